@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// AuditCmd defines audit command.
+func AuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "View and verify the audit log of admin operations of the connected Easegress member",
+	}
+
+	cmd.AddCommand(listAuditCmd())
+	cmd.AddCommand(verifyAuditCmd())
+	return cmd
+}
+
+func listAuditCmd() *cobra.Command {
+	var principal, name, since string
+	var limit int
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List audit records",
+		Example: "egctl audit list --principal admin --limit 10",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if principal != "" {
+				query.Set("principal", principal)
+			}
+			if name != "" {
+				query.Set("name", name)
+			}
+			if since != "" {
+				query.Set("since", since)
+			}
+			if limit > 0 {
+				query.Set("limit", strconv.Itoa(limit))
+			}
+
+			u := makeURL(auditURL)
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			handleRequest(http.MethodGet, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&principal, "principal", "", "Only list records of the principal.")
+	cmd.Flags().StringVar(&name, "name", "", "Only list records of the object.")
+	cmd.Flags().StringVar(&since, "since", "", "Only list records since the time, in RFC3339 format.")
+	cmd.Flags().IntVar(&limit, "limit", 0, "The max number of the latest records, 0 means no limit.")
+
+	return cmd
+}
+
+func verifyAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the hash chain of the audit log",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(auditVerifyURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// BlockCmd defines block command.
+func BlockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "block",
+		Short: "View and change config blocks shared by objects",
+	}
+
+	cmd.AddCommand(listBlocksCmd())
+	cmd.AddCommand(getBlockCmd())
+	cmd.AddCommand(createBlockCmd())
+	cmd.AddCommand(updateBlockCmd())
+	cmd.AddCommand(deleteBlockCmd())
+
+	return cmd
+}
+
+func createBlockCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Create a block from a yaml file or stdin",
+		Example: "egctl block create -f <block.yaml>",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, _ := readFromFileOrStdin(specFile, cmd)
+			handleRequest(http.MethodPost, makeURL(blocksURL), buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the block.")
+
+	return cmd
+}
+
+func updateBlockCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "update",
+		Short:   "Update a block and all objects referencing it from a yaml file or stdin",
+		Example: "egctl block update -f <block.yaml>",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, name := readFromFileOrStdin(specFile, cmd)
+			handleRequest(http.MethodPut, makeURL(blockURL, name), buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the block.")
+
+	return cmd
+}
+
+func deleteBlockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a block not referenced by objects",
+		Example: "egctl block delete <block_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one block name to be deleted")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(blockURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getBlockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a block with the objects referencing it",
+		Example: "egctl block get <block_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one block name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(blockURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func listBlocksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List all blocks",
+		Example: "egctl block list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(blocksURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
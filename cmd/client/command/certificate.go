@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type certificateFlags struct {
+	specFile    string
+	name        string
+	certFile    string
+	keyFile     string
+	alertBefore string
+}
+
+// CertificateCmd defines certificate command.
+func CertificateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "certificate",
+		Short: "View, upload and rotate certificates in the certificate store",
+	}
+
+	cmd.AddCommand(listCertificatesCmd())
+	cmd.AddCommand(getCertificateCmd())
+	cmd.AddCommand(createCertificateCmd())
+	cmd.AddCommand(updateCertificateCmd())
+	cmd.AddCommand(deleteCertificateCmd())
+
+	return cmd
+}
+
+func (f *certificateFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.specFile, "file", "f", "", "A yaml file specifying the certificate.")
+	cmd.Flags().StringVar(&f.name, "name", "", "The name of the certificate, instead of the yaml file.")
+	cmd.Flags().StringVar(&f.certFile, "cert", "", "The PEM file of the certificate chain, used with --name.")
+	cmd.Flags().StringVar(&f.keyFile, "key", "", "The PEM file of the private key, used with --name.")
+	cmd.Flags().StringVar(&f.alertBefore, "alert-before", "", "How long before the expiry to alert, e.g. 168h, used with --name.")
+}
+
+// read reads the certificate from the yaml file or stdin, or builds it
+// from the PEM files.
+func (f *certificateFlags) read(cmd *cobra.Command) ([]byte, string) {
+	if f.name == "" {
+		return readFromFileOrStdin(f.specFile, cmd)
+	}
+
+	if f.certFile == "" || f.keyFile == "" {
+		ExitWithErrorf("%s failed: both --cert and --key are required with --name", cmd.Short)
+	}
+	certPEM, err := ioutil.ReadFile(f.certFile)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	keyPEM, err := ioutil.ReadFile(f.keyFile)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	buff, err := yaml.Marshal(map[string]string{
+		"name":        f.name,
+		"certBase64":  base64.StdEncoding.EncodeToString(certPEM),
+		"keyBase64":   base64.StdEncoding.EncodeToString(keyPEM),
+		"alertBefore": f.alertBefore,
+	})
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	return buff, f.name
+}
+
+func createCertificateCmd() *cobra.Command {
+	flags := &certificateFlags{}
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Upload a certificate from a yaml file, stdin or PEM files",
+		Example: "egctl certificate create --name web --cert web.crt --key web.key",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, _ := flags.read(cmd)
+			handleRequest(http.MethodPost, makeURL(certificatesURL), buff, cmd)
+		},
+	}
+
+	flags.register(cmd)
+
+	return cmd
+}
+
+func updateCertificateCmd() *cobra.Command {
+	flags := &certificateFlags{}
+	cmd := &cobra.Command{
+		Use:     "update",
+		Short:   "Rotate a certificate from a yaml file, stdin or PEM files",
+		Example: "egctl certificate update --name web --cert web.crt --key web.key",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, name := flags.read(cmd)
+			handleRequest(http.MethodPut, makeURL(certificateURL, name), buff, cmd)
+		},
+	}
+
+	flags.register(cmd)
+
+	return cmd
+}
+
+func deleteCertificateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a certificate",
+		Example: "egctl certificate delete <certificate_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one certificate name to be deleted")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(certificateURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getCertificateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get the information of a certificate",
+		Example: "egctl certificate get <certificate_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one certificate name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(certificateURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func listCertificatesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the information of all certificates",
+		Example: "egctl certificate list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(certificatesURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -19,10 +19,17 @@ package command
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	yamljsontool "github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
@@ -34,6 +41,17 @@ type (
 	GlobalFlags struct {
 		Server       string
 		OutputFormat string
+		Token        string
+		// IfMatch is the header If-Match of the requests updating or
+		// deleting resources.
+		IfMatch string
+
+		// TLS flags, the admin API is accessed over TLS if any of them
+		// is set or the server starts with https://.
+		CAFile             string
+		CertFile           string
+		KeyFile            string
+		InsecureSkipVerify bool
 	}
 
 	// APIErr is the standard return of error.
@@ -55,14 +73,72 @@ const (
 
 	membersURL = apiURL + "/status/members"
 	memberURL  = apiURL + "/status/members/%s"
+	raftURL    = apiURL + "/status/raft"
 
 	objectKindsURL = apiURL + "/object-kinds"
 	objectsURL     = apiURL + "/objects"
+	objectBatchURL = apiURL + "/object-batch"
 	objectURL      = apiURL + "/objects/%s"
 
+	objectSplitterWeightsURL = apiURL + "/objects/%s/splitters/%s/weights"
+	objectFlagsURL           = apiURL + "/objects/%s/flags"
+	objectFlagURL            = apiURL + "/objects/%s/flags/%s"
+	objectVersionsURL        = apiURL + "/objects/%s/versions"
+	objectVersionURL         = apiURL + "/objects/%s/versions/%s"
+	objectRollbackURL        = apiURL + "/objects/%s/rollback"
+	objectReplayURL          = apiURL + "/objects/%s/replay"
+	objectDryRunURL          = apiURL + "/objects/%s/dryrun"
+	objectFilterStateURL     = apiURL + "/objects/%s/filters/%s/state"
+
+	validateURL = apiURL + "/validate"
+	lintURL     = apiURL + "/lint"
+
+	consumersURL    = apiURL + "/consumers"
+	consumerURL     = apiURL + "/consumers/%s"
+	consumerKeysURL = apiURL + "/consumers/%s/keys"
+	consumerKeyURL  = apiURL + "/consumers/%s/keys/%s"
+
+	pluginsURL    = apiURL + "/plugins"
+	pluginKindURL = apiURL + "/plugins/kinds/%s"
+
+	certificatesURL = apiURL + "/certificates"
+	certificateURL  = apiURL + "/certificates/%s"
+
+	auditURL       = apiURL + "/audit"
+	auditVerifyURL = apiURL + "/audit/verify"
+
+	namespacesURL = apiURL + "/namespaces"
+	namespaceURL  = apiURL + "/namespaces/%s"
+
+	blocksURL = apiURL + "/blocks"
+	blockURL  = apiURL + "/blocks/%s"
+
+	historyURL          = apiURL + "/history"
+	revisionURL         = apiURL + "/history/%s"
+	revisionDiffURL     = apiURL + "/history/%s/diff"
+	revisionRollbackURL = apiURL + "/history/%s/rollback"
+
+	deploymentsURL = apiURL + "/deployments"
+	deploymentURL  = apiURL + "/deployments/%s"
+
+	restartsURL = apiURL + "/restarts"
+	restartURL  = apiURL + "/restarts/%s"
+
+	schemasURL      = apiURL + "/schemas"
+	objectSchemaURL = apiURL + "/schemas/objects/%s"
+	filterSchemaURL = apiURL + "/schemas/filters/%s"
+	openAPIURL      = apiURL + "/openapi"
+
+	eventsURL     = apiURL + "/events"
+	accessLogsURL = apiURL + "/access-logs"
+
 	statusObjectURL  = apiURL + "/status/objects/%s"
 	statusObjectsURL = apiURL + "/status/objects"
 
+	federationRegionsURL = apiURL + "/federation/regions"
+	federationRegionURL  = apiURL + "/federation/regions/%s"
+	federationStatsURL   = apiURL + "/federation/stats"
+
 	// MeshTenantsURL is the mesh tenant prefix.
 	MeshTenantsURL = apiURL + "/mesh/tenants"
 
@@ -107,7 +183,56 @@ const (
 )
 
 func makeURL(urlTemplate string, a ...interface{}) string {
-	return "http://" + CommandlineGlobalFlags.Server + fmt.Sprintf(urlTemplate, a...)
+	return serverURL() + fmt.Sprintf(urlTemplate, a...)
+}
+
+// serverURL returns the URL of the server, the scheme is https if it's
+// not in the address of the server but any TLS flag is set.
+func serverURL() string {
+	f := &CommandlineGlobalFlags
+	if strings.HasPrefix(f.Server, "http://") || strings.HasPrefix(f.Server, "https://") {
+		return strings.TrimSuffix(f.Server, "/")
+	}
+	if f.CAFile != "" || f.CertFile != "" || f.InsecureSkipVerify {
+		return "https://" + f.Server
+	}
+	return "http://" + f.Server
+}
+
+var (
+	clientOnce sync.Once
+	client     *http.Client
+)
+
+// httpClient returns the client to access the admin API with the TLS
+// flags.
+func httpClient() *http.Client {
+	clientOnce.Do(func() {
+		f := &CommandlineGlobalFlags
+		config := &tls.Config{InsecureSkipVerify: f.InsecureSkipVerify}
+		if f.CAFile != "" {
+			buff, err := ioutil.ReadFile(f.CAFile)
+			if err != nil {
+				ExitWithErrorf("read ca file failed: %v", err)
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(buff) {
+				ExitWithErrorf("no certificate in ca file %s", f.CAFile)
+			}
+		}
+		if f.CertFile != "" || f.KeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+			if err != nil {
+				ExitWithErrorf("load client certificate failed: %v", err)
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		client = &http.Client{Transport: transport}
+	})
+	return client
 }
 
 func successfulStatusCode(code int) bool {
@@ -115,12 +240,37 @@ func successfulStatusCode(code int) bool {
 }
 
 func handleRequest(httpMethod string, url string, reqBody []byte, cmd *cobra.Command) {
+	body := doRequest(httpMethod, url, reqBody, cmd)
+	if len(body) != 0 {
+		printBody(body)
+	}
+}
+
+// doRequest sends the request and returns the body of the successful
+// response, it exits with the error otherwise.
+func doRequest(httpMethod string, url string, reqBody []byte, cmd *cobra.Command) []byte {
+	body, _ := doRequestWithHeader(httpMethod, url, reqBody, cmd)
+	return body
+}
+
+// doRequestWithHeader is doRequest returning the header of the response
+// too.
+func doRequestWithHeader(httpMethod string, url string, reqBody []byte, cmd *cobra.Command) ([]byte, http.Header) {
 	req, err := http.NewRequest(httpMethod, url, bytes.NewReader(reqBody))
 	if err != nil {
 		ExitWithError(err)
 	}
+	if CommandlineGlobalFlags.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+CommandlineGlobalFlags.Token)
+	}
+	if CommandlineGlobalFlags.IfMatch != "" && (httpMethod == http.MethodPut || httpMethod == http.MethodDelete) {
+		req.Header.Set("If-Match", CommandlineGlobalFlags.IfMatch)
+	}
+	// NOTE: Some APIs respond JSON by default, it's converted back in
+	// printBody if JSON output is wanted.
+	req.Header.Set("Accept", "text/vnd.yaml")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient().Do(req)
 	if err != nil {
 		ExitWithErrorf("%s failed: %v", cmd.Short, err)
 	}
@@ -141,8 +291,51 @@ func handleRequest(httpMethod string, url string, reqBody []byte, cmd *cobra.Com
 		ExitWithErrorf("%d: %s", apiErr.Code, msg)
 	}
 
-	if len(body) != 0 {
-		printBody(body)
+	return body, resp.Header
+}
+
+// listFlags are the flags of filtering and paging of list commands.
+type listFlags struct {
+	name   string
+	kind   string
+	limit  int
+	cont   string
+	fields string
+}
+
+func (f *listFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.name, "name", "", "Only list items whose names match the glob pattern, e.g. shop-*.")
+	cmd.Flags().StringVar(&f.kind, "kind", "", "Only list items of the kinds separated by commas.")
+	cmd.Flags().IntVar(&f.limit, "limit", 0, "The max number of items in a page, 0 means no limit.")
+	cmd.Flags().StringVar(&f.cont, "continue", "", "The token of the page printed by the previous page.")
+	cmd.Flags().StringVar(&f.fields, "fields", "", "Only print the top-level fields separated by commas, name and kind are always printed.")
+}
+
+func (f *listFlags) url(u string) string {
+	query := url.Values{}
+	for k, v := range map[string]string{"name": f.name, "kind": f.kind, "continue": f.cont, "fields": f.fields} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if f.limit > 0 {
+		query.Set("limit", strconv.Itoa(f.limit))
+	}
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// handleListRequest lists the items, and prints the token of the next
+// page to stderr if there is one.
+func handleListRequest(u string, cmd *cobra.Command) {
+	body, header := doRequestWithHeader(http.MethodGet, u, nil, cmd)
+	printBody(body)
+
+	if cont := header.Get("X-Continue"); cont != "" {
+		fmt.Fprintf(os.Stderr, "more items, list the next page with --continue %s\n", cont)
 	}
 }
 
@@ -162,6 +355,45 @@ func printBody(body []byte) {
 	fmt.Printf("%s", output)
 }
 
+// splitDocs splits the multiple YAML documents, each of them is a spec or
+// a list of specs, into the specs. A single spec is returned as it is.
+func splitDocs(buff []byte, cmd *cobra.Command) [][]byte {
+	var docs []interface{}
+	decoder := yaml.NewDecoder(bytes.NewReader(buff))
+	for {
+		var doc interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ExitWithErrorf("%s failed, invalid spec: %v", cmd.Short, err)
+		}
+
+		switch doc := doc.(type) {
+		case nil:
+		case []interface{}:
+			docs = append(docs, doc...)
+		default:
+			docs = append(docs, doc)
+		}
+	}
+
+	if len(docs) <= 1 {
+		return [][]byte{buff}
+	}
+
+	specs := make([][]byte, 0, len(docs))
+	for _, doc := range docs {
+		spec, err := yaml.Marshal(doc)
+		if err != nil {
+			ExitWithErrorf("%s failed: %v", cmd.Short, err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
 func readFromFileOrStdin(specFile string, cmd *cobra.Command) ([]byte, string) {
 	var buff []byte
 	var err error
@@ -178,13 +410,23 @@ func readFromFileOrStdin(specFile string, cmd *cobra.Command) ([]byte, string) {
 	}
 
 	var spec struct {
-		Kind string `yaml:"kind"`
-		Name string `yaml:"name"`
+		Kind      string `yaml:"kind"`
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
 	}
 	err = yaml.Unmarshal(buff, &spec)
 	if err != nil {
 		ExitWithErrorf("%s failed, invalid spec: %v", cmd.Short, err)
 	}
 
-	return buff, spec.Name
+	return buff, objectName(spec.Namespace, spec.Name)
+}
+
+// objectName returns the name of the object in the admin API, which is
+// prefixed by the namespace if any.
+func objectName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
 }
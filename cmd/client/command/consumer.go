@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConsumerCmd defines consumer command.
+func ConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "consumer",
+		Short: "View and change consumers and their API keys",
+	}
+
+	cmd.AddCommand(listConsumersCmd())
+	cmd.AddCommand(getConsumerCmd())
+	cmd.AddCommand(createConsumerCmd())
+	cmd.AddCommand(updateConsumerCmd())
+	cmd.AddCommand(deleteConsumerCmd())
+	cmd.AddCommand(createKeyCmd())
+	cmd.AddCommand(listKeysCmd())
+	cmd.AddCommand(revokeKeyCmd())
+
+	return cmd
+}
+
+func createConsumerCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a consumer from a yaml file or stdin",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, _ := readFromFileOrStdin(specFile, cmd)
+			handleRequest(http.MethodPost, makeURL(consumersURL), buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the consumer.")
+
+	return cmd
+}
+
+func updateConsumerCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update a consumer from a yaml file or stdin",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, name := readFromFileOrStdin(specFile, cmd)
+			handleRequest(http.MethodPut, makeURL(consumerURL, name), buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the consumer.")
+
+	return cmd
+}
+
+func deleteConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a consumer and revoke all of its keys",
+		Example: "egctl consumer delete <consumer_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one consumer name to be deleted")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(consumerURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a consumer",
+		Example: "egctl consumer get <consumer_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one consumer name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(consumerURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func listConsumersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List all consumers",
+		Example: "egctl consumer list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(consumersURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func createKeyCmd() *cobra.Command {
+	var description, ttl string
+	cmd := &cobra.Command{
+		Use:     "create-key",
+		Short:   "Create an API key for a consumer, the key is only displayed once",
+		Example: "egctl consumer create-key <consumer_name> --ttl 720h",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one consumer name")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := yaml.Marshal(map[string]string{
+				"description": description,
+				"ttl":         ttl,
+			})
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+
+			handleRequest(http.MethodPost, makeURL(consumerKeysURL, args[0]), body, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&description, "description", "", "The description of the key.")
+	cmd.Flags().StringVar(&ttl, "ttl", "", "The time to live of the key, e.g. 720h, never expires if empty.")
+
+	return cmd
+}
+
+func listKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list-keys",
+		Short:   "List API keys of a consumer",
+		Example: "egctl consumer list-keys <consumer_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one consumer name")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(consumerKeysURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func revokeKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "revoke-key",
+		Short:   "Revoke an API key of a consumer",
+		Example: "egctl consumer revoke-key <consumer_name> <key_id>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("requires consumer name and key id")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(consumerKeyURL, args[0], args[1]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// DeploymentCmd defines deployment command.
+func DeploymentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deployment",
+		Short: "Deploy the complete set of objects to all members at once",
+	}
+
+	cmd.AddCommand(createDeploymentCmd())
+	cmd.AddCommand(listDeploymentsCmd())
+	cmd.AddCommand(getDeploymentCmd())
+	return cmd
+}
+
+func createDeploymentCmd() *cobra.Command {
+	var specFile, timeout string
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Deploy the complete set of objects from a yaml file or stdin",
+		Long:    "Deploy the complete set of objects from a yaml file or stdin, all members prepare them first and switch to them at once, objects not in the set are deleted",
+		Example: "egctl deployment create -f objects.yaml [--timeout 1m]",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, _ := readFromFileOrStdin(specFile, cmd)
+
+			u := makeURL(deploymentsURL)
+			if timeout != "" {
+				u += "?" + url.Values{"timeout": []string{timeout}}.Encode()
+			}
+			handleRequest(http.MethodPost, u, buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the objects.")
+	cmd.Flags().StringVar(&timeout, "timeout", "", "How long to wait for members to prepare the objects, 30s by default.")
+
+	return cmd
+}
+
+func listDeploymentsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List recent deployments",
+		Example: "egctl deployment list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(deploymentsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getDeploymentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a deployment with the results of all members",
+		Example: "egctl deployment get <id>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one deployment id")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(deploymentURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const describeAccessLogLimit = 10
+
+// DescribeCmd defines describe command.
+func DescribeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Show the details of objects",
+	}
+
+	cmd.AddCommand(describePipelineCmd())
+
+	return cmd
+}
+
+func describePipelineCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "pipeline",
+		Short:   "Show the spec, versions, status and recent requests of a pipeline",
+		Example: "egctl describe pipeline <pipeline_name>",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+
+			spec := yaml.MapSlice{}
+			unmarshalBody(doRequest(http.MethodGet, makeURL(objectURL, name), nil, cmd), &spec)
+			for _, item := range spec {
+				if item.Key == "kind" && item.Value != "HTTPPipeline" {
+					ExitWithErrorf("%s is a %v, not a pipeline", name, item.Value)
+				}
+			}
+
+			var versions, status, requests interface{}
+			unmarshalBody(doRequest(http.MethodGet, makeURL(objectVersionsURL, name), nil, cmd), &versions)
+			unmarshalBody(doRequest(http.MethodGet, makeURL(statusObjectURL, name), nil, cmd), &status)
+			query := url.Values{"pipeline": {name}, "limit": {strconv.Itoa(describeAccessLogLimit)}}
+			unmarshalBody(doRequest(http.MethodGet, makeURL(accessLogsURL)+"?"+query.Encode(), nil, cmd), &requests)
+
+			description := yaml.MapSlice{
+				{Key: "spec", Value: spec},
+				{Key: "versions", Value: versions},
+				{Key: "status", Value: status},
+				{Key: "recentRequests", Value: requests},
+			}
+			buff, err := yaml.Marshal(description)
+			if err != nil {
+				ExitWithErrorf("marshal %#v to yaml failed: %v", description, err)
+			}
+			printBody(buff)
+		},
+	}
+
+	return cmd
+}
+
+func unmarshalBody(body []byte, v interface{}) {
+	err := yaml.Unmarshal(body, v)
+	if err != nil {
+		ExitWithErrorf("unmarshal %s failed: %v", body, err)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	yamljsontool "github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+func objectEventsCmd() *cobra.Command {
+	var name, kind string
+	cmd := &cobra.Command{
+		Use:     "events",
+		Short:   "Watch events of object changes",
+		Example: "egctl object events --kind HTTPPipeline --name 'shop-*'",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if name != "" {
+				query.Set("name", name)
+			}
+			if kind != "" {
+				query.Set("kind", kind)
+			}
+
+			u := makeURL(eventsURL)
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			watchEvents(u, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Only watch objects whose names match the glob pattern.")
+	cmd.Flags().StringVar(&kind, "kind", "", "Only watch objects of the kinds separated by commas.")
+
+	return cmd
+}
+
+// watchEvents prints the events until the server closes the stream, each
+// event is printed as a YAML document or a line of JSON.
+func watchEvents(u string, cmd *cobra.Command) {
+	readServerSentEvents(u, cmd, func(data string) {
+		if CommandlineGlobalFlags.OutputFormat == "json" {
+			fmt.Println(data)
+			return
+		}
+		output, err := yamljsontool.JSONToYAML([]byte(data))
+		if err != nil {
+			ExitWithErrorf("json %s to yaml failed: %v", data, err)
+		}
+		fmt.Printf("---\n%s", output)
+	})
+}
+
+// readServerSentEvents calls fn with the data of every server-sent event
+// until the server closes the stream.
+func readServerSentEvents(u string, cmd *cobra.Command, fn func(data string)) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		ExitWithError(err)
+	}
+	if CommandlineGlobalFlags.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+CommandlineGlobalFlags.Token)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	if !successfulStatusCode(resp.StatusCode) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		msg := string(body)
+		apiErr := &APIErr{}
+		err = yaml.Unmarshal(body, apiErr)
+		if err == nil {
+			msg = apiErr.Message
+		}
+		ExitWithErrorf("%d: %s", apiErr.Code, msg)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") {
+			fn(strings.TrimPrefix(line, "data: "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+}
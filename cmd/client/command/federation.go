@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// FederationCmd defines federation command.
+func FederationCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "federation",
+		Short: "View the secondary regions reporting to this primary region",
+	}
+
+	cmd.AddCommand(listRegionsCmd())
+	cmd.AddCommand(federationStatsCmd())
+	cmd.AddCommand(deleteRegionCmd())
+	return cmd
+}
+
+func listRegionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "regions",
+		Short:   "List the reports of secondary regions",
+		Example: "egctl federation regions",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(federationRegionsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func federationStatsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "stats",
+		Short:   "Show the stats of pipelines summed up in all secondary regions",
+		Example: "egctl federation stats",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(federationStatsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func deleteRegionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete <region>",
+		Short:   "Delete the report of a secondary region which is retired",
+		Example: "egctl federation delete eu-west",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one region to be deleted")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(federationRegionURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// HistoryCmd defines history command.
+func HistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "View the revisions of the whole config and roll back to one of them",
+	}
+
+	cmd.AddCommand(listRevisionsCmd())
+	cmd.AddCommand(getRevisionCmd())
+	cmd.AddCommand(diffRevisionCmd())
+	cmd.AddCommand(rollbackRevisionCmd())
+	return cmd
+}
+
+func listRevisionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List revisions of the config",
+		Example: "egctl history list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(historyURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getRevisionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a revision with the specs of all objects in it",
+		Example: "egctl history get <revision>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one revision")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(revisionURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func diffRevisionCmd() *cobra.Command {
+	var to string
+	cmd := &cobra.Command{
+		Use:     "diff",
+		Short:   "Show the changes from a revision to another one, the running config by default",
+		Example: "egctl history diff <revision> [--to <revision>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one revision")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			u := makeURL(revisionDiffURL, args[0])
+			if to != "" {
+				u += "?" + url.Values{"to": []string{to}}.Encode()
+			}
+			handleRequest(http.MethodGet, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", "", "The revision to compare with.")
+
+	return cmd
+}
+
+func rollbackRevisionCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   "Roll back all objects to a revision",
+		Example: "egctl history rollback <revision> [--dry-run]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one revision to be rolled back to")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			u := makeURL(revisionRollbackURL, args[0])
+			if dryRun {
+				u += "?dryRun=true"
+			}
+			handleRequest(http.MethodPost, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only report the changes without making them.")
+
+	return cmd
+}
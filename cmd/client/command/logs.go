@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type accessRecord struct {
+	Time       string `yaml:"time" json:"time"`
+	Pipeline   string `yaml:"pipeline" json:"pipeline"`
+	RequestID  string `yaml:"requestID" json:"requestID"`
+	RealIP     string `yaml:"realIP" json:"realIP"`
+	Method     string `yaml:"method" json:"method"`
+	Path       string `yaml:"path" json:"path"`
+	StatusCode int    `yaml:"statusCode" json:"statusCode"`
+	Duration   string `yaml:"duration" json:"duration"`
+}
+
+// LogsCmd defines logs command.
+func LogsCmd() *cobra.Command {
+	var pipeline, requestID string
+	var limit int
+	var follow bool
+	cmd := &cobra.Command{
+		Use:     "logs",
+		Short:   "Print access logs of pipelines of the connected Easegress member",
+		Example: "egctl logs --pipeline 'shop-*' --request-id 5f1c3a -f",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if pipeline != "" {
+				query.Set("pipeline", pipeline)
+			}
+			if requestID != "" {
+				query.Set("requestID", requestID)
+			}
+			query.Set("limit", strconv.Itoa(limit))
+
+			if !follow {
+				body := doRequest(http.MethodGet, makeURL(accessLogsURL)+"?"+query.Encode(), nil, cmd)
+				records := []*accessRecord{}
+				err := yaml.Unmarshal(body, &records)
+				if err != nil {
+					ExitWithErrorf("unmarshal access logs failed: %v", err)
+				}
+				for _, record := range records {
+					printAccessRecord(record)
+				}
+				return
+			}
+
+			query.Set("follow", "true")
+			readServerSentEvents(makeURL(accessLogsURL)+"?"+query.Encode(), cmd, func(data string) {
+				record := &accessRecord{}
+				err := json.Unmarshal([]byte(data), record)
+				if err != nil {
+					ExitWithErrorf("unmarshal access log %s failed: %v", data, err)
+				}
+				printAccessRecord(record)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&pipeline, "pipeline", "", "Only print logs of pipelines whose names match the glob pattern.")
+	cmd.Flags().StringVar(&requestID, "request-id", "", "Only print logs of the request ID, which is the header X-Request-Id.")
+	cmd.Flags().IntVar(&limit, "tail", 100, "The number of the latest logs to print, 0 means all logs kept by the member.")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new logs.")
+
+	return cmd
+}
+
+// printAccessRecord prints the record in a line, or a line of JSON.
+func printAccessRecord(record *accessRecord) {
+	if CommandlineGlobalFlags.OutputFormat == "json" {
+		buff, err := json.Marshal(record)
+		if err != nil {
+			ExitWithErrorf("marshal %#v to json failed: %v", record, err)
+		}
+		fmt.Println(string(buff))
+		return
+	}
+
+	requestID := record.RequestID
+	if requestID == "" {
+		requestID = "-"
+	}
+	fmt.Printf("%s %s %s %s %s %s %d %s\n", record.Time, record.Pipeline, requestID,
+		record.RealIP, record.Method, record.Path, record.StatusCode, record.Duration)
+}
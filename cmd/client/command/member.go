@@ -33,6 +33,7 @@ func MemberCmd() *cobra.Command {
 
 	cmd.AddCommand(listMemberCmd())
 	cmd.AddCommand(purgeMemberCmd())
+	cmd.AddCommand(raftMemberCmd())
 	return cmd
 }
 
@@ -67,3 +68,17 @@ func purgeMemberCmd() *cobra.Command {
 
 	return cmd
 }
+
+func raftMemberCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "raft",
+		Short:   "Show the raft status of the cluster",
+		Long:    "Show the raft leader, term, commit index and voters of the etcd cluster storing the config",
+		Example: "egctl member raft",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(raftURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
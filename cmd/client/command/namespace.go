@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// NamespaceCmd defines namespace command.
+func NamespaceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "namespace",
+		Short: "View and change namespaces isolating objects of teams",
+	}
+
+	cmd.AddCommand(listNamespacesCmd())
+	cmd.AddCommand(getNamespaceCmd())
+	cmd.AddCommand(createNamespaceCmd())
+	cmd.AddCommand(updateNamespaceCmd())
+	cmd.AddCommand(deleteNamespaceCmd())
+
+	return cmd
+}
+
+func createNamespaceCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Create a namespace from a yaml file or stdin",
+		Example: "egctl namespace create -f <namespace.yaml>",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, _ := readFromFileOrStdin(specFile, cmd)
+			handleRequest(http.MethodPost, makeURL(namespacesURL), buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the namespace.")
+
+	return cmd
+}
+
+func updateNamespaceCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "update",
+		Short:   "Update a namespace from a yaml file or stdin",
+		Example: "egctl namespace update -f <namespace.yaml>",
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, name := readFromFileOrStdin(specFile, cmd)
+			handleRequest(http.MethodPut, makeURL(namespaceURL, name), buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the namespace.")
+
+	return cmd
+}
+
+func deleteNamespaceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a namespace without objects",
+		Example: "egctl namespace delete <namespace_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one namespace name to be deleted")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(namespaceURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getNamespaceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a namespace with the number of objects in it",
+		Example: "egctl namespace get <namespace_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one namespace name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(namespaceURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func listNamespacesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List all namespaces",
+		Example: "egctl namespace list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(namespacesURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
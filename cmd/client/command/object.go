@@ -19,9 +19,18 @@ package command
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/util/starlarkgen"
 )
 
 // ObjectCmd defines object command.
@@ -37,8 +46,23 @@ func ObjectCmd() *cobra.Command {
 	cmd.AddCommand(getObjectCmd())
 	cmd.AddCommand(createObjectCmd())
 	cmd.AddCommand(updateObjectCmd())
+	cmd.AddCommand(applyObjectsCmd())
+	cmd.AddCommand(batchObjectsCmd())
+	cmd.AddCommand(diffObjectsCmd())
+	cmd.AddCommand(validateObjectsCmd())
+	cmd.AddCommand(lintObjectsCmd())
 	cmd.AddCommand(deleteObjectCmd())
 	cmd.AddCommand(statusObjectCmd())
+	cmd.AddCommand(renderObjectCmd())
+	cmd.AddCommand(setWeightsCmd())
+	cmd.AddCommand(objectFlagsCmd())
+	cmd.AddCommand(setFlagsCmd())
+	cmd.AddCommand(objectVersionsCmd())
+	cmd.AddCommand(rollbackObjectCmd())
+	cmd.AddCommand(replayObjectCmd())
+	cmd.AddCommand(filterStateCmd())
+	cmd.AddCommand(dryRunObjectCmd())
+	cmd.AddCommand(objectEventsCmd())
 
 	return cmd
 }
@@ -60,13 +84,23 @@ func createObjectCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "create",
 		Short: "Create an object from a yaml file or stdin",
+		Long:  "Create an object from a yaml file or stdin, or create objects from multiple yaml documents or generated by a starlark(.star) file",
 		Run: func(cmd *cobra.Command, args []string) {
+			if isStarlarkFile(specFile) {
+				for _, spec := range generateSpecs(specFile, cmd) {
+					handleRequest(http.MethodPost, makeURL(objectsURL), spec.buff, cmd)
+				}
+				return
+			}
+
 			buff, _ := readFromFileOrStdin(specFile, cmd)
-			handleRequest(http.MethodPost, makeURL(objectsURL), buff, cmd)
+			for _, spec := range splitDocs(buff, cmd) {
+				handleRequest(http.MethodPost, makeURL(objectsURL), spec, cmd)
+			}
 		},
 	}
 
-	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the object.")
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml or starlark file specifying the objects.")
 
 	return cmd
 }
@@ -76,13 +110,215 @@ func updateObjectCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "update",
 		Short: "Update an object from a yaml file or stdin",
+		Long:  "Update an object from a yaml file or stdin, or update objects from multiple yaml documents or generated by a starlark(.star) file",
+		Run: func(cmd *cobra.Command, args []string) {
+			if isStarlarkFile(specFile) {
+				for _, spec := range generateSpecs(specFile, cmd) {
+					handleRequest(http.MethodPut, makeURL(objectURL, spec.name), spec.buff, cmd)
+				}
+				return
+			}
+
+			buff, _ := readFromFileOrStdin(specFile, cmd)
+			for _, spec := range splitDocs(buff, cmd) {
+				var meta struct {
+					Name      string `yaml:"name"`
+					Namespace string `yaml:"namespace"`
+				}
+				err := yaml.Unmarshal(spec, &meta)
+				if err != nil {
+					ExitWithErrorf("%s failed, invalid spec: %v", cmd.Short, err)
+				}
+				handleRequest(http.MethodPut, makeURL(objectURL, objectName(meta.Namespace, meta.Name)), spec, cmd)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml or starlark file specifying the objects.")
+
+	return cmd
+}
+
+func applyObjectsCmd() *cobra.Command {
+	var specFile string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply the complete set of objects from a yaml file or stdin",
+		Long:  "Apply the complete set of objects from a yaml file or stdin, or generated by a starlark(.star) file, objects not in the set are deleted",
+		Run: func(cmd *cobra.Command, args []string) {
+			var buff []byte
+			if isStarlarkFile(specFile) {
+				for _, spec := range generateSpecs(specFile, cmd) {
+					buff = append(buff, "---\n"...)
+					buff = append(buff, spec.buff...)
+				}
+			} else {
+				buff, _ = readFromFileOrStdin(specFile, cmd)
+			}
+
+			url := makeURL(objectsURL)
+			if dryRun {
+				url += "?dryRun=true"
+			}
+			handleRequest(http.MethodPut, url, buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml or starlark file specifying the objects.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the plan without applying it.")
+
+	return cmd
+}
+
+func batchObjectsCmd() *cobra.Command {
+	var specFile string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Create or update objects from a yaml file or stdin in one transaction",
+		Long:  "Create or update objects from a yaml file or stdin, or generated by a starlark(.star) file, in one transaction, either all of them are made or none of them, objects not in the file are kept",
+		Run: func(cmd *cobra.Command, args []string) {
+			var buff []byte
+			if isStarlarkFile(specFile) {
+				for _, spec := range generateSpecs(specFile, cmd) {
+					buff = append(buff, "---\n"...)
+					buff = append(buff, spec.buff...)
+				}
+			} else {
+				buff, _ = readFromFileOrStdin(specFile, cmd)
+			}
+
+			url := makeURL(objectBatchURL)
+			if dryRun {
+				url += "?dryRun=true"
+			}
+			handleRequest(http.MethodPost, url, buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml or starlark file specifying the objects.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the plan without applying it.")
+
+	return cmd
+}
+
+func diffObjectsCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Print the diff between the objects in a yaml file or stdin and the running ones",
+		Long:  "Print the diff between the complete set of objects from a yaml file or stdin, or generated by a starlark(.star) file, and the running ones, which is what apply changes",
+		Run: func(cmd *cobra.Command, args []string) {
+			var buff []byte
+			if isStarlarkFile(specFile) {
+				for _, spec := range generateSpecs(specFile, cmd) {
+					buff = append(buff, "---\n"...)
+					buff = append(buff, spec.buff...)
+				}
+			} else {
+				buff, _ = readFromFileOrStdin(specFile, cmd)
+			}
+
+			body := doRequest(http.MethodPut, makeURL(objectsURL)+"?dryRun=true", buff, cmd)
+			plan := &struct {
+				Changes []struct {
+					Action string `yaml:"action"`
+					Kind   string `yaml:"kind"`
+					Name   string `yaml:"name"`
+					Diff   string `yaml:"diff"`
+				} `yaml:"changes"`
+			}{}
+			err := yaml.Unmarshal(body, plan)
+			if err != nil {
+				ExitWithErrorf("unmarshal plan failed: %v", err)
+			}
+
+			if CommandlineGlobalFlags.OutputFormat == "json" {
+				printBody(body)
+				return
+			}
+			if len(plan.Changes) == 0 {
+				fmt.Fprintln(os.Stderr, "no changes")
+				return
+			}
+			for _, change := range plan.Changes {
+				fmt.Printf("# %s %s %s\n%s", change.Action, change.Kind, change.Name, change.Diff)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml or starlark file specifying the objects.")
+
+	return cmd
+}
+
+func validateObjectsCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate objects from a yaml file or stdin without applying them",
+		Long:  "Validate objects from a yaml file or stdin, or generated by a starlark(.star) file, it exits with non-zero code if any of them is invalid",
+		Run: func(cmd *cobra.Command, args []string) {
+			var buff []byte
+			if isStarlarkFile(specFile) {
+				for _, spec := range generateSpecs(specFile, cmd) {
+					buff = append(buff, "---\n"...)
+					buff = append(buff, spec.buff...)
+				}
+			} else {
+				buff, _ = readFromFileOrStdin(specFile, cmd)
+			}
+
+			body := doRequest(http.MethodPost, makeURL(validateURL), buff, cmd)
+			printBody(body)
+
+			result := struct {
+				Valid bool `yaml:"valid"`
+			}{}
+			err := yaml.Unmarshal(body, &result)
+			if err != nil {
+				ExitWithErrorf("unmarshal result failed: %v", err)
+			}
+			if !result.Valid {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml or starlark file specifying the objects.")
+
+	return cmd
+}
+
+func lintObjectsCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Print the warnings of the running objects, or objects from a yaml file",
+		Long:  "Print the warnings of the running objects, or objects from a yaml file or generated by a starlark(.star) file as if they were created or updated, the objects are valid but likely not working as intended",
+		Example: `egctl object lint
+egctl object lint -f objects.yaml`,
 		Run: func(cmd *cobra.Command, args []string) {
-			buff, name := readFromFileOrStdin(specFile, cmd)
-			handleRequest(http.MethodPut, makeURL(objectURL, name), buff, cmd)
+			if specFile == "" {
+				handleRequest(http.MethodGet, makeURL(lintURL), nil, cmd)
+				return
+			}
+
+			var buff []byte
+			if isStarlarkFile(specFile) {
+				for _, spec := range generateSpecs(specFile, cmd) {
+					buff = append(buff, "---\n"...)
+					buff = append(buff, spec.buff...)
+				}
+			} else {
+				buff, _ = readFromFileOrStdin(specFile, cmd)
+			}
+			handleRequest(http.MethodPost, makeURL(lintURL), buff, cmd)
 		},
 	}
 
-	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the object.")
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml or starlark file specifying the objects.")
 
 	return cmd
 }
@@ -108,6 +344,234 @@ func deleteObjectCmd() *cobra.Command {
 	return cmd
 }
 
+func setWeightsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "set-weights",
+		Short:   "Set weights of branches of a Splitter in a pipeline",
+		Example: "egctl object set-weights <pipeline_name> <splitter_name> <branch>=<weight>...",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 3 {
+				return errors.New("requires pipeline name, splitter name and at least one branch weight")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			weights := map[string]int{}
+			for _, arg := range args[2:] {
+				kv := strings.SplitN(arg, "=", 2)
+				if len(kv) != 2 {
+					ExitWithErrorf("%s failed: invalid branch weight %s", cmd.Short, arg)
+				}
+				weight, err := strconv.Atoi(kv[1])
+				if err != nil {
+					ExitWithErrorf("%s failed: invalid weight of branch %s: %v", cmd.Short, kv[0], err)
+				}
+				weights[kv[0]] = weight
+			}
+
+			body, err := yaml.Marshal(weights)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+
+			handleRequest(http.MethodPut, makeURL(objectSplitterWeightsURL, args[0], args[1]), body, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func objectFlagsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "flags",
+		Short:   "Get feature flags of a pipeline",
+		Example: "egctl object flags <pipeline_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one pipeline name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(objectFlagsURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func setFlagsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "set-flags",
+		Short:   "Enable or disable feature flags of a pipeline, the other flags are kept",
+		Example: "egctl object set-flags <pipeline_name> <flag>=<true|false>...",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("requires pipeline name and at least one flag")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			flags := map[string]bool{}
+			for _, arg := range args[1:] {
+				kv := strings.SplitN(arg, "=", 2)
+				if len(kv) != 2 {
+					ExitWithErrorf("%s failed: invalid flag %s", cmd.Short, arg)
+				}
+				enabled, err := strconv.ParseBool(kv[1])
+				if err != nil {
+					ExitWithErrorf("%s failed: invalid value of flag %s: %v", cmd.Short, kv[0], err)
+				}
+				flags[kv[0]] = enabled
+			}
+
+			for flag, enabled := range flags {
+				body := []byte(strconv.FormatBool(enabled))
+				handleRequest(http.MethodPut, makeURL(objectFlagURL, args[0], flag), body, cmd)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func objectVersionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "versions",
+		Short:   "List versions of a pipeline, or get the spec of a version",
+		Example: "egctl object versions <pipeline_name> [<version>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 && len(args) != 2 {
+				return errors.New("requires one pipeline name and an optional version")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 2 {
+				handleRequest(http.MethodGet, makeURL(objectVersionURL, args[0], args[1]), nil, cmd)
+				return
+			}
+			handleRequest(http.MethodGet, makeURL(objectVersionsURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func rollbackObjectCmd() *cobra.Command {
+	var version int64
+	cmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   "Roll back a pipeline to a version, the previous one by default",
+		Example: "egctl object rollback <pipeline_name> [--version <version>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one pipeline name to be rolled back")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			url := makeURL(objectRollbackURL, args[0])
+			if version != 0 {
+				url += fmt.Sprintf("?version=%d", version)
+			}
+			handleRequest(http.MethodPost, url, nil, cmd)
+		},
+	}
+
+	cmd.Flags().Int64Var(&version, "version", 0, "The version to roll back to.")
+
+	return cmd
+}
+
+func replayObjectCmd() *cobra.Command {
+	var from, to string
+	cmd := &cobra.Command{
+		Use:     "replay",
+		Short:   "Replay the requests journaled in a time range through a pipeline",
+		Example: "egctl object replay <pipeline_name> --from <RFC3339 time> [--to <RFC3339 time>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one pipeline name to be replayed")
+			}
+			if from == "" {
+				return errors.New("requires the start time of the range")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{"from": {from}}
+			if to != "" {
+				query.Set("to", to)
+			}
+			handleRequest(http.MethodPost, makeURL(objectReplayURL, args[0])+"?"+query.Encode(), nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "The start time of the range in RFC3339.")
+	cmd.Flags().StringVar(&to, "to", "", "The end time of the range in RFC3339, default is now.")
+
+	return cmd
+}
+
+func filterStateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "state",
+		Short:   "Get the live internal state of a filter in a pipeline, in the member serving the request",
+		Example: "egctl object state <pipeline_name> <filter_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("requires one pipeline name and one filter name")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(objectFilterStateURL, args[0], args[1]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func dryRunObjectCmd() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:     "dryrun",
+		Short:   "Run a synthetic request through a candidate spec of a pipeline without applying it",
+		Example: "egctl object dryrun <pipeline_name> -f <dryrun_file>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one pipeline name to be run")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			buff, _ := readFromFileOrStdin(file, cmd)
+			handleRequest(http.MethodPost, makeURL(objectDryRunURL, args[0]), buff, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "A yaml file specifying the request, the mocks and the candidate spec.")
+
+	return cmd
+}
+
 func getObjectCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "get",
@@ -130,14 +594,16 @@ func getObjectCmd() *cobra.Command {
 }
 
 func listObjectsCmd() *cobra.Command {
+	f := &listFlags{}
 	cmd := &cobra.Command{
 		Use:     "list",
 		Short:   "List all objects",
-		Example: "egctl object list",
+		Example: "egctl object list --kind HTTPPipeline --name 'shop-*' --limit 50 --fields flow",
 		Run: func(cmd *cobra.Command, args []string) {
-			handleRequest(http.MethodGet, makeURL(objectsURL), nil, cmd)
+			handleListRequest(f.url(makeURL(objectsURL)), cmd)
 		},
 	}
+	f.register(cmd)
 
 	return cmd
 }
@@ -177,14 +643,84 @@ func getStatusObjectCmd() *cobra.Command {
 }
 
 func listStatusObjectsCmd() *cobra.Command {
+	f := &listFlags{}
 	cmd := &cobra.Command{
 		Use:     "list",
 		Short:   "List all status of objects",
-		Example: "egctl object status list",
+		Example: "egctl object status list --kind HTTPServer",
 		Run: func(cmd *cobra.Command, args []string) {
-			handleRequest(http.MethodGet, makeURL(statusObjectsURL), nil, cmd)
+			handleListRequest(f.url(makeURL(statusObjectsURL)), cmd)
 		},
 	}
+	f.register(cmd)
 
 	return cmd
 }
+
+func renderObjectCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "render",
+		Short:   "Render objects generated by a starlark file",
+		Example: "egctl object render -f pipelines.star",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if !isStarlarkFile(specFile) {
+				return errors.New("requires a starlark(.star) file")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			for i, spec := range generateSpecs(specFile, cmd) {
+				if CommandlineGlobalFlags.OutputFormat == "json" {
+					printBody(spec.buff)
+					fmt.Println()
+					continue
+				}
+
+				if i > 0 {
+					fmt.Println("---")
+				}
+				printBody(spec.buff)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A starlark file generating the objects.")
+
+	return cmd
+}
+
+type generatedSpec struct {
+	name string
+	buff []byte
+}
+
+func isStarlarkFile(specFile string) bool {
+	return filepath.Ext(specFile) == ".star"
+}
+
+func generateSpecs(specFile string, cmd *cobra.Command) []*generatedSpec {
+	specs, err := starlarkgen.New(0).GenerateFile(specFile)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	result := make([]*generatedSpec, 0, len(specs))
+	for _, spec := range specs {
+		name, _ := spec["name"].(string)
+		namespace, _ := spec["namespace"].(string)
+		if name == "" {
+			ExitWithErrorf("%s failed: generated spec without name: %v", cmd.Short, spec)
+		}
+
+		buff, err := yaml.Marshal(spec)
+		if err != nil {
+			ExitWithErrorf("%s failed: marshal %#v to yaml failed: %v", cmd.Short, spec, err)
+		}
+		result = append(result, &generatedSpec{name: objectName(namespace, name), buff: buff})
+	}
+
+	return result
+}
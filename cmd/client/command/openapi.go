@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// OpenAPICmd defines openapi command.
+func OpenAPICmd() *cobra.Command {
+	var server string
+	cmd := &cobra.Command{
+		Use:     "openapi",
+		Short:   "Print the OpenAPI document of the APIs served by HTTP servers",
+		Example: "egctl openapi --server http-server-demo > openapi.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			u := makeURL(openAPIURL)
+			if server != "" {
+				u += "?server=" + url.QueryEscape(server)
+			}
+			handleRequest(http.MethodGet, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&server, "server", "", "Document the APIs of the HTTP server only.")
+
+	return cmd
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// PluginCmd defines plugin command.
+func PluginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "View and unload filter plugins of the connected Easegress member",
+	}
+
+	cmd.AddCommand(listPluginCmd())
+	cmd.AddCommand(unloadPluginKindCmd())
+	return cmd
+}
+
+func listPluginCmd() *cobra.Command {
+	f := &listFlags{}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List loaded plugins",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleListRequest(f.url(makeURL(pluginsURL)), cmd)
+		},
+	}
+	f.register(cmd)
+
+	return cmd
+}
+
+func unloadPluginKindCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "unload <filter kind>",
+		Short:   "Unload a filter kind loaded from plugins",
+		Long:    "Unload a filter kind loaded from plugins. Running pipelines are not affected, but new pipelines could not use it any more",
+		Example: "egctl plugin unload <filter kind>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one filter kind to be unloaded")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(pluginKindURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
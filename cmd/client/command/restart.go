@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// RestartCmd defines restart command.
+func RestartCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "Restart members one by one without losing the capacity of more than one",
+	}
+
+	cmd.AddCommand(createRestartCmd())
+	cmd.AddCommand(listRestartsCmd())
+	cmd.AddCommand(getRestartCmd())
+	return cmd
+}
+
+func createRestartCmd() *cobra.Command {
+	var timeout string
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Start a rolling restart of all live members",
+		Long:    "Start a rolling restart of all live members, every member is gracefully updated after the previous one drains, rejoins the cluster and becomes healthy, the rest are left untouched if any fails",
+		Example: "egctl restart create [--timeout 10m]",
+		Run: func(cmd *cobra.Command, args []string) {
+			u := makeURL(restartsURL)
+			if timeout != "" {
+				u += "?" + url.Values{"timeout": []string{timeout}}.Encode()
+			}
+			handleRequest(http.MethodPost, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&timeout, "timeout", "", "How long every member has to become healthy, 5m by default.")
+
+	return cmd
+}
+
+func listRestartsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List recent rolling restarts and the running one",
+		Example: "egctl restart list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(restartsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getRestartCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a rolling restart with the progress of all members",
+		Example: "egctl restart get <id>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one restart id")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(restartURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// SchemaCmd defines schema command.
+func SchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print JSON schemas of all kinds of objects and filters",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(schemasURL), nil, cmd)
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "object",
+		Short:   "Print the JSON schema of a kind of objects",
+		Example: "egctl schema object HTTPServer",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(objectSchemaURL, args[0]), nil, cmd)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:     "filter",
+		Short:   "Print the JSON schema of a kind of filters, including the ones of plugins",
+		Example: "egctl schema filter Proxy",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(filterSchemaURL, args[0]), nil, cmd)
+		},
+	})
+
+	return cmd
+}
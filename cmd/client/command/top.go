@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// pipelineStats are the stats in the status of a pipeline.
+	pipelineStats struct {
+		Count    uint64  `yaml:"count"`
+		M1       float64 `yaml:"m1"`
+		ErrCount uint64  `yaml:"errCount"`
+		M1Err    float64 `yaml:"m1Err"`
+		Mean     uint64  `yaml:"mean"`
+		P99      float64 `yaml:"p99"`
+	}
+
+	// pipelineTop is the row of a pipeline, the stats of all members are
+	// summed up.
+	pipelineTop struct {
+		name     string
+		members  int
+		count    uint64
+		rps      float64
+		errCount uint64
+		errRPS   float64
+		mean     float64
+		p99      float64
+	}
+)
+
+// TopCmd defines top command.
+func TopCmd() *cobra.Command {
+	var interval time.Duration
+	var once bool
+	cmd := &cobra.Command{
+		Use:     "top",
+		Short:   "Display the live throughput and latency of pipelines",
+		Example: "egctl top --interval 5s",
+		Run: func(cmd *cobra.Command, args []string) {
+			if interval < time.Second {
+				ExitWithErrorf("interval must be at least 1s")
+			}
+
+			for {
+				rows := topPipelines(cmd)
+				if !once {
+					// Clear the screen.
+					fmt.Print("\033[H\033[2J")
+				}
+				printTop(rows)
+				if once {
+					return
+				}
+				time.Sleep(interval)
+			}
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "The interval to refresh.")
+	cmd.Flags().BoolVar(&once, "once", false, "Print once and exit.")
+
+	return cmd
+}
+
+func topPipelines(cmd *cobra.Command) []*pipelineTop {
+	body := doRequest(http.MethodGet, makeURL(statusObjectsURL)+"?kind=HTTPPipeline&fields=stats", nil, cmd)
+
+	status := map[string]map[string]struct {
+		Stats *pipelineStats `yaml:"stats"`
+	}{}
+	err := yaml.Unmarshal(body, &status)
+	if err != nil {
+		ExitWithErrorf("unmarshal status failed: %v", err)
+	}
+
+	rows := make([]*pipelineTop, 0, len(status))
+	for name, members := range status {
+		row := &pipelineTop{name: name}
+		var total float64
+		for _, member := range members {
+			stats := member.Stats
+			if stats == nil {
+				continue
+			}
+			row.members++
+			row.count += stats.Count
+			row.rps += stats.M1
+			row.errCount += stats.ErrCount
+			row.errRPS += stats.M1Err
+			total += float64(stats.Mean) * float64(stats.Count)
+			if stats.P99 > row.p99 {
+				row.p99 = stats.P99
+			}
+		}
+		if row.count > 0 {
+			row.mean = total / float64(row.count)
+		}
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].rps != rows[j].rps {
+			return rows[i].rps > rows[j].rps
+		}
+		return rows[i].name < rows[j].name
+	})
+
+	return rows
+}
+
+// printTop prints the rows, the latencies are in milliseconds and P99 is
+// the max of the members.
+func printTop(rows []*pipelineTop) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PIPELINE\tMEMBERS\tRPS(1m)\tERR%(1m)\tREQUESTS\tERRORS\tMEAN(ms)\tP99(ms)")
+	for _, row := range rows {
+		errPercent := 0.0
+		if row.rps > 0 {
+			errPercent = row.errRPS / row.rps * 100
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%d\t%d\t%.1f\t%.1f\n",
+			row.name, row.members, row.rps, errPercent, row.count, row.errCount, row.mean, row.p99)
+	}
+	w.Flush()
+}
@@ -107,15 +107,42 @@ func main() {
 		command.APICmd(),
 		command.HealthCmd(),
 		command.ObjectCmd(),
+		command.NamespaceCmd(),
+		command.BlockCmd(),
 		command.MemberCmd(),
+		command.PluginCmd(),
+		command.ConsumerCmd(),
+		command.CertificateCmd(),
+		command.AuditCmd(),
+		command.HistoryCmd(),
+		command.DeploymentCmd(),
+		command.RestartCmd(),
+		command.FederationCmd(),
+		command.DescribeCmd(),
+		command.TopCmd(),
+		command.LogsCmd(),
+		command.SchemaCmd(),
+		command.OpenAPICmd(),
 		command.MeshCmd(),
 		completionCmd,
 	)
 
 	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Server,
-		"server", "localhost:2381", "The address of the Easegress endpoint")
+		"server", "localhost:2381", "The address of the Easegress endpoint, which could start with https:// if it's served over TLS")
 	rootCmd.PersistentFlags().StringVarP(&command.CommandlineGlobalFlags.OutputFormat,
 		"output", "o", "yaml", "Output format(json, yaml)")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Token,
+		"token", os.Getenv("EGCTL_TOKEN"), "The bearer token to access the admin API, EGCTL_TOKEN is used if empty")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.IfMatch,
+		"if-match", "", "The ETag of the resource to update or delete, it fails if the resource is changed by others, '*' matches any ETag")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.CAFile,
+		"ca-file", "", "The CA certificate file to verify the admin API served over TLS")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.CertFile,
+		"cert-file", "", "The client certificate file to access the admin API over TLS")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.KeyFile,
+		"key-file", "", "The client private key file to access the admin API over TLS")
+	rootCmd.PersistentFlags().BoolVar(&command.CommandlineGlobalFlags.InsecureSkipVerify,
+		"insecure-skip-verify", false, "Skip verifying the certificate of the admin API, for testing only")
 
 	err := rootCmd.Execute()
 	if err != nil {
@@ -25,15 +25,22 @@ import (
 	"syscall"
 
 	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/certstore"
 	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/common"
+	"github.com/megaease/easegress/pkg/configblock"
+	"github.com/megaease/easegress/pkg/crdt"
 	"github.com/megaease/easegress/pkg/env"
+	"github.com/megaease/easegress/pkg/featureflag"
+	"github.com/megaease/easegress/pkg/goplugin"
 	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
 	"github.com/megaease/easegress/pkg/pidfile"
 	"github.com/megaease/easegress/pkg/profile"
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/interpolation"
 	"github.com/megaease/easegress/pkg/version"
 
 	// For register stuff.
@@ -81,6 +88,32 @@ func main() {
 		logger.Errorf("new cluster failed: %v", err)
 		os.Exit(1)
 	}
+	// NOTE: Plugins must be loaded before creating the supervisor,
+	// since existing pipelines may use the filters in them.
+	pluginLoader, err := goplugin.New(opt)
+	if err != nil {
+		logger.Errorf("new plugin loader failed: %v", err)
+		os.Exit(1)
+	}
+	// NOTE: Secrets must be available before creating the supervisor,
+	// since existing objects may reference them.
+	secretManager, err := secret.New(opt)
+	if err != nil {
+		logger.Errorf("new secret manager failed: %v", err)
+		os.Exit(1)
+	}
+	// NOTE: Objects may reference certificates in the store, it's synced
+	// in the background, so handshakes fail until the first sync.
+	certStore := certstore.New(cls)
+	// NOTE: Blocks are pulled before creating the supervisor, since
+	// existing objects may reference them.
+	blockStore := configblock.New(cls)
+	flagStore := featureflag.New(cls)
+	// NOTE: Plugins of existing pipelines may create shared counters.
+	gossiper := crdt.NewGossiper(opt, cls)
+	// NOTE: Specs of existing objects are interpolated in creating the
+	// supervisor.
+	interpolation.Init(opt)
 	super := supervisor.MustNew(opt, cls)
 	supervisor.InitGlobalSupervisor(super)
 	apiServer := api.MustNewServer(opt, cls)
@@ -112,10 +145,34 @@ func main() {
 	}()
 	logger.Infof("%s signal received, closing easegress", sig)
 
+	// NOTE: The supervisor stops accepting at all traffic gates, then
+	// waits for the requests in flight until the shutdown timeout.
 	wg := &sync.WaitGroup{}
-	wg.Add(4)
+	wg.Add(7)
 	apiServer.Close(wg)
 	super.Close(wg)
+	certStore.Close(wg)
+	blockStore.Close(wg)
+	flagStore.Close(wg)
+	secretManager.Close(wg)
+	pluginLoader.Close(wg)
+	wg.Wait()
+
+	// NOTE: The counters are closed with the supervisor, they gossip their
+	// last states before the gossiper stops.
+	wg.Add(1)
+	gossiper.Close(wg)
+	wg.Wait()
+
+	// NOTE: The child process of graceful update takes over the member.
+	if !graceupdate.IsUpdating() {
+		err := cls.Deregister()
+		if err != nil {
+			logger.Errorf("deregister from cluster failed: %v", err)
+		}
+	}
+
+	wg.Add(2)
 	cls.Close(wg)
 	profile.Close(wg)
 	wg.Wait()
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+const (
+	// AccessLogPrefix is the path of the access records of pipelines of
+	// the member.
+	AccessLogPrefix = "/access-logs"
+
+	defaultAccessLogLimit = 100
+)
+
+func (s *Server) setupAccessLogAPIs() {
+	accessLogAPIs := []*APIEntry{
+		{
+			Path:    AccessLogPrefix,
+			Method:  "GET",
+			Handler: s.listAccessRecords,
+		},
+	}
+
+	s.RegisterAPIs(accessLogAPIs)
+}
+
+// listAccessRecords lists the latest access records of the member, which
+// could be filtered by the glob pattern of pipelines and the request ID.
+// The records after them are streamed as server-sent events if follow is
+// true.
+func (s *Server) listAccessRecords(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pipeline, requestID := query.Get("pipeline"), query.Get("requestID")
+	if pipeline != "" {
+		if _, err := path.Match(pipeline, ""); err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid pipeline pattern %s: %v", pipeline, err))
+			return
+		}
+	}
+
+	limit := defaultAccessLogLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", l))
+			return
+		}
+		limit = n
+	}
+
+	match := func(record *httppipeline.AccessRecord) bool {
+		if requestID != "" && record.RequestID != requestID {
+			return false
+		}
+		if pipeline != "" {
+			matched, _ := path.Match(pipeline, record.Pipeline)
+			return matched
+		}
+		return true
+	}
+
+	if query.Get("follow") != "true" {
+		records := httppipeline.RecentAccessRecords(match, limit)
+		if records == nil {
+			records = []*httppipeline.AccessRecord{}
+		}
+		writeYAML(w, records)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		HandleAPIError(w, r, http.StatusInternalServerError,
+			fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	// NOTE: Subscribe before listing, records in between may be sent
+	// twice but never missed.
+	ch, unsubscribe := httppipeline.SubscribeAccessRecords()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(record *httppipeline.AccessRecord) {
+		buff, err := json.Marshal(record)
+		if err != nil {
+			logger.Errorf("BUG: marshal %#v to json failed: %v", record, err)
+			return
+		}
+		fmt.Fprintf(w, "event: access\ndata: %s\n\n", buff)
+	}
+
+	for _, record := range httppipeline.RecentAccessRecords(match, limit) {
+		send(record)
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.events.done:
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case record := <-ch:
+			if match(record) {
+				send(record)
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -45,7 +45,33 @@ func (s *Server) setupAPIs() {
 	s.setupListAPIs()
 	s.setupMemberAPIs()
 	s.setupObjectAPIs()
+	s.setupNamespaceAPIs()
+	s.setupBlockAPIs()
+	s.setupApplyAPIs()
+	s.setupBatchAPIs()
+	s.setupValidateAPIs()
+	s.setupLintAPIs()
+	s.setupObjectVersionAPIs()
+	s.setupHistoryAPIs()
+	s.setupDeploymentAPIs()
+	s.setupRestartAPIs()
+	s.setupJournalAPIs()
+	s.setupFilterStateAPIs()
+	s.setupDryRunAPIs()
 	s.setupMetadaAPIs()
+	s.setupSchemaAPIs()
+	s.setupOpenAPIAPIs()
+	s.setupPluginAPIs()
+	s.setupSplitterAPIs()
+	s.setupFlagAPIs()
+	s.setupFederationAPIs()
+	s.setupAPIKeyAPIs()
+	s.setupAuditAPIs()
+	s.setupCertificateAPIs()
+	s.setupWebhookAPIs()
+	s.setupEventAPIs()
+	s.setupAccessLogAPIs()
+	s.setupDashboardAPIs()
 	s.setupHealthAPIs()
 	s.setupAboutAPIs()
 }
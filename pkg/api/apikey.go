@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/apikey"
+)
+
+const (
+	// ConsumerPrefix is the prefix of consumers.
+	ConsumerPrefix = "/consumers"
+)
+
+type (
+	// CreateKeyRequest is the request to create an API key.
+	CreateKeyRequest struct {
+		Description string `yaml:"description"`
+		TTL         string `yaml:"ttl"`
+	}
+
+	// CreateKeyResponse is the response of creating an API key, the
+	// plaintext key is only returned here.
+	CreateKeyResponse struct {
+		*apikey.Key `yaml:",inline"`
+		APIKey      string `yaml:"apiKey"`
+	}
+)
+
+func (s *Server) setupAPIKeyAPIs() {
+	apiKeyAPIs := []*APIEntry{
+		{
+			Path:    ConsumerPrefix,
+			Method:  "POST",
+			Handler: s.createConsumer,
+		},
+		{
+			Path:    ConsumerPrefix,
+			Method:  "GET",
+			Handler: s.listConsumers,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}",
+			Method:  "GET",
+			Handler: s.getConsumer,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}",
+			Method:  "PUT",
+			Handler: s.updateConsumer,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}",
+			Method:  "DELETE",
+			Handler: s.deleteConsumer,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}/keys",
+			Method:  "POST",
+			Handler: s.createAPIKey,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}/keys",
+			Method:  "GET",
+			Handler: s.listAPIKeys,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}/keys/{id}",
+			Method:  "DELETE",
+			Handler: s.revokeAPIKey,
+		},
+	}
+
+	s.RegisterAPIs(apiKeyAPIs)
+}
+
+func (s *Server) readConsumer(w http.ResponseWriter, r *http.Request) (*apikey.Consumer, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	consumer, err := apikey.NewConsumer(body)
+	if err != nil {
+		return nil, err
+	}
+
+	name := chi.URLParam(r, "name")
+	if name != "" && name != consumer.Name {
+		return nil, fmt.Errorf("inconsistent name in url and consumer")
+	}
+
+	return consumer, nil
+}
+
+func writeYAML(w http.ResponseWriter, v interface{}) {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", v, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func (s *Server) createConsumer(w http.ResponseWriter, r *http.Request) {
+	consumer, err := s.readConsumer(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getConsumer(consumer.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("conflict name: %s", consumer.Name))
+		return
+	}
+
+	s._putConsumer(consumer)
+	s.upgradeConfigVersion(w, r)
+
+	s.setETag(w, s.cluster.Layout().ConfigConsumerKey(consumer.Name))
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, consumer.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) listConsumers(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	consumers := s._listConsumers()
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+
+	writeYAML(w, consumers)
+}
+
+func (s *Server) getConsumer(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// No need to lock.
+
+	s.setETag(w, s.cluster.Layout().ConfigConsumerKey(name))
+	consumer := s._getConsumer(name)
+	if consumer == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	writeYAML(w, consumer)
+}
+
+func (s *Server) updateConsumer(w http.ResponseWriter, r *http.Request) {
+	consumer, err := s.readConsumer(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := s.cluster.Layout().ConfigConsumerKey(consumer.Name)
+	if !s._checkIfMatch(w, r, key) {
+		return
+	}
+
+	if s._getConsumer(consumer.Name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	s._putConsumer(consumer)
+	s.upgradeConfigVersion(w, r)
+	s.setETag(w, key)
+}
+
+// deleteConsumer deletes the consumer and revokes all of its keys.
+func (s *Server) deleteConsumer(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if !s._checkIfMatch(w, r, s.cluster.Layout().ConfigConsumerKey(name)) {
+		return
+	}
+
+	if s._getConsumer(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	for _, key := range s._listAPIKeys(name) {
+		s._deleteAPIKey(key.ID)
+	}
+	s._deleteConsumer(name)
+	s.upgradeConfigVersion(w, r)
+}
+
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+
+	req := &CreateKeyRequest{}
+	err = yaml.Unmarshal(body, req)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal request failed: %v", err))
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid ttl: %s", req.TTL))
+			return
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getConsumer(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	key, plaintext, err := apikey.Generate(name, req.Description, ttl)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("generate key failed: %v", err))
+		return
+	}
+
+	s._putAPIKey(key)
+	s.upgradeConfigVersion(w, r)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, key.ID))
+	// NOTE: Content-Type must be set before WriteHeader to be sent.
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.WriteHeader(http.StatusCreated)
+	writeYAML(w, &CreateKeyResponse{Key: key.Redacted(), APIKey: plaintext})
+}
+
+func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// No need to lock.
+
+	if s._getConsumer(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	keys := s._listAPIKeys(name)
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt < keys[j].CreatedAt
+	})
+
+	redacted := make([]*apikey.Key, len(keys))
+	for i, key := range keys {
+		redacted[i] = key.Redacted()
+	}
+
+	writeYAML(w, redacted)
+}
+
+func (s *Server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	name, id := chi.URLParam(r, "name"), chi.URLParam(r, "id")
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := s._getAPIKey(id)
+	if key == nil || key.Consumer != name {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	s._deleteAPIKey(id)
+	s.upgradeConfigVersion(w, r)
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/audit"
+	"github.com/megaease/easegress/pkg/lint"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	applyActionCreate = "create"
+	applyActionUpdate = "update"
+	applyActionDelete = "delete"
+)
+
+type (
+	// ApplyPlan is the plan to make the objects the same as the desired
+	// ones, it's applied unless it's a dry run.
+	ApplyPlan struct {
+		Applied   bool           `yaml:"applied"`
+		Changes   []*ApplyChange `yaml:"changes"`
+		Unchanged []string       `yaml:"unchanged,omitempty"`
+		// Warnings are the non-fatal issues of the specs, they never
+		// stop the plan from being applied.
+		Warnings []*lint.Issue `yaml:"warnings,omitempty"`
+	}
+
+	// ApplyChange is the change of an object in the plan.
+	ApplyChange struct {
+		Action string `yaml:"action"`
+		Kind   string `yaml:"kind"`
+		Name   string `yaml:"name"`
+		// Diff is the diff of the specs with sensitive fields redacted.
+		Diff string `yaml:"diff,omitempty"`
+
+		spec *supervisor.Spec
+	}
+)
+
+func (s *Server) setupApplyAPIs() {
+	applyAPIs := []*APIEntry{
+		{
+			Path:    ObjectPrefix,
+			Method:  "PUT",
+			Handler: s.applyObjects,
+		},
+	}
+
+	s.RegisterAPIs(applyAPIs)
+}
+
+// applyObjects makes the objects the same as the complete set of desired
+// ones in the body: the missing ones are created, the different ones are
+// updated, and the ones not in the set are deleted. All changes are made
+// in one transaction in the order of their dependencies. Nothing is changed
+// if the query dryRun is true, and the plan is reported either way.
+func (s *Server) applyObjects(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	specs, err := readSpecs(body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	s.Lock()
+	defer s.Unlock()
+
+	plan, err := s._planApply(specs, nil)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(plan.Changes) > maxTxnChanges {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("too many changes: %d, at most %d", len(plan.Changes), maxTxnChanges))
+		return
+	}
+	for _, change := range plan.Changes {
+		if !authorizeObject(w, r, change.Name) {
+			return
+		}
+	}
+	sortChanges(plan.Changes)
+
+	if !dryRun && len(plan.Changes) != 0 {
+		for _, change := range plan.Changes {
+			if change.Action == applyActionDelete {
+				continue
+			}
+			change.spec, err = encryptSpec(change.spec)
+			if err != nil {
+				HandleAPIError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		_, err = s._commitChanges(w, principalOf(r), 0, plan.Changes)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		plan.Applied = true
+		auditApply(r, plan)
+	}
+
+	buff, err := yaml.Marshal(plan)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", plan, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+// readSpecs reads specs from the YAML documents, each of them is a spec
+// or a list of specs.
+func readSpecs(body []byte) ([]*supervisor.Spec, error) {
+	docs, err := splitSpecDocs(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []*supervisor.Spec
+	names := map[string]struct{}{}
+	for _, doc := range docs {
+		spec, err := supervisor.NewSpec(doc)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := names[spec.Name()]; exists {
+			return nil, fmt.Errorf("duplicated name: %s", spec.Name())
+		}
+		names[spec.Name()] = struct{}{}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+// splitSpecDocs splits the YAML documents into the YAML configs of specs,
+// each of the documents is a spec or a list of specs.
+func splitSpecDocs(body []byte) ([]string, error) {
+	var configs []string
+	add := func(doc interface{}) error {
+		buff, err := yaml.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("marshal spec failed: %v", err)
+		}
+		configs = append(configs, string(buff))
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	for {
+		var doc interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal body failed: %v", err)
+		}
+
+		switch doc := doc.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range doc {
+				err = add(item)
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			err = add(doc)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return configs, nil
+}
+
+// _planApply plans to make the objects the same as the specs, the objects
+// not in them are deleted if deletable is nil or reports true.
+// The changes are checked against the namespaces of the objects.
+func (s *Server) _planApply(specs []*supervisor.Spec, deletable func(name string) bool) (*ApplyPlan, error) {
+	current := s._listObjects()
+	plan, err := planChanges(current, specs, deletable)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s._checkNamespaces(current, plan.Changes)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Warnings = lintSpecs(current, specs, plan.Changes)
+	return plan, nil
+}
+
+// planChanges plans to make the current specs the same as the desired
+// ones like _planApply.
+func planChanges(current, specs []*supervisor.Spec, deletable func(name string) bool) (*ApplyPlan, error) {
+	existing := map[string]*supervisor.Spec{}
+	for _, spec := range current {
+		existing[spec.Name()] = spec
+	}
+
+	plan := &ApplyPlan{}
+	desired := map[string]struct{}{}
+	for _, spec := range specs {
+		name := spec.Name()
+		desired[name] = struct{}{}
+
+		prev := existing[name]
+		if prev == nil {
+			diff, _, err := specDiff(nil, spec)
+			if err != nil {
+				return nil, err
+			}
+			plan.Changes = append(plan.Changes, &ApplyChange{
+				Action: applyActionCreate, Kind: spec.Kind(), Name: name, Diff: diff, spec: spec,
+			})
+			continue
+		}
+
+		if prev.Kind() != spec.Kind() {
+			return nil, fmt.Errorf("different kinds of %s: %s, %s", name, prev.Kind(), spec.Kind())
+		}
+		diff, changed, err := specDiff(prev, spec)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			plan.Unchanged = append(plan.Unchanged, name)
+			continue
+		}
+		plan.Changes = append(plan.Changes, &ApplyChange{
+			Action: applyActionUpdate, Kind: spec.Kind(), Name: name, Diff: diff, spec: spec,
+		})
+	}
+
+	var deleted []*ApplyChange
+	for name, spec := range existing {
+		if _, exists := desired[name]; exists {
+			continue
+		}
+		if deletable != nil && !deletable(name) {
+			continue
+		}
+		diff, _, err := specDiff(spec, nil)
+		if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, &ApplyChange{
+			Action: applyActionDelete, Kind: spec.Kind(), Name: name, Diff: diff, spec: spec,
+		})
+	}
+
+	sort.Slice(plan.Changes, func(i, j int) bool { return plan.Changes[i].Name < plan.Changes[j].Name })
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].Name < deleted[j].Name })
+	plan.Changes = append(plan.Changes, deleted...)
+	sort.Strings(plan.Unchanged)
+
+	return plan, nil
+}
+
+func (s *Server) _applyChange(w http.ResponseWriter, r *http.Request, change *ApplyChange) error {
+	if change.Action == applyActionDelete {
+		s._deleteObject(change.Name)
+		s._deleteObjectVersions(change.Name)
+		s.upgradeConfigVersion(w, r)
+		return nil
+	}
+
+	spec, err := encryptSpec(change.spec)
+	if err != nil {
+		return err
+	}
+	_, err = s._putVersionedObject(w, r, spec)
+	return err
+}
+
+// normalizeSpec returns the document of the spec to be compared, the
+// sensitive fields are decrypted, and the version stamped on pipelines
+// is removed.
+func normalizeSpec(spec *supervisor.Spec) (map[string]interface{}, error) {
+	config, err := secret.DecryptYAML(spec.YAMLConfig())
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s failed: %v", spec.Name(), err)
+	}
+
+	doc := map[string]interface{}{}
+	err = yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s failed: %v", spec.Name(), err)
+	}
+	if spec.Kind() == httppipeline.Kind {
+		delete(doc, "version")
+	}
+
+	return doc, nil
+}
+
+// specDiff returns the diff of the specs with sensitive fields redacted,
+// and whether they're different, either of them could be nil. The diff
+// could be empty if only sensitive fields are changed.
+func specDiff(before, after *supervisor.Spec) (string, bool, error) {
+	var docs [2]map[string]interface{}
+	var configs [2]string
+	for i, spec := range []*supervisor.Spec{before, after} {
+		if spec == nil {
+			continue
+		}
+		doc, err := normalizeSpec(spec)
+		if err != nil {
+			return "", false, err
+		}
+		buff, err := yaml.Marshal(doc)
+		if err != nil {
+			return "", false, fmt.Errorf("marshal %s failed: %v", spec.Name(), err)
+		}
+		docs[i], configs[i] = doc, secret.RedactYAML(string(buff))
+	}
+
+	if docs[0] != nil && docs[1] != nil && reflect.DeepEqual(docs[0], docs[1]) {
+		return "", false, nil
+	}
+	return audit.Diff(configs[0], configs[1]), true, nil
+}
+
+// auditApply attaches the changes to the audit record of the request.
+func auditApply(r *http.Request, plan *ApplyPlan) {
+	record, ok := r.Context().Value(auditRecordKey{}).(*audit.Record)
+	if !ok {
+		return
+	}
+
+	record.Action = "apply"
+	record.Diff = planDiff(plan)
+}
+
+// planDiff joins the diffs of all changes in the plan.
+func planDiff(plan *ApplyPlan) string {
+	var diffs []string
+	for _, change := range plan.Changes {
+		diffs = append(diffs, fmt.Sprintf("%s %s %s\n%s", change.Action, change.Kind, change.Name, change.Diff))
+	}
+	return strings.Join(diffs, "")
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	_ "github.com/megaease/easegress/pkg/filter/mock"
+	_ "github.com/megaease/easegress/pkg/object/crontrigger"
+	_ "github.com/megaease/easegress/pkg/object/statussynccontroller"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestReadSpecsAndDiff(t *testing.T) {
+	specs, err := readSpecs([]byte(`
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+---
+- name: another
+  kind: HTTPPipeline
+  filters:
+  - name: mock
+    kind: Mock
+    rules:
+    - code: 404
+`))
+	if err != nil {
+		t.Fatalf("read specs failed: %v", err)
+	}
+	if len(specs) != 2 || specs[0].Name() != "pipeline" || specs[1].Name() != "another" {
+		t.Fatalf("unexpected specs: %v", specs)
+	}
+
+	_, err = readSpecs([]byte("name: a\nkind: HTTPPipeline\n---\nname: a\nkind: HTTPPipeline\n"))
+	if err == nil {
+		t.Errorf("want error for duplicated names")
+	}
+
+	stamped, err := stampVersion(specs[0], 5)
+	if err != nil {
+		t.Fatalf("stamp version failed: %v", err)
+	}
+	if _, changed, _ := specDiff(stamped, specs[0]); changed {
+		t.Errorf("want the stamped version ignored")
+	}
+
+	updated, err := supervisor.NewSpec(strings.Replace(specs[0].YAMLConfig(), "code: 200", "code: 500", 1))
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	diff, changed, err := specDiff(stamped, updated)
+	if err != nil || !changed {
+		t.Fatalf("want changed, got %v, %v", changed, err)
+	}
+	if !strings.Contains(diff, "-  - code: 200") || !strings.Contains(diff, "+  - code: 500") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+}
+
+func TestSortChanges(t *testing.T) {
+	changes := []*ApplyChange{
+		{Kind: "CronTrigger", Name: "trigger"},
+		{Kind: "HTTPPipeline", Name: "b"},
+		{Kind: "StatusSyncController", Name: "status"},
+		{Kind: "HTTPPipeline", Name: "a"},
+	}
+	sortChanges(changes)
+
+	var names []string
+	for _, change := range changes {
+		names = append(names, change.Name)
+	}
+	if got := strings.Join(names, ","); got != "status,b,a,trigger" {
+		t.Errorf("want status,b,a,trigger, got %s", got)
+	}
+}
+
+func TestLintSpecs(t *testing.T) {
+	current, err := readSpecs([]byte(`
+name: cron
+kind: CronTrigger
+schedule: "@every 1m"
+pipeline: pipeline
+`))
+	if err != nil {
+		t.Fatalf("read specs failed: %v", err)
+	}
+	specs, err := readSpecs([]byte(`
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`))
+	if err != nil {
+		t.Fatalf("read specs failed: %v", err)
+	}
+
+	if issues := lintSpecs(current, specs, nil); len(issues) != 0 {
+		t.Errorf("want no issues, got %+v", issues[0])
+	}
+	changes := []*ApplyChange{{Action: applyActionDelete, Kind: "CronTrigger", Name: "cron"}}
+	if issues := lintSpecs(current, specs, changes); len(issues) != 1 || issues[0].Object != "pipeline" {
+		t.Errorf("want pipeline unreferenced, got %v", issues)
+	}
+}
+
+func TestApplyObjects(t *testing.T) {
+	c := newMemCluster()
+	s := newTestServer(c)
+	body := `
+name: a-trigger
+kind: CronTrigger
+schedule: "@every 1m"
+pipeline: b-pipeline
+---
+name: b-pipeline
+kind: HTTPPipeline
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`
+	apply := func() (int, *ApplyPlan) {
+		r := httptest.NewRequest(http.MethodPut, "/objects", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.applyObjects(w, r)
+		plan := &ApplyPlan{}
+		yaml.Unmarshal(w.Body.Bytes(), plan)
+		return w.Code, plan
+	}
+
+	c.failKey = c.Layout().ConfigObjectKey("b-pipeline")
+	if code, _ := apply(); code != http.StatusInternalServerError {
+		t.Fatalf("want status 500, got %d", code)
+	}
+	if specs := s._listObjects(); len(specs) != 0 || s._getVersion() != 0 {
+		t.Errorf("want nothing applied, got %d objects and version %d", len(specs), s._getVersion())
+	}
+
+	c.failKey = ""
+	code, plan := apply()
+	if code != http.StatusOK || !plan.Applied {
+		t.Fatalf("want plan applied, got status %d", code)
+	}
+	var names []string
+	for _, change := range plan.Changes {
+		names = append(names, change.Name)
+	}
+	if got := strings.Join(names, ","); got != "b-pipeline,a-trigger" {
+		t.Errorf("want b-pipeline,a-trigger, got %s", got)
+	}
+	if specs := s._listObjects(); len(specs) != 2 || s._getVersion() != 1 {
+		t.Errorf("want 2 objects in version 1, got %d objects and version %d", len(specs), s._getVersion())
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/megaease/easegress/pkg/audit"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/secret"
+)
+
+const (
+	// AuditPrefix is the prefix of audit APIs.
+	AuditPrefix = "/audit"
+
+	auditLogFilename = "admin_audit.log"
+
+	anonymousPrincipal = "anonymous"
+)
+
+type (
+	auditRecordKey struct{}
+	principalKey   struct{}
+
+	// AuditVerifyResponse is the response of verifying the audit log.
+	AuditVerifyResponse struct {
+		Records int    `yaml:"records"`
+		Valid   bool   `yaml:"valid"`
+		Error   string `yaml:"error,omitempty"`
+	}
+)
+
+func (s *Server) setupAuditAPIs() {
+	auditAPIs := []*APIEntry{
+		{
+			Path:    AuditPrefix,
+			Method:  "GET",
+			Handler: s.listAuditRecords,
+		},
+		{
+			Path:    AuditPrefix + "/verify",
+			Method:  "GET",
+			Handler: s.verifyAuditLog,
+		},
+	}
+
+	s.RegisterAPIs(auditAPIs)
+}
+
+func openAuditLog(opt *option.Options) *audit.Log {
+	l, err := audit.Open(filepath.Join(opt.AbsLogDir, auditLogFilename))
+	if err != nil {
+		logger.Errorf("open audit log failed, admin operations won't be audited: %v", err)
+		return nil
+	}
+	return l
+}
+
+// withPrincipal returns a copy of r carrying the authenticated principal,
+// which is also recorded by the audit record of the request.
+func withPrincipal(r *http.Request, principal string) *http.Request {
+	if record, ok := r.Context().Value(auditRecordKey{}).(*audit.Record); ok {
+		record.Principal = principal
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// principalOf returns the principal of the request, the user of basic
+// authentication is used if no one was authenticated by the server.
+func principalOf(r *http.Request) string {
+	if p, ok := r.Context().Value(principalKey{}).(string); ok && p != "" {
+		return p
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return anonymousPrincipal
+}
+
+// auditObject attaches the changed object to the audit record of the
+// request, publishes the event of the change and records the revision of
+// the config, before or after is empty if the object is created or
+// deleted. It must be called with the lock held.
+func (s *Server) auditObject(r *http.Request, kind, name, before, after string) {
+	action := changeAction(before, after)
+	diff := audit.Diff(secret.RedactYAML(before), secret.RedactYAML(after))
+	s.publishEvent(principalOf(r), action, kind, name, diff)
+	s._recordRevision(principalOf(r), 0, []*ApplyChange{{Action: action, Kind: kind, Name: name}})
+
+	record, ok := r.Context().Value(auditRecordKey{}).(*audit.Record)
+	if !ok {
+		return
+	}
+	record.Kind, record.Name = kind, name
+	record.Diff = diff
+}
+
+func auditAction(method string) string {
+	switch method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut, http.MethodPatch:
+		return "update"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return ""
+}
+
+func (s *Server) newAuditor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := auditAction(r.Method)
+		if s.auditLog == nil || action == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// NOTE: The auditor is in front of the authenticator to record
+		// denied requests, which updates the principal if authenticated.
+		record := &audit.Record{Action: action, Principal: principalOf(r)}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		r = r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, record))
+
+		// NOTE: The recoverer is behind the auditor, so panics are
+		// recorded with the status written by the recoverer.
+		defer func() {
+			record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+			record.Member = s.opt.Name
+			record.SourceIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+			record.Method = r.Method
+			record.Path = r.URL.Path
+			record.Status = ww.Status()
+			err := s.auditLog.Append(record)
+			if err != nil {
+				logger.Errorf("append audit record failed: %v", err)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+func (s *Server) listAuditRecords(w http.ResponseWriter, r *http.Request) {
+	if s.auditLog == nil {
+		HandleAPIError(w, r, http.StatusServiceUnavailable, fmt.Errorf("audit log is unavailable"))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &audit.Filter{
+		Principal: query.Get("principal"),
+		Name:      query.Get("name"),
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid since: %v", err))
+			return
+		}
+		filter.Since = t
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", limit))
+			return
+		}
+		filter.Limit = n
+	}
+
+	records, err := s.auditLog.Query(filter)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeYAML(w, records)
+}
+
+func (s *Server) verifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	if s.auditLog == nil {
+		HandleAPIError(w, r, http.StatusServiceUnavailable, fmt.Errorf("audit log is unavailable"))
+		return
+	}
+
+	count, err := s.auditLog.Verify()
+	resp := &AuditVerifyResponse{Records: count, Valid: err == nil}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	writeYAML(w, resp)
+}
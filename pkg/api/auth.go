@@ -0,0 +1,277 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// RoleReadOnly can only call read APIs.
+	RoleReadOnly = "read-only"
+	// RolePipelineAdmin can also change objects matching its patterns.
+	RolePipelineAdmin = "pipeline-admin"
+	// RoleClusterAdmin can call all APIs.
+	RoleClusterAdmin = "cluster-admin"
+	// RoleFederation can call read APIs and report the secondary region
+	// to the primary, it's the role of the Federation of the secondaries.
+	RoleFederation = "federation"
+)
+
+type (
+	userKey struct{}
+
+	// AuthConfig is the config of authentication and authorization of
+	// the admin API.
+	AuthConfig struct {
+		Users []*AuthUser `yaml:"users"`
+
+		// tokens is indexed by the hex SHA-256 of the tokens.
+		tokens map[string]*AuthUser
+		// commonNames is indexed by the common names of client certs.
+		commonNames map[string]*AuthUser
+	}
+
+	// AuthUser is a user of the admin API, it's authenticated by a bearer
+	// token or a verified client certificate.
+	AuthUser struct {
+		Name string `yaml:"name"`
+		// TokenSHA256 is the hex SHA-256 of the bearer token, so no
+		// plaintext token is stored in the file.
+		TokenSHA256    string `yaml:"tokenSHA256"`
+		CertCommonName string `yaml:"certCommonName"`
+		Role           string `yaml:"role"`
+		// Objects are name patterns of objects which a pipeline-admin
+		// is allowed to change, all objects if both Objects and
+		// Namespaces are empty.
+		Objects []string `yaml:"objects"`
+		// Namespaces are the namespaces in which a pipeline-admin is
+		// allowed to change all objects.
+		Namespaces []string `yaml:"namespaces"`
+	}
+)
+
+func loadAuthConfig(filename string) (*AuthConfig, error) {
+	buff, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %v", filename, err)
+	}
+
+	c := &AuthConfig{}
+	err = yaml.UnmarshalStrict(buff, c)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s failed: %v", filename, err)
+	}
+
+	err = c.init()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", filename, err)
+	}
+
+	return c, nil
+}
+
+func (c *AuthConfig) init() error {
+	c.tokens = map[string]*AuthUser{}
+	c.commonNames = map[string]*AuthUser{}
+
+	names := map[string]struct{}{}
+	for _, u := range c.Users {
+		if u.Name == "" {
+			return fmt.Errorf("empty user name")
+		}
+		if _, exists := names[u.Name]; exists {
+			return fmt.Errorf("duplicated user %s", u.Name)
+		}
+		names[u.Name] = struct{}{}
+
+		switch u.Role {
+		case RoleReadOnly, RoleClusterAdmin, RoleFederation:
+			if len(u.Objects) != 0 || len(u.Namespaces) != 0 {
+				return fmt.Errorf("user %s: objects and namespaces are only for %s", u.Name, RolePipelineAdmin)
+			}
+		case RolePipelineAdmin:
+			for _, p := range u.Objects {
+				if _, err := path.Match(p, ""); err != nil {
+					return fmt.Errorf("user %s: invalid object pattern %s: %v", u.Name, p, err)
+				}
+			}
+		default:
+			return fmt.Errorf("user %s: unknown role %s", u.Name, u.Role)
+		}
+
+		if u.TokenSHA256 == "" && u.CertCommonName == "" {
+			return fmt.Errorf("user %s: neither tokenSHA256 nor certCommonName", u.Name)
+		}
+		if u.TokenSHA256 != "" {
+			token := strings.ToLower(u.TokenSHA256)
+			if b, err := hex.DecodeString(token); err != nil || len(b) != sha256.Size {
+				return fmt.Errorf("user %s: invalid tokenSHA256", u.Name)
+			}
+			if _, exists := c.tokens[token]; exists {
+				return fmt.Errorf("user %s: duplicated token", u.Name)
+			}
+			c.tokens[token] = u
+		}
+		if u.CertCommonName != "" {
+			if _, exists := c.commonNames[u.CertCommonName]; exists {
+				return fmt.Errorf("user %s: duplicated certCommonName", u.Name)
+			}
+			c.commonNames[u.CertCommonName] = u
+		}
+	}
+
+	return nil
+}
+
+// authenticate returns the user of the request, or nil if the request
+// is not authenticated. The bearer token takes precedence over the
+// client certificate.
+func (c *AuthConfig) authenticate(r *http.Request) *AuthUser {
+	const prefix = "Bearer "
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+			return nil
+		}
+		sum := sha256.Sum256([]byte(auth[len(prefix):]))
+		return c.tokens[hex.EncodeToString(sum[:])]
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		return c.commonNames[cert.Subject.CommonName]
+	}
+
+	return nil
+}
+
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// permits checks the role of the user for the request, the objects of
+// a pipeline-admin are checked by the object APIs.
+func (u *AuthUser) permits(r *http.Request) bool {
+	if isReadMethod(r.Method) {
+		return true
+	}
+
+	switch u.Role {
+	case RoleClusterAdmin:
+		return true
+	case RolePipelineAdmin:
+		return strings.HasPrefix(r.URL.Path, APIPrefix+ObjectPrefix+"/") ||
+			r.URL.Path == APIPrefix+ObjectPrefix
+	case RoleFederation:
+		return r.Method == http.MethodPut &&
+			strings.HasPrefix(r.URL.Path, APIPrefix+FederationPrefix+"/regions/")
+	}
+
+	return false
+}
+
+// permitsObject checks if the user is allowed to change the object.
+func (u *AuthUser) permitsObject(name string) bool {
+	if u.Role != RolePipelineAdmin || (len(u.Objects) == 0 && len(u.Namespaces) == 0) {
+		return true
+	}
+
+	for _, p := range u.Objects {
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+	}
+	for _, ns := range u.Namespaces {
+		if strings.HasPrefix(name, ns+supervisor.NamespaceSeparator) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) newAuthenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// NOTE: Health checks from load balancers carry no credentials,
+		// nor do webhooks, which are verified by the objects receiving them,
+		// nor do the static files of the dashboard, which asks for them.
+		if s.authConfig == nil || r.URL.Path == APIPrefix+"/healthz" ||
+			strings.HasPrefix(r.URL.Path, APIPrefix+WebhookPrefix+"/") ||
+			isDashboardFile(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := s.authConfig.authenticate(r)
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="easegress"`)
+			HandleAPIError(w, r, http.StatusUnauthorized, fmt.Errorf("unauthenticated"))
+			return
+		}
+
+		r = withPrincipal(r, user.Name)
+		if !user.permits(r) {
+			HandleAPIError(w, r, http.StatusForbidden,
+				fmt.Errorf("user %s with role %s is not allowed to %s %s",
+					user.Name, user.Role, r.Method, r.URL.Path))
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeObject checks if the user of the request is allowed to change
+// the object, it writes the error and returns false if not.
+func authorizeObject(w http.ResponseWriter, r *http.Request, name string) bool {
+	user, ok := r.Context().Value(userKey{}).(*AuthUser)
+	if !ok || user.permitsObject(name) {
+		return true
+	}
+
+	HandleAPIError(w, r, http.StatusForbidden,
+		fmt.Errorf("user %s is not allowed to change object %s", user.Name, name))
+	return false
+}
+
+func loadAPIAuthConfig(filename string) *AuthConfig {
+	if filename == "" {
+		logger.Warnf("api-auth-file is empty, anyone who can reach the admin API is allowed to change everything")
+		return nil
+	}
+
+	c, err := loadAuthConfig(filename)
+	if err != nil {
+		panic(fmt.Errorf("load api auth config failed: %v", err))
+	}
+
+	return c
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tokenSHA256(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuthConfig(t *testing.T) {
+	config := `
+users:
+- name: admin
+  tokenSHA256: ` + tokenSHA256("admin-token") + `
+  role: cluster-admin
+- name: team-a
+  tokenSHA256: ` + tokenSHA256("team-a-token") + `
+  role: pipeline-admin
+  objects: ["team-a-*"]
+  namespaces: ["shop"]
+- name: dashboard
+  certCommonName: dashboard.example.com
+  role: read-only
+`
+	filename := filepath.Join(t.TempDir(), "auth.yaml")
+	os.WriteFile(filename, []byte(config), 0600)
+
+	c, err := loadAuthConfig(filename)
+	if err != nil {
+		t.Fatalf("load auth config failed: %v", err)
+	}
+
+	r := httptest.NewRequest("PUT", APIPrefix+ObjectPrefix+"/team-a-pipeline", nil)
+	if c.authenticate(r) != nil {
+		t.Errorf("request without credentials should not be authenticated")
+	}
+	r.Header.Set("Authorization", "Bearer wrong-token")
+	if c.authenticate(r) != nil {
+		t.Errorf("request with wrong token should not be authenticated")
+	}
+
+	r.Header.Set("Authorization", "Bearer team-a-token")
+	user := c.authenticate(r)
+	if user == nil || user.Name != "team-a" {
+		t.Fatalf("want user team-a, got %+v", user)
+	}
+	if !user.permits(r) || !user.permitsObject("team-a-pipeline") {
+		t.Errorf("team-a should be allowed to change team-a-pipeline")
+	}
+	if user.permitsObject("team-b-pipeline") {
+		t.Errorf("team-a should not be allowed to change team-b-pipeline")
+	}
+	if !user.permitsObject("shop.pipeline") || user.permitsObject("shopping.pipeline") {
+		t.Errorf("team-a should be allowed to change objects in namespace shop only")
+	}
+	if user.permits(httptest.NewRequest("DELETE", APIPrefix+"/status/members/eg1", nil)) {
+		t.Errorf("pipeline-admin should not be allowed to purge members")
+	}
+
+	r = httptest.NewRequest("DELETE", APIPrefix+"/status/members/eg1", nil)
+	r.Header.Set("Authorization", "bearer admin-token")
+	user = c.authenticate(r)
+	if user == nil || !user.permits(r) {
+		t.Errorf("cluster-admin should be allowed to purge members")
+	}
+
+	r = httptest.NewRequest("GET", APIPrefix+ObjectPrefix, nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "dashboard.example.com"}},
+	}}}
+	user = c.authenticate(r)
+	if user == nil || user.Name != "dashboard" || !user.permits(r) {
+		t.Fatalf("dashboard should be allowed to list objects, got %+v", user)
+	}
+	r.Method = "POST"
+	if user.permits(r) {
+		t.Errorf("read-only should not be allowed to create objects")
+	}
+}
+
+func TestAuthConfigInvalid(t *testing.T) {
+	for _, users := range [][]*AuthUser{
+		{{Name: "a", TokenSHA256: tokenSHA256("a"), Role: "root"}},
+		{{Name: "a", Role: RoleClusterAdmin}},
+		{{Name: "a", TokenSHA256: "abc", Role: RoleClusterAdmin}},
+		{{Name: "a", TokenSHA256: tokenSHA256("a"), Role: RoleReadOnly, Objects: []string{"*"}}},
+		{
+			{Name: "a", TokenSHA256: tokenSHA256("a"), Role: RoleReadOnly},
+			{Name: "b", TokenSHA256: tokenSHA256("a"), Role: RoleClusterAdmin},
+		},
+	} {
+		c := &AuthConfig{Users: users}
+		if err := c.init(); err == nil {
+			t.Errorf("want error for %+v", users[len(users)-1])
+		}
+	}
+}
+
+func TestFederationRole(t *testing.T) {
+	user := &AuthUser{Name: "eu-west", Role: RoleFederation}
+	if !user.permits(httptest.NewRequest("GET", APIPrefix+ObjectPrefix, nil)) {
+		t.Errorf("federation should be allowed to list objects")
+	}
+	if !user.permits(httptest.NewRequest("PUT", APIPrefix+FederationPrefix+"/regions/eu-west", nil)) {
+		t.Errorf("federation should be allowed to report regions")
+	}
+	if user.permits(httptest.NewRequest("DELETE", APIPrefix+FederationPrefix+"/regions/eu-west", nil)) {
+		t.Errorf("federation should not be allowed to delete regions")
+	}
+	if user.permits(httptest.NewRequest("PUT", APIPrefix+ObjectPrefix+"/pipeline-demo", nil)) {
+		t.Errorf("federation should not be allowed to change objects")
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/audit"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// BatchPrefix is the prefix of object batches.
+	BatchPrefix = "/object-batch"
+
+	// maxTxnChanges is the max number of changes made in one transaction,
+	// etcd limits the operations in a transaction to 128 by default, and
+	// the config version takes one of them.
+	maxTxnChanges = 120
+)
+
+func (s *Server) setupBatchAPIs() {
+	batchAPIs := []*APIEntry{
+		{
+			Path:    BatchPrefix,
+			Method:  "POST",
+			Handler: s.batchObjects,
+		},
+	}
+
+	s.RegisterAPIs(batchAPIs)
+}
+
+// batchObjects creates or updates the objects in the body all at once:
+// they're validated and made in one transaction in the order of their
+// dependencies, so either all of them are made or none of them. Objects
+// not in the body are kept. Nothing is changed if the query dryRun is
+// true, and the plan is reported either way.
+func (s *Server) batchObjects(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	specs, err := readSpecs(body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	s.Lock()
+	defer s.Unlock()
+
+	plan, err := s._planApply(specs, func(string) bool { return false })
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(plan.Changes) > maxTxnChanges {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("too many changes: %d, at most %d", len(plan.Changes), maxTxnChanges))
+		return
+	}
+	for _, change := range plan.Changes {
+		if !authorizeObject(w, r, change.Name) {
+			return
+		}
+	}
+	sortChanges(plan.Changes)
+
+	if !dryRun && len(plan.Changes) != 0 {
+		for _, change := range plan.Changes {
+			change.spec, err = encryptSpec(change.spec)
+			if err != nil {
+				HandleAPIError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		_, err = s._commitChanges(w, principalOf(r), 0, plan.Changes)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		plan.Applied = true
+		auditBatch(r, plan)
+	}
+
+	writeYAML(w, plan)
+}
+
+// sortChanges sorts the changes in the order of the dependencies of the
+// objects, e.g. pipelines are before the traffic gates using them.
+func sortChanges(changes []*ApplyChange) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return supervisor.KindPriority(changes[i].Kind) < supervisor.KindPriority(changes[j].Kind)
+	})
+}
+
+// _commitChanges makes all changes in one transaction with the next
+// config version, so members apply them at once, and returns the version.
+// The specs of the changes must be encrypted, and rollback is the revision
+// restored by them, it's 0 if they're not a rollback.
+func (s *Server) _commitChanges(w http.ResponseWriter, actor string, rollback int64, changes []*ApplyChange) (int64, error) {
+	layout := s.cluster.Layout()
+	version := s._getVersion() + 1
+	kvs := map[string]*string{}
+	var pipelines []*supervisor.Spec
+	for _, change := range changes {
+		key := layout.ConfigObjectKey(change.Name)
+		if change.Action == applyActionDelete {
+			kvs[key] = nil
+			continue
+		}
+
+		spec := change.spec
+		if spec.Kind() == httppipeline.Kind {
+			var err error
+			spec, err = stampVersion(spec, version)
+			if err != nil {
+				return 0, err
+			}
+			pipelines = append(pipelines, spec)
+		}
+		config := spec.YAMLConfig()
+		kvs[key] = &config
+	}
+	value := strconv.FormatInt(version, 10)
+	kvs[layout.ConfigVersion()] = &value
+
+	err := s.cluster.PutAndDelete(kvs)
+	if err != nil {
+		return 0, fmt.Errorf("commit failed: %v", err)
+	}
+	w.Header().Set(ConfigVersionKey, value)
+
+	for _, spec := range pipelines {
+		s._keepObjectVersion(spec, version)
+	}
+	for _, change := range changes {
+		if change.Action == applyActionDelete {
+			s._deleteObjectVersions(change.Name)
+		}
+		s.publishEvent(actor, change.Action, change.Kind, change.Name, change.Diff)
+	}
+	s._recordRevision(actor, rollback, changes)
+
+	return version, nil
+}
+
+func auditBatch(r *http.Request, plan *ApplyPlan) {
+	record, ok := r.Context().Value(auditRecordKey{}).(*audit.Record)
+	if !ok {
+		return
+	}
+
+	record.Action = "batch"
+	record.Diff = planDiff(plan)
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/configblock"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// BlockPrefix is the prefix of config blocks.
+	BlockPrefix = "/blocks"
+)
+
+type (
+	// BlockInfo is the block with the objects referencing it.
+	BlockInfo struct {
+		configblock.Block `yaml:",inline"`
+		Objects           []string `yaml:"objects"`
+	}
+)
+
+func (s *Server) setupBlockAPIs() {
+	blockAPIs := []*APIEntry{
+		{
+			Path:    BlockPrefix,
+			Method:  "POST",
+			Handler: s.createBlock,
+		},
+		{
+			Path:    BlockPrefix,
+			Method:  "GET",
+			Handler: s.listBlocks,
+		},
+		{
+			Path:    BlockPrefix + "/{name}",
+			Method:  "GET",
+			Handler: s.getBlock,
+		},
+		{
+			Path:    BlockPrefix + "/{name}",
+			Method:  "PUT",
+			Handler: s.updateBlock,
+		},
+		{
+			Path:    BlockPrefix + "/{name}",
+			Method:  "DELETE",
+			Handler: s.deleteBlock,
+		},
+	}
+
+	s.RegisterAPIs(blockAPIs)
+}
+
+func (s *Server) readBlock(w http.ResponseWriter, r *http.Request) (*configblock.Block, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	b, err := configblock.NewBlock(body)
+	if err != nil {
+		return nil, err
+	}
+
+	name := chi.URLParam(r, "name")
+	if name != "" && name != b.Name {
+		return nil, fmt.Errorf("inconsistent name in url and block")
+	}
+
+	return b, nil
+}
+
+// blockObjects returns the names of the objects referencing the block.
+func blockObjects(specs []*supervisor.Spec, name string) []string {
+	var names []string
+	for _, spec := range specs {
+		if containsString(configblock.References(spec.YAMLConfig()), name) {
+			names = append(names, spec.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkBlockObjects checks the objects referencing the block still work
+// with the new value of it.
+func checkBlockObjects(specs []*supervisor.Spec, blocks map[string]*configblock.Block, b *configblock.Block) error {
+	blocks[b.Name] = b
+	for _, spec := range specs {
+		config := spec.YAMLConfig()
+		if !containsString(configblock.References(config), b.Name) {
+			continue
+		}
+
+		resolved, _, err := configblock.Resolve(config, blocks)
+		if err != nil {
+			return fmt.Errorf("%s: %v", spec.Name(), err)
+		}
+		_, err = supervisor.NewSpec(resolved)
+		if err != nil {
+			return fmt.Errorf("%s: %v", spec.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// writeRedactedYAML is like writeYAML, but the plaintext values of
+// sensitive fields are redacted.
+func writeRedactedYAML(w http.ResponseWriter, v interface{}) {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", v, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write([]byte(secret.RedactYAML(string(buff))))
+}
+
+func (s *Server) createBlock(w http.ResponseWriter, r *http.Request) {
+	b, err := s.readBlock(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getBlock(b.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("conflict name: %s", b.Name))
+		return
+	}
+
+	s._putBlock(b)
+	s.upgradeConfigVersion(w, r)
+
+	s.setETag(w, s.cluster.Layout().ConfigBlockKey(b.Name))
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, b.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) listBlocks(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	specs := s._listObjects()
+	blocks := s._listBlocks()
+	infos := make([]*BlockInfo, 0, len(blocks))
+	for _, b := range blocks {
+		infos = append(infos, &BlockInfo{
+			Block:   *b,
+			Objects: blockObjects(specs, b.Name),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	writeRedactedYAML(w, infos)
+}
+
+func (s *Server) getBlock(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// No need to lock.
+
+	s.setETag(w, s.cluster.Layout().ConfigBlockKey(name))
+	b := s._getBlock(name)
+	if b == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	writeRedactedYAML(w, &BlockInfo{
+		Block:   *b,
+		Objects: blockObjects(s._listObjects(), name),
+	})
+}
+
+// updateBlock updates the block, all objects referencing it are updated
+// by members, so they must be valid with the new value.
+func (s *Server) updateBlock(w http.ResponseWriter, r *http.Request) {
+	b, err := s.readBlock(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := s.cluster.Layout().ConfigBlockKey(b.Name)
+	if !s._checkIfMatch(w, r, key) {
+		return
+	}
+
+	if s._getBlock(b.Name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	blocks := map[string]*configblock.Block{}
+	for _, b := range s._listBlocks() {
+		blocks[b.Name] = b
+	}
+	err = checkBlockObjects(s._listObjects(), blocks, b)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid objects with block %s: %v", b.Name, err))
+		return
+	}
+
+	s._putBlock(b)
+	s.upgradeConfigVersion(w, r)
+	s.setETag(w, key)
+}
+
+// deleteBlock deletes the block, which must not be referenced by objects.
+func (s *Server) deleteBlock(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if !s._checkIfMatch(w, r, s.cluster.Layout().ConfigBlockKey(name)) {
+		return
+	}
+
+	if s._getBlock(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if names := blockObjects(s._listObjects(), name); len(names) != 0 {
+		HandleAPIError(w, r, http.StatusConflict,
+			fmt.Errorf("block %s is referenced by objects: %s", name, strings.Join(names, ", ")))
+		return
+	}
+
+	s._deleteBlock(name)
+	s.upgradeConfigVersion(w, r)
+}
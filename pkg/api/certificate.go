@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/certstore"
+)
+
+const (
+	// CertificatePrefix is the prefix of certificates.
+	CertificatePrefix = "/certificates"
+)
+
+func (s *Server) setupCertificateAPIs() {
+	certificateAPIs := []*APIEntry{
+		{
+			Path:    CertificatePrefix,
+			Method:  "POST",
+			Handler: s.createCertificate,
+		},
+		{
+			Path:    CertificatePrefix,
+			Method:  "GET",
+			Handler: s.listCertificates,
+		},
+		{
+			Path:    CertificatePrefix + "/{name}",
+			Method:  "GET",
+			Handler: s.getCertificate,
+		},
+		{
+			Path:    CertificatePrefix + "/{name}",
+			Method:  "PUT",
+			Handler: s.updateCertificate,
+		},
+		{
+			Path:    CertificatePrefix + "/{name}",
+			Method:  "DELETE",
+			Handler: s.deleteCertificate,
+		},
+	}
+
+	s.RegisterAPIs(certificateAPIs)
+}
+
+func (s *Server) readCertificate(w http.ResponseWriter, r *http.Request) (*certstore.Certificate, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	c, err := certstore.NewCertificate(body)
+	if err != nil {
+		return nil, err
+	}
+
+	name := chi.URLParam(r, "name")
+	if name != "" && name != c.Name {
+		return nil, fmt.Errorf("inconsistent name in url and certificate")
+	}
+
+	return c, nil
+}
+
+func (s *Server) createCertificate(w http.ResponseWriter, r *http.Request) {
+	c, err := s.readCertificate(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getCertificate(c.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("conflict name: %s", c.Name))
+		return
+	}
+
+	s._putCertificate(c)
+	s.upgradeConfigVersion(w, r)
+
+	s.setETag(w, s.cluster.Layout().ConfigCertificateKey(c.Name))
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, c.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) listCertificates(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	now := time.Now()
+	certificates := s._listCertificates()
+	infos := make([]*certstore.Info, 0, len(certificates))
+	for _, c := range certificates {
+		infos = append(infos, c.Info(now))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	writeYAML(w, infos)
+}
+
+// getCertificate returns the information of the certificate, the private
+// key is never returned.
+func (s *Server) getCertificate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// No need to lock.
+
+	s.setETag(w, s.cluster.Layout().ConfigCertificateKey(name))
+	c := s._getCertificate(name)
+	if c == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	writeYAML(w, c.Info(time.Now()))
+}
+
+// updateCertificate rotates the certificate, objects referencing it use
+// the new one for new connections.
+func (s *Server) updateCertificate(w http.ResponseWriter, r *http.Request) {
+	c, err := s.readCertificate(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := s.cluster.Layout().ConfigCertificateKey(c.Name)
+	if !s._checkIfMatch(w, r, key) {
+		return
+	}
+
+	if s._getCertificate(c.Name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	s._putCertificate(c)
+	s.upgradeConfigVersion(w, r)
+	s.setETag(w, key)
+}
+
+func (s *Server) deleteCertificate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if !s._checkIfMatch(w, r, s.cluster.Layout().ConfigCertificateKey(name)) {
+		return
+	}
+
+	if s._getCertificate(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	s._deleteCertificate(name)
+	s.upgradeConfigVersion(w, r)
+}
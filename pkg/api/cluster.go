@@ -19,9 +19,15 @@ package api
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/megaease/easegress/pkg/apikey"
+	"github.com/megaease/easegress/pkg/certstore"
+	"github.com/megaease/easegress/pkg/configblock"
+	"github.com/megaease/easegress/pkg/featureflag"
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/supervisor"
 
 	yaml "gopkg.in/yaml.v2"
@@ -116,6 +122,114 @@ func (s *Server) _deleteObject(name string) {
 	}
 }
 
+func (s *Server) _listObjectVersions(name string) []*ObjectVersion {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigObjectVersionPrefix(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	versions := make([]*ObjectVersion, 0, len(kvs))
+	for _, v := range kvs {
+		version := &ObjectVersion{}
+		err := yaml.Unmarshal([]byte(v), version)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions
+}
+
+func (s *Server) _putObjectVersion(name string, version *ObjectVersion) {
+	buff, err := yaml.Marshal(version)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", version, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigObjectVersionKey(name, version.Version), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteObjectVersion(name string, version int64) {
+	err := s.cluster.Delete(s.cluster.Layout().ConfigObjectVersionKey(name, version))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteObjectVersions(name string) {
+	err := s.cluster.DeletePrefix(s.cluster.Layout().ConfigObjectVersionPrefix(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getRevision(revision int64) *ConfigRevision {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigHistoryKey(revision))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	result := &ConfigRevision{}
+	err = yaml.Unmarshal([]byte(*value), result)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return result
+}
+
+func (s *Server) _listRevisions() []*ConfigRevision {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigHistoryPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	revisions := make([]*ConfigRevision, 0, len(kvs))
+	for _, v := range kvs {
+		revision := &ConfigRevision{}
+		err := yaml.Unmarshal([]byte(v), revision)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		revisions = append(revisions, revision)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions
+}
+
+func (s *Server) _putRevision(revision *ConfigRevision) {
+	buff, err := yaml.Marshal(revision)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", revision, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigHistoryKey(revision.Revision), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteRevision(revision int64) {
+	err := s.cluster.Delete(s.cluster.Layout().ConfigHistoryKey(revision))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
 func (s *Server) _getStatusObject(name string) map[string]string {
 	prefix := s.cluster.Layout().StatusObjectPrefix(name)
 	kvs, err := s.cluster.GetPrefix(prefix)
@@ -164,3 +278,501 @@ func (s *Server) _listStatusObjects() map[string]map[string]interface{} {
 
 	return status
 }
+
+func (s *Server) _getConsumer(name string) *apikey.Consumer {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigConsumerKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	consumer := &apikey.Consumer{}
+	err = yaml.Unmarshal([]byte(*value), consumer)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return consumer
+}
+
+func (s *Server) _listConsumers() []*apikey.Consumer {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigConsumerPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	consumers := make([]*apikey.Consumer, 0, len(kvs))
+	for _, v := range kvs {
+		consumer := &apikey.Consumer{}
+		err := yaml.Unmarshal([]byte(v), consumer)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		consumers = append(consumers, consumer)
+	}
+
+	return consumers
+}
+
+func (s *Server) _putConsumer(consumer *apikey.Consumer) {
+	buff, err := yaml.Marshal(consumer)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", consumer, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigConsumerKey(consumer.Name), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteConsumer(name string) {
+	err := s.cluster.Delete(s.cluster.Layout().ConfigConsumerKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getAPIKey(id string) *apikey.Key {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigAPIKeyKey(id))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	key := &apikey.Key{}
+	err = yaml.Unmarshal([]byte(*value), key)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return key
+}
+
+// _listAPIKeys lists keys of the consumer.
+func (s *Server) _listAPIKeys(consumer string) []*apikey.Key {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigAPIKeyPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	keys := make([]*apikey.Key, 0)
+	for _, v := range kvs {
+		key := &apikey.Key{}
+		err := yaml.Unmarshal([]byte(v), key)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		if key.Consumer == consumer {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (s *Server) _putAPIKey(key *apikey.Key) {
+	buff, err := yaml.Marshal(key)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", key, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigAPIKeyKey(key.ID), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteAPIKey(id string) {
+	err := s.cluster.Delete(s.cluster.Layout().ConfigAPIKeyKey(id))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getCertificate(name string) *certstore.Certificate {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigCertificateKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	c, err := certstore.NewCertificate([]byte(*value))
+	if err != nil {
+		panic(fmt.Errorf("bad certificate %s: %v", name, err))
+	}
+
+	return c
+}
+
+func (s *Server) _listCertificates() []*certstore.Certificate {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigCertificatePrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	certificates := make([]*certstore.Certificate, 0, len(kvs))
+	for k, v := range kvs {
+		c, err := certstore.NewCertificate([]byte(v))
+		if err != nil {
+			panic(fmt.Errorf("bad certificate %s: %v", k, err))
+		}
+		certificates = append(certificates, c)
+	}
+
+	return certificates
+}
+
+func (s *Server) _putCertificate(c *certstore.Certificate) {
+	value, err := c.Marshal()
+	if err != nil {
+		panic(err)
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigCertificateKey(c.Name), value)
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteCertificate(name string) {
+	err := s.cluster.Delete(s.cluster.Layout().ConfigCertificateKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getFlags(pipeline string) *featureflag.Flags {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigFlagsKey(pipeline))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	f, err := featureflag.NewFlags([]byte(*value))
+	if err != nil {
+		panic(fmt.Errorf("bad flags of %s: %v", pipeline, err))
+	}
+
+	return f
+}
+
+// _putFlags validates and puts the flags, they're deleted if empty.
+func (s *Server) _putFlags(f *featureflag.Flags) error {
+	key := s.cluster.Layout().ConfigFlagsKey(f.Pipeline)
+	if len(f.Flags) == 0 {
+		err := s.cluster.Delete(key)
+		if err != nil {
+			ClusterPanic(err)
+		}
+		return nil
+	}
+
+	buff, err := yaml.Marshal(f)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", f, err))
+	}
+	if _, err = featureflag.NewFlags(buff); err != nil {
+		return err
+	}
+
+	err = s.cluster.Put(key, string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	return nil
+}
+
+func (s *Server) _getNamespace(name string) *Namespace {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigNamespaceKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	ns := &Namespace{}
+	err = yaml.Unmarshal([]byte(*value), ns)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return ns
+}
+
+func (s *Server) _listNamespaces() []*Namespace {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigNamespacePrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	namespaces := make([]*Namespace, 0, len(kvs))
+	for _, v := range kvs {
+		ns := &Namespace{}
+		err := yaml.Unmarshal([]byte(v), ns)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		namespaces = append(namespaces, ns)
+	}
+
+	return namespaces
+}
+
+func (s *Server) _putNamespace(ns *Namespace) {
+	buff, err := yaml.Marshal(ns)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", ns, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigNamespaceKey(ns.Name), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteNamespace(name string) {
+	err := s.cluster.Delete(s.cluster.Layout().ConfigNamespaceKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getStagedDeployment() *stagedDeployment {
+	value, err := s.cluster.Get(s.cluster.Layout().DeploymentStagedKey())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	staged := &stagedDeployment{}
+	err = yaml.Unmarshal([]byte(*value), staged)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return staged
+}
+
+func (s *Server) _putStagedDeployment(staged *stagedDeployment) {
+	buff, err := yaml.Marshal(staged)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", staged, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().DeploymentStagedKey(), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteStagedDeployment() {
+	err := s.cluster.Delete(s.cluster.Layout().DeploymentStagedKey())
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+// _getDeploymentStatus returns the results of preparing the deployment,
+// the keys are the member names.
+func (s *Server) _getDeploymentStatus(id string) map[string]*DeploymentMember {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().StatusDeploymentPrefix(id))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	members := map[string]*DeploymentMember{}
+	for _, v := range kvs {
+		member := &DeploymentMember{}
+		err := yaml.Unmarshal([]byte(v), member)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		members[member.Name] = member
+	}
+
+	return members
+}
+
+func (s *Server) _deleteDeploymentStatus(id string) {
+	err := s.cluster.DeletePrefix(s.cluster.Layout().StatusDeploymentPrefix(id))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getDeployment(id string) *Deployment {
+	value, err := s.cluster.Get(s.cluster.Layout().DeploymentKey(id))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	d := &Deployment{}
+	err = yaml.Unmarshal([]byte(*value), d)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return d
+}
+
+func (s *Server) _listDeployments() []*Deployment {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().DeploymentPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	deployments := make([]*Deployment, 0, len(kvs))
+	for _, v := range kvs {
+		d := &Deployment{}
+		err := yaml.Unmarshal([]byte(v), d)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", v, err))
+		}
+		deployments = append(deployments, d)
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].ID < deployments[j].ID
+	})
+
+	return deployments
+}
+
+func (s *Server) _putDeployment(d *Deployment) {
+	buff, err := yaml.Marshal(d)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", d, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().DeploymentKey(d.ID), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteDeployment(id string) {
+	err := s.cluster.Delete(s.cluster.Layout().DeploymentKey(id))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getBlock(name string) *configblock.Block {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigBlockKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	b, err := configblock.NewBlock([]byte(*value))
+	if err != nil {
+		panic(fmt.Errorf("bad block %s: %v", name, err))
+	}
+
+	return b
+}
+
+func (s *Server) _listBlocks() []*configblock.Block {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigBlockPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	blocks := make([]*configblock.Block, 0, len(kvs))
+	for _, v := range kvs {
+		b, err := configblock.NewBlock([]byte(v))
+		if err != nil {
+			panic(fmt.Errorf("bad block %s: %v", v, err))
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks
+}
+
+// _putBlock stores the block with sensitive fields encrypted.
+func (s *Server) _putBlock(b *configblock.Block) {
+	buff, err := yaml.Marshal(b)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", b, err))
+	}
+
+	config, err := secret.EncryptYAML(string(buff))
+	if err != nil {
+		panic(fmt.Errorf("encrypt sensitive fields failed: %v", err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigBlockKey(b.Name), config)
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteBlock(name string) {
+	err := s.cluster.Delete(s.cluster.Layout().ConfigBlockKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getRegionReport(region string) *RegionReport {
+	value, err := s.cluster.Get(s.cluster.Layout().StatusFederationKey(region))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	report := &RegionReport{}
+	err = yaml.Unmarshal([]byte(*value), report)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to region report failed: %v", *value, err))
+	}
+
+	return report
+}
+
+func (s *Server) _putRegionReport(report *RegionReport) {
+	buff, err := yaml.Marshal(report)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", report, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().StatusFederationKey(report.Region), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteRegionReport(region string) {
+	err := s.cluster.Delete(s.cluster.Layout().StatusFederationKey(region))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
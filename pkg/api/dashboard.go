@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+
+	yamljsontool "github.com/ghodss/yaml"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+const (
+	// DashboardPath is the path of the web dashboard, it's not under
+	// APIPrefix.
+	DashboardPath = "/dashboard"
+
+	// DashboardPrefix is the prefix of the data of the web dashboard.
+	DashboardPrefix = "/dashboard"
+
+	dashboardErrorLimit = 50
+)
+
+type (
+	// Dashboard is the data shown by the web dashboard.
+	Dashboard struct {
+		Member  string                   `yaml:"member"`
+		Objects []map[string]interface{} `yaml:"objects"`
+		// ETags are the ETags of the objects, keyed by their names.
+		ETags     map[string]string    `yaml:"etags"`
+		Pipelines []*DashboardPipeline `yaml:"pipelines"`
+		// Errors are the latest access records of the member responded
+		// with 5xx.
+		Errors []*httppipeline.AccessRecord `yaml:"errors"`
+	}
+
+	// DashboardPipeline is a pipeline shown by the web dashboard.
+	DashboardPipeline struct {
+		Name   string                 `yaml:"name"`
+		Stages []*httppipeline.Stage  `yaml:"stages"`
+		Status map[string]interface{} `yaml:"status"`
+	}
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+func (s *Server) setupDashboardAPIs() {
+	dashboardAPIs := []*APIEntry{
+		{
+			Path:    DashboardPrefix,
+			Method:  "GET",
+			Handler: s.getDashboard,
+		},
+	}
+
+	s.RegisterAPIs(dashboardAPIs)
+
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(fmt.Errorf("BUG: open dashboard files failed: %v", err))
+	}
+	fileServer := http.StripPrefix(DashboardPath, http.FileServer(http.FS(files)))
+	s.router.Get(DashboardPath, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, DashboardPath+"/", http.StatusMovedPermanently)
+	})
+	s.router.Get(DashboardPath+"/*", fileServer.ServeHTTP)
+}
+
+// isDashboardFile reports whether the request is for the static files of
+// the dashboard, which hold no data.
+func isDashboardFile(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return r.URL.Path == DashboardPath || strings.HasPrefix(r.URL.Path, DashboardPath+"/")
+}
+
+// getDashboard reports the objects, the flows and status of pipelines in
+// all members, and the recent errors of the member, in JSON.
+func (s *Server) getDashboard(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	specs := specList(s._listObjects())
+	sort.Sort(specs)
+	status := s._listStatusObjects()
+
+	dashboard := &Dashboard{
+		Member:    s.opt.Name,
+		Objects:   []map[string]interface{}{},
+		ETags:     map[string]string{},
+		Pipelines: []*DashboardPipeline{},
+	}
+	for _, spec := range specs {
+		doc, err := redactedSpecDoc(spec)
+		if err != nil {
+			panic(err)
+		}
+		dashboard.Objects = append(dashboard.Objects, doc)
+		dashboard.ETags[spec.Name()] = etagOf(spec.YAMLConfig())
+
+		if spec.Kind() != httppipeline.Kind {
+			continue
+		}
+		dashboard.Pipelines = append(dashboard.Pipelines, &DashboardPipeline{
+			Name:   spec.Name(),
+			Stages: spec.ObjectSpec().(*httppipeline.Spec).Graph(),
+			Status: status[spec.Name()],
+		})
+	}
+
+	dashboard.Errors = httppipeline.RecentAccessRecords(func(record *httppipeline.AccessRecord) bool {
+		return record.StatusCode >= http.StatusInternalServerError
+	}, dashboardErrorLimit)
+	if dashboard.Errors == nil {
+		dashboard.Errors = []*httppipeline.AccessRecord{}
+	}
+
+	writeJSON(w, dashboard)
+}
+
+// writeJSON writes v in JSON, it's marshalled to YAML first, so the maps
+// unmarshalled from YAML are accepted.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", v, err))
+	}
+	buff, err = yamljsontool.YAMLToJSON(buff)
+	if err != nil {
+		panic(fmt.Errorf("convert %s to json failed: %v", buff, err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buff)
+}
@@ -0,0 +1,676 @@
+// The dashboard of Easegress, it only uses the admin API, the data of
+// pipelines is refreshed every five seconds, which is the interval the
+// members report their status.
+(function () {
+  'use strict';
+
+  var API = '/apis/v1';
+  var REFRESH_INTERVAL = 5000;
+  var REDACTED = '******';
+
+  var state = {
+    dashboard: null,
+    schemas: null,
+    pipeline: null,
+    object: null,
+  };
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(tag, attrs, children) {
+    var e = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      if (key === 'text') {
+        e.textContent = attrs[key];
+      } else if (key.indexOf('on') === 0) {
+        e.addEventListener(key.slice(2), attrs[key]);
+      } else {
+        e.setAttribute(key, attrs[key]);
+      }
+    });
+    (children || []).forEach(function (child) {
+      e.appendChild(typeof child === 'string' ? document.createTextNode(child) : child);
+    });
+    return e;
+  }
+
+  function svg(tag, attrs, text) {
+    var e = document.createElementNS('http://www.w3.org/2000/svg', tag);
+    Object.keys(attrs).forEach(function (key) {
+      e.setAttribute(key, attrs[key]);
+    });
+    if (text !== undefined) {
+      e.textContent = text;
+    }
+    return e;
+  }
+
+  function showMessage(text, info) {
+    var message = $('message');
+    message.textContent = text;
+    message.className = info ? 'info' : '';
+    message.hidden = !text;
+  }
+
+  // request calls the admin API with the token, it's resolved with the
+  // body and the ETag, errors are rejected with the messages in them.
+  function request(method, path, body, etag) {
+    var headers = {};
+    if (etag) {
+      headers['If-Match'] = etag;
+    }
+    var token = sessionStorage.getItem('token');
+    if (token) {
+      headers.Authorization = 'Bearer ' + token;
+    }
+    if (body !== undefined) {
+      headers['Content-Type'] = 'application/json';
+      body = JSON.stringify(body);
+    }
+
+    return fetch(API + path, { method: method, headers: headers, body: body }).then(function (resp) {
+      return resp.text().then(function (text) {
+        if (resp.ok) {
+          return { text: text, etag: resp.headers.get('ETag') };
+        }
+        var match = /^message: ([\s\S]*)$/m.exec(text);
+        throw new Error(resp.status + ': ' + (match ? match[1].trim() : text));
+      });
+    });
+  }
+
+  function getJSON(path) {
+    return request('GET', path).then(function (resp) {
+      return JSON.parse(resp.text);
+    });
+  }
+
+  // Pipelines
+
+  // stageStats sums up the stats of the stage in all members, the
+  // percentiles are the max ones.
+  function stageStats(pipeline, name) {
+    var stats = { count: 0, m1: 0, p50: 0, p99: 0, results: {} };
+    Object.keys(pipeline.status || {}).forEach(function (member) {
+      var stages = pipeline.status[member].stages || {};
+      var stage = stages[name];
+      if (!stage) {
+        return;
+      }
+      stats.count += stage.count;
+      stats.m1 += stage.m1;
+      stats.p50 = Math.max(stats.p50, stage.p50);
+      stats.p99 = Math.max(stats.p99, stage.p99);
+      Object.keys(stage.results || {}).forEach(function (result) {
+        stats.results[result] = (stats.results[result] || 0) + stage.results[result];
+      });
+    });
+    return stats;
+  }
+
+  function renderPipelineList() {
+    var list = $('pipeline-list');
+    list.innerHTML = '';
+    state.dashboard.pipelines.forEach(function (pipeline) {
+      var item = el('li', {
+        onclick: function () {
+          state.pipeline = pipeline.name;
+          renderPipelineList();
+          renderPipeline();
+        },
+      }, [pipeline.name]);
+      if (pipeline.name === state.pipeline) {
+        item.className = 'selected';
+      }
+      list.appendChild(item);
+    });
+  }
+
+  function renderPipeline() {
+    var view = $('pipeline-view');
+    var pipeline = state.dashboard.pipelines.filter(function (p) {
+      return p.name === state.pipeline;
+    })[0];
+    if (!pipeline) {
+      return;
+    }
+
+    view.innerHTML = '';
+    view.appendChild(el('h2', { text: pipeline.name }));
+
+    var members = Object.keys(pipeline.status || {}).sort();
+    if (members.length === 0) {
+      view.appendChild(el('p', { class: 'hint', text: 'Not running in any member.' }));
+    }
+    members.forEach(function (member) {
+      var status = pipeline.status[member];
+      var stats = status.stats || {};
+      var summary = el('div', { class: 'summary' }, [
+        el('strong', { text: member }),
+        ' ',
+        el('span', { text: 'requests/s: ' + (stats.m1 || 0).toFixed(2) }),
+        el('span', { text: 'p50: ' + (stats.p50 || 0).toFixed(1) + 'ms' }),
+        el('span', { text: 'p99: ' + (stats.p99 || 0).toFixed(1) + 'ms' }),
+        el('span', { text: 'errors: ' + ((stats.m1ErrPercent || 0) * 100).toFixed(1) + '%' }),
+      ]);
+      if (status.health) {
+        summary.insertBefore(el('span', { text: 'health: ' + status.health }), summary.children[1]);
+        if (status.health !== 'healthy') {
+          summary.classList.add('unhealthy');
+        }
+      }
+      view.appendChild(summary);
+    });
+
+    view.appendChild(renderFlow(pipeline));
+  }
+
+  // renderFlow draws the stages in a row, the edges to the next stages
+  // are below them, and the edges of jumpIf are above them.
+  function renderFlow(pipeline) {
+    var width = 170;
+    var height = 84;
+    var gap = 50;
+    var top = 30 + 24 * pipeline.stages.length;
+    var nodes = pipeline.stages.map(function (stage) {
+      return stage.filter;
+    }).concat(['END']);
+
+    var chart = svg('svg', {
+      class: 'flow',
+      width: nodes.length * (width + gap) + gap,
+      height: top + height + 30 + 24 * pipeline.stages.length,
+    });
+    var defs = svg('defs', {});
+    var marker = svg('marker', {
+      id: 'arrow', viewBox: '0 0 10 10', refX: 10, refY: 5,
+      markerWidth: 6, markerHeight: 6, orient: 'auto-start-reverse',
+    });
+    marker.appendChild(svg('path', { d: 'M 0 0 L 10 5 L 0 10 z', fill: '#6a737d' }));
+    defs.appendChild(marker);
+    chart.appendChild(defs);
+
+    var x = function (index) {
+      return gap + index * (width + gap);
+    };
+
+    nodes.forEach(function (name, i) {
+      var g = svg('g', {});
+      if (name === 'END') {
+        g.appendChild(svg('rect', { class: 'end', x: x(i), y: top + 20, width: 60, height: 40, rx: 20 }));
+        g.appendChild(svg('text', { x: x(i) + 14, y: top + 45 }, 'END'));
+        chart.appendChild(g);
+        return;
+      }
+
+      var stage = pipeline.stages[i];
+      var stats = stageStats(pipeline, name);
+      var results = Object.keys(stats.results).map(function (result) {
+        return result + ': ' + stats.results[result];
+      }).join(', ');
+
+      g.appendChild(svg('rect', { x: x(i), y: top, width: width, height: height, rx: 4 }));
+      g.appendChild(svg('text', { class: 'name', x: x(i) + 8, y: top + 18 }, name));
+      g.appendChild(svg('text', { x: x(i) + 8, y: top + 34 }, stage.kind));
+      g.appendChild(svg('text', { class: 'stat', x: x(i) + 8, y: top + 52 },
+        stats.m1.toFixed(2) + ' req/s'));
+      g.appendChild(svg('text', { class: 'stat', x: x(i) + 8, y: top + 68 },
+        'p50 ' + stats.p50.toFixed(1) + 'ms  p99 ' + stats.p99.toFixed(1) + 'ms'));
+      var title = svg('title', {}, (stage.if ? 'if: ' + stage.if + '\n' : '') +
+        'count: ' + stats.count + (results ? '\n' + results : ''));
+      g.appendChild(title);
+      chart.appendChild(g);
+    });
+
+    pipeline.stages.forEach(function (stage, i) {
+      stage.edges.forEach(function (edge, j) {
+        var to = nodes.indexOf(edge.to);
+        if (to < 0) {
+          return;
+        }
+        var x1 = x(i) + width;
+        var x2 = x(to);
+        var y = top + height / 2;
+        if (!edge.result && to === i + 1) {
+          chart.appendChild(svg('path', { d: 'M ' + x1 + ' ' + y + ' L ' + x2 + ' ' + y, 'marker-end': 'url(#arrow)' }));
+          return;
+        }
+
+        // Edges skipping stages are arcs, the farther the higher.
+        var above = !!edge.result;
+        var from = x(i) + width / 2 + (j - stage.edges.length / 2) * 12;
+        var end = to === nodes.length - 1 ? x(to) + 30 : x(to) + width / 2;
+        var yEdge = above ? top : top + height;
+        var yEnd = to === nodes.length - 1 ? (above ? top + 20 : top + 60) : yEdge;
+        var lift = 24 * (i + j + 1);
+        var yControl = above ? yEdge - lift : yEdge + lift;
+        chart.appendChild(svg('path', {
+          class: edge.result ? 'jump' : '',
+          d: 'M ' + from + ' ' + yEdge + ' C ' + from + ' ' + yControl + ', ' +
+            end + ' ' + yControl + ', ' + end + ' ' + yEnd,
+          'marker-end': 'url(#arrow)',
+        }));
+        if (edge.result) {
+          chart.appendChild(svg('text', {
+            class: 'label', x: (from + end) / 2 - 20, y: yControl + (above ? 10 : -4),
+          }, edge.result));
+        }
+      });
+    });
+
+    return chart;
+  }
+
+  // Errors
+
+  function renderErrors() {
+    var list = $('error-list');
+    list.innerHTML = '';
+    state.dashboard.errors.slice().reverse().forEach(function (record) {
+      list.appendChild(el('tr', {}, [
+        el('td', { text: new Date(record.time).toLocaleString() }),
+        el('td', { text: record.pipeline }),
+        el('td', { text: record.method }),
+        el('td', { text: record.path }),
+        el('td', { text: String(record.statusCode) }),
+        el('td', { text: record.duration }),
+        el('td', { text: record.requestID || '' }),
+      ]));
+    });
+    if (state.dashboard.errors.length === 0) {
+      list.appendChild(el('tr', {}, [el('td', { colspan: 7, class: 'hint', text: 'No errors.' })]));
+    }
+  }
+
+  // Objects
+
+  function renderObjectList() {
+    var list = $('object-list');
+    list.innerHTML = '';
+    state.dashboard.objects.forEach(function (object) {
+      var item = el('li', {
+        onclick: function () {
+          state.object = object.name;
+          renderObjectList();
+          renderEditor(object.kind, object, false);
+        },
+      }, [object.name, el('small', { text: object.kind })]);
+      if (object.name === state.object) {
+        item.className = 'selected';
+      }
+      list.appendChild(item);
+    });
+  }
+
+  function resolve(schema, root) {
+    while (schema && schema.$ref) {
+      schema = root.definitions[schema.$ref.replace('#/definitions/', '')];
+    }
+    return schema || {};
+  }
+
+  function isEmpty(value) {
+    return value === undefined || value === '' ||
+      (Array.isArray(value) && value.length === 0) ||
+      (value !== null && typeof value === 'object' && Object.keys(value).length === 0);
+  }
+
+  // field renders the form field of the schema with the value, it
+  // returns the element and the function getting the edited value,
+  // empty values are undefined so they're omitted.
+  function field(schema, value, root) {
+    schema = resolve(schema, root);
+    var type = Array.isArray(schema.type) ? schema.type[0] : schema.type;
+
+    if (schema.enum) {
+      var select = el('select', {}, [el('option', { value: '', text: '' })].concat(
+        schema.enum.map(function (item) {
+          return el('option', { value: item, text: item === '' ? '(empty)' : String(item) });
+        })));
+      select.value = value === undefined ? (schema.default === undefined ? '' : schema.default) : value;
+      return { el: select, get: function () { return select.value === '' ? undefined : select.value; } };
+    }
+
+    if (type === 'boolean') {
+      var checkbox = el('input', { type: 'checkbox' });
+      checkbox.checked = value === undefined ? !!schema.default : !!value;
+      return { el: checkbox, get: function () { return checkbox.checked ? true : undefined; } };
+    }
+
+    if (type === 'integer' || type === 'number') {
+      var number = el('input', { type: 'number', step: type === 'integer' ? 1 : 'any' });
+      number.value = value === undefined ? '' : value;
+      if (schema.default !== undefined) {
+        number.placeholder = schema.default;
+      }
+      return { el: number, get: function () { return number.value === '' ? undefined : Number(number.value); } };
+    }
+
+    if (type === 'string') {
+      var input = el('input', { type: value === REDACTED ? 'password' : 'text' });
+      input.value = value === undefined ? '' : value;
+      if (schema.default !== undefined) {
+        input.placeholder = schema.default;
+      } else if (schema.format) {
+        input.placeholder = schema.format;
+      }
+      return { el: input, get: function () { return input.value === '' ? undefined : input.value; } };
+    }
+
+    if (type === 'array' && schema.items) {
+      return arrayField(value || [], function (item) {
+        return field(schema.items, item, root);
+      });
+    }
+
+    if (type === 'object' && schema.properties && !schema.additionalProperties) {
+      return objectField(schema, value || {}, root);
+    }
+
+    return jsonField(value);
+  }
+
+  function objectField(schema, value, root) {
+    var fieldset = el('fieldset');
+    var required = schema.required || [];
+    var fields = {};
+    Object.keys(schema.properties).sort(function (a, b) {
+      var ra = required.indexOf(a) >= 0 ? 0 : 1;
+      var rb = required.indexOf(b) >= 0 ? 0 : 1;
+      return ra - rb || a.localeCompare(b);
+    }).forEach(function (name) {
+      var property = resolve(schema.properties[name], root);
+      var f = field(property, value[name], root);
+      var label = el('label', { text: name, title: property.description || '' });
+      if (required.indexOf(name) >= 0) {
+        label.className = 'required';
+      }
+      fieldset.appendChild(el('div', { class: 'field' }, [label, f.el]));
+      fields[name] = f;
+    });
+
+    return {
+      el: fieldset,
+      get: function () {
+        // NOTE: The fields not in the schema are kept as they are.
+        var result = {};
+        Object.keys(value).forEach(function (name) {
+          if (!fields[name]) {
+            result[name] = value[name];
+          }
+        });
+        Object.keys(fields).forEach(function (name) {
+          var v = fields[name].get();
+          if (!isEmpty(v)) {
+            result[name] = v;
+          }
+        });
+        return isEmpty(result) ? undefined : result;
+      },
+    };
+  }
+
+  function arrayField(value, newItem) {
+    var container = el('div');
+    var items = [];
+    var add = function (item) {
+      var f = newItem(item);
+      var row = el('div', { class: 'item' }, [f.el]);
+      var entry = { f: f, row: row };
+      row.appendChild(el('button', {
+        type: 'button',
+        text: '−',
+        onclick: function () {
+          items.splice(items.indexOf(entry), 1);
+          container.removeChild(row);
+        },
+      }));
+      items.push(entry);
+      container.insertBefore(row, addButton);
+    };
+    var addButton = el('button', { type: 'button', text: '+', onclick: function () { add(undefined); } });
+    container.appendChild(addButton);
+    value.forEach(add);
+
+    return {
+      el: container,
+      get: function () {
+        var result = items.map(function (entry) {
+          return entry.f.get();
+        }).filter(function (v) {
+          return v !== undefined;
+        });
+        return result.length === 0 ? undefined : result;
+      },
+    };
+  }
+
+  function jsonField(value) {
+    var textarea = el('textarea');
+    textarea.value = value === undefined ? '' : JSON.stringify(value, null, 2);
+    return {
+      el: textarea,
+      get: function () {
+        if (textarea.value.trim() === '') {
+          return undefined;
+        }
+        return JSON.parse(textarea.value);
+      },
+    };
+  }
+
+  // filterField renders a filter of pipelines by the schema of its kind.
+  function filterField(filter) {
+    var container = el('div');
+    var kinds = Object.keys(state.schemas.filters).sort();
+    var select = el('select', {}, kinds.map(function (kind) {
+      return el('option', { value: kind, text: kind });
+    }));
+    var current = null;
+    var render = function (value) {
+      if (current) {
+        container.removeChild(current.el);
+      }
+      var schema = state.schemas.filters[select.value];
+      current = schema ? field(schema, value, schema) : jsonField(value);
+      container.appendChild(current.el);
+    };
+    select.addEventListener('change', function () {
+      var value = current.get() || {};
+      value.kind = select.value;
+      render(value);
+    });
+
+    filter = filter || { kind: kinds[0] };
+    select.value = filter.kind;
+    container.appendChild(select);
+    render(filter);
+
+    return { el: container, get: function () { return current.get(); } };
+  }
+
+  function renderEditor(kind, object, isNew) {
+    var editor = $('editor');
+    editor.innerHTML = '';
+    editor.appendChild(el('h2', { text: isNew ? 'New ' + kind : object.name }));
+
+    var schema = state.schemas.objects[kind];
+    if (!schema) {
+      editor.appendChild(el('p', { class: 'hint', text: 'Schema of ' + kind + ' not found.' }));
+      return;
+    }
+
+    // NOTE: The object is saved only if no one changed it after it's
+    // shown, the ETag is kept until the editor is rendered again.
+    var etag = isNew ? '' : state.dashboard.etags[object.name];
+    var value = JSON.parse(JSON.stringify(object || { kind: kind }));
+    var filters = value.filters;
+    var form = field(schema, value, schema);
+    editor.appendChild(form.el);
+
+    var filtersField = null;
+    if (kind === 'HTTPPipeline') {
+      filtersField = arrayField(filters || [], filterField);
+      editor.appendChild(el('h3', { text: 'filters' }));
+      editor.appendChild(filtersField.el);
+    }
+
+    var raw = jsonField(object || { name: '', kind: kind });
+    raw.el.hidden = true;
+    editor.appendChild(raw.el);
+
+    var read = function () {
+      if (!raw.el.hidden) {
+        return raw.get();
+      }
+      var spec = form.get() || {};
+      if (filtersField) {
+        spec.filters = filtersField.get() || [];
+      }
+      return spec;
+    };
+
+    var save = function () {
+      var spec;
+      try {
+        spec = read();
+      } catch (e) {
+        showMessage('Invalid JSON: ' + e.message);
+        return;
+      }
+      var done = isNew ?
+        request('POST', '/objects', spec) :
+        request('PUT', '/objects/' + encodeURIComponent(object.name), spec, etag);
+      done.then(function (resp) {
+        etag = resp.etag || etag;
+        state.object = spec.name;
+        showMessage((isNew ? 'Created ' : 'Updated ') + spec.name, true);
+        return refresh().then(function () {
+          var created = state.dashboard.objects.filter(function (o) {
+            return o.name === spec.name;
+          })[0];
+          if (isNew && created) {
+            renderEditor(created.kind, created, false);
+          }
+        });
+      }).catch(function (e) {
+        showMessage(e.message);
+      });
+    };
+
+    var remove = function () {
+      if (!window.confirm('Delete ' + object.name + '?')) {
+        return;
+      }
+      request('DELETE', '/objects/' + encodeURIComponent(object.name), undefined, etag).then(function () {
+        state.object = null;
+        showMessage('Deleted ' + object.name, true);
+        $('editor').innerHTML = '';
+        refresh();
+      }).catch(function (e) {
+        showMessage(e.message);
+      });
+    };
+
+    var actions = el('div', { class: 'actions' }, [
+      el('button', { type: 'button', text: isNew ? 'Create' : 'Save', onclick: save }),
+      el('button', {
+        type: 'button',
+        text: 'Edit JSON',
+        onclick: function (e) {
+          if (raw.el.hidden) {
+            try {
+              raw.el.value = JSON.stringify(read(), null, 2);
+            } catch (err) {
+              showMessage(err.message);
+              return;
+            }
+          }
+          raw.el.hidden = !raw.el.hidden;
+          e.target.textContent = raw.el.hidden ? 'Edit JSON' : 'Edit form';
+          form.el.hidden = !raw.el.hidden;
+          if (filtersField) {
+            filtersField.el.hidden = !raw.el.hidden;
+          }
+        },
+      }),
+    ]);
+    if (!isNew) {
+      actions.appendChild(el('button', { type: 'button', text: 'Delete', onclick: remove }));
+    }
+    editor.appendChild(actions);
+    editor.appendChild(el('p', {
+      class: 'hint',
+      text: 'Sensitive fields shown as ' + REDACTED + ' keep their current values if unchanged.',
+    }));
+  }
+
+  function renderKinds() {
+    var select = $('new-kind');
+    select.innerHTML = '';
+    Object.keys(state.schemas.objects).sort().forEach(function (kind) {
+      select.appendChild(el('option', { value: kind, text: kind }));
+    });
+  }
+
+  // Refreshing
+
+  function refresh() {
+    return getJSON('/dashboard').then(function (dashboard) {
+      state.dashboard = dashboard;
+      $('member').textContent = dashboard.member;
+      renderPipelineList();
+      renderPipeline();
+      renderErrors();
+      renderObjectList();
+      if ($('message').className !== 'info') {
+        showMessage('');
+      }
+    }).catch(function (e) {
+      showMessage(e.message);
+    });
+  }
+
+  function loadSchemas() {
+    return getJSON('/schemas').then(function (schemas) {
+      state.schemas = schemas;
+      renderKinds();
+    }).catch(function (e) {
+      showMessage(e.message);
+    });
+  }
+
+  document.querySelectorAll('header nav button').forEach(function (button) {
+    button.addEventListener('click', function () {
+      document.querySelectorAll('header nav button').forEach(function (b) {
+        b.classList.toggle('active', b === button);
+        $(b.dataset.tab).hidden = b !== button;
+      });
+    });
+  });
+
+  $('token').value = sessionStorage.getItem('token') || '';
+  $('token-form').addEventListener('submit', function (e) {
+    e.preventDefault();
+    sessionStorage.setItem('token', $('token').value);
+    loadSchemas().then(refresh);
+  });
+
+  $('new-object').addEventListener('click', function () {
+    if (!state.schemas) {
+      return;
+    }
+    state.object = null;
+    renderObjectList();
+    renderEditor($('new-kind').value, null, true);
+  });
+
+  loadSchemas().then(refresh);
+  setInterval(function () {
+    if (document.visibilityState === 'visible') {
+      refresh();
+    }
+  }, REFRESH_INTERVAL);
+})();
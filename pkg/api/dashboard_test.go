@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDashboardFiles(t *testing.T) {
+	for _, name := range []string{"index.html", "dashboard.js", "dashboard.css"} {
+		if _, err := dashboardFiles.ReadFile("dashboard/" + name); err != nil {
+			t.Errorf("read %s failed: %v", name, err)
+		}
+	}
+
+	for path, want := range map[string]bool{
+		"/dashboard":             true,
+		"/dashboard/index.html":  true,
+		"/dashboards":            false,
+		APIPrefix + "/dashboard": false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if got := isDashboardFile(r); got != want {
+			t.Errorf("%s: want %v, got %v", path, want, got)
+		}
+	}
+	r := httptest.NewRequest(http.MethodPost, "/dashboard/index.html", nil)
+	if isDashboardFile(r) {
+		t.Errorf("POST should not be taken as a static file")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSON(w, map[string]interface{}{
+		"status": map[interface{}]interface{}{"m1": 0.5},
+	})
+	if got := w.Body.String(); got != `{"status":{"m1":0.5}}` {
+		t.Errorf("unexpected json: %s", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("unexpected content type: %s", got)
+	}
+}
@@ -0,0 +1,467 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/audit"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// DeploymentPrefix is the prefix of deployments.
+	DeploymentPrefix = "/deployments"
+
+	deploymentStateCommitted = "committed"
+	deploymentStateAborted   = "aborted"
+
+	defaultDeploymentTimeout  = 30 * time.Second
+	maxDeploymentTimeout      = 5 * time.Minute
+	deploymentPollInterval    = 500 * time.Millisecond
+	deploymentRewatchInterval = 5 * time.Second
+	// deploymentLiveMemberTimeout is the max age of the last heartbeat
+	// of the members which must prepare deployments, others are down and
+	// get the whole config when they're up.
+	deploymentLiveMemberTimeout = 3 * cluster.HeartbeatInterval
+	// deploymentRecords is the number of records of deployments kept.
+	deploymentRecords = 20
+)
+
+type (
+	// Deployment is a set of objects deployed to all members at once, the
+	// changes are staged and prepared by every live member first, then
+	// they're made in one transaction, so all members switch to the new
+	// config together. Nothing is changed if any member fails to prepare
+	// them.
+	Deployment struct {
+		ID    string `yaml:"id"`
+		Time  string `yaml:"time"`
+		Actor string `yaml:"actor"`
+		State string `yaml:"state"`
+		Error string `yaml:"error,omitempty"`
+		// BaseVersion is the config version the changes are planned
+		// on, and Version is the one after they're committed.
+		BaseVersion int64               `yaml:"baseVersion"`
+		Version     int64               `yaml:"version,omitempty"`
+		Changes     []*ApplyChange      `yaml:"changes"`
+		Members     []*DeploymentMember `yaml:"members"`
+	}
+
+	// DeploymentMember is the result of preparing a deployment in a member.
+	DeploymentMember struct {
+		Name     string `yaml:"name"`
+		Prepared bool   `yaml:"prepared"`
+		Error    string `yaml:"error,omitempty"`
+	}
+
+	// stagedDeployment is the deployment being prepared by all members,
+	// the specs are the created or updated ones.
+	stagedDeployment struct {
+		ID       string   `yaml:"id"`
+		Deadline string   `yaml:"deadline"`
+		Specs    []string `yaml:"specs"`
+	}
+)
+
+func (s *Server) setupDeploymentAPIs() {
+	deploymentAPIs := []*APIEntry{
+		{
+			Path:    DeploymentPrefix,
+			Method:  "POST",
+			Handler: s.createDeployment,
+		},
+		{
+			Path:    DeploymentPrefix,
+			Method:  "GET",
+			Handler: s.listDeployments,
+		},
+		{
+			Path:    DeploymentPrefix + "/{id}",
+			Method:  "GET",
+			Handler: s.getDeployment,
+		},
+	}
+
+	s.RegisterAPIs(deploymentAPIs)
+
+	go s.watchDeployments()
+}
+
+// createDeployment deploys the objects in the body like applying them,
+// but all members switch to them at once. The query timeout is how long
+// to wait for members to prepare them.
+func (s *Server) createDeployment(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultDeploymentTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		var err error
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout <= 0 || timeout > maxDeploymentTimeout {
+			HandleAPIError(w, r, http.StatusBadRequest,
+				fmt.Errorf("invalid timeout %s, it must be within %s", v, maxDeploymentTimeout))
+			return
+		}
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	specs, err := readSpecs(body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	d := s.stageDeployment(w, r, specs, timeout)
+	if d == nil {
+		return
+	}
+
+	if len(d.Changes) != 0 {
+		d.Members = s.waitDeploymentPrepared(d.ID, timeout)
+		var failures []string
+		for _, m := range d.Members {
+			if !m.Prepared {
+				failures = append(failures, fmt.Sprintf("%s: %s", m.Name, m.Error))
+			}
+		}
+
+		if len(failures) != 0 {
+			d.Error = strings.Join(failures, "; ")
+		} else if err := s.commitDeployment(w, r, d); err != nil {
+			d.Error = err.Error()
+		}
+	}
+
+	if d.Error != "" {
+		d.State = deploymentStateAborted
+	} else {
+		d.State = deploymentStateCommitted
+	}
+	s.finishDeployment(d)
+	auditDeployment(r, d)
+
+	if d.State == deploymentStateAborted {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("deployment %s aborted: %s", d.ID, d.Error))
+		return
+	}
+	writeYAML(w, d)
+}
+
+// stageDeployment plans the changes and stages them for members to
+// prepare, it handles the error and returns nil if it fails.
+func (s *Server) stageDeployment(w http.ResponseWriter, r *http.Request,
+	specs []*supervisor.Spec, timeout time.Duration) *Deployment {
+
+	s.Lock()
+	defer s.Unlock()
+
+	plan, err := s._planApply(specs, nil)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return nil
+	}
+	if len(plan.Changes) > maxTxnChanges {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("too many changes: %d, at most %d", len(plan.Changes), maxTxnChanges))
+		return nil
+	}
+	for _, change := range plan.Changes {
+		if !authorizeObject(w, r, change.Name) {
+			return nil
+		}
+	}
+
+	if staged := s._getStagedDeployment(); staged != nil {
+		if deadline, _ := time.Parse(time.RFC3339, staged.Deadline); time.Now().Before(deadline) {
+			HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("deployment %s is in progress", staged.ID))
+			return nil
+		}
+	}
+
+	now := time.Now()
+	d := &Deployment{
+		ID:          strconv.FormatInt(now.UnixNano(), 10),
+		Time:        now.Format(time.RFC3339),
+		Actor:       principalOf(r),
+		BaseVersion: s._getVersion(),
+		Changes:     plan.Changes,
+	}
+	if len(d.Changes) == 0 {
+		return d
+	}
+
+	staged := &stagedDeployment{
+		ID: d.ID,
+		// NOTE: The stage expires in case this member is down before
+		// finishing it, the commit takes a bit of time after the timeout.
+		Deadline: now.Add(2 * timeout).Format(time.RFC3339),
+	}
+	for _, change := range d.Changes {
+		if change.Action == applyActionDelete {
+			continue
+		}
+		change.spec, err = encryptSpec(change.spec)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return nil
+		}
+		staged.Specs = append(staged.Specs, change.spec.YAMLConfig())
+	}
+	s._putStagedDeployment(staged)
+
+	return d
+}
+
+// waitDeploymentPrepared waits for all live members to prepare the
+// deployment until the timeout, and returns their results.
+func (s *Server) waitDeploymentPrepared(id string, timeout time.Duration) []*DeploymentMember {
+	members := s.liveMembers()
+	deadline := time.Now().Add(timeout)
+
+	var reports map[string]*DeploymentMember
+	for {
+		reports = s._getDeploymentStatus(id)
+		prepared := true
+		for _, name := range members {
+			if reports[name] == nil {
+				prepared = false
+			}
+		}
+		if prepared || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(deploymentPollInterval)
+	}
+
+	results := make([]*DeploymentMember, 0, len(members))
+	for _, name := range members {
+		m := reports[name]
+		if m == nil {
+			m = &DeploymentMember{Name: name, Error: fmt.Sprintf("not prepared in %s", timeout)}
+		}
+		results = append(results, m)
+	}
+	return results
+}
+
+// liveMembers returns the names of members with recent heartbeats, and
+// this member.
+func (s *Server) liveMembers() []string {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().StatusMemberPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	names := []string{s.opt.Name}
+	for _, v := range kvs {
+		status := &cluster.MemberStatus{}
+		err := yaml.Unmarshal([]byte(v), status)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to member status failed: %v", v, err))
+		}
+		heartbeat, err := time.Parse(time.RFC3339, status.LastHeartbeatTime)
+		if err != nil || time.Since(heartbeat) > deploymentLiveMemberTimeout {
+			continue
+		}
+		if status.Options.Name != s.opt.Name {
+			names = append(names, status.Options.Name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// commitDeployment makes all changes of the deployment in one transaction
+// with the new config version, unless the config has been changed since
+// it's planned.
+func (s *Server) commitDeployment(w http.ResponseWriter, r *http.Request, d *Deployment) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if version := s._getVersion(); version != d.BaseVersion {
+		return fmt.Errorf("config changed from version %d to %d during the deployment", d.BaseVersion, version)
+	}
+
+	version, err := s._commitChanges(w, d.Actor, 0, d.Changes)
+	if err != nil {
+		return err
+	}
+	d.Version = version
+
+	return nil
+}
+
+// finishDeployment records the deployment, and removes the stage of it.
+func (s *Server) finishDeployment(d *Deployment) {
+	s.Lock()
+	defer s.Unlock()
+
+	if staged := s._getStagedDeployment(); staged != nil && staged.ID == d.ID {
+		s._deleteStagedDeployment()
+	}
+	s._deleteDeploymentStatus(d.ID)
+
+	s._putDeployment(d)
+	deployments := s._listDeployments()
+	for len(deployments) > deploymentRecords {
+		s._deleteDeployment(deployments[0].ID)
+		deployments = deployments[1:]
+	}
+}
+
+func auditDeployment(r *http.Request, d *Deployment) {
+	record, ok := r.Context().Value(auditRecordKey{}).(*audit.Record)
+	if !ok {
+		return
+	}
+
+	record.Action = "deploy"
+	if d.State == deploymentStateCommitted {
+		record.Diff = planDiff(&ApplyPlan{Changes: d.Changes})
+	}
+}
+
+// watchDeployments prepares the staged deployments in this member until
+// the server is closed.
+func (s *Server) watchDeployments() {
+	for {
+		s.watchDeploymentsOnce()
+
+		select {
+		case <-s.events.done:
+			return
+		case <-time.After(deploymentRewatchInterval):
+		}
+	}
+}
+
+func (s *Server) watchDeploymentsOnce() {
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		logger.Errorf("get cluster watcher failed: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	ch, err := watcher.Watch(s.cluster.Layout().DeploymentStagedKey())
+	if err != nil {
+		logger.Errorf("watch deployments failed: %v", err)
+		return
+	}
+
+	// NOTE: The deployment could be staged before watching.
+	value, err := s.cluster.Get(s.cluster.Layout().DeploymentStagedKey())
+	if err != nil {
+		logger.Errorf("get staged deployment failed: %v", err)
+	} else if value != nil {
+		s.reportDeployment(*value)
+	}
+
+	for {
+		select {
+		case <-s.events.done:
+			return
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			if value != nil {
+				s.reportDeployment(*value)
+			}
+		}
+	}
+}
+
+// reportDeployment prepares the staged deployment and reports the result,
+// unless it has expired.
+func (s *Server) reportDeployment(value string) {
+	staged := &stagedDeployment{}
+	err := yaml.Unmarshal([]byte(value), staged)
+	if err != nil {
+		logger.Errorf("unmarshal staged deployment %s failed: %v", value, err)
+		return
+	}
+	if deadline, _ := time.Parse(time.RFC3339, staged.Deadline); time.Now().After(deadline) {
+		return
+	}
+
+	result := prepareDeployment(staged)
+	result.Name = s.opt.Name
+	if !result.Prepared {
+		logger.Errorf("prepare deployment %s failed: %s", staged.ID, result.Error)
+	}
+
+	buff, err := yaml.Marshal(result)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to yaml failed: %v", result, err)
+		return
+	}
+	err = s.cluster.Put(s.cluster.Layout().StatusDeploymentKey(staged.ID), string(buff))
+	if err != nil {
+		logger.Errorf("report deployment %s failed: %v", staged.ID, err)
+	}
+}
+
+// prepareDeployment prepares the specs of the deployment in this member,
+// they're created as the supervisor does, so the kinds of objects and
+// filters, including the ones of plugins, and the referenced secrets must
+// be available in this member.
+func prepareDeployment(staged *stagedDeployment) *DeploymentMember {
+	for _, config := range staged.Specs {
+		_, err := supervisor.NewSpec(config)
+		if err != nil {
+			return &DeploymentMember{Error: err.Error()}
+		}
+	}
+	return &DeploymentMember{Prepared: true}
+}
+
+func (s *Server) listDeployments(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	writeYAML(w, s._listDeployments())
+}
+
+func (s *Server) getDeployment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	// No need to lock.
+
+	d := s._getDeployment(id)
+	if d == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	writeYAML(w, d)
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrepareDeployment(t *testing.T) {
+	valid := `
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`
+	result := prepareDeployment(&stagedDeployment{ID: "1", Specs: []string{valid}})
+	if !result.Prepared || result.Error != "" {
+		t.Errorf("want prepared, got %+v", result)
+	}
+
+	invalid := strings.Replace(valid, "kind: Mock", "kind: Unknown", 1)
+	result = prepareDeployment(&stagedDeployment{ID: "2", Specs: []string{valid, invalid}})
+	if result.Prepared || result.Error == "" {
+		t.Errorf("want not prepared, got %+v", result)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+type (
+	// DryRunRequest is the request of dry-run of a pipeline.
+	DryRunRequest struct {
+		// Spec is the candidate spec, the current one is used if empty.
+		Spec    map[string]interface{}              `yaml:"spec,omitempty"`
+		Request *httppipeline.DryRunRequest         `yaml:"request"`
+		Mocks   map[string]*httppipeline.DryRunMock `yaml:"mocks,omitempty"`
+	}
+)
+
+func (s *Server) setupDryRunAPIs() {
+	dryRunAPIs := []*APIEntry{
+		{
+			Path:    ObjectPrefix + "/{name}/dryrun",
+			Method:  "POST",
+			Handler: s.dryRunPipeline,
+		},
+	}
+
+	s.RegisterAPIs(dryRunAPIs)
+}
+
+// dryRunPipeline runs a synthetic request through a sandbox built from
+// the candidate spec, nothing is applied.
+func (s *Server) dryRunPipeline(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !authorizeObject(w, r, name) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	req := &DryRunRequest{}
+	err = yaml.Unmarshal(body, req)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal body failed: %v", err))
+		return
+	}
+	if req.Request == nil || req.Request.URL == "" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("request url is required"))
+		return
+	}
+
+	var spec *supervisor.Spec
+	if len(req.Spec) == 0 {
+		spec = s._getObject(name)
+		if spec == nil {
+			HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+			return
+		}
+	} else {
+		buff, err := yaml.Marshal(req.Spec)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("marshal spec failed: %v", err))
+			return
+		}
+		spec, err = supervisor.NewSpec(string(buff))
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if spec.Name() != name {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("inconsistent name in url and spec "))
+			return
+		}
+	}
+
+	result, err := httppipeline.DryRun(spec, supervisor.Global, req.Request, req.Mocks)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	buff, err := yaml.Marshal(result)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", result, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
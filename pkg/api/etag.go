@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// etagOf returns the strong ETag of the stored value of a resource, it's
+// the same in all members.
+func etagOf(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether the value of header If-Match matches the
+// ETag, which is empty if the resource doesn't exist.
+func etagMatches(ifMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// _getETag returns the ETag of the value of the key in the cluster, it's
+// empty if the key doesn't exist.
+func (s *Server) _getETag(key string) string {
+	value, err := s.cluster.Get(key)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if value == nil {
+		return ""
+	}
+	return etagOf(*value)
+}
+
+// setETag sets the header ETag by the value of the key. It's called
+// before reading the resource, so the ETag is never newer than it.
+func (s *Server) setETag(w http.ResponseWriter, key string) {
+	if etag := s._getETag(key); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
+
+// _checkIfMatch checks the header If-Match of the request changing the
+// resource stored in the key, it writes the error and returns false if
+// the resource is changed since the client read it, or the header is
+// missing but required.
+func (s *Server) _checkIfMatch(w http.ResponseWriter, r *http.Request, key string) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		if !s.opt.APIRequireIfMatch {
+			return true
+		}
+		HandleAPIError(w, r, http.StatusPreconditionRequired,
+			fmt.Errorf("header If-Match is required, get the resource for its ETag, or set it to * to overwrite the resource"))
+		return false
+	}
+
+	etag := s._getETag(key)
+	if etagMatches(ifMatch, etag) {
+		return true
+	}
+
+	if etag == "" {
+		HandleAPIError(w, r, http.StatusPreconditionFailed,
+			fmt.Errorf("precondition failed: not found"))
+	} else {
+		w.Header().Set("ETag", etag)
+		HandleAPIError(w, r, http.StatusPreconditionFailed,
+			fmt.Errorf("precondition failed: changed by others, the current ETag is %s", etag))
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagMatches(t *testing.T) {
+	etag := etagOf("name: demo\nkind: HTTPPipeline\n")
+	if etag != etagOf("name: demo\nkind: HTTPPipeline\n") || etag == etagOf("name: demo\n") {
+		t.Fatalf("etag should be decided by the value")
+	}
+
+	for _, c := range []struct {
+		ifMatch string
+		etag    string
+		want    bool
+	}{
+		{etag, etag, true},
+		{`"other", ` + etag, etag, true},
+		{"*", etag, true},
+		{"*", "", false},
+		{etag, "", false},
+		{`"other"`, etag, false},
+		{"W/" + etag, etag, false},
+	} {
+		if got := etagMatches(c.ifMatch, c.etag); got != c.want {
+			t.Errorf("etagMatches(%s, %s): want %v, got %v", c.ifMatch, c.etag, c.want, got)
+		}
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	c := newMemCluster()
+	s := newTestServer(c)
+	s.opt.APIRequireIfMatch = true
+	key := c.Layout().ConfigObjectKey("demo")
+	c.Put(key, "name: demo\nkind: HTTPPipeline\n")
+	etag := etagOf("name: demo\nkind: HTTPPipeline\n")
+
+	check := func(ifMatch string) int {
+		r := httptest.NewRequest(http.MethodPut, "/objects/demo", nil)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		if s._checkIfMatch(w, r, key) {
+			return http.StatusOK
+		}
+		return w.Code
+	}
+
+	for _, c := range []struct {
+		ifMatch string
+		want    int
+	}{
+		{"", http.StatusPreconditionRequired},
+		{`"other"`, http.StatusPreconditionFailed},
+		{etag, http.StatusOK},
+		{"*", http.StatusOK},
+	} {
+		if got := check(c.ifMatch); got != c.want {
+			t.Errorf("If-Match %q: want status %d, got %d", c.ifMatch, c.want, got)
+		}
+	}
+
+	s.opt.APIRequireIfMatch = false
+	if got := check(""); got != http.StatusOK {
+		t.Errorf("want If-Match optional, got status %d", got)
+	}
+}
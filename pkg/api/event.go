@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// EventPrefix is the path of the event stream of config changes.
+	EventPrefix = "/events"
+
+	eventKeepAliveInterval = 15 * time.Second
+	eventRewatchInterval   = 5 * time.Second
+	eventSubscriberBuffer  = 64
+)
+
+type (
+	// ConfigEvent is the event of a change of an object, it's published by
+	// the member handling the change and received by all members.
+	ConfigEvent struct {
+		// Revision is the revision of the event in the cluster, it
+		// increases across events.
+		Revision int64     `json:"revision" yaml:"revision"`
+		Time     time.Time `json:"time" yaml:"time"`
+		Member   string    `json:"member" yaml:"member"`
+		Actor    string    `json:"actor,omitempty" yaml:"actor,omitempty"`
+		// Action is one of create, update and delete.
+		Action string `json:"action" yaml:"action"`
+		Kind   string `json:"kind" yaml:"kind"`
+		Name   string `json:"name" yaml:"name"`
+		// Diff is the line based diff of the redacted specs.
+		Diff string `json:"diff,omitempty" yaml:"diff,omitempty"`
+	}
+
+	// eventBroker fans out the events watched from the cluster to the
+	// subscribers of this member. A subscriber falling behind is dropped,
+	// so it could reconnect with the revision it has seen instead of
+	// blocking others.
+	eventBroker struct {
+		mutex       sync.Mutex
+		subscribers map[chan *ConfigEvent]struct{}
+		closed      bool
+		done        chan struct{}
+	}
+)
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscribers: map[chan *ConfigEvent]struct{}{},
+		done:        make(chan struct{}),
+	}
+}
+
+// subscribe returns the channel of events, it's closed once the
+// subscriber is dropped or the broker is closed.
+func (b *eventBroker) subscribe() chan *ConfigEvent {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ch := make(chan *ConfigEvent, eventSubscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan *ConfigEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.subscribers[ch]; exists {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *eventBroker) publish(event *ConfigEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			logger.Warnf("drop the subscriber of events falling behind")
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *eventBroker) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (s *Server) setupEventAPIs() {
+	go s.watchEvents()
+
+	eventAPIs := []*APIEntry{
+		{
+			Path:    EventPrefix,
+			Method:  "GET",
+			Handler: s.streamEvents,
+		},
+	}
+
+	s.RegisterAPIs(eventAPIs)
+}
+
+func changeAction(before, after string) string {
+	switch {
+	case before == "":
+		return applyActionCreate
+	case after == "":
+		return applyActionDelete
+	default:
+		return applyActionUpdate
+	}
+}
+
+// publishEvent publishes the event of a change to all members, failures
+// are logged only since the change has been made.
+func (s *Server) publishEvent(actor, action, kind, name, diff string) {
+	event := &ConfigEvent{
+		Time:   time.Now(),
+		Member: s.opt.Name,
+		Actor:  actor,
+		Action: action,
+		Kind:   kind,
+		Name:   name,
+		Diff:   diff,
+	}
+
+	buff, err := json.Marshal(event)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to json failed: %v", event, err)
+		return
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigEventKey(), string(buff))
+	if err != nil {
+		logger.Errorf("publish event of %s %s failed: %v", action, name, err)
+	}
+}
+
+// watchEvents watches the events of all members until the broker is
+// closed, the revision of an event is the revision of its put.
+func (s *Server) watchEvents() {
+	for {
+		s.watchEventsOnce()
+
+		select {
+		case <-s.events.done:
+			return
+		case <-time.After(eventRewatchInterval):
+		}
+	}
+}
+
+func (s *Server) watchEventsOnce() {
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		logger.Errorf("get cluster watcher failed: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	ch, err := watcher.WatchRaw(s.cluster.Layout().ConfigEventKey())
+	if err != nil {
+		logger.Errorf("watch events failed: %v", err)
+		return
+	}
+
+	for {
+		select {
+		case <-s.events.done:
+			return
+		case kv, ok := <-ch:
+			if !ok {
+				return
+			}
+			if kv == nil {
+				continue
+			}
+
+			event := &ConfigEvent{}
+			err := json.Unmarshal(kv.Kv.Value, event)
+			if err != nil {
+				logger.Errorf("unmarshal event %s failed: %v", kv.Kv.Value, err)
+				continue
+			}
+			event.Revision = kv.Kv.ModRevision
+			s.events.publish(event)
+		}
+	}
+}
+
+// streamEvents streams the events as server-sent events, the events
+// could be filtered by the name and kind parameters of list APIs.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		HandleAPIError(w, r, http.StatusInternalServerError,
+			fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !q.match(&listItem{name: event.Name, kinds: []string{event.Kind}}) {
+				continue
+			}
+
+			buff, err := json.Marshal(event)
+			if err != nil {
+				logger.Errorf("BUG: marshal %#v to json failed: %v", event, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n",
+				strconv.FormatInt(event.Revision, 10), event.Action, buff)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "api-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "api-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func TestEventBroker(t *testing.T) {
+	b := newEventBroker()
+
+	fast, slow := b.subscribe(), b.subscribe()
+	for i := 0; i < eventSubscriberBuffer; i++ {
+		b.publish(&ConfigEvent{Revision: int64(i)})
+		<-fast
+	}
+	b.publish(&ConfigEvent{Revision: eventSubscriberBuffer})
+
+	// The slow subscriber is dropped with the buffered events kept.
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != eventSubscriberBuffer {
+		t.Errorf("slow subscriber received %d events, want %d", n, eventSubscriberBuffer)
+	}
+	if event := <-fast; event.Revision != eventSubscriberBuffer {
+		t.Errorf("fast subscriber received revision %d", event.Revision)
+	}
+
+	b.unsubscribe(slow)
+	b.close()
+	if _, ok := <-fast; ok {
+		t.Errorf("subscriber not closed with the broker")
+	}
+	if _, ok := <-b.subscribe(); ok {
+		t.Errorf("subscribed to a closed broker")
+	}
+}
+
+func TestChangeAction(t *testing.T) {
+	cases := []struct{ before, after, action string }{
+		{"", "name: a", applyActionCreate},
+		{"name: a", "", applyActionDelete},
+		{"name: a", "name: b", applyActionUpdate},
+	}
+	for _, c := range cases {
+		if got := changeAction(c.before, c.after); got != c.action {
+			t.Errorf("change %q to %q: got %s, want %s", c.before, c.after, got, c.action)
+		}
+	}
+}
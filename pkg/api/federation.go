@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/common"
+)
+
+const (
+	// FederationPrefix is the prefix of federation APIs, the secondary
+	// regions report to the primary by them.
+	FederationPrefix = "/federation"
+)
+
+type (
+	// RegionReport is reported by the Federation of a secondary region to
+	// the primary, it carries the state of the sync and the stats of the
+	// pipelines in the region.
+	RegionReport struct {
+		Region     string `yaml:"region"`
+		Cluster    string `yaml:"cluster"`
+		Members    int    `yaml:"members"`
+		Objects    int    `yaml:"objects"`
+		SyncedAt   string `yaml:"syncedAt,omitempty"`
+		SyncError  string `yaml:"syncError,omitempty"`
+		ReportedAt string `yaml:"reportedAt"`
+
+		Pipelines map[string]*RegionStats `yaml:"pipelines,omitempty"`
+	}
+
+	// RegionStats are the stats of a pipeline summed up in regions, the
+	// mean latency is weighted by the requests, and P99 is the max one.
+	RegionStats struct {
+		Regions  int     `yaml:"regions,omitempty"`
+		Members  int     `yaml:"members"`
+		Count    uint64  `yaml:"count"`
+		M1       float64 `yaml:"m1"`
+		ErrCount uint64  `yaml:"errCount"`
+		M1Err    float64 `yaml:"m1Err"`
+		Mean     float64 `yaml:"mean"`
+		P99      float64 `yaml:"p99"`
+	}
+)
+
+// Add adds the stats of another member or region.
+func (rs *RegionStats) Add(other *RegionStats) {
+	count := rs.Count + other.Count
+	if count > 0 {
+		rs.Mean = (rs.Mean*float64(rs.Count) + other.Mean*float64(other.Count)) / float64(count)
+	}
+	rs.Members += other.Members
+	rs.Count = count
+	rs.M1 += other.M1
+	rs.ErrCount += other.ErrCount
+	rs.M1Err += other.M1Err
+	if other.P99 > rs.P99 {
+		rs.P99 = other.P99
+	}
+}
+
+func (s *Server) setupFederationAPIs() {
+	federationAPIs := []*APIEntry{
+		{
+			Path:    FederationPrefix + "/regions",
+			Method:  "GET",
+			Handler: s.listRegions,
+		},
+		{
+			Path:    FederationPrefix + "/regions/{region}",
+			Method:  "PUT",
+			Handler: s.reportRegion,
+		},
+		{
+			Path:    FederationPrefix + "/regions/{region}",
+			Method:  "DELETE",
+			Handler: s.deleteRegion,
+		},
+		{
+			Path:    FederationPrefix + "/stats",
+			Method:  "GET",
+			Handler: s.getFederationStats,
+		},
+	}
+
+	s.RegisterAPIs(federationAPIs)
+}
+
+func (s *Server) listRegions(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	writeYAML(w, s._listRegionReports())
+}
+
+func (s *Server) reportRegion(w http.ResponseWriter, r *http.Request) {
+	region := chi.URLParam(r, "region")
+	if err := common.ValidateName(region); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid region: %v", err))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	report := &RegionReport{}
+	err = yaml.UnmarshalStrict(body, report)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal report failed: %v", err))
+		return
+	}
+	if report.Region != region {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("region %s in the body doesn't match %s", report.Region, region))
+		return
+	}
+	report.ReportedAt = time.Now().Format(time.RFC3339)
+
+	s.Lock()
+	defer s.Unlock()
+
+	s._putRegionReport(report)
+}
+
+func (s *Server) deleteRegion(w http.ResponseWriter, r *http.Request) {
+	region := chi.URLParam(r, "region")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getRegionReport(region) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	s._deleteRegionReport(region)
+}
+
+// getFederationStats sums up the stats of pipelines in all secondary
+// regions.
+func (s *Server) getFederationStats(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	stats := map[string]*RegionStats{}
+	for _, report := range s._listRegionReports() {
+		for name, rs := range report.Pipelines {
+			sum, exists := stats[name]
+			if !exists {
+				sum = &RegionStats{}
+				stats[name] = sum
+			}
+			sum.Add(rs)
+			sum.Regions++
+		}
+	}
+
+	writeYAML(w, stats)
+}
+
+func (s *Server) _listRegionReports() []*RegionReport {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().StatusFederationPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	reports := make([]*RegionReport, 0, len(kvs))
+	for _, v := range kvs {
+		report := &RegionReport{}
+		err = yaml.Unmarshal([]byte(v), report)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to region report failed: %v", v, err))
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Region < reports[j].Region
+	})
+
+	return reports
+}
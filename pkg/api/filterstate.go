@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+type (
+	// FilterState is the live internal state of a filter in a member.
+	FilterState struct {
+		Member   string      `yaml:"member"`
+		Pipeline string      `yaml:"pipeline"`
+		Filter   string      `yaml:"filter"`
+		State    interface{} `yaml:"state"`
+	}
+)
+
+func (s *Server) setupFilterStateAPIs() {
+	filterStateAPIs := []*APIEntry{
+		{
+			Path:    ObjectPrefix + "/{name}/filters/{filter}/state",
+			Method:  "GET",
+			Handler: s.getFilterState,
+		},
+	}
+
+	s.RegisterAPIs(filterStateAPIs)
+}
+
+// getFilterState returns the live internal state of the filter in the
+// running pipeline. The state is local, so it's the one in this member.
+func (s *Server) getFilterState(w http.ResponseWriter, r *http.Request) {
+	name, filter := chi.URLParam(r, "name"), chi.URLParam(r, "filter")
+	if !authorizeObject(w, r, name) {
+		return
+	}
+
+	ro, exists := supervisor.Global.GetRunningObject(name, supervisor.CategoryPipeline)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	pipeline, ok := ro.Instance().(*httppipeline.HTTPPipeline)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not a %s", name, httppipeline.Kind))
+		return
+	}
+
+	state, err := pipeline.FilterState(filter)
+	switch err {
+	case nil:
+	case httppipeline.ErrFilterNotFound:
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("filter %s not found in %s", filter, name))
+		return
+	default:
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("filter %s: %v", filter, err))
+		return
+	}
+
+	writeYAML(w, &FilterState{
+		Member:   s.opt.Name,
+		Pipeline: name,
+		Filter:   filter,
+		State:    state,
+	})
+}
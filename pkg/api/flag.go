@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/featureflag"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+func (s *Server) setupFlagAPIs() {
+	flagAPIs := []*APIEntry{
+		{
+			Path:    ObjectPrefix + "/{name}/flags",
+			Method:  "GET",
+			Handler: s.getFlags,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/flags",
+			Method:  "PUT",
+			Handler: s.updateFlags,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/flags/{flag}",
+			Method:  "PUT",
+			Handler: s.updateFlag,
+		},
+	}
+
+	s.RegisterAPIs(flagAPIs)
+}
+
+func (s *Server) getFlags(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// No need to lock.
+
+	s.setETag(w, s.cluster.Layout().ConfigFlagsKey(name))
+	flags := s._getFlags(name)
+	if flags == nil {
+		flags = &featureflag.Flags{Pipeline: name, Flags: map[string]bool{}}
+	}
+
+	writeYAML(w, flags)
+}
+
+// updateFlags replaces all flags of the pipeline by the ones in the body,
+// which is a map from the names of the flags to whether they're enabled.
+func (s *Server) updateFlags(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !authorizeObject(w, r, name) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	flags := map[string]bool{}
+	err = yaml.UnmarshalStrict(body, &flags)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal flags failed: %v", err))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := s.cluster.Layout().ConfigFlagsKey(name)
+	if !s._checkIfMatch(w, r, key) || !s._checkFlagsPipeline(w, r, name) {
+		return
+	}
+
+	err = s._putFlags(&featureflag.Flags{Pipeline: name, Flags: flags})
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	s.upgradeConfigVersion(w, r)
+	s.setETag(w, key)
+}
+
+// updateFlag enables or disables a flag of the pipeline by the body, which
+// is true or false, the other flags are kept.
+func (s *Server) updateFlag(w http.ResponseWriter, r *http.Request) {
+	name, flag := chi.URLParam(r, "name"), chi.URLParam(r, "flag")
+	if !authorizeObject(w, r, name) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	enabled, err := strconv.ParseBool(string(body))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid flag value %q: want true or false", body))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := s.cluster.Layout().ConfigFlagsKey(name)
+	if !s._checkIfMatch(w, r, key) || !s._checkFlagsPipeline(w, r, name) {
+		return
+	}
+
+	flags := s._getFlags(name)
+	if flags == nil {
+		flags = &featureflag.Flags{Pipeline: name, Flags: map[string]bool{}}
+	}
+	flags.Flags[flag] = enabled
+
+	err = s._putFlags(flags)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	s.upgradeConfigVersion(w, r)
+	s.setETag(w, key)
+}
+
+// _checkFlagsPipeline checks the pipeline of flags exists, flags of other
+// objects are not allowed, since only filters query them.
+func (s *Server) _checkFlagsPipeline(w http.ResponseWriter, r *http.Request, name string) bool {
+	spec := s._getObject(name)
+	if spec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return false
+	}
+	if spec.Kind() != httppipeline.Kind {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not a %s", name, httppipeline.Kind))
+		return false
+	}
+	return true
+}
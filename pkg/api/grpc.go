@@ -0,0 +1,529 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/api/pb"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	defaultStatusWatchInterval = 5 * time.Second
+	minStatusWatchInterval     = time.Second
+)
+
+type (
+	// grpcServer serves the admin API over gRPC. Every call is dispatched
+	// to the handler of the REST API in process, so both of them share
+	// the middlewares of auth, audit and logging.
+	grpcServer struct {
+		s *Server
+	}
+
+	// grpcResponse is the response of the REST API to a call.
+	grpcResponse struct {
+		code   int
+		header http.Header
+		body   bytes.Buffer
+	}
+
+	// eventStreamWriter converts the server-sent events written by the
+	// REST API to the messages of the stream.
+	eventStreamWriter struct {
+		header  http.Header
+		code    int
+		buff    bytes.Buffer
+		send    func(*ConfigEvent) error
+		onError func()
+		err     error
+	}
+)
+
+var _ pb.AdminServer = (*grpcServer)(nil)
+
+func (s *Server) startGRPCServer() {
+	if s.opt.GRPCAPIAddr == "" {
+		return
+	}
+
+	listener, err := net.Listen("tcp", s.opt.GRPCAPIAddr)
+	if err != nil {
+		logger.Errorf("listen grpc api on %s failed: %v", s.opt.GRPCAPIAddr, err)
+		return
+	}
+
+	var opts []grpc.ServerOption
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	s.grpcSrv = grpc.NewServer(opts...)
+	pb.RegisterAdminServer(s.grpcSrv, &grpcServer{s: s})
+
+	go func() {
+		logger.Infof("grpc api server running in %s", s.opt.GRPCAPIAddr)
+		s.grpcSrv.Serve(listener)
+	}()
+}
+
+func (r *grpcResponse) Header() http.Header { return r.header }
+
+func (r *grpcResponse) Write(p []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *grpcResponse) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+// newRequest creates the request of the REST API for a call, with the
+// credentials and the address of the client.
+func newRequest(ctx context.Context, method, path string, query url.Values, body []byte) *http.Request {
+	u := APIPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	r, _ := http.NewRequest(method, u, bytes.NewReader(body))
+	r = r.WithContext(ctx)
+	r.Header.Set("Accept", "text/vnd.yaml")
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if auth := md.Get("authorization"); len(auth) > 0 {
+			r.Header.Set("Authorization", auth[0])
+		}
+		if ifMatch := md.Get("if-match"); len(ifMatch) > 0 {
+			r.Header.Set("If-Match", ifMatch[0])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		// NOTE: Users could be authenticated by client certificates.
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+
+	return r
+}
+
+// call calls the REST API, and converts the errors to gRPC ones.
+func (g *grpcServer) call(ctx context.Context, method, path string, query url.Values, body []byte) (*grpcResponse, error) {
+	resp := &grpcResponse{header: http.Header{}}
+	g.s.router.ServeHTTP(resp, newRequest(ctx, method, path, query, body))
+
+	if version := resp.header.Get(ConfigVersionKey); version != "" {
+		grpc.SetHeader(ctx, metadata.Pairs(ConfigVersionKey, version))
+	}
+	if etag := resp.header.Get("ETag"); etag != "" {
+		grpc.SetHeader(ctx, metadata.Pairs("ETag", etag))
+	}
+	if resp.code == 0 || successfulStatusCode(resp.code) {
+		return resp, nil
+	}
+
+	return nil, grpcError(resp.code, resp.body.Bytes())
+}
+
+func successfulStatusCode(code int) bool {
+	return code >= 200 && code < 300
+}
+
+func grpcError(code int, body []byte) error {
+	msg := string(body)
+	apiErr := &APIErr{}
+	if err := yaml.Unmarshal(body, apiErr); err == nil && apiErr.Message != "" {
+		msg = apiErr.Message
+	}
+
+	c := codes.Unknown
+	switch code {
+	case http.StatusBadRequest:
+		c = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		c = codes.Unauthenticated
+	case http.StatusForbidden:
+		c = codes.PermissionDenied
+	case http.StatusNotFound:
+		c = codes.NotFound
+	case http.StatusConflict:
+		c = codes.AlreadyExists
+	case http.StatusPreconditionFailed, http.StatusPreconditionRequired:
+		c = codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		c = codes.ResourceExhausted
+	case http.StatusInternalServerError:
+		c = codes.Internal
+	case http.StatusServiceUnavailable:
+		c = codes.Unavailable
+	}
+
+	return status.Error(c, msg)
+}
+
+func (g *grpcServer) Health(ctx context.Context, req *pb.HealthRequest) (*pb.HealthResponse, error) {
+	_, err := g.call(ctx, http.MethodGet, "/healthz", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.HealthResponse{}, nil
+}
+
+func (g *grpcServer) ListMembers(ctx context.Context, req *pb.ListMembersRequest) (*pb.ListMembersResponse, error) {
+	resp, err := g.call(ctx, http.MethodGet, "/status/members", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []*cluster.MemberStatus{}
+	err = yaml.Unmarshal(resp.body.Bytes(), &members)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal members failed: %v", err)
+	}
+
+	result := &pb.ListMembersResponse{}
+	for _, m := range members {
+		member := &pb.Member{
+			Name:              m.Options.Name,
+			ClusterRole:       m.Options.ClusterRole,
+			ApiAddr:           m.Options.APIAddr,
+			LastHeartbeatTime: m.LastHeartbeatTime,
+		}
+		if m.Etcd != nil {
+			member.EtcdState = m.Etcd.State
+		}
+		result.Members = append(result.Members, member)
+	}
+
+	return result, nil
+}
+
+func (g *grpcServer) ListObjectKinds(ctx context.Context, req *pb.ListObjectKindsRequest) (*pb.ListObjectKindsResponse, error) {
+	resp, err := g.call(ctx, http.MethodGet, ObjectKindsPrefix, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pb.ListObjectKindsResponse{}
+	err = yaml.Unmarshal(resp.body.Bytes(), &result.Kinds)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal kinds failed: %v", err)
+	}
+
+	return result, nil
+}
+
+func (g *grpcServer) ListObjects(ctx context.Context, req *pb.ListObjectsRequest) (*pb.ListObjectsResponse, error) {
+	query := url.Values{}
+	for k, v := range map[string]string{"name": req.Name, "kind": req.Kind, "continue": req.Continue} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if req.Limit != 0 {
+		query.Set("limit", strconv.Itoa(int(req.Limit)))
+	}
+
+	resp, err := g.call(ctx, http.MethodGet, ObjectPrefix, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []map[string]interface{}{}
+	err = yaml.Unmarshal(resp.body.Bytes(), &docs)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal objects failed: %v", err)
+	}
+
+	total, _ := strconv.Atoi(resp.header.Get(TotalCountHeader))
+	result := &pb.ListObjectsResponse{
+		Continue:   resp.header.Get(ContinueHeader),
+		TotalCount: int32(total),
+	}
+	for _, doc := range docs {
+		buff, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "marshal %#v to yaml failed: %v", doc, err)
+		}
+		object, err := newObject(buff)
+		if err != nil {
+			return nil, err
+		}
+		result.Objects = append(result.Objects, object)
+	}
+
+	return result, nil
+}
+
+func (g *grpcServer) GetObject(ctx context.Context, req *pb.GetObjectRequest) (*pb.Object, error) {
+	resp, err := g.call(ctx, http.MethodGet, ObjectPrefix+"/"+url.PathEscape(req.Name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newObject(resp.body.Bytes())
+}
+
+func (g *grpcServer) CreateObject(ctx context.Context, req *pb.CreateObjectRequest) (*pb.Object, error) {
+	name, err := specName(req.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = g.call(ctx, http.MethodPost, ObjectPrefix, nil, []byte(req.Spec))
+	if err != nil {
+		return nil, err
+	}
+	return g.GetObject(ctx, &pb.GetObjectRequest{Name: name})
+}
+
+func (g *grpcServer) UpdateObject(ctx context.Context, req *pb.UpdateObjectRequest) (*pb.Object, error) {
+	name, err := specName(req.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = g.call(ctx, http.MethodPut, ObjectPrefix+"/"+url.PathEscape(name), nil, []byte(req.Spec))
+	if err != nil {
+		return nil, err
+	}
+	return g.GetObject(ctx, &pb.GetObjectRequest{Name: name})
+}
+
+func (g *grpcServer) DeleteObject(ctx context.Context, req *pb.DeleteObjectRequest) (*pb.DeleteObjectResponse, error) {
+	_, err := g.call(ctx, http.MethodDelete, ObjectPrefix+"/"+url.PathEscape(req.Name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteObjectResponse{}, nil
+}
+
+func (g *grpcServer) ApplyObjects(ctx context.Context, req *pb.ApplyObjectsRequest) (*pb.ApplyObjectsResponse, error) {
+	query := url.Values{}
+	if req.DryRun {
+		query.Set("dryRun", "true")
+	}
+
+	resp, err := g.call(ctx, http.MethodPut, ObjectPrefix, query, []byte(req.Specs))
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ApplyPlan{}
+	err = yaml.Unmarshal(resp.body.Bytes(), plan)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal plan failed: %v", err)
+	}
+
+	result := &pb.ApplyObjectsResponse{Applied: plan.Applied, Unchanged: plan.Unchanged}
+	for _, change := range plan.Changes {
+		result.Changes = append(result.Changes, &pb.ApplyChange{
+			Action: change.Action,
+			Kind:   change.Kind,
+			Name:   change.Name,
+			Diff:   change.Diff,
+		})
+	}
+
+	return result, nil
+}
+
+func (g *grpcServer) GetObjectStatus(ctx context.Context, req *pb.GetObjectStatusRequest) (*pb.ObjectStatus, error) {
+	resp, err := g.call(ctx, http.MethodGet, StatusObjectPrefix+"/"+url.PathEscape(req.Name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[string]interface{}{}
+	err = yaml.Unmarshal(resp.body.Bytes(), &members)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal status failed: %v", err)
+	}
+
+	result := &pb.ObjectStatus{Name: req.Name, Members: map[string]string{}}
+	for member, memberStatus := range members {
+		buff, err := yaml.Marshal(memberStatus)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "marshal %#v to yaml failed: %v", memberStatus, err)
+		}
+		result.Members[member] = string(buff)
+	}
+
+	return result, nil
+}
+
+func (g *grpcServer) WatchObjectStatus(req *pb.WatchObjectStatusRequest, stream pb.Admin_WatchObjectStatusServer) error {
+	interval := defaultStatusWatchInterval
+	if req.IntervalSeconds != 0 {
+		interval = time.Duration(req.IntervalSeconds) * time.Second
+	}
+	if interval < minStatusWatchInterval {
+		interval = minStatusWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := g.GetObjectStatus(stream.Context(), &pb.GetObjectStatusRequest{Name: req.Name})
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(status); err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-g.s.events.done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *grpcServer) WatchEvents(req *pb.WatchEventsRequest, stream pb.Admin_WatchEventsServer) error {
+	query := url.Values{}
+	if req.Name != "" {
+		query.Set("name", req.Name)
+	}
+	if req.Kind != "" {
+		query.Set("kind", req.Kind)
+	}
+
+	w := &eventStreamWriter{
+		header: http.Header{},
+		send: func(event *ConfigEvent) error {
+			return stream.Send(&pb.ConfigEvent{
+				Revision: event.Revision,
+				Time:     event.Time.Format(time.RFC3339Nano),
+				Member:   event.Member,
+				Actor:    event.Actor,
+				Action:   event.Action,
+				Kind:     event.Kind,
+				Name:     event.Name,
+				Diff:     event.Diff,
+			})
+		},
+	}
+
+	// Cancel the REST API once sending fails.
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	w.onError = cancel
+
+	g.s.router.ServeHTTP(w, newRequest(ctx, http.MethodGet, EventPrefix, query, nil))
+
+	if w.code != 0 && !successfulStatusCode(w.code) {
+		return grpcError(w.code, w.buff.Bytes())
+	}
+	return w.err
+}
+
+func (w *eventStreamWriter) Header() http.Header { return w.header }
+
+func (w *eventStreamWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// Write buffers the events, and sends every complete one.
+func (w *eventStreamWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.buff.Write(p)
+	if !successfulStatusCode(w.code) {
+		return len(p), nil
+	}
+
+	for w.err == nil {
+		frame := w.buff.Bytes()
+		end := bytes.Index(frame, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		w.buff.Next(end + 2)
+
+		for _, line := range strings.Split(string(frame[:end]), "\n") {
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			event := &ConfigEvent{}
+			err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event)
+			if err == nil {
+				err = w.send(event)
+			}
+			if err != nil {
+				w.err = err
+				w.onError()
+			}
+		}
+	}
+
+	return len(p), w.err
+}
+
+// Flush implements http.Flusher, events are sent once written.
+func (w *eventStreamWriter) Flush() {}
+
+func specName(spec string) (string, error) {
+	meta := &supervisor.MetaSpec{}
+	err := yaml.Unmarshal([]byte(spec), meta)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "invalid spec: %v", err)
+	}
+	if meta.Name == "" {
+		return "", status.Error(codes.InvalidArgument, "name is required")
+	}
+	return supervisor.QualifiedName(meta.Namespace, meta.Name), nil
+}
+
+func newObject(spec []byte) (*pb.Object, error) {
+	meta := &supervisor.MetaSpec{}
+	err := yaml.Unmarshal(spec, meta)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unmarshal spec failed: %v", err)
+	}
+	name := supervisor.QualifiedName(meta.Namespace, meta.Name)
+	return &pb.Object{Name: name, Kind: meta.Kind, Spec: string(spec)}, nil
+}
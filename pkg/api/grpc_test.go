@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCError(t *testing.T) {
+	err := grpcError(http.StatusNotFound, []byte("code: 404\nmessage: not found\n"))
+	if s := status.Convert(err); s.Code() != codes.NotFound || s.Message() != "not found" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	err = grpcError(http.StatusBadGateway, []byte("bad gateway"))
+	if s := status.Convert(err); s.Code() != codes.Unknown || s.Message() != "bad gateway" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestEventStreamWriter(t *testing.T) {
+	var names []string
+	canceled := false
+	w := &eventStreamWriter{
+		header: http.Header{},
+		send: func(event *ConfigEvent) error {
+			if event.Name == "fail" {
+				return fmt.Errorf("send failed")
+			}
+			names = append(names, event.Name)
+			return nil
+		},
+		onError: func() { canceled = true },
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(": ping\n\n"))
+	w.Write([]byte("id: 1\nevent: create\ndata: {\"name\":\"a\"}\n\nid: 2\nevent: update\n"))
+	if len(names) != 1 || names[0] != "a" {
+		t.Fatalf("unexpected events %v", names)
+	}
+	w.Write([]byte("data: {\"name\":\"b\"}\n\n"))
+	if len(names) != 2 || names[1] != "b" {
+		t.Fatalf("unexpected events %v", names)
+	}
+
+	_, err := w.Write([]byte("data: {\"name\":\"fail\"}\n\n"))
+	if err == nil || !canceled {
+		t.Errorf("failure of sending not reported")
+	}
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/audit"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// HistoryPrefix is the prefix of the APIs of config history.
+	HistoryPrefix = "/history"
+)
+
+type (
+	// ConfigRevision is a revision of the whole config, it's recorded
+	// after every change of objects, and the revision is the config
+	// version after the change.
+	ConfigRevision struct {
+		Revision int64  `yaml:"revision"`
+		Time     string `yaml:"time"`
+		Actor    string `yaml:"actor"`
+		// Rollback is the revision restored by this one, it's 0 if
+		// it's not a rollback.
+		Rollback int64          `yaml:"rollback,omitempty"`
+		Changes  []*ApplyChange `yaml:"changes"`
+		// Objects are the specs of all objects after the change, the
+		// sensitive fields are kept encrypted as they're stored.
+		Objects []string `yaml:"objects,omitempty"`
+	}
+)
+
+func (s *Server) setupHistoryAPIs() {
+	historyAPIs := []*APIEntry{
+		{
+			Path:    HistoryPrefix,
+			Method:  "GET",
+			Handler: s.listRevisions,
+		},
+		{
+			Path:    HistoryPrefix + "/{revision}",
+			Method:  "GET",
+			Handler: s.getRevision,
+		},
+		{
+			Path:    HistoryPrefix + "/{revision}/diff",
+			Method:  "GET",
+			Handler: s.diffRevision,
+		},
+		{
+			Path:    HistoryPrefix + "/{revision}/rollback",
+			Method:  "POST",
+			Handler: s.rollbackRevision,
+		},
+	}
+
+	s.RegisterAPIs(historyAPIs)
+}
+
+// _recordRevision records the revision of the config after the changes,
+// the oldest ones beyond the limit of history are removed.
+func (s *Server) _recordRevision(actor string, rollback int64, changes []*ApplyChange) {
+	if s.opt.ConfigHistory == 0 || len(changes) == 0 {
+		return
+	}
+
+	revision := &ConfigRevision{
+		Revision: s._getVersion(),
+		Time:     time.Now().Format(time.RFC3339),
+		Actor:    actor,
+		Rollback: rollback,
+	}
+	for _, change := range changes {
+		revision.Changes = append(revision.Changes, &ApplyChange{
+			Action: change.Action, Kind: change.Kind, Name: change.Name,
+		})
+	}
+	specs := specList(s._listObjects())
+	sort.Sort(specs)
+	for _, spec := range specs {
+		revision.Objects = append(revision.Objects, spec.YAMLConfig())
+	}
+	s._putRevision(revision)
+
+	revisions := s._listRevisions()
+	for len(revisions) > s.opt.ConfigHistory {
+		s._deleteRevision(revisions[0].Revision)
+		revisions = revisions[1:]
+	}
+}
+
+// revisionSpecs returns the specs of all objects in the revision.
+func revisionSpecs(revision *ConfigRevision) ([]*supervisor.Spec, error) {
+	specs := make([]*supervisor.Spec, 0, len(revision.Objects))
+	for _, config := range revision.Objects {
+		spec, err := supervisor.NewSpec(config)
+		if err != nil {
+			return nil, fmt.Errorf("spec in revision %d is invalid: %v", revision.Revision, err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// revisionOf returns the revision in the path, it handles the error and
+// returns nil if it's invalid or not found.
+func (s *Server) revisionOf(w http.ResponseWriter, r *http.Request) *ConfigRevision {
+	revision, err := strconv.ParseInt(chi.URLParam(r, "revision"), 10, 64)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid revision: %v", err))
+		return nil
+	}
+
+	result := s._getRevision(revision)
+	if result == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("revision %d not found", revision))
+	}
+	return result
+}
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	revisions := s._listRevisions()
+	for _, revision := range revisions {
+		revision.Objects = nil
+	}
+
+	writeYAML(w, revisions)
+}
+
+func (s *Server) getRevision(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	revision := s.revisionOf(w, r)
+	if revision == nil {
+		return
+	}
+	for i, config := range revision.Objects {
+		revision.Objects[i] = secret.RedactYAML(config)
+	}
+
+	writeYAML(w, revision)
+}
+
+// diffRevision reports the changes from the revision in the path to the
+// one in the query to, or to the running config if it's empty.
+func (s *Server) diffRevision(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	revision := s.revisionOf(w, r)
+	if revision == nil {
+		return
+	}
+	from, err := revisionSpecs(revision)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var to []*supervisor.Spec
+	if v := r.URL.Query().Get("to"); v != "" {
+		target, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid revision: %v", err))
+			return
+		}
+		toRevision := s._getRevision(target)
+		if toRevision == nil {
+			HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("revision %d not found", target))
+			return
+		}
+		to, err = revisionSpecs(toRevision)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	} else {
+		to = s._listObjects()
+	}
+
+	plan, err := planChanges(from, to, nil)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeYAML(w, plan.Changes)
+}
+
+// rollbackRevision makes the objects the same as the ones in the revision
+// like applying them, nothing is changed if the query dryRun is true. All
+// changes are made in one transaction, and recorded as a new revision.
+func (s *Server) rollbackRevision(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	s.Lock()
+	defer s.Unlock()
+
+	revision := s.revisionOf(w, r)
+	if revision == nil {
+		return
+	}
+	specs, err := revisionSpecs(revision)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	plan, err := s._planApply(specs, nil)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(plan.Changes) > maxTxnChanges {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("too many changes: %d, at most %d", len(plan.Changes), maxTxnChanges))
+		return
+	}
+	for _, change := range plan.Changes {
+		if !authorizeObject(w, r, change.Name) {
+			return
+		}
+	}
+	sortChanges(plan.Changes)
+
+	if !dryRun && len(plan.Changes) != 0 {
+		for _, change := range plan.Changes {
+			if change.Action == applyActionDelete {
+				continue
+			}
+			change.spec, err = encryptSpec(change.spec)
+			if err != nil {
+				HandleAPIError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		_, err = s._commitChanges(w, principalOf(r), revision.Revision, plan.Changes)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		plan.Applied = true
+		auditRollback(r, plan)
+	}
+
+	writeYAML(w, plan)
+}
+
+func auditRollback(r *http.Request, plan *ApplyPlan) {
+	record, ok := r.Context().Value(auditRecordKey{}).(*audit.Record)
+	if !ok {
+		return
+	}
+
+	record.Action = "rollback"
+	record.Diff = planDiff(plan)
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+type (
+	// memCluster is a cluster keeping the kvs in memory, the writes of
+	// failKey fail.
+	memCluster struct {
+		cluster.Cluster
+
+		mutex   sync.Mutex
+		kvs     map[string]string
+		failKey string
+	}
+
+	memMutex struct{}
+)
+
+func (m memMutex) Lock() error   { return nil }
+func (m memMutex) Unlock() error { return nil }
+
+func newMemCluster() *memCluster {
+	return &memCluster{kvs: map[string]string{}}
+}
+
+func (c *memCluster) Layout() *cluster.Layout { return &cluster.Layout{} }
+
+func (c *memCluster) Mutex(name string) (cluster.Mutex, error) { return memMutex{}, nil }
+
+func (c *memCluster) Get(key string) (*string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, exists := c.kvs[key]
+	if !exists {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+func (c *memCluster) GetPrefix(prefix string) (map[string]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	kvs := map[string]string{}
+	for key, value := range c.kvs {
+		if strings.HasPrefix(key, prefix) {
+			kvs[key] = value
+		}
+	}
+	return kvs, nil
+}
+
+func (c *memCluster) Put(key, value string) error {
+	return c.PutAndDelete(map[string]*string{key: &value})
+}
+
+func (c *memCluster) Delete(key string) error {
+	return c.PutAndDelete(map[string]*string{key: nil})
+}
+
+func (c *memCluster) DeletePrefix(prefix string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key := range c.kvs {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.kvs, key)
+		}
+	}
+	return nil
+}
+
+func (c *memCluster) PutAndDelete(kvs map[string]*string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := kvs[c.failKey]; exists {
+		return fmt.Errorf("put %s failed", c.failKey)
+	}
+	for key, value := range kvs {
+		if value == nil {
+			delete(c.kvs, key)
+		} else {
+			c.kvs[key] = *value
+		}
+	}
+	return nil
+}
+
+func newTestServer(c *memCluster) *Server {
+	return &Server{
+		opt:     option.Options{ConfigHistory: 10},
+		cluster: c,
+		events:  newEventBroker(),
+	}
+}
+
+// putSpecs stores the specs as the objects in the cluster.
+func putSpecs(t *testing.T, c *memCluster, yamlConfig string) {
+	specs, err := readSpecs([]byte(yamlConfig))
+	if err != nil {
+		t.Fatalf("read specs failed: %v", err)
+	}
+	for _, spec := range specs {
+		c.Put(c.Layout().ConfigObjectKey(spec.Name()), spec.YAMLConfig())
+	}
+}
+
+func TestRevisionPlan(t *testing.T) {
+	current, err := readSpecs([]byte(`
+- name: pipeline
+  kind: HTTPPipeline
+  filters:
+  - name: mock
+    kind: Mock
+    rules:
+    - code: 200
+- name: another
+  kind: HTTPPipeline
+  filters:
+  - name: mock
+    kind: Mock
+    rules:
+    - code: 404
+`))
+	if err != nil {
+		t.Fatalf("read specs failed: %v", err)
+	}
+
+	revision := &ConfigRevision{Revision: 3}
+	for _, config := range []string{
+		strings.Replace(current[0].YAMLConfig(), "code: 200", "code: 500", 1),
+		strings.Replace(current[0].YAMLConfig(), "name: pipeline", "name: created", 1),
+	} {
+		revision.Objects = append(revision.Objects, config)
+	}
+	specs, err := revisionSpecs(revision)
+	if err != nil {
+		t.Fatalf("revision specs failed: %v", err)
+	}
+
+	plan, err := planChanges(current, specs, nil)
+	if err != nil {
+		t.Fatalf("plan changes failed: %v", err)
+	}
+	var got []string
+	for _, change := range plan.Changes {
+		got = append(got, change.Action+" "+change.Name)
+	}
+	want := "create created,update pipeline,delete another"
+	if strings.Join(got, ",") != want {
+		t.Errorf("want changes %s, got %v", want, got)
+	}
+
+	_, err = revisionSpecs(&ConfigRevision{Objects: []string{"kind: HTTPPipeline"}})
+	if err == nil {
+		t.Errorf("want error for invalid spec")
+	}
+}
+
+func TestRollbackAtomic(t *testing.T) {
+	c := newMemCluster()
+	s := newTestServer(c)
+	putSpecs(t, c, `
+- name: pipeline-a
+  kind: HTTPPipeline
+  filters:
+  - name: mock
+    kind: Mock
+    rules:
+    - code: 200
+- name: pipeline-b
+  kind: HTTPPipeline
+  filters:
+  - name: mock
+    kind: Mock
+    rules:
+    - code: 200
+`)
+	revision := &ConfigRevision{Revision: 3}
+	for _, spec := range s._listObjects() {
+		revision.Objects = append(revision.Objects,
+			strings.Replace(spec.YAMLConfig(), "code: 200", "code: 500", 1))
+	}
+	s._putRevision(revision)
+	c.Put(c.Layout().ConfigVersion(), "3")
+
+	rollback := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/history/3/rollback", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("revision", "3")
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		s.rollbackRevision(w, r)
+		return w.Code
+	}
+
+	// The change of pipeline-b fails after the one of pipeline-a.
+	c.failKey = c.Layout().ConfigObjectKey("pipeline-b")
+	if code := rollback(); code != http.StatusInternalServerError {
+		t.Fatalf("want status 500, got %d", code)
+	}
+	for _, spec := range s._listObjects() {
+		if strings.Contains(spec.YAMLConfig(), "code: 500") {
+			t.Errorf("want %s unchanged, got it rolled back", spec.Name())
+		}
+	}
+	if v := s._getVersion(); v != 3 {
+		t.Errorf("want version 3, got %d", v)
+	}
+	if revisions := s._listRevisions(); len(revisions) != 1 {
+		t.Errorf("want no revision recorded, got %d revisions", len(revisions))
+	}
+
+	c.failKey = ""
+	if code := rollback(); code != http.StatusOK {
+		t.Fatalf("want status 200, got %d", code)
+	}
+	for _, spec := range s._listObjects() {
+		if !strings.Contains(spec.YAMLConfig(), "code: 500") {
+			t.Errorf("want %s rolled back, got it unchanged", spec.Name())
+		}
+	}
+	revisions := s._listRevisions()
+	last := revisions[len(revisions)-1]
+	if s._getVersion() != 4 || last.Revision != 4 || last.Rollback != 3 {
+		t.Errorf("want revision 4 rolling back 3, got %d rolling back %d", last.Revision, last.Rollback)
+	}
+}
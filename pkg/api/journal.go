@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func (s *Server) setupJournalAPIs() {
+	journalAPIs := []*APIEntry{
+		{
+			Path:    ObjectPrefix + "/{name}/replay",
+			Method:  "POST",
+			Handler: s.replayJournal,
+		},
+	}
+
+	s.RegisterAPIs(journalAPIs)
+}
+
+// replayJournal replays the requests journaled in the time range through
+// the running pipeline. The journal is local, so only the requests
+// journaled by this member are replayed.
+func (s *Server) replayJournal(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !authorizeObject(w, r, name) {
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid from: %v", err))
+		return
+	}
+	to := time.Now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid to: %v", err))
+			return
+		}
+	}
+
+	ro, exists := supervisor.Global.GetRunningObject(name, supervisor.CategoryPipeline)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	pipeline, ok := ro.Instance().(*httppipeline.HTTPPipeline)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not a %s", name, httppipeline.Kind))
+		return
+	}
+
+	result, err := pipeline.Replay(from, to)
+	if err != nil {
+		if result == nil {
+			HandleAPIError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		HandleAPIError(w, r, http.StatusInternalServerError,
+			fmt.Errorf("replayed %d requests: %v", result.Replayed, err))
+		return
+	}
+
+	buff, err := yaml.Marshal(result)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", result, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
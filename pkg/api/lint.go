@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/lint"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// LintPrefix is the prefix of linting objects.
+	LintPrefix = "/lint"
+)
+
+func (s *Server) setupLintAPIs() {
+	lintAPIs := []*APIEntry{
+		{
+			Path:    LintPrefix,
+			Method:  "GET",
+			Handler: s.lintObjects,
+		},
+		{
+			Path:    LintPrefix,
+			Method:  "POST",
+			Handler: s.lintBodySpecs,
+		},
+	}
+
+	s.RegisterAPIs(lintAPIs)
+}
+
+// lintObjects reports the issues of the running objects.
+func (s *Server) lintObjects(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	writeYAML(w, lint.Lint(s._listObjects()))
+}
+
+// lintBodySpecs reports the issues of the specs in the body as if they
+// were created or updated, the other objects are kept as they are. Nothing
+// is changed.
+func (s *Server) lintBodySpecs(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	specs, err := readSpecs(body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// No need to lock.
+
+	writeYAML(w, lintSpecs(s._listObjects(), specs, nil))
+}
+
+// lintSpecs reports the issues of the specs, with the ones of the current
+// objects to be kept, since some rules are about the references between
+// objects. Only the issues of the specs are reported.
+func lintSpecs(current, specs []*supervisor.Spec, changes []*ApplyChange) []*lint.Issue {
+	names, excluded := map[string]struct{}{}, map[string]struct{}{}
+	for _, spec := range specs {
+		names[spec.Name()] = struct{}{}
+		excluded[spec.Name()] = struct{}{}
+	}
+	for _, change := range changes {
+		if change.Action == applyActionDelete {
+			excluded[change.Name] = struct{}{}
+		}
+	}
+
+	all := append([]*supervisor.Spec{}, specs...)
+	for _, spec := range current {
+		if _, exists := excluded[spec.Name()]; !exists {
+			all = append(all, spec)
+		}
+	}
+
+	var issues []*lint.Issue
+	for _, issue := range lint.Lint(all) {
+		if _, exists := names[issue.Object]; exists {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
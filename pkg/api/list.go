@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// ContinueHeader is the header of the token of the next page, it's
+	// absent in the last page.
+	ContinueHeader = "X-Continue"
+	// TotalCountHeader is the header of the number of items matched by
+	// the filters of all pages.
+	TotalCountHeader = "X-Total-Count"
+)
+
+type (
+	// listQuery is the query of list APIs, all parameters are optional:
+	//   name: the glob pattern of names, e.g. shop-*
+	//   kind: the kinds separated by commas
+	//   limit: the max number of items in a page
+	//   continue: the token of the page, from the header of the previous page
+	//   fields: the top-level fields of items separated by commas, name
+	//           and kind are always kept
+	listQuery struct {
+		namePattern string
+		kinds       map[string]struct{}
+		limit       int
+		cont        string
+		fields      []string
+	}
+
+	// listItem is an item of list APIs, the items are sorted by names.
+	listItem struct {
+		name  string
+		kinds []string
+		value interface{}
+	}
+)
+
+func parseListQuery(r *http.Request) (*listQuery, error) {
+	values := r.URL.Query()
+	q := &listQuery{
+		namePattern: values.Get("name"),
+		cont:        values.Get("continue"),
+	}
+
+	if q.namePattern != "" {
+		if _, err := path.Match(q.namePattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %s: %v", q.namePattern, err)
+		}
+	}
+
+	if kinds := values.Get("kind"); kinds != "" {
+		q.kinds = map[string]struct{}{}
+		for _, kind := range strings.Split(kinds, ",") {
+			q.kinds[strings.TrimSpace(kind)] = struct{}{}
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		var err error
+		q.limit, err = strconv.Atoi(limit)
+		if err != nil || q.limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %s", limit)
+		}
+	}
+
+	if fields := values.Get("fields"); fields != "" {
+		q.fields = []string{"name", "kind"}
+		for _, field := range strings.Split(fields, ",") {
+			q.fields = append(q.fields, strings.TrimSpace(field))
+		}
+	}
+
+	return q, nil
+}
+
+func (q *listQuery) match(item *listItem) bool {
+	if q.namePattern != "" {
+		if matched, _ := path.Match(q.namePattern, item.name); !matched {
+			return false
+		}
+	}
+
+	if q.kinds == nil {
+		return true
+	}
+	for _, kind := range item.kinds {
+		if _, exists := q.kinds[kind]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// page returns the page of the items matched, and sets the headers of
+// the page. The token of the next page is the name of the last item, so
+// pages are consistent while items are created or deleted.
+func (q *listQuery) page(w http.ResponseWriter, items []*listItem) []*listItem {
+	var matched []*listItem
+	for _, item := range items {
+		if q.match(item) {
+			matched = append(matched, item)
+		}
+	}
+	w.Header().Set(TotalCountHeader, strconv.Itoa(len(matched)))
+
+	var page []*listItem
+	for _, item := range matched {
+		if q.cont != "" && item.name <= q.cont {
+			continue
+		}
+		if q.limit != 0 && len(page) == q.limit {
+			w.Header().Set(ContinueHeader, page[len(page)-1].name)
+			break
+		}
+		page = append(page, item)
+	}
+
+	return page
+}
+
+// selectFields returns the top-level fields of the value selected by the
+// query, the value is returned as it is if no fields are selected.
+func (q *listQuery) selectFields(v interface{}) (interface{}, error) {
+	if len(q.fields) == 0 {
+		return v, nil
+	}
+
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		buff, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %#v to yaml failed: %v", v, err)
+		}
+		err = yaml.Unmarshal(buff, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", buff, err)
+		}
+	}
+
+	selected := map[string]interface{}{}
+	for _, field := range q.fields {
+		if value, exists := doc[field]; exists {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListQuery(t *testing.T) {
+	var items []*listItem
+	for _, name := range []string{"shop-a", "shop-b", "shop-c", "shop-d", "user-a"} {
+		kind := "HTTPPipeline"
+		if name == "shop-c" {
+			kind = "HTTPServer"
+		}
+		items = append(items, &listItem{
+			name:  name,
+			kinds: []string{kind},
+			value: map[string]interface{}{"name": name, "kind": kind, "flow": []string{"proxy"}},
+		})
+	}
+
+	page := func(query string) ([]string, string, string) {
+		r := httptest.NewRequest("GET", "/apis/v1/objects?"+query, nil)
+		q, err := parseListQuery(r)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", query, err)
+		}
+		w := httptest.NewRecorder()
+		var names []string
+		for _, item := range q.page(w, items) {
+			names = append(names, item.name)
+		}
+		return names, w.Header().Get(ContinueHeader), w.Header().Get(TotalCountHeader)
+	}
+
+	names, cont, total := page("name=shop-*&kind=HTTPPipeline&limit=2")
+	if len(names) != 2 || names[1] != "shop-b" || cont != "shop-b" || total != "3" {
+		t.Errorf("unexpected first page %v, continue %q, total %s", names, cont, total)
+	}
+	names, cont, _ = page("name=shop-*&kind=HTTPPipeline&limit=2&continue=" + cont)
+	if len(names) != 1 || names[0] != "shop-d" || cont != "" {
+		t.Errorf("unexpected last page %v, continue %q", names, cont)
+	}
+	names, _, total = page("")
+	if len(names) != 5 || total != "5" {
+		t.Errorf("unexpected page %v without query", names)
+	}
+
+	for _, query := range []string{"limit=0", "limit=x", "name=["} {
+		r := httptest.NewRequest("GET", "/apis/v1/objects?"+query, nil)
+		if _, err := parseListQuery(r); err == nil {
+			t.Errorf("want error of %s", query)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/apis/v1/objects?fields=flow", nil)
+	q, _ := parseListQuery(r)
+	selected, err := q.selectFields(items[0].value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc := selected.(map[string]interface{}); len(doc) != 3 || doc["flow"] == nil {
+		t.Errorf("unexpected fields %v", doc)
+	}
+}
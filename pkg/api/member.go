@@ -39,6 +39,11 @@ func (s *Server) setupMemberAPIs() {
 			Method:  "DELETE",
 			Handler: s.purgeMember,
 		},
+		{
+			Path:    "/status/raft",
+			Method:  "GET",
+			Handler: s.getRaftStatus,
+		},
 	}
 
 	s.RegisterAPIs(memberAPIs)
@@ -99,3 +104,14 @@ func (s *Server) purgeMember(w http.ResponseWriter, r *http.Request) {
 
 	s._purgeMember(memberName)
 }
+
+func (s *Server) getRaftStatus(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	status, err := s.cluster.RaftStatus()
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	writeYAML(w, status)
+}
@@ -51,25 +51,36 @@ type (
 	}
 )
 
-var (
-	filterMetaBook = map[string]*FilterMeta{}
-	filterKinds    []string
-)
+// NOTE: Filters could be registered or unregistered at runtime by plugins,
+// so the metadata is always built from the latest registry.
+func filterMeta(kind string) (*FilterMeta, bool) {
+	f, exists := httppipeline.GetFilterRegistry()[kind]
+	if !exists {
+		return nil, false
+	}
 
-func (s *Server) setupMetadaAPIs() {
-	filterRegistry := httppipeline.GetFilterRegistry()
-	for kind, f := range filterRegistry {
-		filterMetaBook[kind] = &FilterMeta{
-			Kind:        kind,
-			Results:     f.Results(),
-			SpecType:    reflect.TypeOf(f.DefaultSpec()),
-			Description: f.Description(),
-		}
-		filterKinds = append(filterKinds, kind)
-		sort.Strings(filterMetaBook[kind].Results)
+	fm := &FilterMeta{
+		Kind:        kind,
+		Results:     append([]string{}, f.Results()...),
+		SpecType:    reflect.TypeOf(f.DefaultSpec()),
+		Description: f.Description(),
+	}
+	sort.Strings(fm.Results)
+
+	return fm, true
+}
+
+func filterKinds() []string {
+	kinds := []string{}
+	for kind := range httppipeline.GetFilterRegistry() {
+		kinds = append(kinds, kind)
 	}
-	sort.Strings(filterKinds)
+	sort.Strings(kinds)
 
+	return kinds
+}
+
+func (s *Server) setupMetadaAPIs() {
 	metadataAPIs := make([]*APIEntry, 0)
 	metadataAPIs = append(metadataAPIs,
 		&APIEntry{
@@ -98,9 +109,10 @@ func (s *Server) setupMetadaAPIs() {
 }
 
 func (s *Server) listFilters(w http.ResponseWriter, r *http.Request) {
-	buff, err := yaml.Marshal(filterKinds)
+	kinds := filterKinds()
+	buff, err := yaml.Marshal(kinds)
 	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", filterKinds, err))
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", kinds, err))
 	}
 
 	w.Header().Set("Content-Type", "text/vnd.yaml")
@@ -110,7 +122,7 @@ func (s *Server) listFilters(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getFilterDescription(w http.ResponseWriter, r *http.Request) {
 	kind := chi.URLParam(r, "kind")
 
-	fm, exits := filterMetaBook[kind]
+	fm, exits := filterMeta(kind)
 	if !exits {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
 		return
@@ -121,7 +133,7 @@ func (s *Server) getFilterDescription(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getFilterSchema(w http.ResponseWriter, r *http.Request) {
 	kind := chi.URLParam(r, "kind")
 
-	fm, exits := filterMetaBook[kind]
+	fm, exits := filterMeta(kind)
 	if !exits {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
 		return
@@ -139,7 +151,7 @@ func (s *Server) getFilterSchema(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getFilterResults(w http.ResponseWriter, r *http.Request) {
 	kind := chi.URLParam(r, "kind")
 
-	fm, exits := filterMetaBook[kind]
+	fm, exits := filterMeta(kind)
 	if !exits {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
 		return
@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const (
+	// NamespacePrefix is the prefix of namespaces.
+	NamespacePrefix = "/namespaces"
+)
+
+type (
+	// Namespace isolates the objects of a team: their names are scoped
+	// by it, and the kinds and the number of them could be limited.
+	Namespace struct {
+		Name        string `yaml:"name" jsonschema:"required,format=urlname"`
+		Description string `yaml:"description,omitempty" jsonschema:"omitempty"`
+		// Kinds are the object kinds allowed in the namespace, all
+		// kinds if empty.
+		Kinds []string `yaml:"kinds,omitempty" jsonschema:"omitempty"`
+		// FilterKinds are the filter kinds allowed in the pipelines of
+		// the namespace, including the ones of plugins, all kinds if
+		// empty.
+		FilterKinds []string `yaml:"filterKinds,omitempty" jsonschema:"omitempty"`
+		// MaxObjects is the quota of objects in the namespace, there's
+		// no limit if it's 0.
+		MaxObjects int `yaml:"maxObjects,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// NamespaceInfo is the namespace with the number of objects in it.
+	NamespaceInfo struct {
+		Namespace `yaml:",inline"`
+		Objects   int `yaml:"objects"`
+	}
+)
+
+func (s *Server) setupNamespaceAPIs() {
+	namespaceAPIs := []*APIEntry{
+		{
+			Path:    NamespacePrefix,
+			Method:  "POST",
+			Handler: s.createNamespace,
+		},
+		{
+			Path:    NamespacePrefix,
+			Method:  "GET",
+			Handler: s.listNamespaces,
+		},
+		{
+			Path:    NamespacePrefix + "/{name}",
+			Method:  "GET",
+			Handler: s.getNamespace,
+		},
+		{
+			Path:    NamespacePrefix + "/{name}",
+			Method:  "PUT",
+			Handler: s.updateNamespace,
+		},
+		{
+			Path:    NamespacePrefix + "/{name}",
+			Method:  "DELETE",
+			Handler: s.deleteNamespace,
+		},
+	}
+
+	s.RegisterAPIs(namespaceAPIs)
+}
+
+// newNamespace creates a namespace from the YAML config and validates it.
+func newNamespace(config []byte) (*Namespace, error) {
+	ns := &Namespace{}
+	err := yaml.UnmarshalStrict(config, ns)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	vr := v.Validate(ns, config)
+	if !vr.Valid() {
+		return nil, fmt.Errorf("validate failed: \n%w", vr)
+	}
+	if strings.Contains(ns.Name, supervisor.NamespaceSeparator) {
+		return nil, fmt.Errorf("name %s contains %s", ns.Name, supervisor.NamespaceSeparator)
+	}
+
+	return ns, nil
+}
+
+func (ns *Namespace) allowsKind(kind string) bool {
+	return len(ns.Kinds) == 0 || containsString(ns.Kinds, kind)
+}
+
+func (ns *Namespace) allowsFilterKind(kind string) bool {
+	return len(ns.FilterKinds) == 0 || containsString(ns.FilterKinds, kind)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNamespaces checks the objects changed by the changes against
+// their namespaces: the namespace of a created or updated object must
+// exist and allow the kinds of it and its filters, and the namespaces
+// getting more objects must be within their quotas. The names in the
+// default namespace must not look like the ones in a namespace.
+func checkNamespaces(namespaces map[string]*Namespace, current []*supervisor.Spec, changes []*ApplyChange) error {
+	counts := map[string]int{}
+	for _, spec := range current {
+		counts[spec.Namespace()]++
+	}
+
+	grown := map[string]struct{}{}
+	for _, change := range changes {
+		spec := change.spec
+		switch change.Action {
+		case applyActionCreate:
+			counts[spec.Namespace()]++
+			grown[spec.Namespace()] = struct{}{}
+		case applyActionDelete:
+			counts[spec.Namespace()]--
+			continue
+		}
+
+		if spec.Namespace() == "" {
+			prefix := strings.SplitN(spec.Name(), supervisor.NamespaceSeparator, 2)[0]
+			if _, exists := namespaces[prefix]; exists && prefix != spec.Name() {
+				return fmt.Errorf("name %s is reserved by namespace %s", spec.Name(), prefix)
+			}
+			continue
+		}
+
+		ns := namespaces[spec.Namespace()]
+		if ns == nil {
+			return fmt.Errorf("namespace %s of %s not found", spec.Namespace(), spec.Name())
+		}
+		if !ns.allowsKind(spec.Kind()) {
+			return fmt.Errorf("kind %s of %s is not allowed in namespace %s", spec.Kind(), spec.Name(), ns.Name)
+		}
+		if spec.Kind() != httppipeline.Kind {
+			continue
+		}
+		for _, filter := range spec.ObjectSpec().(*httppipeline.Spec).Filters {
+			kind, _ := filter["kind"].(string)
+			if !ns.allowsFilterKind(kind) {
+				return fmt.Errorf("filter kind %s of %s is not allowed in namespace %s", kind, spec.Name(), ns.Name)
+			}
+		}
+	}
+
+	for name := range grown {
+		ns := namespaces[name]
+		if ns != nil && ns.MaxObjects != 0 && counts[name] > ns.MaxObjects {
+			return fmt.Errorf("namespace %s exceeds the quota of %d objects", name, ns.MaxObjects)
+		}
+	}
+
+	return nil
+}
+
+// _checkNamespaces checks the changes of the objects against their
+// namespaces like checkNamespaces.
+func (s *Server) _checkNamespaces(current []*supervisor.Spec, changes []*ApplyChange) error {
+	namespaces := map[string]*Namespace{}
+	for _, ns := range s._listNamespaces() {
+		namespaces[ns.Name] = ns
+	}
+	return checkNamespaces(namespaces, current, changes)
+}
+
+func (s *Server) readNamespace(w http.ResponseWriter, r *http.Request) (*Namespace, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	ns, err := newNamespace(body)
+	if err != nil {
+		return nil, err
+	}
+
+	name := chi.URLParam(r, "name")
+	if name != "" && name != ns.Name {
+		return nil, fmt.Errorf("inconsistent name in url and namespace")
+	}
+
+	return ns, nil
+}
+
+// namespaceObjects returns the names of the objects in the namespace, or
+// the ones in the default namespace looking like in it if any.
+func namespaceObjects(specs []*supervisor.Spec, name string) []string {
+	var names []string
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Name(), name+supervisor.NamespaceSeparator) {
+			names = append(names, spec.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) createNamespace(w http.ResponseWriter, r *http.Request) {
+	ns, err := s.readNamespace(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getNamespace(ns.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("conflict name: %s", ns.Name))
+		return
+	}
+	if names := namespaceObjects(s._listObjects(), ns.Name); len(names) != 0 {
+		HandleAPIError(w, r, http.StatusConflict,
+			fmt.Errorf("names of objects conflict with namespace %s: %s", ns.Name, strings.Join(names, ", ")))
+		return
+	}
+
+	s._putNamespace(ns)
+	s.upgradeConfigVersion(w, r)
+
+	s.setETag(w, s.cluster.Layout().ConfigNamespaceKey(ns.Name))
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, ns.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) listNamespaces(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	specs := s._listObjects()
+	namespaces := s._listNamespaces()
+	infos := make([]*NamespaceInfo, 0, len(namespaces))
+	for _, ns := range namespaces {
+		infos = append(infos, &NamespaceInfo{
+			Namespace: *ns,
+			Objects:   len(namespaceObjects(specs, ns.Name)),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	writeYAML(w, infos)
+}
+
+func (s *Server) getNamespace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// No need to lock.
+
+	s.setETag(w, s.cluster.Layout().ConfigNamespaceKey(name))
+	ns := s._getNamespace(name)
+	if ns == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	writeYAML(w, &NamespaceInfo{
+		Namespace: *ns,
+		Objects:   len(namespaceObjects(s._listObjects(), name)),
+	})
+}
+
+// updateNamespace updates the namespace, the limits apply to the later
+// changes of objects, the existing objects are kept.
+func (s *Server) updateNamespace(w http.ResponseWriter, r *http.Request) {
+	ns, err := s.readNamespace(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	key := s.cluster.Layout().ConfigNamespaceKey(ns.Name)
+	if !s._checkIfMatch(w, r, key) {
+		return
+	}
+
+	if s._getNamespace(ns.Name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	s._putNamespace(ns)
+	s.upgradeConfigVersion(w, r)
+	s.setETag(w, key)
+}
+
+// deleteNamespace deletes the namespace, which must have no objects.
+func (s *Server) deleteNamespace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if !s._checkIfMatch(w, r, s.cluster.Layout().ConfigNamespaceKey(name)) {
+		return
+	}
+
+	if s._getNamespace(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if names := namespaceObjects(s._listObjects(), name); len(names) != 0 {
+		HandleAPIError(w, r, http.StatusConflict,
+			fmt.Errorf("namespace %s has objects: %s", name, strings.Join(names, ", ")))
+		return
+	}
+
+	s._deleteNamespace(name)
+	s.upgradeConfigVersion(w, r)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckNamespaces(t *testing.T) {
+	current, err := readSpecs([]byte(`
+- name: pipeline
+  namespace: shop
+  kind: HTTPPipeline
+  filters:
+  - name: mock
+    kind: Mock
+    rules:
+    - code: 200
+- name: pipeline
+  kind: HTTPPipeline
+  filters:
+  - name: mock
+    kind: Mock
+    rules:
+    - code: 200
+`))
+	if err != nil {
+		t.Fatalf("read specs failed: %v", err)
+	}
+	if current[0].Name() != "shop.pipeline" || current[1].Name() != "pipeline" {
+		t.Fatalf("unexpected names: %s, %s", current[0].Name(), current[1].Name())
+	}
+
+	namespaces := map[string]*Namespace{
+		"shop": {Name: "shop", FilterKinds: []string{"Mock"}, MaxObjects: 2},
+		"blog": {Name: "blog", FilterKinds: []string{"Proxy"}},
+	}
+	const filters = "filters:\n- name: mock\n  kind: Mock\n  rules:\n  - code: 200\n"
+	plan := func(config string) []*ApplyChange {
+		specs, err := readSpecs([]byte(config))
+		if err != nil {
+			t.Fatalf("read specs failed: %v", err)
+		}
+		p, err := planChanges(current, append(specs, current...), nil)
+		if err != nil {
+			t.Fatalf("plan changes failed: %v", err)
+		}
+		return p.Changes
+	}
+
+	changes := plan("name: another\nnamespace: shop\nkind: HTTPPipeline\n" + filters)
+	if err := checkNamespaces(namespaces, current, changes); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+
+	for config, want := range map[string]string{
+		"name: another\nnamespace: docs\nkind: HTTPPipeline\n" + filters: "not found",
+		"name: another\nnamespace: blog\nkind: HTTPPipeline\n" + filters: "not allowed",
+		"name: shop.another\nkind: HTTPPipeline\n" + filters:             "reserved",
+	} {
+		err := checkNamespaces(namespaces, current, plan(config))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("want error %q for %q, got %v", want, config, err)
+		}
+	}
+
+	namespaces["shop"].MaxObjects = 1
+	if err := checkNamespaces(namespaces, current, changes); err == nil {
+		t.Errorf("want error for exceeding the quota")
+	}
+
+	_, err = newNamespace([]byte("name: a.b\n"))
+	if err == nil {
+		t.Errorf("want error for the separator in the name")
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"sort"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/supervisor"
 
 	yaml "gopkg.in/yaml.v2"
@@ -97,6 +98,16 @@ func (s *Server) readObjectSpec(w http.ResponseWriter, r *http.Request) (*superv
 		return nil, fmt.Errorf("read body failed: %v", err)
 	}
 
+	// NOTE: The rest documents used to be ignored silently, which could
+	// lose objects.
+	configs, err := splitSpecDocs(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) > 1 {
+		return nil, fmt.Errorf("%d specs in body, send them one by one or apply them", len(configs))
+	}
+
 	spec, err := supervisor.NewSpec(string(body))
 	if err != nil {
 		return nil, err
@@ -107,12 +118,44 @@ func (s *Server) readObjectSpec(w http.ResponseWriter, r *http.Request) (*superv
 		return nil, fmt.Errorf("inconsistent name in url and spec ")
 	}
 
-	return spec, err
+	return encryptSpec(spec)
+}
+
+// encryptSpec returns the spec with sensitive fields encrypted, which is
+// the one to be stored.
+func encryptSpec(spec *supervisor.Spec) (*supervisor.Spec, error) {
+	config, err := secret.EncryptYAML(spec.YAMLConfig())
+	if err != nil {
+		return nil, fmt.Errorf("encrypt sensitive fields failed: %v", err)
+	}
+	if config == spec.YAMLConfig() {
+		return spec, nil
+	}
+
+	return supervisor.NewSpec(config)
 }
 
-func (s *Server) upgradeConfigVersion(w http.ResponseWriter, r *http.Request) {
+// restoreRedacted returns the spec with redacted values of sensitive
+// fields replaced by the ones of the current spec.
+func restoreRedacted(spec, current *supervisor.Spec) (*supervisor.Spec, error) {
+	config, err := secret.RestoreRedactedYAML(spec.YAMLConfig(), current.YAMLConfig())
+	if err != nil {
+		return nil, fmt.Errorf("restore redacted values failed: %v", err)
+	}
+	if config == spec.YAMLConfig() {
+		return spec, nil
+	}
+
+	return supervisor.NewSpec(config)
+}
+
+func (s *Server) upgradeConfigVersion(w http.ResponseWriter, r *http.Request) int64 {
 	version := s._plusOneVersion()
-	w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
+	// NOTE: It's nil if the objects are synced by others.
+	if w != nil {
+		w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
+	}
+	return version
 }
 
 func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
@@ -123,6 +166,9 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	name := spec.Name()
+	if !authorizeObject(w, r, name) {
+		return
+	}
 
 	s.Lock()
 	defer s.Unlock()
@@ -133,9 +179,21 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
-	s.upgradeConfigVersion(w, r)
+	change := &ApplyChange{Action: applyActionCreate, Kind: spec.Kind(), Name: name, spec: spec}
+	err = s._checkNamespaces(s._listObjects(), []*ApplyChange{change})
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
 
+	spec, err = s._putVersionedObject(w, r, spec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	s.auditObject(r, spec.Kind(), name, "", spec.YAMLConfig())
+
+	s.setETag(w, s.cluster.Layout().ConfigObjectKey(name))
 	w.WriteHeader(http.StatusCreated)
 	location := fmt.Sprintf("%s/%s", r.URL.Path, name)
 	w.Header().Set("Location", location)
@@ -143,10 +201,17 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
+	if !authorizeObject(w, r, name) {
+		return
+	}
 
 	s.Lock()
 	defer s.Unlock()
 
+	if !s._checkIfMatch(w, r, s.cluster.Layout().ConfigObjectKey(name)) {
+		return
+	}
+
 	spec := s._getObject(name)
 	if spec == nil {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
@@ -154,7 +219,9 @@ func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s._deleteObject(name)
+	s._deleteObjectVersions(name)
 	s.upgradeConfigVersion(w, r)
+	s.auditObject(r, spec.Kind(), name, spec.YAMLConfig(), "")
 }
 
 func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
@@ -162,6 +229,7 @@ func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
 
 	// No need to lock.
 
+	s.setETag(w, s.cluster.Layout().ConfigObjectKey(name))
 	spec := s._getObject(name)
 	if spec == nil {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
@@ -171,7 +239,7 @@ func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
 	// Reference: https://mailarchive.ietf.org/arch/msg/media-types/e9ZNC0hDXKXeFlAVRWxLCCaG9GI
 	w.Header().Set("Content-Type", "text/vnd.yaml")
 
-	w.Write([]byte(spec.YAMLConfig()))
+	w.Write([]byte(secret.RedactYAML(spec.YAMLConfig())))
 }
 
 func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
@@ -182,10 +250,18 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	name := spec.Name()
+	if !authorizeObject(w, r, name) {
+		return
+	}
 
 	s.Lock()
 	defer s.Unlock()
 
+	key := s.cluster.Layout().ConfigObjectKey(name)
+	if !s._checkIfMatch(w, r, key) {
+		return
+	}
+
 	existedSpec := s._getObject(name)
 	if existedSpec == nil {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
@@ -199,20 +275,64 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
-	s.upgradeConfigVersion(w, r)
+	// NOTE: Redacted values keep the current ones, so a spec read from
+	// the API could be updated as it is.
+	spec, err = restoreRedacted(spec, existedSpec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	change := &ApplyChange{Action: applyActionUpdate, Kind: spec.Kind(), Name: name, spec: spec}
+	err = s._checkNamespaces(s._listObjects(), []*ApplyChange{change})
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	spec, err = s._putVersionedObject(w, r, spec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	s.auditObject(r, spec.Kind(), name, existedSpec.YAMLConfig(), spec.YAMLConfig())
+	s.setETag(w, key)
 }
 
 func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	// No need to lock.
 
 	specs := specList(s._listObjects())
 	// NOTE: Keep it consistent.
 	sort.Sort(specs)
 
-	buff, err := specs.Marshal()
+	items := make([]*listItem, 0, len(specs))
+	for _, spec := range specs {
+		items = append(items, &listItem{name: spec.Name(), kinds: []string{spec.Kind()}, value: spec})
+	}
+
+	docs := []interface{}{}
+	for _, item := range q.page(w, items) {
+		doc, err := redactedSpecDoc(item.value.(*supervisor.Spec))
+		if err != nil {
+			panic(err)
+		}
+		selected, err := q.selectFields(doc)
+		if err != nil {
+			panic(err)
+		}
+		docs = append(docs, selected)
+	}
+
+	buff, err := yaml.Marshal(docs)
 	if err != nil {
-		panic(err)
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", docs, err))
 	}
 
 	w.Header().Set("Content-Type", "text/vnd.yaml")
@@ -244,13 +364,46 @@ func (s *Server) getStatusObject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) listStatusObjects(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	// No need to lock.
 
 	status := s._listStatusObjects()
 
-	buff, err := yaml.Marshal(status)
+	kinds := map[string]string{}
+	for _, spec := range s._listObjects() {
+		kinds[spec.Name()] = spec.Kind()
+	}
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]*listItem, 0, len(names))
+	for _, name := range names {
+		items = append(items, &listItem{name: name, kinds: []string{kinds[name]}, value: status[name]})
+	}
+
+	result := map[string]map[string]interface{}{}
+	for _, item := range q.page(w, items) {
+		members := map[string]interface{}{}
+		for member, memberStatus := range item.value.(map[string]interface{}) {
+			members[member], err = q.selectFields(memberStatus)
+			if err != nil {
+				panic(err)
+			}
+		}
+		result[item.name] = members
+	}
+
+	buff, err := yaml.Marshal(result)
 	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", result, err))
 	}
 
 	w.Header().Set("Content-Type", "text/vnd.yaml")
@@ -263,24 +416,18 @@ type specList []*supervisor.Spec
 func (s specList) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
 func (s specList) Len() int           { return len(s) }
 func (s specList) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s specList) Marshal() ([]byte, error) {
-	specs := []map[string]interface{}{}
-	for _, spec := range s {
-		var m map[string]interface{}
-		err := yaml.Unmarshal([]byte(spec.YAMLConfig()), &m)
-		if err != nil {
-			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v",
-				spec.YAMLConfig(), err)
-		}
-		specs = append(specs, m)
-	}
 
-	buff, err := yaml.Marshal(specs)
+// redactedSpecDoc returns the document of the spec with sensitive fields
+// redacted.
+func redactedSpecDoc(spec *supervisor.Spec) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := yaml.Unmarshal([]byte(secret.RedactYAML(spec.YAMLConfig())), &m)
 	if err != nil {
-		return nil, fmt.Errorf("marshal %#v to yaml failed: %v", specs, err)
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v",
+			spec.YAMLConfig(), err)
 	}
 
-	return buff, nil
+	return m, nil
 }
 
 func (s *Server) listObjectKinds(w http.ResponseWriter, r *http.Request) {
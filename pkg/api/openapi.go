@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/openapi"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// OpenAPIPath is the path of the OpenAPI document of the APIs served
+	// by HTTP servers.
+	OpenAPIPath = "/openapi"
+)
+
+func (s *Server) setupOpenAPIAPIs() {
+	openAPIAPIs := []*APIEntry{
+		{
+			Path:    OpenAPIPath,
+			Method:  "GET",
+			Handler: s.getOpenAPI,
+		},
+	}
+
+	s.RegisterAPIs(openAPIAPIs)
+}
+
+// getOpenAPI generates the OpenAPI document of the APIs served by the
+// HTTP servers, or by the one in the query server. It's in JSON, or YAML
+// if the request asks for it.
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	server := r.URL.Query().Get("server")
+
+	// No need to lock.
+
+	specs := s._listObjects()
+	if server != "" {
+		var selected []*supervisor.Spec
+		found := false
+		for _, spec := range specs {
+			if spec.Name() == server && spec.Kind() == openapi.ServerKind {
+				found = true
+			} else if spec.Kind() == openapi.ServerKind {
+				continue
+			}
+			selected = append(selected, spec)
+		}
+		if !found {
+			HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("server %s not found", server))
+			return
+		}
+		specs = selected
+	}
+
+	doc := openapi.Generate(specs, &openapi.Info{
+		Title:   fmt.Sprintf("APIs of %s", s.opt.ClusterName),
+		Version: fmt.Sprintf("%d", s._getVersion()),
+	})
+	writeSchema(w, r, doc)
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+type (
+	// ObjectVersion is a version of the spec of a pipeline, which is
+	// kept for rollback.
+	ObjectVersion struct {
+		Version int64  `yaml:"version"`
+		Time    string `yaml:"time"`
+		Spec    string `yaml:"spec,omitempty"`
+	}
+)
+
+func (s *Server) setupObjectVersionAPIs() {
+	versionAPIs := []*APIEntry{
+		{
+			Path:    ObjectPrefix + "/{name}/versions",
+			Method:  "GET",
+			Handler: s.listObjectVersions,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/versions/{version}",
+			Method:  "GET",
+			Handler: s.getObjectVersion,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/rollback",
+			Method:  "POST",
+			Handler: s.rollbackObject,
+		},
+	}
+
+	s.RegisterAPIs(versionAPIs)
+}
+
+// _putVersionedObject puts the spec and upgrades the config version. The
+// version of a pipeline is stamped into its spec, and the spec is kept
+// in its history for rollback.
+func (s *Server) _putVersionedObject(w http.ResponseWriter, r *http.Request,
+	spec *supervisor.Spec) (*supervisor.Spec, error) {
+
+	if spec.Kind() != httppipeline.Kind {
+		s._putObject(spec)
+		s.upgradeConfigVersion(w, r)
+		return spec, nil
+	}
+
+	version := s.upgradeConfigVersion(w, r)
+	spec, err := stampVersion(spec, version)
+	if err != nil {
+		return nil, err
+	}
+	s._putObject(spec)
+	s._keepObjectVersion(spec, version)
+
+	return spec, nil
+}
+
+// _keepObjectVersion keeps the stamped spec of the pipeline in its
+// history, the oldest ones beyond the limit are removed.
+func (s *Server) _keepObjectVersion(spec *supervisor.Spec, version int64) {
+	if s.opt.PipelineVersions == 0 {
+		return
+	}
+
+	name := spec.Name()
+	s._putObjectVersion(name, &ObjectVersion{
+		Version: version,
+		Time:    time.Now().Format(time.RFC3339),
+		Spec:    spec.YAMLConfig(),
+	})
+	versions := s._listObjectVersions(name)
+	for len(versions) > s.opt.PipelineVersions {
+		s._deleteObjectVersion(name, versions[0].Version)
+		versions = versions[1:]
+	}
+}
+
+// stampVersion sets the version field of the spec, the order of other
+// fields is kept.
+func stampVersion(spec *supervisor.Spec, version int64) (*supervisor.Spec, error) {
+	config := yaml.MapSlice{}
+	err := yaml.Unmarshal([]byte(spec.YAMLConfig()), &config)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal spec failed: %v", err)
+	}
+
+	found := false
+	for i := range config {
+		if config[i].Key == "version" {
+			config[i].Value, found = version, true
+		}
+	}
+	if !found {
+		config = append(config, yaml.MapItem{Key: "version", Value: version})
+	}
+
+	buff, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("marshal spec failed: %v", err)
+	}
+
+	return supervisor.NewSpec(string(buff))
+}
+
+func (s *Server) listObjectVersions(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// No need to lock.
+
+	versions := s._listObjectVersions(name)
+	for _, version := range versions {
+		version.Spec = ""
+	}
+
+	buff, err := yaml.Marshal(versions)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", versions, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func (s *Server) getObjectVersion(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid version: %v", err))
+		return
+	}
+
+	// No need to lock.
+
+	for _, v := range s._listObjectVersions(name) {
+		if v.Version == version {
+			w.Header().Set("Content-Type", "text/vnd.yaml")
+			w.Write([]byte(secret.RedactYAML(v.Spec)))
+			return
+		}
+	}
+
+	HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+}
+
+// rollbackObject puts the spec of the version in the query, or the one
+// before the running version, as a new version of the pipeline.
+func (s *Server) rollbackObject(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !authorizeObject(w, r, name) {
+		return
+	}
+
+	var target int64
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		target, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid version: %v", err))
+			return
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	spec := s._getObject(name)
+	if spec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if spec.Kind() != httppipeline.Kind {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not a %s", name, httppipeline.Kind))
+		return
+	}
+
+	current := spec.ObjectSpec().(*httppipeline.Spec).Version
+	var version *ObjectVersion
+	for _, v := range s._listObjectVersions(name) {
+		if (target != 0 && v.Version == target) || (target == 0 && v.Version < current) {
+			version = v
+		}
+	}
+	if version == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("version not found"))
+		return
+	}
+	if version.Version == current {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("version %d is running", current))
+		return
+	}
+
+	prevSpec, err := supervisor.NewSpec(version.Spec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("spec of version %d is invalid: %v", version.Version, err))
+		return
+	}
+
+	newSpec, err := s._putVersionedObject(w, r, prevSpec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	s.auditObject(r, spec.Kind(), name, spec.YAMLConfig(), newSpec.YAMLConfig())
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/megaease/easegress/pkg/filter/mock"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestStampVersion(t *testing.T) {
+	spec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+drainTimeout: 10s
+version: 3
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	spec, err = stampVersion(spec, 8)
+	if err != nil {
+		t.Fatalf("stamp version failed: %v", err)
+	}
+	if v := spec.ObjectSpec().(*httppipeline.Spec).Version; v != 8 {
+		t.Errorf("want version 8, got %d", v)
+	}
+	if !strings.HasPrefix(spec.YAMLConfig(), "name: pipeline\nkind: HTTPPipeline\n") {
+		t.Errorf("order of fields is not kept:\n%s", spec.YAMLConfig())
+	}
+}
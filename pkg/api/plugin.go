@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/goplugin"
+)
+
+const (
+	// PluginPrefix is the prefix of plugin api.
+	PluginPrefix = "/plugins"
+)
+
+func (s *Server) setupPluginAPIs() {
+	pluginAPIs := []*APIEntry{
+		{
+			Path:    PluginPrefix,
+			Method:  "GET",
+			Handler: s.listPlugins,
+		},
+		{
+			Path:    PluginPrefix + "/kinds/{kind}",
+			Method:  "DELETE",
+			Handler: s.unloadPluginKind,
+		},
+	}
+
+	s.RegisterAPIs(pluginAPIs)
+}
+
+// listPlugins lists the plugins, they're named by the base names of
+// their paths, and their kinds are the filter kinds loaded from them.
+func (s *Server) listPlugins(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	plugins := []*goplugin.Plugin{}
+	if goplugin.Global != nil {
+		plugins = goplugin.Global.Plugins()
+	}
+
+	items := make([]*listItem, 0, len(plugins))
+	for _, p := range plugins {
+		items = append(items, &listItem{name: filepath.Base(p.Path), kinds: p.Kinds, value: p})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].name < items[j].name })
+
+	result := []interface{}{}
+	for _, item := range q.page(w, items) {
+		selected, err := q.selectFields(item.value)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, selected)
+	}
+
+	buff, err := yaml.Marshal(result)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", result, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func (s *Server) unloadPluginKind(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+
+	if goplugin.Global == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("plugins are disabled"))
+		return
+	}
+
+	err := goplugin.Global.UnloadKind(kind)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusNotFound, err)
+		return
+	}
+}
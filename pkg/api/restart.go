@@ -0,0 +1,642 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// RestartPrefix is the prefix of rolling restarts.
+	RestartPrefix = "/restarts"
+
+	restartStateRunning   = "running"
+	restartStateCompleted = "completed"
+	restartStateAborted   = "aborted"
+
+	restartMemberPending    = "pending"
+	restartMemberRestarting = "restarting"
+	restartMemberDraining   = "draining"
+	restartMemberHealthy    = "healthy"
+	restartMemberFailed     = "failed"
+
+	defaultRestartTimeout  = 5 * time.Minute
+	maxRestartTimeout      = 30 * time.Minute
+	restartPollInterval    = time.Second
+	restartRewatchInterval = 5 * time.Second
+	// restartRecords is the number of records of rolling restarts kept.
+	restartRecords = 20
+)
+
+var (
+	// processStartTime tells the process started by a rolling restart
+	// from the one it takes over.
+	processStartTime = time.Now()
+
+	// restartTriggered is the rolling restart which this process has
+	// gracefully updated itself for, and the server which did it. The
+	// server is recreated in the same process if the update failed.
+	restartTriggered struct {
+		sync.Mutex
+		id     string
+		server *Server
+	}
+
+	errRestartInterrupted = errors.New("server closed")
+)
+
+type (
+	// Restart is a rolling restart of members. They're gracefully updated
+	// one by one, and the next one isn't restarted until the previous one
+	// has drained the old process, rejoined the cluster and become
+	// healthy. The rest are left untouched if any fails.
+	Restart struct {
+		ID    string `yaml:"id"`
+		Time  string `yaml:"time"`
+		Actor string `yaml:"actor"`
+		State string `yaml:"state"`
+		Error string `yaml:"error,omitempty"`
+		// Coordinator is the member driving the restart, it's restarted
+		// last and its new process finishes the restart.
+		Coordinator string `yaml:"coordinator"`
+		// Timeout is how long every member has to become healthy, and
+		// the restart is taken as lost after the deadline.
+		Timeout  string           `yaml:"timeout"`
+		Deadline string           `yaml:"deadline"`
+		Members  []*RestartMember `yaml:"members"`
+	}
+
+	// RestartMember is the progress of restarting a member.
+	RestartMember struct {
+		Name  string `yaml:"name"`
+		State string `yaml:"state"`
+		// RFC3339Nano format, it tells the new process from the old one.
+		RequestedAt string `yaml:"requestedAt,omitempty"`
+		FinishedAt  string `yaml:"finishedAt,omitempty"`
+		Error       string `yaml:"error,omitempty"`
+	}
+
+	// restartReport is reported by the member being restarted.
+	restartReport struct {
+		Name  string `yaml:"name"`
+		State string `yaml:"state"`
+		Error string `yaml:"error,omitempty"`
+	}
+)
+
+func (s *Server) setupRestartAPIs() {
+	restartAPIs := []*APIEntry{
+		{
+			Path:    RestartPrefix,
+			Method:  "POST",
+			Handler: s.createRestart,
+		},
+		{
+			Path:    RestartPrefix,
+			Method:  "GET",
+			Handler: s.listRestarts,
+		},
+		{
+			Path:    RestartPrefix + "/{id}",
+			Method:  "GET",
+			Handler: s.getRestart,
+		},
+	}
+
+	s.RegisterAPIs(restartAPIs)
+
+	go s.watchRestarts()
+}
+
+// createRestart starts a rolling restart of all live members in the
+// background and returns it, the query timeout is how long every member
+// has to become healthy.
+func (s *Server) createRestart(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultRestartTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		var err error
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout <= 0 || timeout > maxRestartTimeout {
+			HandleAPIError(w, r, http.StatusBadRequest,
+				fmt.Errorf("invalid timeout %s, it must be within %s", v, maxRestartTimeout))
+			return
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	running, err := s.getRunningRestart()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if running != nil {
+		if deadline, _ := time.Parse(time.RFC3339, running.Deadline); time.Now().Before(deadline) {
+			HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("restart %s is in progress", running.ID))
+			return
+		}
+		// NOTE: The coordinator is lost, it would have finished it.
+		running.Error = "not finished before the deadline"
+		if err := s.finishRestart(running); err != nil {
+			ClusterPanic(err)
+		}
+	}
+
+	members := restartOrder(s.liveMembers(), s.opt.Name)
+	now := time.Now()
+	rs := &Restart{
+		ID:          strconv.FormatInt(now.UnixNano(), 10),
+		Time:        now.Format(time.RFC3339),
+		Actor:       principalOf(r),
+		State:       restartStateRunning,
+		Coordinator: s.opt.Name,
+		Timeout:     timeout.String(),
+		Deadline:    now.Add(time.Duration(len(members)+1) * timeout).Format(time.RFC3339),
+	}
+	for _, name := range members {
+		rs.Members = append(rs.Members, &RestartMember{Name: name, State: restartMemberPending})
+	}
+	if err := s.putRunningRestart(rs); err != nil {
+		ClusterPanic(err)
+	}
+
+	go s.runRestart(rs)
+
+	writeYAML(w, rs)
+}
+
+// restartOrder returns the members in the order of restarting, the
+// coordinator is the last, since it can't watch others after that.
+func restartOrder(members []string, coordinator string) []string {
+	order := make([]string, 0, len(members))
+	for _, name := range members {
+		if name != coordinator {
+			order = append(order, name)
+		}
+	}
+	return append(order, coordinator)
+}
+
+// runRestart restarts the members one by one. It returns after requesting
+// to restart this member, the new process resumes the restart.
+func (s *Server) runRestart(rs *Restart) {
+	timeout, _ := time.ParseDuration(rs.Timeout)
+
+	for _, m := range rs.Members {
+		if m.State == restartMemberHealthy {
+			continue
+		}
+
+		if m.State == restartMemberPending {
+			m.State = restartMemberRestarting
+			m.RequestedAt = time.Now().Format(time.RFC3339Nano)
+			if err := s.putRunningRestart(rs); err != nil {
+				logger.Errorf("request restart of %s failed: %v", m.Name, err)
+				m.State, m.Error = restartMemberFailed, err.Error()
+			} else if m.Name == s.opt.Name {
+				return
+			}
+		}
+
+		if m.State != restartMemberFailed {
+			err := s.waitRestartMember(rs, m, timeout)
+			if err == errRestartInterrupted {
+				// NOTE: The coordinator resumes it after it's up again.
+				return
+			}
+			if err != nil {
+				m.State, m.Error = restartMemberFailed, err.Error()
+			}
+		}
+
+		if m.State == restartMemberFailed {
+			rs.Error = fmt.Sprintf("restart %s failed: %s", m.Name, m.Error)
+			break
+		}
+	}
+
+	if err := s.finishRestart(rs); err != nil {
+		logger.Errorf("finish restart %s failed: %v", rs.ID, err)
+	}
+}
+
+// waitRestartMember waits for the member to report it's healthy until the
+// timeout since it's requested.
+func (s *Server) waitRestartMember(rs *Restart, m *RestartMember, timeout time.Duration) error {
+	requestedAt, _ := time.Parse(time.RFC3339Nano, m.RequestedAt)
+
+	for {
+		// NOTE: The cluster may be unavailable for a moment while the
+		// member is a writer, so errors are retried until the timeout.
+		reports, err := s.getRestartReports(rs.ID)
+		if err != nil {
+			logger.Warnf("get reports of restart %s failed: %v", rs.ID, err)
+		} else if report := reports[m.Name]; report != nil {
+			changed, err := applyRestartReport(m, report)
+			if err != nil {
+				return err
+			}
+			if changed {
+				if err := s.putRunningRestart(rs); err != nil {
+					logger.Warnf("update restart %s failed: %v", rs.ID, err)
+				}
+			}
+			if m.State == restartMemberHealthy {
+				return nil
+			}
+		}
+
+		if time.Since(requestedAt) > timeout {
+			return fmt.Errorf("not healthy in %s", timeout)
+		}
+
+		select {
+		case <-s.events.done:
+			return errRestartInterrupted
+		case <-time.After(restartPollInterval):
+		}
+	}
+}
+
+// applyRestartReport updates the progress of the member by its report,
+// it returns if the progress is changed, or the error the member failed
+// with.
+func applyRestartReport(m *RestartMember, report *restartReport) (bool, error) {
+	switch report.State {
+	case restartMemberFailed:
+		return false, errors.New(report.Error)
+	case restartMemberDraining, restartMemberHealthy:
+		if m.State == report.State {
+			return false, nil
+		}
+		m.State = report.State
+		if m.State == restartMemberHealthy {
+			m.FinishedAt = time.Now().Format(time.RFC3339)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// finishRestart records the restart, and removes the running one and the
+// reports of it.
+func (s *Server) finishRestart(rs *Restart) error {
+	if rs.Error != "" {
+		rs.State = restartStateAborted
+		logger.Errorf("restart %s aborted: %s", rs.ID, rs.Error)
+	} else {
+		rs.State = restartStateCompleted
+		logger.Infof("restart %s completed", rs.ID)
+	}
+
+	buff, err := yaml.Marshal(rs)
+	if err != nil {
+		return fmt.Errorf("marshal %#v to yaml failed: %v", rs, err)
+	}
+	err = s.cluster.Put(s.cluster.Layout().RestartKey(rs.ID), string(buff))
+	if err != nil {
+		return err
+	}
+	err = s.cluster.Delete(s.cluster.Layout().RestartRunningKey())
+	if err != nil {
+		return err
+	}
+	err = s.cluster.DeletePrefix(s.cluster.Layout().StatusRestartPrefix(rs.ID))
+	if err != nil {
+		return err
+	}
+
+	restarts, err := s.getRestarts()
+	if err != nil {
+		return err
+	}
+	for len(restarts) > restartRecords {
+		err := s.cluster.Delete(s.cluster.Layout().RestartKey(restarts[0].ID))
+		if err != nil {
+			return err
+		}
+		restarts = restarts[1:]
+	}
+
+	return nil
+}
+
+// watchRestarts restarts this member as the running restart requests
+// until the server is closed, and resumes the restart if this member is
+// the coordinator of it.
+func (s *Server) watchRestarts() {
+	rs, err := s.getRunningRestart()
+	if err != nil {
+		logger.Errorf("get running restart failed: %v", err)
+	} else if rs != nil && rs.Coordinator == s.opt.Name {
+		logger.Infof("resume restart %s", rs.ID)
+		go s.runRestart(rs)
+	}
+
+	for {
+		s.watchRestartsOnce()
+
+		select {
+		case <-s.events.done:
+			return
+		case <-time.After(restartRewatchInterval):
+		}
+	}
+}
+
+func (s *Server) watchRestartsOnce() {
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		logger.Errorf("get cluster watcher failed: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	ch, err := watcher.Watch(s.cluster.Layout().RestartRunningKey())
+	if err != nil {
+		logger.Errorf("watch restarts failed: %v", err)
+		return
+	}
+
+	// NOTE: The restart could be requested before watching.
+	value, err := s.cluster.Get(s.cluster.Layout().RestartRunningKey())
+	if err != nil {
+		logger.Errorf("get running restart failed: %v", err)
+	} else if value != nil {
+		s.handleRestart(*value)
+	}
+
+	for {
+		select {
+		case <-s.events.done:
+			return
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			if value != nil {
+				s.handleRestart(*value)
+			}
+		}
+	}
+}
+
+// handleRestart restarts this member if the restart requests it, or
+// reports the progress if this process has been restarted by it.
+func (s *Server) handleRestart(value string) {
+	rs := &Restart{}
+	err := yaml.Unmarshal([]byte(value), rs)
+	if err != nil {
+		logger.Errorf("unmarshal restart %s failed: %v", value, err)
+		return
+	}
+	if rs.State != restartStateRunning {
+		return
+	}
+
+	var m *RestartMember
+	for _, member := range rs.Members {
+		if member.Name == s.opt.Name {
+			m = member
+		}
+	}
+	if m == nil || (m.State != restartMemberRestarting && m.State != restartMemberDraining) {
+		return
+	}
+
+	requestedAt, err := time.Parse(time.RFC3339Nano, m.RequestedAt)
+	if err != nil {
+		logger.Errorf("invalid requested time of restart %s: %s", rs.ID, m.RequestedAt)
+		return
+	}
+	if processStartTime.After(requestedAt) {
+		s.reportRestart(rs.ID)
+		return
+	}
+
+	restartTriggered.Lock()
+	defer restartTriggered.Unlock()
+
+	if restartTriggered.id == rs.ID {
+		if restartTriggered.server != s {
+			s.putRestartReport(rs.ID, restartMemberFailed, "graceful update failed")
+		}
+		return
+	}
+
+	logger.Infof("gracefully update for restart %s", rs.ID)
+	restartTriggered.id, restartTriggered.server = rs.ID, s
+	if err := graceupdate.Update(); err != nil {
+		s.putRestartReport(rs.ID, restartMemberFailed, fmt.Sprintf("graceful update failed: %v", err))
+	}
+}
+
+// reportRestart reports the progress of this new process in the
+// background, it's draining until the old process has exited, and it's
+// healthy after that, if it has created all objects and rejoined the
+// cluster.
+func (s *Server) reportRestart(id string) {
+	restartTriggered.Lock()
+	defer restartTriggered.Unlock()
+
+	if restartTriggered.id == id {
+		return
+	}
+	restartTriggered.id, restartTriggered.server = id, s
+
+	go func() {
+		if supervisor.Global != nil {
+			select {
+			case <-supervisor.Global.FirstHandleDone():
+			case <-s.events.done:
+				return
+			}
+		}
+		s.putRestartReport(id, restartMemberDraining, "")
+
+		for !graceupdate.OriProcessExited() || !s.heartbeatSince(processStartTime) {
+			select {
+			case <-s.events.done:
+				return
+			case <-time.After(restartPollInterval):
+			}
+		}
+		s.putRestartReport(id, restartMemberHealthy, "")
+	}()
+}
+
+// heartbeatSince returns if the status of this member has been synced to
+// the cluster since the time.
+func (s *Server) heartbeatSince(t time.Time) bool {
+	value, err := s.cluster.Get(s.cluster.Layout().StatusMemberKey())
+	if err != nil || value == nil {
+		return false
+	}
+
+	status := &cluster.MemberStatus{}
+	if err := yaml.Unmarshal([]byte(*value), status); err != nil {
+		return false
+	}
+	heartbeat, err := time.Parse(time.RFC3339, status.LastHeartbeatTime)
+	// NOTE: The heartbeat time is in seconds.
+	return err == nil && !heartbeat.Before(t.Truncate(time.Second))
+}
+
+func (s *Server) putRestartReport(id, state, errMsg string) {
+	report := &restartReport{Name: s.opt.Name, State: state, Error: errMsg}
+	buff, err := yaml.Marshal(report)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to yaml failed: %v", report, err)
+		return
+	}
+	err = s.cluster.Put(s.cluster.Layout().StatusRestartKey(id), string(buff))
+	if err != nil {
+		logger.Errorf("report restart %s failed: %v", id, err)
+	}
+}
+
+func (s *Server) listRestarts(w http.ResponseWriter, r *http.Request) {
+	// No need to lock.
+
+	restarts, err := s.getRestarts()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	running, err := s.getRunningRestart()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if running != nil {
+		restarts = append(restarts, running)
+	}
+
+	writeYAML(w, restarts)
+}
+
+func (s *Server) getRestart(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	// No need to lock.
+
+	rs, err := s.getRunningRestart()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if rs == nil || rs.ID != id {
+		value, err := s.cluster.Get(s.cluster.Layout().RestartKey(id))
+		if err != nil {
+			ClusterPanic(err)
+		}
+		if value == nil {
+			HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+			return
+		}
+		rs = &Restart{}
+		if err := yaml.Unmarshal([]byte(*value), rs); err != nil {
+			panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+		}
+	}
+
+	writeYAML(w, rs)
+}
+
+// The helpers below return errors rather than panicking like the ones in
+// cluster.go, since restarts run in the background.
+
+func (s *Server) getRunningRestart() (*Restart, error) {
+	value, err := s.cluster.Get(s.cluster.Layout().RestartRunningKey())
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	rs := &Restart{}
+	err = yaml.Unmarshal([]byte(*value), rs)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err)
+	}
+
+	return rs, nil
+}
+
+func (s *Server) putRunningRestart(rs *Restart) error {
+	buff, err := yaml.Marshal(rs)
+	if err != nil {
+		return fmt.Errorf("marshal %#v to yaml failed: %v", rs, err)
+	}
+
+	return s.cluster.Put(s.cluster.Layout().RestartRunningKey(), string(buff))
+}
+
+// getRestarts returns the records of finished restarts, the earliest
+// first.
+func (s *Server) getRestarts() ([]*Restart, error) {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().RestartPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	restarts := make([]*Restart, 0, len(kvs))
+	for _, v := range kvs {
+		rs := &Restart{}
+		err := yaml.Unmarshal([]byte(v), rs)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", v, err)
+		}
+		restarts = append(restarts, rs)
+	}
+	sort.Slice(restarts, func(i, j int) bool {
+		return restarts[i].ID < restarts[j].ID
+	})
+
+	return restarts, nil
+}
+
+// getRestartReports returns the reports of the restart, the keys are the
+// member names.
+func (s *Server) getRestartReports(id string) (map[string]*restartReport, error) {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().StatusRestartPrefix(id))
+	if err != nil {
+		return nil, err
+	}
+
+	reports := map[string]*restartReport{}
+	for _, v := range kvs {
+		report := &restartReport{}
+		err := yaml.Unmarshal([]byte(v), report)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", v, err)
+		}
+		reports[report.Name] = report
+	}
+
+	return reports, nil
+}
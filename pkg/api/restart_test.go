@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRestartOrder(t *testing.T) {
+	order := restartOrder([]string{"a", "b", "c"}, "b")
+	if want := []string{"a", "c", "b"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("want %v, got %v", want, order)
+	}
+
+	order = restartOrder([]string{"a"}, "a")
+	if want := []string{"a"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("want %v, got %v", want, order)
+	}
+}
+
+func TestApplyRestartReport(t *testing.T) {
+	m := &RestartMember{Name: "a", State: restartMemberRestarting}
+
+	changed, err := applyRestartReport(m, &restartReport{Name: "a", State: restartMemberDraining})
+	if !changed || err != nil || m.State != restartMemberDraining {
+		t.Errorf("want draining, got %+v, %v", m, err)
+	}
+	changed, err = applyRestartReport(m, &restartReport{Name: "a", State: restartMemberDraining})
+	if changed || err != nil {
+		t.Errorf("want unchanged, got %+v, %v", m, err)
+	}
+
+	changed, err = applyRestartReport(m, &restartReport{Name: "a", State: restartMemberHealthy})
+	if !changed || err != nil || m.State != restartMemberHealthy || m.FinishedAt == "" {
+		t.Errorf("want healthy, got %+v, %v", m, err)
+	}
+
+	_, err = applyRestartReport(m, &restartReport{Name: "a", State: restartMemberFailed, Error: "graceful update failed"})
+	if err == nil || err.Error() != "graceful update failed" {
+		t.Errorf("want error, got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	yamljsontool "github.com/ghodss/yaml"
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const (
+	// SchemaPrefix is the prefix of JSON schemas of kinds of objects and
+	// filters.
+	SchemaPrefix = "/schemas"
+)
+
+type (
+	// Schemas are the JSON schemas of all kinds registered, keyed by kinds.
+	Schemas struct {
+		Objects map[string]map[string]interface{} `yaml:"objects" json:"objects"`
+		Filters map[string]map[string]interface{} `yaml:"filters" json:"filters"`
+	}
+)
+
+func (s *Server) setupSchemaAPIs() {
+	schemaAPIs := []*APIEntry{
+		{
+			Path:    SchemaPrefix,
+			Method:  "GET",
+			Handler: s.listSchemas,
+		},
+		{
+			Path:    SchemaPrefix + "/objects/{kind}",
+			Method:  "GET",
+			Handler: s.getObjectSchema,
+		},
+		{
+			Path:    SchemaPrefix + "/filters/{kind}",
+			Method:  "GET",
+			Handler: s.getFilterJSONSchema,
+		},
+	}
+
+	s.RegisterAPIs(schemaAPIs)
+}
+
+// objectSchema returns the JSON schema of the whole spec of the object kind.
+func objectSchema(kind string) (map[string]interface{}, bool) {
+	defaultSpec, exists := supervisor.ObjectDefaultSpec(kind)
+	if !exists {
+		return nil, false
+	}
+
+	schema, err := specSchema(kind, defaultSpec)
+	if err != nil {
+		panic(fmt.Errorf("get schema of %s failed: %v", kind, err))
+	}
+	root, _ := schemaRoot(schema)
+	root["properties"].(map[string]interface{})["namespace"] = map[string]interface{}{
+		"type": "string", "format": "urlname",
+	}
+	return schema, true
+}
+
+// filterSchema returns the JSON schema of the whole spec of the filter
+// kind in pipelines, with its description and results.
+func filterSchema(kind string) (map[string]interface{}, bool) {
+	f, exists := httppipeline.GetFilterRegistry()[kind]
+	if !exists {
+		return nil, false
+	}
+
+	schema, err := specSchema(kind, f.DefaultSpec())
+	if err != nil {
+		panic(fmt.Errorf("get schema of %s failed: %v", kind, err))
+	}
+	if f.Description() != "" {
+		schema["description"] = f.Description()
+	}
+	schema["x-results"] = append([]string{}, f.Results()...)
+	return schema, true
+}
+
+// specSchema returns the JSON schema of the spec, with the name and kind
+// of the spec, and the non-zero fields of the default spec as defaults.
+func specSchema(kind string, defaultSpec interface{}) (map[string]interface{}, error) {
+	buff, err := v.GetSchemaInJSON(reflect.TypeOf(defaultSpec))
+	if err != nil {
+		return nil, err
+	}
+	schema := map[string]interface{}{}
+	err = json.Unmarshal(buff, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal schema failed: %v", err)
+	}
+
+	root, err := schemaRoot(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	properties, _ := root["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = map[string]interface{}{}
+		root["properties"] = properties
+	}
+	properties["name"] = map[string]interface{}{"type": "string", "format": "urlname"}
+	properties["kind"] = map[string]interface{}{"type": "string", "enum": []string{kind}}
+	required := []interface{}{"name", "kind"}
+	if r, ok := root["required"].([]interface{}); ok {
+		required = append(required, r...)
+	}
+	root["required"] = required
+
+	defaults, err := specDefaults(defaultSpec)
+	if err != nil {
+		return nil, err
+	}
+	for field, value := range defaults {
+		if property, ok := properties[field].(map[string]interface{}); ok && !isZeroJSON(value) {
+			property["default"] = value
+		}
+	}
+
+	return schema, nil
+}
+
+// schemaRoot returns the schema of the root object, the schema of a
+// struct refers to its definition.
+func schemaRoot(schema map[string]interface{}) (map[string]interface{}, error) {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema, nil
+	}
+
+	definitions, _ := schema["definitions"].(map[string]interface{})
+	root, _ := definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	if root == nil {
+		return nil, fmt.Errorf("definition %s not found", ref)
+	}
+	return root, nil
+}
+
+func specDefaults(defaultSpec interface{}) (map[string]interface{}, error) {
+	buff, err := yaml.Marshal(defaultSpec)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %#v to yaml failed: %v", defaultSpec, err)
+	}
+	buff, err = yamljsontool.YAMLToJSON(buff)
+	if err != nil {
+		return nil, fmt.Errorf("transform yaml %s to json failed: %v", buff, err)
+	}
+
+	defaults := map[string]interface{}{}
+	err = json.Unmarshal(buff, &defaults)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s failed: %v", buff, err)
+	}
+	return defaults, nil
+}
+
+func isZeroJSON(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case float64:
+		return value == 0
+	case bool:
+		return !value
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	}
+	return false
+}
+
+// writeSchema writes v in JSON, or YAML if the request asks for it.
+func writeSchema(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if strings.Contains(r.Header.Get("Accept"), "yaml") {
+		writeYAML(w, v)
+		return
+	}
+
+	buff, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to json failed: %v", v, err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buff)
+}
+
+func (s *Server) listSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := &Schemas{
+		Objects: map[string]map[string]interface{}{},
+		Filters: map[string]map[string]interface{}{},
+	}
+	for _, kind := range supervisor.ObjectKinds() {
+		schemas.Objects[kind], _ = objectSchema(kind)
+	}
+	for _, kind := range filterKinds() {
+		// NOTE: The filter may be unregistered by plugins in between.
+		if schema, exists := filterSchema(kind); exists {
+			schemas.Filters[kind] = schema
+		}
+	}
+
+	writeSchema(w, r, schemas)
+}
+
+func (s *Server) getObjectSchema(w http.ResponseWriter, r *http.Request) {
+	schema, exists := objectSchema(chi.URLParam(r, "kind"))
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	writeSchema(w, r, schema)
+}
+
+func (s *Server) getFilterJSONSchema(w http.ResponseWriter, r *http.Request) {
+	schema, exists := filterSchema(chi.URLParam(r, "kind"))
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	writeSchema(w, r, schema)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+type schemaTestSpec struct {
+	Port    int      `yaml:"port" jsonschema:"required,minimum=1"`
+	Timeout string   `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+	Hosts   []string `yaml:"hosts" jsonschema:"omitempty"`
+}
+
+func TestSpecSchema(t *testing.T) {
+	schema, err := specSchema("SchemaTest", &schemaTestSpec{Port: 80})
+	if err != nil {
+		t.Fatalf("get schema failed: %v", err)
+	}
+
+	root := schema["definitions"].(map[string]interface{})["api.schemaTestSpec"].(map[string]interface{})
+	required := root["required"].([]interface{})
+	if !reflect.DeepEqual(required, []interface{}{"name", "kind", "port"}) {
+		t.Errorf("unexpected required fields %v", required)
+	}
+
+	properties := root["properties"].(map[string]interface{})
+	kind := properties["kind"].(map[string]interface{})
+	if !reflect.DeepEqual(kind["enum"], []string{"SchemaTest"}) {
+		t.Errorf("unexpected kind %v", kind)
+	}
+	port := properties["port"].(map[string]interface{})
+	if port["default"] != float64(80) || port["minimum"] != float64(1) {
+		t.Errorf("unexpected port %v", port)
+	}
+	if _, exists := properties["timeout"].(map[string]interface{})["default"]; exists {
+		t.Errorf("zero value as default of timeout")
+	}
+}
@@ -19,13 +19,16 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
+	"github.com/megaease/easegress/pkg/audit"
 	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
@@ -36,6 +39,7 @@ type (
 	Server struct {
 		opt       option.Options
 		srv       http.Server
+		grpcSrv   *grpc.Server
 		router    *chi.Mux
 		cluster   cluster.Cluster
 		apisMutex sync.RWMutex
@@ -43,6 +47,11 @@ type (
 
 		mutex      cluster.Mutex
 		mutexMutex sync.Mutex
+
+		auditLog   *audit.Log
+		authConfig *AuthConfig
+		tlsConfig  *tls.Config
+		events     *eventBroker
 	}
 
 	// APIEntry is the entry of API.
@@ -63,13 +72,21 @@ func MustNewServer(opt *option.Options, cluster cluster.Cluster) *Server {
 	r := chi.NewRouter()
 
 	s := &Server{
-		srv:     http.Server{Addr: opt.APIAddr, Handler: r},
-		router:  r,
-		cluster: cluster,
+		opt:      *opt,
+		srv:      http.Server{Addr: opt.APIAddr, Handler: r},
+		router:   r,
+		cluster:  cluster,
+		auditLog: openAuditLog(opt),
+		events:   newEventBroker(),
 	}
+	s.authConfig = loadAPIAuthConfig(opt.AbsAPIAuthFile)
+	s.tlsConfig = loadAPITLSConfig(opt, s.authConfig != nil)
+	s.srv.TLSConfig = s.tlsConfig
 
 	r.Use(s.newAPILogger)
 	r.Use(s.newConfigVersionAttacher)
+	r.Use(s.newAuditor)
+	r.Use(s.newAuthenticator)
 	r.Use(s.newRecoverer)
 
 	_, err := s.getMutex()
@@ -78,8 +95,14 @@ func MustNewServer(opt *option.Options, cluster cluster.Cluster) *Server {
 	}
 
 	s.setupAPIs()
+	s.startGRPCServer()
 
 	go func() {
+		if s.tlsConfig != nil {
+			logger.Infof("api server running in %s over tls", opt.APIAddr)
+			s.srv.ListenAndServeTLS("", "")
+			return
+		}
 		logger.Infof("api server running in %s", opt.APIAddr)
 		s.srv.ListenAndServe()
 	}()
@@ -97,9 +120,19 @@ func (s *Server) Close(wg *sync.WaitGroup) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Close the event streams first, they never end otherwise.
+	s.events.close()
+
 	if err := s.srv.Shutdown(ctx); err != nil {
 		logger.Errorf("Could not gracefully shutdown the server", zap.Error(err))
 	}
+	if s.grpcSrv != nil {
+		s.grpcSrv.Stop()
+	}
+
+	if s.auditLog != nil {
+		s.auditLog.Close()
+	}
 
 	logger.Infof("Server stopped")
 }
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/filter/splitter"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func (s *Server) setupSplitterAPIs() {
+	splitterAPIs := []*APIEntry{
+		{
+			Path:    ObjectPrefix + "/{name}/splitters/{filter}/weights",
+			Method:  "PUT",
+			Handler: s.updateSplitterWeights,
+		},
+	}
+
+	s.RegisterAPIs(splitterAPIs)
+}
+
+// updateSplitterWeights updates weights of branches of a Splitter in the
+// spec of the pipeline, so the weights are updated in the whole cluster.
+func (s *Server) updateSplitterWeights(w http.ResponseWriter, r *http.Request) {
+	name, filter := chi.URLParam(r, "name"), chi.URLParam(r, "filter")
+	if !authorizeObject(w, r, name) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+
+	weights := map[string]int{}
+	err = yaml.Unmarshal(body, &weights)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal weights failed: %v", err))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	spec := s._getObject(name)
+	if spec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if spec.Kind() != httppipeline.Kind {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not a %s", name, httppipeline.Kind))
+		return
+	}
+
+	config := map[string]interface{}{}
+	err = yaml.Unmarshal([]byte(spec.YAMLConfig()), &config)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("unmarshal spec failed: %v", err))
+		return
+	}
+
+	err = setSplitterWeights(config, filter, weights)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	buff, err := yaml.Marshal(config)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("marshal spec failed: %v", err))
+		return
+	}
+
+	newSpec, err := supervisor.NewSpec(string(buff))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	newSpec, err = encryptSpec(newSpec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	newSpec, err = s._putVersionedObject(w, r, newSpec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	s.auditObject(r, spec.Kind(), name, spec.YAMLConfig(), newSpec.YAMLConfig())
+}
+
+func setSplitterWeights(config map[string]interface{}, filter string, weights map[string]int) error {
+	filters, _ := config["filters"].([]interface{})
+	for _, f := range filters {
+		f, ok := f.(map[interface{}]interface{})
+		if !ok || f["name"] != filter {
+			continue
+		}
+
+		if f["kind"] != splitter.Kind {
+			return fmt.Errorf("filter %s is not a %s", filter, splitter.Kind)
+		}
+
+		found := map[string]struct{}{}
+		branches, _ := f["branches"].([]interface{})
+		for _, b := range branches {
+			b, ok := b.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := b["name"].(string)
+			if weight, exists := weights[name]; exists {
+				b["weight"] = weight
+				found[name] = struct{}{}
+			}
+		}
+
+		for name := range weights {
+			if _, exists := found[name]; !exists {
+				return fmt.Errorf("branch %s not found", name)
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("filter %s not found", filter)
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/audit"
+	"github.com/megaease/easegress/pkg/certstore"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// ownedConfig is the config synced by an owner from external sources.
+type ownedConfig struct {
+	Objects      []string `yaml:"objects"`
+	Certificates []string `yaml:"certificates,omitempty"`
+}
+
+// SyncSpecs makes the objects owned by the owner the same as the specs in
+// the YAML documents of the body, it's used by objects syncing config from
+// external sources, and the owner is the principal of the audit record.
+// The missing objects are created, the different ones are updated, and the
+// ones owned before but not in the body are deleted, others are never
+// deleted.
+func (s *Server) SyncSpecs(owner string, body []byte) (*ApplyPlan, error) {
+	specs, err := readSpecs(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan *ApplyPlan
+	err = s.syncOwned(owner, func(owned *ownedConfig) error {
+		names := map[string]struct{}{}
+		for _, name := range owned.Objects {
+			names[name] = struct{}{}
+		}
+		plan, err = s._planApply(specs, func(name string) bool {
+			_, exists := names[name]
+			return exists
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, change := range plan.Changes {
+			err = s._applyChange(nil, nil, change)
+			if err != nil {
+				return fmt.Errorf("%s %s failed: %v", change.Action, change.Name, err)
+			}
+			s.publishEvent(owner, change.Action, change.Kind, change.Name, change.Diff)
+		}
+		plan.Applied = true
+		s._recordRevision(owner, 0, plan.Changes)
+
+		owned.Objects = owned.Objects[:0]
+		for _, spec := range specs {
+			owned.Objects = append(owned.Objects, spec.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plan.Changes) != 0 {
+		s.auditSync(owner, planDiff(plan))
+	}
+	return plan, nil
+}
+
+// SyncCertificates makes the certificates owned by the owner the same as
+// the given ones like SyncSpecs, it returns the names of the changed ones.
+func (s *Server) SyncCertificates(owner string, certificates []*certstore.Certificate) ([]string, error) {
+	var changed []string
+	err := s.syncOwned(owner, func(owned *ownedConfig) error {
+		desired := map[string]struct{}{}
+		for _, c := range certificates {
+			desired[c.Name] = struct{}{}
+			prev := s._getCertificate(c.Name)
+			if prev != nil && prev.CertBase64 == c.CertBase64 &&
+				prev.KeyBase64 == c.KeyBase64 && prev.AlertBefore == c.AlertBefore {
+				continue
+			}
+			s._putCertificate(c)
+			changed = append(changed, c.Name)
+		}
+
+		for _, name := range owned.Certificates {
+			if _, exists := desired[name]; exists {
+				continue
+			}
+			if s._getCertificate(name) != nil {
+				s._deleteCertificate(name)
+				changed = append(changed, name)
+			}
+		}
+
+		if len(changed) != 0 {
+			s.upgradeConfigVersion(nil, nil)
+		}
+
+		owned.Certificates = owned.Certificates[:0]
+		for name := range desired {
+			owned.Certificates = append(owned.Certificates, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changed) != 0 {
+		sort.Strings(changed)
+		s.auditSync(owner, fmt.Sprintf("certificates %v\n", changed))
+	}
+	return changed, nil
+}
+
+// syncOwned calls fn to sync the config owned by the owner, and stores
+// the owned config changed by fn.
+func (s *Server) syncOwned(owner string, fn func(owned *ownedConfig) error) (err error) {
+	// NOTE: All members sync the same sources, the mutex serializes them,
+	// so the later ones have nothing to change.
+	mutex, err := s.cluster.Mutex(s.cluster.Layout().ConfigOwnerLock(owner))
+	if err != nil {
+		return fmt.Errorf("get mutex failed: %v", err)
+	}
+	err = mutex.Lock()
+	if err != nil {
+		return fmt.Errorf("lock mutex failed: %v", err)
+	}
+	defer mutex.Unlock()
+
+	s.Lock()
+	defer s.Unlock()
+
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			if ce, ok := rvr.(clusterErr); ok {
+				err = fmt.Errorf("cluster error: %s", ce)
+				return
+			}
+			panic(rvr)
+		}
+	}()
+
+	owned := s._getOwnedConfig(owner)
+	err = fn(owned)
+	if err != nil {
+		return err
+	}
+	s._putOwnedConfig(owner, owned)
+
+	return nil
+}
+
+func (s *Server) _getOwnedConfig(owner string) *ownedConfig {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigOwnerKey(owner))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	owned := &ownedConfig{}
+	if value == nil {
+		return owned
+	}
+
+	err = yaml.Unmarshal([]byte(*value), owned)
+	if err != nil {
+		// NOTE: Compatible with the list of object names stored before.
+		err = yaml.Unmarshal([]byte(*value), &owned.Objects)
+	}
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err))
+	}
+
+	return owned
+}
+
+func (s *Server) _putOwnedConfig(owner string, owned *ownedConfig) {
+	sort.Strings(owned.Objects)
+	sort.Strings(owned.Certificates)
+	buff, err := yaml.Marshal(owned)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", owned, err))
+	}
+
+	err = s.cluster.Put(s.cluster.Layout().ConfigOwnerKey(owner), string(buff))
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+// auditSync records the changes synced by the owner, there is no request.
+func (s *Server) auditSync(owner, diff string) {
+	if s.auditLog == nil {
+		return
+	}
+
+	record := &audit.Record{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Member:    s.opt.Name,
+		Principal: owner,
+		Action:    "sync",
+		Diff:      diff,
+	}
+	err := s.auditLog.Append(record)
+	if err != nil {
+		logger.Errorf("append audit record failed: %v", err)
+	}
+}
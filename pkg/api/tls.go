@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+// loadAPITLSConfig loads the TLS config of the admin API, it's nil if the
+// admin API is served in plaintext. If the client CA is set, client
+// certificates are verified if given, so users could be authenticated by
+// either bearer tokens or certificates, and they're required if there's
+// no auth file, or anyone could change everything.
+func loadAPITLSConfig(opt *option.Options, authEnabled bool) *tls.Config {
+	if opt.AbsAPITLSCertFile == "" {
+		if !isLoopbackAddr(opt.APIAddr) {
+			logger.Warnf("the admin API on %s is served in plaintext, set api-tls-cert-file to serve it over TLS", opt.APIAddr)
+		}
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(opt.AbsAPITLSCertFile, opt.AbsAPITLSKeyFile)
+	if err != nil {
+		panic(fmt.Errorf("load api tls certificate failed: %v", err))
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if opt.AbsAPITLSClientCAFile == "" {
+		return config
+	}
+
+	buff, err := ioutil.ReadFile(opt.AbsAPITLSClientCAFile)
+	if err != nil {
+		panic(fmt.Errorf("read api tls client ca failed: %v", err))
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buff) {
+		panic(fmt.Errorf("no certificate in api tls client ca %s", opt.AbsAPITLSClientCAFile))
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if !authEnabled {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config
+}
+
+// isLoopbackAddr reports whether the host of the address is a loopback
+// one, which can't be reached by others.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/option"
+)
+
+// writeCertificate writes a self-signed certificate of the common name
+// and its key to the dir, and returns their paths.
+func writeCertificate(t *testing.T, dir, cn string) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	certFile, keyFile := filepath.Join(dir, cn+".crt"), filepath.Join(dir, cn+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestAPITLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := writeCertificate(t, dir, "server")
+	clientCert, clientKey := writeCertificate(t, dir, "dashboard.example.com")
+
+	opt := &option.Options{APIAddr: "localhost:2381"}
+	if loadAPITLSConfig(opt, false) != nil {
+		t.Fatalf("want nil config without certificate")
+	}
+
+	opt.AbsAPITLSCertFile, opt.AbsAPITLSKeyFile = serverCert, serverKey
+	if config := loadAPITLSConfig(opt, false); config.ClientAuth != tls.NoClientCert {
+		t.Errorf("want no client certificates without client ca")
+	}
+	opt.AbsAPITLSClientCAFile = clientCert
+	if config := loadAPITLSConfig(opt, true); config.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("want client certificates verified if given with auth file")
+	}
+	config := loadAPITLSConfig(opt, false)
+	if config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("want client certificates required without auth file")
+	}
+
+	var commonName string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commonName = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}))
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	buff, _ := os.ReadFile(serverCert)
+	pool.AppendCertsFromPEM(buff)
+	cert, _ := tls.LoadX509KeyPair(clientCert, clientKey)
+	for _, certs := range [][]tls.Certificate{nil, {cert}} {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+		resp, err := client.Get(srv.URL)
+		if certs == nil {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("want error without client certificate")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("get with client certificate failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if commonName != "dashboard.example.com" {
+		t.Errorf("want common name dashboard.example.com, got %s", commonName)
+	}
+
+	for addr, want := range map[string]bool{
+		"localhost:2381": true, "127.0.0.1:2381": true, "[::1]:2381": true,
+		"0.0.0.0:2381": false, "10.0.0.1:2381": false, "bad": false,
+	} {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%s): want %v, got %v", addr, want, got)
+		}
+	}
+}
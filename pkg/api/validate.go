@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const (
+	// ValidatePrefix is the prefix of validating specs.
+	ValidatePrefix = "/validate"
+)
+
+type (
+	// ValidateResult is the result of validating specs.
+	ValidateResult struct {
+		Valid   bool              `yaml:"valid"`
+		Objects []*ObjectValidity `yaml:"objects"`
+	}
+
+	// ObjectValidity is the validity of a spec, the name and kind are
+	// empty if they're invalid.
+	ObjectValidity struct {
+		Name   string          `yaml:"name,omitempty"`
+		Kind   string          `yaml:"kind,omitempty"`
+		Valid  bool            `yaml:"valid"`
+		Errors []*v.FieldError `yaml:"errors,omitempty"`
+	}
+)
+
+func (s *Server) setupValidateAPIs() {
+	validateAPIs := []*APIEntry{
+		{
+			Path:    ValidatePrefix,
+			Method:  "POST",
+			Handler: s.validateSpecs,
+		},
+	}
+
+	s.RegisterAPIs(validateAPIs)
+}
+
+// validateSpecs validates the specs in the body by all checks of creating
+// them, nothing is applied. The errors are reported by fields, and the
+// status code is 200 even if some specs are invalid.
+func (s *Server) validateSpecs(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	configs, err := splitSpecDocs(body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	result := &ValidateResult{Valid: true}
+	names := map[string]struct{}{}
+	for _, config := range configs {
+		validity := s.validateSpec(config, names)
+		result.Valid = result.Valid && validity.Valid
+		result.Objects = append(result.Objects, validity)
+	}
+
+	buff, err := yaml.Marshal(result)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", result, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func (s *Server) validateSpec(config string, names map[string]struct{}) *ObjectValidity {
+	spec, err := supervisor.NewSpec(config)
+	if err != nil {
+		validity := &ObjectValidity{Errors: v.FieldErrorsOf(err)}
+		meta := &supervisor.MetaSpec{}
+		if yaml.Unmarshal([]byte(config), meta) == nil {
+			validity.Name, validity.Kind = meta.Name, meta.Kind
+		}
+		return validity
+	}
+
+	validity := &ObjectValidity{Name: spec.Name(), Kind: spec.Kind()}
+	if _, exists := names[spec.Name()]; exists {
+		validity.Errors = append(validity.Errors, &v.FieldError{
+			Field: "name", Message: fmt.Sprintf("duplicated name: %s", spec.Name()),
+		})
+	}
+	names[spec.Name()] = struct{}{}
+
+	// NOTE: The kind of an existing object can't be changed.
+	if existing := s._getObject(spec.Name()); existing != nil && existing.Kind() != spec.Kind() {
+		validity.Errors = append(validity.Errors, &v.FieldError{
+			Field: "kind", Message: fmt.Sprintf("different kinds: %s, %s", existing.Kind(), spec.Kind()),
+		})
+	}
+
+	validity.Valid = len(validity.Errors) == 0
+	return validity
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"testing"
+
+	_ "github.com/megaease/easegress/pkg/filter/mock"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+func TestFieldErrorsOfSpec(t *testing.T) {
+	_, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: mock
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 99
+`)
+	if err == nil {
+		t.Fatalf("want error for invalid spec")
+	}
+
+	errs := v.FieldErrorsOf(err)
+	if len(errs) != 1 || errs[0].Field != "filters.mock.code" {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	_, err = supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: mock
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+    delay: 1x
+`)
+	if err == nil {
+		t.Fatalf("want error for invalid spec")
+	}
+
+	errs = v.FieldErrorsOf(err)
+	if len(errs) != 1 || errs[0].Field != "filters.mock.delay" {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
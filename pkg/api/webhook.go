@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// WebhookPrefix is the prefix of webhooks of objects.
+	WebhookPrefix = "/webhooks"
+)
+
+// WebhookHandler is implemented by objects receiving webhooks, e.g. the
+// push events of git servers. Webhooks carry no credentials of the admin
+// API, so the handler must verify the requests itself.
+type WebhookHandler interface {
+	HandleWebhook(w http.ResponseWriter, r *http.Request)
+}
+
+func (s *Server) setupWebhookAPIs() {
+	webhookAPIs := []*APIEntry{
+		{
+			Path:    WebhookPrefix + "/{name}",
+			Method:  "POST",
+			Handler: s.handleWebhook,
+		},
+	}
+
+	s.RegisterAPIs(webhookAPIs)
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	ro, exists := supervisor.Global.GetRunningObject(name, "")
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	handler, ok := ro.Instance().(WebhookHandler)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s doesn't receive webhooks", name))
+		return
+	}
+
+	handler.HandleWebhook(w, r)
+}
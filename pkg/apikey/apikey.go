@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apikey defines consumers and their API keys, which are managed by
+// the admin API and stored in the cluster, and validated by the APIKeyAuth
+// filter.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/v"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	idSize     = 8
+	secretSize = 32
+)
+
+type (
+	// Consumer is the consumer of APIs, e.g. an application or a partner.
+	Consumer struct {
+		Name     string            `yaml:"name" jsonschema:"required,format=urlname"`
+		Metadata map[string]string `yaml:"metadata,omitempty" jsonschema:"omitempty"`
+		Quota    *Quota            `yaml:"quota,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Quota limits requests of a consumer.
+	Quota struct {
+		RequestsPerSecond float64 `yaml:"requestsPerSecond" jsonschema:"required,exclusiveMinimum=0"`
+		Burst             int     `yaml:"burst" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Key is an API key of a consumer, only the hash of the secret is saved.
+	Key struct {
+		ID          string `yaml:"id"`
+		Consumer    string `yaml:"consumer"`
+		Hash        string `yaml:"hash,omitempty"`
+		Description string `yaml:"description,omitempty"`
+		CreatedAt   string `yaml:"createdAt"`
+		ExpiresAt   string `yaml:"expiresAt,omitempty"`
+	}
+)
+
+// NewConsumer creates a consumer from yaml and validates it.
+func NewConsumer(buff []byte) (*Consumer, error) {
+	c := &Consumer{}
+	err := yaml.Unmarshal(buff, c)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal consumer failed: %v", err)
+	}
+
+	vr := v.Validate(c, buff)
+	if !vr.Valid() {
+		return nil, fmt.Errorf("validate consumer failed: \n%s", vr)
+	}
+
+	return c, nil
+}
+
+// Generate generates a key of the consumer, it returns the key record and
+// the plaintext key, which is in the form of <id>.<secret>.
+func Generate(consumer, description string, ttl time.Duration) (*Key, string, error) {
+	id := make([]byte, idSize)
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	k := &Key{
+		ID:          hex.EncodeToString(id),
+		Consumer:    consumer,
+		Description: description,
+		CreatedAt:   now.Format(time.RFC3339),
+	}
+	if ttl > 0 {
+		k.ExpiresAt = now.Add(ttl).Format(time.RFC3339)
+	}
+
+	plaintext := base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hash(plaintext)
+
+	return k, k.ID + "." + plaintext, nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Parse parses the plaintext key into its id and secret.
+func Parse(key string) (id, secret string, ok bool) {
+	i := strings.IndexByte(key, '.')
+	if i <= 0 || i == len(key)-1 {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
+
+// Verify verifies the secret, and checks if the key is expired.
+func (k *Key) Verify(secret string) error {
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(k.Hash)) != 1 {
+		return fmt.Errorf("invalid key")
+	}
+
+	if k.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, k.ExpiresAt)
+		if err != nil || time.Now().After(expiresAt) {
+			return fmt.Errorf("key expired")
+		}
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of the key without the hash, for displaying.
+func (k *Key) Redacted() *Key {
+	copied := *k
+	copied.Hash = ""
+	return &copied
+}
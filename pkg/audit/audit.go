@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package audit records admin operations to an append-only log, records
+// are chained by hashes so that any modification is detectable.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecordSize is the max size of a record line.
+const maxRecordSize = 16 * 1024 * 1024
+
+type (
+	// Record is a record of an admin operation.
+	Record struct {
+		Seq       uint64 `json:"seq" yaml:"seq"`
+		Time      string `json:"time" yaml:"time"`
+		Member    string `json:"member" yaml:"member"`
+		Principal string `json:"principal" yaml:"principal"`
+		SourceIP  string `json:"sourceIP" yaml:"sourceIP"`
+		Method    string `json:"method" yaml:"method"`
+		Path      string `json:"path" yaml:"path"`
+		Status    int    `json:"status" yaml:"status"`
+
+		// The fields below are set by APIs changing configs.
+		Action string `json:"action,omitempty" yaml:"action,omitempty"`
+		Kind   string `json:"kind,omitempty" yaml:"kind,omitempty"`
+		Name   string `json:"name,omitempty" yaml:"name,omitempty"`
+		Diff   string `json:"diff,omitempty" yaml:"diff,omitempty"`
+
+		PrevHash string `json:"prevHash" yaml:"prevHash"`
+		Hash     string `json:"hash" yaml:"hash"`
+	}
+
+	// Filter filters records, zero fields match all.
+	Filter struct {
+		Principal string
+		Name      string
+		Since     time.Time
+		// Limit is the max number of the latest records returned.
+		Limit int
+	}
+
+	// Log is an append-only audit log in a file.
+	Log struct {
+		path string
+
+		mutex    sync.Mutex
+		file     *os.File
+		seq      uint64
+		lastHash string
+	}
+)
+
+// Open opens the audit log at path, the chain continues from the last
+// record in the file.
+func Open(path string) (*Log, error) {
+	l := &Log{path: path}
+
+	err := l.scan(func(r *Record) error {
+		l.seq, l.lastHash = r.Seq, r.Hash
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %s failed: %v", path, err)
+	}
+
+	return l, nil
+}
+
+// hash returns the hash of the record, which covers all fields except
+// the hash itself.
+func (r *Record) hash() string {
+	rr := *r
+	rr.Hash = ""
+	buff, _ := json.Marshal(&rr)
+	sum := sha256.Sum256(buff)
+	return hex.EncodeToString(sum[:])
+}
+
+// Append appends the record to the log, it fills the sequence, time and
+// hashes of the record.
+func (l *Log) Append(r *Record) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	r.Seq = l.seq + 1
+	if r.Time == "" {
+		r.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	r.PrevHash = l.lastHash
+	r.Hash = r.hash()
+
+	buff, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	buff = append(buff, '\n')
+
+	_, err = l.file.Write(buff)
+	if err != nil {
+		return fmt.Errorf("write audit log failed: %v", err)
+	}
+	// NOTE: Audit records must survive crashes.
+	err = l.file.Sync()
+	if err != nil {
+		return fmt.Errorf("sync audit log failed: %v", err)
+	}
+
+	l.seq, l.lastHash = r.Seq, r.Hash
+	return nil
+}
+
+func (l *Log) scan(fn func(r *Record) error) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		r := &Record{}
+		err := json.Unmarshal([]byte(text), r)
+		if err != nil {
+			return fmt.Errorf("line %d of %s: %v", line, l.path, err)
+		}
+		err = fn(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Query returns records matching the filter, in the order of sequence.
+func (l *Log) Query(f *Filter) ([]*Record, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	records := []*Record{}
+	err := l.scan(func(r *Record) error {
+		if f.Principal != "" && r.Principal != f.Principal {
+			return nil
+		}
+		if f.Name != "" && r.Name != f.Name {
+			return nil
+		}
+		if !f.Since.IsZero() {
+			t, err := time.Parse(time.RFC3339Nano, r.Time)
+			if err == nil && t.Before(f.Since) {
+				return nil
+			}
+		}
+		records = append(records, r)
+		if f.Limit > 0 && len(records) > f.Limit {
+			records = records[1:]
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Verify verifies the hash chain of the whole log, it returns the number
+// of records verified, and the error of the first broken record.
+func (l *Log) Verify() (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	count, prevHash := 0, ""
+	err := l.scan(func(r *Record) error {
+		if r.PrevHash != prevHash {
+			return fmt.Errorf("record %d: previous hash mismatch", r.Seq)
+		}
+		if r.hash() != r.Hash {
+			return fmt.Errorf("record %d: hash mismatch", r.Seq)
+		}
+		if r.Seq != uint64(count+1) {
+			return fmt.Errorf("record %d: sequence mismatch, want %d", r.Seq, count+1)
+		}
+		count++
+		prevHash = r.Hash
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return count, err
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	for _, p := range []string{"alice", "bob", "alice"} {
+		err = l.Append(&Record{Principal: p, Method: "PUT", Name: "pipeline-demo"})
+		if err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	l.Close()
+
+	// Reopen to check the chain continues.
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer l.Close()
+	err = l.Append(&Record{Principal: "carol", Method: "DELETE"})
+	if err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	count, err := l.Verify()
+	if err != nil || count != 4 {
+		t.Fatalf("verify: want 4 records and no error, got %d, %v", count, err)
+	}
+
+	records, err := l.Query(&Filter{Principal: "alice"})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("query by principal: want 2 records, got %d, %v", len(records), err)
+	}
+	records, _ = l.Query(&Filter{Limit: 1})
+	if len(records) != 1 || records[0].Seq != 4 {
+		t.Fatalf("query with limit: want the latest record, got %+v", records)
+	}
+
+	// Tamper with a record.
+	buff, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(buff), "bob", "eve", 1)), 0600)
+	count, err = l.Verify()
+	if err == nil || count != 1 {
+		t.Fatalf("verify: want error at record 2, got %d, %v", count, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := "kind: HTTPPipeline\nname: demo\nflow:\n- filter: proxy\n"
+	after := "kind: HTTPPipeline\nname: demo\nflow:\n- filter: validator\n- filter: proxy\n"
+
+	want := "+- filter: validator\n"
+	if got := Diff(before, after); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	want = "-a\n-b\n"
+	if got := Diff("a\nb\n", ""); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
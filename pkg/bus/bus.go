@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bus is the in-process publish/subscribe bus, pipelines hand
+// requests to each other asynchronously through topics of it, without
+// looping them back through HTTP.
+package bus
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Message is a request published to a topic.
+	Message struct {
+		Topic  string      `json:"topic"`
+		Time   time.Time   `json:"time"`
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Host   string      `json:"host"`
+		Header http.Header `json:"header"`
+		Body   []byte      `json:"body"`
+	}
+
+	// Bus dispatches messages to the subscriptions of their topics.
+	Bus struct {
+		mutex  sync.RWMutex
+		topics map[string]map[*Subscription]struct{}
+	}
+
+	// Subscription receives the messages of a topic in a buffered
+	// channel, messages are dropped if the buffer is full.
+	Subscription struct {
+		bus   *Bus
+		topic string
+		ch    chan *Message
+
+		closeOnce sync.Once
+		received  uint64
+		dropped   uint64
+	}
+)
+
+// Global is the bus of the process.
+var Global = New()
+
+// New creates a Bus.
+func New() *Bus {
+	return &Bus{
+		topics: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe subscribes the topic with a buffer of the size.
+func (b *Bus) Subscribe(topic string, bufferSize int) *Subscription {
+	s := &Subscription{
+		bus:   b,
+		topic: topic,
+		ch:    make(chan *Message, bufferSize),
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	subs := b.topics[topic]
+	if subs == nil {
+		subs = map[*Subscription]struct{}{}
+		b.topics[topic] = subs
+	}
+	subs[s] = struct{}{}
+
+	return s
+}
+
+// Publish delivers the message to all subscriptions of its topic without
+// blocking, it returns the number of subscriptions received it. The
+// message is shared, so it must not be modified after publishing.
+func (b *Bus) Publish(msg *Message) int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	delivered := 0
+	for s := range b.topics[msg.Topic] {
+		if s.deliver(msg) {
+			delivered++
+		}
+	}
+
+	return delivered
+}
+
+// Subscribers returns the number of subscriptions of the topic.
+func (b *Bus) Subscribers(topic string) int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return len(b.topics[topic])
+}
+
+// Topic returns the topic of the subscription.
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// C returns the channel of messages, it's closed after the subscription
+// is closed and the buffered messages are consumed.
+func (s *Subscription) C() <-chan *Message {
+	return s.ch
+}
+
+// Deliver delivers the message to the subscription only, e.g. the one
+// relayed from another member of the cluster.
+func (s *Subscription) Deliver(msg *Message) bool {
+	s.bus.mutex.RLock()
+	defer s.bus.mutex.RUnlock()
+
+	if _, exists := s.bus.topics[s.topic][s]; !exists {
+		return false
+	}
+	return s.deliver(msg)
+}
+
+// deliver must be called with the read lock of the bus, so the channel
+// isn't closed meanwhile.
+func (s *Subscription) deliver(msg *Message) bool {
+	select {
+	case s.ch <- msg:
+		atomic.AddUint64(&s.received, 1)
+		return true
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+}
+
+// Received returns the number of messages received.
+func (s *Subscription) Received() uint64 {
+	return atomic.LoadUint64(&s.received)
+}
+
+// Dropped returns the number of messages dropped since the buffer is full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unsubscribes the topic.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.bus.mutex.Lock()
+		defer s.bus.mutex.Unlock()
+
+		subs := s.bus.topics[s.topic]
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(s.bus.topics, s.topic)
+		}
+		close(s.ch)
+	})
+}
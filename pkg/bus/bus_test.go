@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bus
+
+import "testing"
+
+func TestBus(t *testing.T) {
+	b := New()
+	s1, s2 := b.Subscribe("orders", 1), b.Subscribe("orders", 2)
+	other := b.Subscribe("payments", 1)
+
+	if n := b.Publish(&Message{Topic: "orders", URL: "/1"}); n != 2 {
+		t.Fatalf("want delivered to 2 subscriptions, got %d", n)
+	}
+	if n := b.Publish(&Message{Topic: "orders", URL: "/2"}); n != 1 {
+		t.Fatalf("want delivered to 1 subscription with a full buffer, got %d", n)
+	}
+	if s1.Dropped() != 1 || s2.Received() != 2 || other.Received() != 0 {
+		t.Errorf("unexpected counts: %d dropped, %d and %d received",
+			s1.Dropped(), s2.Received(), other.Received())
+	}
+
+	s2.Close()
+	if n := b.Subscribers("orders"); n != 1 {
+		t.Errorf("want 1 subscription after closing, got %d", n)
+	}
+	var urls []string
+	for msg := range s2.C() {
+		urls = append(urls, msg.URL)
+	}
+	if len(urls) != 2 || urls[0] != "/1" || urls[1] != "/2" {
+		t.Errorf("want buffered messages consumed in order after closing, got %v", urls)
+	}
+	if s2.Deliver(&Message{Topic: "orders"}) {
+		t.Errorf("want no delivery to the closed subscription")
+	}
+}
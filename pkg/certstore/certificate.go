@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package certstore keeps certificates shared by objects and filters, they
+// reference certificates by names, so certificates could be rotated
+// without changing them or interrupting connections.
+package certstore
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/common"
+	"github.com/megaease/easegress/pkg/secret"
+)
+
+const defaultAlertBefore = 30 * 24 * time.Hour
+
+type (
+	// Certificate is a certificate with its private key in the store.
+	Certificate struct {
+		Name       string `yaml:"name"`
+		CertBase64 string `yaml:"certBase64"`
+		KeyBase64  string `yaml:"keyBase64"`
+		// AlertBefore is how long before the expiry alerts are raised,
+		// the default is 720h.
+		AlertBefore string `yaml:"alertBefore,omitempty"`
+
+		keyPair     *tls.Certificate
+		alertBefore time.Duration
+	}
+
+	// Info is the public information of a certificate.
+	Info struct {
+		Name        string    `yaml:"name"`
+		Subject     string    `yaml:"subject"`
+		Issuer      string    `yaml:"issuer"`
+		DNSNames    []string  `yaml:"dnsNames,omitempty"`
+		Serial      string    `yaml:"serial"`
+		SHA256      string    `yaml:"sha256"`
+		NotBefore   time.Time `yaml:"notBefore"`
+		NotAfter    time.Time `yaml:"notAfter"`
+		DaysLeft    int       `yaml:"daysLeft"`
+		AlertBefore string    `yaml:"alertBefore"`
+		Expiring    bool      `yaml:"expiring"`
+		Expired     bool      `yaml:"expired"`
+	}
+)
+
+func init() {
+	secret.RegisterSensitiveFields("keyBase64")
+}
+
+// NewCertificate parses the certificate in YAML, encrypted private keys
+// are decrypted, and the key pair is validated.
+func NewCertificate(buff []byte) (*Certificate, error) {
+	resolved, _, err := secret.ResolveYAML(string(buff))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Certificate{}
+	err = yaml.UnmarshalStrict([]byte(resolved), c)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal certificate failed: %v", err)
+	}
+
+	err = common.ValidateName(c.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.alertBefore = defaultAlertBefore
+	if c.AlertBefore != "" {
+		c.alertBefore, err = time.ParseDuration(c.AlertBefore)
+		if err != nil || c.alertBefore <= 0 {
+			return nil, fmt.Errorf("invalid alertBefore %s", c.AlertBefore)
+		}
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(c.CertBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode certBase64 failed: %v", err)
+	}
+	keyPEM, err := base64.StdEncoding.DecodeString(c.KeyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode keyBase64 failed: %v", err)
+	}
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+	}
+	keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate failed: %v", err)
+	}
+	c.keyPair = &keyPair
+
+	return c, nil
+}
+
+// Marshal marshals the certificate to YAML with the private key
+// encrypted, if the master key is configured.
+func (c *Certificate) Marshal() (string, error) {
+	buff, err := yaml.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("marshal certificate failed: %v", err)
+	}
+	return secret.EncryptYAML(string(buff))
+}
+
+// KeyPair returns the parsed key pair.
+func (c *Certificate) KeyPair() *tls.Certificate {
+	return c.keyPair
+}
+
+// Info returns the public information of the certificate at now.
+func (c *Certificate) Info(now time.Time) *Info {
+	leaf := c.keyPair.Leaf
+	sum := sha256.Sum256(leaf.Raw)
+	left := leaf.NotAfter.Sub(now)
+
+	return &Info{
+		Name:        c.Name,
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		DNSNames:    leaf.DNSNames,
+		Serial:      leaf.SerialNumber.String(),
+		SHA256:      hex.EncodeToString(sum[:]),
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		DaysLeft:    int(left / (24 * time.Hour)),
+		AlertBefore: c.alertBefore.String(),
+		Expiring:    left < c.alertBefore,
+		Expired:     left <= 0,
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "certstore-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "certstore-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func newCertificateYAML(t *testing.T, name, cn string, notAfter time.Time) string {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return fmt.Sprintf("name: %s\ncertBase64: %s\nkeyBase64: %s\n", name,
+		base64.StdEncoding.EncodeToString(certPEM),
+		base64.StdEncoding.EncodeToString(keyPEM))
+}
+
+func TestCertificate(t *testing.T) {
+	now := time.Now()
+	c, err := NewCertificate([]byte(newCertificateYAML(t, "web", "web.example.com", now.Add(90*24*time.Hour))))
+	if err != nil {
+		t.Fatalf("new certificate failed: %v", err)
+	}
+
+	info := c.Info(now)
+	if info.Name != "web" || info.DNSNames[0] != "web.example.com" || info.Expiring || info.DaysLeft != 89 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if info = c.Info(now.Add(70 * 24 * time.Hour)); !info.Expiring || info.Expired {
+		t.Errorf("want expiring certificate: %+v", info)
+	}
+	if info = c.Info(now.Add(91 * 24 * time.Hour)); !info.Expired {
+		t.Errorf("want expired certificate: %+v", info)
+	}
+
+	other, _ := NewCertificate([]byte(newCertificateYAML(t, "other", "other.example.com", now.Add(time.Hour))))
+	mismatched := fmt.Sprintf("name: web\ncertBase64: %s\nkeyBase64: %s\n", c.CertBase64, other.KeyBase64)
+	for _, buff := range []string{
+		"name: web\ncertBase64: abc\nkeyBase64: abc\n",
+		"name: web\nunknown: field\n",
+		mismatched,
+		newCertificateYAML(t, "web", "web.example.com", now.Add(time.Hour)) + "alertBefore: -1h\n",
+	} {
+		if _, err := NewCertificate([]byte(buff)); err == nil {
+			t.Errorf("want error for:\n%s", buff)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := newStore()
+	Global = s
+	defer func() { Global = nil }()
+
+	getCertificate := GetCertificate("web")
+	if _, err := getCertificate(nil); err == nil {
+		t.Errorf("want error for missing certificate")
+	}
+
+	now := time.Now()
+	s.update(map[string]string{
+		"/config/certificates/web": newCertificateYAML(t, "web", "v1.example.com", now.Add(10*24*time.Hour)),
+		"/config/certificates/bad": "name: bad\n",
+	})
+	cert, err := getCertificate(nil)
+	if err != nil || cert.Leaf.Subject.CommonName != "v1.example.com" {
+		t.Fatalf("want certificate v1, got %v", err)
+	}
+	if len(s.List(now)) != 1 {
+		t.Errorf("invalid certificates should be ignored")
+	}
+
+	s.checkExpiry(now)
+	s.checkExpiry(now.Add(time.Hour))
+	if len(s.alerts) != 1 || !s.alerts["web/"+s.List(now)[0].SHA256].Equal(now) {
+		t.Errorf("want alert not repeated within alert interval: %v", s.alerts)
+	}
+
+	// Rotate.
+	s.update(map[string]string{
+		"/config/certificates/web": newCertificateYAML(t, "web", "v2.example.com", now.Add(90*24*time.Hour)),
+	})
+	cert, err = GetClientCertificate("web")(nil)
+	if err != nil || cert.Leaf.Subject.CommonName != "v2.example.com" {
+		t.Fatalf("want certificate v2, got %v", err)
+	}
+	s.checkExpiry(now)
+	if len(s.alerts) != 0 {
+		t.Errorf("want no alert after rotation: %v", s.alerts)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certstore
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	pullInterval  = time.Minute
+	checkInterval = time.Hour
+	// alertInterval is the interval to repeat alerts of a certificate.
+	alertInterval = 24 * time.Hour
+)
+
+type (
+	// Store keeps a copy of certificates synced from the cluster.
+	Store struct {
+		mutex        sync.RWMutex
+		certificates map[string]*Certificate
+
+		alertMutex sync.Mutex
+		alerts     map[string]time.Time
+
+		syncer *cluster.Syncer
+		done   chan struct{}
+	}
+)
+
+// Global is the global certificate store.
+var Global *Store
+
+// New creates a Store syncing certificates from the cluster.
+func New(cls cluster.Cluster) *Store {
+	s := newStore()
+	Global = s
+
+	syncer, err := cls.Syncer(pullInterval)
+	if err != nil {
+		logger.Errorf("create syncer failed: %v", err)
+		return s
+	}
+	s.syncer = syncer
+
+	ch, err := syncer.SyncPrefix(cls.Layout().ConfigCertificatePrefix())
+	if err != nil {
+		logger.Errorf("sync certificates failed: %v", err)
+		return s
+	}
+
+	go func() {
+		for kvs := range ch {
+			s.update(kvs)
+			s.checkExpiry(time.Now())
+		}
+	}()
+	go s.run()
+
+	return s
+}
+
+func newStore() *Store {
+	return &Store{
+		certificates: map[string]*Certificate{},
+		alerts:       map[string]time.Time{},
+		done:         make(chan struct{}),
+	}
+}
+
+func (s *Store) update(kvs map[string]string) {
+	certificates := make(map[string]*Certificate, len(kvs))
+	for k, v := range kvs {
+		c, err := NewCertificate([]byte(v))
+		if err != nil {
+			logger.Errorf("invalid certificate %s: %v", k, err)
+			continue
+		}
+		certificates[c.Name] = c
+	}
+
+	s.mutex.Lock()
+	s.certificates = certificates
+	s.mutex.Unlock()
+}
+
+func (s *Store) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.checkExpiry(now)
+		}
+	}
+}
+
+// checkExpiry raises alerts for expiring certificates, the alert of a
+// certificate is repeated every alertInterval until it's rotated.
+func (s *Store) checkExpiry(now time.Time) {
+	s.alertMutex.Lock()
+	defer s.alertMutex.Unlock()
+
+	alerts := map[string]time.Time{}
+	for _, info := range s.List(now) {
+		if !info.Expiring {
+			continue
+		}
+
+		key := info.Name + "/" + info.SHA256
+		last, alerted := s.alerts[key]
+		if alerted && now.Sub(last) < alertInterval {
+			alerts[key] = last
+			continue
+		}
+		alerts[key] = now
+
+		if info.Expired {
+			logger.Errorf("certificate %s (%s) expired at %s",
+				info.Name, info.Subject, info.NotAfter.Format(time.RFC3339))
+		} else {
+			logger.Warnf("certificate %s (%s) expires in %d days at %s",
+				info.Name, info.Subject, info.DaysLeft, info.NotAfter.Format(time.RFC3339))
+		}
+	}
+	s.alerts = alerts
+}
+
+// Get returns the certificate.
+func (s *Store) Get(name string) *Certificate {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.certificates[name]
+}
+
+// List returns information of all certificates sorted by name.
+func (s *Store) List(now time.Time) []*Info {
+	s.mutex.RLock()
+	infos := make([]*Info, 0, len(s.certificates))
+	for _, c := range s.certificates {
+		infos = append(infos, c.Info(now))
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func keyPair(name string) (*tls.Certificate, error) {
+	s := Global
+	if s == nil {
+		return nil, fmt.Errorf("certificate store is not available")
+	}
+
+	c := s.Get(name)
+	if c == nil {
+		return nil, fmt.Errorf("certificate %s not found", name)
+	}
+	return c.KeyPair(), nil
+}
+
+// GetCertificate returns the function for tls.Config.GetCertificate, it
+// gets the latest certificate in the global store for every handshake.
+func GetCertificate(name string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return keyPair(name)
+	}
+}
+
+// GetCertificates returns the function for tls.Config.GetCertificate, it
+// gets the first certificate supporting the client among the latest ones
+// in the global store, or the first one if none of them supports it.
+func GetCertificates(names []string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		var first *tls.Certificate
+		for _, name := range names {
+			cert, err := keyPair(name)
+			if err != nil {
+				continue
+			}
+			if hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+			if first == nil {
+				first = cert
+			}
+		}
+		if first == nil {
+			return nil, fmt.Errorf("certificates %v not found", names)
+		}
+		return first, nil
+	}
+}
+
+// GetClientCertificate returns the function for
+// tls.Config.GetClientCertificate, it gets the latest certificate in the
+// global store for every handshake.
+func GetClientCertificate(name string) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return keyPair(name)
+	}
+}
+
+// Close closes the Store.
+func (s *Store) Close(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	close(s.done)
+	if s.syncer != nil {
+		s.syncer.Close()
+	}
+}
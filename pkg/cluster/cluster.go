@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/common"
@@ -129,6 +130,8 @@ type cluster struct {
 	leaseMutex   sync.RWMutex
 	sessionMutex sync.RWMutex
 
+	deregistered int32
+
 	done chan struct{}
 }
 
@@ -141,6 +144,11 @@ func New(opt *option.Options) (Cluster, error) {
 		return nil, fmt.Errorf("invalid cluster request timeout: %v", err)
 	}
 
+	err = discoverJoinURLs(opt)
+	if err != nil {
+		return nil, err
+	}
+
 	members, err := newMembers(opt)
 	if err != nil {
 		return nil, fmt.Errorf("new members failed: %v", err)
@@ -211,6 +219,10 @@ func (c *cluster) run() {
 }
 
 func (c *cluster) getReady() error {
+	if c.external() {
+		return c.getExternalReady()
+	}
+
 	if c.opt.ClusterRole == "reader" {
 		_, err := c.getClient()
 		if err != nil {
@@ -384,20 +396,32 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 	if c.opt.ForceNewCluster {
 		endpoints = []string{c.members.self().PeerURL}
 	}
-	logger.Infof("client connect with endpoints: %v", endpoints)
-	client, err := clientv3.New(clientv3.Config{
+	config := clientv3.Config{
 		Endpoints:            endpoints,
 		AutoSyncInterval:     autoSyncInterval,
 		DialTimeout:          dialTimeout,
 		DialKeepAliveTime:    dialKeepAliveTime,
 		DialKeepAliveTimeout: dialKeepAliveTimeout,
 		LogConfig:            logger.EtcdClientLoggerConfig(c.opt, logger.EtcdClientFilename),
-	})
+	}
+	if c.external() {
+		err := externalClientConfig(&config, c.opt.ClusterEtcdEndpoints,
+			c.opt.ClusterEtcdCAFile, c.opt.ClusterEtcdCertFile, c.opt.ClusterEtcdKeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	logger.Infof("client connect with endpoints: %v", config.Endpoints)
+	client, err := clientv3.New(config)
 	if err != nil {
 		return nil, fmt.Errorf("create client failed: %v", err)
 	}
 
+	if c.external() {
+		prefixClient(client, c.opt.ClusterEtcdPrefix)
+	}
+
 	logger.Infof("client is ready")
 
 	c.client = client
@@ -639,6 +663,11 @@ func (c *cluster) CloseServer(wg *sync.WaitGroup) {
 }
 
 func (c *cluster) StartServer() (done, timeout chan struct{}, err error) {
+	if c.external() {
+		done = make(chan struct{})
+		close(done)
+		return done, make(chan struct{}), nil
+	}
 	return c.startServer()
 }
 
@@ -650,9 +679,12 @@ func (c *cluster) heartbeat() {
 			if err != nil {
 				logger.Errorf("sync status failed: %v", err)
 			}
-			err = c.updateMembers()
-			if err != nil {
-				logger.Errorf("update members failed: %v", err)
+			// NOTE: The members of the external etcd aren't ours.
+			if !c.external() {
+				err = c.updateMembers()
+				if err != nil {
+					logger.Errorf("update members failed: %v", err)
+				}
 			}
 		case <-c.done:
 			return
@@ -688,6 +720,10 @@ func (c *cluster) defrag() {
 }
 
 func (c *cluster) syncStatus() error {
+	if atomic.LoadInt32(&c.deregistered) == 1 {
+		return nil
+	}
+
 	status := MemberStatus{
 		Options: *c.opt,
 	}
@@ -743,21 +779,23 @@ func (c *cluster) PurgeMember(memberName string) error {
 	}
 
 	// remove etcd member if there is it.
-	respList, err := client.MemberList(c.requestContext())
-	if err != nil {
-		return err
-	}
-	var id *uint64
-	for _, member := range respList.Members {
-		if member.Name == memberName {
-			id = &member.ID
-		}
-	}
-	if id != nil {
-		_, err = client.MemberRemove(c.requestContext(), *id)
+	if !c.external() {
+		respList, err := client.MemberList(c.requestContext())
 		if err != nil {
 			return err
 		}
+		var id *uint64
+		for _, member := range respList.Members {
+			if member.Name == memberName {
+				id = &member.ID
+			}
+		}
+		if id != nil {
+			_, err = client.MemberRemove(c.requestContext(), *id)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	// remove all stuff under the lease of the member.
@@ -782,6 +820,35 @@ func (c *cluster) PurgeMember(memberName string) error {
 	return nil
 }
 
+// Deregister deletes the status of the member and the status of objects
+// running on it, so the member doesn't look alive to others after it's
+// shut down. The lease of the member is kept, it's reused on restart.
+func (c *cluster) Deregister() error {
+	atomic.StoreInt32(&c.deregistered, 1)
+
+	kvs, err := c.GetPrefix(c.Layout().StatusObjectsPrefix())
+	if err != nil {
+		return err
+	}
+
+	keys := []string{c.Layout().StatusMemberKey()}
+	suffix := "/" + c.opt.Name
+	for k := range kvs {
+		if strings.HasSuffix(k, suffix) {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		err = c.Delete(k)
+		if err != nil {
+			return fmt.Errorf("delete %s failed: %v", k, err)
+		}
+	}
+
+	return nil
+}
+
 func (c *cluster) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -39,6 +39,7 @@ type (
 		PutUnderLease(key, value string) error
 		PutAndDelete(map[string]*string) error
 		PutAndDeleteUnderLease(map[string]*string) error
+		PutIfAbsent(key, value string, ttl time.Duration) (bool, error)
 
 		Delete(key string) error
 		DeletePrefix(prefix string) error
@@ -47,6 +48,7 @@ type (
 		Syncer(pullInterval time.Duration) (*Syncer, error)
 
 		Mutex(name string) (Mutex, error)
+		Lease(name string, ttl time.Duration) (Lease, error)
 
 		CloseServer(wg *sync.WaitGroup)
 		StartServer() (chan struct{}, chan struct{}, error)
@@ -54,6 +56,8 @@ type (
 		Close(wg *sync.WaitGroup)
 
 		PurgeMember(member string) error
+		RaftStatus() (*RaftStatus, error)
+		Deregister() error
 	}
 
 	// Watcher wraps etcd watcher.
@@ -18,10 +18,13 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/megaease/easegress/pkg/env"
 )
 
 func mockClusters(count int) []*cluster {
@@ -73,3 +76,103 @@ func TestCluster(t *testing.T) {
 	clusters := mockClusters(5)
 	defer closeClusters(clusters)
 }
+
+func TestExternalEtcd(t *testing.T) {
+	clusters := mockClusters(1)
+	defer closeClusters(clusters)
+
+	opt := mockTestOpt()
+	opt.ClusterRole = "reader"
+	opt.ClusterEtcdEndpoints = clusters[0].opt.ClusterAdvertiseClientURLs
+	opt.ClusterEtcdPrefix = "/external/"
+	env.InitServerDir(opt)
+
+	cls, err := New(opt)
+	if err != nil {
+		t.Fatalf("new cluster failed: %v", err)
+	}
+	c := cls.(*cluster)
+	defer closeClusters([]*cluster{c})
+
+	for err = c.getReady(); err != nil; err = c.getReady() {
+		time.Sleep(HeartbeatInterval)
+	}
+
+	err = c.Put("/config/objects/demo", "demo")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	value, err := clusters[0].Get("/external/config/objects/demo")
+	if err != nil || value == nil || *value != "demo" {
+		t.Errorf("want the key under the prefix, got %v, %v", value, err)
+	}
+	value, err = clusters[0].Get("/external" + c.Layout().ClusterNameKey())
+	if err != nil || value == nil || *value != opt.ClusterName {
+		t.Errorf("want the cluster name registered, got %v, %v", value, err)
+	}
+}
+
+func TestRaftStatus(t *testing.T) {
+	clusters := mockClusters(3)
+	defer closeClusters(clusters)
+
+	status, err := clusters[1].RaftStatus()
+	if err != nil {
+		t.Fatalf("raft status failed: %v", err)
+	}
+	if status.Voters != 3 || status.Quorum != 2 {
+		t.Errorf("want 3 voters and quorum 2, got %d, %d", status.Voters, status.Quorum)
+	}
+	if status.Leader == "" || status.LeaderName == "" || status.Term == 0 {
+		t.Errorf("want the leader and term, got %+v", status)
+	}
+}
+
+func TestLease(t *testing.T) {
+	clusters := mockClusters(2)
+	defer closeClusters(clusters)
+
+	if _, err := clusters[0].Lease("/locks/test", time.Millisecond); err == nil {
+		t.Errorf("want error for ttl less than 1s")
+	}
+	first, _ := clusters[0].Lease("/locks/test", time.Second)
+	second, _ := clusters[1].Lease("/locks/test", time.Second)
+
+	if err := first.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	if holder, _ := second.Holder(); holder != clusters[0].opt.Name {
+		t.Errorf("want holder %s, got %q", clusters[0].opt.Name, holder)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := second.Acquire(ctx); err == nil {
+		t.Errorf("want error acquiring the held lease")
+	}
+
+	if err := first.Release(); err != nil {
+		t.Errorf("release failed: %v", err)
+	}
+	select {
+	case <-first.Done():
+	default:
+		t.Errorf("want the released lease done")
+	}
+	if err := second.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after release failed: %v", err)
+	}
+	if holder, _ := first.Holder(); holder != clusters[1].opt.Name {
+		t.Errorf("want holder %s, got %q", clusters[1].opt.Name, holder)
+	}
+
+	// The holder is down, its lease isn't kept alive or revoked.
+	second.(*clusterLease).session.Orphan()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := first.Acquire(ctx); err != nil {
+		t.Fatalf("acquire after failover failed: %v", err)
+	}
+	first.Release()
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/common"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const (
+	discoveryInterval    = 2 * time.Second
+	discoveryTimeout     = 5 * time.Minute
+	discoveryDefaultPort = "2380"
+)
+
+var (
+	// They're variables for testing.
+	gceMetadataURL = "http://metadata.google.internal/computeMetadata/v1"
+	gceComputeURL  = "https://compute.googleapis.com/compute/v1"
+
+	discoveryClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+// discoverJoinURLs fills cluster-join-urls with the peers discovered by
+// cluster-discovery. The writer with the least peer URL bootstraps the
+// cluster, unless one of the others is serving already, and the others
+// join it, so writers started at the same time assemble one cluster.
+func discoverJoinURLs(opt *option.Options) error {
+	if opt.ClusterDiscovery == "" || opt.UseExternalEtcd() || len(opt.ClusterJoinURLs) != 0 {
+		return nil
+	}
+
+	// NOTE: The writer restarting from its data knows its cluster already.
+	if opt.ClusterRole == "writer" && !common.IsDirEmpty(opt.AbsDataDir) {
+		return nil
+	}
+
+	deadline := time.Now().Add(discoveryTimeout)
+	for {
+		peers, err := discoverPeers(opt)
+		if err == nil {
+			var joinURLs []string
+			joinURLs, err = joinURLsOf(opt, peers)
+			if err == nil {
+				logger.Infof("discovered peers %v by %s, join urls: %v",
+					peers, opt.ClusterDiscovery, joinURLs)
+				opt.ClusterJoinURLs = joinURLs
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("discover peers by %s failed: %v", opt.ClusterDiscovery, err)
+		}
+		logger.Warnf("discover peers by %s failed, retry in %v: %v",
+			opt.ClusterDiscovery, discoveryInterval, err)
+		time.Sleep(discoveryInterval)
+	}
+}
+
+// joinURLsOf returns the join urls from the discovered peers, it's empty
+// if this writer should bootstrap the cluster.
+func joinURLsOf(opt *option.Options, peers []string) ([]string, error) {
+	peers = uniquePeers(peers)
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peer discovered")
+	}
+
+	if opt.ClusterRole != "writer" {
+		return peers, nil
+	}
+
+	self := opt.ClusterInitialAdvertisePeerURLs[0]
+	others := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if !strings.EqualFold(peer, self) {
+			others = append(others, peer)
+		}
+	}
+	if len(others) == len(peers) {
+		return nil, fmt.Errorf("self %s not in discovered peers %v", self, peers)
+	}
+	if len(peers) < opt.ClusterDiscoveryExpect {
+		return nil, fmt.Errorf("discovered %d peers %v, want %d",
+			len(peers), peers, opt.ClusterDiscoveryExpect)
+	}
+
+	if len(others) == 0 {
+		return nil, nil
+	}
+	if !strings.EqualFold(peers[0], self) {
+		return others, nil
+	}
+
+	for _, peer := range others {
+		if peerServing(peer) {
+			return others, nil
+		}
+	}
+	return nil, nil
+}
+
+func uniquePeers(peers []string) []string {
+	set := make(map[string]struct{}, len(peers))
+	result := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if _, exists := set[peer]; !exists {
+			set[peer] = struct{}{}
+			result = append(result, peer)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// peerServing reports whether the peer is a member of a running cluster.
+func peerServing(peerURL string) bool {
+	resp, err := discoveryClient.Get(strings.TrimSuffix(peerURL, "/") + "/members")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func discoverPeers(opt *option.Options) ([]string, error) {
+	// NOTE: The peers are supposed to use the same scheme and port.
+	scheme, port := "http", discoveryDefaultPort
+	if len(opt.ClusterInitialAdvertisePeerURLs) != 0 {
+		u, err := url.Parse(opt.ClusterInitialAdvertisePeerURLs[0])
+		if err == nil {
+			scheme = u.Scheme
+			if u.Port() != "" {
+				port = u.Port()
+			}
+		}
+	}
+
+	switch opt.ClusterDiscovery {
+	case "dns-srv":
+		return discoverDNSSRV(scheme, opt.ClusterDiscoveryTarget)
+	case "kubernetes":
+		return discoverKubernetes(scheme, port, opt.ClusterDiscoveryTarget)
+	case "gce":
+		return discoverGCE(scheme, port, opt.ClusterDiscoveryTarget)
+	default:
+		return nil, fmt.Errorf("unsupported cluster discovery %s", opt.ClusterDiscovery)
+	}
+}
+
+func peerURL(scheme, host, port string) string {
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+}
+
+// discoverDNSSRV discovers the targets of the SRV records.
+func discoverDNSSRV(scheme, name string) ([]string, error) {
+	_, addrs, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		host := strings.TrimSuffix(addr.Target, ".")
+		peers = append(peers, peerURL(scheme, host, strconv.Itoa(int(addr.Port))))
+	}
+	return peers, nil
+}
+
+// discoverKubernetes discovers the addresses of the pods behind the
+// headless service, it should publish not ready addresses, since the pods
+// aren't ready before the cluster is assembled.
+func discoverKubernetes(scheme, port, service string) ([]string, error) {
+	addrs, err := net.LookupHost(service)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		peers = append(peers, peerURL(scheme, addr, port))
+	}
+	return peers, nil
+}
+
+type (
+	gceInstanceList struct {
+		Items map[string]struct {
+			Instances []*gceInstance `json:"instances"`
+		} `json:"items"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+
+	gceInstance struct {
+		Status            string `json:"status"`
+		NetworkInterfaces []struct {
+			NetworkIP string `json:"networkIP"`
+		} `json:"networkInterfaces"`
+	}
+
+	gceToken struct {
+		AccessToken string `json:"access_token"`
+	}
+)
+
+// discoverGCE discovers the internal addresses of the instances with the
+// label in the project, with the service account of this instance, which
+// needs the permission compute.instances.list.
+func discoverGCE(scheme, port, label string) ([]string, error) {
+	project, err := gceMetadata("/project/project-id")
+	if err != nil {
+		return nil, err
+	}
+	buff, err := gceMetadata("/instance/service-accounts/default/token")
+	if err != nil {
+		return nil, err
+	}
+	token := gceToken{}
+	err = json.Unmarshal([]byte(buff), &token)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal token failed: %v", err)
+	}
+
+	query := url.Values{}
+	query.Set("filter", "labels."+label)
+	peers := []string{}
+	for {
+		listURL := fmt.Sprintf("%s/projects/%s/aggregated/instances?%s",
+			gceComputeURL, project, query.Encode())
+		req, err := http.NewRequest(http.MethodGet, listURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+		buff, err := gceDo(req)
+		if err != nil {
+			return nil, err
+		}
+		list := gceInstanceList{}
+		err = json.Unmarshal([]byte(buff), &list)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal instances failed: %v", err)
+		}
+
+		for _, zone := range list.Items {
+			for _, instance := range zone.Instances {
+				if instance.Status != "RUNNING" || len(instance.NetworkInterfaces) == 0 {
+					continue
+				}
+				peers = append(peers, peerURL(scheme, instance.NetworkInterfaces[0].NetworkIP, port))
+			}
+		}
+
+		if list.NextPageToken == "" {
+			return peers, nil
+		}
+		query.Set("pageToken", list.NextPageToken)
+	}
+}
+
+func gceMetadata(path string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, gceMetadataURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return gceDo(req)
+}
+
+func gceDo(req *http.Request) (string, error) {
+	resp, err := discoveryClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	buff, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, buff)
+	}
+	return string(buff), nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestJoinURLsOf(t *testing.T) {
+	opt := &option.Options{
+		ClusterRole:                     "writer",
+		ClusterInitialAdvertisePeerURLs: []string{"http://10.0.0.2:2380"},
+		ClusterDiscoveryExpect:          2,
+	}
+
+	_, err := joinURLsOf(opt, []string{"http://10.0.0.2:2380"})
+	if err == nil {
+		t.Errorf("want error for less peers than expected")
+	}
+	_, err = joinURLsOf(opt, []string{"http://10.0.0.1:2380", "http://10.0.0.3:2380"})
+	if err == nil {
+		t.Errorf("want error for self not discovered")
+	}
+
+	joinURLs, err := joinURLsOf(opt, []string{"http://10.0.0.3:2380", "http://10.0.0.2:2380", "http://10.0.0.1:2380"})
+	want := []string{"http://10.0.0.1:2380", "http://10.0.0.3:2380"}
+	if err != nil || !reflect.DeepEqual(joinURLs, want) {
+		t.Errorf("want %v, got %v, %v", want, joinURLs, err)
+	}
+
+	// NOTE: The least one bootstraps the cluster if no one else is serving.
+	joinURLs, err = joinURLsOf(opt, []string{"http://10.0.0.2:2380", "http://127.0.0.1:1"})
+	if err != nil || len(joinURLs) != 0 {
+		t.Errorf("want to bootstrap, got %v, %v", joinURLs, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	joinURLs, err = joinURLsOf(opt, []string{"http://10.0.0.2:2380", server.URL})
+	if err != nil || !reflect.DeepEqual(joinURLs, []string{server.URL}) {
+		t.Errorf("want to join the serving one, got %v, %v", joinURLs, err)
+	}
+
+	opt.ClusterRole = "reader"
+	joinURLs, err = joinURLsOf(opt, []string{"http://10.0.0.3:2380", "http://10.0.0.3:2380"})
+	if err != nil || !reflect.DeepEqual(joinURLs, []string{"http://10.0.0.3:2380"}) {
+		t.Errorf("want all peers for reader, got %v, %v", joinURLs, err)
+	}
+}
+
+func TestDiscoverKubernetes(t *testing.T) {
+	peers, err := discoverKubernetes("http", "2380", "localhost")
+	if err != nil {
+		t.Fatalf("discover failed: %v", err)
+	}
+	found := false
+	for _, peer := range peers {
+		if peer == "http://127.0.0.1:2380" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want http://127.0.0.1:2380, got %v", peers)
+	}
+}
+
+func TestDiscoverGCE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/metadata/project/project-id":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("demo"))
+		case r.URL.Path == "/metadata/instance/service-accounts/default/token":
+			w.Write([]byte(`{"access_token":"abc","expires_in":3599,"token_type":"Bearer"}`))
+		case r.URL.Path == "/compute/projects/demo/aggregated/instances":
+			if r.Header.Get("Authorization") != "Bearer abc" ||
+				r.URL.Query().Get("filter") != "labels.easegress=prod" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if r.URL.Query().Get("pageToken") == "" {
+				w.Write([]byte(`{"items":{"zones/a":{"instances":[
+					{"status":"RUNNING","networkInterfaces":[{"networkIP":"10.0.0.1"}]},
+					{"status":"TERMINATED","networkInterfaces":[{"networkIP":"10.0.0.9"}]}]}},
+					"nextPageToken":"next"}`))
+				return
+			}
+			w.Write([]byte(`{"items":{"zones/b":{"instances":[
+				{"status":"RUNNING","networkInterfaces":[{"networkIP":"10.0.0.2"}]}]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	gceMetadataURL, gceComputeURL = server.URL+"/metadata", server.URL+"/compute"
+	peers, err := discoverGCE("https", "2380", "easegress=prod")
+	if err != nil {
+		t.Fatalf("discover failed: %v", err)
+	}
+	want := "https://10.0.0.1:2380,https://10.0.0.2:2380"
+	if strings.Join(peers, ",") != want {
+		t.Errorf("want %s, got %v", want, peers)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/namespace"
+)
+
+// external reports whether the config is stored in an external etcd
+// cluster, the members are all clients of it then.
+func (c *cluster) external() bool {
+	return c.opt.UseExternalEtcd()
+}
+
+func (c *cluster) getExternalReady() error {
+	_, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	err = c.registerClusterName()
+	if err != nil {
+		return err
+	}
+
+	err = c.initLease()
+	if err != nil {
+		return fmt.Errorf("init lease failed: %v", err)
+	}
+	return nil
+}
+
+// registerClusterName registers the cluster name if it's the first member
+// using the external etcd cluster, or checks it otherwise.
+func (c *cluster) registerClusterName() error {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	key := c.Layout().ClusterNameKey()
+	resp, err := client.Txn(c.requestContext()).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, c.opt.ClusterName)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("register cluster name %s failed: %v", c.opt.ClusterName, err)
+	}
+
+	if resp.Succeeded {
+		logger.Infof("register cluster name %s", c.opt.ClusterName)
+		return nil
+	}
+
+	return c.checkClusterName()
+}
+
+// externalClientConfig returns the client config of the external etcd.
+func externalClientConfig(config *clientv3.Config, endpoints []string, caFile, certFile, keyFile string) error {
+	config.Endpoints = endpoints
+
+	secure := caFile != "" || certFile != ""
+	for _, endpoint := range endpoints {
+		secure = secure || strings.HasPrefix(endpoint, "https://")
+	}
+	if !secure {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("read %s failed: %v", caFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("load client certificate failed: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	config.TLS = tlsConfig
+
+	return nil
+}
+
+// prefixClient makes all keys, watches and leases of the client under the
+// prefix.
+func prefixClient(client *clientv3.Client, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return
+	}
+
+	client.KV = namespace.NewKV(client.KV, prefix)
+	client.Watcher = namespace.NewWatcher(client.Watcher, prefix)
+	client.Lease = namespace.NewLease(client.Lease, prefix)
+}
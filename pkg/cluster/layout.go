@@ -23,15 +23,55 @@ import "fmt"
 // Status means dynamic, different in every member.
 // Config means static, same in every member.
 const (
-	leaseFormat              = "/leases/%s" //+memberName
-	statusMemberPrefix       = "/status/members/"
-	statusMemberFormat       = "/status/members/%s" // +memberName
-	statusObjectPrefix       = "/status/objects/"
-	statusObjectPrefixFormat = "/status/objects/%s/"   // +objectName
-	statusObjectFormat       = "/status/objects/%s/%s" // +objectName +memberName
-	configObjectPrefix       = "/config/objects/"
-	configObjectFormat       = "/config/objects/%s" // +objectName
-	configVersion            = "/config/version"
+	leaseFormat                   = "/leases/%s" //+memberName
+	statusMemberPrefix            = "/status/members/"
+	statusMemberFormat            = "/status/members/%s" // +memberName
+	statusObjectPrefix            = "/status/objects/"
+	statusObjectPrefixFormat      = "/status/objects/%s/"        // +objectName
+	statusObjectFormat            = "/status/objects/%s/%s"      // +objectName +memberName
+	statusRateLimiterPrefixFormat = "/status/ratelimiters/%s/"   // +rateLimiterName
+	statusRateLimiterFormat       = "/status/ratelimiters/%s/%s" // +rateLimiterName +memberName
+	statusCronTriggerFormat       = "/status/crontriggers/%s"    // +cronTriggerName
+	statusDeploymentPrefixFormat  = "/status/deployments/%s/"    // +deploymentID
+	statusDeploymentFormat        = "/status/deployments/%s/%s"  // +deploymentID +memberName
+	lockCronTriggerFormat         = "/locks/crontriggers/%s"     // +cronTriggerName
+	dedupKeyFormat                = "/dedup/%s/%s"               // +dedupName +key
+	busTopicPrefixFormat          = "/bus/%s/"                   // +topic
+	busMemberPrefixFormat         = "/bus/%s/%s/"                // +topic +memberName
+	busMessageFormat              = "/bus/%s/%s/%020d"           // +topic +memberName +seq
+	configObjectPrefix            = "/config/objects/"
+	configObjectFormat            = "/config/objects/%s"     // +objectName
+	configObjectVersionPrefix     = "/config/versions/%s/"   // +objectName
+	configObjectVersionFormat     = "/config/versions/%s/%d" // +objectName +version
+	configHistoryPrefix           = "/config/history/"
+	configHistoryFormat           = "/config/history/%020d" // +revision
+	configNamespacePrefix         = "/config/namespaces/"
+	configNamespaceFormat         = "/config/namespaces/%s" // +namespace
+	configBlockPrefix             = "/config/blocks/"
+	configBlockFormat             = "/config/blocks/%s" // +blockName
+	configConsumerPrefix          = "/config/consumers/"
+	configConsumerFormat          = "/config/consumers/%s" // +consumerName
+	configAPIKeyPrefix            = "/config/apikeys/"
+	configAPIKeyFormat            = "/config/apikeys/%s" // +keyID
+	configCertificatePrefix       = "/config/certificates/"
+	configCertificateFormat       = "/config/certificates/%s" // +certificateName
+	configFlagsPrefix             = "/config/flags/"
+	configFlagsFormat             = "/config/flags/%s"  // +pipelineName
+	configOwnerFormat             = "/config/owners/%s" // +owner
+	lockConfigOwnerFormat         = "/locks/owners/%s"  // +owner
+	configVersion                 = "/config/version"
+	eventConfigKey                = "/events/config"
+	deploymentStagedKey           = "/deployments/staged"
+	deploymentPrefix              = "/deployments/records/"
+	deploymentFormat              = "/deployments/records/%s" // +deploymentID
+	statusFederationPrefix        = "/status/federation/"
+	statusFederationFormat        = "/status/federation/%s" // +region
+	restartRunningKey             = "/restarts/running"
+	restartPrefix                 = "/restarts/records/"
+	restartFormat                 = "/restarts/records/%s"   // +restartID
+	statusRestartPrefixFormat     = "/status/restarts/%s/"   // +restartID
+	statusRestartFormat           = "/status/restarts/%s/%s" // +restartID +memberName
+	lockPluginFormat              = "/locks/plugins/%s/%s"   // +pipelineName +leaseName
 
 	// the cluster name of this eg group will be registered under this path in etcd
 	// any new member(reader or writer ) will be rejected if it is configured a different cluster name
@@ -57,6 +97,12 @@ func (c *cluster) Layout() *Layout {
 	return c.layout
 }
 
+// ConfigEventKey returns the key of the events of config changes, every
+// change is a put of it.
+func (l *Layout) ConfigEventKey() string {
+	return eventConfigKey
+}
+
 // ClusterNameKey returns the key of the cluster name.
 func (l *Layout) ClusterNameKey() string {
 	return clusterNameKey
@@ -102,6 +148,50 @@ func (l *Layout) StatusObjectKey(name string) string {
 	return fmt.Sprintf(statusObjectFormat, name, l.memberName)
 }
 
+// StatusRateLimiterPrefix returns the prefix of the rate limiter status.
+func (l *Layout) StatusRateLimiterPrefix(name string) string {
+	return fmt.Sprintf(statusRateLimiterPrefixFormat, name)
+}
+
+// StatusRateLimiterKey returns the key of the rate limiter status of the member.
+func (l *Layout) StatusRateLimiterKey(name string) string {
+	return fmt.Sprintf(statusRateLimiterFormat, name, l.memberName)
+}
+
+// StatusCronTriggerKey returns the key of the last tick fired by the
+// cron trigger in the cluster.
+func (l *Layout) StatusCronTriggerKey(name string) string {
+	return fmt.Sprintf(statusCronTriggerFormat, name)
+}
+
+// CronTriggerLock returns the name of the cluster mutex of the cron trigger.
+func (l *Layout) CronTriggerLock(name string) string {
+	return fmt.Sprintf(lockCronTriggerFormat, name)
+}
+
+// DedupKey returns the key of a seen key of the dedup store.
+func (l *Layout) DedupKey(name, key string) string {
+	return fmt.Sprintf(dedupKeyFormat, name, key)
+}
+
+// BusTopicPrefix returns the prefix of the messages of the topic relayed
+// through the cluster.
+func (l *Layout) BusTopicPrefix(topic string) string {
+	return fmt.Sprintf(busTopicPrefixFormat, topic)
+}
+
+// BusMemberPrefix returns the prefix of the messages of the topic
+// published by own member.
+func (l *Layout) BusMemberPrefix(topic string) string {
+	return fmt.Sprintf(busMemberPrefixFormat, topic, l.memberName)
+}
+
+// BusMessageKey returns the key of a message of the topic published by
+// own member.
+func (l *Layout) BusMessageKey(topic string, seq int64) string {
+	return fmt.Sprintf(busMessageFormat, topic, l.memberName, seq)
+}
+
 // ConfigObjectPrefix returns the prefix of object config.
 func (l *Layout) ConfigObjectPrefix() string {
 	return configObjectPrefix
@@ -112,7 +202,169 @@ func (l *Layout) ConfigObjectKey(name string) string {
 	return fmt.Sprintf(configObjectFormat, name)
 }
 
+// ConfigObjectVersionPrefix returns the prefix of the versions of the object.
+func (l *Layout) ConfigObjectVersionPrefix(name string) string {
+	return fmt.Sprintf(configObjectVersionPrefix, name)
+}
+
+// ConfigObjectVersionKey returns the key of the version of the object.
+func (l *Layout) ConfigObjectVersionKey(name string, version int64) string {
+	return fmt.Sprintf(configObjectVersionFormat, name, version)
+}
+
+// ConfigHistoryPrefix returns the prefix of the revisions of the config.
+func (l *Layout) ConfigHistoryPrefix() string {
+	return configHistoryPrefix
+}
+
+// ConfigHistoryKey returns the key of the revision of the config.
+func (l *Layout) ConfigHistoryKey(revision int64) string {
+	return fmt.Sprintf(configHistoryFormat, revision)
+}
+
+// ConfigNamespacePrefix returns the prefix of namespace config.
+func (l *Layout) ConfigNamespacePrefix() string {
+	return configNamespacePrefix
+}
+
+// ConfigNamespaceKey returns the key of namespace config.
+func (l *Layout) ConfigNamespaceKey(name string) string {
+	return fmt.Sprintf(configNamespaceFormat, name)
+}
+
+// ConfigBlockPrefix returns the prefix of block config.
+func (l *Layout) ConfigBlockPrefix() string {
+	return configBlockPrefix
+}
+
+// ConfigBlockKey returns the key of block config.
+func (l *Layout) ConfigBlockKey(name string) string {
+	return fmt.Sprintf(configBlockFormat, name)
+}
+
+// ConfigConsumerPrefix returns the prefix of consumer config.
+func (l *Layout) ConfigConsumerPrefix() string {
+	return configConsumerPrefix
+}
+
+// ConfigConsumerKey returns the key of consumer config.
+func (l *Layout) ConfigConsumerKey(name string) string {
+	return fmt.Sprintf(configConsumerFormat, name)
+}
+
+// ConfigAPIKeyPrefix returns the prefix of API keys.
+func (l *Layout) ConfigAPIKeyPrefix() string {
+	return configAPIKeyPrefix
+}
+
+// ConfigAPIKeyKey returns the key of the API key.
+func (l *Layout) ConfigAPIKeyKey(id string) string {
+	return fmt.Sprintf(configAPIKeyFormat, id)
+}
+
+// ConfigCertificatePrefix returns the prefix of certificates.
+func (l *Layout) ConfigCertificatePrefix() string {
+	return configCertificatePrefix
+}
+
+// ConfigCertificateKey returns the key of the certificate.
+func (l *Layout) ConfigCertificateKey(name string) string {
+	return fmt.Sprintf(configCertificateFormat, name)
+}
+
+// ConfigFlagsPrefix returns the prefix of feature flags.
+func (l *Layout) ConfigFlagsPrefix() string {
+	return configFlagsPrefix
+}
+
+// ConfigFlagsKey returns the key of the feature flags of the pipeline.
+func (l *Layout) ConfigFlagsKey(pipeline string) string {
+	return fmt.Sprintf(configFlagsFormat, pipeline)
+}
+
+// ConfigOwnerKey returns the key of the objects owned by the owner.
+func (l *Layout) ConfigOwnerKey(owner string) string {
+	return fmt.Sprintf(configOwnerFormat, owner)
+}
+
+// ConfigOwnerLock returns the lock of syncing the objects of the owner.
+func (l *Layout) ConfigOwnerLock(owner string) string {
+	return fmt.Sprintf(lockConfigOwnerFormat, owner)
+}
+
+// StatusFederationPrefix returns the prefix of the reports of secondary
+// regions.
+func (l *Layout) StatusFederationPrefix() string {
+	return statusFederationPrefix
+}
+
+// StatusFederationKey returns the key of the report of the secondary region.
+func (l *Layout) StatusFederationKey(region string) string {
+	return fmt.Sprintf(statusFederationFormat, region)
+}
+
 // ConfigVersion returns the key of config version.
 func (l *Layout) ConfigVersion() string {
 	return configVersion
 }
+
+// StatusDeploymentPrefix returns the prefix of the preparation status of
+// the deployment in all members.
+func (l *Layout) StatusDeploymentPrefix(id string) string {
+	return fmt.Sprintf(statusDeploymentPrefixFormat, id)
+}
+
+// StatusDeploymentKey returns the key of the preparation status of the
+// deployment in this member.
+func (l *Layout) StatusDeploymentKey(id string) string {
+	return fmt.Sprintf(statusDeploymentFormat, id, l.memberName)
+}
+
+// DeploymentStagedKey returns the key of the staged deployment, which is
+// being prepared by all members.
+func (l *Layout) DeploymentStagedKey() string {
+	return deploymentStagedKey
+}
+
+// DeploymentPrefix returns the prefix of the records of deployments.
+func (l *Layout) DeploymentPrefix() string {
+	return deploymentPrefix
+}
+
+// DeploymentKey returns the key of the record of the deployment.
+func (l *Layout) DeploymentKey(id string) string {
+	return fmt.Sprintf(deploymentFormat, id)
+}
+
+// StatusRestartPrefix returns the prefix of the reports of the rolling
+// restart from all members.
+func (l *Layout) StatusRestartPrefix(id string) string {
+	return fmt.Sprintf(statusRestartPrefixFormat, id)
+}
+
+// StatusRestartKey returns the key of the report of the rolling restart
+// from this member.
+func (l *Layout) StatusRestartKey(id string) string {
+	return fmt.Sprintf(statusRestartFormat, id, l.memberName)
+}
+
+// RestartRunningKey returns the key of the running rolling restart, which
+// is watched by all members.
+func (l *Layout) RestartRunningKey() string {
+	return restartRunningKey
+}
+
+// RestartPrefix returns the prefix of the records of rolling restarts.
+func (l *Layout) RestartPrefix() string {
+	return restartPrefix
+}
+
+// RestartKey returns the key of the record of the rolling restart.
+func (l *Layout) RestartKey(id string) string {
+	return fmt.Sprintf(restartFormat, id)
+}
+
+// PluginLease returns the key of the lease of the plugins in the pipeline.
+func (l *Layout) PluginLease(pipeline, name string) string {
+	return fmt.Sprintf(lockPluginFormat, pipeline, name)
+}
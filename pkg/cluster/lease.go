@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+// Lease is a cluster level lease held by at most one member at a time.
+// Unlike Mutex, whose session lives as long as the member, the lease
+// expires in its TTL if the holder is down, so another member waiting
+// for it takes over.
+type Lease interface {
+	// Acquire blocks until this member holds the lease or ctx is done.
+	Acquire(ctx context.Context) error
+	// Done returns a channel closed once the lease isn't held, e.g. it
+	// can't be kept alive in its TTL, the holder must stop the work
+	// guarded by the lease then.
+	Done() <-chan struct{}
+	// Holder returns the member holding the lease, it's empty if none.
+	Holder() (string, error)
+	// Release releases the lease if it's held.
+	Release() error
+}
+
+type clusterLease struct {
+	c   *cluster
+	key string
+	ttl time.Duration
+
+	mutex    sync.Mutex
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+// closedChan is returned by Done of leases not held.
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func (c *cluster) Lease(name string, ttl time.Duration) (Lease, error) {
+	if ttl < time.Second {
+		return nil, fmt.Errorf("ttl of lease %s must be at least 1s", name)
+	}
+
+	return &clusterLease{
+		c:   c,
+		key: name,
+		ttl: ttl,
+	}, nil
+}
+
+func (l *clusterLease) Acquire(ctx context.Context) error {
+	l.mutex.Lock()
+	held := l.session != nil
+	if held {
+		select {
+		case <-l.session.Done():
+			held = false
+		default:
+		}
+	}
+	l.mutex.Unlock()
+	if held {
+		return nil
+	}
+
+	client, err := l.c.getClient()
+	if err != nil {
+		return err
+	}
+
+	session, err := concurrency.NewSession(client,
+		concurrency.WithTTL(int(l.ttl/time.Second)))
+	if err != nil {
+		return fmt.Errorf("create session failed: %v", err)
+	}
+
+	election := concurrency.NewElection(session, l.key)
+	err = election.Campaign(ctx, l.c.opt.Name)
+	if err != nil {
+		session.Close()
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.session != nil {
+		l.session.Close()
+	}
+	l.session, l.election = session, election
+
+	return nil
+}
+
+func (l *clusterLease) Done() <-chan struct{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.session == nil {
+		return closedChan
+	}
+	return l.session.Done()
+}
+
+func (l *clusterLease) Holder() (string, error) {
+	client, err := l.c.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	// NOTE: The holder is the earliest candidate, as Election.Leader
+	// does, which needs a session though.
+	resp, err := client.Get(l.c.requestContext(), l.key+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (l *clusterLease) Release() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.session == nil {
+		return nil
+	}
+
+	// NOTE: Closing the session revokes its lease, which deletes the key
+	// of the election as well, Resign makes it quicker.
+	err := l.election.Resign(l.c.requestContext())
+	l.session.Close()
+	l.session, l.election = nil, nil
+
+	return err
+}
@@ -18,6 +18,8 @@
 package cluster
 
 import (
+	"time"
+
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/mvcc/mvccpb"
 )
@@ -52,6 +54,38 @@ func (c *cluster) Put(key, value string) error {
 	return err
 }
 
+// PutIfAbsent stores data which expires after ttl only if the key
+// does not exist, it reports whether the data is stored.
+func (c *cluster) PutIfAbsent(key, value string, ttl time.Duration) (bool, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	seconds := int64(ttl / time.Second)
+	if ttl%time.Second != 0 {
+		seconds++
+	}
+	lease, err := client.Grant(c.requestContext(), seconds)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Txn(c.requestContext()).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+
+	if !resp.Succeeded {
+		client.Revoke(c.requestContext(), lease.ID)
+	}
+
+	return resp.Succeeded, nil
+}
+
 func (c *cluster) PutAndDeleteUnderLease(kvs map[string]*string) error {
 	return c.putAndDelete(kvs, true)
 }
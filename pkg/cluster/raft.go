@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+
+	"go.etcd.io/etcd/clientv3"
+)
+
+type (
+	// RaftStatus is the raft status of the etcd cluster storing the config.
+	// All config changes are proposed to the raft leader and committed once
+	// the quorum of voters accepts them, and reads are linearizable, so a
+	// partitioned minority refuses to change or serve stale config.
+	RaftStatus struct {
+		// Member is the ID of the etcd member answering the status.
+		Member string `yaml:"member"`
+		// Leader is empty if the answering member doesn't know any leader,
+		// the config can't be changed then.
+		Leader       string   `yaml:"leader,omitempty"`
+		LeaderName   string   `yaml:"leaderName,omitempty"`
+		Term         uint64   `yaml:"term"`
+		CommitIndex  uint64   `yaml:"commitIndex"`
+		AppliedIndex uint64   `yaml:"appliedIndex"`
+		Voters       int      `yaml:"voters"`
+		Quorum       int      `yaml:"quorum"`
+		Errors       []string `yaml:"errors,omitempty"`
+
+		Members []*RaftMember `yaml:"members"`
+	}
+
+	// RaftMember is a member of the etcd cluster.
+	RaftMember struct {
+		ID       string   `yaml:"id"`
+		Name     string   `yaml:"name"`
+		PeerURLs []string `yaml:"peerURLs"`
+		Learner  bool     `yaml:"learner,omitempty"`
+		Leader   bool     `yaml:"leader,omitempty"`
+	}
+)
+
+func raftID(id uint64) string {
+	return fmt.Sprintf("%x", id)
+}
+
+// RaftStatus returns the raft status of the etcd cluster, asking the
+// embedded etcd first for the writer, or the endpoints of the client in turn.
+func (c *cluster) RaftStatus() (*RaftStatus, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := client.Endpoints()
+	if c.opt.ClusterRole == "writer" && !c.external() && len(c.opt.ClusterAdvertiseClientURLs) != 0 {
+		endpoints = append([]string{c.opt.ClusterAdvertiseClientURLs[0]}, endpoints...)
+	}
+
+	var statusResp *clientv3.StatusResponse
+	for _, endpoint := range endpoints {
+		statusResp, err = client.Status(c.requestContext(), endpoint)
+		if err == nil {
+			break
+		}
+	}
+	if statusResp == nil {
+		return nil, fmt.Errorf("get status failed: %v", err)
+	}
+
+	listResp, err := client.MemberList(c.requestContext())
+	if err != nil {
+		return nil, fmt.Errorf("list members failed: %v", err)
+	}
+
+	status := &RaftStatus{
+		Member:       raftID(statusResp.Header.MemberId),
+		Term:         statusResp.RaftTerm,
+		CommitIndex:  statusResp.RaftIndex,
+		AppliedIndex: statusResp.RaftAppliedIndex,
+		Errors:       statusResp.Errors,
+	}
+	if statusResp.Leader != 0 {
+		status.Leader = raftID(statusResp.Leader)
+	}
+
+	for _, m := range listResp.Members {
+		member := &RaftMember{
+			ID:       raftID(m.ID),
+			Name:     m.Name,
+			PeerURLs: m.PeerURLs,
+			Learner:  m.IsLearner,
+			Leader:   m.ID == statusResp.Leader,
+		}
+		if member.Leader {
+			status.LeaderName = m.Name
+		}
+		if !m.IsLearner {
+			status.Voters++
+		}
+		status.Members = append(status.Members, member)
+	}
+	sort.Slice(status.Members, func(i, j int) bool {
+		return status.Members[i].Name < status.Members[j].Name
+	})
+	status.Quorum = status.Voters/2 + 1
+
+	return status, nil
+}
@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package configblock resolves references to shared config blocks in
+// object specs.
+//
+// A block is a named YAML value stored once in the cluster, e.g. the
+// servers of an upstream service or a TLS config. A reference is a string
+// value in the form of block:<name>, e.g. block:orders-service, it is
+// replaced by the value of the block, so changing the block changes all
+// objects referencing it. Blocks are synced from the cluster, and the
+// names of changed blocks are sent to the channel returned by Changes.
+package configblock
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const (
+	// ReferencePrefix is the prefix of block references.
+	ReferencePrefix = "block:"
+
+	pullInterval = time.Minute
+)
+
+type (
+	// Block is a named value shared by objects.
+	Block struct {
+		Name        string `yaml:"name" jsonschema:"required,format=urlname"`
+		Description string `yaml:"description,omitempty" jsonschema:"omitempty"`
+		// Value replaces the references to the block, it could be any
+		// YAML value, but must not reference other blocks.
+		Value interface{} `yaml:"value" jsonschema:"-"`
+	}
+
+	// Store keeps a copy of blocks synced from the cluster.
+	Store struct {
+		mutex  sync.RWMutex
+		blocks map[string]*Block
+
+		syncer  *cluster.Syncer
+		changes chan []string
+		done    chan struct{}
+	}
+)
+
+// Global is the global block store.
+var Global *Store
+
+// NewBlock creates a block from the YAML config and validates it.
+func NewBlock(config []byte) (*Block, error) {
+	b := &Block{}
+	err := yaml.UnmarshalStrict(config, b)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	vr := v.Validate(b, config)
+	if !vr.Valid() {
+		return nil, fmt.Errorf("validate failed: \n%w", vr)
+	}
+	if b.Value == nil {
+		return nil, fmt.Errorf("value of block %s is empty", b.Name)
+	}
+	if names := references(b.Value); len(names) != 0 {
+		return nil, fmt.Errorf("block %s references other blocks: %s", b.Name, strings.Join(names, ", "))
+	}
+
+	return b, nil
+}
+
+// IsReference reports whether s is a block reference.
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, ReferencePrefix)
+}
+
+// New creates a Store syncing blocks from the cluster. Blocks are pulled
+// once before it returns, since existing objects may reference them.
+func New(cls cluster.Cluster) *Store {
+	s := newStore()
+	Global = s
+
+	kvs, err := cls.GetPrefix(cls.Layout().ConfigBlockPrefix())
+	if err != nil {
+		logger.Errorf("get blocks failed: %v", err)
+	} else {
+		s.update(kvs)
+	}
+
+	syncer, err := cls.Syncer(pullInterval)
+	if err != nil {
+		logger.Errorf("create syncer failed: %v", err)
+		return s
+	}
+	s.syncer = syncer
+
+	ch, err := syncer.SyncPrefix(cls.Layout().ConfigBlockPrefix())
+	if err != nil {
+		logger.Errorf("sync blocks failed: %v", err)
+		return s
+	}
+
+	go func() {
+		for kvs := range ch {
+			changed := s.update(kvs)
+			if len(changed) == 0 {
+				continue
+			}
+			select {
+			case s.changes <- changed:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func newStore() *Store {
+	return &Store{
+		blocks:  map[string]*Block{},
+		changes: make(chan []string, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// update replaces the blocks, it returns the names of created, updated
+// and deleted blocks.
+func (s *Store) update(kvs map[string]string) []string {
+	blocks := make(map[string]*Block, len(kvs))
+	for k, v := range kvs {
+		b, err := NewBlock([]byte(v))
+		if err != nil {
+			logger.Errorf("invalid block %s: %v", k, err)
+			continue
+		}
+		blocks[b.Name] = b
+	}
+
+	s.mutex.Lock()
+	prev := s.blocks
+	s.blocks = blocks
+	s.mutex.Unlock()
+
+	changed := []string{}
+	for name, b := range blocks {
+		if p := prev[name]; p == nil || !reflect.DeepEqual(p.Value, b.Value) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range prev {
+		if _, exists := blocks[name]; !exists {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// Changes returns the channel receiving names of changed blocks.
+func (s *Store) Changes() <-chan []string {
+	return s.changes
+}
+
+// Get returns the block.
+func (s *Store) Get(name string) *Block {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.blocks[name]
+}
+
+// ResolveYAML replaces all references in the string values of the YAML
+// config by the blocks in the global Store, it returns the resolved
+// config and the names of blocks used. The config is returned as it is
+// if there is nothing to resolve.
+func ResolveYAML(config string) (string, []string, error) {
+	s := Global
+	if s == nil {
+		s = newStore()
+	}
+	return resolveYAML(config, s.Get)
+}
+
+// Resolve is like ResolveYAML, but it resolves the references by the
+// blocks, which are keyed by their names.
+func Resolve(config string, blocks map[string]*Block) (string, []string, error) {
+	return resolveYAML(config, func(name string) *Block { return blocks[name] })
+}
+
+// References returns the names of blocks referenced by the YAML config.
+func References(config string) []string {
+	if !strings.Contains(config, ReferencePrefix) {
+		return nil
+	}
+
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return nil
+	}
+	return references(doc)
+}
+
+func references(value interface{}) []string {
+	names := map[string]struct{}{}
+	collectReferences(value, names)
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func collectReferences(value interface{}, names map[string]struct{}) {
+	switch v := value.(type) {
+	case string:
+		if IsReference(v) {
+			names[strings.TrimPrefix(v, ReferencePrefix)] = struct{}{}
+		}
+	case map[interface{}]interface{}:
+		for _, item := range v {
+			collectReferences(item, names)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectReferences(item, names)
+		}
+	}
+}
+
+func resolveYAML(config string, get func(name string) *Block) (string, []string, error) {
+	if !strings.Contains(config, ReferencePrefix) {
+		return config, nil, nil
+	}
+
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return "", nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	names := references(doc)
+	if len(names) == 0 {
+		return config, nil, nil
+	}
+
+	doc, err = resolveValue(doc, get)
+	if err != nil {
+		return "", nil, err
+	}
+
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", nil, fmt.Errorf("marshal failed: %v", err)
+	}
+
+	return string(buff), names, nil
+}
+
+func resolveValue(value interface{}, get func(name string) *Block) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !IsReference(v) {
+			return v, nil
+		}
+		name := strings.TrimPrefix(v, ReferencePrefix)
+		b := get(name)
+		if b == nil {
+			return nil, fmt.Errorf("block %s not found", name)
+		}
+		return copyValue(b.Value), nil
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			resolved, err := resolveValue(item, get)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := resolveValue(item, get)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	}
+
+	return value, nil
+}
+
+// copyValue copies the value of a block, so the shared one is never
+// changed by its users.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for key, item := range v {
+			m[key] = copyValue(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, item := range v {
+			l[i] = copyValue(item)
+		}
+		return l
+	}
+
+	return value
+}
+
+// Close closes the Store.
+func (s *Store) Close(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	close(s.done)
+	if s.syncer != nil {
+		s.syncer.Close()
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configblock
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "configblock-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "configblock-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func mustNewBlock(t *testing.T, config string) *Block {
+	b, err := NewBlock([]byte(config))
+	if err != nil {
+		t.Fatalf("new block failed: %v", err)
+	}
+	return b
+}
+
+func TestNewBlock(t *testing.T) {
+	mustNewBlock(t, "name: orders-service\nvalue:\n- url: http://127.0.0.1:9095\n")
+
+	for _, config := range []string{
+		"name: orders-service\n",
+		"value: 1\n",
+		"name: orders-service\nvalue: 1\nunknown: 1\n",
+		"name: orders-service\nvalue:\n  servers: block:other\n",
+	} {
+		if _, err := NewBlock([]byte(config)); err == nil {
+			t.Errorf("want error for block %q", config)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	blocks := map[string]*Block{
+		"orders-service": mustNewBlock(t, `
+name: orders-service
+value:
+- url: http://127.0.0.1:9095
+- url: http://127.0.0.1:9096
+`),
+		"lb": mustNewBlock(t, `
+name: lb
+value:
+  policy: roundRobin
+`),
+	}
+
+	config := `
+name: proxy
+kind: Proxy
+mainPool:
+  servers: block:orders-service
+  loadBalance: block:lb
+candidatePools:
+- servers: block:orders-service
+  loadBalance: block:lb
+`
+	if got := References(config); !reflect.DeepEqual(got, []string{"lb", "orders-service"}) {
+		t.Errorf("want references [lb orders-service], got %v", got)
+	}
+
+	resolved, names, err := Resolve(config, blocks)
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"lb", "orders-service"}) {
+		t.Errorf("want names [lb orders-service], got %v", names)
+	}
+	if strings.Contains(resolved, ReferencePrefix) {
+		t.Errorf("want no references in %s", resolved)
+	}
+
+	doc := map[string]interface{}{}
+	err = yaml.Unmarshal([]byte(resolved), &doc)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	servers := doc["mainPool"].(map[interface{}]interface{})["servers"].([]interface{})
+	if len(servers) != 2 {
+		t.Errorf("want 2 servers, got %v", servers)
+	}
+
+	// The shared value must be copied for every reference.
+	servers[0].(map[interface{}]interface{})["url"] = "changed"
+	if blocks["orders-service"].Value.([]interface{})[0].(map[interface{}]interface{})["url"] == "changed" {
+		t.Errorf("want value of block unchanged")
+	}
+
+	unchanged, names, err := Resolve("name: proxy\nkind: Proxy\n", blocks)
+	if err != nil || names != nil || unchanged != "name: proxy\nkind: Proxy\n" {
+		t.Errorf("want config unchanged, got %q, %v, %v", unchanged, names, err)
+	}
+
+	_, _, err = Resolve("servers: block:unknown\n", blocks)
+	if err == nil {
+		t.Errorf("want error for unknown block")
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	s := newStore()
+	changed := s.update(map[string]string{
+		"/config/blocks/a": "name: a\nvalue: 1\n",
+		"/config/blocks/b": "name: b\nvalue: 2\n",
+	})
+	if !reflect.DeepEqual(changed, []string{"a", "b"}) {
+		t.Errorf("want changed [a b], got %v", changed)
+	}
+
+	changed = s.update(map[string]string{
+		"/config/blocks/a": "name: a\nvalue: 1\n",
+		"/config/blocks/c": "name: c\nvalue: 3\n",
+	})
+	if !reflect.DeepEqual(changed, []string{"b", "c"}) {
+		t.Errorf("want changed [b c], got %v", changed)
+	}
+	if s.Get("a") == nil || s.Get("b") != nil {
+		t.Errorf("want a kept and b deleted")
+	}
+}
@@ -49,6 +49,9 @@ type (
 		Unlock()
 
 		Span() tracing.Span
+		// SetSpan replaces the current span, e.g. by the span of the
+		// running filter, so the spans created after it are its children.
+		SetSpan(span tracing.Span)
 
 		Request() HTTPRequest
 		Response() HTTPReponse
@@ -74,6 +77,7 @@ type (
 
 		CallNextHandler(lastResult string) string
 		SetHandlerCaller(caller HandlerCaller)
+		HandlerCaller() HandlerCaller
 	}
 
 	// HTTPRequest is all operations for HTTP request.
@@ -144,6 +148,7 @@ type (
 
 		ht             *HTTPTemplate
 		tracer         opentracing.Tracer
+		spanMutex      sync.RWMutex
 		span           tracing.Span
 		originalReqCtx stdcontext.Context
 		stdctx         stdcontext.Context
@@ -165,7 +170,7 @@ func New(stdw http.ResponseWriter, stdr *http.Request,
 	return &httpContext{
 		startTime:      &startTime,
 		tracer:         tracer,
-		span:           tracing.NewSpan(tracer, spanName),
+		span:           tracing.NewSpanWithHeader(tracer, spanName, stdr.Header),
 		originalReqCtx: originalReqCtx,
 		stdctx:         stdctx,
 		cancelFunc:     cancelFunc,
@@ -183,6 +188,10 @@ func (ctx *httpContext) SetHandlerCaller(caller HandlerCaller) {
 	ctx.caller = caller
 }
 
+func (ctx *httpContext) HandlerCaller() HandlerCaller {
+	return ctx.caller
+}
+
 func (ctx *httpContext) Lock() {
 	ctx.mutex.Lock()
 }
@@ -191,10 +200,20 @@ func (ctx *httpContext) Unlock() {
 	ctx.mutex.Unlock()
 }
 
+// NOTE: The span could be read by goroutines of filters, e.g. mirrors of
+// Proxy, while the pipeline is switching it.
 func (ctx *httpContext) Span() tracing.Span {
+	ctx.spanMutex.RLock()
+	defer ctx.spanMutex.RUnlock()
 	return ctx.span
 }
 
+func (ctx *httpContext) SetSpan(span tracing.Span) {
+	ctx.spanMutex.Lock()
+	defer ctx.spanMutex.Unlock()
+	ctx.span = span
+}
+
 func (ctx *httpContext) AddTag(tag string) {
 	ctx.tags = append(ctx.tags, tag)
 }
@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crdt
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// Counter is a counter shared by members of the cluster. It's changed
+	// locally and converges in all members in the background, so its
+	// value lags behind the changes of other members by about a sync
+	// interval.
+	Counter interface {
+		// Add adds the delta to the counter, which could be negative.
+		Add(delta int64)
+		// Value returns the value of the counter in this member.
+		Value() int64
+	}
+
+	// SharedCounter is the Counter exchanging states by the Gossiper.
+	// Every member merges the states gossiped by others into its own, and
+	// gossips the merged state, so the changes of a member are kept by
+	// others after it's gone.
+	//
+	// The replica of a member is named by the member, so the state only
+	// grows with the members. Changes of the member since the process
+	// started are shared by the counters of the same name, e.g. the ones
+	// before and after reloading, and the count of the previous processes
+	// is learned from the states gossiped by others as the base of the
+	// replica.
+	SharedCounter struct {
+		gossiper *Gossiper
+		name     string
+		replica  string
+		window   time.Duration
+		ownKey   string
+		own      *ownCount
+
+		mutex sync.Mutex
+		state *PNCounter
+	}
+
+	// ownCount is the changes of the replica in this process, shared by
+	// the counters of the same name and window size.
+	ownCount struct {
+		refs int
+
+		mutex  sync.Mutex
+		window int64
+		p      int64
+		n      int64
+		// baseP and baseN are the increments and decrements of the
+		// previous processes in the window, learned from other members.
+		baseP  int64
+		baseN  int64
+		synced bool
+	}
+)
+
+var (
+	ownCountsMutex sync.Mutex
+	ownCounts      = map[string]*ownCount{}
+)
+
+func acquireOwnCount(key string) *ownCount {
+	ownCountsMutex.Lock()
+	defer ownCountsMutex.Unlock()
+
+	own := ownCounts[key]
+	if own == nil {
+		own = &ownCount{}
+		ownCounts[key] = own
+	}
+	own.refs++
+
+	return own
+}
+
+// releaseOwnCount releases the ownCount, it's removed after all counters
+// using it are closed, the changes are kept by other members then.
+func releaseOwnCount(key string) {
+	ownCountsMutex.Lock()
+	defer ownCountsMutex.Unlock()
+
+	own := ownCounts[key]
+	own.refs--
+	if own.refs == 0 {
+		delete(ownCounts, key)
+	}
+}
+
+// add adds the delta in the window.
+func (o *ownCount) add(window, delta int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.roll(window)
+	if window < o.window {
+		return
+	}
+	if delta >= 0 {
+		o.p += delta
+	} else {
+		o.n -= delta
+	}
+}
+
+// learn learns the base from the count of the replica in the states of
+// other members in the window.
+//
+// NOTE: The replica isn't gossiped by this process before the first
+// sync, so the count is all from the previous processes then. After that, the count
+// beyond the changes of this process is from the previous process still
+// draining after a graceful update, the changes of both processes in the
+// meantime are merged by the max rather than the sum, so some are lost.
+func (o *ownCount) learn(window, p, n int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.roll(window)
+	if window < o.window {
+		return
+	}
+
+	if !o.synced {
+		o.baseP, o.baseN, o.synced = p, n, true
+		return
+	}
+	if p-o.p > o.baseP {
+		o.baseP = p - o.p
+	}
+	if n-o.n > o.baseN {
+		o.baseN = n - o.n
+	}
+}
+
+// get returns the increments and decrements in the window.
+func (o *ownCount) get(window int64) (int64, int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.roll(window)
+	if window < o.window {
+		return 0, 0
+	}
+	return o.baseP + o.p, o.baseN + o.n
+}
+
+// isSynced reports whether the base has been learned.
+func (o *ownCount) isSynced() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.synced
+}
+
+func (o *ownCount) roll(window int64) {
+	if window > o.window {
+		o.window, o.p, o.n, o.baseP, o.baseN = window, 0, 0, 0, 0
+	}
+}
+
+// NewSharedCounter creates a SharedCounter of the name gossiped by the
+// Gossiper, it's reset at the start of every window, or never if the window
+// is 0.
+func NewSharedCounter(g *Gossiper, name string, window time.Duration) *SharedCounter {
+	c := &SharedCounter{
+		gossiper: g,
+		name:     name,
+		replica:  g.member,
+		window:   window,
+		ownKey:   fmt.Sprintf("%s/%d", name, window),
+		state:    NewPNCounter(WindowOf(time.Now(), window)),
+	}
+	c.own = acquireOwnCount(c.ownKey)
+	g.add(c)
+
+	return c
+}
+
+// Add adds the delta to the counter.
+func (c *SharedCounter) Add(delta int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.state.Roll(WindowOf(time.Now(), c.window))
+	c.own.add(c.state.Window, delta)
+	c.updateReplica()
+}
+
+// Value returns the value of the counter in this member.
+func (c *SharedCounter) Value() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.state.Roll(WindowOf(time.Now(), c.window))
+	c.updateReplica()
+	return c.state.Value()
+}
+
+// updateReplica updates the replica of this member in the state, the
+// caller must hold the lock.
+func (c *SharedCounter) updateReplica() {
+	p, n := c.own.get(c.state.Window)
+	delete(c.state.P, c.replica)
+	delete(c.state.N, c.replica)
+	if p > 0 {
+		c.state.Add(c.replica, p)
+	}
+	if n > 0 {
+		c.state.Add(c.replica, -n)
+	}
+}
+
+// gossipState returns a copy of the state to gossip.
+func (c *SharedCounter) gossipState() *PNCounter {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.state.Roll(WindowOf(time.Now(), c.window))
+	c.updateReplica()
+	state := c.state.Clone()
+
+	// NOTE: The replica is not gossiped before the base is learned,
+	// otherwise the changes of this process come back as the base.
+	if !c.own.isSynced() {
+		delete(state.P, c.replica)
+		delete(state.N, c.replica)
+	}
+	return state
+}
+
+// merge merges the states gossiped by other members into the counter.
+func (c *SharedCounter) merge(states []*PNCounter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.state.Roll(WindowOf(time.Now(), c.window))
+	for _, state := range states {
+		c.state.Merge(state)
+	}
+
+	// NOTE: The replica of this member is learned from the states of
+	// others before merging, the merged one is mixed with local changes.
+	var p, n int64
+	for _, state := range states {
+		if state.Window == c.state.Window {
+			p, n = max(p, state.P[c.replica]), max(n, state.N[c.replica])
+		}
+	}
+	c.own.learn(c.state.Window, p, n)
+	c.updateReplica()
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Close stops gossiping the counter, the state is gossiped at once if
+// it's the last counter of the name in this member.
+func (c *SharedCounter) Close() {
+	c.gossiper.remove(c)
+	releaseOwnCount(c.ownKey)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package crdt provides counters shared by members of the cluster, they
+// are changed locally without touching the cluster, and converge in all
+// members by gossiping their states in the background.
+//
+// Every member pushes the states of all its counters to a few random peers
+// every sync interval in one request, and merges the states in the
+// response, so the load of a member doesn't grow with the members, and
+// etcd is only used to learn the gossip addresses of members.
+package crdt
+
+import "time"
+
+type (
+	// PNCounter is a state based counter in a window, which converges
+	// however states are exchanged. Every replica only changes its own
+	// increments and decrements, and merging takes the max of every
+	// replica, so merging is commutative, associative and idempotent.
+	// A state in a later window supersedes the ones in earlier windows.
+	PNCounter struct {
+		Window int64            `yaml:"window"`
+		P      map[string]int64 `yaml:"p,omitempty"`
+		N      map[string]int64 `yaml:"n,omitempty"`
+	}
+)
+
+// NewPNCounter creates a PNCounter in the window.
+func NewPNCounter(window int64) *PNCounter {
+	return &PNCounter{
+		Window: window,
+		P:      map[string]int64{},
+		N:      map[string]int64{},
+	}
+}
+
+// WindowOf returns the window of the time, windows of the size are
+// aligned to the Unix epoch, it's always 0 if the size is 0.
+func WindowOf(t time.Time, size time.Duration) int64 {
+	if size <= 0 {
+		return 0
+	}
+	return t.UnixNano() / int64(size)
+}
+
+// Add adds the delta to the replica.
+func (c *PNCounter) Add(replica string, delta int64) {
+	if delta >= 0 {
+		c.P[replica] += delta
+	} else {
+		c.N[replica] -= delta
+	}
+}
+
+// Value returns the value of the counter.
+func (c *PNCounter) Value() int64 {
+	var value int64
+	for _, v := range c.P {
+		value += v
+	}
+	for _, v := range c.N {
+		value -= v
+	}
+	return value
+}
+
+// Roll resets the counter if the window is later than its window.
+func (c *PNCounter) Roll(window int64) {
+	if window > c.Window {
+		*c = *NewPNCounter(window)
+	}
+}
+
+// Merge merges the other state into the counter.
+func (c *PNCounter) Merge(other *PNCounter) {
+	if other.Window < c.Window {
+		return
+	}
+	c.Roll(other.Window)
+
+	mergeMax(c.P, other.P)
+	mergeMax(c.N, other.N)
+}
+
+func mergeMax(dst, src map[string]int64) {
+	for replica, v := range src {
+		if v > dst[replica] {
+			dst[replica] = v
+		}
+	}
+}
+
+// Clone returns a copy of the counter.
+func (c *PNCounter) Clone() *PNCounter {
+	clone := NewPNCounter(c.Window)
+	mergeMax(clone.P, c.P)
+	mergeMax(clone.N, c.N)
+	return clone
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crdt
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "crdt-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "crdt-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func TestPNCounter(t *testing.T) {
+	a, b := NewPNCounter(1), NewPNCounter(1)
+	a.Add("a", 5)
+	a.Add("a", -2)
+	b.Add("b", 4)
+
+	ab, ba := a.Clone(), b.Clone()
+	ab.Merge(b)
+	ba.Merge(a)
+	if ab.Value() != 7 || ba.Value() != 7 {
+		t.Errorf("want 7 in both orders, got %d and %d", ab.Value(), ba.Value())
+	}
+
+	ab.Merge(b)
+	ab.Merge(ab.Clone())
+	if ab.Value() != 7 {
+		t.Errorf("want 7 after merging again, got %d", ab.Value())
+	}
+
+	// Later changes of a replica supersede its earlier state.
+	a.Add("a", 1)
+	ab.Merge(a)
+	if ab.Value() != 8 {
+		t.Errorf("want 8, got %d", ab.Value())
+	}
+}
+
+func TestPNCounterWindow(t *testing.T) {
+	c := NewPNCounter(1)
+	c.Add("a", 5)
+
+	later := NewPNCounter(2)
+	later.Add("b", 1)
+	c.Merge(later)
+	if c.Window != 2 || c.Value() != 1 {
+		t.Errorf("want window 2 and value 1, got %d and %d", c.Window, c.Value())
+	}
+
+	earlier := NewPNCounter(1)
+	earlier.Add("a", 10)
+	c.Merge(earlier)
+	if c.Value() != 1 {
+		t.Errorf("want states of earlier windows ignored, got %d", c.Value())
+	}
+
+	c.Roll(3)
+	if c.Window != 3 || c.Value() != 0 {
+		t.Errorf("want window 3 and value 0, got %d and %d", c.Window, c.Value())
+	}
+	c.Roll(2)
+	if c.Window != 3 {
+		t.Errorf("want window 3 kept, got %d", c.Window)
+	}
+
+	now := time.Unix(120, 0)
+	if w := WindowOf(now, time.Minute); w != 2 {
+		t.Errorf("want window 2, got %d", w)
+	}
+	if w := WindowOf(now, 0); w != 0 {
+		t.Errorf("want window 0, got %d", w)
+	}
+}
+
+func newTestSharedCounter(replica string, own *ownCount) *SharedCounter {
+	return &SharedCounter{
+		replica: replica,
+		own:     own,
+		state:   NewPNCounter(0),
+	}
+}
+
+func TestSharedCounterMerge(t *testing.T) {
+	c := newTestSharedCounter("a", &ownCount{})
+	c.Add(3)
+
+	// The replica isn't gossiped before the base is learned.
+	if state := c.gossipState(); len(state.P) != 0 {
+		t.Errorf("want replica a not gossiped, got %v", state.P)
+	}
+
+	// The state of the previous process of this member, and another member.
+	previous, other := NewPNCounter(0), NewPNCounter(0)
+	previous.Add("a", 10)
+	other.Add("b", 2)
+	other.Add("b", -1)
+
+	c.merge([]*PNCounter{previous, other})
+	merged := c.gossipState()
+	if c.Value() != 14 || merged.Value() != 14 {
+		t.Errorf("want 14, got %d and %d", c.Value(), merged.Value())
+	}
+	if len(merged.P) != 2 {
+		t.Errorf("want replicas a and b, got %v", merged.P)
+	}
+
+	// The gossiped state is a copy.
+	c.Add(1)
+	if merged.Value() != 14 || c.Value() != 15 {
+		t.Errorf("want 14 and 15, got %d and %d", merged.Value(), c.Value())
+	}
+
+	// The state gossiped by itself is not counted again.
+	c.merge([]*PNCounter{merged, other})
+	if c.Value() != 15 {
+		t.Errorf("want 15, got %d", c.Value())
+	}
+}
+
+func TestSharedCounterReload(t *testing.T) {
+	own := &ownCount{}
+	prev := newTestSharedCounter("a", own)
+	prev.Add(2)
+
+	// The counter replacing the previous one before the first sync.
+	next := newTestSharedCounter("a", own)
+	prev.Add(1)
+	next.Add(-1)
+
+	prev.merge(nil)
+	if next.merge([]*PNCounter{prev.gossipState()}); next.Value() != 2 {
+		t.Errorf("want 2, got %d", next.Value())
+	}
+	if len(next.state.P) != 1 || len(next.state.N) != 1 {
+		t.Errorf("want only replica a, got %+v", next.state)
+	}
+}
+
+func newTestGossiper(t *testing.T, member string) (*Gossiper, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	g := newGossiper(member, 10*time.Millisecond)
+	g.wg.Add(1)
+	go g.serve(addr)
+	t.Cleanup(func() {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		g.Close(wg)
+	})
+
+	return g, addr
+}
+
+func waitValue(c Counter, want int64) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if c.Value() == want {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestGossip(t *testing.T) {
+	a, addrA := newTestGossiper(t, "a")
+	b, addrB := newTestGossiper(t, "b")
+	c, addrC := newTestGossiper(t, "c")
+
+	// NOTE: c only knows b, so the state of a reaches c through b.
+	a.updatePeers(map[string]string{
+		"a": "options:\n  name: a\n  gossip-addr: " + addrA,
+		"b": "options:\n  name: b\n  gossip-addr: " + addrB,
+	})
+	b.updatePeers(map[string]string{
+		"a": "options:\n  name: a\n  gossip-addr: " + addrA,
+		"c": "options:\n  name: c\n  gossip-addr: " + addrC,
+	})
+	c.updatePeers(map[string]string{
+		"b": "options:\n  name: b\n  gossip-addr: " + addrB,
+	})
+
+	ca := NewSharedCounter(a, "pipeline/requests", time.Hour)
+	cb := NewSharedCounter(b, "pipeline/requests", time.Hour)
+	cc := NewSharedCounter(c, "pipeline/requests", time.Hour)
+	other := NewSharedCounter(c, "pipeline/others", time.Hour)
+	defer other.Close()
+
+	ca.Add(3)
+	cb.Add(2)
+	cc.Add(-1)
+	for _, counter := range []*SharedCounter{ca, cb, cc} {
+		if !waitValue(counter, 4) {
+			t.Errorf("want 4 in %s, got %d", counter.replica, counter.Value())
+		}
+	}
+	if other.Value() != 0 {
+		t.Errorf("want other counters not changed, got %d", other.Value())
+	}
+
+	// The changes of a member are kept by others after it's gone.
+	ca.Add(1)
+	ca.Close()
+	if !waitValue(cc, 5) {
+		t.Errorf("want 5 after a is gone, got %d", cc.Value())
+	}
+	cb.Close()
+	cc.Close()
+}
@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crdt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const (
+	// DefaultSyncInterval is the default interval of gossip rounds.
+	DefaultSyncInterval = time.Second
+
+	// gossipPath is the path exchanging states of counters.
+	gossipPath = "/counters"
+
+	// gossipFanout is the number of peers exchanged with every round.
+	gossipFanout = 2
+
+	// maxGossipBodySize is the max size of the states exchanged at once.
+	maxGossipBodySize = 16 * 1024 * 1024
+
+	// peersPullInterval is the interval pulling members from the cluster,
+	// besides watching them.
+	peersPullInterval = 10 * time.Second
+)
+
+// Global is the global gossiper.
+var Global *Gossiper
+
+type (
+	// Gossiper exchanges states of the shared counters with other members
+	// directly, the cluster is only used to learn the gossip addresses of
+	// members. Every round it pushes the states of all counters to a few
+	// random peers in one request, and merges the states of the same
+	// counters in the response, so states spread to all members in a few
+	// rounds however many members there are.
+	Gossiper struct {
+		member   string
+		interval time.Duration
+		client   *http.Client
+		syncer   *cluster.Syncer
+		done     chan struct{}
+		wg       sync.WaitGroup
+
+		mutex sync.Mutex
+		// peers are the gossip addresses of other members by name.
+		peers    map[string]string
+		counters map[string][]*SharedCounter
+	}
+
+	// gossipStates are the states of counters by name.
+	gossipStates map[string]*PNCounter
+)
+
+// NewGossiper creates the global Gossiper of the member, it serves gossip
+// on the gossip-addr of the options, and gossips with the members in the
+// cluster. Counters are still shared by the ones in this member if the
+// address is empty.
+func NewGossiper(opt *option.Options, cls cluster.Cluster) *Gossiper {
+	g := newGossiper(opt.Name, DefaultSyncInterval)
+	Global = g
+
+	if opt.GossipAddr == "" {
+		logger.Warnf("gossip-addr is empty, shared counters are not shared with other members")
+		return g
+	}
+
+	g.wg.Add(1)
+	go g.serve(opt.GossipAddr)
+
+	syncer, err := cls.Syncer(peersPullInterval)
+	if err != nil {
+		logger.Errorf("create syncer failed: %v", err)
+		return g
+	}
+	g.syncer = syncer
+
+	ch, err := syncer.SyncPrefix(cls.Layout().StatusMemberPrefix())
+	if err != nil {
+		logger.Errorf("sync members failed: %v", err)
+		return g
+	}
+	go func() {
+		for kvs := range ch {
+			g.updatePeers(kvs)
+		}
+	}()
+
+	return g
+}
+
+func newGossiper(member string, interval time.Duration) *Gossiper {
+	g := &Gossiper{
+		member:   member,
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+		done:     make(chan struct{}),
+		peers:    map[string]string{},
+		counters: map[string][]*SharedCounter{},
+	}
+
+	g.wg.Add(1)
+	go g.run()
+
+	return g
+}
+
+// serve serves gossip on the address until the gossiper is closed.
+//
+// NOTE: The address is still taken by the previous process in a graceful
+// update, so listening is retried until it's released.
+func (g *Gossiper) serve(addr string) {
+	defer g.wg.Done()
+
+	var listener net.Listener
+	for {
+		var err error
+		listener, err = net.Listen("tcp", addr)
+		if err == nil {
+			break
+		}
+		logger.Warnf("listen gossip on %s failed, retry later: %v", addr, err)
+
+		select {
+		case <-g.done:
+			return
+		case <-time.After(peersPullInterval):
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(gossipPath, g.handle)
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-g.done
+		server.Close()
+	}()
+
+	logger.Infof("gossip server running in %s", addr)
+	server.Serve(listener)
+}
+
+// updatePeers updates the peers by the statuses of members.
+func (g *Gossiper) updatePeers(kvs map[string]string) {
+	peers := map[string]string{}
+	for k, v := range kvs {
+		status := &cluster.MemberStatus{}
+		err := yaml.Unmarshal([]byte(v), status)
+		if err != nil {
+			logger.Errorf("unmarshal member status %s failed: %v", k, err)
+			continue
+		}
+
+		name, addr := status.Options.Name, status.Options.GossipAddr
+		if name != g.member && addr != "" {
+			peers[name] = addr
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.peers = peers
+}
+
+func (g *Gossiper) run() {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+			g.round()
+		}
+	}
+}
+
+// round exchanges the states of all counters with random peers.
+func (g *Gossiper) round() {
+	g.mutex.Lock()
+	addrs := g._pickPeers()
+	states := g._states(nil)
+	g.mutex.Unlock()
+
+	if len(states) == 0 {
+		return
+	}
+	for _, addr := range addrs {
+		g.exchange(addr, states)
+	}
+}
+
+// _pickPeers returns the addresses of gossipFanout random peers at most.
+// The caller must hold the lock.
+func (g *Gossiper) _pickPeers() []string {
+	addrs := make([]string, 0, len(g.peers))
+	for _, addr := range g.peers {
+		addrs = append(addrs, addr)
+	}
+
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	if len(addrs) > gossipFanout {
+		addrs = addrs[:gossipFanout]
+	}
+	return addrs
+}
+
+// exchange pushes the states to the peer, and merges the states of the
+// same counters in the response.
+func (g *Gossiper) exchange(addr string, states gossipStates) {
+	buff, err := yaml.Marshal(states)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to yaml failed: %v", states, err)
+		return
+	}
+
+	resp, err := g.client.Post("http://"+addr+gossipPath, "text/vnd.yaml", bytes.NewReader(buff))
+	if err != nil {
+		logger.Warnf("gossip with %s failed: %v", addr, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Warnf("gossip with %s failed: status code %d", addr, resp.StatusCode)
+		return
+	}
+
+	peerStates, err := readStates(resp.Body)
+	if err != nil {
+		logger.Warnf("gossip with %s failed: %v", addr, err)
+		return
+	}
+	g.merge(peerStates)
+}
+
+// handle merges the states pushed by a peer, and responds with the merged
+// states of the same counters.
+func (g *Gossiper) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	states, err := readStates(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g.merge(states)
+
+	g.mutex.Lock()
+	states = g._states(states)
+	g.mutex.Unlock()
+
+	buff, err := yaml.Marshal(states)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to yaml failed: %v", states, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func readStates(body io.Reader) (gossipStates, error) {
+	buff, err := ioutil.ReadAll(io.LimitReader(body, maxGossipBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read states failed: %v", err)
+	}
+	if len(buff) > maxGossipBodySize {
+		return nil, fmt.Errorf("states exceed %dB", maxGossipBodySize)
+	}
+
+	states := gossipStates{}
+	err = yaml.Unmarshal(buff, &states)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal states failed: %v", err)
+	}
+	return states, nil
+}
+
+// _states returns the states of the counters in this member, only the ones
+// in names if it's not nil. The caller must hold the lock.
+func (g *Gossiper) _states(names gossipStates) gossipStates {
+	states := gossipStates{}
+	for name, counters := range g.counters {
+		if names != nil && names[name] == nil {
+			continue
+		}
+
+		// NOTE: Counters of the same name are merged, e.g. the ones before
+		// and after reloading, they have the same replica of this member.
+		state := counters[0].gossipState()
+		for _, c := range counters[1:] {
+			state.Merge(c.gossipState())
+		}
+		states[name] = state
+	}
+	return states
+}
+
+// merge merges the states into the counters of the same names.
+func (g *Gossiper) merge(states gossipStates) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for name, state := range states {
+		if state == nil {
+			continue
+		}
+		for _, c := range g.counters[name] {
+			c.merge([]*PNCounter{state})
+		}
+	}
+}
+
+func (g *Gossiper) add(c *SharedCounter) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.counters[c.name] = append(g.counters[c.name], c)
+}
+
+// remove removes the counter, the state of the last counter of the name
+// is pushed to peers at once, since the changes since the last round are
+// lost otherwise.
+func (g *Gossiper) remove(c *SharedCounter) {
+	g.mutex.Lock()
+	counters := g.counters[c.name]
+	for i := range counters {
+		if counters[i] == c {
+			counters = append(counters[:i:i], counters[i+1:]...)
+			break
+		}
+	}
+	if len(counters) != 0 {
+		g.counters[c.name] = counters
+		g.mutex.Unlock()
+		return
+	}
+	delete(g.counters, c.name)
+	addrs := g._pickPeers()
+	g.mutex.Unlock()
+
+	states := gossipStates{c.name: c.gossipState()}
+	for _, addr := range addrs {
+		g.exchange(addr, states)
+	}
+}
+
+// Close stops gossiping, the counters must be closed before it.
+func (g *Gossiper) Close(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	close(g.done)
+	g.wg.Wait()
+
+	if g.syncer != nil {
+		g.syncer.Close()
+	}
+}
@@ -52,6 +52,13 @@ func InitServerDir(opt *option.Options) error {
 		return err
 	}
 
+	if opt.AbsPluginDir != "" {
+		err = common.MkdirAll(opt.AbsPluginDir)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
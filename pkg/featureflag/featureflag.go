@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package featureflag keeps the feature flags of pipelines, which are set
+// by the admin API at runtime and stored in the cluster, so filters could
+// switch risky behaviors on and off without changing the specs, e.g. for
+// rolling them out gradually.
+package featureflag
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const pullInterval = time.Minute
+
+type (
+	// Flags are the feature flags of a pipeline.
+	Flags struct {
+		Pipeline string          `yaml:"pipeline" jsonschema:"required"`
+		Flags    map[string]bool `yaml:"flags" jsonschema:"omitempty"`
+	}
+
+	// Store keeps a copy of flags synced from the cluster.
+	Store struct {
+		mutex sync.RWMutex
+		flags map[string]*Flags
+
+		syncer *cluster.Syncer
+	}
+)
+
+// Global is the global flag store.
+var Global *Store
+
+// NewFlags creates flags from the YAML config and validates them.
+func NewFlags(config []byte) (*Flags, error) {
+	f := &Flags{}
+	err := yaml.UnmarshalStrict(config, f)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	vr := v.Validate(f, config)
+	if !vr.Valid() {
+		return nil, fmt.Errorf("validate flags failed: \n%s", vr)
+	}
+	for name := range f.Flags {
+		if name == "" {
+			return nil, fmt.Errorf("empty flag name")
+		}
+	}
+
+	return f, nil
+}
+
+// Names returns the names of the flags sorted.
+func (f *Flags) Names() []string {
+	names := make([]string, 0, len(f.Flags))
+	for name := range f.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates a Store syncing flags from the cluster.
+func New(cls cluster.Cluster) *Store {
+	s := &Store{flags: map[string]*Flags{}}
+	Global = s
+
+	syncer, err := cls.Syncer(pullInterval)
+	if err != nil {
+		logger.Errorf("create syncer failed: %v", err)
+		return s
+	}
+	s.syncer = syncer
+
+	ch, err := syncer.SyncPrefix(cls.Layout().ConfigFlagsPrefix())
+	if err != nil {
+		logger.Errorf("sync flags failed: %v", err)
+		return s
+	}
+
+	go func() {
+		for kvs := range ch {
+			s.update(kvs)
+		}
+	}()
+
+	return s
+}
+
+func (s *Store) update(kvs map[string]string) {
+	flags := make(map[string]*Flags, len(kvs))
+	for k, v := range kvs {
+		f, err := NewFlags([]byte(v))
+		if err != nil {
+			logger.Errorf("invalid flags %s: %v", k, err)
+			continue
+		}
+		flags[f.Pipeline] = f
+	}
+
+	s.mutex.Lock()
+	s.flags = flags
+	s.mutex.Unlock()
+}
+
+// Enabled reports whether the flag of the pipeline is enabled.
+func (s *Store) Enabled(pipeline, flag string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	f := s.flags[pipeline]
+	return f != nil && f.Flags[flag]
+}
+
+// Enabled reports whether the flag of the pipeline is enabled in the
+// global store, flags are disabled if the store is not available.
+func Enabled(pipeline, flag string) bool {
+	s := Global
+	return s != nil && s.Enabled(pipeline, flag)
+}
+
+// Close closes the Store.
+func (s *Store) Close(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if s.syncer != nil {
+		s.syncer.Close()
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "featureflag-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "featureflag-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func TestStore(t *testing.T) {
+	if _, err := NewFlags([]byte("flags: {a: true}")); err == nil {
+		t.Errorf("want error for missing pipeline")
+	}
+	if _, err := NewFlags([]byte("pipeline: p\nflags: {a: yes-please}")); err == nil {
+		t.Errorf("want error for non-bool flag")
+	}
+
+	s := &Store{flags: map[string]*Flags{}}
+	s.update(map[string]string{
+		"/config/flags/p":     "pipeline: p\nflags: {verbose: true, streaming: false}",
+		"/config/flags/bad":   "pipeline: [",
+		"/config/flags/other": "pipeline: other\nflags: {streaming: true}",
+	})
+
+	if !s.Enabled("p", "verbose") || s.Enabled("p", "streaming") || s.Enabled("p", "missing") {
+		t.Errorf("unexpected flags of p")
+	}
+	if !s.Enabled("other", "streaming") || s.Enabled("bad", "verbose") {
+		t.Errorf("unexpected flags of other pipelines")
+	}
+
+	Global = nil
+	if Enabled("p", "verbose") {
+		t.Errorf("want flags disabled without the global store")
+	}
+}
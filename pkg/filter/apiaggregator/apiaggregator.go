@@ -24,7 +24,6 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -43,6 +42,10 @@ const (
 	Kind = "APIAggregator"
 
 	resultFailed = "failed"
+
+	mergeStrategyAll          = "all"
+	mergeStrategyFirstSuccess = "firstSuccess"
+	mergeStrategyQuorum       = "quorum"
 )
 
 var (
@@ -69,6 +72,13 @@ type (
 		Timeout        string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
 		MergeResponse  bool   `yaml:"mergeResponse"`
 
+		// MergeStrategy decides which responses are aggregated:
+		// all of them, the first successful one, or the first Quorum
+		// successful ones. A response is successful if its status code
+		// is 2xx.
+		MergeStrategy string `yaml:"mergeStrategy" jsonschema:"omitempty,enum=,enum=all,enum=firstSuccess,enum=quorum"`
+		Quorum        int    `yaml:"quorum" jsonschema:"omitempty,minimum=1"`
+
 		// User describes HTTP service target via an existing HTTPProxy
 		APIProxies []*APIProxy `yaml:"apiProxies" jsonschema:"required"`
 
@@ -88,8 +98,29 @@ type (
 
 		pa *pathadaptor.PathAdaptor
 	}
+
+	branchResponse struct {
+		index int
+		resp  context.HTTPReponse
+	}
 )
 
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	switch s.MergeStrategy {
+	case mergeStrategyQuorum:
+		if s.Quorum == 0 || s.Quorum > len(s.APIProxies) {
+			return fmt.Errorf("quorum must be in [1, %d]", len(s.APIProxies))
+		}
+	default:
+		if s.Quorum != 0 {
+			return fmt.Errorf("quorum is only for merge strategy %s", mergeStrategyQuorum)
+		}
+	}
+
+	return nil
+}
+
 // Kind returns the kind of APIAggregator.
 func (aa *APIAggregator) Kind() string {
 	return Kind
@@ -98,8 +129,9 @@ func (aa *APIAggregator) Kind() string {
 // DefaultSpec returns default spec of APIAggregator.
 func (aa *APIAggregator) DefaultSpec() interface{} {
 	return &Spec{
-		Timeout:      "60s",
-		MaxBodyBytes: 10240,
+		Timeout:       "60s",
+		MaxBodyBytes:  10240,
+		MergeStrategy: mergeStrategyAll,
 	}
 }
 
@@ -123,7 +155,6 @@ func (aa *APIAggregator) Init(pipeSpec *httppipeline.FilterSpec, super *supervis
 func (aa *APIAggregator) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	aa.Init(pipeSpec, super)
 }
 
@@ -167,60 +198,66 @@ func (aa *APIAggregator) handle(ctx context.HTTPContext) (result string) {
 		}
 	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(len(aa.spec.APIProxies))
+	// NOTE: Branches not needed by the merge strategy are canceled
+	// once the handling returns.
+	var stdctx stdcontext.Context = ctx
+	var cancel stdcontext.CancelFunc
+	if aa.spec.timeout != nil {
+		stdctx, cancel = stdcontext.WithTimeout(stdctx, *aa.spec.timeout)
+	} else {
+		stdctx, cancel = stdcontext.WithCancel(stdctx)
+	}
+	defer cancel()
 
-	httpResps := make([]context.HTTPReponse, len(aa.spec.APIProxies))
+	respCh := make(chan *branchResponse, len(aa.spec.APIProxies))
 	// Using supervisor to call HTTPProxy object's Handle function
 	for i, proxy := range aa.spec.APIProxies {
-		req, err := aa.newHTTPReq(ctx, proxy, buff)
+		req, err := aa.newHTTPReq(stdctx, ctx, proxy, buff)
 
 		if err != nil {
-			logger.Errorf("BUG: new HTTPProxy request failed %v proxyname[%d]", err, aa.spec.APIProxies[i].HTTPProxyName)
+			logger.Errorf("BUG: new HTTPProxy request failed %v proxyname[%s]", err, aa.spec.APIProxies[i].HTTPProxyName)
 			ctx.Response().SetStatusCode(http.StatusBadRequest)
 			return resultFailed
 		}
 
 		go func(i int, name string, req *http.Request) {
-			defer wg.Done()
-			copyCtx, err := aa.newCtx(ctx, req, buff)
-
-			if err != nil {
-				httpResps[i] = nil
-				return
-			}
-			ro, exists := supervisor.Global.GetRunningObject(name, supervisor.CategoryPipeline)
-			if !exists {
-				httpResps[i] = nil
-			} else {
-				handler, ok := ro.Instance().(protocol.HTTPHandler)
-				if !ok {
-					httpResps[i] = nil
-				} else {
-					handler.Handle(copyCtx)
-					httpResps[i] = copyCtx.Response()
-				}
-			}
-
+			respCh <- &branchResponse{index: i, resp: aa.callPipeline(name, req)}
 		}(i, proxy.HTTPProxyName, req)
 	}
 
-	wg.Wait()
+	httpResps, received := aa.collect(respCh)
+	go drain(respCh, len(aa.spec.APIProxies)-received)
 
 	for _, resp := range httpResps {
-		_resp := resp
-
 		if resp != nil {
-			if body, ok := _resp.Body().(io.ReadCloser); ok {
+			if body, ok := resp.Body().(io.ReadCloser); ok {
 				defer body.Close()
 			}
 		}
 	}
 
+	if aa.partial() {
+		succeeded := 0
+		for _, resp := range httpResps {
+			if resp != nil {
+				succeeded++
+			}
+		}
+		if succeeded == 0 {
+			ctx.AddTag(fmt.Sprintf("apiAggregator: merge strategy %s not satisfied",
+				aa.spec.MergeStrategy))
+			ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+			return resultFailed
+		}
+	}
+
 	data := make(map[string][]byte)
 
 	// Get all HTTPProxy response' body
 	for i, resp := range httpResps {
+		if resp == nil && aa.partial() {
+			continue
+		}
 		if resp == nil && !aa.spec.PartialSucceed {
 			ctx.AddTag(fmt.Sprintf("apiAggregator: failed in HTTPProxy %s",
 				aa.spec.APIProxies[i].HTTPProxyName))
@@ -241,28 +278,99 @@ func (aa *APIAggregator) handle(ctx context.HTTPContext) (result string) {
 
 }
 
-func (aa *APIAggregator) newCtx(ctx context.HTTPContext, req *http.Request, buff *bytes.Buffer) (context.HTTPContext, error) {
-	// Construct a new context for the HTTPProxy
-	// responseWriter is an HTTP responseRecorder, no the original context's real
-	// repsonseWriter, or these Proxies will overwriten each others
-	w := httptest.NewRecorder()
-	var stdctx stdcontext.Context = ctx
-	if aa.spec.timeout != nil {
-		stdctx, _ = stdcontext.WithTimeout(stdctx, *aa.spec.timeout)
+// callPipeline calls the pipeline with a new context, whose response
+// writer is a recorder, so the responses don't overwrite each other.
+func (aa *APIAggregator) callPipeline(name string, req *http.Request) context.HTTPReponse {
+	ro, exists := supervisor.Global.GetRunningObject(name, supervisor.CategoryPipeline)
+	if !exists {
+		return nil
+	}
+
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		return nil
 	}
 
-	copyCtx := context.New(w, req, tracing.NoopTracing, "no trace")
+	copyCtx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	handler.Handle(copyCtx)
 
-	return copyCtx, nil
+	return copyCtx.Response()
 }
 
-func (aa *APIAggregator) newHTTPReq(ctx context.HTTPContext, proxy *APIProxy, buff *bytes.Buffer) (*http.Request, error) {
-	var stdctx stdcontext.Context = ctx
-	if aa.spec.timeout != nil {
-		// NOTE: Cancel function could be omiited here.
-		stdctx, _ = stdcontext.WithTimeout(stdctx, *aa.spec.timeout)
+// partial reports whether the merge strategy aggregates only part of
+// the responses.
+func (aa *APIAggregator) partial() bool {
+	return aa.spec.MergeStrategy == mergeStrategyFirstSuccess ||
+		aa.spec.MergeStrategy == mergeStrategyQuorum
+}
+
+// collect receives responses of branches until the merge strategy is
+// satisfied or all branches respond. It returns the responses to merge
+// indexed by branch, and the number of received responses. For partial
+// strategies, only successful responses are returned, and they are
+// returned only if the strategy is satisfied.
+func (aa *APIAggregator) collect(respCh <-chan *branchResponse) ([]context.HTTPReponse, int) {
+	total := len(aa.spec.APIProxies)
+	httpResps := make([]context.HTTPReponse, total)
+
+	if !aa.partial() {
+		for i := 0; i < total; i++ {
+			br := <-respCh
+			httpResps[br.index] = br.resp
+		}
+		return httpResps, total
 	}
 
+	want := 1
+	if aa.spec.MergeStrategy == mergeStrategyQuorum {
+		want = aa.spec.Quorum
+	}
+
+	succeeded, received := 0, 0
+	for succeeded < want && total-received >= want-succeeded {
+		br := <-respCh
+		received++
+		if successful(br.resp) {
+			httpResps[br.index] = br.resp
+			succeeded++
+		} else {
+			closeBody(br.resp)
+		}
+	}
+
+	if succeeded < want {
+		for i, resp := range httpResps {
+			closeBody(resp)
+			httpResps[i] = nil
+		}
+	}
+
+	return httpResps, received
+}
+
+// drain closes responses of the n branches not needed any more.
+func drain(respCh <-chan *branchResponse, n int) {
+	for i := 0; i < n; i++ {
+		closeBody((<-respCh).resp)
+	}
+}
+
+func successful(resp context.HTTPReponse) bool {
+	return resp != nil && resp.StatusCode() >= 200 && resp.StatusCode() < 300
+}
+
+func closeBody(resp context.HTTPReponse) {
+	if resp == nil {
+		return
+	}
+	if body, ok := resp.Body().(io.Closer); ok {
+		body.Close()
+	}
+}
+
+func (aa *APIAggregator) newHTTPReq(stdctx stdcontext.Context, ctx context.HTTPContext,
+	proxy *APIProxy, buff *bytes.Buffer) (*http.Request, error) {
+
 	method := ctx.Request().Method()
 	if proxy.Method != "" {
 		method = proxy.Method
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apiaggregator
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+)
+
+func newResponse(code int) context.HTTPReponse {
+	r, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	ctx := filtertest.NewContext(r)
+	ctx.Response().SetStatusCode(code)
+	return ctx.Response()
+}
+
+func newAggregator(strategy string, quorum, proxies int) *APIAggregator {
+	spec := &Spec{MergeStrategy: strategy, Quorum: quorum}
+	for i := 0; i < proxies; i++ {
+		spec.APIProxies = append(spec.APIProxies, &APIProxy{})
+	}
+	return &APIAggregator{spec: spec}
+}
+
+func sendResponses(codes ...int) chan *branchResponse {
+	respCh := make(chan *branchResponse, len(codes))
+	for i, code := range codes {
+		var resp context.HTTPReponse
+		if code != 0 {
+			resp = newResponse(code)
+		}
+		respCh <- &branchResponse{index: i, resp: resp}
+	}
+	return respCh
+}
+
+func countResponses(resps []context.HTTPReponse) int {
+	n := 0
+	for _, resp := range resps {
+		if resp != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCollect(t *testing.T) {
+	cases := []struct {
+		strategy string
+		quorum   int
+		codes    []int
+		received int
+		merged   int
+	}{
+		{strategy: mergeStrategyAll, codes: []int{200, 0, 500}, received: 3, merged: 2},
+		{strategy: mergeStrategyFirstSuccess, codes: []int{500, 200, 200}, received: 2, merged: 1},
+		{strategy: mergeStrategyFirstSuccess, codes: []int{500, 0, 404}, received: 3, merged: 0},
+		{strategy: mergeStrategyQuorum, quorum: 2, codes: []int{200, 503, 200, 200}, received: 3, merged: 2},
+		{strategy: mergeStrategyQuorum, quorum: 3, codes: []int{503, 0, 200, 200}, received: 2, merged: 0},
+	}
+
+	for i, c := range cases {
+		aa := newAggregator(c.strategy, c.quorum, len(c.codes))
+		resps, received := aa.collect(sendResponses(c.codes...))
+		if received != c.received {
+			t.Errorf("case %d: expected %d received, got %d", i, c.received, received)
+		}
+		if n := countResponses(resps); n != c.merged {
+			t.Errorf("case %d: expected %d merged, got %d", i, c.merged, n)
+		}
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	if err := newAggregator(mergeStrategyQuorum, 2, 3).spec.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := newAggregator(mergeStrategyQuorum, 4, 3).spec.Validate(); err == nil {
+		t.Errorf("expected error for quorum larger than branches")
+	}
+	if err := newAggregator(mergeStrategyAll, 1, 3).spec.Validate(); err == nil {
+		t.Errorf("expected error for quorum without quorum strategy")
+	}
+}
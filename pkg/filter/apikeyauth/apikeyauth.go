@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apikeyauth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of APIKeyAuth.
+	Kind = "APIKeyAuth"
+
+	resultUnauthorized  = "unauthorized"
+	resultQuotaExceeded = "quotaExceeded"
+
+	defaultHeader         = "X-API-Key"
+	defaultConsumerHeader = "X-Consumer-Name"
+)
+
+var results = []string{resultUnauthorized, resultQuotaExceeded}
+
+func init() {
+	httppipeline.Register(&APIKeyAuth{})
+}
+
+type (
+	// APIKeyAuth validates API keys managed by the admin API, and attaches
+	// the identity of the consumer to the request.
+	APIKeyAuth struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		store *store
+	}
+
+	// Spec describes the APIKeyAuth.
+	Spec struct {
+		// Header is the header carrying the key, default is X-API-Key.
+		Header string `yaml:"header" jsonschema:"omitempty"`
+		// Query is the query parameter carrying the key, it is used
+		// only if the header is absent.
+		Query string `yaml:"query" jsonschema:"omitempty"`
+		// Consumers limits the consumers allowed, all consumers are
+		// allowed if it is empty.
+		Consumers []string `yaml:"consumers" jsonschema:"omitempty,uniqueItems=true"`
+
+		// ConsumerHeader is the header to set the consumer name for
+		// following filters, default is X-Consumer-Name.
+		ConsumerHeader string `yaml:"consumerHeader" jsonschema:"omitempty"`
+		// Metadata maps metadata of the consumer to request headers.
+		Metadata map[string]string `yaml:"metadata" jsonschema:"omitempty"`
+		// HideKey removes the key from the request after validation.
+		HideKey bool `yaml:"hideKey" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of APIKeyAuth.
+	Status struct {
+		Consumers int `yaml:"consumers"`
+		Keys      int `yaml:"keys"`
+	}
+)
+
+// Kind returns the kind of APIKeyAuth.
+func (a *APIKeyAuth) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of APIKeyAuth.
+func (a *APIKeyAuth) DefaultSpec() interface{} {
+	return &Spec{
+		Header:         defaultHeader,
+		ConsumerHeader: defaultConsumerHeader,
+	}
+}
+
+// Description returns the description of APIKeyAuth.
+func (a *APIKeyAuth) Description() string {
+	return "APIKeyAuth validates API keys of consumers and enforces their quotas."
+}
+
+// Results returns the results of APIKeyAuth.
+func (a *APIKeyAuth) Results() []string {
+	return results
+}
+
+// DescribeAPI describes the API key in the header, or in the query if
+// the header is not set.
+func (a *APIKeyAuth) DescribeAPI(pipeSpec *httppipeline.FilterSpec) *httppipeline.APIDescription {
+	spec := pipeSpec.FilterSpec().(*Spec)
+	security := &httppipeline.APISecurity{
+		Type:        httppipeline.APISecurityAPIKey,
+		In:          httppipeline.APIInHeader,
+		Name:        spec.Header,
+		Description: "API key of consumers",
+	}
+	if spec.Header == "" {
+		security.In, security.Name = httppipeline.APIInQuery, spec.Query
+	}
+	return &httppipeline.APIDescription{Security: []*httppipeline.APISecurity{security}}
+}
+
+// Init initializes APIKeyAuth.
+func (a *APIKeyAuth) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	a.pipeSpec, a.spec, a.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	a.reload()
+}
+
+// Inherit inherits previous generation of APIKeyAuth.
+func (a *APIKeyAuth) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	a.Init(pipeSpec, super)
+}
+
+func (a *APIKeyAuth) reload() {
+	a.store = newStore()
+	if a.super != nil && a.super.Cluster() != nil {
+		a.store.sync(a.super.Cluster())
+	}
+}
+
+// Handle validates the API key of HTTPContext.
+func (a *APIKeyAuth) Handle(ctx context.HTTPContext) string {
+	result := a.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (a *APIKeyAuth) handle(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	consumer, err := a.validate(r)
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("apikeyauth: ", err.Error()))
+		w.SetStatusCode(http.StatusUnauthorized)
+		return resultUnauthorized
+	}
+
+	if !a.store.allow(consumer.Name) {
+		ctx.AddTag(stringtool.Cat("apikeyauth: quota of ", consumer.Name, " exceeded"))
+		w.SetStatusCode(http.StatusTooManyRequests)
+		return resultQuotaExceeded
+	}
+
+	if a.spec.HideKey {
+		a.hideKey(r)
+	}
+
+	h := r.Header()
+	if a.spec.ConsumerHeader != "" {
+		h.Set(a.spec.ConsumerHeader, consumer.Name)
+	}
+	// NOTE: Delete it first, so clients can't forge it.
+	for key, header := range a.spec.Metadata {
+		h.Del(header)
+		if value, exists := consumer.Metadata[key]; exists {
+			h.Set(header, value)
+		}
+	}
+
+	return ""
+}
+
+func (a *APIKeyAuth) key(r context.HTTPRequest) string {
+	if a.spec.Header != "" {
+		if key := r.Header().Get(a.spec.Header); key != "" {
+			return key
+		}
+	}
+	if a.spec.Query != "" {
+		return r.Std().URL.Query().Get(a.spec.Query)
+	}
+	return ""
+}
+
+func (a *APIKeyAuth) hideKey(r context.HTTPRequest) {
+	if a.spec.Header != "" {
+		r.Header().Del(a.spec.Header)
+	}
+	if a.spec.Query != "" {
+		query := r.Std().URL.Query()
+		if query.Get(a.spec.Query) != "" {
+			query.Del(a.spec.Query)
+			r.SetQuery(query.Encode())
+		}
+	}
+}
+
+func (a *APIKeyAuth) validate(r context.HTTPRequest) (*consumer, error) {
+	key := a.key(r)
+	if key == "" {
+		return nil, fmt.Errorf("missing api key")
+	}
+
+	consumer, err := a.store.validate(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(a.spec.Consumers) > 0 && !stringtool.StrInSlice(consumer.Name, a.spec.Consumers) {
+		return nil, fmt.Errorf("consumer %s is not allowed", consumer.Name)
+	}
+
+	return consumer, nil
+}
+
+// Status returns the status of APIKeyAuth.
+func (a *APIKeyAuth) Status() interface{} {
+	consumers, keys := a.store.count()
+	return &Status{Consumers: consumers, Keys: keys}
+}
+
+// Close closes APIKeyAuth.
+func (a *APIKeyAuth) Close() {
+	a.store.close()
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apikeyauth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/apikey"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "apikeyauth-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "apikeyauth-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+
+	os.Exit(code)
+}
+
+func newAPIKeyAuth(t *testing.T, spec map[string]interface{}) *APIKeyAuth {
+	return filtertest.NewFilter(t, &APIKeyAuth{}, spec).(*APIKeyAuth)
+}
+
+func newContext(key string) context.HTTPContext {
+	r := filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/?foo=bar", "", map[string]string{"X-Tier": "forged"})
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	return filtertest.NewContext(r)
+}
+
+func mustYAML(t *testing.T, v interface{}) string {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %#v failed: %v", v, err)
+	}
+	return string(buff)
+}
+
+func TestHandle(t *testing.T) {
+	a := newAPIKeyAuth(t, map[string]interface{}{
+		"header":         "X-API-Key",
+		"consumerHeader": "X-Consumer-Name",
+		"metadata":       map[string]string{"tier": "X-Tier"},
+		"hideKey":        true,
+	})
+	defer a.Close()
+
+	alice, aliceKey, _ := apikey.Generate("alice", "", 0)
+	bob, bobKey, _ := apikey.Generate("bob", "", 0)
+	expired, expiredKey, _ := apikey.Generate("alice", "", time.Nanosecond)
+	orphan, orphanKey, _ := apikey.Generate("carol", "", 0)
+
+	a.store.updateConsumers(map[string]string{
+		"alice": mustYAML(t, &apikey.Consumer{
+			Name:     "alice",
+			Metadata: map[string]string{"tier": "gold"},
+		}),
+		"bob": mustYAML(t, &apikey.Consumer{
+			Name:  "bob",
+			Quota: &apikey.Quota{RequestsPerSecond: 0.001, Burst: 1},
+		}),
+	})
+	a.store.updateKeys(map[string]string{
+		alice.ID:   mustYAML(t, alice),
+		bob.ID:     mustYAML(t, bob),
+		expired.ID: mustYAML(t, expired),
+		orphan.ID:  mustYAML(t, orphan),
+	})
+
+	for _, key := range []string{"", "malformed", alice.ID + ".wrong", expiredKey, orphanKey} {
+		if result := a.handle(newContext(key)); result != resultUnauthorized {
+			t.Errorf("key %q should be unauthorized, got %q", key, result)
+		}
+	}
+
+	ctx := newContext(aliceKey)
+	if result := a.handle(ctx); result != "" {
+		t.Fatalf("key of alice should be valid, got %q", result)
+	}
+	h := ctx.Request().Header()
+	if h.Get("X-Consumer-Name") != "alice" {
+		t.Errorf("consumer header should be alice, got %q", h.Get("X-Consumer-Name"))
+	}
+	if h.Get("X-Tier") != "gold" {
+		t.Errorf("tier header should be gold, got %q", h.Get("X-Tier"))
+	}
+	if h.Get("X-API-Key") != "" {
+		t.Errorf("api key should be hidden")
+	}
+
+	ctx = newContext(bobKey)
+	if result := a.handle(ctx); result != "" {
+		t.Fatalf("key of bob should be valid, got %q", result)
+	}
+	if ctx.Request().Header().Get("X-Tier") != "" {
+		t.Errorf("forged tier header should be removed")
+	}
+	if result := a.handle(newContext(bobKey)); result != resultQuotaExceeded {
+		t.Errorf("quota of bob should be exceeded, got %q", result)
+	}
+
+	a.spec.Consumers = []string{"bob"}
+	if result := a.handle(newContext(aliceKey)); result != resultUnauthorized {
+		t.Errorf("alice should not be allowed, got %q", result)
+	}
+}
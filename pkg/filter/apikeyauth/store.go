@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apikeyauth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/apikey"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const pullInterval = time.Minute
+
+type (
+	// store keeps a copy of consumers and keys synced from the cluster.
+	store struct {
+		mutex     sync.RWMutex
+		consumers map[string]*consumer
+		keys      map[string]*apikey.Key
+
+		syncer *cluster.Syncer
+	}
+
+	consumer struct {
+		*apikey.Consumer
+		// NOTE: The quota is enforced on every member separately.
+		limiter *rate.Limiter
+	}
+)
+
+func newStore() *store {
+	return &store{
+		consumers: map[string]*consumer{},
+		keys:      map[string]*apikey.Key{},
+	}
+}
+
+func (s *store) sync(cls cluster.Cluster) {
+	syncer, err := cls.Syncer(pullInterval)
+	if err != nil {
+		logger.Errorf("create syncer failed: %v", err)
+		return
+	}
+	s.syncer = syncer
+
+	consumerCh, err := syncer.SyncPrefix(cls.Layout().ConfigConsumerPrefix())
+	if err != nil {
+		logger.Errorf("sync consumers failed: %v", err)
+		return
+	}
+	keyCh, err := syncer.SyncPrefix(cls.Layout().ConfigAPIKeyPrefix())
+	if err != nil {
+		logger.Errorf("sync api keys failed: %v", err)
+		return
+	}
+
+	go func() {
+		for kvs := range consumerCh {
+			s.updateConsumers(kvs)
+		}
+	}()
+	go func() {
+		for kvs := range keyCh {
+			s.updateKeys(kvs)
+		}
+	}()
+}
+
+func (s *store) updateConsumers(kvs map[string]string) {
+	consumers := make(map[string]*consumer, len(kvs))
+	for _, v := range kvs {
+		c := &apikey.Consumer{}
+		err := yaml.Unmarshal([]byte(v), c)
+		if err != nil {
+			logger.Errorf("unmarshal consumer %s failed: %v", v, err)
+			continue
+		}
+		consumers[c.Name] = &consumer{Consumer: c}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for name, c := range consumers {
+		if c.Quota == nil {
+			continue
+		}
+
+		limit, burst := rate.Limit(c.Quota.RequestsPerSecond), c.Quota.Burst
+		if burst < 1 {
+			burst = 1
+		}
+
+		// Keep the limiter, so updating other fields of the consumer
+		// does not reset its quota.
+		if old := s.consumers[name]; old != nil && old.limiter != nil &&
+			old.limiter.Limit() == limit && old.limiter.Burst() == burst {
+			c.limiter = old.limiter
+		} else {
+			c.limiter = rate.NewLimiter(limit, burst)
+		}
+	}
+
+	s.consumers = consumers
+}
+
+func (s *store) updateKeys(kvs map[string]string) {
+	keys := make(map[string]*apikey.Key, len(kvs))
+	for _, v := range kvs {
+		k := &apikey.Key{}
+		err := yaml.Unmarshal([]byte(v), k)
+		if err != nil {
+			logger.Errorf("unmarshal api key %s failed: %v", v, err)
+			continue
+		}
+		keys[k.ID] = k
+	}
+
+	s.mutex.Lock()
+	s.keys = keys
+	s.mutex.Unlock()
+}
+
+func (s *store) validate(plaintext string) (*consumer, error) {
+	id, secret, ok := apikey.Parse(plaintext)
+	if !ok {
+		return nil, fmt.Errorf("malformed api key")
+	}
+
+	s.mutex.RLock()
+	key := s.keys[id]
+	var c *consumer
+	if key != nil {
+		c = s.consumers[key.Consumer]
+	}
+	s.mutex.RUnlock()
+
+	if key == nil {
+		return nil, fmt.Errorf("unknown api key %s", id)
+	}
+	if err := key.Verify(secret); err != nil {
+		return nil, fmt.Errorf("api key %s: %v", id, err)
+	}
+	if c == nil {
+		return nil, fmt.Errorf("consumer %s of api key %s not found", key.Consumer, id)
+	}
+
+	return c, nil
+}
+
+func (s *store) allow(name string) bool {
+	s.mutex.RLock()
+	c := s.consumers[name]
+	s.mutex.RUnlock()
+
+	if c == nil || c.limiter == nil {
+		return true
+	}
+	return c.limiter.Allow()
+}
+
+func (s *store) count() (int, int) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.consumers), len(s.keys)
+}
+
+func (s *store) close() {
+	if s.syncer != nil {
+		s.syncer.Close()
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authcallout
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of AuthCallout.
+	Kind = "AuthCallout"
+
+	resultDenied = "denied"
+	resultFailed = "failed"
+
+	defaultTimeout       = "200ms"
+	defaultStatusOnError = http.StatusForbidden
+	defaultMaxBodySize   = 64 * 1024
+	defaultCacheTTL      = "30s"
+	defaultCacheSize     = 10000
+
+	// maxDecisionBodySize is the max size of bodies of decisions.
+	maxDecisionBodySize = 64 * 1024
+)
+
+var (
+	results = []string{resultDenied, resultFailed}
+)
+
+func init() {
+	httppipeline.Register(&AuthCallout{})
+}
+
+type (
+	// AuthCallout is the filter asking an external service to authorize requests.
+	AuthCallout struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		client   *http.Client
+		cache    *lru.Cache
+		cacheTTL time.Duration
+	}
+
+	// Spec describes the AuthCallout.
+	Spec struct {
+		URL                    string     `yaml:"url" jsonschema:"required,format=url"`
+		Timeout                string     `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		Headers                []string   `yaml:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		IncludeBody            bool       `yaml:"includeBody" jsonschema:"omitempty"`
+		MaxBodySize            int64      `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		AllowedUpstreamHeaders []string   `yaml:"allowedUpstreamHeaders" jsonschema:"omitempty,uniqueItems=true"`
+		AllowedClientHeaders   []string   `yaml:"allowedClientHeaders" jsonschema:"omitempty,uniqueItems=true"`
+		FailOpen               bool       `yaml:"failOpen" jsonschema:"omitempty"`
+		StatusOnError          int        `yaml:"statusOnError" jsonschema:"omitempty,minimum=200,maximum=599"`
+		Cache                  *CacheSpec `yaml:"cache" jsonschema:"omitempty"`
+	}
+
+	// CacheSpec describes the cache of decisions.
+	CacheSpec struct {
+		TTL  string `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+		Size int    `yaml:"size" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// authRequest is the request body sent to the decision service.
+	authRequest struct {
+		Method  string            `json:"method"`
+		Scheme  string            `json:"scheme"`
+		Host    string            `json:"host"`
+		Path    string            `json:"path"`
+		Query   string            `json:"query"`
+		RealIP  string            `json:"realIP"`
+		Headers map[string]string `json:"headers"`
+		Body    string            `json:"body,omitempty"`
+	}
+
+	decision struct {
+		allowed    bool
+		statusCode int
+		header     http.Header
+		body       []byte
+		expiresAt  time.Time
+	}
+)
+
+// Kind returns the kind of AuthCallout.
+func (ac *AuthCallout) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of AuthCallout.
+func (ac *AuthCallout) DefaultSpec() interface{} {
+	return &Spec{
+		Timeout:       defaultTimeout,
+		MaxBodySize:   defaultMaxBodySize,
+		StatusOnError: defaultStatusOnError,
+	}
+}
+
+// Description returns the description of AuthCallout.
+func (ac *AuthCallout) Description() string {
+	return "AuthCallout asks an external decision service to allow, deny or mutate requests."
+}
+
+// Results returns the results of AuthCallout.
+func (ac *AuthCallout) Results() []string {
+	return results
+}
+
+// Init initializes AuthCallout.
+func (ac *AuthCallout) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	ac.pipeSpec, ac.spec, ac.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	ac.reload()
+}
+
+// Inherit inherits previous generation of AuthCallout.
+func (ac *AuthCallout) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	ac.Init(pipeSpec, super)
+}
+
+func parseDuration(s string, dflt time.Duration) time.Duration {
+	if s == "" {
+		return dflt
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", s, err)
+		return dflt
+	}
+
+	return d
+}
+
+func (ac *AuthCallout) reload() {
+	ac.client = &http.Client{
+		Timeout:   parseDuration(ac.spec.Timeout, 0),
+		Transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+
+	if ac.spec.Cache != nil {
+		size := ac.spec.Cache.Size
+		if size == 0 {
+			size = defaultCacheSize
+		}
+		cache, err := lru.New(size)
+		if err != nil {
+			logger.Errorf("BUG: new lru cache failed: %v", err)
+		}
+		ac.cache = cache
+		ac.cacheTTL = parseDuration(ac.spec.Cache.TTL, parseDuration(defaultCacheTTL, 0))
+	}
+}
+
+// Handle authorizes HTTPContext by the decision service.
+func (ac *AuthCallout) Handle(ctx context.HTTPContext) string {
+	result := ac.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (ac *AuthCallout) handle(ctx context.HTTPContext) string {
+	payload, err := ac.buildPayload(ctx)
+	if err != nil {
+		return ac.fail(ctx, err)
+	}
+
+	var key string
+	var d *decision
+	if ac.cache != nil {
+		key = fmt.Sprintf("%x", sha256.Sum256(payload))
+		if v, ok := ac.cache.Get(key); ok && time.Now().Before(v.(*decision).expiresAt) {
+			d = v.(*decision)
+		}
+	}
+
+	if d == nil {
+		d, err = ac.callout(payload)
+		if err != nil {
+			return ac.fail(ctx, err)
+		}
+		if ac.cache != nil {
+			d.expiresAt = time.Now().Add(ac.cacheTTL)
+			ac.cache.Add(key, d)
+		}
+	}
+
+	if d.allowed {
+		h := ctx.Request().Header()
+		for key, values := range d.header {
+			h.Del(key)
+			for _, value := range values {
+				h.Add(key, value)
+			}
+		}
+		return ""
+	}
+
+	w := ctx.Response()
+	for key, values := range d.header {
+		w.Header().Del(key)
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.SetStatusCode(d.statusCode)
+	w.SetBody(bytes.NewReader(d.body))
+	ctx.AddTag(stringtool.Cat("authCallout: denied with status ", fmt.Sprint(d.statusCode)))
+
+	return resultDenied
+}
+
+func (ac *AuthCallout) buildPayload(ctx context.HTTPContext) ([]byte, error) {
+	r := ctx.Request()
+
+	ar := &authRequest{
+		Method:  r.Method(),
+		Scheme:  r.Scheme(),
+		Host:    r.Host(),
+		Path:    r.Path(),
+		Query:   r.Query(),
+		RealIP:  r.RealIP(),
+		Headers: map[string]string{},
+	}
+
+	if len(ac.spec.Headers) == 0 {
+		r.Header().VisitAll(func(key, value string) {
+			if _, exists := ar.Headers[key]; !exists {
+				ar.Headers[key] = value
+			}
+		})
+	} else {
+		for _, key := range ac.spec.Headers {
+			if value := r.Header().Get(key); value != "" {
+				ar.Headers[http.CanonicalHeaderKey(key)] = value
+			}
+		}
+	}
+
+	if ac.spec.IncludeBody {
+		buff := bytes.NewBuffer(nil)
+		written, err := io.CopyN(buff, r.Body(), ac.spec.MaxBodySize+1)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("read body failed: %v", err)
+		}
+		if written > ac.spec.MaxBodySize {
+			r.SetBody(io.MultiReader(buff, r.Body()))
+			return nil, fmt.Errorf("body exceed %dB", ac.spec.MaxBodySize)
+		}
+		ar.Body = buff.String()
+		r.SetBody(bytes.NewReader(buff.Bytes()))
+	}
+
+	return json.Marshal(ar)
+}
+
+func (ac *AuthCallout) callout(payload []byte) (*decision, error) {
+	req, err := http.NewRequest(http.MethodPost, ac.spec.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("decision service returns %d", resp.StatusCode)
+	}
+
+	d := &decision{
+		allowed:    resp.StatusCode >= 200 && resp.StatusCode < 300,
+		statusCode: resp.StatusCode,
+		header:     http.Header{},
+	}
+
+	allowedHeaders := ac.spec.AllowedClientHeaders
+	if d.allowed {
+		allowedHeaders = ac.spec.AllowedUpstreamHeaders
+	} else {
+		d.body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxDecisionBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("read body of decision failed: %v", err)
+		}
+	}
+	for _, key := range allowedHeaders {
+		if values := resp.Header.Values(key); len(values) > 0 {
+			d.header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+
+	return d, nil
+}
+
+// fail returns the result of failures according to the fail policy.
+func (ac *AuthCallout) fail(ctx context.HTTPContext, err error) string {
+	ctx.AddTag(stringtool.Cat("authCallout: ", err.Error()))
+	if ac.spec.FailOpen {
+		return ""
+	}
+
+	ctx.Response().SetStatusCode(ac.spec.StatusOnError)
+	return resultFailed
+}
+
+// Status returns status.
+func (ac *AuthCallout) Status() interface{} { return nil }
+
+// Close closes AuthCallout.
+func (ac *AuthCallout) Close() {
+	ac.client.CloseIdleConnections()
+}
@@ -0,0 +1,403 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package basicauth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of BasicAuth.
+	Kind = "BasicAuth"
+
+	resultUnauthorized    = "unauthorized"
+	resultTooManyFailures = "tooManyFailures"
+
+	defaultRealm       = "Restricted"
+	defaultUserHeader  = "X-Auth-User"
+	defaultCacheSize   = 1000
+	defaultMaxFailures = 5
+	defaultWindow      = time.Minute
+
+	// maxTrackedUsers is the max number of users tracked for failures.
+	maxTrackedUsers = 10000
+)
+
+var results = []string{resultUnauthorized, resultTooManyFailures}
+
+func init() {
+	httppipeline.Register(&BasicAuth{})
+}
+
+type (
+	// BasicAuth authenticates requests by HTTP basic authentication with
+	// credentials in an htpasswd file.
+	BasicAuth struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		mutex      sync.RWMutex
+		htpasswd   htpasswd
+		verified   *lru.Cache
+		lastReload time.Time
+		loadErr    error
+
+		failures    *lru.Cache
+		maxFailures int
+		window      time.Duration
+
+		watcher *fsnotify.Watcher
+		done    chan struct{}
+	}
+
+	// Spec describes the BasicAuth.
+	Spec struct {
+		// File is the path of the htpasswd file, it is reloaded when changed.
+		File  string `yaml:"file" jsonschema:"required"`
+		Realm string `yaml:"realm" jsonschema:"omitempty"`
+		// UserHeader is the header to set the user name for following filters.
+		UserHeader      string `yaml:"userHeader" jsonschema:"omitempty"`
+		HideCredentials bool   `yaml:"hideCredentials" jsonschema:"omitempty"`
+		// CacheSize is the max number of verified credentials to cache, as
+		// verifying bcrypt hashes is slow.
+		CacheSize    int               `yaml:"cacheSize" jsonschema:"omitempty,minimum=0"`
+		FailureLimit *FailureLimitSpec `yaml:"failureLimit,omitempty" jsonschema:"omitempty"`
+	}
+
+	// FailureLimitSpec limits the failures of a user, the user is rejected
+	// until the end of the window after maxFailures failures in the window.
+	FailureLimitSpec struct {
+		MaxFailures int    `yaml:"maxFailures" jsonschema:"omitempty,minimum=1"`
+		Window      string `yaml:"window" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of BasicAuth.
+	Status struct {
+		Users      int    `yaml:"users"`
+		LastReload string `yaml:"lastReload,omitempty"`
+		Error      string `yaml:"error,omitempty"`
+	}
+
+	failureRecord struct {
+		mutex   sync.Mutex
+		count   int
+		resetAt time.Time
+	}
+)
+
+// Kind returns the kind of BasicAuth.
+func (ba *BasicAuth) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of BasicAuth.
+func (ba *BasicAuth) DefaultSpec() interface{} {
+	return &Spec{
+		Realm:      defaultRealm,
+		UserHeader: defaultUserHeader,
+		CacheSize:  defaultCacheSize,
+	}
+}
+
+// Description returns the description of BasicAuth.
+func (ba *BasicAuth) Description() string {
+	return "BasicAuth authenticates requests by HTTP basic authentication with an htpasswd file."
+}
+
+// Results returns the results of BasicAuth.
+func (ba *BasicAuth) Results() []string {
+	return results
+}
+
+// DescribeAPI describes the HTTP basic authentication.
+func (ba *BasicAuth) DescribeAPI(pipeSpec *httppipeline.FilterSpec) *httppipeline.APIDescription {
+	return &httppipeline.APIDescription{Security: []*httppipeline.APISecurity{{
+		Type:   httppipeline.APISecurityHTTP,
+		Scheme: "basic",
+	}}}
+}
+
+// Init initializes BasicAuth.
+func (ba *BasicAuth) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	ba.pipeSpec, ba.spec, ba.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	ba.reload()
+}
+
+// Inherit inherits previous generation of BasicAuth.
+func (ba *BasicAuth) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	ba.Init(pipeSpec, super)
+}
+
+func (ba *BasicAuth) reload() {
+	ba.done = make(chan struct{})
+
+	if fl := ba.spec.FailureLimit; fl != nil {
+		ba.maxFailures, ba.window = fl.MaxFailures, defaultWindow
+		if ba.maxFailures == 0 {
+			ba.maxFailures = defaultMaxFailures
+		}
+		if fl.Window != "" {
+			var err error
+			ba.window, err = time.ParseDuration(fl.Window)
+			if err != nil {
+				logger.Errorf("BUG: parse duration %s failed: %v", fl.Window, err)
+				ba.window = defaultWindow
+			}
+		}
+
+		var err error
+		ba.failures, err = lru.New(maxTrackedUsers)
+		if err != nil {
+			logger.Errorf("BUG: new lru cache failed: %v", err)
+		}
+	}
+
+	ba.load()
+	ba.watch()
+}
+
+// load loads the htpasswd file, the previous credentials are kept if it
+// fails.
+func (ba *BasicAuth) load() {
+	h, err := loadHtpasswd(ba.spec.File)
+	if err != nil {
+		logger.Errorf("%s: load htpasswd failed: %v", ba.pipeSpec.Name(), err)
+		ba.mutex.Lock()
+		ba.loadErr = err
+		ba.mutex.Unlock()
+		return
+	}
+
+	var verified *lru.Cache
+	if ba.spec.CacheSize > 0 {
+		verified, err = lru.New(ba.spec.CacheSize)
+		if err != nil {
+			logger.Errorf("BUG: new lru cache failed: %v", err)
+		}
+	}
+
+	ba.mutex.Lock()
+	ba.htpasswd, ba.verified = h, verified
+	ba.lastReload, ba.loadErr = time.Now(), nil
+	ba.mutex.Unlock()
+}
+
+func (ba *BasicAuth) watch() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("%s: create watcher failed: %v", ba.pipeSpec.Name(), err)
+		return
+	}
+
+	// NOTE: Watch the directory, because editors and tools usually replace
+	// the file by renaming, which stops watching the file itself.
+	path := filepath.Clean(ba.spec.File)
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		logger.Errorf("%s: watch %s failed: %v", ba.pipeSpec.Name(), path, err)
+		watcher.Close()
+		return
+	}
+	ba.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case <-ba.done:
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Errorf("%s: watch %s failed: %v", ba.pipeSpec.Name(), path, err)
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == path && event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+					ba.load()
+				}
+			}
+		}
+	}()
+}
+
+// Handle authenticates HTTPContext.
+func (ba *BasicAuth) Handle(ctx context.HTTPContext) string {
+	result := ba.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (ba *BasicAuth) handle(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	user, password, ok := r.Std().BasicAuth()
+	if !ok {
+		return ba.unauthorized(ctx, "missing credentials")
+	}
+
+	record := ba.failureRecord(user)
+	if record != nil {
+		if retryAfter := record.locked(ba.maxFailures); retryAfter > 0 {
+			ctx.AddTag(stringtool.Cat("basicauth: too many failures of ", user))
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+			w.SetStatusCode(http.StatusTooManyRequests)
+			return resultTooManyFailures
+		}
+	}
+
+	if !ba.verify(user, password) {
+		if record != nil {
+			record.fail(ba.window)
+		}
+		return ba.unauthorized(ctx, stringtool.Cat("invalid credentials of ", user))
+	}
+	if record != nil {
+		record.reset()
+	}
+
+	h := r.Header()
+	if ba.spec.HideCredentials {
+		h.Del("Authorization")
+	}
+	if ba.spec.UserHeader != "" {
+		h.Set(ba.spec.UserHeader, user)
+	}
+
+	return ""
+}
+
+func (ba *BasicAuth) unauthorized(ctx context.HTTPContext, msg string) string {
+	ctx.AddTag(stringtool.Cat("basicauth: ", msg))
+	w := ctx.Response()
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, ba.spec.Realm))
+	w.SetStatusCode(http.StatusUnauthorized)
+	return resultUnauthorized
+}
+
+func (ba *BasicAuth) verify(user, password string) bool {
+	ba.mutex.RLock()
+	h, verified := ba.htpasswd, ba.verified
+	ba.mutex.RUnlock()
+
+	var key [sha256.Size]byte
+	if verified != nil {
+		key = sha256.Sum256([]byte(user + ":" + password))
+		if _, exists := verified.Get(key); exists {
+			return true
+		}
+	}
+
+	if !h.verify(user, password) {
+		return false
+	}
+
+	if verified != nil {
+		verified.Add(key, struct{}{})
+	}
+	return true
+}
+
+func (ba *BasicAuth) failureRecord(user string) *failureRecord {
+	if ba.failures == nil {
+		return nil
+	}
+
+	record := &failureRecord{}
+	if exists, _ := ba.failures.ContainsOrAdd(user, record); exists {
+		if previous, ok := ba.failures.Get(user); ok {
+			record = previous.(*failureRecord)
+		}
+	}
+	return record
+}
+
+// locked returns how long the user is locked, 0 means not locked.
+func (fr *failureRecord) locked(maxFailures int) time.Duration {
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+
+	if fr.count < maxFailures {
+		return 0
+	}
+
+	d := time.Until(fr.resetAt)
+	if d <= 0 {
+		fr.count = 0
+		return 0
+	}
+	return d
+}
+
+func (fr *failureRecord) fail(window time.Duration) {
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+
+	now := time.Now()
+	if now.After(fr.resetAt) {
+		fr.count, fr.resetAt = 0, now.Add(window)
+	}
+	fr.count++
+}
+
+func (fr *failureRecord) reset() {
+	fr.mutex.Lock()
+	fr.count = 0
+	fr.mutex.Unlock()
+}
+
+// Status returns the status of BasicAuth.
+func (ba *BasicAuth) Status() interface{} {
+	ba.mutex.RLock()
+	defer ba.mutex.RUnlock()
+
+	s := &Status{Users: len(ba.htpasswd)}
+	if !ba.lastReload.IsZero() {
+		s.LastReload = ba.lastReload.Format(time.RFC3339)
+	}
+	if ba.loadErr != nil {
+		s.Error = ba.loadErr.Error()
+	}
+	return s
+}
+
+// Close closes BasicAuth.
+func (ba *BasicAuth) Close() {
+	close(ba.done)
+	if ba.watcher != nil {
+		ba.watcher.Close()
+	}
+}
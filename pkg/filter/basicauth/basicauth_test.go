@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package basicauth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const tempDir = "/tmp/eg-test"
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(tempDir, "basicauth-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "basicauth-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+
+	os.Exit(code)
+}
+
+func newBasicAuth(t *testing.T, spec map[string]interface{}) *BasicAuth {
+	return filtertest.NewFilter(t, &BasicAuth{}, spec).(*BasicAuth)
+}
+
+func newContext(user, password string) context.HTTPContext {
+	r := filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", nil)
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+	return filtertest.NewContext(r)
+}
+
+func TestAPR1(t *testing.T) {
+	hash := "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/"
+	if got := apr1("myPassword", "r31....."); got != hash {
+		t.Errorf("apr1 should be %s, got %s", hash, got)
+	}
+
+	h := htpasswd{"alice": hash}
+	if !h.verify("alice", "myPassword") {
+		t.Errorf("password of alice should be verified")
+	}
+	if h.verify("alice", "wrong") || h.verify("bob", "myPassword") {
+		t.Errorf("wrong credentials should not be verified")
+	}
+
+	if _, err := parseHtpasswd([]byte("carol:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=")); err == nil {
+		t.Errorf("unsupported hash should be rejected")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "basicauth")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	bobHash, _ := bcrypt.GenerateFromPassword([]byte("bob-password"), bcrypt.MinCost)
+	file := filepath.Join(dir, "htpasswd")
+	content := "# users\nalice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/\nbob:" + string(bobHash) + "\n"
+	ioutil.WriteFile(file, []byte(content), 0600)
+
+	ba := newBasicAuth(t, map[string]interface{}{
+		"file":            file,
+		"userHeader":      "X-Auth-User",
+		"hideCredentials": true,
+		"cacheSize":       10,
+		"failureLimit": map[string]interface{}{
+			"maxFailures": 2,
+			"window":      "1m",
+		},
+	})
+	defer ba.Close()
+
+	ctx := newContext("bob", "bob-password")
+	if result := ba.handle(ctx); result != "" {
+		t.Fatalf("bob should be authenticated, got %q", result)
+	}
+	if user := ctx.Request().Header().Get("X-Auth-User"); user != "bob" {
+		t.Errorf("user header should be bob, got %q", user)
+	}
+	if ctx.Request().Header().Get("Authorization") != "" {
+		t.Errorf("credentials should be hidden")
+	}
+
+	if result := ba.handle(newContext("", "")); result != resultUnauthorized {
+		t.Errorf("missing credentials should be unauthorized, got %q", result)
+	}
+
+	for i := 0; i < 2; i++ {
+		if result := ba.handle(newContext("alice", "wrong")); result != resultUnauthorized {
+			t.Errorf("wrong password should be unauthorized, got %q", result)
+		}
+	}
+	if result := ba.handle(newContext("alice", "myPassword")); result != resultTooManyFailures {
+		t.Errorf("alice should be locked, got %q", result)
+	}
+	if result := ba.handle(newContext("bob", "bob-password")); result != "" {
+		t.Errorf("bob should not be affected by failures of alice, got %q", result)
+	}
+
+	// Replace the file by renaming, as most tools do.
+	tmp := filepath.Join(dir, "htpasswd.tmp")
+	ioutil.WriteFile(tmp, []byte("alice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/\n"), 0600)
+	os.Rename(tmp, file)
+
+	for i := 0; ; i++ {
+		if result := ba.handle(newContext("bob", "bob-password")); result == resultUnauthorized {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("htpasswd should be reloaded")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if status := ba.Status().(*Status); status.Users != 1 {
+		t.Errorf("there should be 1 user after reloading, got %d", status.Users)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package basicauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const apr1Magic = "$apr1$"
+
+// htpasswd is the parsed htpasswd file, which maps users to password hashes.
+type htpasswd map[string]string
+
+func loadHtpasswd(path string) (htpasswd, error) {
+	buff, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %v", path, err)
+	}
+	return parseHtpasswd(buff)
+}
+
+// parseHtpasswd parses htpasswd content, only bcrypt and apr1 hashes
+// are supported.
+func parseHtpasswd(buff []byte) (htpasswd, error) {
+	h := htpasswd{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(buff))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, fmt.Errorf("line %d: malformed entry", lineNo)
+		}
+
+		user, hash := fields[0], fields[1]
+		if !isBcrypt(hash) && !strings.HasPrefix(hash, apr1Magic) {
+			return nil, fmt.Errorf("line %d: unsupported hash of user %s, only bcrypt and apr1 are supported",
+				lineNo, user)
+		}
+		h[user] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h htpasswd) verify(user, password string) bool {
+	hash, exists := h[user]
+	if !exists {
+		return false
+	}
+
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	salt := strings.TrimPrefix(hash, apr1Magic)
+	if i := strings.IndexByte(salt, '$'); i >= 0 {
+		salt = salt[:i]
+	}
+	return subtle.ConstantTimeCompare([]byte(apr1(password, salt)), []byte(hash)) == 1
+}
+
+// apr1 computes the Apache variant of the MD5-based crypt.
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	h := md5.New()
+	h.Write(pw)
+	h.Write([]byte(apr1Magic))
+	h.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			h.Write(altSum)
+		} else {
+			h.Write(altSum[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(sum)
+		} else {
+			h.Write(pw)
+		}
+		sum = h.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var sb strings.Builder
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			sb.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(uint(sum[0])<<16|uint(sum[6])<<8|uint(sum[12]), 4)
+	encode(uint(sum[1])<<16|uint(sum[7])<<8|uint(sum[13]), 4)
+	encode(uint(sum[2])<<16|uint(sum[8])<<8|uint(sum[14]), 4)
+	encode(uint(sum[3])<<16|uint(sum[9])<<8|uint(sum[15]), 4)
+	encode(uint(sum[4])<<16|uint(sum[10])<<8|uint(sum[5]), 4)
+	encode(uint(sum[11]), 2)
+
+	return apr1Magic + salt + "$" + sb.String()
+}
@@ -0,0 +1,355 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	// Kind is the kind of Batcher.
+	Kind = "Batcher"
+
+	resultBatched = "batched"
+	resultDropped = "dropped"
+
+	// FormatNDJSON joins the bodies by newlines.
+	FormatNDJSON = "ndjson"
+	// FormatJSON joins the bodies into a JSON array.
+	FormatJSON = "json"
+
+	headerBatchSize = "X-EG-Batch-Size"
+
+	defaultMaxCount = 100
+	defaultMaxBytes = 1024 * 1024
+	defaultMaxWait  = time.Second
+)
+
+var results = []string{resultBatched, resultDropped}
+
+func init() {
+	httppipeline.Register(&Batcher{})
+}
+
+type (
+	// Batcher accumulates requests and sends them to an output pipeline
+	// as one aggregated request, for efficient bulk writes.
+	Batcher struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		maxWait time.Duration
+
+		mutex   sync.Mutex
+		batches map[string]*batch
+		closed  bool
+		wg      sync.WaitGroup
+
+		batched uint64
+		dropped uint64
+		sent    uint64
+		failed  uint64
+	}
+
+	// Spec describes the Batcher.
+	Spec struct {
+		Pipeline   string `yaml:"pipeline" jsonschema:"required"`
+		MaxCount   int    `yaml:"maxCount" jsonschema:"omitempty,minimum=1"`
+		MaxBytes   int64  `yaml:"maxBytes" jsonschema:"omitempty,minimum=1"`
+		MaxWait    string `yaml:"maxWait" jsonschema:"omitempty,format=duration"`
+		GroupBy    string `yaml:"groupBy" jsonschema:"omitempty"`
+		Format     string `yaml:"format" jsonschema:"omitempty,enum=ndjson,enum=json"`
+		StatusCode int    `yaml:"statusCode" jsonschema:"omitempty,format=httpcode"`
+	}
+
+	// Status is the status of Batcher.
+	Status struct {
+		Pending int    `yaml:"pending"`
+		Batched uint64 `yaml:"batched"`
+		Dropped uint64 `yaml:"dropped"`
+		Sent    uint64 `yaml:"sent"`
+		Failed  uint64 `yaml:"failed"`
+	}
+
+	// batch is the batch of a group, the first request decides the
+	// method, URL and header of the aggregated request.
+	batch struct {
+		group  string
+		method string
+		url    string
+		host   string
+		header http.Header
+		bodies [][]byte
+		size   int64
+		timer  *time.Timer
+	}
+)
+
+// Kind returns the kind of Batcher.
+func (b *Batcher) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Batcher.
+func (b *Batcher) DefaultSpec() interface{} {
+	return &Spec{
+		MaxCount:   defaultMaxCount,
+		MaxBytes:   defaultMaxBytes,
+		Format:     FormatNDJSON,
+		StatusCode: http.StatusAccepted,
+	}
+}
+
+// Description returns the description of Batcher.
+func (b *Batcher) Description() string {
+	return "Batcher accumulates requests and sends them to an output pipeline in batches."
+}
+
+// Results returns the results of Batcher.
+func (b *Batcher) Results() []string {
+	return results
+}
+
+// Init initializes Batcher.
+func (b *Batcher) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	b.pipeSpec, b.spec, b.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	b.reload()
+}
+
+// Inherit inherits previous generation of Batcher.
+func (b *Batcher) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	b.Init(pipeSpec, super)
+}
+
+func (b *Batcher) reload() {
+	b.maxWait = defaultMaxWait
+	if b.spec.MaxWait != "" {
+		// NOTE: The format has been validated.
+		b.maxWait, _ = time.ParseDuration(b.spec.MaxWait)
+	}
+
+	b.batches = make(map[string]*batch)
+}
+
+// Handle adds the request to the batch of its group.
+func (b *Batcher) Handle(ctx context.HTTPContext) string {
+	result := b.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (b *Batcher) handle(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	var body []byte
+	if r.Body() != nil {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body(), b.spec.MaxBytes+1))
+		if err != nil {
+			return b.drop(ctx, http.StatusBadRequest, fmt.Sprintf("read body failed: %v", err))
+		}
+		if int64(len(body)) > b.spec.MaxBytes {
+			return b.drop(ctx, http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceed %dB", b.spec.MaxBytes))
+		}
+		r.SetBody(bytes.NewReader(body))
+	}
+	if b.spec.Format == FormatJSON && !json.Valid(body) {
+		return b.drop(ctx, http.StatusBadRequest, "invalid json body")
+	}
+
+	var group string
+	if b.spec.GroupBy != "" {
+		group = r.Header().Get(b.spec.GroupBy)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return b.drop(ctx, http.StatusServiceUnavailable, "closed")
+	}
+
+	bt := b.batches[group]
+	if bt != nil && bt.size+int64(len(body)) > b.spec.MaxBytes {
+		b.flushLocked(bt)
+		bt = nil
+	}
+	if bt == nil {
+		bt = &batch{
+			group:  group,
+			method: r.Method(),
+			url:    r.Std().URL.String(),
+			host:   r.Host(),
+			header: r.Header().Copy().Std(),
+		}
+		bt.timer = time.AfterFunc(b.maxWait, func() { b.flush(bt) })
+		b.batches[group] = bt
+	}
+
+	bt.bodies = append(bt.bodies, body)
+	bt.size += int64(len(body))
+	atomic.AddUint64(&b.batched, 1)
+	if len(bt.bodies) >= b.spec.MaxCount {
+		b.flushLocked(bt)
+	}
+
+	w.SetStatusCode(b.spec.StatusCode)
+	return resultBatched
+}
+
+func (b *Batcher) drop(ctx context.HTTPContext, code int, reason string) string {
+	ctx.AddTag(fmt.Sprintf("batcher: %s", reason))
+	atomic.AddUint64(&b.dropped, 1)
+	ctx.Response().SetStatusCode(code)
+	return resultDropped
+}
+
+// flush flushes the batch if it's still pending, it's called when the
+// batch reaches maxWait.
+func (b *Batcher) flush(bt *batch) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.batches[bt.group] == bt {
+		b.flushLocked(bt)
+	}
+}
+
+func (b *Batcher) flushLocked(bt *batch) {
+	bt.timer.Stop()
+	delete(b.batches, bt.group)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		err := b.send(bt)
+		if err != nil {
+			atomic.AddUint64(&b.failed, 1)
+			logger.Errorf("%s: send batch of %d requests failed: %v",
+				b.pipeSpec.Name(), len(bt.bodies), err)
+			return
+		}
+		atomic.AddUint64(&b.sent, 1)
+	}()
+}
+
+func (b *Batcher) aggregate(bt *batch) []byte {
+	buff := bytes.NewBuffer(nil)
+	if b.spec.Format == FormatJSON {
+		buff.WriteByte('[')
+		buff.Write(bytes.Join(bt.bodies, []byte{','}))
+		buff.WriteByte(']')
+		return buff.Bytes()
+	}
+
+	// NOTE: Every line ends with a newline, as the bulk API of
+	// Elasticsearch requires.
+	for _, body := range bt.bodies {
+		buff.Write(body)
+		if len(body) == 0 || body[len(body)-1] != '\n' {
+			buff.WriteByte('\n')
+		}
+	}
+	return buff.Bytes()
+}
+
+// send sends the batch to the output pipeline.
+func (b *Batcher) send(bt *batch) error {
+	ro, exists := b.super.GetRunningObject(b.spec.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		return fmt.Errorf("pipeline %s not found", b.spec.Pipeline)
+	}
+
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		return fmt.Errorf("%s is not a handler", b.spec.Pipeline)
+	}
+
+	body := b.aggregate(bt)
+	req, err := http.NewRequest(bt.method, bt.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request failed: %v", err)
+	}
+	req.Header = bt.header
+	req.Host = bt.host
+	req.Header.Del("Content-Length")
+	if b.spec.Format == FormatJSON {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	req.Header.Set(headerBatchSize, strconv.Itoa(len(bt.bodies)))
+
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+	handler.Handle(ctx)
+	ctx.Finish()
+
+	if code := ctx.Response().StatusCode(); code >= 500 {
+		return fmt.Errorf("status code %d", code)
+	}
+	return nil
+}
+
+// Status returns status.
+func (b *Batcher) Status() interface{} {
+	b.mutex.Lock()
+	pending := 0
+	for _, bt := range b.batches {
+		pending += len(bt.bodies)
+	}
+	b.mutex.Unlock()
+
+	return &Status{
+		Pending: pending,
+		Batched: atomic.LoadUint64(&b.batched),
+		Dropped: atomic.LoadUint64(&b.dropped),
+		Sent:    atomic.LoadUint64(&b.sent),
+		Failed:  atomic.LoadUint64(&b.failed),
+	}
+}
+
+// Close flushes the pending batches and waits for them to be sent.
+func (b *Batcher) Close() {
+	b.mutex.Lock()
+	b.closed = true
+	for _, bt := range b.batches {
+		b.flushLocked(bt)
+	}
+	b.mutex.Unlock()
+
+	b.wg.Wait()
+}
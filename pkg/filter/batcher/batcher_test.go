@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+)
+
+func newTestBatcher(spec *Spec) *Batcher {
+	b := &Batcher{spec: spec}
+	b.reload()
+	return b
+}
+
+func handleTestRequest(b *Batcher, group, body string) (string, int) {
+	r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/_bulk", strings.NewReader(body))
+	r.Header.Set("X-Index", group)
+	ctx := filtertest.NewContext(r)
+	return b.handle(ctx), ctx.Response().StatusCode()
+}
+
+func TestBatcherGroup(t *testing.T) {
+	b := newTestBatcher(&Spec{
+		MaxCount:   10,
+		MaxBytes:   32,
+		MaxWait:    "1h",
+		GroupBy:    "X-Index",
+		Format:     FormatNDJSON,
+		StatusCode: http.StatusAccepted,
+	})
+
+	for _, c := range []struct{ group, body string }{
+		{"a", `{"id":1}`}, {"b", `{"id":2}`}, {"a", "{\"id\":3}\n"},
+	} {
+		if result, code := handleTestRequest(b, c.group, c.body); result != resultBatched || code != http.StatusAccepted {
+			t.Fatalf("want batched with 202, got %s with %d", result, code)
+		}
+	}
+	if result, code := handleTestRequest(b, "a", strings.Repeat("x", 33)); result != resultDropped || code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want dropped with 413, got %s with %d", result, code)
+	}
+
+	if len(b.batches) != 2 {
+		t.Fatalf("want 2 batches, got %d", len(b.batches))
+	}
+	if got := string(b.aggregate(b.batches["a"])); got != "{\"id\":1}\n{\"id\":3}\n" {
+		t.Errorf("unexpected ndjson batch %q", got)
+	}
+	if s := b.Status().(*Status); s.Pending != 3 || s.Dropped != 1 {
+		t.Errorf("want 3 pending and 1 dropped, got %+v", s)
+	}
+
+	b.spec.Format = FormatJSON
+	if got := string(b.aggregate(b.batches["a"])); got != "[{\"id\":1},{\"id\":3}\n]" {
+		t.Errorf("unexpected json batch %q", got)
+	}
+	if result, _ := handleTestRequest(b, "b", "not json"); result != resultDropped {
+		t.Errorf("want invalid json dropped, got %s", result)
+	}
+}
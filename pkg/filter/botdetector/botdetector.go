@@ -0,0 +1,365 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package botdetector
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of BotDetector.
+	Kind = "BotDetector"
+
+	resultBlocked    = "blocked"
+	resultChallenged = "challenged"
+
+	actionBlock     = "block"
+	actionTarpit    = "tarpit"
+	actionChallenge = "challenge"
+
+	defaultTarpitDelay  = 5 * time.Second
+	defaultChallengeTTL = time.Hour
+	defaultRateWindow   = 10 * time.Second
+
+	// maxTrackedClients is the max number of clients tracked for rates.
+	maxTrackedClients = 100000
+)
+
+var results = []string{resultBlocked, resultChallenged}
+
+// toolUserAgent matches user agents of HTTP libraries, command line tools,
+// headless browsers and crawlers.
+var toolUserAgent = regexp.MustCompile(`(?i)\b(?:curl|wget|python-requests|python-urllib|aiohttp|httpx|go-http-client|java/|okhttp|libwww-perl|scrapy|apache-httpclient|node-fetch|axios|headlesschrome|phantomjs|selenium|puppeteer|playwright)|(?:bot|crawler|spider|scraper)\b`)
+
+func init() {
+	httppipeline.Register(&BotDetector{})
+	secret.RegisterSensitiveFields("challengeSecret")
+}
+
+type (
+	// BotDetector detects bots and scrapers by heuristics, and blocks,
+	// tarpits or challenges them.
+	BotDetector struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		allowed     []*regexp.Regexp
+		denied      []*regexp.Regexp
+		tarpitDelay time.Duration
+		challenger  *challenger
+
+		rateWindow time.Duration
+		rates      *lru.Cache
+
+		inspected uint64
+		detected  uint64
+	}
+
+	// Spec describes the BotDetector.
+	Spec struct {
+		Threshold int    `yaml:"threshold" jsonschema:"omitempty,minimum=1"`
+		Action    string `yaml:"action" jsonschema:"omitempty,enum=,enum=block,enum=tarpit,enum=challenge"`
+		// TarpitDelay is how long requests are delayed by the tarpit action.
+		TarpitDelay string `yaml:"tarpitDelay" jsonschema:"omitempty,format=duration"`
+
+		// AllowedUserAgents are regular expressions of user agents never
+		// treated as bots, e.g. search engines.
+		AllowedUserAgents []string `yaml:"allowedUserAgents" jsonschema:"omitempty,uniqueItems=true"`
+		// DeniedUserAgents are regular expressions of user agents treated as
+		// bots, in addition to the built-in ones.
+		DeniedUserAgents []string  `yaml:"deniedUserAgents" jsonschema:"omitempty,uniqueItems=true"`
+		Rate             *RateSpec `yaml:"rate,omitempty" jsonschema:"omitempty"`
+
+		// ChallengeSecret signs challenge cookies, it should be the same
+		// on all members, a random one is used if it is empty.
+		ChallengeSecret string `yaml:"challengeSecret" jsonschema:"omitempty"`
+		ChallengeTTL    string `yaml:"challengeTTL" jsonschema:"omitempty,format=duration"`
+		ChallengeCookie string `yaml:"challengeCookie" jsonschema:"omitempty"`
+	}
+
+	// RateSpec describes the rate anomaly check, a client sending more than
+	// maxRequests requests in the window is suspicious.
+	RateSpec struct {
+		MaxRequests int    `yaml:"maxRequests" jsonschema:"required,minimum=1"`
+		Window      string `yaml:"window" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of BotDetector.
+	Status struct {
+		Inspected uint64 `yaml:"inspected"`
+		Detected  uint64 `yaml:"detected"`
+	}
+
+	rateWindow struct {
+		mutex sync.Mutex
+		start time.Time
+		count int
+	}
+
+	heuristic struct {
+		name  string
+		score int
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	for _, expr := range append(append([]string{}, s.AllowedUserAgents...), s.DeniedUserAgents...) {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid user agent regexp %s: %v", expr, err)
+		}
+	}
+	return nil
+}
+
+// Kind returns the kind of BotDetector.
+func (bd *BotDetector) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of BotDetector.
+func (bd *BotDetector) DefaultSpec() interface{} {
+	return &Spec{
+		Threshold:       5,
+		Action:          actionBlock,
+		ChallengeCookie: "EG_BOT",
+	}
+}
+
+// Description returns the description of BotDetector.
+func (bd *BotDetector) Description() string {
+	return "BotDetector detects bots and scrapers, and blocks, tarpits or challenges them."
+}
+
+// Results returns the results of BotDetector.
+func (bd *BotDetector) Results() []string {
+	return results
+}
+
+// Init initializes BotDetector.
+func (bd *BotDetector) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	bd.pipeSpec, bd.spec, bd.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	bd.reload()
+}
+
+// Inherit inherits previous generation of BotDetector.
+func (bd *BotDetector) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	bd.Init(pipeSpec, super)
+}
+
+func parseDuration(d string, dflt time.Duration) time.Duration {
+	if d == "" {
+		return dflt
+	}
+	v, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return dflt
+	}
+	return v
+}
+
+func (bd *BotDetector) reload() {
+	bd.allowed, bd.denied = nil, nil
+	for _, expr := range bd.spec.AllowedUserAgents {
+		bd.allowed = append(bd.allowed, regexp.MustCompile(expr))
+	}
+	for _, expr := range bd.spec.DeniedUserAgents {
+		bd.denied = append(bd.denied, regexp.MustCompile(expr))
+	}
+
+	bd.tarpitDelay = parseDuration(bd.spec.TarpitDelay, defaultTarpitDelay)
+
+	secret := []byte(bd.spec.ChallengeSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	bd.challenger = &challenger{
+		secret: secret,
+		ttl:    parseDuration(bd.spec.ChallengeTTL, defaultChallengeTTL),
+	}
+
+	if bd.spec.Rate != nil {
+		bd.rateWindow = parseDuration(bd.spec.Rate.Window, defaultRateWindow)
+		var err error
+		bd.rates, err = lru.New(maxTrackedClients)
+		if err != nil {
+			logger.Errorf("BUG: new lru cache failed: %v", err)
+		}
+	}
+}
+
+// Handle detects bots in HTTPContext.
+func (bd *BotDetector) Handle(ctx context.HTTPContext) string {
+	result := bd.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (bd *BotDetector) handle(ctx context.HTTPContext) string {
+	atomic.AddUint64(&bd.inspected, 1)
+
+	r, w := ctx.Request(), ctx.Response()
+	client, ua := r.RealIP(), r.Header().Get("User-Agent")
+
+	for _, re := range bd.allowed {
+		if re.MatchString(ua) {
+			return ""
+		}
+	}
+
+	if bd.spec.Action == actionChallenge {
+		if cookie, err := r.Cookie(bd.spec.ChallengeCookie); err == nil &&
+			bd.challenger.verify(client, cookie.Value) {
+			return ""
+		}
+	}
+
+	score, names := 0, []string{}
+	for _, h := range bd.detect(r, client, ua) {
+		score += h.score
+		names = append(names, h.name)
+	}
+	if score < bd.spec.Threshold {
+		return ""
+	}
+
+	atomic.AddUint64(&bd.detected, 1)
+	ctx.AddTag(stringtool.Cat("botdetector: score ", strconv.Itoa(score), ", ", strings.Join(names, ",")))
+
+	switch bd.spec.Action {
+	case actionTarpit:
+		timer := time.NewTimer(bd.tarpitDelay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Std().Context().Done():
+		}
+		return ""
+
+	case actionChallenge:
+		page, err := bd.challenger.page(bd.spec.ChallengeCookie, client)
+		if err != nil {
+			logger.Errorf("BUG: render challenge page failed: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.SetStatusCode(http.StatusForbidden)
+		w.SetBody(strings.NewReader(page))
+		return resultChallenged
+
+	default:
+		w.SetStatusCode(http.StatusForbidden)
+		return resultBlocked
+	}
+}
+
+func (bd *BotDetector) detect(r context.HTTPRequest, client, ua string) []*heuristic {
+	var result []*heuristic
+	add := func(name string, score int) {
+		result = append(result, &heuristic{name: name, score: score})
+	}
+
+	h := r.Header()
+	switch {
+	case ua == "":
+		add("missing-user-agent", 5)
+	case toolUserAgent.MatchString(ua):
+		add("tool-user-agent", 5)
+	default:
+		for _, re := range bd.denied {
+			if re.MatchString(ua) {
+				add("denied-user-agent", 5)
+				break
+			}
+		}
+	}
+
+	// NOTE: The order of headers is not checked, because it is not kept
+	// by the HTTP server, headers every browser sends are checked instead.
+	if strings.HasPrefix(ua, "Mozilla/") {
+		if h.Get("Accept-Language") == "" {
+			add("missing-accept-language", 3)
+		}
+		if h.Get("Accept") == "" || h.Get("Accept-Encoding") == "" {
+			add("missing-accept", 2)
+		}
+		if strings.Contains(ua, "Chrome/") && h.Get("Sec-Fetch-Mode") == "" {
+			add("missing-fetch-metadata", 2)
+		}
+	}
+
+	if bd.rates != nil && bd.rateExceeded(client) {
+		add("rate-anomaly", 5)
+	}
+
+	return result
+}
+
+// rateExceeded counts the request of the client, and returns whether the
+// client sent more requests than allowed in the current window.
+func (bd *BotDetector) rateExceeded(client string) bool {
+	rw := &rateWindow{start: time.Now()}
+	if exists, _ := bd.rates.ContainsOrAdd(client, rw); exists {
+		if v, ok := bd.rates.Get(client); ok {
+			rw = v.(*rateWindow)
+		}
+	}
+
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(rw.start) >= bd.rateWindow {
+		rw.start, rw.count = now, 0
+	}
+	rw.count++
+
+	return rw.count > bd.spec.Rate.MaxRequests
+}
+
+// Status returns the status of BotDetector.
+func (bd *BotDetector) Status() interface{} {
+	return &Status{
+		Inspected: atomic.LoadUint64(&bd.inspected),
+		Detected:  atomic.LoadUint64(&bd.detected),
+	}
+}
+
+// Close closes BotDetector.
+func (bd *BotDetector) Close() {}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package botdetector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+)
+
+const chromeUA = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.45 Safari/537.36"
+
+func newBotDetector(t *testing.T, spec map[string]interface{}) *BotDetector {
+	return filtertest.NewFilter(t, &BotDetector{}, spec).(*BotDetector)
+}
+
+func newContext(headers map[string]string) context.HTTPContext {
+	r := filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", headers)
+	r.RemoteAddr = "10.0.0.1:12345"
+	return filtertest.NewContext(r)
+}
+
+func browserHeaders() map[string]string {
+	return map[string]string{
+		"User-Agent":      chromeUA,
+		"Accept":          "text/html",
+		"Accept-Encoding": "gzip",
+		"Accept-Language": "en-US",
+		"Sec-Fetch-Mode":  "navigate",
+	}
+}
+
+func TestDetect(t *testing.T) {
+	bd := newBotDetector(t, map[string]interface{}{
+		"allowedUserAgents": []string{"Googlebot"},
+		"deniedUserAgents":  []string{"^BadClient"},
+	})
+
+	cases := []struct {
+		headers map[string]string
+		blocked bool
+	}{
+		{headers: browserHeaders(), blocked: false},
+		{headers: map[string]string{}, blocked: true},
+		{headers: map[string]string{"User-Agent": "curl/7.68.0"}, blocked: true},
+		{headers: map[string]string{"User-Agent": "python-requests/2.25.1"}, blocked: true},
+		{headers: map[string]string{"User-Agent": "BadClient/1.0"}, blocked: true},
+		{headers: map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1)"}, blocked: false},
+		// Browser user agent without the headers of browsers.
+		{headers: map[string]string{"User-Agent": chromeUA}, blocked: true},
+	}
+
+	for i, c := range cases {
+		if result := bd.handle(newContext(c.headers)); (result == resultBlocked) != c.blocked {
+			t.Errorf("case %d: blocked should be %v, got %q", i, c.blocked, result)
+		}
+	}
+}
+
+func TestRateAnomaly(t *testing.T) {
+	bd := newBotDetector(t, map[string]interface{}{
+		"rate": map[string]interface{}{"maxRequests": 3, "window": "1m"},
+	})
+
+	for i := 0; i < 3; i++ {
+		if result := bd.handle(newContext(browserHeaders())); result != "" {
+			t.Fatalf("request %d should pass, got %q", i, result)
+		}
+	}
+	if result := bd.handle(newContext(browserHeaders())); result != resultBlocked {
+		t.Errorf("request exceeding the rate should be blocked, got %q", result)
+	}
+}
+
+func TestTarpit(t *testing.T) {
+	bd := newBotDetector(t, map[string]interface{}{
+		"action":      "tarpit",
+		"tarpitDelay": "100ms",
+	})
+
+	start := time.Now()
+	if result := bd.handle(newContext(map[string]string{"User-Agent": "curl/7.68.0"})); result != "" {
+		t.Errorf("tarpit should continue the request, got %q", result)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Errorf("tarpit should delay the request")
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	bd := newBotDetector(t, map[string]interface{}{
+		"action":          "challenge",
+		"challengeSecret": "secret",
+	})
+
+	headers := map[string]string{"User-Agent": chromeUA}
+	ctx := newContext(headers)
+	if result := bd.handle(ctx); result != resultChallenged {
+		t.Fatalf("request should be challenged, got %q", result)
+	}
+
+	page, _ := ioutil.ReadAll(ctx.Response().Body())
+	m := regexp.MustCompile(`EG_BOT=(\d+\.[\w-]+)`).FindSubmatch(page)
+	if m == nil {
+		t.Fatalf("challenge page should set the cookie: %s", page)
+	}
+
+	headers["Cookie"] = "EG_BOT=" + string(m[1])
+	if result := bd.handle(newContext(headers)); result != "" {
+		t.Errorf("request with a valid challenge cookie should pass, got %q", result)
+	}
+
+	headers["X-Forwarded-For"] = "10.0.0.2"
+	if result := bd.handle(newContext(headers)); result != resultChallenged {
+		t.Errorf("challenge cookie should be bound to the client, got %q", result)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package botdetector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var challengePage = template.Must(template.New("challenge").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Checking your browser</title></head>
+<body>
+<noscript>Please enable JavaScript to continue.</noscript>
+<script>
+document.cookie = {{.Cookie}};
+location.reload();
+</script>
+</body>
+</html>
+`))
+
+// challenger issues and verifies tokens of the JavaScript challenge, a
+// token is bound to the client and expires.
+type challenger struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func (c *challenger) sign(client string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(client + "|" + strconv.FormatInt(expiresAt, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *challenger) issue(client string) string {
+	expiresAt := time.Now().Add(c.ttl).Unix()
+	return strconv.FormatInt(expiresAt, 10) + "." + c.sign(client, expiresAt)
+}
+
+func (c *challenger) verify(client, token string) bool {
+	i := strings.IndexByte(token, '.')
+	if i <= 0 {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(token[:i], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+
+	return hmac.Equal([]byte(token[i+1:]), []byte(c.sign(client, expiresAt)))
+}
+
+func (c *challenger) page(cookieName, client string) (string, error) {
+	cookie := fmt.Sprintf("%s=%s; path=/; max-age=%d; SameSite=Lax",
+		cookieName, c.issue(client), int(c.ttl.Seconds()))
+
+	var sb strings.Builder
+	err := challengePage.Execute(&sb, struct{ Cookie string }{cookie})
+	return sb.String(), err
+}
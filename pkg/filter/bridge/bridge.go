@@ -99,7 +99,6 @@ func (b *Bridge) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Super
 func (b *Bridge) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	b.Init(pipeSpec, super)
 }
 
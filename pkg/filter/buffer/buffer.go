@@ -0,0 +1,472 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package buffer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	// Kind is the kind of Buffer.
+	Kind = "Buffer"
+
+	resultBuffered = "buffered"
+	resultDropped  = "dropped"
+
+	// DropOldest drops the oldest buffered request if the buffer is full.
+	DropOldest = "dropOldest"
+	// DropNewest drops the incoming request if the buffer is full.
+	DropNewest = "dropNewest"
+
+	defaultMaxEntries     = 1000
+	defaultMaxBodySize    = 1024 * 1024
+	defaultDiskMaxSize    = 64 * 1024 * 1024
+	defaultReplayInterval = 5 * time.Second
+)
+
+var results = []string{resultBuffered, resultDropped}
+
+func init() {
+	httppipeline.Register(&Buffer{})
+}
+
+type (
+	// Buffer sends requests to an output pipeline, and buffers them
+	// in memory or on disk to replay later if the output fails.
+	Buffer struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		replayInterval time.Duration
+
+		mutex sync.Mutex
+		queue *queue
+		// next is the next generation, which takes over the requests
+		// buffered by the ones in flight of this generation.
+		next *Buffer
+
+		buffered uint64
+		replayed uint64
+		dropped  uint64
+
+		done     chan struct{}
+		wg       sync.WaitGroup
+		stopOnce sync.Once
+	}
+
+	// Spec describes the Buffer.
+	Spec struct {
+		Pipeline       string    `yaml:"pipeline" jsonschema:"required"`
+		FailureCodes   []int     `yaml:"failureCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		StatusCode     int       `yaml:"statusCode" jsonschema:"omitempty,format=httpcode"`
+		MaxEntries     int       `yaml:"maxEntries" jsonschema:"omitempty,minimum=1"`
+		MaxBodySize    int64     `yaml:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+		DropPolicy     string    `yaml:"dropPolicy" jsonschema:"omitempty,enum=,enum=dropOldest,enum=dropNewest"`
+		ReplayInterval string    `yaml:"replayInterval" jsonschema:"omitempty,format=duration"`
+		Disk           *DiskSpec `yaml:"disk,omitempty" jsonschema:"omitempty"`
+	}
+
+	// DiskSpec describes the disk to spill requests to.
+	DiskSpec struct {
+		Dir     string `yaml:"dir" jsonschema:"required"`
+		MaxSize int64  `yaml:"maxSize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of Buffer.
+	Status struct {
+		Entries  int    `yaml:"entries"`
+		DiskSize int64  `yaml:"diskSize"`
+		Buffered uint64 `yaml:"buffered"`
+		Replayed uint64 `yaml:"replayed"`
+		Dropped  uint64 `yaml:"dropped"`
+	}
+
+	// response is the response of the output pipeline.
+	response struct {
+		statusCode int
+		header     http.Header
+		body       []byte
+	}
+)
+
+// Kind returns the kind of Buffer.
+func (b *Buffer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Buffer.
+func (b *Buffer) DefaultSpec() interface{} {
+	return &Spec{
+		StatusCode:  http.StatusAccepted,
+		MaxEntries:  defaultMaxEntries,
+		MaxBodySize: defaultMaxBodySize,
+		DropPolicy:  DropNewest,
+	}
+}
+
+// Description returns the description of Buffer.
+func (b *Buffer) Description() string {
+	return "Buffer buffers requests to replay them when the output pipeline fails."
+}
+
+// Results returns the results of Buffer.
+func (b *Buffer) Results() []string {
+	return results
+}
+
+// Init initializes Buffer.
+func (b *Buffer) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	b.pipeSpec, b.spec, b.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	b.reload()
+}
+
+// Inherit inherits previous generation of Buffer.
+func (b *Buffer) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	// NOTE: The previous generation is closed by the pipeline after its
+	// requests in flight complete, only its replay is stopped here, so the
+	// generations never replay the same requests.
+	prev := previousGeneration.(*Buffer)
+	prev.stopReplay()
+
+	// NOTE: Requests on disk are loaded by the new generation, the ones
+	// in memory are taken over, and the requests in flight of the previous
+	// generation are buffered by the new one.
+	prev.mutex.Lock()
+	defer prev.mutex.Unlock()
+
+	b.Init(pipeSpec, super)
+	b.mutex.Lock()
+	b.queue.mem = append(prev.queue.mem, b.queue.mem...)
+	if prev.queue.nextSeq > b.queue.nextSeq {
+		b.queue.nextSeq = prev.queue.nextSeq
+	}
+	b.mutex.Unlock()
+
+	prev.queue.mem, prev.next = nil, b
+}
+
+func (b *Buffer) reload() {
+	b.replayInterval = defaultReplayInterval
+	if b.spec.ReplayInterval != "" {
+		var err error
+		b.replayInterval, err = time.ParseDuration(b.spec.ReplayInterval)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", b.spec.ReplayInterval, err)
+			b.replayInterval = defaultReplayInterval
+		}
+	}
+
+	var disk *diskQueue
+	if b.spec.Disk != nil {
+		maxSize := b.spec.Disk.MaxSize
+		if maxSize == 0 {
+			maxSize = defaultDiskMaxSize
+		}
+
+		var err error
+		disk, err = newDiskQueue(b.spec.Disk.Dir, maxSize)
+		if err != nil {
+			logger.Errorf("%s: %v, buffer in memory only", b.pipeSpec.Name(), err)
+		} else if len(disk.files) > 0 {
+			logger.Infof("%s: load %d buffered requests from %s",
+				b.pipeSpec.Name(), len(disk.files), b.spec.Disk.Dir)
+		}
+	}
+	b.queue = newQueue(b.spec.MaxEntries, disk)
+
+	b.done = make(chan struct{})
+	b.wg.Add(1)
+	go b.run()
+}
+
+// Handle buffers HTTPContext.
+func (b *Buffer) Handle(ctx context.HTTPContext) string {
+	result := b.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (b *Buffer) handle(ctx context.HTTPContext) string {
+	w := ctx.Response()
+
+	e, err := b.newEntry(ctx)
+	if err != nil {
+		ctx.AddTag(fmt.Sprintf("buffer: %v", err))
+		atomic.AddUint64(&b.dropped, 1)
+		w.SetStatusCode(http.StatusRequestEntityTooLarge)
+		return resultDropped
+	}
+
+	// NOTE: Send the request directly only if nothing is buffered,
+	// otherwise it must wait behind buffered ones to keep the order.
+	b.mutex.Lock()
+	empty := b.queue.len() == 0
+	b.mutex.Unlock()
+
+	if empty {
+		resp, err := b.send(e)
+		if err == nil && !b.failed(resp.statusCode) {
+			w.SetStatusCode(resp.statusCode)
+			w.Header().AddFromStd(resp.header)
+			w.SetBody(bytes.NewReader(resp.body))
+			return ""
+		}
+		if err != nil {
+			ctx.AddTag(fmt.Sprintf("buffer: %v", err))
+		}
+	}
+
+	if !b.buffer(e) {
+		w.SetStatusCode(http.StatusServiceUnavailable)
+		return resultDropped
+	}
+
+	w.SetStatusCode(b.spec.StatusCode)
+	return resultBuffered
+}
+
+func (b *Buffer) newEntry(ctx context.HTTPContext) (*entry, error) {
+	r := ctx.Request()
+
+	var body []byte
+	if r.Body() != nil {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body(), b.spec.MaxBodySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("read body failed: %v", err)
+		}
+		if int64(len(body)) > b.spec.MaxBodySize {
+			return nil, fmt.Errorf("body exceed %dB", b.spec.MaxBodySize)
+		}
+		r.SetBody(bytes.NewReader(body))
+	}
+
+	return &entry{
+		Method:     r.Method(),
+		URL:        r.Std().URL.String(),
+		Host:       r.Host(),
+		RemoteAddr: r.Std().RemoteAddr,
+		Header:     r.Header().Copy().Std(),
+		Body:       body,
+		Time:       time.Now().Unix(),
+	}, nil
+}
+
+// buffer pushes the entry to the queue, it returns false if it's dropped.
+func (b *Buffer) buffer(e *entry) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.next != nil {
+		return b.next.buffer(e)
+	}
+
+	for {
+		ok, err := b.queue.push(e)
+		if err != nil {
+			logger.Errorf("%s: buffer request failed: %v", b.pipeSpec.Name(), err)
+			atomic.AddUint64(&b.dropped, 1)
+			return false
+		}
+		if ok {
+			atomic.AddUint64(&b.buffered, 1)
+			return true
+		}
+
+		if b.spec.DropPolicy != DropOldest || b.queue.len() == 0 {
+			atomic.AddUint64(&b.dropped, 1)
+			return false
+		}
+
+		err = b.queue.pop()
+		if err != nil {
+			logger.Errorf("%s: drop oldest request failed: %v", b.pipeSpec.Name(), err)
+		}
+		atomic.AddUint64(&b.dropped, 1)
+	}
+}
+
+func (b *Buffer) failed(statusCode int) bool {
+	if len(b.spec.FailureCodes) == 0 {
+		return statusCode >= 500
+	}
+
+	for _, code := range b.spec.FailureCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the entry to the output pipeline.
+func (b *Buffer) send(e *entry) (*response, error) {
+	ro, exists := b.super.GetRunningObject(b.spec.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		return nil, fmt.Errorf("pipeline %s not found", b.spec.Pipeline)
+	}
+
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a handler", b.spec.Pipeline)
+	}
+
+	req, err := http.NewRequest(e.Method, e.URL, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, fmt.Errorf("new request failed: %v", err)
+	}
+	req.Header = e.Header
+	req.Host = e.Host
+	req.RemoteAddr = e.RemoteAddr
+
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+	handler.Handle(ctx)
+
+	w := ctx.Response()
+	resp := &response{
+		statusCode: w.StatusCode(),
+		header:     w.Header().Std().Clone(),
+	}
+	if body := w.Body(); body != nil {
+		resp.body, err = ioutil.ReadAll(body)
+		w.SetBody(bytes.NewReader(resp.body))
+	}
+	ctx.Finish()
+
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %v", err)
+	}
+
+	return resp, nil
+}
+
+func (b *Buffer) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.replay()
+		}
+	}
+}
+
+// replay sends buffered requests in order until the output fails.
+func (b *Buffer) replay() {
+	for {
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+
+		b.mutex.Lock()
+		e, err := b.queue.head()
+		if err != nil {
+			logger.Errorf("%s: drop broken request: %v", b.pipeSpec.Name(), err)
+			b.queue.pop()
+			atomic.AddUint64(&b.dropped, 1)
+			b.mutex.Unlock()
+			continue
+		}
+		b.mutex.Unlock()
+
+		if e == nil {
+			return
+		}
+
+		resp, err := b.send(e)
+		if err != nil || b.failed(resp.statusCode) {
+			return
+		}
+
+		b.mutex.Lock()
+		// NOTE: The head may have been dropped while sending.
+		if head, err := b.queue.head(); err == nil && head != nil && head.seq == e.seq {
+			b.queue.pop()
+		}
+		b.mutex.Unlock()
+
+		atomic.AddUint64(&b.replayed, 1)
+	}
+}
+
+// Status returns status.
+func (b *Buffer) Status() interface{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	s := &Status{
+		Entries:  b.queue.len(),
+		Buffered: atomic.LoadUint64(&b.buffered),
+		Replayed: atomic.LoadUint64(&b.replayed),
+		Dropped:  atomic.LoadUint64(&b.dropped),
+	}
+	if b.queue.disk != nil {
+		s.DiskSize = b.queue.disk.size
+	}
+
+	return s
+}
+
+// stopReplay stops replaying buffered requests, it could be called more
+// than once.
+func (b *Buffer) stopReplay() {
+	b.stopOnce.Do(func() {
+		close(b.done)
+		b.wg.Wait()
+	})
+}
+
+// Close closes Buffer, the requests in memory are spilled to disk if it's
+// not taken over by the next generation.
+func (b *Buffer) Close() {
+	b.stopReplay()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.next != nil {
+		return
+	}
+	err := b.queue.spill()
+	if err != nil {
+		logger.Errorf("%s: spill buffered requests to disk failed: %v", b.pipeSpec.Name(), err)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package buffer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+)
+
+func TestReloadWithRequestInFlight(t *testing.T) {
+	dir := t.TempDir()
+	spec := map[string]interface{}{
+		"pipeline":       "output",
+		"replayInterval": "1h",
+		"disk":           map[string]interface{}{"dir": dir},
+	}
+	prev := filtertest.NewFilter(t, &Buffer{}, spec).(*Buffer)
+	pushN(t, prev.queue, 0, 2)
+
+	b := filtertest.InheritFilter(t, &Buffer{}, prev, spec).(*Buffer)
+	t.Cleanup(b.Close)
+
+	// The request in flight of the previous generation is buffered by the
+	// new one, and closing the previous generation spills nothing.
+	if !prev.buffer(&entry{URL: "/2"}) {
+		t.Fatalf("want the request in flight buffered")
+	}
+	prev.Close()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 0 {
+		t.Errorf("want nothing spilled by the previous generation, got %d files, %v", len(files), err)
+	}
+	if urls := popAll(t, b.queue); fmt.Sprint(urls) != "[/0 /1 /2]" {
+		t.Errorf("want [/0 /1 /2], got %v", urls)
+	}
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package buffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	entryFileSuffix = ".entry"
+)
+
+type (
+	// entry is a buffered request.
+	entry struct {
+		seq uint64
+
+		Method     string              `json:"method"`
+		URL        string              `json:"url"`
+		Host       string              `json:"host"`
+		RemoteAddr string              `json:"remoteAddr"`
+		Header     map[string][]string `json:"header"`
+		Body       []byte              `json:"body"`
+		Time       int64               `json:"time"`
+	}
+
+	// queue is a FIFO queue of entries, it keeps entries in memory and
+	// spills them to disk if the memory is full. Entries on disk are always
+	// newer than the ones in memory and the memory is refilled from disk,
+	// so the order is kept.
+	queue struct {
+		maxEntries int
+		disk       *diskQueue
+
+		mem     []*entry
+		nextSeq uint64
+	}
+
+	diskQueue struct {
+		dir     string
+		maxSize int64
+
+		// files are sequences of entries on disk in order.
+		files []uint64
+		sizes map[uint64]int64
+		size  int64
+	}
+)
+
+func newQueue(maxEntries int, disk *diskQueue) *queue {
+	q := &queue{
+		maxEntries: maxEntries,
+		disk:       disk,
+	}
+	if disk != nil && len(disk.files) > 0 {
+		q.nextSeq = disk.files[len(disk.files)-1] + 1
+	}
+	return q
+}
+
+func (q *queue) len() int {
+	n := len(q.mem)
+	if q.disk != nil {
+		n += len(q.disk.files)
+	}
+	return n
+}
+
+// push pushes the entry to the tail, it returns false if the queue is full.
+func (q *queue) push(e *entry) (bool, error) {
+	e.seq = q.nextSeq
+
+	switch {
+	case len(q.mem) < q.maxEntries && (q.disk == nil || len(q.disk.files) == 0):
+		q.mem = append(q.mem, e)
+	case q.disk != nil:
+		ok, err := q.disk.push(e)
+		if !ok || err != nil {
+			return ok, err
+		}
+	default:
+		return false, nil
+	}
+
+	q.nextSeq++
+	return true, nil
+}
+
+// head returns the oldest entry, or nil if the queue is empty.
+func (q *queue) head() (*entry, error) {
+	if len(q.mem) > 0 {
+		return q.mem[0], nil
+	}
+	if q.disk != nil && len(q.disk.files) > 0 {
+		return q.disk.head()
+	}
+	return nil, nil
+}
+
+// pop removes the oldest entry.
+func (q *queue) pop() error {
+	if len(q.mem) == 0 {
+		if q.disk != nil && len(q.disk.files) > 0 {
+			return q.disk.pop()
+		}
+		return nil
+	}
+
+	q.mem[0] = nil
+	q.mem = q.mem[1:]
+
+	if q.disk == nil || len(q.disk.files) == 0 {
+		return nil
+	}
+
+	// NOTE: The broken entry is dropped anyway, otherwise it blocks the queue.
+	e, err := q.disk.head()
+	if err == nil {
+		q.mem = append(q.mem, e)
+	}
+	if popErr := q.disk.pop(); err == nil {
+		err = popErr
+	}
+	return err
+}
+
+// spill moves all entries in memory to disk regardless of the max size,
+// so they are not lost after closing.
+func (q *queue) spill() error {
+	if q.disk == nil {
+		return nil
+	}
+
+	for len(q.mem) > 0 {
+		err := q.disk.write(q.mem[0])
+		if err != nil {
+			return err
+		}
+		q.mem[0] = nil
+		q.mem = q.mem[1:]
+	}
+	sort.Slice(q.disk.files, func(i, j int) bool {
+		return q.disk.files[i] < q.disk.files[j]
+	})
+
+	return nil
+}
+
+func newDiskQueue(dir string, maxSize int64) (*diskQueue, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("create dir %s failed: %v", dir, err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %s failed: %v", dir, err)
+	}
+
+	dq := &diskQueue{
+		dir:     dir,
+		maxSize: maxSize,
+		sizes:   map[uint64]int64{},
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, entryFileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, entryFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		dq.files = append(dq.files, seq)
+		dq.sizes[seq] = info.Size()
+		dq.size += info.Size()
+	}
+	sort.Slice(dq.files, func(i, j int) bool {
+		return dq.files[i] < dq.files[j]
+	})
+
+	return dq, nil
+}
+
+func (dq *diskQueue) path(seq uint64) string {
+	return filepath.Join(dq.dir, fmt.Sprintf("%020d%s", seq, entryFileSuffix))
+}
+
+func (dq *diskQueue) push(e *entry) (bool, error) {
+	buff, err := json.Marshal(e)
+	if err != nil {
+		return false, fmt.Errorf("marshal entry failed: %v", err)
+	}
+
+	if dq.size+int64(len(buff)) > dq.maxSize {
+		return false, nil
+	}
+
+	return true, dq.writeFile(e.seq, buff)
+}
+
+func (dq *diskQueue) write(e *entry) error {
+	buff, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal entry failed: %v", err)
+	}
+
+	return dq.writeFile(e.seq, buff)
+}
+
+func (dq *diskQueue) writeFile(seq uint64, buff []byte) error {
+	// NOTE: Write to a temporary file first, so a crash never leaves
+	// a broken entry behind.
+	path := dq.path(seq)
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, buff, 0o640)
+	if err != nil {
+		return fmt.Errorf("write %s failed: %v", tmp, err)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename %s failed: %v", tmp, err)
+	}
+
+	size := int64(len(buff))
+	dq.files = append(dq.files, seq)
+	dq.sizes[seq] = size
+	dq.size += size
+
+	return nil
+}
+
+func (dq *diskQueue) head() (*entry, error) {
+	seq := dq.files[0]
+	buff, err := ioutil.ReadFile(dq.path(seq))
+	if err != nil {
+		return nil, fmt.Errorf("read entry %d failed: %v", seq, err)
+	}
+
+	e := &entry{}
+	err = json.Unmarshal(buff, e)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal entry %d failed: %v", seq, err)
+	}
+	e.seq = seq
+
+	return e, nil
+}
+
+func (dq *diskQueue) pop() error {
+	seq := dq.files[0]
+	dq.files = dq.files[1:]
+	dq.size -= dq.sizes[seq]
+	delete(dq.sizes, seq)
+
+	err := os.Remove(dq.path(seq))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove entry %d failed: %v", seq, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package buffer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func pushN(t *testing.T, q *queue, from, to int) {
+	for i := from; i < to; i++ {
+		ok, err := q.push(&entry{URL: fmt.Sprintf("/%d", i)})
+		if err != nil || !ok {
+			t.Fatalf("push %d failed: %v, %v", i, ok, err)
+		}
+	}
+}
+
+func popAll(t *testing.T, q *queue) []string {
+	var urls []string
+	for {
+		e, err := q.head()
+		if err != nil {
+			t.Fatalf("head failed: %v", err)
+		}
+		if e == nil {
+			return urls
+		}
+		urls = append(urls, e.URL)
+		if err = q.pop(); err != nil {
+			t.Fatalf("pop failed: %v", err)
+		}
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	q := newQueue(3, nil)
+	pushN(t, q, 0, 3)
+
+	if ok, _ := q.push(&entry{URL: "/3"}); ok {
+		t.Fatalf("push to a full queue should fail")
+	}
+
+	urls := popAll(t, q)
+	if fmt.Sprint(urls) != "[/0 /1 /2]" {
+		t.Fatalf("unexpected order: %v", urls)
+	}
+}
+
+func TestDiskQueue(t *testing.T) {
+	dir := t.TempDir()
+
+	dq, err := newDiskQueue(dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("new disk queue failed: %v", err)
+	}
+	q := newQueue(2, dq)
+	pushN(t, q, 0, 5)
+	if len(q.mem) != 2 || len(dq.files) != 3 {
+		t.Fatalf("entries should be spilled to disk, memory %d, disk %d", len(q.mem), len(dq.files))
+	}
+
+	// NOTE: The memory is refilled from disk, so new entries are still
+	// spilled behind older ones.
+	if err = q.pop(); err != nil {
+		t.Fatalf("pop failed: %v", err)
+	}
+	pushN(t, q, 5, 6)
+	if len(q.mem) != 2 || len(dq.files) != 3 {
+		t.Fatalf("memory should be refilled, memory %d, disk %d", len(q.mem), len(dq.files))
+	}
+
+	if err = q.spill(); err != nil {
+		t.Fatalf("spill failed: %v", err)
+	}
+
+	dq, err = newDiskQueue(dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("new disk queue failed: %v", err)
+	}
+	q = newQueue(2, dq)
+	pushN(t, q, 6, 7)
+
+	urls := popAll(t, q)
+	if fmt.Sprint(urls) != "[/1 /2 /3 /4 /5 /6]" {
+		t.Fatalf("unexpected order: %v", urls)
+	}
+	if dq.size != 0 {
+		t.Fatalf("disk size should be 0 after popping all, got %d", dq.size)
+	}
+}
+
+func TestDiskQueueMaxSize(t *testing.T) {
+	dq, err := newDiskQueue(t.TempDir(), 200)
+	if err != nil {
+		t.Fatalf("new disk queue failed: %v", err)
+	}
+	q := newQueue(1, dq)
+	pushN(t, q, 0, 2)
+
+	full := false
+	for i := 2; i < 10; i++ {
+		ok, err := q.push(&entry{URL: fmt.Sprintf("/%d", i)})
+		if err != nil {
+			t.Fatalf("push failed: %v", err)
+		}
+		if !ok {
+			full = true
+			break
+		}
+	}
+	if !full {
+		t.Fatalf("disk queue should be full")
+	}
+	if dq.size > 200 {
+		t.Fatalf("disk size %d exceeds max size", dq.size)
+	}
+}
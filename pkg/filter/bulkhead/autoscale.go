@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bulkhead
+
+import (
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	defaultAutoscalePercentile = 99
+	defaultAutoscaleInterval   = time.Second
+
+	sampleSize = 1028
+)
+
+type (
+	// AutoscaleSpec describes the adjustment of the concurrency limit
+	// between MinConcurrency and MaxConcurrency of Bulkhead.
+	AutoscaleSpec struct {
+		MinConcurrency int     `yaml:"minConcurrency" jsonschema:"required,minimum=1"`
+		Step           int     `yaml:"step" jsonschema:"omitempty,minimum=1"`
+		TargetLatency  string  `yaml:"targetLatency" jsonschema:"omitempty,format=duration"`
+		Percentile     float64 `yaml:"percentile" jsonschema:"omitempty,exclusiveMinimum=0,maximum=100"`
+		MaxCPUPercent  float64 `yaml:"maxCPUPercent" jsonschema:"omitempty,exclusiveMinimum=0,maximum=100"`
+		Interval       string  `yaml:"interval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// autoscaler adjusts the concurrency limit every interval. The limit
+	// is enforced by holding the slots above it, so acquiring and
+	// releasing slots stay the same as the static limit.
+	autoscaler struct {
+		b             *Bulkhead
+		spec          *AutoscaleSpec
+		step          int
+		percentile    float64
+		targetLatency time.Duration
+		interval      time.Duration
+
+		held         int32
+		limit        int32
+		peak         int32
+		lastRejected uint64
+		cpuPercent   uint64
+		lastCPU      time.Duration
+		lastWall     time.Time
+
+		sample atomic.Value
+		done   chan struct{}
+	}
+)
+
+func newAutoscaler(b *Bulkhead, spec *AutoscaleSpec) *autoscaler {
+	a := &autoscaler{
+		b:        b,
+		spec:     spec,
+		step:     spec.Step,
+		interval: defaultAutoscaleInterval,
+		done:     make(chan struct{}),
+	}
+
+	if a.step == 0 {
+		a.step = b.spec.MaxConcurrency / 10
+		if a.step == 0 {
+			a.step = 1
+		}
+	}
+	a.percentile = spec.Percentile
+	if a.percentile == 0 {
+		a.percentile = defaultAutoscalePercentile
+	}
+	// NOTE: The formats have been validated.
+	if spec.TargetLatency != "" {
+		a.targetLatency, _ = time.ParseDuration(spec.TargetLatency)
+	}
+	if spec.Interval != "" {
+		a.interval, _ = time.ParseDuration(spec.Interval)
+	}
+
+	a.sample.Store(metrics.NewUniformSample(sampleSize))
+	a.lastCPU, _ = processCPUTime()
+	a.lastWall = time.Now()
+
+	// It starts from the min limit, and grows on demand.
+	a.setLimit(spec.MinConcurrency)
+
+	go a.run()
+
+	return a
+}
+
+func (a *autoscaler) run() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.adjust()
+		}
+	}
+}
+
+// adjust decreases the limit by step if the filters after Bulkhead are
+// overloaded, i.e. the latency exceeds the target or the CPU usage of
+// the process exceeds the max. Otherwise, it increases the limit by step
+// if requests were queued or rejected in the last interval, or decreases
+// it by step if the slots were not used.
+func (a *autoscaler) adjust() {
+	sample := a.sample.Load().(metrics.Sample)
+	a.sample.Store(metrics.NewUniformSample(sampleSize))
+	latency := time.Duration(sample.Percentile(a.percentile / 100))
+
+	overloaded := a.targetLatency > 0 && sample.Count() > 0 && latency > a.targetLatency
+	if cpu, ok := a.sampleCPU(); ok && a.spec.MaxCPUPercent > 0 && cpu > a.spec.MaxCPUPercent {
+		overloaded = true
+	}
+
+	rejected := atomic.LoadUint64(&a.b.rejected)
+	queued := atomic.LoadInt32(&a.b.waiting) > 0 || rejected > a.lastRejected
+	a.lastRejected = rejected
+
+	limit := int(atomic.LoadInt32(&a.limit))
+	peak := int(atomic.SwapInt32(&a.peak, int32(a.inFlight())))
+
+	switch {
+	case overloaded:
+		limit -= a.step
+	case queued:
+		limit += a.step
+	case peak <= limit-a.step:
+		limit -= a.step
+	}
+
+	a.setLimit(limit)
+}
+
+// setLimit sets the limit in [MinConcurrency, MaxConcurrency], slots are
+// held or returned to match the limit. If slots are in use, holding
+// them waits for the next adjustment.
+func (a *autoscaler) setLimit(limit int) {
+	max := a.b.spec.MaxConcurrency
+	if limit < a.spec.MinConcurrency {
+		limit = a.spec.MinConcurrency
+	}
+	if limit > max {
+		limit = max
+	}
+
+	held := int(atomic.LoadInt32(&a.held))
+hold:
+	for held < max-limit {
+		select {
+		case a.b.slots <- struct{}{}:
+			held++
+		default:
+			break hold
+		}
+	}
+	for held > max-limit {
+		<-a.b.slots
+		held--
+	}
+	if a.b.queue != nil {
+		a.b.dispatch()
+	}
+
+	atomic.StoreInt32(&a.held, int32(held))
+	atomic.StoreInt32(&a.limit, int32(max-held))
+}
+
+// sampleCPU returns the CPU usage of the process in percentage of all
+// CPUs since the last sampling.
+func (a *autoscaler) sampleCPU() (float64, bool) {
+	cpu, ok := processCPUTime()
+	if !ok {
+		return 0, false
+	}
+
+	now := time.Now()
+	wall := now.Sub(a.lastWall)
+	used := cpu - a.lastCPU
+	a.lastCPU, a.lastWall = cpu, now
+	if wall <= 0 {
+		return 0, false
+	}
+
+	percent := float64(used) / float64(wall) / float64(runtime.NumCPU()) * 100
+	atomic.StoreUint64(&a.cpuPercent, uint64(percent))
+	return percent, true
+}
+
+// observe records the latency of a request and the peak of in-flight
+// requests.
+func (a *autoscaler) observe(inFlight int, latency time.Duration) {
+	for {
+		peak := atomic.LoadInt32(&a.peak)
+		if int32(inFlight) <= peak || atomic.CompareAndSwapInt32(&a.peak, peak, int32(inFlight)) {
+			break
+		}
+	}
+	a.sample.Load().(metrics.Sample).Update(int64(latency))
+}
+
+func (a *autoscaler) inFlight() int {
+	return len(a.b.slots) - int(atomic.LoadInt32(&a.held))
+}
+
+func (a *autoscaler) close() {
+	close(a.done)
+}
+
+// processCPUTime returns the CPU time consumed by the process.
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
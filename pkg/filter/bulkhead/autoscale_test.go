@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bulkhead
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBulkhead(autoscale *AutoscaleSpec) *Bulkhead {
+	b := &Bulkhead{spec: &Spec{MaxConcurrency: 10, Autoscale: autoscale}}
+	b.reload()
+	return b
+}
+
+func TestAutoscale(t *testing.T) {
+	b := newTestBulkhead(&AutoscaleSpec{
+		MinConcurrency: 2,
+		Step:           3,
+		TargetLatency:  "10ms",
+		Interval:       "1h",
+	})
+	defer b.Close()
+	a := b.autoscaler
+
+	check := func(step string, want int32) {
+		t.Helper()
+		if got := b.Status().(*Status).Limit; got != want {
+			t.Errorf("%s: want limit %d, got %d", step, want, got)
+		}
+	}
+
+	check("init", 2)
+
+	atomic.StoreInt32(&b.waiting, 1)
+	a.adjust()
+	check("queued", 5)
+	a.adjust()
+	a.adjust()
+	check("queued to max", 10)
+	atomic.StoreInt32(&b.waiting, 0)
+
+	a.observe(10, 50*time.Millisecond)
+	a.adjust()
+	check("overloaded", 7)
+
+	a.observe(7, time.Millisecond)
+	a.adjust()
+	check("busy", 7)
+
+	a.adjust()
+	check("idle", 4)
+
+	// Slots in use are held on the next adjustment.
+	for i := 0; i < 4; i++ {
+		b.slots <- struct{}{}
+	}
+	a.observe(4, 50*time.Millisecond)
+	a.adjust()
+	check("overloaded with slots in use", 4)
+	b.release()
+	b.release()
+	a.observe(2, 50*time.Millisecond)
+	a.adjust()
+	check("slots released", 2)
+	if got := a.inFlight(); got != 2 {
+		t.Errorf("want 2 in-flight, got %d", got)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec := &Spec{MaxConcurrency: 10, Autoscale: &AutoscaleSpec{MinConcurrency: 11}}
+	if err := spec.Validate(); err == nil {
+		t.Errorf("want error for minConcurrency greater than maxConcurrency")
+	}
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bulkhead
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of Bulkhead.
+	Kind = "Bulkhead"
+
+	resultRejected = "rejected"
+)
+
+var (
+	results = []string{resultRejected}
+)
+
+func init() {
+	httppipeline.Register(&Bulkhead{})
+}
+
+type (
+	// Bulkhead limits the concurrent requests through the filters after it.
+	Bulkhead struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		slots      chan struct{}
+		maxWait    time.Duration
+		autoscaler *autoscaler
+		queue      *priorityQueue
+
+		waiting  int32
+		rejected uint64
+	}
+
+	// Spec describes the Bulkhead.
+	Spec struct {
+		MaxConcurrency int    `yaml:"maxConcurrency" jsonschema:"required,minimum=1"`
+		MaxQueue       int    `yaml:"maxQueue" jsonschema:"omitempty,minimum=0"`
+		MaxWait        string `yaml:"maxWait" jsonschema:"omitempty,format=duration"`
+
+		// Autoscale adjusts the concurrency limit dynamically, and
+		// MaxConcurrency is the upper bound of it.
+		Autoscale *AutoscaleSpec `yaml:"autoscale,omitempty" jsonschema:"omitempty"`
+
+		// Priority orders the waiting requests by priorities, instead of
+		// the arrival.
+		Priority *PrioritySpec `yaml:"priority,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of Bulkhead.
+	Status struct {
+		InFlight   int    `yaml:"inFlight"`
+		Waiting    int32  `yaml:"waiting"`
+		Rejected   uint64 `yaml:"rejected"`
+		Limit      int32  `yaml:"limit,omitempty"`
+		CPUPercent uint64 `yaml:"cpuPercent,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.Autoscale != nil && s.Autoscale.MinConcurrency > s.MaxConcurrency {
+		return fmt.Errorf("minConcurrency %d is greater than maxConcurrency %d",
+			s.Autoscale.MinConcurrency, s.MaxConcurrency)
+	}
+	if s.Priority != nil && s.MaxQueue == 0 {
+		return fmt.Errorf("priority needs a queue, but maxQueue is 0")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of Bulkhead.
+func (b *Bulkhead) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Bulkhead.
+func (b *Bulkhead) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of Bulkhead.
+func (b *Bulkhead) Description() string {
+	return "Bulkhead limits the concurrent requests through the filters after it."
+}
+
+// Results returns the results of Bulkhead.
+func (b *Bulkhead) Results() []string {
+	return results
+}
+
+// Produces returns nil, Bulkhead sets no header.
+func (b *Bulkhead) Produces(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value { return nil }
+
+// Consumes returns the headers matched by the priority rules of Bulkhead.
+func (b *Bulkhead) Consumes(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	priority := pipeSpec.FilterSpec().(*Spec).Priority
+	if priority == nil {
+		return nil
+	}
+
+	var values []*httppipeline.Value
+	for _, rule := range priority.Rules {
+		for key := range rule.Headers {
+			values = append(values, &httppipeline.Value{Header: key, Type: httppipeline.ValueString})
+		}
+	}
+	return values
+}
+
+// Init initializes Bulkhead.
+func (b *Bulkhead) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	b.pipeSpec, b.spec, b.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	b.reload()
+}
+
+// Inherit inherits previous generation of Bulkhead.
+func (b *Bulkhead) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	b.Init(pipeSpec, super)
+}
+
+func (b *Bulkhead) reload() {
+	b.slots = make(chan struct{}, b.spec.MaxConcurrency)
+
+	if b.spec.MaxWait != "" {
+		var err error
+		b.maxWait, err = time.ParseDuration(b.spec.MaxWait)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", b.spec.MaxWait, err)
+		}
+	}
+
+	b.queue = nil
+	if b.spec.Priority != nil {
+		b.spec.Priority.init()
+		b.queue = &priorityQueue{}
+	}
+
+	b.autoscaler = nil
+	if b.spec.Autoscale != nil {
+		b.autoscaler = newAutoscaler(b, b.spec.Autoscale)
+	}
+}
+
+// Handle limits the concurrent requests of HTTPContext.
+func (b *Bulkhead) Handle(ctx context.HTTPContext) string {
+	if !b.acquire(ctx) {
+		atomic.AddUint64(&b.rejected, 1)
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag("bulkhead: rejected")
+		return resultRejected
+	}
+	defer b.release()
+
+	if b.autoscaler == nil {
+		return ctx.CallNextHandler("")
+	}
+
+	inFlight, startTime := b.autoscaler.inFlight(), time.Now()
+	result := ctx.CallNextHandler("")
+	b.autoscaler.observe(inFlight, time.Since(startTime))
+
+	return result
+}
+
+// acquire acquires a slot, it waits in the queue if there's no free slot,
+// until a slot is free, maxWait passes or the request is cancelled.
+func (b *Bulkhead) acquire(ctx context.HTTPContext) bool {
+	if b.queue != nil {
+		return b.acquireByPriority(ctx)
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt32(&b.waiting, 1) > int32(b.spec.MaxQueue) {
+		atomic.AddInt32(&b.waiting, -1)
+		return false
+	}
+	defer atomic.AddInt32(&b.waiting, -1)
+
+	var timeout <-chan time.Time
+	if b.maxWait > 0 {
+		timer := time.NewTimer(b.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (b *Bulkhead) release() {
+	<-b.slots
+	if b.queue != nil {
+		b.dispatch()
+	}
+}
+
+// Status returns status.
+func (b *Bulkhead) Status() interface{} {
+	s := &Status{
+		InFlight: len(b.slots),
+		Waiting:  atomic.LoadInt32(&b.waiting),
+		Rejected: atomic.LoadUint64(&b.rejected),
+	}
+	if a := b.autoscaler; a != nil {
+		s.InFlight = a.inFlight()
+		s.Limit = atomic.LoadInt32(&a.limit)
+		s.CPUPercent = atomic.LoadUint64(&a.cpuPercent)
+	}
+
+	return s
+}
+
+// Close closes Bulkhead.
+func (b *Bulkhead) Close() {
+	if b.autoscaler != nil {
+		b.autoscaler.close()
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bulkhead
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+type (
+	// PrioritySpec describes the priorities of requests waiting for a
+	// free slot of Bulkhead.
+	PrioritySpec struct {
+		Default int             `yaml:"default" jsonschema:"omitempty"`
+		Rules   []*PriorityRule `yaml:"rules" jsonschema:"required,minItems=1"`
+	}
+
+	// PriorityRule gives the priority to requests whose headers match all
+	// of the rule, e.g. a header carrying the class of traffic, or a token
+	// with a pattern.
+	PriorityRule struct {
+		Priority int                             `yaml:"priority" jsonschema:"required"`
+		Headers  map[string]*urlrule.StringMatch `yaml:"headers" jsonschema:"required"`
+	}
+
+	// priorityQueue is the queue of waiting requests, a free slot is given
+	// to the waiter of the highest priority, and the earliest one among the
+	// waiters of the same priority.
+	priorityQueue struct {
+		sync.Mutex
+		waiters waiterHeap
+		seq     uint64
+	}
+
+	waiter struct {
+		priority int
+		seq      uint64
+		index    int
+
+		// ready is closed when the waiter is granted a slot, or evicted
+		// by a waiter of higher priority.
+		ready   chan struct{}
+		granted bool
+	}
+
+	waiterHeap []*waiter
+)
+
+func (h waiterHeap) Len() int { return len(h) }
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *waiterHeap) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+func (h *waiterHeap) Pop() interface{} {
+	old := *h
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	w.index = -1
+	return w
+}
+
+func (s *PrioritySpec) init() {
+	for _, rule := range s.Rules {
+		for _, sm := range rule.Headers {
+			sm.Init()
+		}
+	}
+}
+
+// priorityOf returns the priority of the first matched rule, or the
+// default priority.
+func (s *PrioritySpec) priorityOf(ctx context.HTTPContext) int {
+	header := ctx.Request().Header()
+	for _, rule := range s.Rules {
+		matched := true
+		for key, sm := range rule.Headers {
+			if !sm.Match(header.Get(key)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule.Priority
+		}
+	}
+
+	return s.Default
+}
+
+// acquireByPriority acquires a slot like acquire, but waiters of higher
+// priority get free slots first. If the queue is full, the waiter of the
+// lowest priority is evicted for a request of higher priority.
+func (b *Bulkhead) acquireByPriority(ctx context.HTTPContext) bool {
+	q := b.queue
+	priority := b.spec.Priority.priorityOf(ctx)
+
+	q.Lock()
+	if q.waiters.Len() == 0 {
+		select {
+		case b.slots <- struct{}{}:
+			q.Unlock()
+			return true
+		default:
+		}
+	}
+
+	if q.waiters.Len() >= b.spec.MaxQueue {
+		lowest := q.lowest()
+		if lowest == nil || lowest.priority >= priority {
+			q.Unlock()
+			return false
+		}
+		heap.Remove(&q.waiters, lowest.index)
+		close(lowest.ready)
+	}
+
+	q.seq++
+	w := &waiter{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiters, w)
+	atomic.StoreInt32(&b.waiting, int32(q.waiters.Len()))
+	q.Unlock()
+
+	var timeout <-chan time.Time
+	if b.maxWait > 0 {
+		timer := time.NewTimer(b.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-w.ready:
+	case <-timeout:
+	case <-ctx.Done():
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	if w.index >= 0 {
+		heap.Remove(&q.waiters, w.index)
+	}
+	atomic.StoreInt32(&b.waiting, int32(q.waiters.Len()))
+
+	// NOTE: The granted slot is released by the caller, even if the
+	// request is cancelled at the same time.
+	return w.granted
+}
+
+// dispatch gives free slots to the waiters in the order of priorities.
+func (b *Bulkhead) dispatch() {
+	b.queue.Lock()
+	defer b.queue.Unlock()
+	b.dispatchLocked()
+}
+
+func (b *Bulkhead) dispatchLocked() {
+	q := b.queue
+	defer func() {
+		atomic.StoreInt32(&b.waiting, int32(q.waiters.Len()))
+	}()
+
+	for q.waiters.Len() > 0 {
+		select {
+		case b.slots <- struct{}{}:
+		default:
+			return
+		}
+		w := heap.Pop(&q.waiters).(*waiter)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// lowest returns the waiter of the lowest priority, and the latest one
+// among the waiters of the same priority.
+func (q *priorityQueue) lowest() *waiter {
+	var lowest *waiter
+	for _, w := range q.waiters {
+		if lowest == nil || w.priority < lowest.priority ||
+			(w.priority == lowest.priority && w.seq > lowest.seq) {
+			lowest = w
+		}
+	}
+	return lowest
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bulkhead
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+func newPriorityContext(class string) context.HTTPContext {
+	r := httptest.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	r.Header.Set("X-Class", class)
+	return filtertest.NewContext(r)
+}
+
+func waitForWaiting(t *testing.T, b *Bulkhead, n int32) {
+	t.Helper()
+	for i := 0; i < 1000 && atomic.LoadInt32(&b.waiting) != n; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&b.waiting); got != n {
+		t.Fatalf("want %d waiting, got %d", n, got)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	b := &Bulkhead{spec: &Spec{
+		MaxConcurrency: 1,
+		MaxQueue:       2,
+		Priority: &PrioritySpec{
+			Rules: []*PriorityRule{{
+				Priority: 10,
+				Headers:  map[string]*urlrule.StringMatch{"X-Class": {Exact: "payment"}},
+			}},
+		},
+	}}
+	b.reload()
+
+	if !b.acquire(newPriorityContext("batch")) {
+		t.Fatalf("want the free slot acquired")
+	}
+
+	order := make(chan string, 3)
+	acquire := func(name, class string) {
+		if b.acquire(newPriorityContext(class)) {
+			order <- name
+		} else {
+			order <- name + " rejected"
+		}
+	}
+
+	go acquire("batch1", "batch")
+	waitForWaiting(t, b, 1)
+	go acquire("batch2", "batch")
+	waitForWaiting(t, b, 2)
+
+	// The queue is full, the latest waiter of the lowest priority is
+	// evicted for the payment.
+	go acquire("payment", "payment")
+	if got := <-order; got != "batch2 rejected" {
+		t.Fatalf("want batch2 rejected, got %s", got)
+	}
+	waitForWaiting(t, b, 2)
+
+	b.release()
+	if got := <-order; got != "payment" {
+		t.Errorf("want payment first, got %s", got)
+	}
+	b.release()
+	if got := <-order; got != "batch1" {
+		t.Errorf("want batch1, got %s", got)
+	}
+	b.release()
+}
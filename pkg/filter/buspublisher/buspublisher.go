@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package buspublisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/bus"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of BusPublisher.
+	Kind = "BusPublisher"
+
+	resultPublished = "published"
+	resultDropped   = "dropped"
+
+	defaultMaxBodySize = 4 * 1024 * 1024
+	defaultClusterTTL  = time.Minute
+)
+
+var results = []string{resultPublished, resultDropped}
+
+func init() {
+	httppipeline.Register(&BusPublisher{})
+}
+
+type (
+	// BusPublisher is the filter publishing requests to a topic of the
+	// message bus, they are handled asynchronously by the pipelines
+	// subscribing the topic.
+	BusPublisher struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		published uint64
+		relayed   uint64
+		dropped   uint64
+	}
+
+	// Spec describes the BusPublisher.
+	Spec struct {
+		Topic       string `yaml:"topic" jsonschema:"required,format=urlname"`
+		MaxBodySize int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		StatusCode  int    `yaml:"statusCode" jsonschema:"omitempty,format=httpcode"`
+		// Cluster relays messages to the subscribers on other members of
+		// the cluster through the cluster store, it's best-effort.
+		Cluster bool `yaml:"cluster" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of BusPublisher.
+	Status struct {
+		Subscribers int    `yaml:"subscribers"`
+		Published   uint64 `yaml:"published"`
+		Relayed     uint64 `yaml:"relayed,omitempty"`
+		Dropped     uint64 `yaml:"dropped"`
+	}
+)
+
+// Kind returns the kind of BusPublisher.
+func (bp *BusPublisher) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of BusPublisher.
+func (bp *BusPublisher) DefaultSpec() interface{} {
+	return &Spec{
+		MaxBodySize: defaultMaxBodySize,
+		StatusCode:  http.StatusAccepted,
+	}
+}
+
+// Description returns the description of BusPublisher.
+func (bp *BusPublisher) Description() string {
+	return "BusPublisher publishes requests to a topic of the message bus."
+}
+
+// Results returns the results of BusPublisher.
+func (bp *BusPublisher) Results() []string {
+	return results
+}
+
+// Init initializes BusPublisher.
+func (bp *BusPublisher) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	bp.pipeSpec, bp.spec, bp.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+}
+
+// Inherit inherits previous generation of BusPublisher.
+func (bp *BusPublisher) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	bp.Init(pipeSpec, super)
+}
+
+// Handle publishes the HTTPContext to the topic.
+func (bp *BusPublisher) Handle(ctx context.HTTPContext) string {
+	result := bp.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (bp *BusPublisher) handle(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	var body []byte
+	if r.Body() != nil {
+		buff := bytes.NewBuffer(nil)
+		n, err := io.CopyN(buff, r.Body(), bp.spec.MaxBodySize+1)
+		if err != nil && err != io.EOF {
+			atomic.AddUint64(&bp.dropped, 1)
+			w.SetStatusCode(http.StatusBadRequest)
+			ctx.AddTag("busPublisher: read body failed")
+			return resultDropped
+		}
+		if n > bp.spec.MaxBodySize {
+			atomic.AddUint64(&bp.dropped, 1)
+			w.SetStatusCode(http.StatusRequestEntityTooLarge)
+			ctx.AddTag("busPublisher: body too large")
+			return resultDropped
+		}
+		body = buff.Bytes()
+	}
+
+	msg := &bus.Message{
+		Topic:  bp.spec.Topic,
+		Time:   time.Now(),
+		Method: r.Method(),
+		URL:    r.Std().URL.String(),
+		Host:   r.Host(),
+		Header: r.Header().Copy().Std(),
+		Body:   body,
+	}
+
+	delivered := bus.Global.Publish(msg)
+	if bp.spec.Cluster {
+		go bp.relay(msg)
+	} else if delivered == 0 {
+		atomic.AddUint64(&bp.dropped, 1)
+		w.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag("busPublisher: no subscriber received the message")
+		return resultDropped
+	}
+
+	atomic.AddUint64(&bp.published, 1)
+	w.SetStatusCode(bp.spec.StatusCode)
+	return resultPublished
+}
+
+// relay puts the message to the cluster store with a TTL, the subscribers
+// on other members watch and deliver it.
+func (bp *BusPublisher) relay(msg *bus.Message) {
+	buff, err := json.Marshal(msg)
+	if err != nil {
+		logger.Errorf("%s: marshal message failed: %v", bp.pipeSpec.Name(), err)
+		return
+	}
+
+	cls := bp.super.Cluster()
+	key := cls.Layout().BusMessageKey(msg.Topic, msg.Time.UnixNano())
+	stored, err := cls.PutIfAbsent(key, string(buff), defaultClusterTTL)
+	if err != nil {
+		logger.Warnf("%s: relay message to cluster failed: %v", bp.pipeSpec.Name(), err)
+		return
+	}
+	if !stored {
+		logger.Warnf("%s: relay message to cluster failed: %s exists", bp.pipeSpec.Name(), key)
+		return
+	}
+	atomic.AddUint64(&bp.relayed, 1)
+}
+
+// Status returns status.
+func (bp *BusPublisher) Status() interface{} {
+	return &Status{
+		Subscribers: bus.Global.Subscribers(bp.spec.Topic),
+		Published:   atomic.LoadUint64(&bp.published),
+		Relayed:     atomic.LoadUint64(&bp.relayed),
+		Dropped:     atomic.LoadUint64(&bp.dropped),
+	}
+}
+
+// Close closes BusPublisher.
+func (bp *BusPublisher) Close() {}
@@ -88,6 +88,13 @@ type (
 	Status struct {
 		Health string `yaml:"health"`
 	}
+
+	// URLState is the state of the circuit breaker of a URL rule.
+	URLState struct {
+		URL            string `yaml:"url"`
+		Policy         string `yaml:"policy"`
+		libcb.Snapshot `yaml:",inline"`
+	}
 )
 
 // Validate implements custom validation for Spec
@@ -264,8 +271,9 @@ OuterLoop:
 
 			url.Init()
 			cb.bindPolicyToURL(url)
+			// NOTE: The cb is shared with the previous generation,
+			// which still serves its requests in flight until closed.
 			url.cb = prev.cb
-			prev.cb = nil
 			cb.setStateListenerForURL(url)
 			continue OuterLoop
 		}
@@ -340,6 +348,19 @@ func (cb *CircuitBreaker) Status() interface{} {
 	return nil
 }
 
+// State returns the states of the circuit breakers of all URL rules.
+func (cb *CircuitBreaker) State() interface{} {
+	states := make([]*URLState, 0, len(cb.spec.URLs))
+	for _, u := range cb.spec.URLs {
+		states = append(states, &URLState{
+			URL:      u.ID(),
+			Policy:   u.policy.Name,
+			Snapshot: *u.cb.Snapshot(),
+		})
+	}
+	return states
+}
+
 // Close closes CircuitBreaker.
 func (cb *CircuitBreaker) Close() {
 }
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package circuitbreaker
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "circuitbreaker-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "circuitbreaker-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func newSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"policies": []interface{}{map[string]interface{}{
+			"name":                 "fragile",
+			"slidingWindowSize":    1,
+			"minimumNumberOfCalls": 1,
+			"failureStatusCodes":   []interface{}{500},
+		}},
+		"defaultPolicyRef": "fragile",
+		"urls": []interface{}{map[string]interface{}{
+			"url": map[string]interface{}{"prefix": "/"},
+		}},
+	}
+}
+
+func TestReloadWithRequestInFlight(t *testing.T) {
+	prev := filtertest.NewFilter(t, &CircuitBreaker{}, newSpec()).(*CircuitBreaker)
+	cb := filtertest.InheritFilter(t, &CircuitBreaker{}, prev, newSpec()).(*CircuitBreaker)
+	t.Cleanup(cb.Close)
+
+	// The request dispatched to the previous generation before the switch
+	// still runs in it, and its failure opens the circuit of both.
+	ctx := filtertest.NewContext(filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", nil))
+	ctx.SetHandlerCaller(func(lastResult string) string {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		return lastResult
+	})
+	if result := prev.Handle(ctx); result != "" {
+		t.Errorf("want the request in flight handled, got %q", result)
+	}
+	prev.Close()
+
+	ctx = filtertest.NewContext(filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", nil))
+	if result := cb.Handle(ctx); result != resultShortCircuited {
+		t.Errorf("want %s by the inherited circuit breaker, got %q", resultShortCircuited, result)
+	}
+}
@@ -92,7 +92,6 @@ func (a *CORSAdaptor) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.
 func (a *CORSAdaptor) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	a.Init(pipeSpec, super)
 }
 
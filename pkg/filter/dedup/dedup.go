@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dedup
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of Dedup.
+	Kind = "Dedup"
+
+	resultDuplicate = "duplicate"
+
+	sourceHeader = "header"
+	sourceQuery  = "query"
+	sourceCookie = "cookie"
+	sourceRealIP = "realIP"
+	sourcePath   = "path"
+	sourceMethod = "method"
+
+	defaultHeader  = "Idempotency-Key"
+	defaultTTL     = 24 * time.Hour
+	defaultMaxKeys = 100000
+)
+
+var results = []string{resultDuplicate}
+
+func init() {
+	httppipeline.Register(&Dedup{})
+}
+
+type (
+	// Dedup is the filter dropping requests whose key was seen within
+	// a time window, for idempotent ingestion of webhooks.
+	Dedup struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		ttl time.Duration
+
+		// mutex makes the check and the record of a key atomic.
+		mutex sync.Mutex
+		seen  *lru.Cache
+
+		duplicated uint64
+		storeError uint64
+	}
+
+	// Spec describes the Dedup.
+	Spec struct {
+		Key        []*KeyPart   `yaml:"key" jsonschema:"omitempty"`
+		TTL        string       `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+		MaxKeys    int          `yaml:"maxKeys" jsonschema:"omitempty,minimum=1"`
+		StatusCode int          `yaml:"statusCode" jsonschema:"omitempty,format=httpcode"`
+		Cluster    *ClusterSpec `yaml:"cluster" jsonschema:"omitempty"`
+	}
+
+	// KeyPart is a part of the dedup key.
+	KeyPart struct {
+		Source string `yaml:"source" jsonschema:"required,enum=header,enum=query,enum=cookie,enum=realIP,enum=path,enum=method"`
+		Name   string `yaml:"name" jsonschema:"omitempty"`
+	}
+
+	// ClusterSpec describes how to share seen keys across members of
+	// the cluster.
+	ClusterSpec struct {
+		Name string `yaml:"name" jsonschema:"required,format=urlname"`
+	}
+
+	// Status is the status of Dedup.
+	Status struct {
+		Keys       int    `yaml:"keys"`
+		Duplicated uint64 `yaml:"duplicated"`
+		StoreError uint64 `yaml:"storeError,omitempty"`
+	}
+)
+
+// Validate validates KeyPart.
+func (kp KeyPart) Validate() error {
+	switch kp.Source {
+	case sourceHeader, sourceQuery, sourceCookie:
+		if kp.Name == "" {
+			return fmt.Errorf("name of source %s is empty", kp.Source)
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of Dedup.
+func (d *Dedup) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Dedup.
+func (d *Dedup) DefaultSpec() interface{} {
+	return &Spec{
+		MaxKeys:    defaultMaxKeys,
+		StatusCode: http.StatusOK,
+	}
+}
+
+// Description returns the description of Dedup.
+func (d *Dedup) Description() string {
+	return "Dedup drops requests whose key was seen within a time window."
+}
+
+// Results returns the results of Dedup.
+func (d *Dedup) Results() []string {
+	return results
+}
+
+// Produces returns nil, Dedup sets no header.
+func (d *Dedup) Produces(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	return nil
+}
+
+// Consumes returns the headers in the key of Dedup.
+func (d *Dedup) Consumes(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	key := pipeSpec.FilterSpec().(*Spec).Key
+	if len(key) == 0 {
+		return []*httppipeline.Value{{Header: defaultHeader, Type: httppipeline.ValueString}}
+	}
+
+	var values []*httppipeline.Value
+	for _, kp := range key {
+		if kp.Source == sourceHeader {
+			values = append(values, &httppipeline.Value{Header: kp.Name, Type: httppipeline.ValueString})
+		}
+	}
+	return values
+}
+
+// Init initializes Dedup.
+func (d *Dedup) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	d.pipeSpec, d.spec, d.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	d.reload(nil)
+}
+
+// Inherit inherits previous generation of Dedup.
+func (d *Dedup) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	d.pipeSpec, d.spec, d.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	d.reload(previousGeneration.(*Dedup))
+}
+
+func (d *Dedup) reload(previous *Dedup) {
+	if len(d.spec.Key) == 0 {
+		d.spec.Key = []*KeyPart{{Source: sourceHeader, Name: defaultHeader}}
+	}
+
+	d.ttl = defaultTTL
+	if d.spec.TTL != "" {
+		ttl, err := time.ParseDuration(d.spec.TTL)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", d.spec.TTL, err)
+		} else {
+			d.ttl = ttl
+		}
+	}
+
+	var err error
+	d.seen, err = lru.New(d.spec.MaxKeys)
+	if err != nil {
+		logger.Errorf("BUG: new lru cache failed: %v", err)
+	}
+
+	// NOTE: Keep the seen keys across updates of the pipeline, or the
+	// retried deliveries during the update are all passed.
+	if previous != nil {
+		previous.mutex.Lock()
+		for _, k := range previous.seen.Keys() {
+			if v, ok := previous.seen.Peek(k); ok {
+				d.seen.Add(k, v)
+			}
+		}
+		previous.mutex.Unlock()
+	}
+}
+
+// Handle drops the HTTPContext if its key is duplicated.
+func (d *Dedup) Handle(ctx context.HTTPContext) string {
+	result := d.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (d *Dedup) handle(ctx context.HTTPContext) string {
+	key, ok := d.key(ctx)
+	if !ok {
+		return ""
+	}
+
+	if !d.record(key) {
+		atomic.AddUint64(&d.duplicated, 1)
+		ctx.Response().SetStatusCode(d.spec.StatusCode)
+		ctx.AddTag(stringtool.Cat("dedup: key ", key, " is duplicated"))
+		return resultDuplicate
+	}
+
+	return ""
+}
+
+// key returns the key of the HTTPContext, it returns false if all parts
+// of the key are empty, the request can't be deduplicated then.
+func (d *Dedup) key(ctx context.HTTPContext) (string, bool) {
+	r := ctx.Request()
+
+	empty := true
+	parts := make([]string, 0, len(d.spec.Key))
+	for _, kp := range d.spec.Key {
+		var part string
+		switch kp.Source {
+		case sourceHeader:
+			part = r.Header().Get(kp.Name)
+		case sourceQuery:
+			part = r.Std().URL.Query().Get(kp.Name)
+		case sourceCookie:
+			if cookie, err := r.Cookie(kp.Name); err == nil {
+				part = cookie.Value
+			}
+		case sourceRealIP:
+			part = r.RealIP()
+		case sourcePath:
+			part = r.Path()
+		case sourceMethod:
+			part = r.Method()
+		}
+		if part != "" {
+			empty = false
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, ":"), !empty
+}
+
+// record records the key, it returns false if the key was seen within
+// the TTL.
+func (d *Dedup) record(key string) bool {
+	now := time.Now()
+
+	d.mutex.Lock()
+	if v, ok := d.seen.Get(key); ok && now.Before(v.(time.Time)) {
+		d.mutex.Unlock()
+		return false
+	}
+	d.seen.Add(key, now.Add(d.ttl))
+	d.mutex.Unlock()
+
+	if d.spec.Cluster == nil {
+		return true
+	}
+
+	// NOTE: The request is passed if the cluster store fails, a duplicated
+	// delivery is better than a lost one for idempotent consumers.
+	cls := d.super.Cluster()
+	stored, err := cls.PutIfAbsent(cls.Layout().DedupKey(d.spec.Cluster.Name, key), now.Format(time.RFC3339), d.ttl)
+	if err != nil {
+		atomic.AddUint64(&d.storeError, 1)
+		logger.Warnf("dedup %s: put key %s to cluster failed: %v", d.pipeSpec.Name(), key, err)
+		return true
+	}
+
+	return stored
+}
+
+// Status returns status.
+func (d *Dedup) Status() interface{} {
+	return &Status{
+		Keys:       d.seen.Len(),
+		Duplicated: atomic.LoadUint64(&d.duplicated),
+		StoreError: atomic.LoadUint64(&d.storeError),
+	}
+}
+
+// Close closes Dedup.
+func (d *Dedup) Close() {}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dedup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+)
+
+func handleTestRequest(d *Dedup, key string) (string, int) {
+	r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/webhook", nil)
+	if key != "" {
+		r.Header.Set(defaultHeader, key)
+	}
+	ctx := filtertest.NewContext(r)
+	return d.handle(ctx), ctx.Response().StatusCode()
+}
+
+func TestDedup(t *testing.T) {
+	d := &Dedup{spec: &Spec{TTL: "100ms", MaxKeys: 10, StatusCode: http.StatusOK}}
+	d.reload(nil)
+
+	if result, _ := handleTestRequest(d, "a"); result != "" {
+		t.Fatalf("want first request passed, got %s", result)
+	}
+	if result, code := handleTestRequest(d, "a"); result != resultDuplicate || code != http.StatusOK {
+		t.Fatalf("want duplicate with 200, got %s with %d", result, code)
+	}
+	if result, _ := handleTestRequest(d, "b"); result != "" {
+		t.Errorf("want another key passed, got %s", result)
+	}
+	for i := 0; i < 2; i++ {
+		if result, _ := handleTestRequest(d, ""); result != "" {
+			t.Errorf("want request without key passed, got %s", result)
+		}
+	}
+
+	next := &Dedup{spec: &Spec{TTL: "100ms", MaxKeys: 10, StatusCode: http.StatusOK}}
+	next.reload(d)
+	if result, _ := handleTestRequest(next, "a"); result != resultDuplicate {
+		t.Errorf("want seen keys inherited, got %s", result)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if result, _ := handleTestRequest(next, "a"); result != "" {
+		t.Errorf("want expired key passed, got %s", result)
+	}
+	if s := next.Status().(*Status); s.Keys != 2 || s.Duplicated != 1 {
+		t.Errorf("want 2 keys and 1 duplicated, got %+v", s)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package digest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/bodystream"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of Digest.
+	Kind = "Digest"
+
+	resultReadBodyFailed = "readBodyFailed"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	encodingHex    = "hex"
+	encodingBase64 = "base64"
+
+	algorithmMD5    = "md5"
+	algorithmSHA256 = "sha256"
+	algorithmXXHash = "xxhash"
+
+	defaultHeaderPrefix = "X-EG-Digest-"
+	defaultMaxBodySize  = 4 * 1024 * 1024
+)
+
+var (
+	results = []string{resultReadBodyFailed}
+
+	hashCreators = map[string]func() hash.Hash{
+		algorithmMD5:    md5.New,
+		algorithmSHA256: sha256.New,
+		algorithmXXHash: func() hash.Hash { return xxhash.New() },
+	}
+)
+
+func init() {
+	httppipeline.Register(&Digest{})
+}
+
+type (
+	// Digest is filter Digest.
+	Digest struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+	}
+
+	// Spec describes the Digest.
+	Spec struct {
+		Target       string   `yaml:"target" jsonschema:"omitempty,enum=request,enum=response"`
+		Algorithms   []string `yaml:"algorithms" jsonschema:"required,uniqueItems=true"`
+		Encoding     string   `yaml:"encoding" jsonschema:"omitempty,enum=hex,enum=base64"`
+		HeaderPrefix string   `yaml:"headerPrefix" jsonschema:"omitempty"`
+		Trailer      bool     `yaml:"trailer" jsonschema:"omitempty"`
+		// MaxBodySize is the max size of response bodies buffered to
+		// compute digests in headers.
+		MaxBodySize int64 `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if len(s.Algorithms) == 0 {
+		return fmt.Errorf("algorithms is empty")
+	}
+
+	for _, a := range s.Algorithms {
+		if _, exists := hashCreators[a]; !exists {
+			return fmt.Errorf("unsupported algorithm %s", a)
+		}
+	}
+
+	if s.Trailer && s.Target != targetResponse {
+		return fmt.Errorf("trailer is only supported by target response")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of Digest.
+func (d *Digest) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of Digest.
+func (d *Digest) DefaultSpec() interface{} {
+	return &Spec{
+		Target:       targetRequest,
+		Encoding:     encodingHex,
+		HeaderPrefix: defaultHeaderPrefix,
+		MaxBodySize:  defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of Digest.
+func (d *Digest) Description() string {
+	return "Digest computes digests of the body and stores them in headers."
+}
+
+// Results returns the results of Digest.
+func (d *Digest) Results() []string {
+	return results
+}
+
+// Init initializes Digest.
+func (d *Digest) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	d.pipeSpec, d.spec, d.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+}
+
+// Inherit inherits previous generation of Digest.
+func (d *Digest) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	d.Init(pipeSpec, super)
+}
+
+// Handle computes digests of the body.
+func (d *Digest) Handle(ctx context.HTTPContext) string {
+	if d.spec.Target == targetResponse {
+		result := ctx.CallNextHandler("")
+		if result != "" {
+			return result
+		}
+
+		w := ctx.Response()
+		if d.spec.Trailer {
+			d.digestTrailer(w)
+			return ""
+		}
+
+		if w.Body() == nil {
+			w.SetBody(bytes.NewReader(nil))
+		}
+		body, err := d.digest(w.Body(), w.Header())
+		if body != nil {
+			w.SetBody(body)
+		}
+		if err != nil {
+			ctx.AddTag(stringtool.Cat("digest: ", err.Error()))
+			return resultReadBodyFailed
+		}
+
+		return ""
+	}
+
+	return d.digestRequest(ctx)
+}
+
+// digestRequest computes the digests while the following filters, e.g.
+// the Proxy, read the request body, without buffering it, so they're
+// stored in the headers after the following filters return.
+func (d *Digest) digestRequest(ctx context.HTTPContext) string {
+	r := ctx.Request()
+	if r.Body() == nil {
+		r.SetBody(bytes.NewReader(nil))
+	}
+
+	// NOTE: The body could still be read by the transport after the
+	// following filters return, so the hashes are only read after EOF.
+	var digested int32
+	hashes := d.newHashes()
+	r.SetBody(bodystream.Chain(r.Body(),
+		bodystream.Tee(hashWriter(hashes)),
+		bodystream.OnEOF(func(err error) {
+			if err == nil {
+				atomic.StoreInt32(&digested, 1)
+			}
+		}),
+	))
+
+	result := ctx.CallNextHandler("")
+	if atomic.LoadInt32(&digested) == 0 {
+		ctx.AddTag("digest: request body is not read completely")
+		return result
+	}
+	d.setDigests(r.Header(), "", hashes)
+
+	return result
+}
+
+// digest reads the body through all hashes in a single pass, so the
+// body is consumed and buffered only once no matter how many algorithms
+// are configured, the returned reader replays the body. The body is
+// kept untouched if it exceeds maxBodySize.
+func (d *Digest) digest(body io.Reader, header *httpheader.HTTPHeader) (io.Reader, error) {
+	maxBodySize := d.spec.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+
+	buff := bytes.NewBuffer(nil)
+	hashes := d.newHashes()
+	written, err := io.CopyN(io.MultiWriter(buff, hashWriter(hashes)), body, maxBodySize+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+	if written > maxBodySize {
+		return io.MultiReader(buff, body), fmt.Errorf("body exceed %dB", maxBodySize)
+	}
+
+	d.setDigests(header, "", hashes)
+
+	return buff, nil
+}
+
+// digestTrailer computes the digests while the response body is being
+// sent to the client, without buffering it, and sends them in trailers.
+func (d *Digest) digestTrailer(w context.HTTPReponse) {
+	if w.Body() == nil {
+		w.SetBody(bytes.NewReader(nil))
+	}
+
+	// NOTE: Trailers must be declared before the header is written,
+	// and they can't be sent with Content-Length in HTTP/1.1.
+	w.Header().Del(httpheader.KeyContentLength)
+	for _, a := range d.spec.Algorithms {
+		w.Header().Add("Trailer", d.spec.HeaderPrefix+a)
+	}
+
+	hashes := d.newHashes()
+	w.SetBody(bodystream.Chain(w.Body(),
+		bodystream.Tee(hashWriter(hashes)),
+		bodystream.OnEOF(func(err error) {
+			if err == nil {
+				d.setDigests(w.Header(), http.TrailerPrefix, hashes)
+			}
+		}),
+	))
+}
+
+func (d *Digest) newHashes() []hash.Hash {
+	hashes := make([]hash.Hash, len(d.spec.Algorithms))
+	for i, a := range d.spec.Algorithms {
+		hashes[i] = hashCreators[a]()
+	}
+	return hashes
+}
+
+func hashWriter(hashes []hash.Hash) io.Writer {
+	writers := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		writers[i] = h
+	}
+	return io.MultiWriter(writers...)
+}
+
+func (d *Digest) setDigests(header *httpheader.HTTPHeader, prefix string, hashes []hash.Hash) {
+	for i, a := range d.spec.Algorithms {
+		sum := hashes[i].Sum(nil)
+
+		var value string
+		if d.spec.Encoding == encodingBase64 {
+			value = base64.StdEncoding.EncodeToString(sum)
+		} else {
+			value = hex.EncodeToString(sum)
+		}
+
+		header.Set(prefix+d.spec.HeaderPrefix+a, value)
+	}
+}
+
+// Status returns status.
+func (d *Digest) Status() interface{} { return nil }
+
+// Close closes Digest.
+func (d *Digest) Close() {}
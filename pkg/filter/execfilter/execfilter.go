@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package execfilter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of ExecFilter.
+	Kind = "ExecFilter"
+
+	resultFailed = "failed"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	framingLine   = "line"
+	framingLength = "length"
+
+	defaultPoolSize    = 4
+	defaultTimeout     = "1s"
+	defaultMaxBodySize = 4 * 1024 * 1024
+)
+
+var (
+	results = []string{resultFailed}
+)
+
+func init() {
+	httppipeline.Register(&ExecFilter{})
+}
+
+type (
+	// ExecFilter is the filter transforming bodies by long-lived child processes.
+	ExecFilter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		pool    *processPool
+	}
+
+	// Spec describes the ExecFilter.
+	Spec struct {
+		Command     string   `yaml:"command" jsonschema:"required"`
+		Args        []string `yaml:"args" jsonschema:"omitempty"`
+		Env         []string `yaml:"env" jsonschema:"omitempty"`
+		Dir         string   `yaml:"dir" jsonschema:"omitempty"`
+		Target      string   `yaml:"target" jsonschema:"omitempty,enum=request,enum=response"`
+		Framing     string   `yaml:"framing" jsonschema:"omitempty,enum=line,enum=length"`
+		PoolSize    int      `yaml:"poolSize" jsonschema:"omitempty,minimum=1"`
+		Timeout     string   `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxBodySize int64    `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of ExecFilter.
+	Status struct {
+		Running  int32  `yaml:"running"`
+		Restarts uint64 `yaml:"restarts"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.Command == "" {
+		return fmt.Errorf("command is empty")
+	}
+	return nil
+}
+
+// Kind returns the kind of ExecFilter.
+func (ef *ExecFilter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of ExecFilter.
+func (ef *ExecFilter) DefaultSpec() interface{} {
+	return &Spec{
+		Target:      targetRequest,
+		Framing:     framingLine,
+		PoolSize:    defaultPoolSize,
+		Timeout:     defaultTimeout,
+		MaxBodySize: defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of ExecFilter.
+func (ef *ExecFilter) Description() string {
+	return "ExecFilter transforms bodies by piping them to long-lived child processes."
+}
+
+// Results returns the results of ExecFilter.
+func (ef *ExecFilter) Results() []string {
+	return results
+}
+
+// Init initializes ExecFilter.
+func (ef *ExecFilter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	ef.pipeSpec, ef.spec, ef.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	ef.reload()
+}
+
+// Inherit inherits previous generation of ExecFilter.
+func (ef *ExecFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	ef.Init(pipeSpec, super)
+}
+
+func (ef *ExecFilter) reload() {
+	var err error
+	if ef.spec.Timeout != "" {
+		ef.timeout, err = time.ParseDuration(ef.spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", ef.spec.Timeout, err)
+		}
+	}
+
+	ef.pool = newProcessPool(ef.pipeSpec.Name(), ef.spec)
+}
+
+// Handle handles HTTPContext by piping the body to a child process.
+func (ef *ExecFilter) Handle(ctx context.HTTPContext) string {
+	if ef.spec.Target == targetResponse {
+		result := ctx.CallNextHandler("")
+		if result != "" {
+			return result
+		}
+
+		w := ctx.Response()
+		if w.Body() == nil {
+			w.SetBody(bytes.NewReader(nil))
+		}
+		body, err := ef.transform(w.Body())
+		if err != nil {
+			w.SetStatusCode(http.StatusServiceUnavailable)
+			ctx.AddTag(stringtool.Cat("execFilter: ", err.Error()))
+			return resultFailed
+		}
+		w.Header().Del("Content-Length")
+		w.SetBody(bytes.NewReader(body))
+
+		return ""
+	}
+
+	r := ctx.Request()
+	body, err := ef.transform(r.Body())
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag(stringtool.Cat("execFilter: ", err.Error()))
+		return ctx.CallNextHandler(resultFailed)
+	}
+	r.SetBody(bytes.NewReader(body))
+
+	return ctx.CallNextHandler("")
+}
+
+func (ef *ExecFilter) transform(body io.Reader) ([]byte, error) {
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, body, ef.spec.MaxBodySize+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+	if written > ef.spec.MaxBodySize {
+		return nil, fmt.Errorf("body exceed %dB", ef.spec.MaxBodySize)
+	}
+
+	return ef.pool.exchange(buff.Bytes(), ef.timeout)
+}
+
+// Status returns status.
+func (ef *ExecFilter) Status() interface{} {
+	return &Status{
+		Running:  atomic.LoadInt32(&ef.pool.running),
+		Restarts: atomic.LoadUint64(&ef.pool.restarts),
+	}
+}
+
+// Close closes ExecFilter.
+func (ef *ExecFilter) Close() {
+	ef.pool.close()
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package execfilter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// processPool holds at most poolSize child processes, every process
+	// serves one exchange at a time. Processes are started on demand and
+	// restarted on the next use after they crash or time out.
+	processPool struct {
+		name string
+		spec *Spec
+
+		slots    chan *process
+		closed   int32
+		running  int32
+		restarts uint64
+	}
+
+	process struct {
+		cmd    *exec.Cmd
+		stdin  io.WriteCloser
+		stdout *bufio.Reader
+		done   chan struct{}
+	}
+)
+
+func newProcessPool(name string, spec *Spec) *processPool {
+	pp := &processPool{
+		name:  name,
+		spec:  spec,
+		slots: make(chan *process, spec.PoolSize),
+	}
+
+	for i := 0; i < spec.PoolSize; i++ {
+		pp.slots <- nil
+	}
+
+	return pp
+}
+
+func (pp *processPool) start() (*process, error) {
+	cmd := exec.Command(pp.spec.Command, pp.spec.Args...)
+	cmd.Dir = pp.spec.Dir
+	cmd.Env = append(os.Environ(), pp.spec.Env...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: Stderr is read by ourselves instead of assigning a writer to
+	// cmd.Stderr, otherwise Wait blocks until all descendants exit.
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start %s failed: %v", pp.spec.Command, err)
+	}
+
+	p := &process{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.Warnf("%s: stderr of child process %d: %s", pp.name, cmd.Process.Pid, scanner.Text())
+		}
+	}()
+
+	atomic.AddInt32(&pp.running, 1)
+	go func() {
+		err := cmd.Wait()
+		atomic.AddInt32(&pp.running, -1)
+		if err != nil && atomic.LoadInt32(&pp.closed) == 0 {
+			logger.Warnf("%s: child process %d exited: %v", pp.name, cmd.Process.Pid, err)
+		}
+		close(p.done)
+	}()
+
+	return p, nil
+}
+
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *process) kill() {
+	p.cmd.Process.Kill()
+	<-p.done
+}
+
+// exchange sends data to a child process and waits for its output.
+func (pp *processPool) exchange(data []byte, timeout time.Duration) ([]byte, error) {
+	if atomic.LoadInt32(&pp.closed) != 0 {
+		return nil, fmt.Errorf("filter closed")
+	}
+
+	if pp.spec.Framing != framingLength && bytes.IndexByte(data, '\n') != -1 {
+		return nil, fmt.Errorf("body contains newline which is not allowed by line framing")
+	}
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	var p *process
+	select {
+	case p = <-pp.slots:
+	case <-timeoutChan:
+		return nil, fmt.Errorf("timeout waiting for an idle child process")
+	}
+
+	if p == nil || p.exited() {
+		if p != nil {
+			atomic.AddUint64(&pp.restarts, 1)
+		}
+
+		var err error
+		p, err = pp.start()
+		if err != nil {
+			pp.slots <- nil
+			return nil, err
+		}
+	}
+
+	type exchangeResult struct {
+		output []byte
+		err    error
+	}
+	resultChan := make(chan *exchangeResult, 1)
+	go func() {
+		output, err := pp.roundTrip(p, data)
+		resultChan <- &exchangeResult{output: output, err: err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			// NOTE: The stream may be out of sync, so kill it.
+			p.kill()
+			pp.slots <- nil
+			return nil, result.err
+		}
+		pp.slots <- p
+		return result.output, nil
+	case <-timeoutChan:
+		p.kill()
+		<-resultChan
+		pp.slots <- nil
+		return nil, fmt.Errorf("timeout waiting for output of child process")
+	}
+}
+
+func (pp *processPool) roundTrip(p *process, data []byte) ([]byte, error) {
+	if pp.spec.Framing == framingLength {
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(data)))
+		_, err := p.stdin.Write(append(header, data...))
+		if err != nil {
+			return nil, fmt.Errorf("write to child process failed: %v", err)
+		}
+
+		_, err = io.ReadFull(p.stdout, header)
+		if err != nil {
+			return nil, fmt.Errorf("read from child process failed: %v", err)
+		}
+		size := binary.BigEndian.Uint32(header)
+		if int64(size) > pp.spec.MaxBodySize {
+			return nil, fmt.Errorf("output of child process exceed %dB", pp.spec.MaxBodySize)
+		}
+
+		output := make([]byte, size)
+		_, err = io.ReadFull(p.stdout, output)
+		if err != nil {
+			return nil, fmt.Errorf("read from child process failed: %v", err)
+		}
+		return output, nil
+	}
+
+	_, err := p.stdin.Write(append(data, '\n'))
+	if err != nil {
+		return nil, fmt.Errorf("write to child process failed: %v", err)
+	}
+
+	var output []byte
+	for {
+		line, err := p.stdout.ReadSlice('\n')
+		output = append(output, line...)
+		if int64(len(output)) > pp.spec.MaxBodySize+1 {
+			return nil, fmt.Errorf("output of child process exceed %dB", pp.spec.MaxBodySize)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read from child process failed: %v", err)
+		}
+		return output[:len(output)-1], nil
+	}
+}
+
+func (pp *processPool) close() {
+	atomic.StoreInt32(&pp.closed, 1)
+
+	for i := 0; i < pp.spec.PoolSize; i++ {
+		if p := <-pp.slots; p != nil && !p.exited() {
+			p.kill()
+		}
+	}
+}
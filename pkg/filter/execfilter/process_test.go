@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package execfilter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const tempDir = "/tmp/eg-test"
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(tempDir, "global-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "execfilter-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		spec   *Spec
+		input  string
+		output string
+		err    string
+	}{
+		{
+			spec:   &Spec{Command: "cat", Framing: framingLine},
+			input:  "hello",
+			output: "hello",
+		},
+		{
+			spec:  &Spec{Command: "cat", Framing: framingLine},
+			input: "hello\nworld",
+			err:   "newline",
+		},
+		{
+			spec:   &Spec{Command: "cat", Framing: framingLength},
+			input:  "hello\nworld",
+			output: "hello\nworld",
+		},
+		{
+			spec:   &Spec{Command: "sh", Args: []string{"-c", `while read l; do echo "$l" | tr a-z A-Z; done`}, Framing: framingLine},
+			input:  "hello",
+			output: "HELLO",
+		},
+		{
+			spec:  &Spec{Command: "sh", Args: []string{"-c", "sleep 10"}, Framing: framingLine},
+			input: "hello",
+			err:   "timeout",
+		},
+		{
+			spec:  &Spec{Command: "sh", Args: []string{"-c", "exit 1"}, Framing: framingLine},
+			input: "hello",
+			err:   "child process",
+		},
+	}
+
+	for i, test := range tests {
+		test.spec.PoolSize, test.spec.MaxBodySize = 1, defaultMaxBodySize
+		pp := newProcessPool("test", test.spec)
+
+		// NOTE: Run twice to cover reusing and restarting processes.
+		for j := 0; j < 2; j++ {
+			output, err := pp.exchange([]byte(test.input), 200*time.Millisecond)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("case %d: want error containing %q, got %v", i, test.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("case %d: unexpected error: %v", i, err)
+				continue
+			}
+			if string(output) != test.output {
+				t.Errorf("case %d: want output %q, got %q", i, test.output, output)
+			}
+		}
+
+		pp.close()
+	}
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extproc
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/extproc/pb"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of ExtProc.
+	Kind = "ExtProc"
+
+	resultFailed          = "failed"
+	resultResponseAlready = "responseAlready"
+
+	defaultTimeout             = "200ms"
+	defaultMaxBodySize         = 4 * 1024 * 1024
+	defaultHealthCheckInterval = "5s"
+	defaultHealthCheckTimeout  = "1s"
+)
+
+var (
+	results = []string{resultFailed, resultResponseAlready}
+)
+
+func init() {
+	httppipeline.Register(&ExtProc{})
+}
+
+type (
+	// ExtProc is the filter delegating processing to external processors over gRPC.
+	ExtProc struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		conn    *grpc.ClientConn
+		client  pb.ExternalProcessorClient
+
+		// unhealthy is 1 if the latest health check failed.
+		unhealthy int32
+		done      chan struct{}
+	}
+
+	// Spec describes the ExtProc.
+	Spec struct {
+		Address         string           `yaml:"address" jsonschema:"required"`
+		Timeout         string           `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		RequestBody     bool             `yaml:"requestBody" jsonschema:"omitempty"`
+		ResponseHeaders bool             `yaml:"responseHeaders" jsonschema:"omitempty"`
+		ResponseBody    bool             `yaml:"responseBody" jsonschema:"omitempty"`
+		FailOpen        bool             `yaml:"failOpen" jsonschema:"omitempty"`
+		MaxBodySize     int64            `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		HealthCheck     *HealthCheckSpec `yaml:"healthCheck" jsonschema:"omitempty"`
+	}
+
+	// HealthCheckSpec describes the health check of the external processor,
+	// it uses the standard gRPC health checking protocol.
+	HealthCheckSpec struct {
+		Service  string `yaml:"service" jsonschema:"omitempty"`
+		Interval string `yaml:"interval" jsonschema:"omitempty,format=duration"`
+		Timeout  string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of ExtProc.
+	Status struct {
+		Healthy bool `yaml:"healthy"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.Address == "" {
+		return fmt.Errorf("address is empty")
+	}
+	return nil
+}
+
+// Kind returns the kind of ExtProc.
+func (ep *ExtProc) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of ExtProc.
+func (ep *ExtProc) DefaultSpec() interface{} {
+	return &Spec{
+		Timeout:     defaultTimeout,
+		MaxBodySize: defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of ExtProc.
+func (ep *ExtProc) Description() string {
+	return "ExtProc delegates processing of requests and responses to external processors over gRPC."
+}
+
+// Results returns the results of ExtProc.
+func (ep *ExtProc) Results() []string {
+	return results
+}
+
+// Init initializes ExtProc.
+func (ep *ExtProc) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	ep.pipeSpec, ep.spec, ep.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	ep.reload()
+}
+
+// Inherit inherits previous generation of ExtProc.
+func (ep *ExtProc) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	ep.Init(pipeSpec, super)
+}
+
+func parseDuration(s string, dflt time.Duration) time.Duration {
+	if s == "" {
+		return dflt
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", s, err)
+		return dflt
+	}
+
+	return d
+}
+
+func (ep *ExtProc) reload() {
+	ep.timeout = parseDuration(ep.spec.Timeout, 0)
+	ep.done = make(chan struct{})
+
+	// NOTE: Dial is non-blocking, the connection is established in background.
+	conn, err := grpc.Dial(ep.spec.Address, grpc.WithInsecure())
+	if err != nil {
+		logger.Errorf("%s: dial %s failed: %v", ep.pipeSpec.Name(), ep.spec.Address, err)
+		return
+	}
+	ep.conn, ep.client = conn, pb.NewExternalProcessorClient(conn)
+
+	if ep.spec.HealthCheck != nil {
+		go ep.checkHealth()
+	}
+}
+
+func (ep *ExtProc) checkHealth() {
+	hc := ep.spec.HealthCheck
+	interval := parseDuration(hc.Interval, parseDuration(defaultHealthCheckInterval, 0))
+	timeout := parseDuration(hc.Timeout, parseDuration(defaultHealthCheckTimeout, 0))
+	client := healthpb.NewHealthClient(ep.conn)
+
+	check := func() {
+		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), timeout)
+		defer cancel()
+
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: hc.Service})
+		if err == nil && resp.Status != healthpb.HealthCheckResponse_SERVING {
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+
+		if err != nil {
+			if atomic.SwapInt32(&ep.unhealthy, 1) == 0 {
+				logger.Warnf("%s: external processor %s becomes unhealthy: %v",
+					ep.pipeSpec.Name(), ep.spec.Address, err)
+			}
+			return
+		}
+
+		if atomic.SwapInt32(&ep.unhealthy, 0) == 1 {
+			logger.Infof("%s: external processor %s becomes healthy", ep.pipeSpec.Name(), ep.spec.Address)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	check()
+	for {
+		select {
+		case <-ep.done:
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// Handle handles HTTPContext by the external processor.
+func (ep *ExtProc) Handle(ctx context.HTTPContext) string {
+	if ep.client == nil {
+		return ctx.CallNextHandler(ep.fail(ctx, fmt.Errorf("not connected")))
+	}
+	if atomic.LoadInt32(&ep.unhealthy) == 1 {
+		return ctx.CallNextHandler(ep.fail(ctx, fmt.Errorf("external processor is unhealthy")))
+	}
+
+	s, err := newSession(ep, ctx)
+	if err != nil {
+		return ctx.CallNextHandler(ep.fail(ctx, err))
+	}
+	defer s.close()
+
+	result, err := s.processRequest()
+	if err != nil {
+		return ctx.CallNextHandler(ep.fail(ctx, err))
+	}
+	if result != "" {
+		return ctx.CallNextHandler(result)
+	}
+
+	result = ctx.CallNextHandler("")
+	if result != "" || (!ep.spec.ResponseHeaders && !ep.spec.ResponseBody) {
+		return result
+	}
+
+	err = s.processResponse()
+	if err != nil {
+		return ep.fail(ctx, err)
+	}
+
+	return ""
+}
+
+// fail returns the result of failures according to the fail policy.
+func (ep *ExtProc) fail(ctx context.HTTPContext, err error) string {
+	ctx.AddTag(stringtool.Cat("extProc: ", err.Error()))
+	if ep.spec.FailOpen {
+		return ""
+	}
+
+	ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+	return resultFailed
+}
+
+// Status returns status.
+func (ep *ExtProc) Status() interface{} {
+	return &Status{Healthy: atomic.LoadInt32(&ep.unhealthy) == 0}
+}
+
+// Close closes ExtProc.
+func (ep *ExtProc) Close() {
+	close(ep.done)
+	if ep.conn != nil {
+		ep.conn.Close()
+	}
+}
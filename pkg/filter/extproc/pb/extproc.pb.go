@@ -0,0 +1,1208 @@
+//
+// Copyright (c) 2017, MegaEase
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0-devel
+// 	protoc        (unknown)
+// source: extproc.proto
+
+package pb
+
+import (
+	context "context"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+type ProcessingRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Request:
+	//	*ProcessingRequest_RequestHeaders
+	//	*ProcessingRequest_RequestBody
+	//	*ProcessingRequest_ResponseHeaders
+	//	*ProcessingRequest_ResponseBody
+	Request isProcessingRequest_Request `protobuf_oneof:"request"`
+}
+
+func (x *ProcessingRequest) Reset() {
+	*x = ProcessingRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProcessingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessingRequest) ProtoMessage() {}
+
+func (x *ProcessingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessingRequest.ProtoReflect.Descriptor instead.
+func (*ProcessingRequest) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{0}
+}
+
+func (m *ProcessingRequest) GetRequest() isProcessingRequest_Request {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (x *ProcessingRequest) GetRequestHeaders() *RequestHeaders {
+	if x, ok := x.GetRequest().(*ProcessingRequest_RequestHeaders); ok {
+		return x.RequestHeaders
+	}
+	return nil
+}
+
+func (x *ProcessingRequest) GetRequestBody() *HttpBody {
+	if x, ok := x.GetRequest().(*ProcessingRequest_RequestBody); ok {
+		return x.RequestBody
+	}
+	return nil
+}
+
+func (x *ProcessingRequest) GetResponseHeaders() *ResponseHeaders {
+	if x, ok := x.GetRequest().(*ProcessingRequest_ResponseHeaders); ok {
+		return x.ResponseHeaders
+	}
+	return nil
+}
+
+func (x *ProcessingRequest) GetResponseBody() *HttpBody {
+	if x, ok := x.GetRequest().(*ProcessingRequest_ResponseBody); ok {
+		return x.ResponseBody
+	}
+	return nil
+}
+
+type isProcessingRequest_Request interface {
+	isProcessingRequest_Request()
+}
+
+type ProcessingRequest_RequestHeaders struct {
+	RequestHeaders *RequestHeaders `protobuf:"bytes,1,opt,name=request_headers,json=requestHeaders,proto3,oneof"`
+}
+
+type ProcessingRequest_RequestBody struct {
+	RequestBody *HttpBody `protobuf:"bytes,2,opt,name=request_body,json=requestBody,proto3,oneof"`
+}
+
+type ProcessingRequest_ResponseHeaders struct {
+	ResponseHeaders *ResponseHeaders `protobuf:"bytes,3,opt,name=response_headers,json=responseHeaders,proto3,oneof"`
+}
+
+type ProcessingRequest_ResponseBody struct {
+	ResponseBody *HttpBody `protobuf:"bytes,4,opt,name=response_body,json=responseBody,proto3,oneof"`
+}
+
+func (*ProcessingRequest_RequestHeaders) isProcessingRequest_Request() {}
+
+func (*ProcessingRequest_RequestBody) isProcessingRequest_Request() {}
+
+func (*ProcessingRequest_ResponseHeaders) isProcessingRequest_Request() {}
+
+func (*ProcessingRequest_ResponseBody) isProcessingRequest_Request() {}
+
+type ProcessingResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Response:
+	//	*ProcessingResponse_RequestHeaders
+	//	*ProcessingResponse_RequestBody
+	//	*ProcessingResponse_ResponseHeaders
+	//	*ProcessingResponse_ResponseBody
+	//	*ProcessingResponse_ImmediateResponse
+	Response isProcessingResponse_Response `protobuf_oneof:"response"`
+}
+
+func (x *ProcessingResponse) Reset() {
+	*x = ProcessingResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProcessingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessingResponse) ProtoMessage() {}
+
+func (x *ProcessingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessingResponse.ProtoReflect.Descriptor instead.
+func (*ProcessingResponse) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{1}
+}
+
+func (m *ProcessingResponse) GetResponse() isProcessingResponse_Response {
+	if m != nil {
+		return m.Response
+	}
+	return nil
+}
+
+func (x *ProcessingResponse) GetRequestHeaders() *HeadersResponse {
+	if x, ok := x.GetResponse().(*ProcessingResponse_RequestHeaders); ok {
+		return x.RequestHeaders
+	}
+	return nil
+}
+
+func (x *ProcessingResponse) GetRequestBody() *BodyResponse {
+	if x, ok := x.GetResponse().(*ProcessingResponse_RequestBody); ok {
+		return x.RequestBody
+	}
+	return nil
+}
+
+func (x *ProcessingResponse) GetResponseHeaders() *HeadersResponse {
+	if x, ok := x.GetResponse().(*ProcessingResponse_ResponseHeaders); ok {
+		return x.ResponseHeaders
+	}
+	return nil
+}
+
+func (x *ProcessingResponse) GetResponseBody() *BodyResponse {
+	if x, ok := x.GetResponse().(*ProcessingResponse_ResponseBody); ok {
+		return x.ResponseBody
+	}
+	return nil
+}
+
+func (x *ProcessingResponse) GetImmediateResponse() *ImmediateResponse {
+	if x, ok := x.GetResponse().(*ProcessingResponse_ImmediateResponse); ok {
+		return x.ImmediateResponse
+	}
+	return nil
+}
+
+type isProcessingResponse_Response interface {
+	isProcessingResponse_Response()
+}
+
+type ProcessingResponse_RequestHeaders struct {
+	RequestHeaders *HeadersResponse `protobuf:"bytes,1,opt,name=request_headers,json=requestHeaders,proto3,oneof"`
+}
+
+type ProcessingResponse_RequestBody struct {
+	RequestBody *BodyResponse `protobuf:"bytes,2,opt,name=request_body,json=requestBody,proto3,oneof"`
+}
+
+type ProcessingResponse_ResponseHeaders struct {
+	ResponseHeaders *HeadersResponse `protobuf:"bytes,3,opt,name=response_headers,json=responseHeaders,proto3,oneof"`
+}
+
+type ProcessingResponse_ResponseBody struct {
+	ResponseBody *BodyResponse `protobuf:"bytes,4,opt,name=response_body,json=responseBody,proto3,oneof"`
+}
+
+type ProcessingResponse_ImmediateResponse struct {
+	// ImmediateResponse stops processing and sends the response to the
+	// client directly, it's valid only in request phases.
+	ImmediateResponse *ImmediateResponse `protobuf:"bytes,5,opt,name=immediate_response,json=immediateResponse,proto3,oneof"`
+}
+
+func (*ProcessingResponse_RequestHeaders) isProcessingResponse_Response() {}
+
+func (*ProcessingResponse_RequestBody) isProcessingResponse_Response() {}
+
+func (*ProcessingResponse_ResponseHeaders) isProcessingResponse_Response() {}
+
+func (*ProcessingResponse_ResponseBody) isProcessingResponse_Response() {}
+
+func (*ProcessingResponse_ImmediateResponse) isProcessingResponse_Response() {}
+
+type HeaderValue struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Key   string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (x *HeaderValue) Reset() {
+	*x = HeaderValue{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HeaderValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeaderValue) ProtoMessage() {}
+
+func (x *HeaderValue) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeaderValue.ProtoReflect.Descriptor instead.
+func (*HeaderValue) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *HeaderValue) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *HeaderValue) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type RequestHeaders struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Method  string         `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	Path    string         `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	Query   string         `protobuf:"bytes,3,opt,name=query,proto3" json:"query,omitempty"`
+	RealIp  string         `protobuf:"bytes,4,opt,name=real_ip,json=realIp,proto3" json:"real_ip,omitempty"`
+	Headers []*HeaderValue `protobuf:"bytes,5,rep,name=headers,proto3" json:"headers,omitempty"`
+}
+
+func (x *RequestHeaders) Reset() {
+	*x = RequestHeaders{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RequestHeaders) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestHeaders) ProtoMessage() {}
+
+func (x *RequestHeaders) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestHeaders.ProtoReflect.Descriptor instead.
+func (*RequestHeaders) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RequestHeaders) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *RequestHeaders) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *RequestHeaders) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *RequestHeaders) GetRealIp() string {
+	if x != nil {
+		return x.RealIp
+	}
+	return ""
+}
+
+func (x *RequestHeaders) GetHeaders() []*HeaderValue {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+type ResponseHeaders struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StatusCode int32          `protobuf:"varint,1,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Headers    []*HeaderValue `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty"`
+}
+
+func (x *ResponseHeaders) Reset() {
+	*x = ResponseHeaders{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ResponseHeaders) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResponseHeaders) ProtoMessage() {}
+
+func (x *ResponseHeaders) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResponseHeaders.ProtoReflect.Descriptor instead.
+func (*ResponseHeaders) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ResponseHeaders) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *ResponseHeaders) GetHeaders() []*HeaderValue {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+type HttpBody struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Body []byte `protobuf:"bytes,1,opt,name=body,proto3" json:"body,omitempty"`
+}
+
+func (x *HttpBody) Reset() {
+	*x = HttpBody{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HttpBody) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HttpBody) ProtoMessage() {}
+
+func (x *HttpBody) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HttpBody.ProtoReflect.Descriptor instead.
+func (*HttpBody) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *HttpBody) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+type HeaderMutation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SetHeaders    []*HeaderValue `protobuf:"bytes,1,rep,name=set_headers,json=setHeaders,proto3" json:"set_headers,omitempty"`
+	RemoveHeaders []string       `protobuf:"bytes,2,rep,name=remove_headers,json=removeHeaders,proto3" json:"remove_headers,omitempty"`
+}
+
+func (x *HeaderMutation) Reset() {
+	*x = HeaderMutation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HeaderMutation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeaderMutation) ProtoMessage() {}
+
+func (x *HeaderMutation) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeaderMutation.ProtoReflect.Descriptor instead.
+func (*HeaderMutation) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *HeaderMutation) GetSetHeaders() []*HeaderValue {
+	if x != nil {
+		return x.SetHeaders
+	}
+	return nil
+}
+
+func (x *HeaderMutation) GetRemoveHeaders() []string {
+	if x != nil {
+		return x.RemoveHeaders
+	}
+	return nil
+}
+
+type HeadersResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	HeaderMutation *HeaderMutation `protobuf:"bytes,1,opt,name=header_mutation,json=headerMutation,proto3" json:"header_mutation,omitempty"`
+	// path rewrites the path of the request, empty means unchanged.
+	Path string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	// status_code overrides the status code of the response, 0 means unchanged.
+	StatusCode int32 `protobuf:"varint,3,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+}
+
+func (x *HeadersResponse) Reset() {
+	*x = HeadersResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HeadersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeadersResponse) ProtoMessage() {}
+
+func (x *HeadersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeadersResponse.ProtoReflect.Descriptor instead.
+func (*HeadersResponse) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *HeadersResponse) GetHeaderMutation() *HeaderMutation {
+	if x != nil {
+		return x.HeaderMutation
+	}
+	return nil
+}
+
+func (x *HeadersResponse) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *HeadersResponse) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+type BodyResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	HeaderMutation *HeaderMutation `protobuf:"bytes,1,opt,name=header_mutation,json=headerMutation,proto3" json:"header_mutation,omitempty"`
+	ReplaceBody    bool            `protobuf:"varint,2,opt,name=replace_body,json=replaceBody,proto3" json:"replace_body,omitempty"`
+	Body           []byte          `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+}
+
+func (x *BodyResponse) Reset() {
+	*x = BodyResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BodyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BodyResponse) ProtoMessage() {}
+
+func (x *BodyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BodyResponse.ProtoReflect.Descriptor instead.
+func (*BodyResponse) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BodyResponse) GetHeaderMutation() *HeaderMutation {
+	if x != nil {
+		return x.HeaderMutation
+	}
+	return nil
+}
+
+func (x *BodyResponse) GetReplaceBody() bool {
+	if x != nil {
+		return x.ReplaceBody
+	}
+	return false
+}
+
+func (x *BodyResponse) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+type ImmediateResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StatusCode int32          `protobuf:"varint,1,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Headers    []*HeaderValue `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty"`
+	Body       []byte         `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+}
+
+func (x *ImmediateResponse) Reset() {
+	*x = ImmediateResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_extproc_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ImmediateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImmediateResponse) ProtoMessage() {}
+
+func (x *ImmediateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_extproc_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImmediateResponse.ProtoReflect.Descriptor instead.
+func (*ImmediateResponse) Descriptor() ([]byte, []int) {
+	return file_extproc_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ImmediateResponse) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *ImmediateResponse) GetHeaders() []*HeaderValue {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *ImmediateResponse) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+var File_extproc_proto protoreflect.FileDescriptor
+
+var file_extproc_proto_rawDesc = []byte{
+	0x0a, 0x0d, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
+	0x14, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72,
+	0x6f, 0x63, 0x2e, 0x76, 0x31, 0x22, 0xcf, 0x02, 0x0a, 0x11, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73,
+	0x73, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x4f, 0x0a, 0x0f, 0x72,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73,
+	0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x48, 0x00, 0x52, 0x0e, 0x72, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x43, 0x0a, 0x0c,
+	0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e, 0x65,
+	0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x74, 0x74, 0x70, 0x42, 0x6f,
+	0x64, 0x79, 0x48, 0x00, 0x52, 0x0b, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x42, 0x6f, 0x64,
+	0x79, 0x12, 0x52, 0x0a, 0x10, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x68, 0x65,
+	0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x25, 0x2e, 0x65, 0x61,
+	0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e,
+	0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65,
+	0x72, 0x73, 0x48, 0x00, 0x52, 0x0f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65,
+	0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x45, 0x0a, 0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x65,
+	0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63,
+	0x2e, 0x76, 0x31, 0x2e, 0x48, 0x74, 0x74, 0x70, 0x42, 0x6f, 0x64, 0x79, 0x48, 0x00, 0x52, 0x0c,
+	0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x42, 0x09, 0x0a, 0x07,
+	0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xb4, 0x03, 0x0a, 0x12, 0x50, 0x72, 0x6f, 0x63,
+	0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x50,
+	0x0a, 0x0f, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72,
+	0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x25, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72,
+	0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x48,
+	0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00,
+	0x52, 0x0e, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73,
+	0x12, 0x47, 0x0a, 0x0c, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x62, 0x6f, 0x64, 0x79,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65,
+	0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x6f,
+	0x64, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0b, 0x72, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x42, 0x6f, 0x64, 0x79, 0x12, 0x52, 0x0a, 0x10, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x25, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e,
+	0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x65, 0x61, 0x64, 0x65,
+	0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0f, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x49, 0x0a,
+	0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x22, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73,
+	0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x6f, 0x64, 0x79,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x12, 0x58, 0x0a, 0x12, 0x69, 0x6d, 0x6d, 0x65,
+	0x64, 0x69, 0x61, 0x74, 0x65, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73,
+	0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x6d, 0x6d, 0x65,
+	0x64, 0x69, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52,
+	0x11, 0x69, 0x6d, 0x6d, 0x65, 0x64, 0x69, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x42, 0x0a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x35,
+	0x0a, 0x0b, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x10, 0x0a,
+	0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
+	0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0xa8, 0x01, 0x0a, 0x0e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x65, 0x74, 0x68,
+	0x6f, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64,
+	0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x70, 0x61, 0x74, 0x68, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x12, 0x17, 0x0a, 0x07, 0x72, 0x65,
+	0x61, 0x6c, 0x5f, 0x69, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61,
+	0x6c, 0x49, 0x70, 0x12, 0x3b, 0x0a, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x05,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73,
+	0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x65, 0x61, 0x64,
+	0x65, 0x72, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73,
+	0x22, 0x6f, 0x0a, 0x0f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64,
+	0x65, 0x72, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x5f, 0x63, 0x6f,
+	0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x43, 0x6f, 0x64, 0x65, 0x12, 0x3b, 0x0a, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18,
+	0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73,
+	0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x65, 0x61,
+	0x64, 0x65, 0x72, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72,
+	0x73, 0x22, 0x1e, 0x0a, 0x08, 0x48, 0x74, 0x74, 0x70, 0x42, 0x6f, 0x64, 0x79, 0x12, 0x12, 0x0a,
+	0x04, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x62, 0x6f, 0x64,
+	0x79, 0x22, 0x7b, 0x0a, 0x0e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x75, 0x74, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x42, 0x0a, 0x0b, 0x73, 0x65, 0x74, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65,
+	0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67,
+	0x72, 0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e,
+	0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x0a, 0x73, 0x65, 0x74,
+	0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x72, 0x65, 0x6d, 0x6f, 0x76,
+	0x65, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x0d, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x22, 0x95,
+	0x01, 0x0a, 0x0f, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x4d, 0x0a, 0x0f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x5f, 0x6d, 0x75, 0x74,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x65, 0x61,
+	0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e,
+	0x76, 0x31, 0x2e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x52, 0x0e, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x5f,
+	0x63, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x73, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x43, 0x6f, 0x64, 0x65, 0x22, 0x94, 0x01, 0x0a, 0x0c, 0x42, 0x6f, 0x64, 0x79, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x4d, 0x0a, 0x0f, 0x68, 0x65, 0x61, 0x64, 0x65,
+	0x72, 0x5f, 0x6d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x24, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74,
+	0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x75,
+	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0e, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x4d, 0x75,
+	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x63,
+	0x65, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x72, 0x65,
+	0x70, 0x6c, 0x61, 0x63, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x6f, 0x64,
+	0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x22, 0x85, 0x01,
+	0x0a, 0x11, 0x49, 0x6d, 0x6d, 0x65, 0x64, 0x69, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x5f, 0x63, 0x6f,
+	0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x43, 0x6f, 0x64, 0x65, 0x12, 0x3b, 0x0a, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18,
+	0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73,
+	0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x48, 0x65, 0x61,
+	0x64, 0x65, 0x72, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72,
+	0x73, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x04, 0x62, 0x6f, 0x64, 0x79, 0x32, 0x75, 0x0a, 0x11, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61,
+	0x6c, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x6f, 0x72, 0x12, 0x60, 0x0a, 0x07, 0x50, 0x72,
+	0x6f, 0x63, 0x65, 0x73, 0x73, 0x12, 0x27, 0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73,
+	0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f,
+	0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x28,
+	0x2e, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2e, 0x65, 0x78, 0x74, 0x70, 0x72,
+	0x6f, 0x63, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6e, 0x67,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01, 0x42, 0x35, 0x5a, 0x33,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6d, 0x65, 0x67, 0x61, 0x65,
+	0x61, 0x73, 0x65, 0x2f, 0x65, 0x61, 0x73, 0x65, 0x67, 0x72, 0x65, 0x73, 0x73, 0x2f, 0x70, 0x6b,
+	0x67, 0x2f, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x2f, 0x65, 0x78, 0x74, 0x70, 0x72, 0x6f, 0x63,
+	0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_extproc_proto_rawDescOnce sync.Once
+	file_extproc_proto_rawDescData = file_extproc_proto_rawDesc
+)
+
+func file_extproc_proto_rawDescGZIP() []byte {
+	file_extproc_proto_rawDescOnce.Do(func() {
+		file_extproc_proto_rawDescData = protoimpl.X.CompressGZIP(file_extproc_proto_rawDescData)
+	})
+	return file_extproc_proto_rawDescData
+}
+
+var file_extproc_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_extproc_proto_goTypes = []interface{}{
+	(*ProcessingRequest)(nil),  // 0: easegress.extproc.v1.ProcessingRequest
+	(*ProcessingResponse)(nil), // 1: easegress.extproc.v1.ProcessingResponse
+	(*HeaderValue)(nil),        // 2: easegress.extproc.v1.HeaderValue
+	(*RequestHeaders)(nil),     // 3: easegress.extproc.v1.RequestHeaders
+	(*ResponseHeaders)(nil),    // 4: easegress.extproc.v1.ResponseHeaders
+	(*HttpBody)(nil),           // 5: easegress.extproc.v1.HttpBody
+	(*HeaderMutation)(nil),     // 6: easegress.extproc.v1.HeaderMutation
+	(*HeadersResponse)(nil),    // 7: easegress.extproc.v1.HeadersResponse
+	(*BodyResponse)(nil),       // 8: easegress.extproc.v1.BodyResponse
+	(*ImmediateResponse)(nil),  // 9: easegress.extproc.v1.ImmediateResponse
+}
+var file_extproc_proto_depIdxs = []int32{
+	3,  // 0: easegress.extproc.v1.ProcessingRequest.request_headers:type_name -> easegress.extproc.v1.RequestHeaders
+	5,  // 1: easegress.extproc.v1.ProcessingRequest.request_body:type_name -> easegress.extproc.v1.HttpBody
+	4,  // 2: easegress.extproc.v1.ProcessingRequest.response_headers:type_name -> easegress.extproc.v1.ResponseHeaders
+	5,  // 3: easegress.extproc.v1.ProcessingRequest.response_body:type_name -> easegress.extproc.v1.HttpBody
+	7,  // 4: easegress.extproc.v1.ProcessingResponse.request_headers:type_name -> easegress.extproc.v1.HeadersResponse
+	8,  // 5: easegress.extproc.v1.ProcessingResponse.request_body:type_name -> easegress.extproc.v1.BodyResponse
+	7,  // 6: easegress.extproc.v1.ProcessingResponse.response_headers:type_name -> easegress.extproc.v1.HeadersResponse
+	8,  // 7: easegress.extproc.v1.ProcessingResponse.response_body:type_name -> easegress.extproc.v1.BodyResponse
+	9,  // 8: easegress.extproc.v1.ProcessingResponse.immediate_response:type_name -> easegress.extproc.v1.ImmediateResponse
+	2,  // 9: easegress.extproc.v1.RequestHeaders.headers:type_name -> easegress.extproc.v1.HeaderValue
+	2,  // 10: easegress.extproc.v1.ResponseHeaders.headers:type_name -> easegress.extproc.v1.HeaderValue
+	2,  // 11: easegress.extproc.v1.HeaderMutation.set_headers:type_name -> easegress.extproc.v1.HeaderValue
+	6,  // 12: easegress.extproc.v1.HeadersResponse.header_mutation:type_name -> easegress.extproc.v1.HeaderMutation
+	6,  // 13: easegress.extproc.v1.BodyResponse.header_mutation:type_name -> easegress.extproc.v1.HeaderMutation
+	2,  // 14: easegress.extproc.v1.ImmediateResponse.headers:type_name -> easegress.extproc.v1.HeaderValue
+	0,  // 15: easegress.extproc.v1.ExternalProcessor.Process:input_type -> easegress.extproc.v1.ProcessingRequest
+	1,  // 16: easegress.extproc.v1.ExternalProcessor.Process:output_type -> easegress.extproc.v1.ProcessingResponse
+	16, // [16:17] is the sub-list for method output_type
+	15, // [15:16] is the sub-list for method input_type
+	15, // [15:15] is the sub-list for extension type_name
+	15, // [15:15] is the sub-list for extension extendee
+	0,  // [0:15] is the sub-list for field type_name
+}
+
+func init() { file_extproc_proto_init() }
+func file_extproc_proto_init() {
+	if File_extproc_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_extproc_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProcessingRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProcessingResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HeaderValue); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RequestHeaders); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ResponseHeaders); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HttpBody); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HeaderMutation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HeadersResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BodyResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_extproc_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ImmediateResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_extproc_proto_msgTypes[0].OneofWrappers = []interface{}{
+		(*ProcessingRequest_RequestHeaders)(nil),
+		(*ProcessingRequest_RequestBody)(nil),
+		(*ProcessingRequest_ResponseHeaders)(nil),
+		(*ProcessingRequest_ResponseBody)(nil),
+	}
+	file_extproc_proto_msgTypes[1].OneofWrappers = []interface{}{
+		(*ProcessingResponse_RequestHeaders)(nil),
+		(*ProcessingResponse_RequestBody)(nil),
+		(*ProcessingResponse_ResponseHeaders)(nil),
+		(*ProcessingResponse_ResponseBody)(nil),
+		(*ProcessingResponse_ImmediateResponse)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_extproc_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_extproc_proto_goTypes,
+		DependencyIndexes: file_extproc_proto_depIdxs,
+		MessageInfos:      file_extproc_proto_msgTypes,
+	}.Build()
+	File_extproc_proto = out.File
+	file_extproc_proto_rawDesc = nil
+	file_extproc_proto_goTypes = nil
+	file_extproc_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// ExternalProcessorClient is the client API for ExternalProcessor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ExternalProcessorClient interface {
+	Process(ctx context.Context, opts ...grpc.CallOption) (ExternalProcessor_ProcessClient, error)
+}
+
+type externalProcessorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExternalProcessorClient(cc grpc.ClientConnInterface) ExternalProcessorClient {
+	return &externalProcessorClient{cc}
+}
+
+func (c *externalProcessorClient) Process(ctx context.Context, opts ...grpc.CallOption) (ExternalProcessor_ProcessClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ExternalProcessor_serviceDesc.Streams[0], "/easegress.extproc.v1.ExternalProcessor/Process", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &externalProcessorProcessClient{stream}
+	return x, nil
+}
+
+type ExternalProcessor_ProcessClient interface {
+	Send(*ProcessingRequest) error
+	Recv() (*ProcessingResponse, error)
+	grpc.ClientStream
+}
+
+type externalProcessorProcessClient struct {
+	grpc.ClientStream
+}
+
+func (x *externalProcessorProcessClient) Send(m *ProcessingRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *externalProcessorProcessClient) Recv() (*ProcessingResponse, error) {
+	m := new(ProcessingResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ExternalProcessorServer is the server API for ExternalProcessor service.
+type ExternalProcessorServer interface {
+	Process(ExternalProcessor_ProcessServer) error
+}
+
+// UnimplementedExternalProcessorServer can be embedded to have forward compatible implementations.
+type UnimplementedExternalProcessorServer struct {
+}
+
+func (*UnimplementedExternalProcessorServer) Process(ExternalProcessor_ProcessServer) error {
+	return status.Errorf(codes.Unimplemented, "method Process not implemented")
+}
+
+func RegisterExternalProcessorServer(s *grpc.Server, srv ExternalProcessorServer) {
+	s.RegisterService(&_ExternalProcessor_serviceDesc, srv)
+}
+
+func _ExternalProcessor_Process_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ExternalProcessorServer).Process(&externalProcessorProcessServer{stream})
+}
+
+type ExternalProcessor_ProcessServer interface {
+	Send(*ProcessingResponse) error
+	Recv() (*ProcessingRequest, error)
+	grpc.ServerStream
+}
+
+type externalProcessorProcessServer struct {
+	grpc.ServerStream
+}
+
+func (x *externalProcessorProcessServer) Send(m *ProcessingResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *externalProcessorProcessServer) Recv() (*ProcessingRequest, error) {
+	m := new(ProcessingRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _ExternalProcessor_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "easegress.extproc.v1.ExternalProcessor",
+	HandlerType: (*ExternalProcessorServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Process",
+			Handler:       _ExternalProcessor_Process_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "extproc.proto",
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extproc
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/extproc/pb"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+// session is the processing of one HTTP request, which uses one stream.
+type session struct {
+	ep     *ExtProc
+	ctx    context.HTTPContext
+	stream pb.ExternalProcessor_ProcessClient
+	cancel stdcontext.CancelFunc
+}
+
+func newSession(ep *ExtProc, ctx context.HTTPContext) (*session, error) {
+	streamCtx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	stream, err := ep.client.Process(streamCtx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("open stream failed: %v", err)
+	}
+
+	return &session{
+		ep:     ep,
+		ctx:    ctx,
+		stream: stream,
+		cancel: cancel,
+	}, nil
+}
+
+func (s *session) close() {
+	s.stream.CloseSend()
+	s.cancel()
+}
+
+// exchange sends one message and waits for its response, the stream
+// is canceled if the response doesn't arrive in time.
+func (s *session) exchange(req *pb.ProcessingRequest) (*pb.ProcessingResponse, error) {
+	if s.ep.timeout > 0 {
+		timer := time.AfterFunc(s.ep.timeout, s.cancel)
+		defer timer.Stop()
+	}
+
+	err := s.stream.Send(req)
+	if err != nil {
+		return nil, fmt.Errorf("send failed: %v", err)
+	}
+
+	resp, err := s.stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("receive failed: %v", err)
+	}
+
+	return resp, nil
+}
+
+func (s *session) readBody(body io.Reader) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, body, s.ep.spec.MaxBodySize+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+	if written > s.ep.spec.MaxBodySize {
+		return nil, fmt.Errorf("body exceed %dB", s.ep.spec.MaxBodySize)
+	}
+
+	return buff.Bytes(), nil
+}
+
+func (s *session) processRequest() (string, error) {
+	r := s.ctx.Request()
+
+	resp, err := s.exchange(&pb.ProcessingRequest{
+		Request: &pb.ProcessingRequest_RequestHeaders{
+			RequestHeaders: &pb.RequestHeaders{
+				Method:  r.Method(),
+				Path:    r.Path(),
+				Query:   r.Query(),
+				RealIp:  r.RealIP(),
+				Headers: headerValues(r.Header()),
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch v := resp.Response.(type) {
+	case *pb.ProcessingResponse_ImmediateResponse:
+		s.applyImmediateResponse(v.ImmediateResponse)
+		return resultResponseAlready, nil
+	case *pb.ProcessingResponse_RequestHeaders:
+		applyHeaderMutation(r.Header(), v.RequestHeaders.HeaderMutation)
+		if v.RequestHeaders.Path != "" {
+			r.SetPath(v.RequestHeaders.Path)
+		}
+	default:
+		return "", fmt.Errorf("unexpected response %T to request headers", resp.Response)
+	}
+
+	if !s.ep.spec.RequestBody {
+		return "", nil
+	}
+
+	body, err := s.readBody(r.Body())
+	if err != nil {
+		return "", err
+	}
+	r.SetBody(bytes.NewReader(body))
+
+	resp, err = s.exchange(&pb.ProcessingRequest{
+		Request: &pb.ProcessingRequest_RequestBody{
+			RequestBody: &pb.HttpBody{Body: body},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch v := resp.Response.(type) {
+	case *pb.ProcessingResponse_ImmediateResponse:
+		s.applyImmediateResponse(v.ImmediateResponse)
+		return resultResponseAlready, nil
+	case *pb.ProcessingResponse_RequestBody:
+		applyHeaderMutation(r.Header(), v.RequestBody.HeaderMutation)
+		if v.RequestBody.ReplaceBody {
+			r.SetBody(bytes.NewReader(v.RequestBody.Body))
+		}
+	default:
+		return "", fmt.Errorf("unexpected response %T to request body", resp.Response)
+	}
+
+	return "", nil
+}
+
+func (s *session) processResponse() error {
+	w := s.ctx.Response()
+
+	if s.ep.spec.ResponseHeaders {
+		resp, err := s.exchange(&pb.ProcessingRequest{
+			Request: &pb.ProcessingRequest_ResponseHeaders{
+				ResponseHeaders: &pb.ResponseHeaders{
+					StatusCode: int32(w.StatusCode()),
+					Headers:    headerValues(w.Header()),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		v, ok := resp.Response.(*pb.ProcessingResponse_ResponseHeaders)
+		if !ok {
+			return fmt.Errorf("unexpected response %T to response headers", resp.Response)
+		}
+		applyHeaderMutation(w.Header(), v.ResponseHeaders.HeaderMutation)
+		if v.ResponseHeaders.StatusCode != 0 {
+			w.SetStatusCode(int(v.ResponseHeaders.StatusCode))
+		}
+	}
+
+	if !s.ep.spec.ResponseBody {
+		return nil
+	}
+
+	body, err := s.readBody(w.Body())
+	if err != nil {
+		return err
+	}
+	w.SetBody(bytes.NewReader(body))
+
+	resp, err := s.exchange(&pb.ProcessingRequest{
+		Request: &pb.ProcessingRequest_ResponseBody{
+			ResponseBody: &pb.HttpBody{Body: body},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	v, ok := resp.Response.(*pb.ProcessingResponse_ResponseBody)
+	if !ok {
+		return fmt.Errorf("unexpected response %T to response body", resp.Response)
+	}
+	applyHeaderMutation(w.Header(), v.ResponseBody.HeaderMutation)
+	if v.ResponseBody.ReplaceBody {
+		w.Header().Del("Content-Length")
+		w.SetBody(bytes.NewReader(v.ResponseBody.Body))
+	}
+
+	return nil
+}
+
+func (s *session) applyImmediateResponse(ir *pb.ImmediateResponse) {
+	w := s.ctx.Response()
+	if ir.StatusCode != 0 {
+		w.SetStatusCode(int(ir.StatusCode))
+	}
+	for _, hv := range ir.Headers {
+		w.Header().Add(hv.Key, hv.Value)
+	}
+	w.SetBody(bytes.NewReader(ir.Body))
+}
+
+func headerValues(h *httpheader.HTTPHeader) []*pb.HeaderValue {
+	var values []*pb.HeaderValue
+	for key, vs := range h.Std() {
+		for _, v := range vs {
+			values = append(values, &pb.HeaderValue{Key: key, Value: v})
+		}
+	}
+	return values
+}
+
+func applyHeaderMutation(h *httpheader.HTTPHeader, m *pb.HeaderMutation) {
+	if m == nil {
+		return
+	}
+
+	for _, key := range m.RemoveHeaders {
+		h.Del(key)
+	}
+	for _, hv := range m.SetHeaders {
+		h.Set(hv.Key, hv.Value)
+	}
+}
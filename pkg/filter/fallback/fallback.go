@@ -18,6 +18,8 @@
 package fallback
 
 import (
+	"fmt"
+
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -46,15 +48,37 @@ type (
 		pipeSpec *httppipeline.FilterSpec
 		spec     *Spec
 
-		f *fallback.Fallback
+		f           *fallback.Fallback
+		results     map[string]struct{}
+		statusCodes map[int]struct{}
+		lastGood    *lastGoodCache
 	}
 
 	// Spec describes the Fallback.
 	Spec struct {
 		fallback.Spec `yaml:",inline"`
+
+		OnResults     []string      `yaml:"onResults" jsonschema:"omitempty,uniqueItems=true"`
+		OnStatusCodes []int         `yaml:"onStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		LastGood      *LastGoodSpec `yaml:"lastGood" jsonschema:"omitempty"`
 	}
 )
 
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.LastGood != nil && !s.wrapping() {
+		return fmt.Errorf("lastGood requires onResults or onStatusCodes")
+	}
+
+	return nil
+}
+
+// wrapping returns true if Fallback wraps the filters after it,
+// instead of being jumped to by results of other filters.
+func (s *Spec) wrapping() bool {
+	return len(s.OnResults) != 0 || len(s.OnStatusCodes) != 0
+}
+
 // Kind returns the kind of Fallback.
 func (f *Fallback) Kind() string {
 	return Kind
@@ -85,19 +109,60 @@ func (f *Fallback) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Sup
 func (f *Fallback) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	f.Init(pipeSpec, super)
 }
 
 func (f *Fallback) reload() {
 	f.f = fallback.New(&f.spec.Spec)
+
+	f.results = map[string]struct{}{}
+	for _, result := range f.spec.OnResults {
+		f.results[result] = struct{}{}
+	}
+
+	f.statusCodes = map[int]struct{}{}
+	for _, code := range f.spec.OnStatusCodes {
+		f.statusCodes[code] = struct{}{}
+	}
+
+	f.lastGood = nil
+	if f.spec.LastGood != nil {
+		f.lastGood = newLastGoodCache(f.spec.LastGood)
+	}
 }
 
 // Handle fallabcks HTTPContext.
-// It always returns fallback.
+// It always returns fallback if it is not wrapping the filters after it.
 func (f *Fallback) Handle(ctx context.HTTPContext) string {
+	if !f.spec.wrapping() {
+		f.f.Fallback(ctx)
+		return ctx.CallNextHandler(resultFallback)
+	}
+
+	result := ctx.CallNextHandler("")
+	if !f.failed(ctx, result) {
+		if f.lastGood != nil {
+			f.lastGood.store(ctx)
+		}
+		return result
+	}
+
+	if f.lastGood != nil && f.lastGood.load(ctx) {
+		ctx.AddTag("fallback: last good response")
+		return resultFallback
+	}
+
 	f.f.Fallback(ctx)
-	return ctx.CallNextHandler(resultFallback)
+	return resultFallback
+}
+
+func (f *Fallback) failed(ctx context.HTTPContext, result string) bool {
+	if _, exists := f.results[result]; exists && result != "" {
+		return true
+	}
+
+	_, exists := f.statusCodes[ctx.Response().StatusCode()]
+	return exists
 }
 
 // Status returns Status.
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fallback
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	defaultLastGoodTTL         = 5 * time.Minute
+	defaultLastGoodMaxEntries  = 1000
+	defaultLastGoodMaxBodySize = 1024 * 1024
+)
+
+type (
+	// LastGoodSpec describes the cache of last good responses.
+	LastGoodSpec struct {
+		TTL         string `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+		MaxEntries  int    `yaml:"maxEntries" jsonschema:"omitempty,minimum=1"`
+		MaxBodySize int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// lastGoodCache caches last good responses of GET requests by URL.
+	lastGoodCache struct {
+		spec  *LastGoodSpec
+		ttl   time.Duration
+		cache *lru.Cache
+	}
+
+	cachedResponse struct {
+		statusCode int
+		header     *httpheader.HTTPHeader
+		body       []byte
+		expireAt   time.Time
+	}
+)
+
+func newLastGoodCache(spec *LastGoodSpec) *lastGoodCache {
+	if spec.MaxEntries == 0 {
+		spec.MaxEntries = defaultLastGoodMaxEntries
+	}
+	if spec.MaxBodySize == 0 {
+		spec.MaxBodySize = defaultLastGoodMaxBodySize
+	}
+
+	c := &lastGoodCache{spec: spec, ttl: defaultLastGoodTTL}
+	if spec.TTL != "" {
+		ttl, err := time.ParseDuration(spec.TTL)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", spec.TTL, err)
+		} else {
+			c.ttl = ttl
+		}
+	}
+
+	var err error
+	c.cache, err = lru.New(spec.MaxEntries)
+	if err != nil {
+		logger.Errorf("BUG: new lru cache failed: %v", err)
+	}
+
+	return c
+}
+
+func (c *lastGoodCache) key(ctx context.HTTPContext) (string, bool) {
+	r := ctx.Request()
+	if r.Method() != http.MethodGet {
+		return "", false
+	}
+	return r.Host() + r.Path() + "?" + r.Query(), true
+}
+
+// store caches the response if it is successful.
+func (c *lastGoodCache) store(ctx context.HTTPContext) {
+	key, ok := c.key(ctx)
+	if !ok {
+		return
+	}
+
+	w := ctx.Response()
+	if w.StatusCode() < 200 || w.StatusCode() >= 300 {
+		return
+	}
+
+	body := w.Body()
+	if body == nil {
+		body = bytes.NewReader(nil)
+	}
+
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, body, c.spec.MaxBodySize+1)
+	if (err != nil && err != io.EOF) || written > c.spec.MaxBodySize {
+		// NOTE: Don't cache the response, but keep the body intact.
+		w.SetBody(io.MultiReader(buff, body))
+		return
+	}
+	w.SetBody(bytes.NewReader(buff.Bytes()))
+
+	c.cache.Add(key, &cachedResponse{
+		statusCode: w.StatusCode(),
+		header:     w.Header().Copy(),
+		body:       buff.Bytes(),
+		expireAt:   time.Now().Add(c.ttl),
+	})
+}
+
+// load sets the cached response to the response, it returns false if
+// there's no unexpired cached response.
+func (c *lastGoodCache) load(ctx context.HTTPContext) bool {
+	key, ok := c.key(ctx)
+	if !ok {
+		return false
+	}
+
+	v, ok := c.cache.Get(key)
+	if !ok {
+		return false
+	}
+
+	cr := v.(*cachedResponse)
+	if time.Now().After(cr.expireAt) {
+		c.cache.Remove(key)
+		return false
+	}
+
+	w := ctx.Response()
+	w.SetStatusCode(cr.statusCode)
+	w.Header().Reset(cr.header.Copy().Std())
+	w.Header().Set(httpheader.KeyContentLength, strconv.Itoa(len(cr.body)))
+	w.SetBody(bytes.NewReader(cr.body))
+
+	return true
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package filtertest provides utilities for testing filters.
+package filtertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+// NewFilter initializes the filter by the spec without the supervisor,
+// as the pipeline does, and returns it. The test fails at once if the
+// spec is invalid.
+func NewFilter(t *testing.T, filter httppipeline.Filter, spec map[string]interface{}) httppipeline.Filter {
+	t.Helper()
+
+	filterSpec, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+		Name: strings.ToLower(filter.Kind()),
+		Kind: filter.Kind(),
+	}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	filter.Init(filterSpec, nil)
+	return filter
+}
+
+// InheritFilter initializes the filter by the spec inheriting the previous
+// generation, as the pipeline does on reload, and returns it.
+func InheritFilter(t *testing.T, filter, previousGeneration httppipeline.Filter, spec map[string]interface{}) httppipeline.Filter {
+	t.Helper()
+
+	filterSpec, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+		Name: strings.ToLower(filter.Kind()),
+		Kind: filter.Kind(),
+	}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	filter.Inherit(filterSpec, previousGeneration, nil)
+	return filter
+}
+
+// NewRequest creates a request with the body and headers.
+func NewRequest(method, url, body string, headers map[string]string) *http.Request {
+	r, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	return r
+}
+
+// NewContext creates an HTTPContext of the request, whose next handler
+// returns the result of the filter, so Handle of filters returns it.
+func NewContext(r *http.Request) context.HTTPContext {
+	ctx := context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")
+	ctx.SetHandlerCaller(func(lastResult string) string { return lastResult })
+	return ctx
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geoip
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// reloadDelay is the delay to reload a database after it is changed, as
+// databases are usually written in several writes.
+const reloadDelay = time.Second
+
+type (
+	// record is the union of fields used in GeoIP2/GeoLite2 Country, City
+	// and ASN databases.
+	record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+		AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+	}
+
+	lookuper interface {
+		lookup(ip net.IP) (*record, error)
+		status() *DatabaseStatus
+		close()
+	}
+
+	// database is a MaxMind database, it is reloaded when the file changes.
+	database struct {
+		path string
+
+		mutex    sync.RWMutex
+		reader   *maxminddb.Reader
+		loadedAt time.Time
+		err      error
+
+		watcher *fsnotify.Watcher
+		timer   *time.Timer
+		done    chan struct{}
+	}
+
+	// DatabaseStatus is the status of a database.
+	DatabaseStatus struct {
+		Path      string `yaml:"path"`
+		Type      string `yaml:"type,omitempty"`
+		BuildTime string `yaml:"buildTime,omitempty"`
+		LoadedAt  string `yaml:"loadedAt,omitempty"`
+		Error     string `yaml:"error,omitempty"`
+	}
+)
+
+func newDatabase(path string) *database {
+	db := &database{
+		path: filepath.Clean(path),
+		done: make(chan struct{}),
+	}
+	db.load()
+	db.watch()
+	return db
+}
+
+// load loads the database, the previous one is kept if it fails.
+func (db *database) load() {
+	// NOTE: The file is read into memory instead of mmap, so the previous
+	// reader can be dropped safely while lookups are in progress.
+	buff, err := ioutil.ReadFile(db.path)
+	var reader *maxminddb.Reader
+	if err == nil {
+		reader, err = maxminddb.FromBytes(buff)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err != nil {
+		logger.Errorf("load geoip database %s failed: %v", db.path, err)
+		db.err = err
+		return
+	}
+	db.reader, db.loadedAt, db.err = reader, time.Now(), nil
+}
+
+func (db *database) watch() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("create watcher failed: %v", err)
+		return
+	}
+	// NOTE: Watch the directory, because databases are usually updated
+	// by renaming, which stops watching the file itself.
+	err = watcher.Add(filepath.Dir(db.path))
+	if err != nil {
+		logger.Errorf("watch %s failed: %v", db.path, err)
+		watcher.Close()
+		return
+	}
+	db.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case <-db.done:
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Errorf("watch %s failed: %v", db.path, err)
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == db.path && event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+					db.delayLoad()
+				}
+			}
+		}
+	}()
+}
+
+func (db *database) delayLoad() {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.timer != nil {
+		db.timer.Reset(reloadDelay)
+		return
+	}
+	db.timer = time.AfterFunc(reloadDelay, func() {
+		db.mutex.Lock()
+		db.timer = nil
+		db.mutex.Unlock()
+		db.load()
+	})
+}
+
+func (db *database) lookup(ip net.IP) (*record, error) {
+	db.mutex.RLock()
+	reader := db.reader
+	db.mutex.RUnlock()
+
+	if reader == nil {
+		return nil, fmt.Errorf("database %s not loaded", db.path)
+	}
+
+	r := &record{}
+	if err := reader.Lookup(ip, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (db *database) status() *DatabaseStatus {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	s := &DatabaseStatus{Path: db.path}
+	if db.reader != nil {
+		s.Type = db.reader.Metadata.DatabaseType
+		s.BuildTime = time.Unix(int64(db.reader.Metadata.BuildEpoch), 0).UTC().Format(time.RFC3339)
+		s.LoadedAt = db.loadedAt.Format(time.RFC3339)
+	}
+	if db.err != nil {
+		s.Error = db.err.Error()
+	}
+	return s
+}
+
+func (db *database) close() {
+	close(db.done)
+	if db.watcher != nil {
+		db.watcher.Close()
+	}
+
+	db.mutex.Lock()
+	if db.timer != nil {
+		db.timer.Stop()
+	}
+	db.mutex.Unlock()
+}
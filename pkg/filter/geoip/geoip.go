@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of GeoIP.
+	Kind = "GeoIP"
+
+	resultBlocked        = "blocked"
+	resultCountryMatched = "countryMatched"
+)
+
+var results = []string{resultBlocked, resultCountryMatched}
+
+func init() {
+	httppipeline.Register(&GeoIP{})
+}
+
+type (
+	// GeoIP resolves the client IP to the country and ASN by MaxMind
+	// databases, and blocks or routes requests by countries.
+	GeoIP struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		country lookuper
+		asn     lookuper
+	}
+
+	// Spec describes the GeoIP.
+	Spec struct {
+		// CountryDatabase is the path of a GeoIP2/GeoLite2 Country or City
+		// database, ASNDatabase is the path of an ASN database.
+		CountryDatabase string `yaml:"countryDatabase" jsonschema:"omitempty"`
+		ASNDatabase     string `yaml:"asnDatabase" jsonschema:"omitempty"`
+
+		CountryHeader string `yaml:"countryHeader" jsonschema:"omitempty"`
+		ASNHeader     string `yaml:"asnHeader" jsonschema:"omitempty"`
+		ASOrgHeader   string `yaml:"asOrgHeader" jsonschema:"omitempty"`
+
+		// Countries are ISO 3166-1 alpha-2 codes, e.g. US, CN.
+		AllowedCountries []string `yaml:"allowedCountries" jsonschema:"omitempty,uniqueItems=true"`
+		DeniedCountries  []string `yaml:"deniedCountries" jsonschema:"omitempty,uniqueItems=true"`
+		BlockUnknown     bool     `yaml:"blockUnknown" jsonschema:"omitempty"`
+		// MatchCountries makes the result countryMatched if the country
+		// is one of them, so the request could be routed by jumpIf.
+		MatchCountries []string `yaml:"matchCountries" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Status is the status of GeoIP.
+	Status struct {
+		Country *DatabaseStatus `yaml:"country,omitempty"`
+		ASN     *DatabaseStatus `yaml:"asn,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.CountryDatabase == "" && s.ASNDatabase == "" {
+		return fmt.Errorf("neither countryDatabase nor asnDatabase is specified")
+	}
+
+	lists := len(s.AllowedCountries) + len(s.DeniedCountries) + len(s.MatchCountries)
+	if (lists > 0 || s.BlockUnknown) && s.CountryDatabase == "" {
+		return fmt.Errorf("countryDatabase is required to block or match countries")
+	}
+	if len(s.AllowedCountries) > 0 && len(s.DeniedCountries) > 0 {
+		return fmt.Errorf("both allowedCountries and deniedCountries are specified")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of GeoIP.
+func (g *GeoIP) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of GeoIP.
+func (g *GeoIP) DefaultSpec() interface{} {
+	return &Spec{
+		CountryHeader: "X-Geo-Country",
+		ASNHeader:     "X-Geo-ASN",
+		ASOrgHeader:   "X-Geo-AS-Org",
+	}
+}
+
+// Description returns the description of GeoIP.
+func (g *GeoIP) Description() string {
+	return "GeoIP resolves the client IP to the country and ASN, and blocks or routes requests by countries."
+}
+
+// Results returns the results of GeoIP.
+func (g *GeoIP) Results() []string {
+	return results
+}
+
+// Produces returns the headers set by GeoIP.
+func (g *GeoIP) Produces(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	spec := pipeSpec.FilterSpec().(*Spec)
+	var values []*httppipeline.Value
+	if spec.CountryHeader != "" {
+		values = append(values, &httppipeline.Value{Header: spec.CountryHeader, Type: httppipeline.ValueString})
+	}
+	if spec.ASNHeader != "" {
+		values = append(values, &httppipeline.Value{Header: spec.ASNHeader, Type: httppipeline.ValueInt})
+	}
+	if spec.ASOrgHeader != "" {
+		values = append(values, &httppipeline.Value{Header: spec.ASOrgHeader, Type: httppipeline.ValueString})
+	}
+	return values
+}
+
+// Consumes returns nil, GeoIP reads no header set by other filters.
+func (g *GeoIP) Consumes(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value { return nil }
+
+// Init initializes GeoIP.
+func (g *GeoIP) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	g.pipeSpec, g.spec, g.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	g.reload()
+}
+
+// Inherit inherits previous generation of GeoIP.
+func (g *GeoIP) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	g.Init(pipeSpec, super)
+}
+
+func (g *GeoIP) reload() {
+	g.country, g.asn = nil, nil
+	if g.spec.CountryDatabase != "" {
+		g.country = newDatabase(g.spec.CountryDatabase)
+	}
+	if g.spec.ASNDatabase != "" {
+		g.asn = newDatabase(g.spec.ASNDatabase)
+	}
+}
+
+// Handle resolves the client IP of HTTPContext.
+func (g *GeoIP) Handle(ctx context.HTTPContext) string {
+	result := g.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (g *GeoIP) handle(ctx context.HTTPContext) string {
+	r := ctx.Request()
+	h := r.Header()
+	ip := net.ParseIP(r.RealIP())
+
+	// NOTE: Delete them first, so clients can't forge them.
+	for _, header := range []string{g.spec.CountryHeader, g.spec.ASNHeader, g.spec.ASOrgHeader} {
+		if header != "" {
+			h.Del(header)
+		}
+	}
+
+	country := ""
+	if g.country != nil && ip != nil {
+		if rec, err := g.country.lookup(ip); err == nil {
+			country = rec.Country.ISOCode
+		}
+	}
+	if g.asn != nil && ip != nil {
+		if rec, err := g.asn.lookup(ip); err == nil && rec.AutonomousSystemNumber != 0 {
+			if g.spec.ASNHeader != "" {
+				h.Set(g.spec.ASNHeader, strconv.FormatUint(uint64(rec.AutonomousSystemNumber), 10))
+			}
+			if g.spec.ASOrgHeader != "" && rec.AutonomousSystemOrganization != "" {
+				h.Set(g.spec.ASOrgHeader, rec.AutonomousSystemOrganization)
+			}
+		}
+	}
+	if country != "" && g.spec.CountryHeader != "" {
+		h.Set(g.spec.CountryHeader, country)
+	}
+
+	if g.blocked(country) {
+		ctx.AddTag(stringtool.Cat("geoip: blocked country ", country, " of ", r.RealIP()))
+		ctx.Response().SetStatusCode(http.StatusForbidden)
+		return resultBlocked
+	}
+
+	if country != "" && stringtool.StrInSlice(country, g.spec.MatchCountries) {
+		return resultCountryMatched
+	}
+
+	return ""
+}
+
+func (g *GeoIP) blocked(country string) bool {
+	if country == "" {
+		return g.spec.BlockUnknown
+	}
+	if len(g.spec.AllowedCountries) > 0 {
+		return !stringtool.StrInSlice(country, g.spec.AllowedCountries)
+	}
+	return stringtool.StrInSlice(country, g.spec.DeniedCountries)
+}
+
+// Status returns the status of GeoIP.
+func (g *GeoIP) Status() interface{} {
+	s := &Status{}
+	if g.country != nil {
+		s.Country = g.country.status()
+	}
+	if g.asn != nil {
+		s.ASN = g.asn.status()
+	}
+	return s
+}
+
+// Close closes GeoIP.
+func (g *GeoIP) Close() {
+	if g.country != nil {
+		g.country.close()
+	}
+	if g.asn != nil {
+		g.asn.close()
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "geoip-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "geoip-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+type fakeDatabase map[string]*record
+
+func (db fakeDatabase) lookup(ip net.IP) (*record, error) {
+	if r, ok := db[ip.String()]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+func (db fakeDatabase) status() *DatabaseStatus { return &DatabaseStatus{Path: "fake"} }
+func (db fakeDatabase) close()                  {}
+
+func countryRecord(iso string) *record {
+	r := &record{}
+	r.Country.ISOCode = iso
+	return r
+}
+
+func newGeoIP(t *testing.T, spec map[string]interface{}) *GeoIP {
+	g := filtertest.NewFilter(t, &GeoIP{}, spec).(*GeoIP)
+	g.Close()
+
+	g.country = fakeDatabase{
+		"1.1.1.1": countryRecord("US"),
+		"2.2.2.2": countryRecord("CN"),
+	}
+	g.asn = fakeDatabase{
+		"1.1.1.1": {AutonomousSystemNumber: 13335, AutonomousSystemOrganization: "CLOUDFLARENET"},
+	}
+	return g
+}
+
+func newContext(ip string, headers map[string]string) context.HTTPContext {
+	r := filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", headers)
+	r.Header.Set("X-Forwarded-For", ip)
+	return filtertest.NewContext(r)
+}
+
+func TestEnrich(t *testing.T) {
+	dir := t.TempDir()
+	g := newGeoIP(t, map[string]interface{}{
+		"countryDatabase": filepath.Join(dir, "country.mmdb"),
+		"asnDatabase":     filepath.Join(dir, "asn.mmdb"),
+	})
+
+	ctx := newContext("1.1.1.1", map[string]string{"X-Geo-Country": "FR"})
+	if result := g.handle(ctx); result != "" {
+		t.Fatalf("unexpected result %q", result)
+	}
+	h := ctx.Request().Header()
+	if v := h.Get("X-Geo-Country"); v != "US" {
+		t.Errorf("country should be US, but got %v", v)
+	}
+	if v := h.Get("X-Geo-ASN"); v != "13335" {
+		t.Errorf("asn should be 13335, but got %v", v)
+	}
+	if v := h.Get("X-Geo-AS-Org"); v != "CLOUDFLARENET" {
+		t.Errorf("as org should be CLOUDFLARENET, but got %v", v)
+	}
+
+	// forged headers must be removed for unknown addresses
+	ctx = newContext("3.3.3.3", map[string]string{"X-Geo-Country": "US"})
+	g.handle(ctx)
+	if v := ctx.Request().Header().Get("X-Geo-Country"); v != "" {
+		t.Errorf("forged country should be removed, but got %v", v)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	dir := t.TempDir()
+	g := newGeoIP(t, map[string]interface{}{
+		"countryDatabase": filepath.Join(dir, "country.mmdb"),
+		"deniedCountries": []string{"CN"},
+		"matchCountries":  []string{"US"},
+		"blockUnknown":    false,
+	})
+
+	cases := []struct {
+		ip     string
+		result string
+	}{
+		{"1.1.1.1", resultCountryMatched},
+		{"2.2.2.2", resultBlocked},
+		{"3.3.3.3", ""},
+	}
+	for _, c := range cases {
+		ctx := newContext(c.ip, nil)
+		if result := g.handle(ctx); result != c.result {
+			t.Errorf("%s: result should be %q, but got %q", c.ip, c.result, result)
+		}
+	}
+
+	g = newGeoIP(t, map[string]interface{}{
+		"countryDatabase":  filepath.Join(dir, "country.mmdb"),
+		"allowedCountries": []string{"CN"},
+		"blockUnknown":     true,
+	})
+	cases = []struct {
+		ip     string
+		result string
+	}{
+		{"1.1.1.1", resultBlocked},
+		{"2.2.2.2", ""},
+		{"3.3.3.3", resultBlocked},
+	}
+	for _, c := range cases {
+		ctx := newContext(c.ip, nil)
+		if result := g.handle(ctx); result != c.result {
+			t.Errorf("%s: result should be %q, but got %q", c.ip, c.result, result)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	specs := []Spec{
+		{},
+		{ASNDatabase: "asn.mmdb", DeniedCountries: []string{"CN"}},
+		{CountryDatabase: "c.mmdb", AllowedCountries: []string{"US"}, DeniedCountries: []string{"CN"}},
+	}
+	for i, s := range specs {
+		if s.Validate() == nil {
+			t.Errorf("spec %d should be invalid", i)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hmacauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of HMACAuth.
+	Kind = "HMACAuth"
+
+	resultUnauthorized = "unauthorized"
+
+	defaultTolerance      = 5 * time.Minute
+	defaultNonceCacheSize = 10000
+	defaultMaxBodySize    = 10 * 1024 * 1024
+)
+
+var results = []string{resultUnauthorized}
+
+func init() {
+	httppipeline.Register(&HMACAuth{})
+	secret.RegisterSensitiveFields("secrets")
+}
+
+type (
+	// HMACAuth verifies HMAC signatures of requests, e.g. webhooks.
+	HMACAuth struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		scheme    scheme
+		tolerance time.Duration
+		nonces    *lru.Cache
+	}
+
+	// Spec describes the HMACAuth.
+	Spec struct {
+		Scheme string `yaml:"scheme" jsonschema:"required,enum=github,enum=stripe,enum=slack,enum=generic"`
+		// Secrets are the shared secrets, more than one secret could be
+		// specified for rotation.
+		Secrets []string `yaml:"secrets" jsonschema:"required,minItems=1"`
+		// Tolerance is the max difference between the timestamp of the
+		// request and now.
+		Tolerance      string `yaml:"tolerance" jsonschema:"omitempty,format=duration"`
+		NonceCacheSize int    `yaml:"nonceCacheSize" jsonschema:"omitempty,minimum=0"`
+		MaxBodySize    int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+
+		Generic *GenericSpec `yaml:"generic,omitempty" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.Scheme == "generic" && s.Generic == nil {
+		return fmt.Errorf("generic is required for generic scheme")
+	}
+	return nil
+}
+
+// Kind returns the kind of HMACAuth.
+func (ha *HMACAuth) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of HMACAuth.
+func (ha *HMACAuth) DefaultSpec() interface{} {
+	return &Spec{
+		NonceCacheSize: defaultNonceCacheSize,
+		MaxBodySize:    defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of HMACAuth.
+func (ha *HMACAuth) Description() string {
+	return "HMACAuth verifies HMAC signatures of requests, with replay protection."
+}
+
+// Results returns the results of HMACAuth.
+func (ha *HMACAuth) Results() []string {
+	return results
+}
+
+// Init initializes HMACAuth.
+func (ha *HMACAuth) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	ha.pipeSpec, ha.spec, ha.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	ha.reload()
+}
+
+// Inherit inherits previous generation of HMACAuth.
+func (ha *HMACAuth) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	ha.Init(pipeSpec, super)
+
+	// NOTE: Nonces are kept, or requests could be replayed after reloading.
+	prev := previousGeneration.(*HMACAuth)
+	if ha.nonces != nil && prev.nonces != nil {
+		for _, nonce := range prev.nonces.Keys() {
+			ha.nonces.Add(nonce, struct{}{})
+		}
+	}
+}
+
+func (ha *HMACAuth) reload() {
+	ha.scheme = newScheme(ha.spec)
+
+	ha.tolerance = defaultTolerance
+	if ha.spec.Tolerance != "" {
+		var err error
+		ha.tolerance, err = time.ParseDuration(ha.spec.Tolerance)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", ha.spec.Tolerance, err)
+			ha.tolerance = defaultTolerance
+		}
+	}
+
+	if ha.spec.NonceCacheSize > 0 {
+		var err error
+		ha.nonces, err = lru.New(ha.spec.NonceCacheSize)
+		if err != nil {
+			logger.Errorf("BUG: new lru cache failed: %v", err)
+		}
+	}
+}
+
+// Handle verifies the signature of HTTPContext.
+func (ha *HMACAuth) Handle(ctx context.HTTPContext) string {
+	result := ha.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (ha *HMACAuth) handle(ctx context.HTTPContext) string {
+	err := ha.verify(ctx.Request())
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("hmacauth: ", err.Error()))
+		ctx.Response().SetStatusCode(http.StatusUnauthorized)
+		return resultUnauthorized
+	}
+	return ""
+}
+
+func (ha *HMACAuth) readBody(r context.HTTPRequest) ([]byte, error) {
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, r.Body(), ha.spec.MaxBodySize+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+	if written > ha.spec.MaxBodySize {
+		r.SetBody(io.MultiReader(buff, r.Body()))
+		return nil, fmt.Errorf("body exceed %dB", ha.spec.MaxBodySize)
+	}
+	r.SetBody(bytes.NewReader(buff.Bytes()))
+	return buff.Bytes(), nil
+}
+
+func (ha *HMACAuth) verify(r context.HTTPRequest) error {
+	body, err := ha.readBody(r)
+	if err != nil {
+		return err
+	}
+
+	sr, err := ha.scheme.parse(r, body)
+	if err != nil {
+		return err
+	}
+
+	if sr.timestamp != "" {
+		if err := ha.checkTimestamp(sr.timestamp); err != nil {
+			return err
+		}
+	}
+
+	var matched []byte
+	for _, secret := range ha.spec.Secrets {
+		expected := ha.scheme.sign([]byte(secret), sr.payload)
+		for _, signature := range sr.signatures {
+			if hmac.Equal(expected, signature) {
+				matched = signature
+				break
+			}
+		}
+		if matched != nil {
+			break
+		}
+	}
+	if matched == nil {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	// NOTE: The signature is used as the nonce if there's no nonce,
+	// so that identical requests can't be replayed.
+	nonce := sr.nonce
+	if nonce == "" {
+		nonce = hex.EncodeToString(matched)
+	}
+	return ha.checkNonce(nonce)
+}
+
+func (ha *HMACAuth) checkTimestamp(timestamp string) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s", timestamp)
+	}
+
+	diff := time.Since(time.Unix(sec, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > ha.tolerance {
+		return fmt.Errorf("timestamp %s out of tolerance", timestamp)
+	}
+
+	return nil
+}
+
+func (ha *HMACAuth) checkNonce(nonce string) error {
+	if ha.nonces == nil {
+		return nil
+	}
+
+	// NOTE: Checking and adding must be atomic, or concurrent replays
+	// could both pass.
+	if exists, _ := ha.nonces.ContainsOrAdd(nonce, struct{}{}); exists {
+		return fmt.Errorf("replayed nonce %s", nonce)
+	}
+
+	return nil
+}
+
+// Status returns status.
+func (ha *HMACAuth) Status() interface{} {
+	return nil
+}
+
+// Close closes HMACAuth.
+func (ha *HMACAuth) Close() {}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hmacauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+const (
+	testSecret = "webhook-secret"
+	body       = `{"event":"push"}`
+)
+
+func newHMACAuth(t *testing.T, spec map[string]interface{}) *HMACAuth {
+	return filtertest.NewFilter(t, &HMACAuth{}, spec).(*HMACAuth)
+}
+
+func newContext(url string, headers map[string]string) context.HTTPContext {
+	return filtertest.NewContext(filtertest.NewRequest(http.MethodPost, url, body, headers))
+}
+
+func sign(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func TestGitHub(t *testing.T) {
+	ha := newHMACAuth(t, map[string]interface{}{
+		"scheme":  "github",
+		"secrets": []string{"old-secret", testSecret},
+	})
+
+	signature := "sha256=" + hex.EncodeToString(sign(body))
+	ctx := newContext("http://127.0.0.1/", map[string]string{
+		"X-Hub-Signature-256": signature,
+		"X-GitHub-Delivery":   "delivery-1",
+	})
+	if result := ha.handle(ctx); result != "" {
+		t.Fatalf("valid signature should pass, got %q", result)
+	}
+	if buff, _ := ioutil.ReadAll(ctx.Request().Body()); string(buff) != body {
+		t.Errorf("body should be kept for following filters, got %q", buff)
+	}
+
+	ctx = newContext("http://127.0.0.1/", map[string]string{
+		"X-Hub-Signature-256": signature,
+		"X-GitHub-Delivery":   "delivery-1",
+	})
+	if result := ha.handle(ctx); result != resultUnauthorized {
+		t.Errorf("replayed delivery should be rejected, got %q", result)
+	}
+
+	ctx = newContext("http://127.0.0.1/", map[string]string{
+		"X-Hub-Signature-256": signature,
+		"X-GitHub-Delivery":   "delivery-2",
+	})
+	if result := ha.handle(ctx); result != resultUnauthorized {
+		t.Errorf("replayed delivery with another id should be rejected, got %q", result)
+	}
+
+	next := &HMACAuth{}
+	next.Inherit(ha.pipeSpec, ha, nil)
+	ctx = newContext("http://127.0.0.1/", map[string]string{
+		"X-Hub-Signature-256": signature,
+	})
+	if result := next.handle(ctx); result != resultUnauthorized {
+		t.Errorf("replayed delivery after reloading should be rejected, got %q", result)
+	}
+
+	ctx = newContext("http://127.0.0.1/", map[string]string{
+		"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(sign("tampered")),
+	})
+	if result := ha.handle(ctx); result != resultUnauthorized {
+		t.Errorf("invalid signature should be rejected, got %q", result)
+	}
+}
+
+func TestStripe(t *testing.T) {
+	ha := newHMACAuth(t, map[string]interface{}{
+		"scheme":    "stripe",
+		"secrets":   []string{testSecret},
+		"tolerance": "1m",
+	})
+
+	header := func(ts int64) string {
+		t := strconv.FormatInt(ts, 10)
+		return "t=" + t + ",v1=" + hex.EncodeToString(sign(t+"."+body)) + ",v0=ignored"
+	}
+
+	now := time.Now().Unix()
+	ctx := newContext("http://127.0.0.1/", map[string]string{"Stripe-Signature": header(now)})
+	if result := ha.handle(ctx); result != "" {
+		t.Fatalf("valid signature should pass, got %q", result)
+	}
+
+	ctx = newContext("http://127.0.0.1/", map[string]string{"Stripe-Signature": header(now)})
+	if result := ha.handle(ctx); result != resultUnauthorized {
+		t.Errorf("replayed request should be rejected, got %q", result)
+	}
+
+	ctx = newContext("http://127.0.0.1/", map[string]string{"Stripe-Signature": header(now - 120)})
+	if result := ha.handle(ctx); result != resultUnauthorized {
+		t.Errorf("stale timestamp should be rejected, got %q", result)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	ha := newHMACAuth(t, map[string]interface{}{
+		"scheme":  "slack",
+		"secrets": []string{testSecret},
+	})
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	ctx := newContext("http://127.0.0.1/", map[string]string{
+		"X-Slack-Request-Timestamp": ts,
+		"X-Slack-Signature":         "v0=" + hex.EncodeToString(sign("v0:"+ts+":"+body)),
+	})
+	if result := ha.handle(ctx); result != "" {
+		t.Fatalf("valid signature should pass, got %q", result)
+	}
+}
+
+func TestGeneric(t *testing.T) {
+	ha := newHMACAuth(t, map[string]interface{}{
+		"scheme":  "generic",
+		"secrets": []string{testSecret},
+		"generic": map[string]interface{}{
+			"encoding":      "base64",
+			"nonceHeader":   "X-Nonce",
+			"signedHeaders": []string{"Content-Type"},
+		},
+	})
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	bodyHash := sha256.Sum256([]byte(body))
+	canonical := "POST\n/orders\nid=1\n" + ts + "\nnonce-1\ncontent-type:application/json\n" +
+		hex.EncodeToString(bodyHash[:])
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"X-Timestamp":  ts,
+		"X-Nonce":      "nonce-1",
+		"X-Signature":  base64.StdEncoding.EncodeToString(sign(canonical)),
+	}
+	if result := ha.handle(newContext("http://127.0.0.1/orders?id=1", headers)); result != "" {
+		t.Fatalf("valid signature should pass, got %q", result)
+	}
+
+	headers["X-Nonce"] = "nonce-2"
+	if result := ha.handle(newContext("http://127.0.0.1/orders?id=1", headers)); result != resultUnauthorized {
+		t.Errorf("signature over another nonce should be rejected, got %q", result)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	_, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+		Name: "hmacauth",
+		Kind: Kind,
+	}, map[string]interface{}{
+		"scheme":  "generic",
+		"secrets": []string{testSecret},
+	})
+	if err == nil {
+		t.Errorf("generic scheme without generic spec should be invalid")
+	}
+}
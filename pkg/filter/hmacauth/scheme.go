@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hmacauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+type (
+	// scheme extracts signatures and the signed payload from requests,
+	// and signs payloads.
+	scheme interface {
+		parse(r context.HTTPRequest, body []byte) (*signedRequest, error)
+		sign(secret, payload []byte) []byte
+	}
+
+	signedRequest struct {
+		payload    []byte
+		signatures [][]byte
+		timestamp  string
+		nonce      string
+	}
+
+	// GenericSpec describes the generic scheme, the signature is over the
+	// canonical string of the request:
+	//
+	//   METHOD\nPATH\nQUERY\nTIMESTAMP\nNONCE\n
+	//   name1:value1\n...(for signed headers, names in lower case)
+	//   HEX(SHA256(BODY))
+	GenericSpec struct {
+		Algorithm       string   `yaml:"algorithm" jsonschema:"omitempty,enum=,enum=sha1,enum=sha256,enum=sha512"`
+		Encoding        string   `yaml:"encoding" jsonschema:"omitempty,enum=,enum=hex,enum=base64"`
+		SignatureHeader string   `yaml:"signatureHeader" jsonschema:"omitempty"`
+		TimestampHeader string   `yaml:"timestampHeader" jsonschema:"omitempty"`
+		NonceHeader     string   `yaml:"nonceHeader" jsonschema:"omitempty"`
+		SignedHeaders   []string `yaml:"signedHeaders" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	githubScheme  struct{}
+	stripeScheme  struct{}
+	slackScheme   struct{}
+	genericScheme struct {
+		spec    *GenericSpec
+		newHash func() hash.Hash
+	}
+)
+
+func newScheme(spec *Spec) scheme {
+	switch spec.Scheme {
+	case "github":
+		return githubScheme{}
+	case "stripe":
+		return stripeScheme{}
+	case "slack":
+		return slackScheme{}
+	default:
+		return newGenericScheme(spec.Generic)
+	}
+}
+
+func hmacSHA256(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func concat(parts ...[]byte) []byte {
+	var buff []byte
+	for _, p := range parts {
+		buff = append(buff, p...)
+	}
+	return buff
+}
+
+// github: X-Hub-Signature-256: sha256=<hex>
+func (githubScheme) parse(r context.HTTPRequest, body []byte) (*signedRequest, error) {
+	value := r.Header().Get("X-Hub-Signature-256")
+	if !strings.HasPrefix(value, "sha256=") {
+		return nil, fmt.Errorf("missing or malformed X-Hub-Signature-256")
+	}
+
+	signature, err := hex.DecodeString(value[len("sha256="):])
+	if err != nil {
+		return nil, fmt.Errorf("malformed X-Hub-Signature-256")
+	}
+
+	// NOTE: X-GitHub-Delivery isn't signed, and GitHub signs no
+	// timestamp, so the signature itself is the nonce.
+	return &signedRequest{
+		payload:    body,
+		signatures: [][]byte{signature},
+	}, nil
+}
+
+func (githubScheme) sign(secret, payload []byte) []byte {
+	return hmacSHA256(secret, payload)
+}
+
+// stripe: Stripe-Signature: t=<timestamp>,v1=<hex>[,v1=<hex>...]
+func (stripeScheme) parse(r context.HTTPRequest, body []byte) (*signedRequest, error) {
+	sr := &signedRequest{}
+	for _, item := range strings.Split(r.Header().Get("Stripe-Signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			sr.timestamp = kv[1]
+		case "v1":
+			if signature, err := hex.DecodeString(kv[1]); err == nil {
+				sr.signatures = append(sr.signatures, signature)
+			}
+		}
+	}
+
+	if sr.timestamp == "" || len(sr.signatures) == 0 {
+		return nil, fmt.Errorf("missing or malformed Stripe-Signature")
+	}
+
+	sr.payload = concat([]byte(sr.timestamp), []byte("."), body)
+	return sr, nil
+}
+
+func (stripeScheme) sign(secret, payload []byte) []byte {
+	return hmacSHA256(secret, payload)
+}
+
+// slack: X-Slack-Signature: v0=<hex>, X-Slack-Request-Timestamp: <timestamp>
+func (slackScheme) parse(r context.HTTPRequest, body []byte) (*signedRequest, error) {
+	timestamp := r.Header().Get("X-Slack-Request-Timestamp")
+	if timestamp == "" {
+		return nil, fmt.Errorf("missing X-Slack-Request-Timestamp")
+	}
+
+	value := r.Header().Get("X-Slack-Signature")
+	if !strings.HasPrefix(value, "v0=") {
+		return nil, fmt.Errorf("missing or malformed X-Slack-Signature")
+	}
+	signature, err := hex.DecodeString(value[len("v0="):])
+	if err != nil {
+		return nil, fmt.Errorf("malformed X-Slack-Signature")
+	}
+
+	return &signedRequest{
+		payload:    concat([]byte("v0:"+timestamp+":"), body),
+		signatures: [][]byte{signature},
+		timestamp:  timestamp,
+	}, nil
+}
+
+func (slackScheme) sign(secret, payload []byte) []byte {
+	return hmacSHA256(secret, payload)
+}
+
+func newGenericScheme(spec *GenericSpec) *genericScheme {
+	copied := *spec
+	if copied.Algorithm == "" {
+		copied.Algorithm = "sha256"
+	}
+	if copied.Encoding == "" {
+		copied.Encoding = "hex"
+	}
+	if copied.SignatureHeader == "" {
+		copied.SignatureHeader = "X-Signature"
+	}
+	if copied.TimestampHeader == "" {
+		copied.TimestampHeader = "X-Timestamp"
+	}
+
+	gs := &genericScheme{spec: &copied}
+	switch copied.Algorithm {
+	case "sha1":
+		gs.newHash = sha1.New
+	case "sha512":
+		gs.newHash = sha512.New
+	default:
+		gs.newHash = sha256.New
+	}
+
+	return gs
+}
+
+func (gs *genericScheme) parse(r context.HTTPRequest, body []byte) (*signedRequest, error) {
+	h := r.Header()
+
+	value := h.Get(gs.spec.SignatureHeader)
+	if value == "" {
+		return nil, fmt.Errorf("missing %s", gs.spec.SignatureHeader)
+	}
+
+	var signature []byte
+	var err error
+	if gs.spec.Encoding == "base64" {
+		signature, err = base64.StdEncoding.DecodeString(value)
+	} else {
+		signature, err = hex.DecodeString(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s", gs.spec.SignatureHeader)
+	}
+
+	timestamp := h.Get(gs.spec.TimestampHeader)
+	if timestamp == "" {
+		return nil, fmt.Errorf("missing %s", gs.spec.TimestampHeader)
+	}
+
+	var nonce string
+	if gs.spec.NonceHeader != "" {
+		nonce = h.Get(gs.spec.NonceHeader)
+	}
+
+	return &signedRequest{
+		payload:    gs.canonicalString(r, timestamp, nonce, body),
+		signatures: [][]byte{signature},
+		timestamp:  timestamp,
+		nonce:      nonce,
+	}, nil
+}
+
+func (gs *genericScheme) canonicalString(r context.HTTPRequest, timestamp, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+
+	var sb strings.Builder
+	sb.WriteString(r.Method())
+	sb.WriteByte('\n')
+	sb.WriteString(r.Path())
+	sb.WriteByte('\n')
+	sb.WriteString(r.Query())
+	sb.WriteByte('\n')
+	sb.WriteString(timestamp)
+	sb.WriteByte('\n')
+	sb.WriteString(nonce)
+	sb.WriteByte('\n')
+	for _, name := range gs.spec.SignedHeaders {
+		sb.WriteString(strings.ToLower(name))
+		sb.WriteByte(':')
+		sb.WriteString(strings.TrimSpace(r.Header().Get(name)))
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(hex.EncodeToString(bodyHash[:]))
+
+	return []byte(sb.String())
+}
+
+func (gs *genericScheme) sign(secret, payload []byte) []byte {
+	mac := hmac.New(gs.newHash, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package injectiondetector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of InjectionDetector.
+	Kind = "InjectionDetector"
+
+	resultRejected = "rejected"
+
+	targetQuery   = "query"
+	targetHeaders = "headers"
+	targetJSON    = "json"
+)
+
+var results = []string{resultRejected}
+
+func init() {
+	httppipeline.Register(&InjectionDetector{})
+}
+
+type (
+	// InjectionDetector detects SQL injection, XSS and command injection in
+	// query parameters, headers and JSON body fields.
+	InjectionDetector struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		patterns []*pattern
+		excluded map[string]struct{}
+
+		inspected uint64
+		rejected  uint64
+	}
+
+	// Spec describes the InjectionDetector.
+	Spec struct {
+		// Threshold is the score to reject requests, the score is the sum
+		// of weights of matched patterns.
+		Threshold  int      `yaml:"threshold" jsonschema:"omitempty,minimum=1"`
+		Categories []string `yaml:"categories" jsonschema:"omitempty,uniqueItems=true"`
+		Targets    []string `yaml:"targets" jsonschema:"omitempty,uniqueItems=true"`
+		// Headers are the headers to inspect, all headers are inspected
+		// if it is empty.
+		Headers []string `yaml:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		// ExcludedFields are fields not to inspect, in the form of
+		// <target>:<name>, e.g. query:comment, headers:Cookie, json:post.body.
+		ExcludedFields []string `yaml:"excludedFields" jsonschema:"omitempty,uniqueItems=true"`
+		MaxBodySize    int64    `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		// FindingsHeader is the header to set findings for following filters.
+		FindingsHeader string `yaml:"findingsHeader" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of InjectionDetector.
+	Status struct {
+		Inspected uint64 `yaml:"inspected"`
+		Rejected  uint64 `yaml:"rejected"`
+	}
+
+	finding struct {
+		pattern  *pattern
+		location string
+	}
+)
+
+var (
+	validCategories = []string{categorySQLi, categoryXSS, categoryCMDi}
+	validTargets    = []string{targetQuery, targetHeaders, targetJSON}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	for _, c := range s.Categories {
+		if !stringtool.StrInSlice(c, validCategories) {
+			return fmt.Errorf("unknown category %s", c)
+		}
+	}
+	for _, t := range s.Targets {
+		if !stringtool.StrInSlice(t, validTargets) {
+			return fmt.Errorf("unknown target %s", t)
+		}
+	}
+	for _, f := range s.ExcludedFields {
+		kv := strings.SplitN(f, ":", 2)
+		if len(kv) != 2 || kv[1] == "" || !stringtool.StrInSlice(kv[0], validTargets) {
+			return fmt.Errorf("invalid excluded field %s, it should be <target>:<name>", f)
+		}
+	}
+	return nil
+}
+
+// Kind returns the kind of InjectionDetector.
+func (d *InjectionDetector) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of InjectionDetector.
+func (d *InjectionDetector) DefaultSpec() interface{} {
+	return &Spec{
+		Threshold:   8,
+		MaxBodySize: 1024 * 1024,
+	}
+}
+
+// Description returns the description of InjectionDetector.
+func (d *InjectionDetector) Description() string {
+	return "InjectionDetector detects SQL injection, XSS and command injection in requests."
+}
+
+// Results returns the results of InjectionDetector.
+func (d *InjectionDetector) Results() []string {
+	return results
+}
+
+// Init initializes InjectionDetector.
+func (d *InjectionDetector) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	d.pipeSpec, d.spec, d.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	d.reload()
+}
+
+// Inherit inherits previous generation of InjectionDetector.
+func (d *InjectionDetector) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	d.Init(pipeSpec, super)
+}
+
+func (d *InjectionDetector) reload() {
+	d.patterns = nil
+	for _, p := range patterns {
+		if len(d.spec.Categories) == 0 || stringtool.StrInSlice(p.category, d.spec.Categories) {
+			d.patterns = append(d.patterns, p)
+		}
+	}
+
+	d.excluded = map[string]struct{}{}
+	for _, f := range d.spec.ExcludedFields {
+		if strings.HasPrefix(f, targetHeaders+":") {
+			f = targetHeaders + ":" + http.CanonicalHeaderKey(f[len(targetHeaders)+1:])
+		}
+		d.excluded[f] = struct{}{}
+	}
+}
+
+func (d *InjectionDetector) inspects(target string) bool {
+	return len(d.spec.Targets) == 0 || stringtool.StrInSlice(target, d.spec.Targets)
+}
+
+// Handle detects injections in HTTPContext.
+func (d *InjectionDetector) Handle(ctx context.HTTPContext) string {
+	result := d.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (d *InjectionDetector) handle(ctx context.HTTPContext) string {
+	atomic.AddUint64(&d.inspected, 1)
+
+	r := ctx.Request()
+	findings := d.detect(r)
+
+	if d.spec.FindingsHeader != "" {
+		// NOTE: Delete it first, so clients can't forge it.
+		r.Header().Del(d.spec.FindingsHeader)
+	}
+	if len(findings) == 0 {
+		return ""
+	}
+
+	score, matched := 0, map[*pattern]struct{}{}
+	items := make([]string, 0, len(findings))
+	for _, f := range findings {
+		if _, exists := matched[f.pattern]; !exists {
+			matched[f.pattern] = struct{}{}
+			score += f.pattern.weight
+		}
+		items = append(items, stringtool.Cat(f.pattern.category, "/", f.pattern.name, "@", f.location))
+	}
+	summary := stringtool.Cat("score=", strconv.Itoa(score), " ", strings.Join(items, ","))
+
+	ctx.AddTag(stringtool.Cat("injectiondetector: ", summary))
+	if d.spec.FindingsHeader != "" {
+		r.Header().Set(d.spec.FindingsHeader, summary)
+	}
+
+	if score < d.spec.Threshold {
+		return ""
+	}
+
+	atomic.AddUint64(&d.rejected, 1)
+	ctx.Response().SetStatusCode(http.StatusForbidden)
+	return resultRejected
+}
+
+func (d *InjectionDetector) detect(r context.HTTPRequest) []*finding {
+	var findings []*finding
+	check := func(target, name, value string) {
+		if value == "" {
+			return
+		}
+		if _, exists := d.excluded[target+":"+name]; exists {
+			return
+		}
+		for _, p := range d.patterns {
+			if p.re.MatchString(value) {
+				findings = append(findings, &finding{pattern: p, location: target + ":" + name})
+			}
+		}
+	}
+
+	if d.inspects(targetQuery) {
+		// NOTE: url.ParseQuery is not used, because it drops pairs
+		// containing semicolons, where attacks could be hidden.
+		for _, pair := range strings.Split(r.Std().URL.RawQuery, "&") {
+			name, value := pair, ""
+			if i := strings.IndexByte(pair, '='); i >= 0 {
+				name, value = pair[:i], pair[i+1:]
+			}
+			check(targetQuery, unescape(name), unescape(value))
+		}
+	}
+
+	if d.inspects(targetHeaders) {
+		h := r.Std().Header
+		names := d.spec.Headers
+		if len(names) == 0 {
+			names = sortedKeys(h)
+		}
+		for _, name := range names {
+			name = http.CanonicalHeaderKey(name)
+			for _, value := range h[name] {
+				check(targetHeaders, name, value)
+			}
+		}
+	}
+
+	if d.inspects(targetJSON) && strings.Contains(r.Header().Get("Content-Type"), "json") {
+		if v, ok := d.readJSON(r); ok {
+			walkJSON("", v, func(path, value string) {
+				check(targetJSON, path, value)
+			})
+		}
+	}
+
+	return findings
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unescape(s string) string {
+	if v, err := url.QueryUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
+
+// readJSON reads and decodes the JSON body, the body is kept for
+// following filters.
+func (d *InjectionDetector) readJSON(r context.HTTPRequest) (interface{}, bool) {
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, r.Body(), d.spec.MaxBodySize+1)
+	if err != nil && err != io.EOF {
+		return nil, false
+	}
+	if written > d.spec.MaxBodySize {
+		r.SetBody(io.MultiReader(buff, r.Body()))
+		return nil, false
+	}
+	r.SetBody(bytes.NewReader(buff.Bytes()))
+
+	var v interface{}
+	if err := json.Unmarshal(buff.Bytes(), &v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// walkJSON calls fn with paths and values of all string fields.
+func walkJSON(path string, v interface{}, fn func(path, value string)) {
+	switch v := v.(type) {
+	case string:
+		fn(path, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			walkJSON(child, v[key], fn)
+		}
+	case []interface{}:
+		for i, value := range v {
+			walkJSON(path+"["+strconv.Itoa(i)+"]", value, fn)
+		}
+	}
+}
+
+// Status returns the status of InjectionDetector.
+func (d *InjectionDetector) Status() interface{} {
+	return &Status{
+		Inspected: atomic.LoadUint64(&d.inspected),
+		Rejected:  atomic.LoadUint64(&d.rejected),
+	}
+}
+
+// Close closes InjectionDetector.
+func (d *InjectionDetector) Close() {}
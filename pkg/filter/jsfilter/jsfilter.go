@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsfilter
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of JSFilter.
+	Kind = "JSFilter"
+
+	resultFailed          = "failed"
+	resultResponseAlready = "responseAlready"
+
+	defaultTimeout          = "100ms"
+	defaultMaxCallStackSize = 256
+	defaultMaxBodySize      = 4 * 1024 * 1024
+	defaultMaxStringSize    = 4 * 1024 * 1024
+)
+
+var (
+	results = []string{resultFailed, resultResponseAlready}
+)
+
+func init() {
+	httppipeline.Register(&JSFilter{})
+}
+
+type (
+	// JSFilter is the filter running JavaScript scripts.
+	JSFilter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		program *goja.Program
+		vmPool  sync.Pool
+	}
+
+	// Spec describes the JSFilter.
+	Spec struct {
+		Script           string `yaml:"script" jsonschema:"required"`
+		Timeout          string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxCallStackSize int    `yaml:"maxCallStackSize" jsonschema:"omitempty,minimum=16"`
+		MaxBodySize      int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		// MaxStringSize limits strings created by the built-in functions
+		// amplifying their inputs, e.g. String.prototype.repeat, and the
+		// strings passed to eg. It's not a limit of the heap, see the
+		// NOTE of limitStrings.
+		MaxStringSize int64 `yaml:"maxStringSize" jsonschema:"omitempty,minimum=1"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	_, err := compile(s.Script)
+	return err
+}
+
+// compile wraps the script into a function, so that the script
+// is able to return its result at the top level.
+func compile(script string) (*goja.Program, error) {
+	program, err := goja.Compile(Kind, "(function() {\n"+script+"\n})()", true)
+	if err != nil {
+		return nil, fmt.Errorf("compile script failed: %v", err)
+	}
+	return program, nil
+}
+
+// Kind returns the kind of JSFilter.
+func (jf *JSFilter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of JSFilter.
+func (jf *JSFilter) DefaultSpec() interface{} {
+	return &Spec{
+		Timeout:          defaultTimeout,
+		MaxCallStackSize: defaultMaxCallStackSize,
+		MaxBodySize:      defaultMaxBodySize,
+		MaxStringSize:    defaultMaxStringSize,
+	}
+}
+
+// Description returns the description of JSFilter.
+func (jf *JSFilter) Description() string {
+	return "JSFilter runs JavaScript scripts to inspect and modify requests and responses."
+}
+
+// Results returns the results of JSFilter.
+func (jf *JSFilter) Results() []string {
+	return results
+}
+
+// Init initializes JSFilter.
+func (jf *JSFilter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	jf.pipeSpec, jf.spec, jf.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	jf.reload()
+}
+
+// Inherit inherits previous generation of JSFilter.
+func (jf *JSFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	jf.Init(pipeSpec, super)
+}
+
+func (jf *JSFilter) reload() {
+	var err error
+	if jf.spec.Timeout != "" {
+		jf.timeout, err = time.ParseDuration(jf.spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", jf.spec.Timeout, err)
+		}
+	}
+
+	jf.program, err = compile(jf.spec.Script)
+	if err != nil {
+		logger.Errorf("BUG: %v", err)
+	}
+
+	jf.vmPool.New = func() interface{} {
+		return newVM(jf.spec, jf.program)
+	}
+}
+
+// Handle handles HTTPContext by running the JavaScript script.
+func (jf *JSFilter) Handle(ctx context.HTTPContext) string {
+	result := jf.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (jf *JSFilter) handle(ctx context.HTTPContext) string {
+	if jf.program == nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag("jsFilter: script is not compiled")
+		return resultFailed
+	}
+
+	vm := jf.vmPool.Get().(*vm)
+	result, reusable, err := vm.run(ctx, jf.timeout)
+	if reusable {
+		jf.vmPool.Put(vm)
+	}
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("jsFilter: ", err.Error()))
+		return resultFailed
+	}
+
+	switch result {
+	case "":
+		return ""
+	case resultResponseAlready:
+		return resultResponseAlready
+	default:
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("jsFilter: unknown result ", result))
+		return resultFailed
+	}
+}
+
+// Status returns status.
+func (jf *JSFilter) Status() interface{} { return nil }
+
+// Close closes JSFilter.
+func (jf *JSFilter) Close() {}
@@ -0,0 +1,427 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsfilter
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// maxFetchTimeout bounds every fetch, even if the script has no timeout
+// or more time left.
+const maxFetchTimeout = 30 * time.Second
+
+var (
+	// All JSFilter instances use one fetchClient in order to reuse
+	// keepalive connections.
+	fetchClient = &http.Client{
+		// NOTE: The timeout is controlled by the context of every fetch,
+		// this is the last resort.
+		Timeout: maxFetchTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 60 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          1024,
+			MaxIdleConnsPerHost:   64,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+)
+
+type (
+	// vm is a JavaScript runtime bound to one HTTPContext at a time.
+	vm struct {
+		rt               *goja.Runtime
+		program          *goja.Program
+		maxCallStackSize int
+		maxBodySize      int64
+		maxStringSize    int64
+
+		ctx      context.HTTPContext
+		deadline time.Time
+		reqBody  []byte
+		rspBody  []byte
+	}
+
+	fetchOptions struct {
+		Method  string
+		Headers map[string]string
+		Body    string
+	}
+)
+
+func newVM(spec *Spec, program *goja.Program) *vm {
+	v := &vm{
+		rt:               goja.New(),
+		program:          program,
+		maxCallStackSize: spec.MaxCallStackSize,
+		maxBodySize:      spec.MaxBodySize,
+		maxStringSize:    spec.MaxStringSize,
+	}
+	if v.maxStringSize <= 0 {
+		v.maxStringSize = defaultMaxStringSize
+	}
+
+	v.rt.SetMaxCallStackSize(spec.MaxCallStackSize)
+	v.rt.SetFieldNameMapper(goja.UncapFieldNameMapper())
+	v.rt.Set("eg", v.api())
+	v.limitStrings()
+
+	return v
+}
+
+// run runs the script, reusable reports whether the vm is safe to be
+// reused, which is false if the script is or may be interrupted.
+func (v *vm) run(ctx context.HTTPContext, timeout time.Duration) (result string, reusable bool, err error) {
+	v.ctx, v.reqBody, v.rspBody = ctx, nil, nil
+	defer func() {
+		v.ctx, v.reqBody, v.rspBody = nil, nil, nil
+	}()
+
+	reusable = true
+	if timeout > 0 {
+		v.deadline = time.Now().Add(timeout)
+		timer := time.AfterFunc(timeout, func() {
+			v.rt.Interrupt("timeout")
+		})
+		defer func() {
+			if !timer.Stop() {
+				reusable = false
+			}
+		}()
+	} else {
+		v.deadline = time.Time{}
+	}
+
+	// NOTE: The script stops on the cancellation of the request too.
+	if ctx != nil {
+		stop, interrupted := make(chan struct{}), make(chan bool, 1)
+		go func() {
+			select {
+			case <-ctx.Done():
+				v.rt.Interrupt("cancelled")
+				interrupted <- true
+			case <-stop:
+				interrupted <- false
+			}
+		}()
+		defer func() {
+			close(stop)
+			if <-interrupted {
+				reusable = false
+			}
+		}()
+	}
+
+	ret, err := v.rt.RunProgram(v.program)
+	if _, ok := err.(*goja.StackOverflowError); ok {
+		return "", false, fmt.Errorf("call stack exceed %d", v.maxCallStackSize)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	if goja.IsUndefined(ret) || goja.IsNull(ret) {
+		return "", reusable, nil
+	}
+
+	return ret.String(), reusable, nil
+}
+
+// limitStrings replaces the built-in functions able to create huge
+// strings from small inputs, e.g. "x".repeat(1e9), by the ones
+// interrupting the script before creating strings exceeding maxStringSize.
+//
+// NOTE: The runtime has no limit of its heap, strings and arrays grown
+// step by step, e.g. by concatenating in loops, are only limited by the
+// timeout, so scripts must still be trusted not to exhaust the memory.
+func (v *vm) limitStrings() {
+	proto := v.rt.Get("String").ToObject(v.rt).Get("prototype").ToObject(v.rt)
+
+	v.limitString(proto, "repeat", func(call goja.FunctionCall) int64 {
+		size, count := int64(len(call.This.String())), call.Argument(0).ToInteger()
+		if size == 0 || count <= 0 {
+			return 0
+		}
+		if count > v.maxStringSize/size {
+			return v.maxStringSize + 1
+		}
+		return size * count
+	})
+
+	padSize := func(call goja.FunctionCall) int64 {
+		return call.Argument(0).ToInteger()
+	}
+	v.limitString(proto, "padStart", padSize)
+	v.limitString(proto, "padEnd", padSize)
+}
+
+// limitString replaces the function of the object by the one interrupting
+// the script if the size of the string it would create exceeds the limit.
+func (v *vm) limitString(obj *goja.Object, name string, size func(call goja.FunctionCall) int64) {
+	fn, ok := goja.AssertFunction(obj.Get(name))
+	if !ok {
+		logger.Errorf("BUG: %s is not a function", name)
+		return
+	}
+
+	limited := func(call goja.FunctionCall) goja.Value {
+		if size(call) > v.maxStringSize {
+			v.rt.Interrupt(fmt.Errorf("%s: string exceed %dB", name, v.maxStringSize))
+			return goja.Undefined()
+		}
+		ret, err := fn(call.This, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return ret
+	}
+
+	obj.DefineDataProperty(name, v.rt.ToValue(limited), goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// checkString returns an error if the string passed to eg exceeds
+// maxStringSize.
+func (v *vm) checkString(s string) error {
+	if int64(len(s)) > v.maxStringSize {
+		return fmt.Errorf("string exceed %dB", v.maxStringSize)
+	}
+	return nil
+}
+
+func (v *vm) api() map[string]interface{} {
+	return map[string]interface{}{
+		"reqMethod":    func() string { return v.ctx.Request().Method() },
+		"reqPath":      func() string { return v.ctx.Request().Path() },
+		"setReqPath":   v.setReqPath,
+		"reqQuery":     func() string { return v.ctx.Request().Query() },
+		"setReqQuery":  v.setReqQuery,
+		"reqRealIP":    func() string { return v.ctx.Request().RealIP() },
+		"reqHeader":    func(key string) string { return v.ctx.Request().Header().Get(key) },
+		"setReqHeader": v.setReqHeader,
+		"addReqHeader": v.addReqHeader,
+		"delReqHeader": func(key string) { v.ctx.Request().Header().Del(key) },
+		"reqBody":      v.reqBodyFunc,
+		"setReqBody":   v.setReqBody,
+		"rspStatus":    func() int { return v.ctx.Response().StatusCode() },
+		"setRspStatus": v.setRspStatus,
+		"rspHeader":    func(key string) string { return v.ctx.Response().Header().Get(key) },
+		"setRspHeader": v.setRspHeader,
+		"delRspHeader": func(key string) { v.ctx.Response().Header().Del(key) },
+		"rspBody":      v.rspBodyFunc,
+		"setRspBody":   v.setRspBody,
+		"fetch":        v.fetch,
+		"log":          v.log,
+	}
+}
+
+func (v *vm) setReqPath(path string) error {
+	if err := v.checkString(path); err != nil {
+		return err
+	}
+	v.ctx.Request().SetPath(path)
+	return nil
+}
+
+func (v *vm) setReqQuery(query string) error {
+	if err := v.checkString(query); err != nil {
+		return err
+	}
+	v.ctx.Request().SetQuery(query)
+	return nil
+}
+
+func (v *vm) setReqHeader(key, value string) error {
+	if err := v.checkString(key + value); err != nil {
+		return err
+	}
+	v.ctx.Request().Header().Set(key, value)
+	return nil
+}
+
+func (v *vm) addReqHeader(key, value string) error {
+	if err := v.checkString(key + value); err != nil {
+		return err
+	}
+	v.ctx.Request().Header().Add(key, value)
+	return nil
+}
+
+func (v *vm) setRspHeader(key, value string) error {
+	if err := v.checkString(key + value); err != nil {
+		return err
+	}
+	v.ctx.Response().Header().Set(key, value)
+	return nil
+}
+
+func (v *vm) log(msg string) error {
+	if err := v.checkString(msg); err != nil {
+		return err
+	}
+	logger.Infof("jsFilter: %s", msg)
+	return nil
+}
+
+// readBody reads the body up to maxBodySize, the bytes read are returned
+// with the error too, so the body could be restored.
+func (v *vm) readBody(body io.Reader) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, body, v.maxBodySize+1)
+	if err != nil && err != io.EOF {
+		return buff.Bytes(), fmt.Errorf("read body failed: %v", err)
+	}
+	if written > v.maxBodySize {
+		return buff.Bytes(), fmt.Errorf("body exceed %dB", v.maxBodySize)
+	}
+
+	return buff.Bytes(), nil
+}
+
+func (v *vm) reqBodyFunc() (string, error) {
+	if v.reqBody == nil {
+		r := v.ctx.Request()
+		body, err := v.readBody(r.Body())
+		if err != nil {
+			// NOTE: The body is restored for the filters after this one.
+			r.SetBody(io.MultiReader(bytes.NewReader(body), r.Body()))
+			return "", err
+		}
+		v.reqBody = body
+		r.SetBody(bytes.NewReader(body))
+	}
+	return string(v.reqBody), nil
+}
+
+func (v *vm) setReqBody(body string) error {
+	if err := v.checkString(body); err != nil {
+		return err
+	}
+	v.reqBody = []byte(body)
+	v.ctx.Request().SetBody(bytes.NewReader(v.reqBody))
+	return nil
+}
+
+func (v *vm) setRspStatus(code int) error {
+	if code < 200 || code >= 600 {
+		return fmt.Errorf("invalid status code: %d", code)
+	}
+	v.ctx.Response().SetStatusCode(code)
+	return nil
+}
+
+func (v *vm) rspBodyFunc() (string, error) {
+	if v.rspBody == nil {
+		w := v.ctx.Response()
+		body, err := v.readBody(w.Body())
+		if err != nil {
+			w.SetBody(io.MultiReader(bytes.NewReader(body), w.Body()))
+			return "", err
+		}
+		v.rspBody = body
+		w.SetBody(bytes.NewReader(body))
+	}
+	return string(v.rspBody), nil
+}
+
+func (v *vm) setRspBody(body string) error {
+	if err := v.checkString(body); err != nil {
+		return err
+	}
+	v.rspBody = []byte(body)
+	w := v.ctx.Response()
+	w.Header().Del("Content-Length")
+	w.SetBody(bytes.NewReader(v.rspBody))
+	return nil
+}
+
+// fetch sends an HTTP request and waits for its response, the request
+// is canceled when the script runs out of its time, the request of the
+// context is canceled, or after maxFetchTimeout.
+func (v *vm) fetch(url string, options *fetchOptions) (map[string]interface{}, error) {
+	if options == nil {
+		options = &fetchOptions{}
+	}
+	if options.Method == "" {
+		options.Method = http.MethodGet
+	}
+	if err := v.checkString(options.Body); err != nil {
+		return nil, err
+	}
+
+	var ctx stdcontext.Context = v.ctx
+	if v.ctx == nil {
+		ctx = stdcontext.Background()
+	}
+	deadline := time.Now().Add(maxFetchTimeout)
+	if !v.deadline.IsZero() && v.deadline.Before(deadline) {
+		deadline = v.deadline
+	}
+	ctx, cancel := stdcontext.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(options.Method), url, strings.NewReader(options.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range options.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := v.readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]interface{}{}
+	for key := range resp.Header {
+		headers[key] = resp.Header.Get(key)
+	}
+
+	return map[string]interface{}{
+		"status":  resp.StatusCode,
+		"headers": headers,
+		"body":    string(body),
+	}, nil
+}
@@ -0,0 +1,397 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwtauth
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/jwks"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of JWTAuth.
+	Kind = "JWTAuth"
+
+	resultUnauthorized = "unauthorized"
+
+	bearerPrefix = "Bearer "
+)
+
+var results = []string{resultUnauthorized}
+
+func init() {
+	httppipeline.Register(&JWTAuth{})
+	secret.RegisterSensitiveFields("secret")
+}
+
+type (
+	// JWTAuth validates JWT tokens signed by static keys or keys from JWKS.
+	JWTAuth struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		secret    []byte
+		publicKey interface{}
+		jwks      *jwks.JWKS
+		clockSkew time.Duration
+	}
+
+	// Spec describes the JWTAuth.
+	Spec struct {
+		Algorithms []string `yaml:"algorithms" jsonschema:"required,uniqueItems=true"`
+		// Secret is in hex encoding, for HMAC algorithms.
+		Secret string `yaml:"secret" jsonschema:"omitempty,pattern=^[A-Fa-f0-9]*$"`
+		// PublicKey is in PEM encoding, for RSA and ECDSA algorithms.
+		PublicKey string     `yaml:"publicKey" jsonschema:"omitempty"`
+		JWKS      *jwks.Spec `yaml:"jwks,omitempty" jsonschema:"omitempty"`
+
+		Issuer    string   `yaml:"issuer" jsonschema:"omitempty"`
+		Audiences []string `yaml:"audiences" jsonschema:"omitempty,uniqueItems=true"`
+		ClockSkew string   `yaml:"clockSkew" jsonschema:"omitempty,format=duration"`
+
+		// CookieName specifies the name of a cookie, if the cookie exists
+		// and has a non-empty value, its value is used as the token, the
+		// Authorization header is used to get the token otherwise.
+		CookieName string `yaml:"cookieName" jsonschema:"omitempty"`
+		// Claims maps claims to request headers for following filters.
+		Claims map[string]string `yaml:"claims" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of JWTAuth.
+	Status struct {
+		JWKS *jwks.Status `yaml:"jwks,omitempty"`
+	}
+)
+
+var validAlgorithms = []string{
+	"HS256", "HS384", "HS512",
+	"RS256", "RS384", "RS512",
+	"ES256", "ES384", "ES512",
+}
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	hmac, asymmetric := false, false
+	for _, alg := range s.Algorithms {
+		if !stringtool.StrInSlice(alg, validAlgorithms) {
+			return fmt.Errorf("unsupported algorithm %s", alg)
+		}
+		if strings.HasPrefix(alg, "HS") {
+			hmac = true
+		} else {
+			asymmetric = true
+		}
+	}
+
+	if hmac && s.Secret == "" && s.JWKS == nil {
+		return fmt.Errorf("secret or jwks is required for HMAC algorithms")
+	}
+	if asymmetric && s.PublicKey == "" && s.JWKS == nil {
+		return fmt.Errorf("publicKey or jwks is required for RSA and ECDSA algorithms")
+	}
+
+	if s.PublicKey != "" {
+		if _, err := parsePublicKey([]byte(s.PublicKey)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parsePublicKey(pem []byte) (interface{}, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid publicKey: neither RSA nor ECDSA public key in PEM")
+}
+
+// Kind returns the kind of JWTAuth.
+func (ja *JWTAuth) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of JWTAuth.
+func (ja *JWTAuth) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of JWTAuth.
+func (ja *JWTAuth) Description() string {
+	return "JWTAuth validates JWT tokens signed by static keys or keys from JWKS."
+}
+
+// Results returns the results of JWTAuth.
+func (ja *JWTAuth) Results() []string {
+	return results
+}
+
+// DescribeAPI describes the bearer token, or the cookie carrying the
+// token if the cookie name is set.
+func (ja *JWTAuth) DescribeAPI(pipeSpec *httppipeline.FilterSpec) *httppipeline.APIDescription {
+	security := &httppipeline.APISecurity{
+		Type:         httppipeline.APISecurityHTTP,
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	}
+	if cookieName := pipeSpec.FilterSpec().(*Spec).CookieName; cookieName != "" {
+		security = &httppipeline.APISecurity{
+			Type:        httppipeline.APISecurityAPIKey,
+			In:          httppipeline.APIInCookie,
+			Name:        cookieName,
+			Description: "JWT in the cookie, or in the header Authorization as a bearer token",
+		}
+	}
+	return &httppipeline.APIDescription{Security: []*httppipeline.APISecurity{security}}
+}
+
+// Init initializes JWTAuth.
+func (ja *JWTAuth) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	ja.pipeSpec, ja.spec, ja.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	ja.reload()
+}
+
+// Inherit inherits previous generation of JWTAuth.
+func (ja *JWTAuth) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	ja.Init(pipeSpec, super)
+}
+
+func (ja *JWTAuth) reload() {
+	ja.secret, _ = hex.DecodeString(ja.spec.Secret)
+
+	if ja.spec.PublicKey != "" {
+		ja.publicKey, _ = parsePublicKey([]byte(ja.spec.PublicKey))
+	}
+
+	if ja.spec.ClockSkew != "" {
+		var err error
+		ja.clockSkew, err = time.ParseDuration(ja.spec.ClockSkew)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", ja.spec.ClockSkew, err)
+		}
+	}
+
+	if ja.spec.JWKS != nil {
+		ja.jwks = jwks.New(ja.spec.JWKS)
+	}
+}
+
+// Handle validates the JWT token of HTTPContext.
+func (ja *JWTAuth) Handle(ctx context.HTTPContext) string {
+	result := ja.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (ja *JWTAuth) handle(ctx context.HTTPContext) string {
+	claims, err := ja.validate(ctx.Request())
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("jwtauth: ", err.Error()))
+		w := ctx.Response()
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.SetStatusCode(http.StatusUnauthorized)
+		return resultUnauthorized
+	}
+
+	h := ctx.Request().Header()
+	for claim, header := range ja.spec.Claims {
+		// NOTE: Delete it first, so clients can't forge it.
+		h.Del(header)
+		if value, exists := claims[claim]; exists {
+			h.Set(header, claimString(value))
+		}
+	}
+
+	return ""
+}
+
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, item := range v {
+			s = append(s, claimString(item))
+		}
+		return strings.Join(s, ",")
+	default:
+		buff, _ := json.Marshal(v)
+		return string(buff)
+	}
+}
+
+func (ja *JWTAuth) token(req context.HTTPRequest) (string, error) {
+	if ja.spec.CookieName != "" {
+		if cookie, err := req.Cookie(ja.spec.CookieName); err == nil && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+	}
+
+	authHdr := req.Header().Get("Authorization")
+	if !strings.HasPrefix(authHdr, bearerPrefix) {
+		return "", fmt.Errorf("no bearer token")
+	}
+	return authHdr[len(bearerPrefix):], nil
+}
+
+func (ja *JWTAuth) validate(req context.HTTPRequest) (jwt.MapClaims, error) {
+	tokenStr, err := ja.token(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: Claims are validated by ourselves to support clock skew.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenStr, ja.key)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if err = ja.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (ja *JWTAuth) key(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if !stringtool.StrInSlice(alg, ja.spec.Algorithms) {
+		return nil, fmt.Errorf("unexpected signing method: %s", alg)
+	}
+
+	if strings.HasPrefix(alg, "HS") && len(ja.secret) > 0 {
+		return ja.secret, nil
+	}
+	if !strings.HasPrefix(alg, "HS") && ja.publicKey != nil {
+		return ja.publicKey, nil
+	}
+	if ja.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		return ja.jwks.Key(kid, alg)
+	}
+
+	return nil, fmt.Errorf("no key for signing method %s", alg)
+}
+
+func (ja *JWTAuth) validateClaims(claims jwt.MapClaims) error {
+	now := time.Now()
+
+	if exp, exists := claims["exp"]; exists {
+		t, ok := numericTime(exp)
+		if !ok {
+			return fmt.Errorf("invalid exp")
+		}
+		if now.After(t.Add(ja.clockSkew)) {
+			return fmt.Errorf("token is expired")
+		}
+	}
+
+	if nbf, exists := claims["nbf"]; exists {
+		t, ok := numericTime(nbf)
+		if !ok {
+			return fmt.Errorf("invalid nbf")
+		}
+		if now.Add(ja.clockSkew).Before(t) {
+			return fmt.Errorf("token is not valid yet")
+		}
+	}
+
+	if ja.spec.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != ja.spec.Issuer {
+			return fmt.Errorf("unexpected issuer %q", iss)
+		}
+	}
+
+	if len(ja.spec.Audiences) > 0 {
+		var auds []string
+		switch aud := claims["aud"].(type) {
+		case string:
+			auds = []string{aud}
+		case []interface{}:
+			for _, a := range aud {
+				if s, ok := a.(string); ok {
+					auds = append(auds, s)
+				}
+			}
+		}
+
+		found := false
+		for _, aud := range auds {
+			if stringtool.StrInSlice(aud, ja.spec.Audiences) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unexpected audience %v", auds)
+		}
+	}
+
+	return nil
+}
+
+func numericTime(v interface{}) (time.Time, bool) {
+	switch n := v.(type) {
+	case float64:
+		return time.Unix(int64(n), 0), true
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(i, 0), true
+	}
+	return time.Time{}, false
+}
+
+// Status returns status.
+func (ja *JWTAuth) Status() interface{} {
+	s := &Status{}
+	if ja.jwks != nil {
+		s.JWKS = ja.jwks.Status()
+	}
+	return s
+}
+
+// Close closes JWTAuth.
+func (ja *JWTAuth) Close() {
+	if ja.jwks != nil {
+		ja.jwks.Close()
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const tempDir = "/tmp/eg-test"
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(tempDir, "jwtauth-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "jwtauth-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+
+	os.Exit(code)
+}
+
+func newJWTAuth(t *testing.T, spec map[string]interface{}) *JWTAuth {
+	return filtertest.NewFilter(t, &JWTAuth{}, spec).(*JWTAuth)
+}
+
+func newContext(token string) context.HTTPContext {
+	r := filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", map[string]string{"X-User": "forged"})
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return filtertest.NewContext(r)
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token failed: %v", err)
+	}
+	return s
+}
+
+func TestHMAC(t *testing.T) {
+	secret := []byte("a secret for testing")
+	ja := newJWTAuth(t, map[string]interface{}{
+		"algorithms": []string{"HS256"},
+		"secret":     hex.EncodeToString(secret),
+		"issuer":     "megaease",
+		"audiences":  []string{"gateway"},
+		"clockSkew":  "1m",
+		"claims":     map[string]string{"sub": "X-User", "roles": "X-Roles"},
+	})
+	defer ja.Close()
+
+	now := time.Now()
+	valid := jwt.MapClaims{
+		"sub":   "alice",
+		"roles": []string{"admin", "dev"},
+		"iss":   "megaease",
+		"aud":   []string{"web", "gateway"},
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+
+	ctx := newContext(sign(t, jwt.SigningMethodHS256, "", secret, valid))
+	if result := ja.handle(ctx); result != "" {
+		t.Fatalf("valid token should pass, got %s", result)
+	}
+	h := ctx.Request().Header()
+	if h.Get("X-User") != "alice" || h.Get("X-Roles") != "admin,dev" {
+		t.Errorf("claims should be set to headers, got %s, %s", h.Get("X-User"), h.Get("X-Roles"))
+	}
+
+	// NOTE: It's expired within the clock skew.
+	claims := jwt.MapClaims{"iss": "megaease", "aud": "gateway", "exp": now.Add(-30 * time.Second).Unix()}
+	if result := ja.handle(newContext(sign(t, jwt.SigningMethodHS256, "", secret, claims))); result != "" {
+		t.Errorf("token within clock skew should pass, got %s", result)
+	}
+
+	cases := map[string]jwt.MapClaims{
+		"expired":      {"iss": "megaease", "aud": "gateway", "exp": now.Add(-time.Hour).Unix()},
+		"not valid":    {"iss": "megaease", "aud": "gateway", "nbf": now.Add(time.Hour).Unix()},
+		"wrong issuer": {"iss": "other", "aud": "gateway"},
+		"wrong aud":    {"iss": "megaease", "aud": "web"},
+	}
+	for name, claims := range cases {
+		ctx := newContext(sign(t, jwt.SigningMethodHS256, "", secret, claims))
+		if result := ja.handle(ctx); result != resultUnauthorized {
+			t.Errorf("%s: token should be unauthorized", name)
+		}
+		if ctx.Response().StatusCode() != http.StatusUnauthorized {
+			t.Errorf("%s: status code should be 401", name)
+		}
+	}
+
+	if result := ja.handle(newContext(sign(t, jwt.SigningMethodHS256, "", []byte("wrong"), valid))); result != resultUnauthorized {
+		t.Errorf("token with wrong signature should be unauthorized")
+	}
+	if result := ja.handle(newContext(sign(t, jwt.SigningMethodHS384, "", secret, valid))); result != resultUnauthorized {
+		t.Errorf("token with unexpected algorithm should be unauthorized")
+	}
+	if result := ja.handle(newContext("")); result != resultUnauthorized {
+		t.Errorf("request without token should be unauthorized")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	set := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "key-1", "use": "sig", "n": encode(key.N.Bytes()), "e": encode(big.NewInt(int64(key.E)).Bytes())},
+			{"kty": "unknown", "kid": "key-2"},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	ja := newJWTAuth(t, map[string]interface{}{
+		"algorithms": []string{"RS256"},
+		"jwks":       map[string]interface{}{"url": server.URL},
+	})
+	defer ja.Close()
+
+	claims := jwt.MapClaims{"sub": "alice"}
+	if result := ja.handle(newContext(sign(t, jwt.SigningMethodRS256, "key-1", key, claims))); result != "" {
+		t.Fatalf("token signed by key in jwks should pass, got %s", result)
+	}
+	if result := ja.handle(newContext(sign(t, jwt.SigningMethodRS256, "key-3", key, claims))); result != resultUnauthorized {
+		t.Errorf("token with unknown kid should be unauthorized")
+	}
+
+	if s := ja.Status().(*Status); s.JWKS == nil || s.JWKS.Keys != 1 {
+		t.Errorf("jwks should have 1 key, got %+v", s.JWKS)
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key failed: %v", err)
+	}
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	ja := newJWTAuth(t, map[string]interface{}{
+		"algorithms": []string{"ES256"},
+		"publicKey":  string(publicKey),
+	})
+	defer ja.Close()
+
+	if result := ja.handle(newContext(sign(t, jwt.SigningMethodES256, "", key, jwt.MapClaims{}))); result != "" {
+		t.Fatalf("token signed by the key should pass, got %s", result)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	cases := []map[string]interface{}{
+		{"algorithms": []string{"none"}, "secret": "00"},
+		{"algorithms": []string{"HS256"}},
+		{"algorithms": []string{"RS256"}, "secret": "00"},
+		{"algorithms": []string{"RS256"}, "publicKey": "invalid"},
+	}
+	for i, spec := range cases {
+		_, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{Name: "jwtauth", Kind: Kind}, spec)
+		if err == nil {
+			t.Errorf("case %d: spec should be invalid", i)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package keyedratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultSyncInterval = time.Second
+
+	// reports older than staleIntervals sync intervals are ignored.
+	staleIntervals = 3
+)
+
+type (
+	// ClusterSpec describes how to share quotas across members of the cluster.
+	ClusterSpec struct {
+		Name         string `yaml:"name" jsonschema:"required,format=urlname"`
+		SyncInterval string `yaml:"syncInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// clusterSyncer shares the admitted rates of keys across members.
+	//
+	// Every member decides on its local buckets, so the hot path never
+	// touches the cluster. The member reports the rates it admitted in
+	// the last interval, and resizes its buckets to what the other members
+	// leave of the global quota, but not less than an even share of it.
+	clusterSyncer struct {
+		krl      *KeyedRateLimiter
+		cls      cluster.Cluster
+		spec     *ClusterSpec
+		interval time.Duration
+		done     chan struct{}
+
+		mutex    sync.Mutex
+		admitted map[string]int
+		others   map[string]float64
+		members  int
+	}
+
+	// memberReport is the report of a member stored in the cluster.
+	memberReport struct {
+		Time  time.Time          `yaml:"time"`
+		Rates map[string]float64 `yaml:"rates"`
+	}
+)
+
+func parseDuration(d string, dflt time.Duration) time.Duration {
+	if d == "" {
+		return dflt
+	}
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return dflt
+	}
+	return duration
+}
+
+func newClusterSyncer(krl *KeyedRateLimiter, cls cluster.Cluster, spec *ClusterSpec) *clusterSyncer {
+	cs := &clusterSyncer{
+		krl:      krl,
+		cls:      cls,
+		spec:     spec,
+		interval: parseDuration(spec.SyncInterval, defaultSyncInterval),
+		done:     make(chan struct{}),
+		admitted: map[string]int{},
+		others:   map[string]float64{},
+		members:  1,
+	}
+
+	go cs.run()
+
+	return cs
+}
+
+func (cs *clusterSyncer) run() {
+	ticker := time.NewTicker(cs.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cs.done:
+			return
+		case <-ticker.C:
+			cs.sync()
+		}
+	}
+}
+
+// admit records an admitted request of the key.
+func (cs *clusterSyncer) admit(key string) {
+	cs.mutex.Lock()
+	cs.admitted[key]++
+	cs.mutex.Unlock()
+}
+
+// allowance returns the local rate and burst of the key from the global ones.
+func (cs *clusterSyncer) allowance(key string, rps float64, b int) (float64, int) {
+	cs.mutex.Lock()
+	others, members := cs.others[key], cs.members
+	cs.mutex.Unlock()
+
+	if others == 0 || rps == 0 {
+		return rps, b
+	}
+
+	limit := math.Max(rps-others, rps/float64(members))
+	b = int(math.Ceil(float64(b) * limit / rps))
+	if b < 1 {
+		b = 1
+	}
+
+	return limit, b
+}
+
+func (cs *clusterSyncer) sync() {
+	cs.mutex.Lock()
+	admitted := cs.admitted
+	cs.admitted = map[string]int{}
+	cs.mutex.Unlock()
+
+	report := &memberReport{
+		Time:  time.Now(),
+		Rates: make(map[string]float64, len(admitted)),
+	}
+	for key, count := range admitted {
+		report.Rates[key] = float64(count) / cs.interval.Seconds()
+	}
+
+	buff, err := yaml.Marshal(report)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to yaml failed: %v", report, err)
+		return
+	}
+
+	layout := cs.cls.Layout()
+	selfKey := layout.StatusRateLimiterKey(cs.spec.Name)
+	err = cs.cls.PutUnderLease(selfKey, string(buff))
+	if err != nil {
+		logger.Errorf("put rate limiter report %s failed: %v", selfKey, err)
+	}
+
+	kvs, err := cs.cls.GetPrefix(layout.StatusRateLimiterPrefix(cs.spec.Name))
+	if err != nil {
+		logger.Errorf("get rate limiter reports of %s failed: %v", cs.spec.Name, err)
+		return
+	}
+
+	others, members := cs.aggregate(selfKey, kvs, report.Time)
+
+	cs.mutex.Lock()
+	cs.others, cs.members = others, members
+	cs.mutex.Unlock()
+
+	cs.krl.resize()
+}
+
+// aggregate sums the rates of keys reported by other alive members.
+func (cs *clusterSyncer) aggregate(selfKey string, kvs map[string]string, now time.Time) (map[string]float64, int) {
+	others, members := map[string]float64{}, 1
+	for k, v := range kvs {
+		if k == selfKey {
+			continue
+		}
+
+		report := &memberReport{}
+		err := yaml.Unmarshal([]byte(v), report)
+		if err != nil {
+			logger.Errorf("unmarshal rate limiter report %s failed: %v", k, err)
+			continue
+		}
+
+		if now.Sub(report.Time) > staleIntervals*cs.interval {
+			continue
+		}
+
+		members++
+		for key, rate := range report.Rates {
+			others[key] += rate
+		}
+	}
+
+	return others, members
+}
+
+func (cs *clusterSyncer) close() {
+	close(cs.done)
+
+	key := cs.cls.Layout().StatusRateLimiterKey(cs.spec.Name)
+	err := cs.cls.Delete(key)
+	if err != nil {
+		logger.Errorf("delete rate limiter report %s failed: %v", key, err)
+	}
+}
+
+func (cs *clusterSyncer) memberCount() int {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.members
+}
+
+// setLimit sets the rate and burst of the limiter if they changed.
+func setLimit(limiter *rate.Limiter, limit rate.Limit, b int) {
+	if limiter.Limit() != limit {
+		limiter.SetLimit(limit)
+	}
+	if limiter.Burst() != b {
+		limiter.SetBurst(b)
+	}
+}
@@ -0,0 +1,336 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package keyedratelimiter
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/time/rate"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of KeyedRateLimiter.
+	Kind = "KeyedRateLimiter"
+
+	resultRateLimited = "rateLimited"
+
+	sourceHeader = "header"
+	sourceQuery  = "query"
+	sourceCookie = "cookie"
+	sourceRealIP = "realIP"
+	sourcePath   = "path"
+	sourceMethod = "method"
+
+	defaultMaxKeys = 100000
+)
+
+var (
+	results = []string{resultRateLimited}
+)
+
+func init() {
+	httppipeline.Register(&KeyedRateLimiter{})
+}
+
+type (
+	// KeyedRateLimiter is the filter limiting the rate of requests by token
+	// buckets, every key has its own bucket.
+	KeyedRateLimiter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		buckets   *lru.Cache
+		overrides map[string]*Override
+		syncer    *clusterSyncer
+	}
+
+	// Spec describes the KeyedRateLimiter.
+	Spec struct {
+		RequestsPerSecond float64      `yaml:"requestsPerSecond" jsonschema:"required,exclusiveMinimum=0"`
+		Burst             int          `yaml:"burst" jsonschema:"omitempty,minimum=1"`
+		Key               []*KeyPart   `yaml:"key" jsonschema:"omitempty"`
+		Overrides         []*Override  `yaml:"overrides" jsonschema:"omitempty"`
+		MaxKeys           int          `yaml:"maxKeys" jsonschema:"omitempty,minimum=1"`
+		Cluster           *ClusterSpec `yaml:"cluster" jsonschema:"omitempty"`
+	}
+
+	// KeyPart is a part of the key of buckets.
+	KeyPart struct {
+		Source string `yaml:"source" jsonschema:"required,enum=header,enum=query,enum=cookie,enum=realIP,enum=path,enum=method"`
+		Name   string `yaml:"name" jsonschema:"omitempty"`
+	}
+
+	// Override overrides the rate and burst of a key.
+	Override struct {
+		Key               string  `yaml:"key" jsonschema:"required"`
+		RequestsPerSecond float64 `yaml:"requestsPerSecond" jsonschema:"required,minimum=0"`
+		Burst             int     `yaml:"burst" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of KeyedRateLimiter.
+	Status struct {
+		Keys    int `yaml:"keys"`
+		Members int `yaml:"members,omitempty"`
+	}
+)
+
+// Validate validates KeyPart.
+func (kp KeyPart) Validate() error {
+	switch kp.Source {
+	case sourceHeader, sourceQuery, sourceCookie:
+		if kp.Name == "" {
+			return fmt.Errorf("name of source %s is empty", kp.Source)
+		}
+	}
+
+	return nil
+}
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	keys := map[string]struct{}{}
+	for _, o := range s.Overrides {
+		if _, exists := keys[o.Key]; exists {
+			return fmt.Errorf("repeated override key: %s", o.Key)
+		}
+		keys[o.Key] = struct{}{}
+	}
+
+	return nil
+}
+
+// burst returns the burst, which is the ceiling of the rate by default.
+func burst(rps float64, b int) int {
+	if b > 0 {
+		return b
+	}
+	if rps < 1 {
+		return 1
+	}
+	return int(math.Ceil(rps))
+}
+
+// Kind returns the kind of KeyedRateLimiter.
+func (krl *KeyedRateLimiter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of KeyedRateLimiter.
+func (krl *KeyedRateLimiter) DefaultSpec() interface{} {
+	return &Spec{
+		MaxKeys: defaultMaxKeys,
+	}
+}
+
+// Description returns the description of KeyedRateLimiter.
+func (krl *KeyedRateLimiter) Description() string {
+	return "KeyedRateLimiter limits the rate of requests by token buckets per key."
+}
+
+// Results returns the results of KeyedRateLimiter.
+func (krl *KeyedRateLimiter) Results() []string {
+	return results
+}
+
+// Produces returns nil, KeyedRateLimiter sets no header.
+func (krl *KeyedRateLimiter) Produces(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	return nil
+}
+
+// Consumes returns the headers in the key of KeyedRateLimiter.
+func (krl *KeyedRateLimiter) Consumes(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	var values []*httppipeline.Value
+	for _, kp := range pipeSpec.FilterSpec().(*Spec).Key {
+		if kp.Source == sourceHeader {
+			values = append(values, &httppipeline.Value{Header: kp.Name, Type: httppipeline.ValueString})
+		}
+	}
+	return values
+}
+
+// Init initializes KeyedRateLimiter.
+func (krl *KeyedRateLimiter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	krl.pipeSpec, krl.spec, krl.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	krl.reload()
+}
+
+// Inherit inherits previous generation of KeyedRateLimiter.
+func (krl *KeyedRateLimiter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	krl.Init(pipeSpec, super)
+}
+
+func (krl *KeyedRateLimiter) reload() {
+	if len(krl.spec.Key) == 0 {
+		krl.spec.Key = []*KeyPart{{Source: sourceRealIP}}
+	}
+
+	krl.overrides = map[string]*Override{}
+	for _, o := range krl.spec.Overrides {
+		krl.overrides[o.Key] = o
+	}
+
+	var err error
+	krl.buckets, err = lru.New(krl.spec.MaxKeys)
+	if err != nil {
+		logger.Errorf("BUG: new lru cache failed: %v", err)
+	}
+
+	if krl.spec.Cluster != nil {
+		krl.syncer = newClusterSyncer(krl, krl.super.Cluster(), krl.spec.Cluster)
+	}
+}
+
+// Handle limits the rate of HTTPContext.
+func (krl *KeyedRateLimiter) Handle(ctx context.HTTPContext) string {
+	result := krl.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (krl *KeyedRateLimiter) handle(ctx context.HTTPContext) string {
+	key := krl.key(ctx)
+
+	r := krl.bucket(key).Reserve()
+	if !r.OK() {
+		// NOTE: It happens only if the rate of the key is overridden to 0.
+		ctx.Response().SetStatusCode(http.StatusTooManyRequests)
+		ctx.AddTag(stringtool.Cat("keyedRateLimiter: key ", key, " is blocked"))
+		return resultRateLimited
+	}
+
+	delay := r.Delay()
+	if delay == 0 {
+		if krl.syncer != nil {
+			krl.syncer.admit(key)
+		}
+		return ""
+	}
+	r.Cancel()
+
+	w := ctx.Response()
+	w.SetStatusCode(http.StatusTooManyRequests)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	ctx.AddTag(stringtool.Cat("keyedRateLimiter: key ", key, " is rate limited"))
+
+	return resultRateLimited
+}
+
+func (krl *KeyedRateLimiter) key(ctx context.HTTPContext) string {
+	r := ctx.Request()
+
+	parts := make([]string, 0, len(krl.spec.Key))
+	for _, kp := range krl.spec.Key {
+		var part string
+		switch kp.Source {
+		case sourceHeader:
+			part = r.Header().Get(kp.Name)
+		case sourceQuery:
+			part = r.Std().URL.Query().Get(kp.Name)
+		case sourceCookie:
+			if cookie, err := r.Cookie(kp.Name); err == nil {
+				part = cookie.Value
+			}
+		case sourceRealIP:
+			part = r.RealIP()
+		case sourcePath:
+			part = r.Path()
+		case sourceMethod:
+			part = r.Method()
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, ":")
+}
+
+func (krl *KeyedRateLimiter) bucket(key string) *rate.Limiter {
+	if v, ok := krl.buckets.Get(key); ok {
+		return v.(*rate.Limiter)
+	}
+
+	limiter := rate.NewLimiter(krl.limit(key))
+
+	// NOTE: Another goroutine may have added the bucket of the key.
+	if exists, _ := krl.buckets.ContainsOrAdd(key, limiter); exists {
+		if v, ok := krl.buckets.Get(key); ok {
+			return v.(*rate.Limiter)
+		}
+	}
+
+	return limiter
+}
+
+// limit returns the rate and burst of the bucket of the key.
+func (krl *KeyedRateLimiter) limit(key string) (rate.Limit, int) {
+	rps, b := krl.spec.RequestsPerSecond, krl.spec.Burst
+	if o, exists := krl.overrides[key]; exists {
+		rps, b = o.RequestsPerSecond, o.Burst
+	}
+
+	if rps == 0 {
+		return 0, 0
+	}
+
+	b = burst(rps, b)
+	if krl.syncer != nil {
+		rps, b = krl.syncer.allowance(key, rps, b)
+	}
+
+	return rate.Limit(rps), b
+}
+
+// resize resizes all buckets, it is called after syncing with the cluster.
+func (krl *KeyedRateLimiter) resize() {
+	for _, k := range krl.buckets.Keys() {
+		v, ok := krl.buckets.Peek(k)
+		if !ok {
+			continue
+		}
+		limit, b := krl.limit(k.(string))
+		setLimit(v.(*rate.Limiter), limit, b)
+	}
+}
+
+// Status returns status.
+func (krl *KeyedRateLimiter) Status() interface{} {
+	s := &Status{Keys: krl.buckets.Len()}
+	if krl.syncer != nil {
+		s.Members = krl.syncer.memberCount()
+	}
+	return s
+}
+
+// Close closes KeyedRateLimiter.
+func (krl *KeyedRateLimiter) Close() {
+	if krl.syncer != nil {
+		krl.syncer.close()
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package keyedratelimiter
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+func newKeyedRateLimiter(t *testing.T, spec map[string]interface{}) *KeyedRateLimiter {
+	return filtertest.NewFilter(t, &KeyedRateLimiter{}, spec).(*KeyedRateLimiter)
+}
+
+func newContext(apiKey string) context.HTTPContext {
+	return filtertest.NewContext(filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/orders", "",
+		map[string]string{"X-Api-Key": apiKey}))
+}
+
+func TestKeyedRateLimiter(t *testing.T) {
+	krl := newKeyedRateLimiter(t, map[string]interface{}{
+		"requestsPerSecond": 1,
+		"burst":             2,
+		"key": []map[string]interface{}{
+			{"source": "header", "name": "X-Api-Key"},
+		},
+		"overrides": []map[string]interface{}{
+			{"key": "blocked", "requestsPerSecond": 0},
+			{"key": "premium", "requestsPerSecond": 100, "burst": 10},
+		},
+	})
+
+	cases := []struct {
+		key     string
+		allowed int
+	}{
+		{key: "normal", allowed: 2},
+		{key: "another", allowed: 2},
+		{key: "blocked", allowed: 0},
+		{key: "premium", allowed: 10},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < c.allowed; i++ {
+			if result := krl.Handle(newContext(c.key)); result != "" {
+				t.Errorf("key %s: request %d should be allowed, got result %q", c.key, i, result)
+			}
+		}
+
+		ctx := newContext(c.key)
+		if result := krl.Handle(ctx); result != resultRateLimited {
+			t.Errorf("key %s: request %d should be rate limited, got result %q", c.key, c.allowed, result)
+		}
+		if code := ctx.Response().StatusCode(); code != http.StatusTooManyRequests {
+			t.Errorf("key %s: status code should be %d, got %d", c.key, http.StatusTooManyRequests, code)
+		}
+	}
+
+	ctx := newContext("normal")
+	krl.Handle(ctx)
+	if retryAfter := ctx.Response().Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("Retry-After should be 1, got %q", retryAfter)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	_, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+		Name: "krl",
+		Kind: Kind,
+	}, map[string]interface{}{
+		"requestsPerSecond": 1,
+		"key": []map[string]interface{}{
+			{"source": "header"},
+		},
+	})
+	if err == nil {
+		t.Errorf("header key part without name should be invalid")
+	}
+
+	_, err = httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+		Name: "krl",
+		Kind: Kind,
+	}, map[string]interface{}{
+		"requestsPerSecond": 1,
+		"overrides": []map[string]interface{}{
+			{"key": "a", "requestsPerSecond": 1},
+			{"key": "a", "requestsPerSecond": 2},
+		},
+	})
+	if err == nil {
+		t.Errorf("repeated override keys should be invalid")
+	}
+}
+
+func TestClusterAllowance(t *testing.T) {
+	now := time.Now()
+	cs := &clusterSyncer{
+		spec:     &ClusterSpec{Name: "quota"},
+		interval: time.Second,
+	}
+
+	kvs := map[string]string{
+		"/status/ratelimiters/quota/self": "",
+		"/status/ratelimiters/quota/m1":   fmt.Sprintf("time: %s\nrates:\n  a: 60\n  b: 2\n", now.Format(time.RFC3339Nano)),
+		"/status/ratelimiters/quota/m2":   fmt.Sprintf("time: %s\nrates:\n  a: 30\n", now.Format(time.RFC3339Nano)),
+		"/status/ratelimiters/quota/m3":   fmt.Sprintf("time: %s\nrates:\n  a: 1000\n", now.Add(-time.Minute).Format(time.RFC3339Nano)),
+	}
+	cs.others, cs.members = cs.aggregate("/status/ratelimiters/quota/self", kvs, now)
+
+	if cs.members != 3 {
+		t.Errorf("members should be 3, got %d", cs.members)
+	}
+
+	cases := []struct {
+		key   string
+		rps   float64
+		burst int
+		limit float64
+		b     int
+	}{
+		{key: "a", rps: 100, burst: 100, limit: 100.0 / 3, b: 34},
+		{key: "b", rps: 100, burst: 100, limit: 98, b: 98},
+		{key: "c", rps: 100, burst: 100, limit: 100, b: 100},
+		{key: "a", rps: 0, burst: 0, limit: 0, b: 0},
+	}
+
+	for _, c := range cases {
+		limit, b := cs.allowance(c.key, c.rps, c.burst)
+		if limit != c.limit || b != c.b {
+			t.Errorf("key %s: allowance should be %v/%d, got %v/%d", c.key, c.limit, c.b, limit, b)
+		}
+	}
+}
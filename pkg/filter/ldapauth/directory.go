@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ldapauth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+type (
+	// directory authenticates users and looks up their groups.
+	directory interface {
+		authenticate(user, password string) (*identity, error)
+		close()
+	}
+
+	identity struct {
+		dn     string
+		groups []string
+	}
+
+	// ldapDirectory is the directory backed by an LDAP server, connections
+	// bound by the service account are pooled.
+	ldapDirectory struct {
+		spec      *Spec
+		timeout   time.Duration
+		tlsConfig *tls.Config
+		pool      chan *ldap.Conn
+	}
+)
+
+func newLDAPDirectory(spec *Spec, timeout time.Duration) *ldapDirectory {
+	serverName := ""
+	if i := strings.Index(spec.URL, "://"); i >= 0 {
+		host := spec.URL[i+3:]
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		serverName = host
+	}
+
+	return &ldapDirectory{
+		spec:    spec,
+		timeout: timeout,
+		tlsConfig: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: spec.InsecureTLS,
+		},
+		pool: make(chan *ldap.Conn, spec.PoolSize),
+	}
+}
+
+func (d *ldapDirectory) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(d.spec.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: d.timeout}),
+		ldap.DialWithTLSConfig(d.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("dial %s failed: %v", d.spec.URL, err)
+	}
+	conn.SetTimeout(d.timeout)
+
+	if d.spec.StartTLS {
+		if err := conn.StartTLS(d.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls failed: %v", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// bindService binds the connection by the service account, or keeps it
+// anonymous if there's no service account.
+func (d *ldapDirectory) bindService(conn *ldap.Conn) error {
+	if d.spec.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(d.spec.BindDN, d.spec.BindPassword); err != nil {
+		return fmt.Errorf("bind %s failed: %v", d.spec.BindDN, err)
+	}
+	return nil
+}
+
+func (d *ldapDirectory) get() (*ldap.Conn, error) {
+	select {
+	case conn := <-d.pool:
+		if !conn.IsClosing() {
+			return conn, nil
+		}
+	default:
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.bindService(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *ldapDirectory) put(conn *ldap.Conn) {
+	if conn.IsClosing() {
+		return
+	}
+	select {
+	case d.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (d *ldapDirectory) authenticate(user, password string) (*identity, error) {
+	// NOTE: An LDAP bind with an empty password is an unauthenticated bind,
+	// which succeeds without checking anything.
+	if password == "" {
+		return nil, errInvalidCredentials
+	}
+
+	conn, err := d.get()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := d.authenticateOn(conn, user, password)
+	if err != nil && !errors.Is(err, errInvalidCredentials) {
+		conn.Close()
+		return nil, err
+	}
+
+	// Rebind by the service account before putting it back, so the pooled
+	// connections are never bound by users.
+	if err := d.bindService(conn); err != nil {
+		conn.Close()
+	} else {
+		d.put(conn)
+	}
+
+	return id, err
+}
+
+func (d *ldapDirectory) authenticateOn(conn *ldap.Conn, user, password string) (*identity, error) {
+	dn, err := d.userDN(conn, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Bind(dn, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bind %s failed: %v", dn, err)
+	}
+
+	id := &identity{dn: dn}
+	if d.spec.GroupFilter != "" {
+		id.groups, err = d.groups(conn, dn, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return id, nil
+}
+
+// userDN returns the DN of the user, from the template or by searching.
+func (d *ldapDirectory) userDN(conn *ldap.Conn, user string) (string, error) {
+	if d.spec.UserDN != "" {
+		return strings.ReplaceAll(d.spec.UserDN, "{user}", escapeDN(user)), nil
+	}
+
+	filter := strings.ReplaceAll(d.spec.UserFilter, "{user}", ldap.EscapeFilter(user))
+	req := ldap.NewSearchRequest(d.spec.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(d.timeout.Seconds()), false, filter, []string{"dn"}, nil)
+	result, err := conn.Search(req)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return "", fmt.Errorf("search user %s failed: %v", user, err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		// NOTE: Unknown or ambiguous users are treated as invalid
+		// credentials, so clients can't tell which users exist.
+		return "", errInvalidCredentials
+	}
+
+	return result.Entries[0].DN, nil
+}
+
+func (d *ldapDirectory) groups(conn *ldap.Conn, dn, user string) ([]string, error) {
+	filter := strings.ReplaceAll(d.spec.GroupFilter, "{dn}", ldap.EscapeFilter(dn))
+	filter = strings.ReplaceAll(filter, "{user}", ldap.EscapeFilter(user))
+
+	baseDN := d.spec.GroupBaseDN
+	if baseDN == "" {
+		baseDN = d.spec.BaseDN
+	}
+
+	req := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(d.timeout.Seconds()), false, filter, []string{d.spec.GroupAttribute}, nil)
+	result, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("search groups of %s failed: %v", dn, err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		if name := entry.GetAttributeValue(d.spec.GroupAttribute); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+func (d *ldapDirectory) close() {
+	for {
+		select {
+		case conn := <-d.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// escapeDN escapes an attribute value in a DN, see RFC 4514.
+func escapeDN(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			c == '#' && i == 0,
+			c == ' ' && (i == 0 || i == len(value)-1):
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == 0:
+			sb.WriteString(`\00`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
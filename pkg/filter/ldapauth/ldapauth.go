@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ldapauth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of LDAPAuth.
+	Kind = "LDAPAuth"
+
+	resultUnauthorized = "unauthorized"
+	resultForbidden    = "forbidden"
+	resultUnavailable  = "unavailable"
+
+	defaultTimeout          = 5 * time.Second
+	defaultCacheTTL         = 5 * time.Minute
+	defaultNegativeCacheTTL = 30 * time.Second
+)
+
+var results = []string{resultUnauthorized, resultForbidden, resultUnavailable}
+
+func init() {
+	httppipeline.Register(&LDAPAuth{})
+	secret.RegisterSensitiveFields("bindPassword")
+}
+
+type (
+	// LDAPAuth authenticates basic auth credentials against LDAP or
+	// Active Directory.
+	LDAPAuth struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		directory        directory
+		cache            *lru.Cache
+		cacheTTL         time.Duration
+		negativeCacheTTL time.Duration
+	}
+
+	// Spec describes the LDAPAuth.
+	Spec struct {
+		// URL is the URL of the LDAP server, e.g. ldap://ldap.example.com:389
+		// or ldaps://ldap.example.com:636.
+		URL         string `yaml:"url" jsonschema:"required,format=uri"`
+		StartTLS    bool   `yaml:"startTLS" jsonschema:"omitempty"`
+		InsecureTLS bool   `yaml:"insecureTLS" jsonschema:"omitempty"`
+		Timeout     string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		PoolSize    int    `yaml:"poolSize" jsonschema:"omitempty,minimum=1"`
+
+		// BindDN and BindPassword are the service account to search users
+		// and groups, searches are anonymous if they are empty.
+		BindDN       string `yaml:"bindDN" jsonschema:"omitempty"`
+		BindPassword string `yaml:"bindPassword" jsonschema:"omitempty"`
+
+		// UserDN is the template of the DN of users, e.g.
+		// uid={user},ou=people,dc=example,dc=com, users are searched by
+		// UserFilter under BaseDN if it is empty.
+		UserDN     string `yaml:"userDN" jsonschema:"omitempty"`
+		BaseDN     string `yaml:"baseDN" jsonschema:"omitempty"`
+		UserFilter string `yaml:"userFilter" jsonschema:"omitempty"`
+
+		// GroupFilter is the filter to search groups of the user, {dn} and
+		// {user} are replaced, e.g. (&(objectClass=groupOfNames)(member={dn})).
+		GroupBaseDN    string   `yaml:"groupBaseDN" jsonschema:"omitempty"`
+		GroupFilter    string   `yaml:"groupFilter" jsonschema:"omitempty"`
+		GroupAttribute string   `yaml:"groupAttribute" jsonschema:"omitempty"`
+		RequiredGroups []string `yaml:"requiredGroups" jsonschema:"omitempty,uniqueItems=true"`
+
+		CacheSize        int    `yaml:"cacheSize" jsonschema:"omitempty,minimum=0"`
+		CacheTTL         string `yaml:"cacheTTL" jsonschema:"omitempty,format=duration"`
+		NegativeCacheTTL string `yaml:"negativeCacheTTL" jsonschema:"omitempty,format=duration"`
+
+		Realm        string `yaml:"realm" jsonschema:"omitempty"`
+		UserHeader   string `yaml:"userHeader" jsonschema:"omitempty"`
+		GroupsHeader string `yaml:"groupsHeader" jsonschema:"omitempty"`
+	}
+
+	cacheEntry struct {
+		// identity is nil for invalid credentials.
+		identity  *identity
+		expiresAt time.Time
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.UserDN == "" && (s.BaseDN == "" || s.UserFilter == "") {
+		return fmt.Errorf("either userDN or both baseDN and userFilter are required")
+	}
+	if s.UserDN != "" && !strings.Contains(s.UserDN, "{user}") {
+		return fmt.Errorf("userDN must contain {user}")
+	}
+	if s.UserFilter != "" && !strings.Contains(s.UserFilter, "{user}") {
+		return fmt.Errorf("userFilter must contain {user}")
+	}
+	if len(s.RequiredGroups) > 0 && s.GroupFilter == "" {
+		return fmt.Errorf("groupFilter is required for requiredGroups")
+	}
+	if s.GroupFilter != "" && s.GroupBaseDN == "" && s.BaseDN == "" {
+		return fmt.Errorf("groupBaseDN or baseDN is required for groupFilter")
+	}
+	return nil
+}
+
+// Kind returns the kind of LDAPAuth.
+func (la *LDAPAuth) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of LDAPAuth.
+func (la *LDAPAuth) DefaultSpec() interface{} {
+	return &Spec{
+		PoolSize:       10,
+		GroupAttribute: "cn",
+		CacheSize:      1000,
+		Realm:          "Restricted",
+		UserHeader:     "X-Auth-User",
+		GroupsHeader:   "X-Auth-Groups",
+	}
+}
+
+// Description returns the description of LDAPAuth.
+func (la *LDAPAuth) Description() string {
+	return "LDAPAuth authenticates basic auth credentials against LDAP or Active Directory."
+}
+
+// Results returns the results of LDAPAuth.
+func (la *LDAPAuth) Results() []string {
+	return results
+}
+
+// Produces returns the headers set by LDAPAuth, the groups are separated
+// by commas.
+func (la *LDAPAuth) Produces(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	spec := pipeSpec.FilterSpec().(*Spec)
+	var values []*httppipeline.Value
+	if spec.UserHeader != "" {
+		values = append(values, &httppipeline.Value{Header: spec.UserHeader, Type: httppipeline.ValueString})
+	}
+	if spec.GroupsHeader != "" {
+		values = append(values, &httppipeline.Value{Header: spec.GroupsHeader, Type: httppipeline.ValueList})
+	}
+	return values
+}
+
+// Consumes returns nil, LDAPAuth reads no header set by other filters.
+func (la *LDAPAuth) Consumes(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value { return nil }
+
+// Init initializes LDAPAuth.
+func (la *LDAPAuth) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	la.pipeSpec, la.spec, la.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	la.reload()
+}
+
+// Inherit inherits previous generation of LDAPAuth.
+func (la *LDAPAuth) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	la.Init(pipeSpec, super)
+}
+
+func parseDuration(d string, dflt time.Duration) time.Duration {
+	if d == "" {
+		return dflt
+	}
+	v, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return dflt
+	}
+	return v
+}
+
+func (la *LDAPAuth) reload() {
+	la.cacheTTL = parseDuration(la.spec.CacheTTL, defaultCacheTTL)
+	la.negativeCacheTTL = parseDuration(la.spec.NegativeCacheTTL, defaultNegativeCacheTTL)
+
+	if la.spec.CacheSize > 0 {
+		var err error
+		la.cache, err = lru.New(la.spec.CacheSize)
+		if err != nil {
+			logger.Errorf("BUG: new lru cache failed: %v", err)
+		}
+	}
+
+	la.directory = newLDAPDirectory(la.spec, parseDuration(la.spec.Timeout, defaultTimeout))
+}
+
+// Handle authenticates HTTPContext.
+func (la *LDAPAuth) Handle(ctx context.HTTPContext) string {
+	result := la.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (la *LDAPAuth) handle(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	user, password, ok := r.Std().BasicAuth()
+	if !ok {
+		return la.unauthorized(ctx, "missing credentials")
+	}
+
+	id, err := la.authenticate(user, password)
+	if errors.Is(err, errInvalidCredentials) {
+		return la.unauthorized(ctx, stringtool.Cat("invalid credentials of ", user))
+	}
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("ldapauth: ", err.Error()))
+		w.SetStatusCode(http.StatusServiceUnavailable)
+		return resultUnavailable
+	}
+
+	if len(la.spec.RequiredGroups) > 0 && !inAnyGroup(id.groups, la.spec.RequiredGroups) {
+		ctx.AddTag(stringtool.Cat("ldapauth: ", user, " is not in required groups"))
+		w.SetStatusCode(http.StatusForbidden)
+		return resultForbidden
+	}
+
+	h := r.Header()
+	if la.spec.UserHeader != "" {
+		h.Set(la.spec.UserHeader, user)
+	}
+	if la.spec.GroupsHeader != "" {
+		// NOTE: Delete it first, so clients can't forge it.
+		h.Del(la.spec.GroupsHeader)
+		if len(id.groups) > 0 {
+			h.Set(la.spec.GroupsHeader, strings.Join(id.groups, ","))
+		}
+	}
+
+	return ""
+}
+
+func (la *LDAPAuth) unauthorized(ctx context.HTTPContext, msg string) string {
+	ctx.AddTag(stringtool.Cat("ldapauth: ", msg))
+	w := ctx.Response()
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, la.spec.Realm))
+	w.SetStatusCode(http.StatusUnauthorized)
+	return resultUnauthorized
+}
+
+// authenticate authenticates the credentials, both valid and invalid
+// credentials are cached, but errors of the directory are not.
+func (la *LDAPAuth) authenticate(user, password string) (*identity, error) {
+	var key [sha256.Size]byte
+	if la.cache != nil {
+		key = sha256.Sum256([]byte(user + ":" + password))
+		if v, exists := la.cache.Get(key); exists {
+			entry := v.(*cacheEntry)
+			if time.Now().Before(entry.expiresAt) {
+				if entry.identity == nil {
+					return nil, errInvalidCredentials
+				}
+				return entry.identity, nil
+			}
+			la.cache.Remove(key)
+		}
+	}
+
+	id, err := la.directory.authenticate(user, password)
+	if la.cache == nil {
+		return id, err
+	}
+
+	switch {
+	case err == nil:
+		la.cache.Add(key, &cacheEntry{identity: id, expiresAt: time.Now().Add(la.cacheTTL)})
+	case errors.Is(err, errInvalidCredentials) && la.negativeCacheTTL > 0:
+		la.cache.Add(key, &cacheEntry{expiresAt: time.Now().Add(la.negativeCacheTTL)})
+	}
+
+	return id, err
+}
+
+func inAnyGroup(groups, required []string) bool {
+	for _, g := range groups {
+		if stringtool.StrInSlice(g, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns status.
+func (la *LDAPAuth) Status() interface{} {
+	return nil
+}
+
+// Close closes LDAPAuth.
+func (la *LDAPAuth) Close() {
+	la.directory.close()
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ldapauth
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+type fakeDirectory struct {
+	users  map[string]string
+	groups map[string][]string
+	down   bool
+	calls  int
+}
+
+func (d *fakeDirectory) authenticate(user, password string) (*identity, error) {
+	d.calls++
+	if d.down {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if p, exists := d.users[user]; !exists || p != password {
+		return nil, errInvalidCredentials
+	}
+	return &identity{dn: "uid=" + user, groups: d.groups[user]}, nil
+}
+
+func (d *fakeDirectory) close() {}
+
+func newLDAPAuth(t *testing.T, spec map[string]interface{}) *LDAPAuth {
+	return filtertest.NewFilter(t, &LDAPAuth{}, spec).(*LDAPAuth)
+}
+
+func newContext(user, password string) context.HTTPContext {
+	r := filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", map[string]string{"X-Auth-Groups": "forged"})
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+	return filtertest.NewContext(r)
+}
+
+func TestHandle(t *testing.T) {
+	la := newLDAPAuth(t, map[string]interface{}{
+		"url":            "ldap://127.0.0.1:389",
+		"baseDN":         "dc=example,dc=com",
+		"userFilter":     "(uid={user})",
+		"groupFilter":    "(member={dn})",
+		"requiredGroups": []string{"admins", "ops"},
+	})
+	d := &fakeDirectory{
+		users:  map[string]string{"alice": "alice-pw", "bob": "bob-pw"},
+		groups: map[string][]string{"alice": {"dev", "ops"}},
+	}
+	la.directory = d
+
+	ctx := newContext("alice", "alice-pw")
+	if result := la.handle(ctx); result != "" {
+		t.Fatalf("alice should be authenticated, got %q", result)
+	}
+	h := ctx.Request().Header()
+	if h.Get("X-Auth-User") != "alice" || h.Get("X-Auth-Groups") != "dev,ops" {
+		t.Errorf("unexpected headers: user %q, groups %q", h.Get("X-Auth-User"), h.Get("X-Auth-Groups"))
+	}
+
+	if result := la.handle(newContext("bob", "bob-pw")); result != resultForbidden {
+		t.Errorf("bob is not in required groups, got %q", result)
+	}
+	if result := la.handle(newContext("", "")); result != resultUnauthorized {
+		t.Errorf("missing credentials should be unauthorized, got %q", result)
+	}
+
+	calls := d.calls
+	for i := 0; i < 3; i++ {
+		la.handle(newContext("alice", "alice-pw"))
+		if result := la.handle(newContext("alice", "wrong")); result != resultUnauthorized {
+			t.Errorf("wrong password should be unauthorized, got %q", result)
+		}
+	}
+	if d.calls != calls+1 {
+		t.Errorf("valid and invalid credentials should be cached, directory called %d times", d.calls-calls)
+	}
+
+	d.down = true
+	for i := 0; i < 2; i++ {
+		if result := la.handle(newContext("carol", "carol-pw")); result != resultUnavailable {
+			t.Errorf("directory errors should be unavailable, got %q", result)
+		}
+	}
+	if result := la.handle(newContext("alice", "alice-pw")); result != "" {
+		t.Errorf("cached credentials should still work, got %q", result)
+	}
+	if d.calls != calls+3 {
+		t.Errorf("directory errors should not be cached")
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	cases := map[string]string{
+		"alice":     "alice",
+		"a,b=c":     `a\,b\=c`,
+		"#admin ":   `\#admin\ `,
+		` x+"y"<>;`: `\ x\+\"y\"\<\>\;`,
+	}
+	for input, want := range cases {
+		if got := escapeDN(input); got != want {
+			t.Errorf("escapeDN(%q) should be %q, got %q", input, want, got)
+		}
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	specs := []map[string]interface{}{
+		{"url": "ldap://127.0.0.1"},
+		{"url": "ldap://127.0.0.1", "userDN": "uid=alice,dc=example,dc=com"},
+		{"url": "ldap://127.0.0.1", "userDN": "uid={user},dc=example,dc=com", "requiredGroups": []string{"ops"}},
+	}
+
+	for i, spec := range specs {
+		_, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+			Name: "ldapauth",
+			Kind: Kind,
+		}, spec)
+		if err == nil {
+			t.Errorf("spec %d should be invalid", i)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadshedder
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of LoadShedder.
+	Kind = "LoadShedder"
+
+	resultShed = "shed"
+
+	defaultPercentile   = 99
+	defaultWindow       = time.Second
+	defaultStep         = 0.1
+	defaultMaxShedRatio = 0.9
+
+	sampleSize = 1028
+)
+
+var (
+	results = []string{resultShed}
+)
+
+func init() {
+	httppipeline.Register(&LoadShedder{})
+}
+
+type (
+	// LoadShedder rejects a fraction of requests when the filters after it
+	// are overloaded, to keep the gateway responsive.
+	LoadShedder struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		targetLatency time.Duration
+		window        time.Duration
+
+		sample    atomic.Value // metrics.Sample
+		inFlight  int32
+		ratioBits uint64 // math.Float64bits of the shed ratio
+		shed      uint64
+		latency   int64 // the latency percentile of the last window
+		done      chan struct{}
+	}
+
+	// Spec describes the LoadShedder.
+	Spec struct {
+		TargetLatency string  `yaml:"targetLatency" jsonschema:"required,format=duration"`
+		Percentile    float64 `yaml:"percentile" jsonschema:"omitempty,exclusiveMinimum=0,maximum=100"`
+		MaxInFlight   int32   `yaml:"maxInFlight" jsonschema:"omitempty,minimum=1"`
+		Window        string  `yaml:"window" jsonschema:"omitempty,format=duration"`
+		Step          float64 `yaml:"step" jsonschema:"omitempty,exclusiveMinimum=0,maximum=1"`
+		MaxShedRatio  float64 `yaml:"maxShedRatio" jsonschema:"omitempty,exclusiveMinimum=0,maximum=1"`
+	}
+
+	// Status is the status of LoadShedder.
+	Status struct {
+		Latency   string  `yaml:"latency"`
+		InFlight  int32   `yaml:"inFlight"`
+		ShedRatio float64 `yaml:"shedRatio"`
+		Shed      uint64  `yaml:"shed"`
+	}
+)
+
+// Kind returns the kind of LoadShedder.
+func (ls *LoadShedder) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of LoadShedder.
+func (ls *LoadShedder) DefaultSpec() interface{} {
+	return &Spec{
+		Percentile:   defaultPercentile,
+		Step:         defaultStep,
+		MaxShedRatio: defaultMaxShedRatio,
+	}
+}
+
+// Description returns the description of LoadShedder.
+func (ls *LoadShedder) Description() string {
+	return "LoadShedder rejects a fraction of requests when the filters after it are overloaded."
+}
+
+// Results returns the results of LoadShedder.
+func (ls *LoadShedder) Results() []string {
+	return results
+}
+
+// Init initializes LoadShedder.
+func (ls *LoadShedder) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	ls.pipeSpec, ls.spec, ls.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	ls.reload()
+}
+
+// Inherit inherits previous generation of LoadShedder.
+func (ls *LoadShedder) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	ls.Init(pipeSpec, super)
+}
+
+func parseDuration(d string, dflt time.Duration) time.Duration {
+	if d == "" {
+		return dflt
+	}
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return dflt
+	}
+	return duration
+}
+
+func (ls *LoadShedder) reload() {
+	ls.targetLatency = parseDuration(ls.spec.TargetLatency, 0)
+	ls.window = parseDuration(ls.spec.Window, defaultWindow)
+	ls.sample.Store(metrics.NewUniformSample(sampleSize))
+	ls.done = make(chan struct{})
+
+	go ls.run()
+}
+
+func (ls *LoadShedder) run() {
+	ticker := time.NewTicker(ls.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ls.done:
+			return
+		case <-ticker.C:
+			ls.adjust()
+		}
+	}
+}
+
+// adjust increases the shed ratio by step if the filters after LoadShedder
+// are overloaded in the last window, and decreases it by step otherwise.
+func (ls *LoadShedder) adjust() {
+	sample := ls.sample.Load().(metrics.Sample)
+	ls.sample.Store(metrics.NewUniformSample(sampleSize))
+
+	latency := time.Duration(sample.Percentile(ls.spec.Percentile / 100))
+	atomic.StoreInt64(&ls.latency, int64(latency))
+
+	overloaded := sample.Count() > 0 && latency > ls.targetLatency
+	if ls.spec.MaxInFlight > 0 && atomic.LoadInt32(&ls.inFlight) > ls.spec.MaxInFlight {
+		overloaded = true
+	}
+
+	ratio := ls.shedRatio()
+	if overloaded {
+		ratio = math.Min(ratio+ls.spec.Step, ls.spec.MaxShedRatio)
+	} else {
+		ratio = math.Max(ratio-ls.spec.Step, 0)
+	}
+	atomic.StoreUint64(&ls.ratioBits, math.Float64bits(ratio))
+}
+
+func (ls *LoadShedder) shedRatio() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&ls.ratioBits))
+}
+
+// Handle sheds HTTPContext if the filters after LoadShedder are overloaded.
+func (ls *LoadShedder) Handle(ctx context.HTTPContext) string {
+	if ratio := ls.shedRatio(); ratio > 0 && rand.Float64() < ratio {
+		atomic.AddUint64(&ls.shed, 1)
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag(fmt.Sprintf("loadShedder: shed at ratio %.2f", ratio))
+		return resultShed
+	}
+
+	atomic.AddInt32(&ls.inFlight, 1)
+	startTime := time.Now()
+
+	result := ctx.CallNextHandler("")
+
+	ls.sample.Load().(metrics.Sample).Update(int64(time.Since(startTime)))
+	atomic.AddInt32(&ls.inFlight, -1)
+
+	return result
+}
+
+// Status returns status.
+func (ls *LoadShedder) Status() interface{} {
+	return &Status{
+		Latency:   time.Duration(atomic.LoadInt64(&ls.latency)).String(),
+		InFlight:  atomic.LoadInt32(&ls.inFlight),
+		ShedRatio: ls.shedRatio(),
+		Shed:      atomic.LoadUint64(&ls.shed),
+	}
+}
+
+// Close closes LoadShedder.
+func (ls *LoadShedder) Close() {
+	close(ls.done)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadshedder
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestAdjust(t *testing.T) {
+	ls := &LoadShedder{
+		spec: &Spec{
+			Percentile:   99,
+			MaxInFlight:  10,
+			Step:         0.25,
+			MaxShedRatio: 0.5,
+		},
+		targetLatency: 100 * time.Millisecond,
+	}
+
+	cases := []struct {
+		latency  time.Duration
+		inFlight int32
+		ratio    float64
+	}{
+		{latency: 10 * time.Millisecond, ratio: 0},
+		{latency: 200 * time.Millisecond, ratio: 0.25},
+		{latency: 200 * time.Millisecond, ratio: 0.5},
+		{latency: 200 * time.Millisecond, ratio: 0.5},
+		{latency: 10 * time.Millisecond, ratio: 0.25},
+		{latency: 10 * time.Millisecond, inFlight: 11, ratio: 0.5},
+		{latency: 10 * time.Millisecond, ratio: 0.25},
+		{ratio: 0},
+	}
+
+	for i, c := range cases {
+		sample := metrics.NewUniformSample(sampleSize)
+		if c.latency > 0 {
+			for j := 0; j < 100; j++ {
+				sample.Update(int64(c.latency))
+			}
+		}
+		ls.sample.Store(sample)
+		ls.inFlight = c.inFlight
+
+		ls.adjust()
+		if ratio := ls.shedRatio(); math.Abs(ratio-c.ratio) > 1e-9 {
+			t.Errorf("case %d: shed ratio should be %v, got %v", i, c.ratio, ratio)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luafilter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of LuaFilter.
+	Kind = "LuaFilter"
+
+	resultFailed          = "failed"
+	resultResponseAlready = "responseAlready"
+
+	defaultTimeout          = "100ms"
+	defaultMaxInstructions  = 1000000
+	defaultMaxCallStackSize = 256
+	defaultMaxRegistrySize  = 64 * 1024
+	defaultMaxBodySize      = 4 * 1024 * 1024
+)
+
+var (
+	results = []string{resultFailed, resultResponseAlready}
+)
+
+func init() {
+	httppipeline.Register(&LuaFilter{})
+}
+
+type (
+	// LuaFilter is the filter running Lua scripts.
+	LuaFilter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		proto   *lua.FunctionProto
+		vmPool  sync.Pool
+	}
+
+	// Spec describes the LuaFilter.
+	Spec struct {
+		Script           string `yaml:"script" jsonschema:"required"`
+		Timeout          string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxInstructions  int64  `yaml:"maxInstructions" jsonschema:"omitempty,minimum=0"`
+		MaxCallStackSize int    `yaml:"maxCallStackSize" jsonschema:"omitempty,minimum=16"`
+		MaxRegistrySize  int    `yaml:"maxRegistrySize" jsonschema:"omitempty,minimum=1024"`
+		MaxBodySize      int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	_, err := compile(s.Script)
+	return err
+}
+
+func compile(script string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), Kind)
+	if err != nil {
+		return nil, fmt.Errorf("parse script failed: %v", err)
+	}
+
+	proto, err := lua.Compile(chunk, Kind)
+	if err != nil {
+		return nil, fmt.Errorf("compile script failed: %v", err)
+	}
+
+	return proto, nil
+}
+
+// Kind returns the kind of LuaFilter.
+func (lf *LuaFilter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of LuaFilter.
+func (lf *LuaFilter) DefaultSpec() interface{} {
+	return &Spec{
+		Timeout:          defaultTimeout,
+		MaxInstructions:  defaultMaxInstructions,
+		MaxCallStackSize: defaultMaxCallStackSize,
+		MaxRegistrySize:  defaultMaxRegistrySize,
+		MaxBodySize:      defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of LuaFilter.
+func (lf *LuaFilter) Description() string {
+	return "LuaFilter runs Lua scripts to inspect and modify requests and responses."
+}
+
+// Results returns the results of LuaFilter.
+func (lf *LuaFilter) Results() []string {
+	return results
+}
+
+// Init initializes LuaFilter.
+func (lf *LuaFilter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	lf.pipeSpec, lf.spec, lf.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	lf.reload()
+}
+
+// Inherit inherits previous generation of LuaFilter.
+func (lf *LuaFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	lf.Init(pipeSpec, super)
+}
+
+func (lf *LuaFilter) reload() {
+	var err error
+	if lf.spec.Timeout != "" {
+		lf.timeout, err = time.ParseDuration(lf.spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", lf.spec.Timeout, err)
+		}
+	}
+
+	lf.proto, err = compile(lf.spec.Script)
+	if err != nil {
+		logger.Errorf("BUG: %v", err)
+	}
+
+	lf.vmPool.New = func() interface{} {
+		return newVM(lf.spec, lf.proto)
+	}
+}
+
+// Handle handles HTTPContext by running the Lua script.
+func (lf *LuaFilter) Handle(ctx context.HTTPContext) string {
+	result := lf.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (lf *LuaFilter) handle(ctx context.HTTPContext) string {
+	if lf.proto == nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag("luaFilter: script is not compiled")
+		return resultFailed
+	}
+
+	vm := lf.vmPool.Get().(*vm)
+	result, err := vm.run(ctx, lf.timeout, lf.spec.MaxInstructions)
+	if err != nil {
+		// NOTE: The state may be broken when the script is
+		// interrupted, so the vm is dropped instead of reused.
+		vm.close()
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("luaFilter: ", err.Error()))
+		return resultFailed
+	}
+	lf.vmPool.Put(vm)
+
+	switch result {
+	case "":
+		return ""
+	case resultResponseAlready:
+		return resultResponseAlready
+	default:
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("luaFilter: unknown result ", result))
+		return resultFailed
+	}
+}
+
+// Status returns status.
+func (lf *LuaFilter) Status() interface{} { return nil }
+
+// Close closes LuaFilter.
+func (lf *LuaFilter) Close() {}
@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luafilter
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// vm is a sandboxed Lua state bound to one HTTPContext at a time.
+	vm struct {
+		L           *lua.LState
+		fn          *lua.LFunction
+		maxBodySize int64
+
+		ctx     context.HTTPContext
+		reqBody []byte
+		rspBody []byte
+	}
+
+	// budgetContext is canceled after its Done is called more than
+	// budget times. The Lua VM checks Done once per instruction, so
+	// it works as an instruction limit.
+	budgetContext struct {
+		stdcontext.Context
+		budget    int64
+		exhausted chan struct{}
+	}
+)
+
+func newBudgetContext(parent stdcontext.Context, budget int64) *budgetContext {
+	return &budgetContext{
+		Context:   parent,
+		budget:    budget,
+		exhausted: make(chan struct{}),
+	}
+}
+
+func (bc *budgetContext) Done() <-chan struct{} {
+	bc.budget--
+	if bc.budget == 0 {
+		close(bc.exhausted)
+	}
+	if bc.budget <= 0 {
+		return bc.exhausted
+	}
+	return bc.Context.Done()
+}
+
+func (bc *budgetContext) Err() error {
+	if bc.budget <= 0 {
+		return fmt.Errorf("instruction limit exceeded")
+	}
+	return bc.Context.Err()
+}
+
+func newVM(spec *Spec, proto *lua.FunctionProto) *vm {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   spec.MaxCallStackSize,
+		RegistrySize:    1024,
+		RegistryMaxSize: spec.MaxRegistrySize,
+	})
+
+	// NOTE: Only libraries without access to the host are opened.
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "module", "require"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	v := &vm{
+		L:           L,
+		fn:          L.NewFunctionFromProto(proto),
+		maxBodySize: spec.MaxBodySize,
+	}
+	L.SetGlobal("eg", L.SetFuncs(L.NewTable(), v.api()))
+
+	return v
+}
+
+func (v *vm) run(ctx context.HTTPContext, timeout time.Duration, maxInstructions int64) (string, error) {
+	v.ctx, v.reqBody, v.rspBody = ctx, nil, nil
+	defer func() {
+		v.ctx, v.reqBody, v.rspBody = nil, nil, nil
+		v.L.SetTop(0)
+	}()
+
+	// NOTE: The script stops on the cancellation of the request too.
+	var runCtx stdcontext.Context = stdcontext.Background()
+	if ctx != nil {
+		runCtx = ctx
+	}
+	if timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		runCtx, cancel = stdcontext.WithTimeout(runCtx, timeout)
+		defer cancel()
+	}
+	if maxInstructions > 0 {
+		runCtx = newBudgetContext(runCtx, maxInstructions)
+	}
+	v.L.SetContext(runCtx)
+	defer v.L.RemoveContext()
+
+	v.L.Push(v.fn)
+	err := v.L.PCall(0, 1, nil)
+	if err != nil {
+		return "", err
+	}
+
+	ret := v.L.Get(-1)
+	if ret == lua.LNil {
+		return "", nil
+	}
+
+	return ret.String(), nil
+}
+
+func (v *vm) close() {
+	v.L.Close()
+}
+
+func (v *vm) api() map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"req_method":     v.reqMethod,
+		"req_path":       v.reqPath,
+		"set_req_path":   v.setReqPath,
+		"req_query":      v.reqQuery,
+		"set_req_query":  v.setReqQuery,
+		"req_real_ip":    v.reqRealIP,
+		"req_header":     v.reqHeader,
+		"set_req_header": v.setReqHeader,
+		"add_req_header": v.addReqHeader,
+		"del_req_header": v.delReqHeader,
+		"req_body":       v.reqBodyFunc,
+		"set_req_body":   v.setReqBody,
+		"rsp_status":     v.rspStatus,
+		"set_rsp_status": v.setRspStatus,
+		"rsp_header":     v.rspHeader,
+		"set_rsp_header": v.setRspHeader,
+		"del_rsp_header": v.delRspHeader,
+		"rsp_body":       v.rspBodyFunc,
+		"set_rsp_body":   v.setRspBody,
+		"log":            v.log,
+	}
+}
+
+func (v *vm) readBody(body io.Reader) []byte {
+	if body == nil {
+		return nil
+	}
+
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, body, v.maxBodySize+1)
+	if err != nil && err != io.EOF {
+		v.L.RaiseError("read body failed: %v", err)
+	}
+	if written > v.maxBodySize {
+		v.L.RaiseError("body exceed %dB", v.maxBodySize)
+	}
+
+	return buff.Bytes()
+}
+
+func (v *vm) reqMethod(L *lua.LState) int {
+	L.Push(lua.LString(v.ctx.Request().Method()))
+	return 1
+}
+
+func (v *vm) reqPath(L *lua.LState) int {
+	L.Push(lua.LString(v.ctx.Request().Path()))
+	return 1
+}
+
+func (v *vm) setReqPath(L *lua.LState) int {
+	v.ctx.Request().SetPath(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) reqQuery(L *lua.LState) int {
+	L.Push(lua.LString(v.ctx.Request().Query()))
+	return 1
+}
+
+func (v *vm) setReqQuery(L *lua.LState) int {
+	v.ctx.Request().SetQuery(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) reqRealIP(L *lua.LState) int {
+	L.Push(lua.LString(v.ctx.Request().RealIP()))
+	return 1
+}
+
+func (v *vm) reqHeader(L *lua.LState) int {
+	L.Push(lua.LString(v.ctx.Request().Header().Get(L.CheckString(1))))
+	return 1
+}
+
+func (v *vm) setReqHeader(L *lua.LState) int {
+	v.ctx.Request().Header().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) addReqHeader(L *lua.LState) int {
+	v.ctx.Request().Header().Add(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) delReqHeader(L *lua.LState) int {
+	v.ctx.Request().Header().Del(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) reqBodyFunc(L *lua.LState) int {
+	if v.reqBody == nil {
+		r := v.ctx.Request()
+		v.reqBody = v.readBody(r.Body())
+		r.SetBody(bytes.NewReader(v.reqBody))
+	}
+	L.Push(lua.LString(v.reqBody))
+	return 1
+}
+
+func (v *vm) setReqBody(L *lua.LState) int {
+	v.reqBody = []byte(L.CheckString(1))
+	v.ctx.Request().SetBody(bytes.NewReader(v.reqBody))
+	return 0
+}
+
+func (v *vm) rspStatus(L *lua.LState) int {
+	L.Push(lua.LNumber(v.ctx.Response().StatusCode()))
+	return 1
+}
+
+func (v *vm) setRspStatus(L *lua.LState) int {
+	code := L.CheckInt(1)
+	if code < 200 || code >= 600 {
+		L.ArgError(1, fmt.Sprintf("invalid status code: %d", code))
+	}
+	v.ctx.Response().SetStatusCode(code)
+	return 0
+}
+
+func (v *vm) rspHeader(L *lua.LState) int {
+	L.Push(lua.LString(v.ctx.Response().Header().Get(L.CheckString(1))))
+	return 1
+}
+
+func (v *vm) setRspHeader(L *lua.LState) int {
+	v.ctx.Response().Header().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) delRspHeader(L *lua.LState) int {
+	v.ctx.Response().Header().Del(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) rspBodyFunc(L *lua.LState) int {
+	if v.rspBody == nil {
+		w := v.ctx.Response()
+		v.rspBody = v.readBody(w.Body())
+		w.SetBody(bytes.NewReader(v.rspBody))
+	}
+	L.Push(lua.LString(v.rspBody))
+	return 1
+}
+
+func (v *vm) setRspBody(L *lua.LState) int {
+	v.rspBody = []byte(L.CheckString(1))
+	w := v.ctx.Response()
+	w.Header().Del("Content-Length")
+	w.SetBody(bytes.NewReader(v.rspBody))
+	return 0
+}
+
+func (v *vm) log(L *lua.LState) int {
+	logger.Infof("luaFilter: %s", L.CheckString(1))
+	return 0
+}
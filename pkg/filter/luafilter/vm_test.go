@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luafilter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVMRun(t *testing.T) {
+	tests := []struct {
+		script          string
+		timeout         time.Duration
+		maxInstructions int64
+		result          string
+		err             string
+	}{
+		{script: `return "responseAlready"`, result: "responseAlready"},
+		{script: `local a = 1`, result: ""},
+		{script: `while true do end`, maxInstructions: 1000, err: "instruction limit exceeded"},
+		{script: `while true do end`, timeout: 10 * time.Millisecond, err: "deadline exceeded"},
+		{script: `dofile("/etc/passwd")`, err: "attempt to call a non-function"},
+		{script: `os.exit(1)`, err: "attempt to index a non-table"},
+		{script: `local function f() return f() + 1 end f()`, err: "stack overflow"},
+	}
+
+	spec := &Spec{
+		MaxCallStackSize: defaultMaxCallStackSize,
+		MaxRegistrySize:  defaultMaxRegistrySize,
+		MaxBodySize:      defaultMaxBodySize,
+	}
+	for i, test := range tests {
+		proto, err := compile(test.script)
+		if err != nil {
+			t.Fatalf("case %d: compile failed: %v", i, err)
+		}
+
+		v := newVM(spec, proto)
+		result, err := v.run(nil, test.timeout, test.maxInstructions)
+		v.close()
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("case %d: want error containing %q, got %v", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if result != test.result {
+			t.Errorf("case %d: want result %q, got %q", i, test.result, result)
+		}
+	}
+}
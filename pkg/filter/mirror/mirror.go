@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mirror
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	// Kind is the kind of Mirror.
+	Kind = "Mirror"
+
+	defaultTimeout     = 10 * time.Second
+	defaultMaxBodySize = 1024 * 1024
+	defaultMaxInFlight = 100
+)
+
+var (
+	results = []string{}
+)
+
+func init() {
+	httppipeline.Register(&Mirror{})
+}
+
+type (
+	// Mirror copies requests to a shadow pipeline or upstream asynchronously.
+	Mirror struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout     time.Duration
+		maxBodySize int64
+		client      *http.Client
+		slots       chan struct{}
+
+		mirrored uint64
+		dropped  uint64
+		failed   uint64
+	}
+
+	// Spec describes the Mirror.
+	Spec struct {
+		Percentage  float64           `yaml:"percentage" jsonschema:"required,exclusiveMinimum=0,maximum=100"`
+		Pipeline    string            `yaml:"pipeline" jsonschema:"omitempty"`
+		URL         string            `yaml:"url" jsonschema:"omitempty,format=uri"`
+		Headers     map[string]string `yaml:"headers" jsonschema:"omitempty"`
+		Timeout     string            `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxBodySize int64             `yaml:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+		MaxInFlight int               `yaml:"maxInFlight" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of Mirror.
+	Status struct {
+		InFlight int    `yaml:"inFlight"`
+		Mirrored uint64 `yaml:"mirrored"`
+		Dropped  uint64 `yaml:"dropped"`
+		Failed   uint64 `yaml:"failed"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if (s.Pipeline == "") == (s.URL == "") {
+		return fmt.Errorf("one and only one of pipeline and url must be specified")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of Mirror.
+func (m *Mirror) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Mirror.
+func (m *Mirror) DefaultSpec() interface{} {
+	return &Spec{
+		MaxBodySize: defaultMaxBodySize,
+		MaxInFlight: defaultMaxInFlight,
+	}
+}
+
+// Description returns the description of Mirror.
+func (m *Mirror) Description() string {
+	return "Mirror copies requests to a shadow pipeline or upstream asynchronously."
+}
+
+// Results returns the results of Mirror.
+func (m *Mirror) Results() []string {
+	return results
+}
+
+// Init initializes Mirror.
+func (m *Mirror) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	m.pipeSpec, m.spec, m.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	m.reload()
+}
+
+// Inherit inherits previous generation of Mirror.
+func (m *Mirror) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	m.Init(pipeSpec, super)
+}
+
+func (m *Mirror) reload() {
+	m.timeout = defaultTimeout
+	if m.spec.Timeout != "" {
+		var err error
+		m.timeout, err = time.ParseDuration(m.spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", m.spec.Timeout, err)
+			m.timeout = defaultTimeout
+		}
+	}
+
+	m.maxBodySize = m.spec.MaxBodySize
+	if m.maxBodySize == 0 {
+		m.maxBodySize = defaultMaxBodySize
+	}
+
+	m.slots = make(chan struct{}, m.spec.MaxInFlight)
+
+	if m.spec.URL != "" {
+		m.client = &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   m.timeout,
+		}
+	}
+}
+
+// Handle mirrors HTTPContext.
+func (m *Mirror) Handle(ctx context.HTTPContext) string {
+	if rand.Float64()*100 < m.spec.Percentage {
+		m.mirror(ctx)
+	}
+
+	return ctx.CallNextHandler("")
+}
+
+func (m *Mirror) mirror(ctx context.HTTPContext) {
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+		return
+	}
+
+	req, cancel, err := m.copyRequest(ctx)
+	if err != nil {
+		<-m.slots
+		atomic.AddUint64(&m.dropped, 1)
+		ctx.AddTag(fmt.Sprintf("mirror: %v", err))
+		return
+	}
+
+	go func() {
+		defer func() {
+			cancel()
+			<-m.slots
+		}()
+
+		if m.spec.Pipeline != "" {
+			m.sendToPipeline(req)
+		} else {
+			m.report(m.sendToURL(req))
+		}
+	}()
+}
+
+// report records the outcome of a mirrored request.
+func (m *Mirror) report(err error) {
+	if err != nil {
+		atomic.AddUint64(&m.failed, 1)
+		logger.Warnf("%s: mirror request failed: %v", m.pipeSpec.Name(), err)
+		return
+	}
+	atomic.AddUint64(&m.mirrored, 1)
+}
+
+// copyRequest copies the request, the copied request is not canceled with
+// the original one, so the mirroring isn't affected by the primary path.
+func (m *Mirror) copyRequest(ctx context.HTTPContext) (*http.Request, stdcontext.CancelFunc, error) {
+	r := ctx.Request()
+
+	var body []byte
+	if b := r.Body(); b != nil {
+		buff := bytes.NewBuffer(nil)
+		written, err := io.CopyN(buff, b, m.maxBodySize+1)
+		// NOTE: Keep the original body intact whatever happens.
+		r.SetBody(io.MultiReader(bytes.NewReader(buff.Bytes()), b))
+		if err != nil && err != io.EOF {
+			return nil, nil, fmt.Errorf("read body failed: %v", err)
+		}
+		if written > m.maxBodySize {
+			return nil, nil, fmt.Errorf("body exceed %dB", m.maxBodySize)
+		}
+		body = buff.Bytes()
+	}
+
+	target := r.Std().URL.String()
+	if m.spec.URL != "" {
+		target = strings.TrimSuffix(m.spec.URL, "/") + r.Std().URL.RequestURI()
+	}
+
+	stdctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), m.timeout)
+	req, err := http.NewRequestWithContext(stdctx, r.Method(), target, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("new request failed: %v", err)
+	}
+
+	req.Header = r.Header().Copy().Std()
+	req.RemoteAddr = r.Std().RemoteAddr
+	if m.spec.Pipeline != "" {
+		req.Host = r.Host()
+	}
+	for k, v := range m.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return req, cancel, nil
+}
+
+func (m *Mirror) sendToPipeline(req *http.Request) {
+	ro, exists := m.super.GetRunningObject(m.spec.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		m.report(fmt.Errorf("pipeline %s not found", m.spec.Pipeline))
+		return
+	}
+
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		m.report(fmt.Errorf("%s is not a handler", m.spec.Pipeline))
+		return
+	}
+
+	m.handle(handler, req)
+}
+
+// handle handles the request by handler, it's reported as failed once the
+// timeout is exceeded, and the context of the request is canceled then.
+func (m *Mirror) handle(handler protocol.HTTPHandler, req *http.Request) {
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.Handle(ctx)
+		ctx.Finish()
+	}()
+
+	select {
+	case <-done:
+		m.report(nil)
+	case <-req.Context().Done():
+		m.report(fmt.Errorf("pipeline %s timed out after %v", m.spec.Pipeline, m.timeout))
+		// NOTE: The slot is held until the pipeline returns, so the
+		// mirrored requests in flight are still bounded.
+		<-done
+	}
+}
+
+func (m *Mirror) sendToURL(req *http.Request) error {
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
+}
+
+// Status returns status.
+func (m *Mirror) Status() interface{} {
+	return &Status{
+		InFlight: len(m.slots),
+		Mirrored: atomic.LoadUint64(&m.mirrored),
+		Dropped:  atomic.LoadUint64(&m.dropped),
+		Failed:   atomic.LoadUint64(&m.failed),
+	}
+}
+
+// Close closes Mirror.
+func (m *Mirror) Close() {
+	if m.client != nil {
+		m.client.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mirror
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "mirror-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "mirror-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func TestZeroMaxBodySize(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	m := filtertest.NewFilter(t, &Mirror{}, map[string]interface{}{
+		"percentage":  100,
+		"url":         server.URL,
+		"maxBodySize": 0,
+	}).(*Mirror)
+	defer m.Close()
+
+	ctx := filtertest.NewContext(filtertest.NewRequest(http.MethodPost, "http://127.0.0.1/", "body", nil))
+	m.Handle(ctx)
+
+	// NOTE: The request is mirrored with the body up to the default size.
+	select {
+	case body := <-bodies:
+		if body != "body" {
+			t.Errorf("want body mirrored, got %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("want request mirrored, got %+v", m.Status())
+	}
+
+	if body, _ := ioutil.ReadAll(ctx.Request().Body()); string(body) != "body" {
+		t.Errorf("want body kept for the next filter, got %q", body)
+	}
+}
+
+// handlerFunc handles requests by the function, as a pipeline.
+type handlerFunc func(ctx context.HTTPContext)
+
+func (f handlerFunc) Handle(ctx context.HTTPContext) { f(ctx) }
+
+func TestPipelineTimeout(t *testing.T) {
+	m := filtertest.NewFilter(t, &Mirror{}, map[string]interface{}{
+		"percentage": 100,
+		"pipeline":   "shadow",
+		"timeout":    "10ms",
+	}).(*Mirror)
+	defer m.Close()
+
+	ctx := filtertest.NewContext(filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", nil))
+	req, cancel, err := m.copyRequest(ctx)
+	if err != nil {
+		t.Fatalf("copy request failed: %v", err)
+	}
+	defer cancel()
+
+	canceled := false
+	m.handle(handlerFunc(func(ctx context.HTTPContext) {
+		select {
+		case <-ctx.Done():
+			canceled = true
+		case <-time.After(5 * time.Second):
+		}
+	}), req)
+
+	if !canceled {
+		t.Errorf("want pipeline canceled after the timeout")
+	}
+	if status := m.Status().(*Status); status.Failed != 1 || status.Mirrored != 0 {
+		t.Errorf("want mirror failed by the timeout, got %+v", status)
+	}
+}
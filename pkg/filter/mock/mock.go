@@ -90,6 +90,16 @@ func (m *Mock) Results() []string {
 	return results
 }
 
+// AlwaysResult returns resultMocked if there is a rule for all paths.
+func (m *Mock) AlwaysResult(pipeSpec *httppipeline.FilterSpec) (string, bool) {
+	for _, rule := range pipeSpec.FilterSpec().(*Spec).Rules {
+		if rule.Path == "" && rule.PathPrefix == "" {
+			return resultMocked, true
+		}
+	}
+	return "", false
+}
+
 // Init initializes Mock.
 func (m *Mock) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
 	m.pipeSpec, m.spec, m.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
@@ -100,7 +110,6 @@ func (m *Mock) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervi
 func (m *Mock) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	m.Init(pipeSpec, super)
 }
 
@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package multipartparser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of MultipartParser.
+	Kind = "MultipartParser"
+
+	resultInvalid = "invalid"
+
+	defaultMaxBodySize       = 32 * 1024 * 1024
+	defaultMaxPartSize       = 10 * 1024 * 1024
+	defaultMaxParts          = 100
+	defaultFieldHeaderPrefix = "X-EG-Form-"
+	defaultFileHeaderPrefix  = "X-EG-File-"
+)
+
+var (
+	results = []string{resultInvalid}
+)
+
+func init() {
+	httppipeline.Register(&MultipartParser{})
+}
+
+type (
+	// MultipartParser is filter MultipartParser.
+	MultipartParser struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+	}
+
+	// Spec describes the MultipartParser.
+	Spec struct {
+		MaxBodySize       int64    `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		MaxPartSize       int64    `yaml:"maxPartSize" jsonschema:"omitempty,minimum=1"`
+		MaxParts          int      `yaml:"maxParts" jsonschema:"omitempty,minimum=1"`
+		RequiredFields    []string `yaml:"requiredFields" jsonschema:"omitempty,uniqueItems=true"`
+		AllowedFileTypes  []string `yaml:"allowedFileTypes" jsonschema:"omitempty,uniqueItems=true"`
+		FieldHeaderPrefix string   `yaml:"fieldHeaderPrefix" jsonschema:"omitempty"`
+		FileHeaderPrefix  string   `yaml:"fileHeaderPrefix" jsonschema:"omitempty"`
+	}
+
+	parseError struct {
+		code int
+		msg  string
+	}
+)
+
+func (e *parseError) Error() string {
+	return e.msg
+}
+
+func newParseError(code int, format string, a ...interface{}) *parseError {
+	return &parseError{code: code, msg: fmt.Sprintf(format, a...)}
+}
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	for _, t := range s.AllowedFileTypes {
+		if _, err := path.Match(t, ""); err != nil {
+			return fmt.Errorf("invalid file type pattern %s: %v", t, err)
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of MultipartParser.
+func (mp *MultipartParser) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of MultipartParser.
+func (mp *MultipartParser) DefaultSpec() interface{} {
+	return &Spec{
+		MaxBodySize:       defaultMaxBodySize,
+		MaxPartSize:       defaultMaxPartSize,
+		MaxParts:          defaultMaxParts,
+		FieldHeaderPrefix: defaultFieldHeaderPrefix,
+		FileHeaderPrefix:  defaultFileHeaderPrefix,
+	}
+}
+
+// Description returns the description of MultipartParser.
+func (mp *MultipartParser) Description() string {
+	return "MultipartParser parses multipart/form-data bodies into headers and validates the parts."
+}
+
+// Results returns the results of MultipartParser.
+func (mp *MultipartParser) Results() []string {
+	return results
+}
+
+// Init initializes MultipartParser.
+func (mp *MultipartParser) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	mp.pipeSpec, mp.spec, mp.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+}
+
+// Inherit inherits previous generation of MultipartParser.
+func (mp *MultipartParser) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	mp.Init(pipeSpec, super)
+}
+
+// Handle parses the multipart body of HTTPContext.
+func (mp *MultipartParser) Handle(ctx context.HTTPContext) string {
+	result := mp.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (mp *MultipartParser) handle(ctx context.HTTPContext) string {
+	err := mp.parse(ctx)
+	if err == nil {
+		return ""
+	}
+
+	ctx.AddTag(stringtool.Cat("multipartParser: ", err.Error()))
+	code := http.StatusBadRequest
+	if pe, ok := err.(*parseError); ok {
+		code = pe.code
+	}
+	ctx.Response().SetStatusCode(code)
+
+	return resultInvalid
+}
+
+func (mp *MultipartParser) parse(ctx context.HTTPContext) error {
+	r := ctx.Request()
+
+	mediaType, params, err := mime.ParseMediaType(r.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return newParseError(http.StatusUnsupportedMediaType, "content type is not multipart/form-data")
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return newParseError(http.StatusBadRequest, "no boundary in content type")
+	}
+
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, r.Body(), mp.spec.MaxBodySize+1)
+	if err != nil && err != io.EOF {
+		return newParseError(http.StatusBadRequest, "read body failed: %v", err)
+	}
+	if written > mp.spec.MaxBodySize {
+		r.SetBody(io.MultiReader(buff, r.Body()))
+		return newParseError(http.StatusRequestEntityTooLarge, "body exceed %dB", mp.spec.MaxBodySize)
+	}
+
+	// NOTE: The backend needs the original body.
+	body := buff.Bytes()
+	r.SetBody(bytes.NewReader(body))
+
+	fields := map[string]struct{}{}
+	h := r.Header()
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for count := 0; ; count++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return newParseError(http.StatusBadRequest, "read part failed: %v", err)
+		}
+
+		if count >= mp.spec.MaxParts {
+			return newParseError(http.StatusRequestEntityTooLarge, "parts exceed %d", mp.spec.MaxParts)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		content := bytes.NewBuffer(nil)
+		size, err := io.Copy(content, io.LimitReader(part, mp.spec.MaxPartSize+1))
+		if err != nil {
+			return newParseError(http.StatusBadRequest, "read part %s failed: %v", name, err)
+		}
+		if size > mp.spec.MaxPartSize {
+			return newParseError(http.StatusRequestEntityTooLarge, "part %s exceed %dB", name, mp.spec.MaxPartSize)
+		}
+
+		fields[name] = struct{}{}
+
+		if part.FileName() == "" {
+			h.Add(mp.spec.FieldHeaderPrefix+name, content.String())
+			continue
+		}
+
+		fileType := part.Header.Get("Content-Type")
+		if !mp.fileTypeAllowed(fileType) {
+			return newParseError(http.StatusUnsupportedMediaType, "file type %s of part %s is not allowed", fileType, name)
+		}
+
+		h.Add(mp.spec.FileHeaderPrefix+name, fmt.Sprintf("filename=%s; size=%s; type=%s",
+			strconv.Quote(part.FileName()), strconv.FormatInt(size, 10), fileType))
+	}
+
+	for _, field := range mp.spec.RequiredFields {
+		if _, exists := fields[field]; !exists {
+			return newParseError(http.StatusBadRequest, "required field %s is missing", field)
+		}
+	}
+
+	return nil
+}
+
+func (mp *MultipartParser) fileTypeAllowed(fileType string) bool {
+	if len(mp.spec.AllowedFileTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(fileType)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range mp.spec.AllowedFileTypes {
+		if matched, _ := path.Match(pattern, mediaType); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Status returns status.
+func (mp *MultipartParser) Status() interface{} { return nil }
+
+// Close closes MultipartParser.
+func (mp *MultipartParser) Close() {}
@@ -0,0 +1,365 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of OIDCAuth.
+	Kind = "OIDCAuth"
+
+	resultRedirected   = "redirected"
+	resultUnauthorized = "unauthorized"
+
+	defaultCookieName = "EG_OIDC"
+	stateCookieSuffix = "_STATE"
+	defaultSessionTTL = 8 * time.Hour
+	stateTTL          = 10 * time.Minute
+)
+
+var (
+	results = []string{resultRedirected, resultUnauthorized}
+
+	defaultScopes = []string{"openid", "profile", "email"}
+)
+
+func init() {
+	httppipeline.Register(&OIDCAuth{})
+	secret.RegisterSensitiveFields("clientSecret", "cookieSecret")
+}
+
+type (
+	// OIDCAuth authenticates browser users by the OpenID Connect
+	// authorization code flow.
+	OIDCAuth struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		provider     *provider
+		codec        *codec
+		callbackPath string
+		secure       bool
+		sessionTTL   time.Duration
+	}
+
+	// Spec describes the OIDCAuth.
+	Spec struct {
+		Issuer       string   `yaml:"issuer" jsonschema:"required,format=uri"`
+		ClientID     string   `yaml:"clientId" jsonschema:"required"`
+		ClientSecret string   `yaml:"clientSecret" jsonschema:"required"`
+		RedirectURL  string   `yaml:"redirectUrl" jsonschema:"required,format=uri"`
+		Scopes       []string `yaml:"scopes" jsonschema:"omitempty,uniqueItems=true"`
+		InsecureTLS  bool     `yaml:"insecureTls" jsonschema:"omitempty"`
+
+		CookieName string `yaml:"cookieName" jsonschema:"omitempty"`
+		// CookieSecret is used to encrypt cookies.
+		CookieSecret string `yaml:"cookieSecret" jsonschema:"required,minLength=16"`
+		SessionTTL   string `yaml:"sessionTTL" jsonschema:"omitempty,format=duration"`
+		LogoutPath   string `yaml:"logoutPath" jsonschema:"omitempty,pattern=^/"`
+
+		// Claims maps claims to request headers for following filters.
+		Claims map[string]string `yaml:"claims" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	u, err := url.Parse(s.RedirectURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid redirectUrl %s", s.RedirectURL)
+	}
+	if s.LogoutPath != "" && s.LogoutPath == u.Path {
+		return fmt.Errorf("logoutPath conflicts with the path of redirectUrl")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of OIDCAuth.
+func (oa *OIDCAuth) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of OIDCAuth.
+func (oa *OIDCAuth) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of OIDCAuth.
+func (oa *OIDCAuth) Description() string {
+	return "OIDCAuth authenticates browser users by the OpenID Connect authorization code flow."
+}
+
+// Results returns the results of OIDCAuth.
+func (oa *OIDCAuth) Results() []string {
+	return results
+}
+
+// DescribeAPI describes the OpenID Connect provider.
+func (oa *OIDCAuth) DescribeAPI(pipeSpec *httppipeline.FilterSpec) *httppipeline.APIDescription {
+	issuer := strings.TrimSuffix(pipeSpec.FilterSpec().(*Spec).Issuer, "/")
+	return &httppipeline.APIDescription{Security: []*httppipeline.APISecurity{{
+		Type:             httppipeline.APISecurityOpenIDConnect,
+		OpenIDConnectURL: issuer + "/.well-known/openid-configuration",
+	}}}
+}
+
+// Init initializes OIDCAuth.
+func (oa *OIDCAuth) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	oa.pipeSpec, oa.spec, oa.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	oa.reload()
+}
+
+// Inherit inherits previous generation of OIDCAuth.
+func (oa *OIDCAuth) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	oa.Init(pipeSpec, super)
+}
+
+func (oa *OIDCAuth) reload() {
+	if oa.spec.CookieName == "" {
+		oa.spec.CookieName = defaultCookieName
+	}
+	if len(oa.spec.Scopes) == 0 {
+		oa.spec.Scopes = defaultScopes
+	}
+
+	oa.sessionTTL = defaultSessionTTL
+	if oa.spec.SessionTTL != "" {
+		var err error
+		oa.sessionTTL, err = time.ParseDuration(oa.spec.SessionTTL)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", oa.spec.SessionTTL, err)
+			oa.sessionTTL = defaultSessionTTL
+		}
+	}
+
+	u, _ := url.Parse(oa.spec.RedirectURL)
+	oa.callbackPath, oa.secure = u.Path, u.Scheme == "https"
+
+	var err error
+	oa.codec, err = newCodec(oa.spec.CookieSecret)
+	if err != nil {
+		logger.Errorf("BUG: create codec failed: %v", err)
+	}
+
+	oa.provider = newProvider(oa.spec.Issuer, oa.spec.ClientID, oa.spec.ClientSecret, oa.spec.InsecureTLS)
+}
+
+// Handle authenticates HTTPContext.
+func (oa *OIDCAuth) Handle(ctx context.HTTPContext) string {
+	result := oa.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (oa *OIDCAuth) handle(ctx context.HTTPContext) string {
+	path := ctx.Request().Path()
+	switch {
+	case path == oa.callbackPath:
+		return oa.handleCallback(ctx)
+	case oa.spec.LogoutPath != "" && path == oa.spec.LogoutPath:
+		return oa.handleLogout(ctx)
+	}
+
+	s := &session{}
+	cookie, err := ctx.Request().Cookie(oa.spec.CookieName)
+	if err == nil {
+		err = oa.codec.open(oa.spec.CookieName, cookie.Value, s)
+		if err == nil && expired(s.Expiry) {
+			err = fmt.Errorf("session expired")
+		}
+	}
+	if err != nil {
+		return oa.login(ctx)
+	}
+
+	h := ctx.Request().Header()
+	for claim, header := range oa.spec.Claims {
+		// NOTE: Delete it first, so clients can't forge it.
+		h.Del(header)
+		if value, exists := s.Claims[claim]; exists {
+			h.Set(header, claimString(value))
+		}
+	}
+
+	return ""
+}
+
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, item := range v {
+			s = append(s, claimString(item))
+		}
+		return strings.Join(s, ",")
+	default:
+		buff, _ := json.Marshal(v)
+		return string(buff)
+	}
+}
+
+// login redirects browsers to the provider, other requests are rejected
+// because they can't follow the redirection.
+func (oa *OIDCAuth) login(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	if r.Method() != http.MethodGet && r.Method() != http.MethodHead {
+		w.SetStatusCode(http.StatusUnauthorized)
+		return resultUnauthorized
+	}
+
+	metadata, err := oa.provider.discover()
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("oidcauth: ", err.Error()))
+		w.SetStatusCode(http.StatusServiceUnavailable)
+		return resultUnauthorized
+	}
+
+	ls := &loginState{
+		State:  randomString(),
+		Nonce:  randomString(),
+		URL:    r.Std().URL.RequestURI(),
+		Expiry: time.Now().Add(stateTTL).Unix(),
+	}
+	stateCookieName := oa.spec.CookieName + stateCookieSuffix
+	value, err := oa.codec.seal(stateCookieName, ls)
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("oidcauth: ", err.Error()))
+		w.SetStatusCode(http.StatusInternalServerError)
+		return resultUnauthorized
+	}
+
+	w.SetCookie(oa.cookie(stateCookieName, value, int(stateTTL.Seconds())))
+	w.Header().Set("Location", oa.provider.authURL(metadata, oa.spec.RedirectURL,
+		oa.spec.Scopes, ls.State, ls.Nonce))
+	w.SetStatusCode(http.StatusFound)
+
+	return resultRedirected
+}
+
+func (oa *OIDCAuth) handleCallback(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+	q := r.Std().URL.Query()
+
+	fail := func(err error) string {
+		ctx.AddTag(stringtool.Cat("oidcauth: ", err.Error()))
+		w.SetStatusCode(http.StatusUnauthorized)
+		return resultUnauthorized
+	}
+
+	if e := q.Get("error"); e != "" {
+		return fail(fmt.Errorf("authorization failed: %s", e))
+	}
+
+	stateCookieName := oa.spec.CookieName + stateCookieSuffix
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil {
+		return fail(fmt.Errorf("no state cookie"))
+	}
+	ls := &loginState{}
+	if err = oa.codec.open(stateCookieName, cookie.Value, ls); err != nil {
+		return fail(err)
+	}
+	if expired(ls.Expiry) || ls.State != q.Get("state") || q.Get("code") == "" {
+		return fail(fmt.Errorf("invalid state"))
+	}
+
+	metadata, err := oa.provider.discover()
+	if err != nil {
+		return fail(err)
+	}
+
+	claims, err := oa.provider.exchange(metadata, oa.spec.RedirectURL, q.Get("code"), ls.Nonce)
+	if err != nil {
+		return fail(err)
+	}
+
+	// NOTE: Only claims in use are saved to keep the cookie small.
+	s := &session{
+		Claims: map[string]interface{}{},
+		Expiry: time.Now().Add(oa.sessionTTL).Unix(),
+	}
+	s.Subject, _ = claims["sub"].(string)
+	for claim := range oa.spec.Claims {
+		if value, exists := claims[claim]; exists {
+			s.Claims[claim] = value
+		}
+	}
+	value, err := oa.codec.seal(oa.spec.CookieName, s)
+	if err != nil {
+		return fail(err)
+	}
+
+	w.SetCookie(oa.cookie(oa.spec.CookieName, value, int(oa.sessionTTL.Seconds())))
+	w.SetCookie(oa.cookie(stateCookieName, "", -1))
+	w.Header().Set("Location", ls.URL)
+	w.SetStatusCode(http.StatusFound)
+
+	return resultRedirected
+}
+
+func (oa *OIDCAuth) handleLogout(ctx context.HTTPContext) string {
+	w := ctx.Response()
+	w.SetCookie(oa.cookie(oa.spec.CookieName, "", -1))
+	w.Header().Set("Location", "/")
+	w.SetStatusCode(http.StatusFound)
+	return resultRedirected
+}
+
+func (oa *OIDCAuth) cookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   oa.secure,
+		HttpOnly: true,
+		// NOTE: Lax is required to send the state cookie in the callback
+		// redirected from the provider.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Status returns status.
+func (oa *OIDCAuth) Status() interface{} {
+	return nil
+}
+
+// Close closes OIDCAuth.
+func (oa *OIDCAuth) Close() {
+	oa.provider.close()
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const tempDir = "/tmp/eg-test"
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(tempDir, "oidcauth-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "oidcauth-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+
+	os.Exit(code)
+}
+
+// newProviderServer creates a fake OpenID provider, which issues ID
+// tokens with the nonce of the code.
+func newProviderServer(t *testing.T, nonces map[string]string) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA", "kid": "key-1",
+				"n": encode(key.N.Bytes()), "e": encode(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		nonce, exists := nonces[r.FormValue("code")]
+		if id != "client" || secret != "secret" || !exists {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   server.URL,
+			"aud":   "client",
+			"sub":   "alice",
+			"email": "alice@example.com",
+			"nonce": nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "key-1"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+
+	return server
+}
+
+func newOIDCAuth(t *testing.T, issuer string) *OIDCAuth {
+	return filtertest.NewFilter(t, &OIDCAuth{}, map[string]interface{}{
+		"issuer":       issuer,
+		"clientId":     "client",
+		"clientSecret": "secret",
+		"redirectUrl":  "http://gateway.example.com/oauth2/callback",
+		"cookieSecret": "a secret of cookies",
+		"logoutPath":   "/logout",
+		"claims":       map[string]string{"email": "X-User-Email"},
+	}).(*OIDCAuth)
+}
+
+func newContext(method, target string, cookies ...*http.Cookie) (context.HTTPContext, *httptest.ResponseRecorder) {
+	r, _ := http.NewRequest(method, target, nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	r.Header.Set("X-User-Email", "forged")
+	w := httptest.NewRecorder()
+	return context.New(w, r, tracing.NoopTracing, ""), w
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestCodeFlow(t *testing.T) {
+	nonces := map[string]string{}
+	server := newProviderServer(t, nonces)
+	defer server.Close()
+
+	oa := newOIDCAuth(t, server.URL)
+	defer oa.Close()
+
+	// Browsers without session are redirected to the provider.
+	ctx, w := newContext(http.MethodGet, "http://gateway.example.com/dashboard?tab=1")
+	if result := oa.handle(ctx); result != resultRedirected {
+		t.Fatalf("request without session should be redirected, got %s", result)
+	}
+	location, _ := url.Parse(ctx.Response().Header().Get("Location"))
+	q := location.Query()
+	if location.Path != "/authorize" || q.Get("client_id") != "client" || q.Get("state") == "" {
+		t.Fatalf("unexpected location: %s", location)
+	}
+	stateCookie := findCookie(w, defaultCookieName+stateCookieSuffix)
+	if stateCookie == nil {
+		t.Fatalf("state cookie should be set")
+	}
+
+	// Callbacks with wrong state are rejected.
+	nonces["code-1"] = q.Get("nonce")
+	ctx, _ = newContext(http.MethodGet, "http://gateway.example.com/oauth2/callback?code=code-1&state=wrong", stateCookie)
+	if result := oa.handle(ctx); result != resultUnauthorized {
+		t.Fatalf("callback with wrong state should be unauthorized, got %s", result)
+	}
+
+	ctx, w = newContext(http.MethodGet, "http://gateway.example.com/oauth2/callback?code=code-1&state="+q.Get("state"), stateCookie)
+	if result := oa.handle(ctx); result != resultRedirected {
+		t.Fatalf("callback should be redirected, got %s", result)
+	}
+	if l := ctx.Response().Header().Get("Location"); l != "/dashboard?tab=1" {
+		t.Fatalf("callback should redirect to the original url, got %s", l)
+	}
+	sessionCookie := findCookie(w, defaultCookieName)
+	if sessionCookie == nil {
+		t.Fatalf("session cookie should be set")
+	}
+
+	// Requests with session pass with claims in headers.
+	ctx, _ = newContext(http.MethodGet, "http://gateway.example.com/dashboard", sessionCookie)
+	if result := oa.handle(ctx); result != "" {
+		t.Fatalf("request with session should pass, got %s", result)
+	}
+	if email := ctx.Request().Header().Get("X-User-Email"); email != "alice@example.com" {
+		t.Errorf("claim should be set to header, got %s", email)
+	}
+
+	// Forged sessions are rejected.
+	forged := &http.Cookie{Name: defaultCookieName, Value: sessionCookie.Value[:len(sessionCookie.Value)-2] + "AA"}
+	ctx, _ = newContext(http.MethodPost, "http://gateway.example.com/api", forged)
+	if result := oa.handle(ctx); result != resultUnauthorized {
+		t.Errorf("request with forged session should be unauthorized, got %s", result)
+	}
+
+	ctx, w = newContext(http.MethodGet, "http://gateway.example.com/logout", sessionCookie)
+	if result := oa.handle(ctx); result != resultRedirected {
+		t.Errorf("logout should be redirected, got %s", result)
+	}
+	if c := findCookie(w, defaultCookieName); c == nil || c.MaxAge >= 0 {
+		t.Errorf("session cookie should be deleted")
+	}
+}
+
+func TestCodec(t *testing.T) {
+	c, err := newCodec("a secret of cookies")
+	if err != nil {
+		t.Fatalf("new codec failed: %v", err)
+	}
+
+	value, err := c.seal("a", &session{Subject: "alice"})
+	if err != nil {
+		t.Fatalf("seal failed: %v", err)
+	}
+
+	s := &session{}
+	if err = c.open("a", value, s); err != nil || s.Subject != "alice" {
+		t.Fatalf("open failed: %v, %+v", err, s)
+	}
+	if err = c.open("b", value, s); err == nil {
+		t.Fatalf("value of a cookie should not be opened as another one")
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcauth
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/megaease/easegress/pkg/util/jwks"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// minDiscoveryInterval limits discovering after failures.
+	minDiscoveryInterval = 10 * time.Second
+
+	maxResponseSize = 1024 * 1024
+
+	// idTokenClockSkew is the tolerance when checking exp of ID tokens.
+	idTokenClockSkew = time.Minute
+)
+
+type (
+	// provider is the OpenID provider, its metadata is discovered lazily.
+	provider struct {
+		issuer       string
+		clientID     string
+		clientSecret string
+		insecureTLS  bool
+		client       *http.Client
+
+		mutex         sync.Mutex
+		metadata      *providerMetadata
+		keys          *jwks.JWKS
+		lastDiscovery time.Time
+		lastError     error
+	}
+
+	providerMetadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	tokenResponse struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+)
+
+func newProvider(issuer, clientID, clientSecret string, insecureTLS bool) *provider {
+	return &provider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		insecureTLS:  insecureTLS,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: insecureTLS,
+				},
+			},
+		},
+	}
+}
+
+// discover returns the metadata of the provider, it's fetched at the first
+// time, and fetched again after failures.
+func (p *provider) discover() (*providerMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	if time.Since(p.lastDiscovery) < minDiscoveryInterval {
+		return nil, p.lastError
+	}
+
+	p.lastDiscovery = time.Now()
+	metadata, err := p.fetchMetadata()
+	if err != nil {
+		p.lastError = fmt.Errorf("discover %s failed: %v", p.issuer, err)
+		return nil, p.lastError
+	}
+
+	p.metadata, p.lastError = metadata, nil
+	p.keys = jwks.New(&jwks.Spec{
+		URL:         metadata.JWKSURI,
+		InsecureTLS: p.insecureTLS,
+	})
+
+	return metadata, nil
+}
+
+func (p *provider) fetchMetadata() (*providerMetadata, error) {
+	resp, err := p.client.Get(p.issuer + discoveryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	metadata := &providerMetadata{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("decode metadata failed: %v", err)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete metadata")
+	}
+
+	return metadata, nil
+}
+
+func (p *provider) authURL(metadata *providerMetadata, redirectURL string,
+	scopes []string, state, nonce string) string {
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return metadata.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// exchange exchanges the code for the ID token and verifies it.
+func (p *provider) exchange(metadata *providerMetadata, redirectURL,
+	code, nonce string) (jwt.MapClaims, error) {
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("client_id", p.clientID)
+
+	req, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("read token response failed: %v", err)
+	}
+
+	tr := &tokenResponse{}
+	err = json.Unmarshal(body, tr)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal token response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.IDToken == "" {
+		return nil, fmt.Errorf("exchange token failed: status code %d, error %q", resp.StatusCode, tr.Error)
+	}
+
+	return p.verify(metadata, tr.IDToken, nonce)
+}
+
+// verify verifies the ID token.
+func (p *provider) verify(metadata *providerMetadata, idToken, nonce string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		alg := token.Method.Alg()
+		if strings.HasPrefix(alg, "HS") {
+			return []byte(p.clientSecret), nil
+		}
+		if !strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "ES") {
+			return nil, fmt.Errorf("unexpected signing method: %s", alg)
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.Key(kid, alg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verify id token failed: %v", err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	issuer := metadata.Issuer
+	if issuer == "" {
+		issuer = p.issuer
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Add(-idTokenClockSkew).Unix(), true) {
+		return nil, fmt.Errorf("id token is expired")
+	}
+
+	var auds []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		auds = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+	}
+	if !stringtool.StrInSlice(p.clientID, auds) {
+		return nil, fmt.Errorf("unexpected audience %v", auds)
+	}
+
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("unexpected nonce")
+	}
+
+	return claims, nil
+}
+
+func (p *provider) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.keys != nil {
+		p.keys.Close()
+	}
+}
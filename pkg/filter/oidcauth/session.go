@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+type (
+	// codec encrypts and authenticates values saved in cookies, so clients
+	// can neither read nor forge them.
+	codec struct {
+		aead cipher.AEAD
+	}
+
+	// session is the login session saved in the session cookie.
+	session struct {
+		Subject string                 `json:"sub"`
+		Claims  map[string]interface{} `json:"claims,omitempty"`
+		Expiry  int64                  `json:"exp"`
+	}
+
+	// loginState is the state of an authorization request saved in the
+	// state cookie, it is checked in the callback.
+	loginState struct {
+		State  string `json:"state"`
+		Nonce  string `json:"nonce"`
+		URL    string `json:"url"`
+		Expiry int64  `json:"exp"`
+	}
+)
+
+func newCodec(secret string) (*codec, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &codec{aead: aead}, nil
+}
+
+// seal encrypts the value, the name is authenticated too, so values of
+// a cookie can't be used as another one.
+func (c *codec) seal(name string, v interface{}) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := c.aead.Seal(nonce, nonce, plaintext, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+func (c *codec) open(name, value string, v interface{}) error {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return fmt.Errorf("invalid cookie")
+	}
+
+	plaintext, err := c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(name))
+	if err != nil {
+		return fmt.Errorf("invalid cookie")
+	}
+
+	return json.Unmarshal(plaintext, v)
+}
+
+func randomString() string {
+	buff := make([]byte, 16)
+	// NOTE: rand.Read of crypto/rand never fails on supported platforms.
+	rand.Read(buff)
+	return base64.RawURLEncoding.EncodeToString(buff)
+}
+
+func expired(expiry int64) bool {
+	return time.Now().Unix() >= expiry
+}
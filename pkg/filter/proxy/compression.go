@@ -18,14 +18,13 @@
 package proxy
 
 import (
-	"bytes"
+	"fmt"
 	"io"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/megaease/easegress/pkg/context"
-	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/bodystream"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 
 	"github.com/klauspost/compress/gzip"
@@ -33,18 +32,7 @@ import (
 
 // TODO: Expose more options: compression level, mime types.
 
-var (
-	bodyFlushSize = 8 * int64(os.Getpagesize())
-)
-
 type (
-	gzipBody struct {
-		body     io.Reader
-		buff     *bytes.Buffer
-		gw       *gzip.Writer
-		complete bool
-	}
-
 	// compression is filter compression.
 	compression struct {
 		spec *CompressionSpec
@@ -87,7 +75,7 @@ func (c *compression) compress(ctx context.HTTPContext) {
 
 	ctx.AddTag("gzip")
 
-	w.SetBody(newGzipBody(w.Body()))
+	w.SetBody(bodystream.Chain(w.Body(), bodystream.Transform(gzipBody)))
 }
 
 func (c *compression) alreadyGziped(ctx context.HTTPContext) bool {
@@ -132,46 +120,13 @@ func (c *compression) parseContentLength(ctx context.HTTPContext) int {
 	return int(cl)
 }
 
-func newGzipBody(body io.Reader) *gzipBody {
-	buff := bytes.NewBuffer(nil)
-	return &gzipBody{
-		body: body,
-		buff: buff,
-		gw:   gzip.NewWriter(buff),
-	}
-}
-
-// body -> gw -> p
-func (gb *gzipBody) Read(p []byte) (int, error) {
-	if gb.complete {
-		return 0, io.EOF
-	}
-
-	if len(gb.buff.Bytes()) < len(p) {
-		gb.pull()
-	}
-
-	n, err := gb.buff.Read(p)
-	if err == io.EOF && !gb.complete {
-		err = nil
-	}
-
-	return n, err
-}
-
-func (gb *gzipBody) pull() {
-	_, err := io.CopyN(gb.gw, gb.body, bodyFlushSize)
-	switch err {
-	case nil:
-		// Nothing to do.
-	case io.EOF:
-		err := gb.gw.Close()
-		if err != nil {
-			logger.Errorf("BUG: close gzip failed: %v", err)
-		}
-		gb.complete = true
-	default:
-		gb.complete = true
-		logger.Errorf("BUG: copy body to gzip failed: %v", err)
+// gzipBody compresses src to dst, it's run as a stage of the body,
+// so the compressed body is flushed while the source is being read.
+func gzipBody(dst io.Writer, src io.Reader) error {
+	gw := gzip.NewWriter(dst)
+	_, err := io.Copy(gw, src)
+	if err != nil {
+		return fmt.Errorf("copy body to gzip failed: %v", err)
 	}
+	return gw.Close()
 }
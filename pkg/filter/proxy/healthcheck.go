@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultHealthCheckTimeout  = 3 * time.Second
+	defaultHealthyThreshold    = 2
+	defaultUnhealthyThreshold  = 3
+
+	// maxHealthCheckBodySize is the max size of the body read to match
+	// the expected body.
+	maxHealthCheckBodySize = 64 * 1024
+)
+
+type (
+	// HealthCheckSpec describes the active health check of servers.
+	HealthCheckSpec struct {
+		Interval            string `yaml:"interval" jsonschema:"omitempty,format=duration"`
+		Timeout             string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		Path                string `yaml:"path" jsonschema:"omitempty"`
+		ExpectedStatusCodes []int  `yaml:"expectedStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		ExpectedBody        string `yaml:"expectedBody" jsonschema:"omitempty"`
+		HealthyThreshold    int    `yaml:"healthyThreshold" jsonschema:"omitempty,minimum=1"`
+		UnhealthyThreshold  int    `yaml:"unhealthyThreshold" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// ServerHealth is the health of a server.
+	ServerHealth struct {
+		URL       string `yaml:"url"`
+		Healthy   bool   `yaml:"healthy"`
+		LastCheck string `yaml:"lastCheck,omitempty"`
+		LastError string `yaml:"lastError,omitempty"`
+
+		successes int
+		failures  int
+	}
+
+	healthChecker struct {
+		spec     *HealthCheckSpec
+		interval time.Duration
+		timeout  time.Duration
+		client   *http.Client
+
+		// servers returns the servers to check, and onChange is called
+		// with unhealthy servers when the health of any server changes.
+		servers  func() []*Server
+		onChange func(unhealthy map[string]struct{})
+
+		mutex  sync.Mutex
+		health map[string]*ServerHealth
+		done   chan struct{}
+	}
+)
+
+func newHealthChecker(spec *HealthCheckSpec, tlsConfig *tls.Config, servers func() []*Server,
+	onChange func(unhealthy map[string]struct{})) *healthChecker {
+
+	hc := &healthChecker{
+		spec:     spec,
+		interval: parseDuration(spec.Interval, defaultHealthCheckInterval),
+		timeout:  parseDuration(spec.Timeout, defaultHealthCheckTimeout),
+		servers:  servers,
+		onChange: onChange,
+		health:   map[string]*ServerHealth{},
+		done:     make(chan struct{}),
+	}
+
+	if hc.spec.HealthyThreshold == 0 {
+		hc.spec.HealthyThreshold = defaultHealthyThreshold
+	}
+	if hc.spec.UnhealthyThreshold == 0 {
+		hc.spec.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+
+	hc.client = &http.Client{
+		Timeout: hc.timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	go hc.run()
+
+	return hc
+}
+
+func parseDuration(d string, dflt time.Duration) time.Duration {
+	if d == "" {
+		return dflt
+	}
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return dflt
+	}
+	return duration
+}
+
+func (hc *healthChecker) run() {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	for {
+		hc.checkAll()
+
+		select {
+		case <-hc.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (hc *healthChecker) checkAll() {
+	servers := hc.servers()
+
+	errs := make([]error, len(servers))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(servers))
+	for i, server := range servers {
+		go func(i int, server *Server) {
+			defer wg.Done()
+			errs[i] = hc.check(server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	hc.mutex.Lock()
+
+	changed := false
+	health := make(map[string]*ServerHealth, len(servers))
+	for i, server := range servers {
+		h := hc.health[server.URL]
+		if h == nil {
+			// NOTE: Servers are healthy until they fail enough checks.
+			h = &ServerHealth{URL: server.URL, Healthy: true}
+		}
+		health[server.URL] = h
+
+		if h.update(errs[i], hc.spec) {
+			changed = true
+			if h.Healthy {
+				logger.Infof("server %s becomes healthy", server.URL)
+			} else {
+				logger.Warnf("server %s becomes unhealthy: %s", server.URL, h.LastError)
+			}
+		}
+	}
+	if len(health) != len(hc.health) {
+		changed = true
+	}
+	hc.health = health
+
+	unhealthy := map[string]struct{}{}
+	for url, h := range health {
+		if !h.Healthy {
+			unhealthy[url] = struct{}{}
+		}
+	}
+
+	hc.mutex.Unlock()
+
+	if changed {
+		hc.onChange(unhealthy)
+	}
+}
+
+// update updates the health by the result of a check, it returns true
+// if the health changed.
+func (h *ServerHealth) update(err error, spec *HealthCheckSpec) bool {
+	h.LastCheck = time.Now().Format(time.RFC3339)
+
+	if err != nil {
+		h.LastError = err.Error()
+		h.successes = 0
+		h.failures++
+		if h.Healthy && h.failures >= spec.UnhealthyThreshold {
+			h.Healthy = false
+			return true
+		}
+		return false
+	}
+
+	h.LastError = ""
+	h.failures = 0
+	h.successes++
+	if !h.Healthy && h.successes >= spec.HealthyThreshold {
+		h.Healthy = true
+		return true
+	}
+	return false
+}
+
+// check probes the server by HTTP if path is specified, or by TCP connect.
+func (hc *healthChecker) check(server *Server) error {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return fmt.Errorf("parse url failed: %v", err)
+	}
+
+	if hc.spec.Path == "" {
+		host := u.Host
+		if u.Port() == "" {
+			if u.Scheme == "https" {
+				host = net.JoinHostPort(u.Hostname(), "443")
+			} else {
+				host = net.JoinHostPort(u.Hostname(), "80")
+			}
+		}
+
+		conn, err := net.DialTimeout("tcp", host, hc.timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), hc.timeout)
+	defer cancel()
+
+	u.Path = hc.spec.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("new request failed: %v", err)
+	}
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !hc.expectedStatusCode(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if hc.spec.ExpectedBody != "" {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBodySize))
+		if err != nil {
+			return fmt.Errorf("read body failed: %v", err)
+		}
+		if !strings.Contains(string(body), hc.spec.ExpectedBody) {
+			return fmt.Errorf("body doesn't contain %q", hc.spec.ExpectedBody)
+		}
+	}
+
+	return nil
+}
+
+func (hc *healthChecker) expectedStatusCode(code int) bool {
+	if len(hc.spec.ExpectedStatusCodes) == 0 {
+		return code >= 200 && code < 400
+	}
+
+	for _, c := range hc.spec.ExpectedStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// status returns the health of servers sorted by URL.
+func (hc *healthChecker) status() []*ServerHealth {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	status := make([]*ServerHealth, 0, len(hc.health))
+	for _, h := range hc.health {
+		copied := *h
+		status = append(status, &copied)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].URL < status[j].URL
+	})
+
+	return status
+}
+
+func (hc *healthChecker) close() {
+	close(hc.done)
+}
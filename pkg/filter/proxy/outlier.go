@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultConsecutiveErrors  = 5
+	defaultBaseEjectionTime   = 30 * time.Second
+	defaultMaxEjectionTime    = 300 * time.Second
+	defaultMaxEjectionPercent = 50
+)
+
+type (
+	// OutlierDetectionSpec describes the passive outlier detection of servers.
+	OutlierDetectionSpec struct {
+		ConsecutiveErrors  int    `yaml:"consecutiveErrors" jsonschema:"omitempty,minimum=1"`
+		ErrorStatusCodes   []int  `yaml:"errorStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		MaxLatency         string `yaml:"maxLatency" jsonschema:"omitempty,format=duration"`
+		BaseEjectionTime   string `yaml:"baseEjectionTime" jsonschema:"omitempty,format=duration"`
+		MaxEjectionTime    string `yaml:"maxEjectionTime" jsonschema:"omitempty,format=duration"`
+		MaxEjectionPercent int    `yaml:"maxEjectionPercent" jsonschema:"omitempty,minimum=1,maximum=100"`
+	}
+
+	// EjectedServer is a server ejected by outlier detection.
+	EjectedServer struct {
+		URL          string `yaml:"url"`
+		Ejections    int    `yaml:"ejections"`
+		EjectedUntil string `yaml:"ejectedUntil"`
+	}
+
+	outlierDetector struct {
+		spec             *OutlierDetectionSpec
+		maxLatency       time.Duration
+		baseEjectionTime time.Duration
+		maxEjectionTime  time.Duration
+
+		// total returns the number of candidate servers, and onChange is
+		// called with ejected servers when any server is ejected or back.
+		total    func() int
+		onChange func(ejected map[string]struct{})
+
+		mutex  sync.Mutex
+		hosts  map[string]*hostStat
+		closed bool
+	}
+
+	hostStat struct {
+		consecutiveErrors int
+		ejections         int
+		ejected           bool
+		ejectedUntil      time.Time
+		unejectedAt       time.Time
+		timer             *time.Timer
+	}
+)
+
+func newOutlierDetector(spec *OutlierDetectionSpec, total func() int,
+	onChange func(ejected map[string]struct{})) *outlierDetector {
+
+	od := &outlierDetector{
+		spec:             spec,
+		baseEjectionTime: parseDuration(spec.BaseEjectionTime, defaultBaseEjectionTime),
+		maxEjectionTime:  parseDuration(spec.MaxEjectionTime, defaultMaxEjectionTime),
+		total:            total,
+		onChange:         onChange,
+		hosts:            map[string]*hostStat{},
+	}
+
+	if spec.MaxLatency != "" {
+		od.maxLatency = parseDuration(spec.MaxLatency, 0)
+	}
+	if od.spec.ConsecutiveErrors == 0 {
+		od.spec.ConsecutiveErrors = defaultConsecutiveErrors
+	}
+	if od.spec.MaxEjectionPercent == 0 {
+		od.spec.MaxEjectionPercent = defaultMaxEjectionPercent
+	}
+
+	return od
+}
+
+func (od *outlierDetector) isError(statusCode int, latency time.Duration) bool {
+	if od.maxLatency > 0 && latency > od.maxLatency {
+		return true
+	}
+
+	if len(od.spec.ErrorStatusCodes) == 0 {
+		return statusCode >= 500
+	}
+
+	for _, code := range od.spec.ErrorStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// record records the result of a request to the server, statusCode is 0
+// if the request failed without response.
+func (od *outlierDetector) record(server *Server, statusCode int, latency time.Duration) {
+	failed := statusCode == 0 || od.isError(statusCode, latency)
+
+	od.mutex.Lock()
+
+	h := od.hosts[server.URL]
+	if h == nil {
+		if !failed {
+			od.mutex.Unlock()
+			return
+		}
+		h = &hostStat{}
+		od.hosts[server.URL] = h
+	}
+
+	if !failed {
+		h.consecutiveErrors = 0
+		od.mutex.Unlock()
+		return
+	}
+
+	h.consecutiveErrors++
+	if h.ejected || h.consecutiveErrors < od.spec.ConsecutiveErrors || !od.canEject() {
+		od.mutex.Unlock()
+		return
+	}
+
+	od.eject(server.URL, h)
+	ejected := od.ejected()
+
+	od.mutex.Unlock()
+
+	od.onChange(ejected)
+}
+
+// canEject returns true if ejecting one more server doesn't exceed the
+// max ejection percent, the caller must hold the lock.
+func (od *outlierDetector) canEject() bool {
+	count := 0
+	for _, h := range od.hosts {
+		if h.ejected {
+			count++
+		}
+	}
+
+	return (count+1)*100 <= od.total()*od.spec.MaxEjectionPercent
+}
+
+// eject ejects the server for an exponential time, the caller must hold the lock.
+func (od *outlierDetector) eject(url string, h *hostStat) {
+	// NOTE: The ejection time backs off only if the server keeps failing
+	// shortly after coming back.
+	if !h.unejectedAt.IsZero() && time.Since(h.unejectedAt) > od.maxEjectionTime {
+		h.ejections = 0
+	}
+
+	d := od.baseEjectionTime
+	for i := 0; i < h.ejections && d < od.maxEjectionTime; i++ {
+		d *= 2
+	}
+	if d > od.maxEjectionTime {
+		d = od.maxEjectionTime
+	}
+
+	h.ejections++
+	h.ejected = true
+	h.consecutiveErrors = 0
+	h.ejectedUntil = time.Now().Add(d)
+	h.timer = time.AfterFunc(d, func() { od.uneject(url) })
+
+	logger.Warnf("server %s is ejected for %s", url, d)
+}
+
+func (od *outlierDetector) uneject(url string) {
+	od.mutex.Lock()
+
+	h := od.hosts[url]
+	if od.closed || h == nil || !h.ejected {
+		od.mutex.Unlock()
+		return
+	}
+
+	h.ejected = false
+	h.unejectedAt = time.Now()
+	h.timer = nil
+	ejected := od.ejected()
+
+	od.mutex.Unlock()
+
+	logger.Infof("server %s is back from ejection", url)
+	od.onChange(ejected)
+}
+
+// ejected returns ejected servers, the caller must hold the lock.
+func (od *outlierDetector) ejected() map[string]struct{} {
+	ejected := map[string]struct{}{}
+	for url, h := range od.hosts {
+		if h.ejected {
+			ejected[url] = struct{}{}
+		}
+	}
+	return ejected
+}
+
+// status returns ejected servers sorted by URL.
+func (od *outlierDetector) status() []*EjectedServer {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	status := []*EjectedServer{}
+	for url, h := range od.hosts {
+		if h.ejected {
+			status = append(status, &EjectedServer{
+				URL:          url,
+				Ejections:    h.ejections,
+				EjectedUntil: h.ejectedUntil.Format(time.RFC3339),
+			})
+		}
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].URL < status[j].URL
+	})
+
+	return status
+}
+
+func (od *outlierDetector) close() {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	od.closed = true
+	for _, h := range od.hosts {
+		if h.timer != nil {
+			h.timer.Stop()
+		}
+	}
+}
@@ -23,9 +23,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 
+	"github.com/megaease/easegress/pkg/certstore"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/spiffe"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/callbackreader"
 	"github.com/megaease/easegress/pkg/util/httpfilter"
@@ -33,11 +37,14 @@ import (
 	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/memorycache"
 	"github.com/megaease/easegress/pkg/util/stringtool"
-	"github.com/opentracing/opentracing-go"
 )
 
 type (
 	pool struct {
+		// inFlight is the number of requests in flight, it must be
+		// the first field for the atomic operations on 32-bit systems.
+		inFlight int64
+
 		spec *PoolSpec
 
 		tagPrefix     string
@@ -48,23 +55,46 @@ type (
 		servers     *servers
 		httpStat    *httpstat.HTTPStat
 		memoryCache *memorycache.MemoryCache
+
+		client       *http.Client
+		spiffeSource *spiffe.Source
 	}
 
 	// PoolSpec describes a pool of servers.
 	PoolSpec struct {
-		SpanName        string            `yaml:"spanName" jsonschema:"omitempty"`
-		Filter          *httpfilter.Spec  `yaml:"filter" jsonschema:"omitempty"`
-		ServersTags     []string          `yaml:"serversTags" jsonschema:"omitempty,uniqueItems=true"`
-		Servers         []*Server         `yaml:"servers" jsonschema:"omitempty"`
-		ServiceRegistry string            `yaml:"serviceRegistry" jsonschema:"omitempty"`
-		ServiceName     string            `yaml:"serviceName" jsonschema:"omitempty"`
-		LoadBalance     *LoadBalance      `yaml:"loadBalance" jsonschema:"required"`
-		MemoryCache     *memorycache.Spec `yaml:"memoryCache,omitempty" jsonschema:"omitempty"`
+		SpanName         string                `yaml:"spanName" jsonschema:"omitempty"`
+		Filter           *httpfilter.Spec      `yaml:"filter" jsonschema:"omitempty"`
+		ServersTags      []string              `yaml:"serversTags" jsonschema:"omitempty,uniqueItems=true"`
+		Servers          []*Server             `yaml:"servers" jsonschema:"omitempty"`
+		ServiceRegistry  string                `yaml:"serviceRegistry" jsonschema:"omitempty"`
+		ServiceName      string                `yaml:"serviceName" jsonschema:"omitempty"`
+		LoadBalance      *LoadBalance          `yaml:"loadBalance" jsonschema:"required"`
+		MemoryCache      *memorycache.Spec     `yaml:"memoryCache,omitempty" jsonschema:"omitempty"`
+		HealthCheck      *HealthCheckSpec      `yaml:"healthCheck,omitempty" jsonschema:"omitempty"`
+		OutlierDetection *OutlierDetectionSpec `yaml:"outlierDetection,omitempty" jsonschema:"omitempty"`
+		// SPIFFE makes the pool present SVIDs to servers, and requires
+		// servers to present SVIDs.
+		SPIFFE *spiffe.Spec `yaml:"spiffe,omitempty" jsonschema:"omitempty"`
+		// ClientCertificate is the name of the certificate in the
+		// certificate store presented to servers requiring client
+		// certificates.
+		ClientCertificate string `yaml:"clientCertificate,omitempty" jsonschema:"omitempty"`
 	}
 
 	// PoolStatus is the status of Pool.
 	PoolStatus struct {
-		Stat *httpstat.Status `yaml:"stat"`
+		Stat    *httpstat.Status `yaml:"stat"`
+		Servers []*ServerHealth  `yaml:"servers,omitempty"`
+		Ejected []*EjectedServer `yaml:"ejected,omitempty"`
+	}
+
+	// PoolState is the live state of the pool, the candidates are the
+	// servers from the spec or the service registry.
+	PoolState struct {
+		InFlight   int64            `yaml:"inFlight"`
+		Candidates []*Server        `yaml:"candidates"`
+		Servers    []*ServerHealth  `yaml:"servers,omitempty"`
+		Ejected    []*EjectedServer `yaml:"ejected,omitempty"`
 	}
 )
 
@@ -74,6 +104,10 @@ func (s PoolSpec) Validate() error {
 		return fmt.Errorf("both serviceName and servers are empty")
 	}
 
+	if s.SPIFFE != nil && s.ClientCertificate != "" {
+		return fmt.Errorf("both spiffe and clientCertificate are specified")
+	}
+
 	serversGotWeight := 0
 	for _, server := range s.Servers {
 		if server.Weight > 0 {
@@ -108,6 +142,25 @@ func newPool(spec *PoolSpec, tagPrefix string,
 		memoryCache = memorycache.New(spec.MemoryCache)
 	}
 
+	// NOTE: Pools with SPIFFE or client certificates need their own
+	// clients, since connections with different identities can't be shared.
+	client := globalClient
+	var source *spiffe.Source
+	if spec.SPIFFE != nil || spec.ClientCertificate != "" {
+		transport := globalClient.Transport.(*http.Transport).Clone()
+		if spec.SPIFFE != nil {
+			source = spiffe.Acquire(spec.SPIFFE.WorkloadAPIAddr)
+			transport.TLSClientConfig = spiffe.ClientTLSConfig(source, spec.SPIFFE)
+		} else {
+			transport.TLSClientConfig.GetClientCertificate =
+				certstore.GetClientCertificate(spec.ClientCertificate)
+		}
+		client = &http.Client{
+			Transport:     transport,
+			CheckRedirect: globalClient.CheckRedirect,
+		}
+	}
+
 	return &pool{
 		spec: spec,
 
@@ -115,18 +168,37 @@ func newPool(spec *PoolSpec, tagPrefix string,
 		writeResponse: writeResponse,
 
 		filter:      filter,
-		servers:     newServers(spec),
+		servers:     newServers(spec, client.Transport.(*http.Transport).TLSClientConfig),
 		httpStat:    httpstat.New(),
 		memoryCache: memoryCache,
+
+		client:       client,
+		spiffeSource: source,
 	}
 }
 
 func (p *pool) status() *PoolStatus {
-	s := &PoolStatus{Stat: p.httpStat.Status()}
+	s := &PoolStatus{
+		Stat:    p.httpStat.Status(),
+		Servers: p.servers.health(),
+		Ejected: p.servers.ejectedServers(),
+	}
 	return s
 }
 
+func (p *pool) state() *PoolState {
+	return &PoolState{
+		InFlight:   atomic.LoadInt64(&p.inFlight),
+		Candidates: p.servers.candidateServers(),
+		Servers:    p.servers.health(),
+		Ejected:    p.servers.ejectedServers(),
+	}
+}
+
 func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
+	atomic.AddInt64(&p.inFlight, 1)
+	defer atomic.AddInt64(&p.inFlight, -1)
+
 	addTag := func(subPerfix, msg string) {
 		tag := stringtool.Cat(p.tagPrefix, "#", subPerfix, ": ", msg)
 		ctx.Lock()
@@ -166,10 +238,12 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 			return resultClientError
 		}
 
+		p.servers.record(server, 0, 0)
 		w.SetStatusCode(http.StatusServiceUnavailable)
 		return resultServerError
 	}
 
+	p.servers.record(server, resp.StatusCode, time.Since(req.startTime()))
 	addTag("code", strconv.Itoa(resp.StatusCode))
 
 	ctx.Lock()
@@ -179,6 +253,9 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 	if p.writeResponse {
 		w.SetStatusCode(resp.StatusCode)
 		w.Header().AddFromStd(resp.Header)
+		if cookie := p.servers.stickyCookie(ctx, server); cookie != nil {
+			w.SetCookie(cookie)
+		}
 		w.SetBody(respBody)
 
 		return ""
@@ -209,9 +286,9 @@ func (p *pool) doRequest(ctx context.HTTPContext, req *request) (*http.Response,
 	}
 
 	span := ctx.Span().NewChildWithStart(spanName, req.startTime())
-	span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.std.Header))
+	tracing.InjectHTTPHeader(span, req.std.Header)
 
-	resp, err := globalClient.Do(req.std)
+	resp, err := p.client.Do(req.std)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -276,4 +353,10 @@ func responseMetaSize(resp *http.Response) int {
 
 func (p *pool) close() {
 	p.servers.close()
+	if p.client != globalClient {
+		p.client.CloseIdleConnections()
+	}
+	if p.spiffeSource != nil {
+		p.spiffeSource.Release()
+	}
 }
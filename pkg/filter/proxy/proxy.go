@@ -127,6 +127,13 @@ type (
 		CandidatePools []*PoolStatus `yaml:"candidatePool,omitempty"`
 		MirrorPool     *PoolStatus   `yaml:"mirrorPool,omitempty"`
 	}
+
+	// State is the live state of Proxy.
+	State struct {
+		MainPool       *PoolState   `yaml:"mainPool"`
+		CandidatePools []*PoolState `yaml:"candidatePool,omitempty"`
+		MirrorPool     *PoolState   `yaml:"mirrorPool,omitempty"`
+	}
 )
 
 // Validate validates Spec.
@@ -196,7 +203,6 @@ func (b *Proxy) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Superv
 func (b *Proxy) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	b.Init(pipeSpec, super)
 }
 
@@ -242,6 +248,20 @@ func (b *Proxy) Status() interface{} {
 	return s
 }
 
+// State returns the live state of all pools.
+func (b *Proxy) State() interface{} {
+	s := &State{
+		MainPool: b.mainPool.state(),
+	}
+	for _, p := range b.candidatePools {
+		s.CandidatePools = append(s.CandidatePools, p.state())
+	}
+	if b.mirrorPool != nil {
+		s.MirrorPool = b.mirrorPool.state()
+	}
+	return s
+}
+
 // Close closes Proxy.
 func (b *Proxy) Close() {
 	b.mainPool.close()
@@ -18,8 +18,12 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -46,8 +50,15 @@ const (
 	PolicyIPHash = "ipHash"
 	// PolicyHeaderHash is the policy of header hash.
 	PolicyHeaderHash = "headerHash"
+	// PolicyConsistentHash is the policy of consistent hash.
+	PolicyConsistentHash = "consistentHash"
 
 	retryTimeout = 3 * time.Second
+
+	// virtualNodes is the number of virtual nodes per server in the hash ring.
+	virtualNodes = 160
+
+	defaultStickyCookieName = "EG_SESSION"
 )
 
 type (
@@ -58,6 +69,14 @@ type (
 		service *serviceregistry.Service
 		static  *staticServers
 		done    chan struct{}
+
+		// candidates are all servers from the spec or the service,
+		// static only holds the healthy ones of them.
+		candidates []*Server
+		unhealthy  map[string]struct{}
+		ejected    map[string]struct{}
+		checker    *healthChecker
+		detector   *outlierDetector
 	}
 
 	staticServers struct {
@@ -65,6 +84,16 @@ type (
 		weightsSum int
 		servers    []*Server
 		lb         LoadBalance
+
+		// ring is the sorted hash ring of virtual nodes for consistent hash.
+		ring []ringNode
+		// ids are servers indexed by their ids for sticky sessions.
+		ids map[string]*Server
+	}
+
+	ringNode struct {
+		hash   uint32
+		server *Server
 	}
 
 	// Server is proxy server.
@@ -76,8 +105,22 @@ type (
 
 	// LoadBalance is load balance for multiple servers.
 	LoadBalance struct {
-		Policy        string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
-		HeaderHashKey string `yaml:"headerHashKey" jsonschema:"omitempty"`
+		Policy        string         `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash,enum=consistentHash"`
+		HeaderHashKey string         `yaml:"headerHashKey" jsonschema:"omitempty"`
+		HashKey       *HashKey       `yaml:"hashKey" jsonschema:"omitempty"`
+		StickySession *StickySession `yaml:"stickySession" jsonschema:"omitempty"`
+	}
+
+	// HashKey is the key of requests for consistent hash.
+	HashKey struct {
+		Source string `yaml:"source" jsonschema:"required,enum=header,enum=cookie,enum=query,enum=realIP"`
+		Name   string `yaml:"name" jsonschema:"omitempty"`
+	}
+
+	// StickySession keeps requests of a client to the same server by cookie.
+	StickySession struct {
+		CookieName string `yaml:"cookieName" jsonschema:"omitempty"`
+		MaxAge     int    `yaml:"maxAge" jsonschema:"omitempty,minimum=0"`
 	}
 )
 
@@ -91,10 +134,49 @@ func (lb LoadBalance) Validate() error {
 		return fmt.Errorf("headerHash needs to speficy headerHashKey")
 	}
 
+	if lb.Policy == PolicyConsistentHash && lb.HashKey == nil {
+		return fmt.Errorf("consistentHash needs to specify hashKey")
+	}
+
 	return nil
 }
 
-func newServers(poolSpec *PoolSpec) *servers {
+// Validate validates HashKey.
+func (hk HashKey) Validate() error {
+	if hk.Source != "realIP" && hk.Name == "" {
+		return fmt.Errorf("name of source %s is empty", hk.Source)
+	}
+
+	return nil
+}
+
+// value returns the value of the key in the request.
+func (hk *HashKey) value(ctx context.HTTPContext) string {
+	r := ctx.Request()
+	switch hk.Source {
+	case "header":
+		return r.Header().Get(hk.Name)
+	case "cookie":
+		if cookie, err := r.Cookie(hk.Name); err == nil {
+			return cookie.Value
+		}
+	case "query":
+		return r.Std().URL.Query().Get(hk.Name)
+	case "realIP":
+		return r.RealIP()
+	}
+
+	return ""
+}
+
+func (ss *StickySession) cookieName() string {
+	if ss.CookieName == "" {
+		return defaultStickyCookieName
+	}
+	return ss.CookieName
+}
+
+func newServers(poolSpec *PoolSpec, tlsConfig *tls.Config) *servers {
 	s := &servers{
 		poolSpec: poolSpec,
 		done:     make(chan struct{}),
@@ -102,6 +184,15 @@ func newServers(poolSpec *PoolSpec) *servers {
 
 	s.tryUpdateService()
 
+	if poolSpec.HealthCheck != nil {
+		s.checker = newHealthChecker(poolSpec.HealthCheck, tlsConfig,
+			s.candidateServers, s.updateHealth)
+	}
+	if poolSpec.OutlierDetection != nil {
+		s.detector = newOutlierDetector(poolSpec.OutlierDetection,
+			s.candidateCount, s.updateEjected)
+	}
+
 	go s.run()
 
 	return s
@@ -174,9 +265,8 @@ func (s *servers) tryUpdateService() {
 func (s *servers) useStaticServers() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.static = newStaticServers(s.poolSpec.Servers,
-		s.poolSpec.ServersTags,
-		*s.poolSpec.LoadBalance)
+	s.candidates = s.poolSpec.Servers
+	s.rebuild()
 	s.service = nil
 }
 
@@ -198,13 +288,86 @@ func (s *servers) useService() (*serviceregistry.Service, error) {
 			Weight: snapshotServer.Weight,
 		})
 	}
-	static := newStaticServers(serversInput, s.poolSpec.ServersTags, *s.poolSpec.LoadBalance)
-
-	s.static, s.service = static, service
+	s.candidates, s.service = serversInput, service
+	s.rebuild()
 
 	return service, nil
 }
 
+// rebuild rebuilds static servers from healthy and not ejected candidates,
+// the caller must hold the lock.
+func (s *servers) rebuild() {
+	servers := s.candidates
+	if len(s.unhealthy) > 0 || len(s.ejected) > 0 {
+		servers = make([]*Server, 0, len(s.candidates))
+		for _, server := range s.candidates {
+			if _, exists := s.unhealthy[server.URL]; exists {
+				continue
+			}
+			if _, exists := s.ejected[server.URL]; exists {
+				continue
+			}
+			servers = append(servers, server)
+		}
+
+		// NOTE: It's better to try unhealthy servers than fail all requests.
+		if len(servers) == 0 {
+			logger.Warnf("all servers are unhealthy, use all of them")
+			servers = s.candidates
+		}
+	}
+
+	s.static = newStaticServers(servers, s.poolSpec.ServersTags, *s.poolSpec.LoadBalance)
+}
+
+func (s *servers) candidateServers() []*Server {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.candidates
+}
+
+func (s *servers) updateHealth(unhealthy map[string]struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unhealthy = unhealthy
+	s.rebuild()
+}
+
+func (s *servers) candidateCount() int {
+	return len(s.candidateServers())
+}
+
+func (s *servers) updateEjected(ejected map[string]struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ejected = ejected
+	s.rebuild()
+}
+
+// record records the result of a request for outlier detection.
+func (s *servers) record(server *Server, statusCode int, latency time.Duration) {
+	if s.detector != nil {
+		s.detector.record(server, statusCode, latency)
+	}
+}
+
+func (s *servers) ejectedServers() []*EjectedServer {
+	if s.detector == nil {
+		return nil
+	}
+	return s.detector.status()
+}
+
+func (s *servers) health() []*ServerHealth {
+	if s.checker == nil {
+		return nil
+	}
+	return s.checker.status()
+}
+
 func (s *servers) snapshot() (*staticServers, *serviceregistry.Service) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -232,8 +395,41 @@ func (s *servers) next(ctx context.HTTPContext) (*Server, error) {
 	return static.next(ctx), nil
 }
 
+// stickyCookie returns the cookie to stick the client to the server, it
+// returns nil if sticky session is disabled or the client has stuck to it.
+func (s *servers) stickyCookie(ctx context.HTTPContext, server *Server) *http.Cookie {
+	ss := s.poolSpec.LoadBalance.StickySession
+	if ss == nil {
+		return nil
+	}
+
+	id := serverID(server)
+	if cookie, err := ctx.Request().Cookie(ss.cookieName()); err == nil && cookie.Value == id {
+		return nil
+	}
+
+	return &http.Cookie{
+		Name:     ss.cookieName(),
+		Value:    id,
+		Path:     "/",
+		MaxAge:   ss.MaxAge,
+		HttpOnly: true,
+	}
+}
+
+// serverID returns the opaque id of the server for sticky sessions.
+func serverID(server *Server) string {
+	return fmt.Sprintf("%08x", hashtool.Hash32(server.URL))
+}
+
 func (s *servers) close() {
 	close(s.done)
+	if s.checker != nil {
+		s.checker.close()
+	}
+	if s.detector != nil {
+		s.detector.close()
+	}
 }
 
 func newStaticServers(servers []*Server, tags []string, lb LoadBalance) *staticServers {
@@ -265,6 +461,28 @@ func (ss *staticServers) prepare() {
 	for _, server := range ss.servers {
 		ss.weightsSum += server.Weight
 	}
+
+	if ss.lb.StickySession != nil {
+		ss.ids = make(map[string]*Server, len(ss.servers))
+		for _, server := range ss.servers {
+			ss.ids[serverID(server)] = server
+		}
+	}
+
+	if ss.lb.Policy == PolicyConsistentHash {
+		ss.ring = make([]ringNode, 0, len(ss.servers)*virtualNodes)
+		for _, server := range ss.servers {
+			for i := 0; i < virtualNodes; i++ {
+				ss.ring = append(ss.ring, ringNode{
+					hash:   hashtool.Hash32(server.URL + "#" + strconv.Itoa(i)),
+					server: server,
+				})
+			}
+		}
+		sort.Slice(ss.ring, func(i, j int) bool {
+			return ss.ring[i].hash < ss.ring[j].hash
+		})
+	}
 }
 
 func (ss *staticServers) len() int {
@@ -272,6 +490,15 @@ func (ss *staticServers) len() int {
 }
 
 func (ss *staticServers) next(ctx context.HTTPContext) *Server {
+	if ss.lb.StickySession != nil {
+		cookie, err := ctx.Request().Cookie(ss.lb.StickySession.cookieName())
+		if err == nil {
+			if server, exists := ss.ids[cookie.Value]; exists {
+				return server
+			}
+		}
+	}
+
 	switch ss.lb.Policy {
 	case PolicyRoundRobin:
 		return ss.roundRobin(ctx)
@@ -283,6 +510,8 @@ func (ss *staticServers) next(ctx context.HTTPContext) *Server {
 		return ss.ipHash(ctx)
 	case PolicyHeaderHash:
 		return ss.headerHash(ctx)
+	case PolicyConsistentHash:
+		return ss.consistentHash(ctx)
 	}
 
 	logger.Errorf("BUG: unknown load balance policy: %s", ss.lb.Policy)
@@ -326,3 +555,22 @@ func (ss *staticServers) headerHash(ctx context.HTTPContext) *Server {
 	sum32 := int(hashtool.Hash32(value))
 	return ss.servers[sum32%len(ss.servers)]
 }
+
+// consistentHash chooses the server by the hash ring, so only a few keys
+// are remapped when servers are added or removed.
+func (ss *staticServers) consistentHash(ctx context.HTTPContext) *Server {
+	key := ss.lb.HashKey.value(ctx)
+	if key == "" {
+		return ss.random(ctx)
+	}
+
+	hash := hashtool.Hash32(key)
+	i := sort.Search(len(ss.ring), func(i int) bool {
+		return ss.ring[i].hash >= hash
+	})
+	if i == len(ss.ring) {
+		i = 0
+	}
+
+	return ss.ring[i].server
+}
@@ -18,10 +18,39 @@
 package proxy
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
 )
 
+const tempDir = "/tmp/eg-test"
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(tempDir, "proxy-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "proxy-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+
+	os.Exit(code)
+}
+
 func TestPickservers(t *testing.T) {
 	type fields struct {
 		serversTags []string
@@ -201,3 +230,198 @@ func TestPickservers(t *testing.T) {
 		})
 	}
 }
+
+func newTestContext(header, cookie string) context.HTTPContext {
+	r, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	if header != "" {
+		r.Header.Set("X-User", header)
+	}
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: defaultStickyCookieName, Value: cookie})
+	}
+	return filtertest.NewContext(r)
+}
+
+func TestConsistentHash(t *testing.T) {
+	servers := []*Server{
+		{URL: "http://127.0.0.1:9091"},
+		{URL: "http://127.0.0.1:9092"},
+		{URL: "http://127.0.0.1:9093"},
+	}
+	lb := LoadBalance{
+		Policy:  PolicyConsistentHash,
+		HashKey: &HashKey{Source: "header", Name: "X-User"},
+	}
+
+	ss := newStaticServers(servers, nil, lb)
+	chosen := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		server := ss.next(newTestContext(user, ""))
+		if again := ss.next(newTestContext(user, "")); again != server {
+			t.Fatalf("%s is mapped to both %s and %s", user, server.URL, again.URL)
+		}
+		chosen[user] = server.URL
+	}
+
+	// Only keys of the removed server should be remapped.
+	ss = newStaticServers(servers[:2], nil, lb)
+	for user, url := range chosen {
+		server := ss.next(newTestContext(user, ""))
+		if url != servers[2].URL && server.URL != url {
+			t.Errorf("%s is remapped from %s to %s", user, url, server.URL)
+		}
+	}
+}
+
+func TestStickySession(t *testing.T) {
+	servers := []*Server{
+		{URL: "http://127.0.0.1:9091"},
+		{URL: "http://127.0.0.1:9092"},
+		{URL: "http://127.0.0.1:9093"},
+	}
+	lb := LoadBalance{
+		Policy:        PolicyRoundRobin,
+		StickySession: &StickySession{},
+	}
+	ss := newStaticServers(servers, nil, lb)
+
+	id := serverID(servers[1])
+	for i := 0; i < 10; i++ {
+		if server := ss.next(newTestContext("", id)); server != servers[1] {
+			t.Errorf("request should stick to %s, got %s", servers[1].URL, server.URL)
+		}
+	}
+
+	if server := ss.next(newTestContext("", "unknown")); server == nil {
+		t.Errorf("request with unknown session should be load balanced")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	healthy := true
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	good := &Server{URL: backend.URL}
+	bad := &Server{URL: "http://127.0.0.1:1"}
+	s := &servers{
+		poolSpec: &PoolSpec{
+			Servers:     []*Server{good, bad},
+			LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		},
+		done: make(chan struct{}),
+	}
+	s.useStaticServers()
+
+	hc := &healthChecker{
+		spec: &HealthCheckSpec{
+			Path:               "/healthz",
+			ExpectedBody:       "ok",
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 2,
+		},
+		timeout:  time.Second,
+		client:   &http.Client{Timeout: time.Second},
+		servers:  s.candidateServers,
+		onChange: s.updateHealth,
+		health:   map[string]*ServerHealth{},
+	}
+
+	hc.checkAll()
+	if s.len() != 2 {
+		t.Fatalf("servers should be healthy before reaching the threshold")
+	}
+
+	hc.checkAll()
+	if s.len() != 1 {
+		t.Fatalf("unreachable server should be unhealthy")
+	}
+	for i := 0; i < 5; i++ {
+		if server, _ := s.next(nil); server != good {
+			t.Fatalf("request should be sent to the healthy server, got %s", server.URL)
+		}
+	}
+
+	healthy = false
+	hc.checkAll()
+	hc.checkAll()
+	if s.len() != 2 {
+		t.Fatalf("all servers should be used when all of them are unhealthy")
+	}
+
+	healthy = true
+	hc.checkAll()
+	for _, h := range hc.status() {
+		if h.Healthy != (h.URL == good.URL) {
+			t.Fatalf("unexpected health of %s: %v", h.URL, h.Healthy)
+		}
+	}
+	if s.len() != 1 {
+		t.Fatalf("recovered server should be healthy")
+	}
+}
+
+func TestOutlierDetection(t *testing.T) {
+	servers1 := []*Server{
+		{URL: "http://127.0.0.1:9091"},
+		{URL: "http://127.0.0.1:9092"},
+		{URL: "http://127.0.0.1:9093"},
+	}
+	s := &servers{
+		poolSpec: &PoolSpec{
+			Servers:     servers1,
+			LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+			OutlierDetection: &OutlierDetectionSpec{
+				ConsecutiveErrors:  2,
+				MaxLatency:         "1s",
+				BaseEjectionTime:   "50ms",
+				MaxEjectionTime:    "100ms",
+				MaxEjectionPercent: 50,
+			},
+		},
+		done: make(chan struct{}),
+	}
+	s.useStaticServers()
+	s.detector = newOutlierDetector(s.poolSpec.OutlierDetection, s.candidateCount, s.updateEjected)
+	defer s.close()
+
+	s.record(servers1[0], http.StatusInternalServerError, 0)
+	s.record(servers1[0], http.StatusOK, 0)
+	s.record(servers1[0], 0, 0)
+	if s.len() != 3 {
+		t.Fatalf("errors are not consecutive, server should not be ejected")
+	}
+
+	s.record(servers1[0], http.StatusOK, 2*time.Second)
+	if s.len() != 2 {
+		t.Fatalf("server should be ejected")
+	}
+	for i := 0; i < 5; i++ {
+		if server, _ := s.next(nil); server == servers1[0] {
+			t.Fatalf("ejected server should not be picked")
+		}
+	}
+
+	s.record(servers1[1], http.StatusBadGateway, 0)
+	s.record(servers1[1], http.StatusBadGateway, 0)
+	if s.len() != 2 {
+		t.Fatalf("ejected servers should not exceed max ejection percent")
+	}
+
+	status := s.ejectedServers()
+	if len(status) != 1 || status[0].URL != servers1[0].URL || status[0].Ejections != 1 {
+		t.Fatalf("unexpected ejected servers: %+v", status)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if s.len() != 3 {
+		t.Fatalf("server should be back after the ejection time")
+	}
+}
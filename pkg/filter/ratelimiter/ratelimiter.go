@@ -74,6 +74,13 @@ type (
 		pipeSpec *httppipeline.FilterSpec
 		spec     *Spec
 	}
+
+	// URLState is the state of the rate limiter of a URL rule.
+	URLState struct {
+		URL            string `yaml:"url"`
+		Policy         string `yaml:"policy"`
+		librl.Snapshot `yaml:",inline"`
+	}
 )
 
 // Validate implements custom validation for Spec
@@ -219,8 +226,9 @@ OuterLoop:
 
 			url.Init()
 			rl.bindPolicyToURL(url)
+			// NOTE: The rl is shared with the previous generation,
+			// which still serves its requests in flight until closed.
 			url.rl = prev.rl
-			prev.rl = nil
 			rl.setStateListenerForURL(url)
 			continue OuterLoop
 		}
@@ -288,6 +296,19 @@ func (rl *RateLimiter) Status() interface{} {
 	return nil
 }
 
+// State returns the states of the rate limiters of all URL rules.
+func (rl *RateLimiter) State() interface{} {
+	states := make([]*URLState, 0, len(rl.spec.URLs))
+	for _, u := range rl.spec.URLs {
+		states = append(states, &URLState{
+			URL:      u.ID(),
+			Policy:   u.policy.Name,
+			Snapshot: *u.rl.Snapshot(),
+		})
+	}
+	return states
+}
+
 // Close closes RateLimiter.
 func (rl *RateLimiter) Close() {
 }
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "ratelimiter-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "ratelimiter-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func newSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"policies": []interface{}{map[string]interface{}{
+			"name":               "once",
+			"limitForPeriod":     1,
+			"limitRefreshPeriod": "1h",
+			"timeoutDuration":    "1ms",
+		}},
+		"defaultPolicyRef": "once",
+		"urls": []interface{}{map[string]interface{}{
+			"url": map[string]interface{}{"prefix": "/"},
+		}},
+	}
+}
+
+func TestReloadWithRequestInFlight(t *testing.T) {
+	prev := filtertest.NewFilter(t, &RateLimiter{}, newSpec()).(*RateLimiter)
+	rl := filtertest.InheritFilter(t, &RateLimiter{}, prev, newSpec()).(*RateLimiter)
+	t.Cleanup(rl.Close)
+
+	// The request dispatched to the previous generation before the switch
+	// still runs in it, and the limiter is shared by both generations.
+	ctx := filtertest.NewContext(filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", nil))
+	if result := prev.Handle(ctx); result != "" {
+		t.Errorf("want the request in flight permitted, got %q", result)
+	}
+	prev.Close()
+
+	ctx = filtertest.NewContext(filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", nil))
+	if result := rl.Handle(ctx); result != resultRateLimited {
+		t.Errorf("want %s by the inherited limiter, got %q", resultRateLimited, result)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redactor
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+type (
+	// detector finds sensitive data by a regexp, and an optional
+	// verify function to reduce false positives.
+	detector struct {
+		re     *regexp.Regexp
+		verify func(s string) bool
+	}
+
+	compiledRule struct {
+		re          *regexp.Regexp
+		replacement string
+	}
+
+	masker struct {
+		maskChar  string
+		keepLast  int
+		detectors []*detector
+		rules     []*compiledRule
+		jsonPaths []string
+	}
+)
+
+var builtinDetectors = map[string]*detector{
+	"email": {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	"creditCard": {
+		re:     regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		verify: luhnValid,
+	},
+	"ssn": {
+		re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	},
+	"chinaID": {
+		re:     regexp.MustCompile(`\b\d{17}[\dXx]\b`),
+		verify: chinaIDValid,
+	},
+}
+
+// luhnValid checks the number by the Luhn algorithm,
+// separators(space and hyphen) are ignored.
+func luhnValid(s string) bool {
+	sum, double, digits := 0, false, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
+
+// chinaIDValid checks the checksum of the Chinese resident identity card number.
+func chinaIDValid(s string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checksums := "10X98765432"
+
+	sum := 0
+	for i, w := range weights {
+		sum += int(s[i]-'0') * w
+	}
+
+	return strings.ToUpper(s[17:]) == string(checksums[sum%11])
+}
+
+func (m *masker) touchBody() bool {
+	return len(m.detectors) != 0 || len(m.rules) != 0 || len(m.jsonPaths) != 0
+}
+
+// mask replaces all characters of s except the last keepLast ones.
+func (m *masker) mask(s string) string {
+	runes := []rune(s)
+	keep := m.keepLast
+	if keep > len(runes) {
+		keep = len(runes)
+	}
+
+	return strings.Repeat(m.maskChar, len(runes)-keep) + string(runes[len(runes)-keep:])
+}
+
+func (m *masker) redact(body []byte) []byte {
+	if len(m.jsonPaths) != 0 {
+		body = m.redactJSON(body)
+	}
+
+	for _, d := range m.detectors {
+		body = d.re.ReplaceAllFunc(body, func(match []byte) []byte {
+			if d.verify != nil && !d.verify(string(match)) {
+				return match
+			}
+			return []byte(m.mask(string(match)))
+		})
+	}
+
+	for _, r := range m.rules {
+		if r.replacement != "" {
+			body = r.re.ReplaceAll(body, []byte(r.replacement))
+			continue
+		}
+		body = r.re.ReplaceAllFunc(body, func(match []byte) []byte {
+			return []byte(m.mask(string(match)))
+		})
+	}
+
+	return body
+}
+
+// redactJSON masks fields addressed by dot-separated paths,
+// `*` matches all keys of an object or all elements of an array.
+// The body is returned untouched if it is not valid JSON.
+func (m *masker) redactJSON(body []byte) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+
+	for _, path := range m.jsonPaths {
+		doc = m.maskPath(doc, strings.Split(path, "."))
+	}
+
+	buff, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+
+	return buff
+}
+
+func (m *masker) maskPath(node interface{}, keys []string) interface{} {
+	if len(keys) == 0 {
+		switch v := node.(type) {
+		case nil:
+			return nil
+		case string:
+			return m.mask(v)
+		case map[string]interface{}, []interface{}:
+			return m.maskChar
+		default:
+			buff, _ := json.Marshal(v)
+			return m.mask(string(buff))
+		}
+	}
+
+	key, rest := keys[0], keys[1:]
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if key == "*" {
+			for k, child := range v {
+				v[k] = m.maskPath(child, rest)
+			}
+		} else if child, exists := v[key]; exists {
+			v[key] = m.maskPath(child, rest)
+		}
+	case []interface{}:
+		if key == "*" {
+			for i, child := range v {
+				v[i] = m.maskPath(child, rest)
+			}
+		}
+	}
+
+	return node
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redactor
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDetectors(t *testing.T) {
+	m := &masker{
+		maskChar: "*",
+		keepLast: 4,
+		detectors: []*detector{
+			builtinDetectors["email"],
+			builtinDetectors["creditCard"],
+			builtinDetectors["chinaID"],
+		},
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"mail: bob@example.com", "mail: ***********.com"},
+		{"card 4111 1111 1111 1111 ok", "card ***************1111 ok"},
+		// Fails the Luhn check.
+		{"card 4111 1111 1111 1112 ok", "card 4111 1111 1111 1112 ok"},
+		{"id 11010519491231002X", "id **************002X"},
+		// Wrong checksum.
+		{"id 110105194912310021", "id 110105194912310021"},
+	}
+
+	for _, test := range tests {
+		got := string(m.redact([]byte(test.input)))
+		if got != test.want {
+			t.Errorf("redact %q: want %q, got %q", test.input, test.want, got)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	m := &masker{
+		maskChar: "#",
+		rules: []*compiledRule{
+			{re: regexp.MustCompile(`token=\w+`), replacement: "token=<redacted>"},
+			{re: regexp.MustCompile(`\d{6}`)},
+		},
+	}
+
+	got := string(m.redact([]byte("token=abc&code=123456")))
+	want := "token=<redacted>&code=######"
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestJSONPaths(t *testing.T) {
+	m := &masker{
+		maskChar:  "*",
+		jsonPaths: []string{"password", "cards.*.number", "missing.field"},
+	}
+
+	got := string(m.redact([]byte(`{"cards":[{"number":"1234"},{"number":5678}],"password":"secret"}`)))
+	want := `{"cards":[{"number":"****"},{"number":"****"}],"password":"******"}`
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	notJSON := "password=secret"
+	if got := string(m.redact([]byte(notJSON))); got != notJSON {
+		t.Errorf("want %s, got %s", notJSON, got)
+	}
+}
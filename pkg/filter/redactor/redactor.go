@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redactor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of Redactor.
+	Kind = "Redactor"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+	targetBoth     = "both"
+
+	defaultMaxBodySize = 4 * 1024 * 1024
+	defaultMaskChar    = "*"
+)
+
+var (
+	results = []string{}
+)
+
+func init() {
+	httppipeline.Register(&Redactor{})
+}
+
+type (
+	// Redactor is filter Redactor.
+	Redactor struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		masker *masker
+	}
+
+	// Spec describes the Redactor.
+	Spec struct {
+		Target      string   `yaml:"target" jsonschema:"omitempty,enum=request,enum=response,enum=both"`
+		Detectors   []string `yaml:"detectors" jsonschema:"omitempty,uniqueItems=true"`
+		Rules       []*Rule  `yaml:"rules" jsonschema:"omitempty"`
+		JSONPaths   []string `yaml:"jsonPaths" jsonschema:"omitempty,uniqueItems=true"`
+		Headers     []string `yaml:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		MaskChar    string   `yaml:"maskChar" jsonschema:"omitempty"`
+		KeepLast    int      `yaml:"keepLast" jsonschema:"omitempty,minimum=0"`
+		MaxBodySize int64    `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Rule is a custom redaction rule.
+	Rule struct {
+		Name        string `yaml:"name" jsonschema:"required"`
+		Regexp      string `yaml:"regexp" jsonschema:"required,format=regexp"`
+		Replacement string `yaml:"replacement" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	for _, d := range s.Detectors {
+		if _, exists := builtinDetectors[d]; !exists {
+			return fmt.Errorf("unknown detector %s", d)
+		}
+	}
+
+	if len(s.Detectors) == 0 && len(s.Rules) == 0 &&
+		len(s.JSONPaths) == 0 && len(s.Headers) == 0 {
+		return fmt.Errorf("none of detectors, rules, jsonPaths and headers is specified")
+	}
+
+	if len([]rune(s.MaskChar)) > 1 {
+		return fmt.Errorf("maskChar must be a single character")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of Redactor.
+func (r *Redactor) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of Redactor.
+func (r *Redactor) DefaultSpec() interface{} {
+	return &Spec{
+		Target:      targetRequest,
+		MaskChar:    defaultMaskChar,
+		MaxBodySize: defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of Redactor.
+func (r *Redactor) Description() string {
+	return "Redactor masks sensitive data such as emails and credit cards in bodies and headers."
+}
+
+// Results returns the results of Redactor.
+func (r *Redactor) Results() []string {
+	return results
+}
+
+// Init initializes Redactor.
+func (r *Redactor) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	r.pipeSpec, r.spec, r.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	r.reload()
+}
+
+// Inherit inherits previous generation of Redactor.
+func (r *Redactor) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	r.Init(pipeSpec, super)
+}
+
+func (r *Redactor) reload() {
+	m := &masker{
+		maskChar:  r.spec.MaskChar,
+		keepLast:  r.spec.KeepLast,
+		jsonPaths: r.spec.JSONPaths,
+	}
+	if m.maskChar == "" {
+		m.maskChar = defaultMaskChar
+	}
+
+	for _, name := range r.spec.Detectors {
+		m.detectors = append(m.detectors, builtinDetectors[name])
+	}
+	for _, rule := range r.spec.Rules {
+		m.rules = append(m.rules, &compiledRule{
+			re:          regexp.MustCompile(rule.Regexp),
+			replacement: rule.Replacement,
+		})
+	}
+
+	r.masker = m
+}
+
+// Handle redacts HTTPContext.
+func (r *Redactor) Handle(ctx context.HTTPContext) string {
+	if r.spec.Target != targetResponse {
+		r.redactRequest(ctx)
+	}
+
+	result := ctx.CallNextHandler("")
+
+	if r.spec.Target == targetResponse || r.spec.Target == targetBoth {
+		r.redactResponse(ctx)
+	}
+
+	return result
+}
+
+func (r *Redactor) redactRequest(ctx context.HTTPContext) {
+	req := ctx.Request()
+	for _, key := range r.spec.Headers {
+		if v := req.Header().Get(key); v != "" {
+			req.Header().Set(key, r.masker.mask(v))
+		}
+	}
+
+	if !r.masker.touchBody() {
+		return
+	}
+
+	body, err := r.readBody(req.Body())
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("redactor: ", err.Error()))
+		req.SetBody(io.MultiReader(bytes.NewReader(body), req.Body()))
+		return
+	}
+
+	req.SetBody(bytes.NewReader(r.masker.redact(body)))
+}
+
+func (r *Redactor) redactResponse(ctx context.HTTPContext) {
+	w := ctx.Response()
+	for _, key := range r.spec.Headers {
+		if v := w.Header().Get(key); v != "" {
+			w.Header().Set(key, r.masker.mask(v))
+		}
+	}
+
+	if !r.masker.touchBody() || w.Body() == nil {
+		return
+	}
+
+	body, err := r.readBody(w.Body())
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("redactor: ", err.Error()))
+		w.SetBody(io.MultiReader(bytes.NewReader(body), w.Body()))
+		return
+	}
+
+	body = r.masker.redact(body)
+	w.Header().Del("Content-Length")
+	w.SetBody(bytes.NewReader(body))
+}
+
+// readBody reads the whole body, it returns the bytes read so far
+// alongside the error, so the caller is able to put them back before
+// the rest of the body, which is streamed without being buffered.
+func (r *Redactor) readBody(body io.Reader) ([]byte, error) {
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, body, r.spec.MaxBodySize+1)
+	if err != nil && err != io.EOF {
+		return buff.Bytes(), fmt.Errorf("read body failed: %v", err)
+	}
+
+	if written > r.spec.MaxBodySize {
+		return buff.Bytes(), fmt.Errorf("body exceed %dB, skip redacting", r.spec.MaxBodySize)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Status returns status.
+func (r *Redactor) Status() interface{} { return nil }
+
+// Close closes Redactor.
+func (r *Redactor) Close() {}
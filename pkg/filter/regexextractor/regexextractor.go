@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package regexextractor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of RegexExtractor.
+	Kind = "RegexExtractor"
+
+	resultNotMatched = "notMatched"
+
+	sourceHeader = "header"
+	sourceQuery  = "query"
+	sourcePath   = "path"
+	sourceBody   = "body"
+
+	defaultHeaderPrefix = "X-EG-Capture-"
+	defaultMaxBodySize  = 1024 * 1024
+)
+
+var (
+	results = []string{resultNotMatched}
+)
+
+func init() {
+	httppipeline.Register(&RegexExtractor{})
+}
+
+type (
+	// RegexExtractor is filter RegexExtractor.
+	RegexExtractor struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		re *regexp.Regexp
+	}
+
+	// Spec describes the RegexExtractor.
+	Spec struct {
+		Source        string `yaml:"source" jsonschema:"required,enum=header,enum=query,enum=path,enum=body"`
+		Key           string `yaml:"key" jsonschema:"omitempty"`
+		Regexp        string `yaml:"regexp" jsonschema:"required,format=regexp"`
+		MultiMatch    bool   `yaml:"multiMatch" jsonschema:"omitempty"`
+		HeaderPrefix  string `yaml:"headerPrefix" jsonschema:"omitempty"`
+		MaxBodySize   int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		NotMatchedErr bool   `yaml:"notMatchedErr" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	switch s.Source {
+	case sourceHeader, sourceQuery:
+		if s.Key == "" {
+			return fmt.Errorf("key is required for source %s", s.Source)
+		}
+	}
+
+	re, err := regexp.Compile(s.Regexp)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("regexp %s has no named capture group", s.Regexp)
+}
+
+// Kind returns the kind of RegexExtractor.
+func (re *RegexExtractor) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of RegexExtractor.
+func (re *RegexExtractor) DefaultSpec() interface{} {
+	return &Spec{
+		HeaderPrefix: defaultHeaderPrefix,
+		MaxBodySize:  defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of RegexExtractor.
+func (re *RegexExtractor) Description() string {
+	return "RegexExtractor extracts named capture groups of a regexp into request headers."
+}
+
+// Results returns the results of RegexExtractor.
+func (re *RegexExtractor) Results() []string {
+	return results
+}
+
+// Produces returns the headers set by RegexExtractor, one for each named
+// capture group.
+func (re *RegexExtractor) Produces(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	spec := pipeSpec.FilterSpec().(*Spec)
+	typ := httppipeline.ValueString
+	if spec.MultiMatch {
+		typ = httppipeline.ValueList
+	}
+
+	var values []*httppipeline.Value
+	for _, name := range regexp.MustCompile(spec.Regexp).SubexpNames() {
+		if name != "" {
+			values = append(values, &httppipeline.Value{Header: spec.HeaderPrefix + name, Type: typ})
+		}
+	}
+	return values
+}
+
+// Consumes returns the header matched by RegexExtractor.
+func (re *RegexExtractor) Consumes(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	spec := pipeSpec.FilterSpec().(*Spec)
+	if spec.Source != sourceHeader {
+		return nil
+	}
+	return []*httppipeline.Value{{Header: spec.Key, Type: httppipeline.ValueString}}
+}
+
+// Init initializes RegexExtractor.
+func (re *RegexExtractor) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	re.pipeSpec, re.spec, re.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	re.reload()
+}
+
+// Inherit inherits previous generation of RegexExtractor.
+func (re *RegexExtractor) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	re.Init(pipeSpec, super)
+}
+
+func (re *RegexExtractor) reload() {
+	re.re = regexp.MustCompile(re.spec.Regexp)
+}
+
+// Handle extracts capture groups from HTTPContext.
+func (re *RegexExtractor) Handle(ctx context.HTTPContext) string {
+	result := re.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (re *RegexExtractor) source(ctx context.HTTPContext) (string, error) {
+	r := ctx.Request()
+
+	switch re.spec.Source {
+	case sourceHeader:
+		return r.Header().Get(re.spec.Key), nil
+	case sourceQuery:
+		values, err := url.ParseQuery(r.Query())
+		if err != nil {
+			return "", err
+		}
+		return values.Get(re.spec.Key), nil
+	case sourcePath:
+		return r.Path(), nil
+	case sourceBody:
+		buff := bytes.NewBuffer(nil)
+		written, err := io.CopyN(buff, r.Body(), re.spec.MaxBodySize+1)
+
+		// NOTE: Put back what we have read whatever happens next.
+		if err != nil && err != io.EOF {
+			r.SetBody(io.MultiReader(buff, r.Body()))
+			return "", fmt.Errorf("read body failed: %v", err)
+		}
+		if written > re.spec.MaxBodySize {
+			r.SetBody(io.MultiReader(buff, r.Body()))
+			return "", fmt.Errorf("body exceed %dB", re.spec.MaxBodySize)
+		}
+		r.SetBody(bytes.NewReader(buff.Bytes()))
+
+		return buff.String(), nil
+	}
+
+	return "", fmt.Errorf("BUG: unknown source %s", re.spec.Source)
+}
+
+func (re *RegexExtractor) handle(ctx context.HTTPContext) string {
+	input, err := re.source(ctx)
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("regexExtractor: ", err.Error()))
+		return re.notMatched()
+	}
+
+	var matches [][]string
+	if re.spec.MultiMatch {
+		matches = re.re.FindAllStringSubmatch(input, -1)
+	} else if match := re.re.FindStringSubmatch(input); match != nil {
+		matches = [][]string{match}
+	}
+
+	if len(matches) == 0 {
+		ctx.AddTag("regexExtractor: not matched")
+		return re.notMatched()
+	}
+
+	h := ctx.Request().Header()
+	names := re.re.SubexpNames()
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		key := re.spec.HeaderPrefix + name
+		h.Del(key)
+		for _, match := range matches {
+			h.Add(key, match[i])
+		}
+	}
+
+	return ""
+}
+
+func (re *RegexExtractor) notMatched() string {
+	if re.spec.NotMatchedErr {
+		return resultNotMatched
+	}
+	return ""
+}
+
+// Status returns status.
+func (re *RegexExtractor) Status() interface{} { return nil }
+
+// Close closes RegexExtractor.
+func (re *RegexExtractor) Close() {}
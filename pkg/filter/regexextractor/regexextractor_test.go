@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package regexextractor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "regexextractor-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "regexextractor-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func TestExtract(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		spec   map[string]interface{}
+		url    string
+		body   string
+		header map[string]string
+		result string
+		want   map[string][]string
+	}{
+		{
+			name:   "header",
+			spec:   map[string]interface{}{"source": "header", "key": "X-Order", "regexp": `^(?P<region>\w+)-(?P<id>\d+)$`},
+			url:    "http://127.0.0.1/",
+			header: map[string]string{"X-Order": "eu-42"},
+			want:   map[string][]string{"X-Eg-Capture-Region": {"eu"}, "X-Eg-Capture-Id": {"42"}},
+		},
+		{
+			name: "query",
+			spec: map[string]interface{}{"source": "query", "key": "user", "regexp": `^(?P<user>[a-z]+)@`},
+			url:  "http://127.0.0.1/?user=alice%40example.com",
+			want: map[string][]string{"X-Eg-Capture-User": {"alice"}},
+		},
+		{
+			name: "body",
+			spec: map[string]interface{}{"source": "body", "regexp": `"sku":\s*"(?P<sku>[^"]+)"`, "multiMatch": true},
+			url:  "http://127.0.0.1/",
+			body: `[{"sku": "a-1"}, {"sku": "b-2"}]`,
+			want: map[string][]string{"X-Eg-Capture-Sku": {"a-1", "b-2"}},
+		},
+		{
+			name:   "header prefix",
+			spec:   map[string]interface{}{"source": "path", "regexp": `^/orders/(?P<id>\d+)`, "headerPrefix": "X-Order-"},
+			url:    "http://127.0.0.1/orders/42",
+			header: map[string]string{"X-Order-Id": "forged"},
+			want:   map[string][]string{"X-Order-Id": {"42"}},
+		},
+		{
+			name:   "not matched",
+			spec:   map[string]interface{}{"source": "header", "key": "X-Order", "regexp": `^(?P<id>\d+)$`},
+			url:    "http://127.0.0.1/",
+			header: map[string]string{"X-Order": "none"},
+			want:   map[string][]string{"X-Eg-Capture-Id": nil},
+		},
+		{
+			name:   "not matched error",
+			spec:   map[string]interface{}{"source": "header", "key": "X-Order", "regexp": `^(?P<id>\d+)$`, "notMatchedErr": true},
+			url:    "http://127.0.0.1/",
+			result: resultNotMatched,
+			want:   map[string][]string{"X-Eg-Capture-Id": nil},
+		},
+		{
+			name:   "large body",
+			spec:   map[string]interface{}{"source": "body", "regexp": `(?P<id>\d+)`, "maxBodySize": 4, "notMatchedErr": true},
+			url:    "http://127.0.0.1/",
+			body:   "order 42",
+			result: resultNotMatched,
+			want:   map[string][]string{"X-Eg-Capture-Id": nil},
+		},
+	} {
+		re := filtertest.NewFilter(t, &RegexExtractor{}, c.spec)
+		ctx := filtertest.NewContext(filtertest.NewRequest(http.MethodPost, c.url, c.body, c.header))
+
+		if result := re.Handle(ctx); result != c.result {
+			t.Errorf("%s: want result %q, got %q", c.name, c.result, result)
+		}
+		for key, want := range c.want {
+			if got := ctx.Request().Header().GetAll(key); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: want %s %v, got %v", c.name, key, want, got)
+			}
+		}
+
+		// NOTE: The body is kept for the next filter.
+		if body, _ := ioutil.ReadAll(ctx.Request().Body()); string(body) != c.body {
+			t.Errorf("%s: want body %q kept, got %q", c.name, c.body, body)
+		}
+	}
+}
+
+// brokenReader returns the data, then fails like a client gone away.
+type brokenReader struct{ data io.Reader }
+
+func (r *brokenReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, fmt.Errorf("connection reset")
+	}
+	return n, err
+}
+
+func TestBrokenBody(t *testing.T) {
+	re := filtertest.NewFilter(t, &RegexExtractor{}, map[string]interface{}{
+		"source":        "body",
+		"regexp":        `(?P<id>\d+)`,
+		"notMatchedErr": true,
+	})
+
+	r := filtertest.NewRequest(http.MethodPost, "http://127.0.0.1/", "", nil)
+	r.Body = ioutil.NopCloser(&brokenReader{strings.NewReader("order 42")})
+	ctx := filtertest.NewContext(r)
+
+	if result := re.Handle(ctx); result != resultNotMatched {
+		t.Errorf("want %s on broken body, got %q", resultNotMatched, result)
+	}
+	if body, _ := ioutil.ReadAll(ctx.Request().Body()); string(body) != "order 42" {
+		t.Errorf("want the read part of body kept, got %q", body)
+	}
+}
@@ -162,7 +162,6 @@ func (rf *RemoteFilter) Init(pipeSpec *httppipeline.FilterSpec, super *superviso
 func (rf *RemoteFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	rf.Init(pipeSpec, super)
 }
 
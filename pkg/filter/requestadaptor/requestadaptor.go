@@ -92,7 +92,6 @@ func (ra *RequestAdaptor) Init(pipeSpec *httppipeline.FilterSpec, super *supervi
 func (ra *RequestAdaptor) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	ra.Init(pipeSpec, super)
 }
 
@@ -86,7 +86,6 @@ func (ra *ResponseAdaptor) Init(pipeSpec *httppipeline.FilterSpec, super *superv
 func (ra *ResponseAdaptor) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	ra.Init(pipeSpec, super)
 }
 
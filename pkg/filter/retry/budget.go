@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBudgetRatio         = 0.2
+	defaultMinRetriesPerSecond = 10
+	defaultBudgetTTL           = 10 * time.Second
+
+	budgetSlots = 10
+)
+
+type (
+	// BudgetSpec describes the retry budget, which limits retries to a
+	// ratio of requests in a sliding window, to prevent retry storms when
+	// the upstream is down.
+	BudgetSpec struct {
+		Ratio               float64 `yaml:"ratio" jsonschema:"omitempty,minimum=0"`
+		MinRetriesPerSecond int     `yaml:"minRetriesPerSecond" jsonschema:"omitempty,minimum=0"`
+		TTL                 string  `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+	}
+
+	budget struct {
+		spec *BudgetSpec
+		ttl  time.Duration
+		slot time.Duration
+
+		mutex sync.Mutex
+		slots [budgetSlots]budgetSlot
+		stat  Status
+	}
+
+	budgetSlot struct {
+		index    int64
+		requests uint64
+		retries  uint64
+	}
+)
+
+// newBudget creates a budget, the budget is unlimited if spec is nil.
+func newBudget(spec *BudgetSpec) *budget {
+	b := &budget{spec: spec}
+	if spec == nil {
+		return b
+	}
+
+	if spec.Ratio == 0 {
+		spec.Ratio = defaultBudgetRatio
+	}
+	if spec.MinRetriesPerSecond == 0 {
+		spec.MinRetriesPerSecond = defaultMinRetriesPerSecond
+	}
+	b.ttl = parseDuration(spec.TTL, defaultBudgetTTL)
+	b.slot = b.ttl / budgetSlots
+
+	return b
+}
+
+// current returns the slot of now, it resets the slot if it is expired.
+func (b *budget) current(now time.Time) *budgetSlot {
+	index := now.UnixNano() / int64(b.slot)
+	s := &b.slots[index%budgetSlots]
+	if s.index != index {
+		*s = budgetSlot{index: index}
+	}
+	return s
+}
+
+// sum sums requests and retries in the window.
+func (b *budget) sum(now time.Time) (requests, retries uint64) {
+	index := now.UnixNano() / int64(b.slot)
+	for i := range b.slots {
+		s := &b.slots[i]
+		if index-s.index < budgetSlots {
+			requests += s.requests
+			retries += s.retries
+		}
+	}
+	return
+}
+
+func (b *budget) deposit() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stat.Requests++
+	if b.spec != nil {
+		b.current(time.Now()).requests++
+	}
+}
+
+// withdraw returns true if the retry is allowed by the budget.
+func (b *budget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.spec == nil {
+		b.stat.Retries++
+		return true
+	}
+
+	now := time.Now()
+	requests, retries := b.sum(now)
+	allowed := b.spec.Ratio*float64(requests) + float64(b.spec.MinRetriesPerSecond)*b.ttl.Seconds()
+	if float64(retries) >= allowed {
+		b.stat.BudgetExhausted++
+		return false
+	}
+
+	b.current(now).retries++
+	b.stat.Retries++
+	return true
+}
+
+func (b *budget) status() *Status {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	s := b.stat
+	return &s
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of Retry.
+	Kind = "Retry"
+
+	defaultMaxAttempts  = 3
+	defaultBaseInterval = 100 * time.Millisecond
+	defaultMaxInterval  = 10 * time.Second
+)
+
+var (
+	results = []string{}
+)
+
+func init() {
+	httppipeline.Register(&Retry{})
+}
+
+type (
+	// Retry re-executes the filters after it on retryable results.
+	Retry struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		results      map[string]struct{}
+		statusCodes  map[int]struct{}
+		baseInterval time.Duration
+		maxInterval  time.Duration
+		budget       *budget
+	}
+
+	// Spec describes the Retry.
+	Spec struct {
+		MaxAttempts  int         `yaml:"maxAttempts" jsonschema:"omitempty,minimum=1"`
+		RetryOn      RetryOnSpec `yaml:"retryOn" jsonschema:"required"`
+		BaseInterval string      `yaml:"baseInterval" jsonschema:"omitempty,format=duration"`
+		MaxInterval  string      `yaml:"maxInterval" jsonschema:"omitempty,format=duration"`
+		Budget       *BudgetSpec `yaml:"budget" jsonschema:"omitempty"`
+	}
+
+	// RetryOnSpec describes the retryable outcomes of the filters.
+	RetryOnSpec struct {
+		Results     []string `yaml:"results" jsonschema:"omitempty,uniqueItems=true"`
+		StatusCodes []int    `yaml:"statusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+	}
+
+	// Status is the status of Retry.
+	Status struct {
+		Requests        uint64 `yaml:"requests"`
+		Retries         uint64 `yaml:"retries"`
+		BudgetExhausted uint64 `yaml:"budgetExhausted"`
+	}
+)
+
+// Validate validates RetryOnSpec.
+func (s RetryOnSpec) Validate() error {
+	if len(s.Results) == 0 && len(s.StatusCodes) == 0 {
+		return fmt.Errorf("both results and statusCodes are empty")
+	}
+
+	return nil
+}
+
+func parseDuration(d string, dflt time.Duration) time.Duration {
+	if d == "" {
+		return dflt
+	}
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return dflt
+	}
+	return duration
+}
+
+// Kind returns the kind of Retry.
+func (r *Retry) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Retry.
+func (r *Retry) DefaultSpec() interface{} {
+	return &Spec{
+		MaxAttempts: defaultMaxAttempts,
+	}
+}
+
+// Description returns the description of Retry.
+func (r *Retry) Description() string {
+	return "Retry re-executes the filters after it on retryable results with a retry budget."
+}
+
+// Results returns the results of Retry.
+func (r *Retry) Results() []string {
+	return results
+}
+
+// Init initializes Retry.
+func (r *Retry) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	r.pipeSpec, r.spec, r.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	r.reload()
+}
+
+// Inherit inherits previous generation of Retry.
+func (r *Retry) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	r.Init(pipeSpec, super)
+}
+
+func (r *Retry) reload() {
+	r.results = map[string]struct{}{}
+	for _, result := range r.spec.RetryOn.Results {
+		r.results[result] = struct{}{}
+	}
+
+	r.statusCodes = map[int]struct{}{}
+	for _, code := range r.spec.RetryOn.StatusCodes {
+		r.statusCodes[code] = struct{}{}
+	}
+
+	r.baseInterval = parseDuration(r.spec.BaseInterval, defaultBaseInterval)
+	r.maxInterval = parseDuration(r.spec.MaxInterval, defaultMaxInterval)
+	r.budget = newBudget(r.spec.Budget)
+}
+
+// Handle retries the filters after Retry.
+func (r *Retry) Handle(ctx context.HTTPContext) string {
+	r.budget.deposit()
+
+	data, err := ioutil.ReadAll(ctx.Request().Body())
+	if err != nil {
+		logger.Errorf("%s: read request body failed: %v", r.pipeSpec.Name(), err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		ctx.Request().SetBody(bytes.NewReader(data))
+
+		result := ctx.CallNextHandler("")
+		if !r.retryable(ctx, result) {
+			if attempt > 1 {
+				ctx.AddTag(fmt.Sprintf("retry: succeeded after %d attempts", attempt))
+			}
+			return result
+		}
+
+		if attempt >= r.spec.MaxAttempts {
+			ctx.AddTag(fmt.Sprintf("retry: failed after %d attempts", attempt))
+			return result
+		}
+
+		if !r.budget.withdraw() {
+			ctx.AddTag(fmt.Sprintf("retry: budget exhausted after %d attempts", attempt))
+			return result
+		}
+
+		timer := time.NewTimer(r.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *Retry) retryable(ctx context.HTTPContext, result string) bool {
+	if result != "" {
+		if _, exists := r.results[result]; exists {
+			return true
+		}
+	}
+
+	_, exists := r.statusCodes[ctx.Response().StatusCode()]
+	return exists
+}
+
+// backoff returns the interval before the next attempt, it is exponential
+// to the attempts with jitters, and capped by maxInterval.
+func (r *Retry) backoff(attempt int) time.Duration {
+	d := r.baseInterval << uint(attempt-1)
+	if d <= 0 || d > r.maxInterval {
+		d = r.maxInterval
+	}
+
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// Status returns status.
+func (r *Retry) Status() interface{} {
+	return r.budget.status()
+}
+
+// Close closes Retry.
+func (r *Retry) Close() {}
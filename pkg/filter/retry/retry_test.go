@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+)
+
+func newRetry(t *testing.T, spec map[string]interface{}) *Retry {
+	return filtertest.NewFilter(t, &Retry{}, spec).(*Retry)
+}
+
+// handle calls Retry with the downstream returning results in order.
+func handle(r *Retry, downstream []string) int {
+	ctx := filtertest.NewContext(filtertest.NewRequest(http.MethodPost, "http://127.0.0.1/", "body", nil))
+
+	calls := 0
+	ctx.SetHandlerCaller(func(lastResult string) string {
+		result := downstream[calls]
+		calls++
+		return result
+	})
+
+	r.Handle(ctx)
+	return calls
+}
+
+func TestRetry(t *testing.T) {
+	r := newRetry(t, map[string]interface{}{
+		"maxAttempts":  3,
+		"baseInterval": "1ms",
+		"retryOn": map[string]interface{}{
+			"results": []string{"serverError"},
+		},
+	})
+
+	cases := []struct {
+		downstream []string
+		calls      int
+	}{
+		{downstream: []string{""}, calls: 1},
+		{downstream: []string{"clientError"}, calls: 1},
+		{downstream: []string{"serverError", ""}, calls: 2},
+		{downstream: []string{"serverError", "serverError", "serverError"}, calls: 3},
+	}
+
+	for i, c := range cases {
+		if calls := handle(r, c.downstream); calls != c.calls {
+			t.Errorf("case %d: downstream should be called %d times, got %d", i, c.calls, calls)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	r := newRetry(t, map[string]interface{}{
+		"maxAttempts":  2,
+		"baseInterval": "1ms",
+		"retryOn": map[string]interface{}{
+			"results": []string{"serverError"},
+		},
+		"budget": map[string]interface{}{
+			"ratio":               0.5,
+			"minRetriesPerSecond": 1,
+			"ttl":                 "10s",
+		},
+	})
+
+	// 10 retries are allowed by minRetriesPerSecond, and 11 more by
+	// ratio after 22 requests.
+	for i := 0; i < 21; i++ {
+		handle(r, []string{"serverError", "serverError"})
+	}
+	if calls := handle(r, []string{"serverError", "serverError"}); calls != 1 {
+		t.Errorf("retry should be rejected by the budget")
+	}
+
+	s := r.Status().(*Status)
+	if s.Requests != 22 || s.Retries != 21 || s.BudgetExhausted != 1 {
+		t.Errorf("unexpected status: %+v", s)
+	}
+}
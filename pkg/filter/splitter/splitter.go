@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package splitter
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/hashtool"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of Splitter.
+	Kind = "Splitter"
+
+	resultBranchNotFound = "branchNotFound"
+
+	sourceHeader = "header"
+	sourceCookie = "cookie"
+	sourceQuery  = "query"
+	sourceRealIP = "realIP"
+)
+
+var (
+	results = []string{resultBranchNotFound}
+)
+
+func init() {
+	httppipeline.Register(&Splitter{})
+}
+
+type (
+	// Splitter splits traffic to branch pipelines by weights.
+	Splitter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		totalWeight int
+	}
+
+	// Spec describes the Splitter.
+	Spec struct {
+		Branches []*Branch  `yaml:"branches" jsonschema:"required,minItems=1"`
+		Sticky   *StickyKey `yaml:"sticky" jsonschema:"omitempty"`
+	}
+
+	// Branch is a branch of traffic.
+	Branch struct {
+		Name     string `yaml:"name" jsonschema:"required"`
+		Pipeline string `yaml:"pipeline" jsonschema:"required"`
+		Weight   int    `yaml:"weight" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// StickyKey is the key to hash, requests with the same key
+	// always go to the same branch if weights are not changed.
+	StickyKey struct {
+		Source string `yaml:"source" jsonschema:"required,enum=header,enum=cookie,enum=query,enum=realIP"`
+		Name   string `yaml:"name" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	names := map[string]struct{}{}
+	total := 0
+	for _, b := range s.Branches {
+		if _, exists := names[b.Name]; exists {
+			return fmt.Errorf("repeated branch name: %s", b.Name)
+		}
+		names[b.Name] = struct{}{}
+		total += b.Weight
+	}
+
+	if total == 0 {
+		return fmt.Errorf("total weight of branches is 0")
+	}
+
+	return nil
+}
+
+// Validate validates StickyKey.
+func (k StickyKey) Validate() error {
+	if k.Source != sourceRealIP && k.Name == "" {
+		return fmt.Errorf("name of source %s is empty", k.Source)
+	}
+
+	return nil
+}
+
+// Kind returns the kind of Splitter.
+func (s *Splitter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Splitter.
+func (s *Splitter) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of Splitter.
+func (s *Splitter) Description() string {
+	return "Splitter splits traffic to branch pipelines by weights."
+}
+
+// Results returns the results of Splitter.
+func (s *Splitter) Results() []string {
+	return results
+}
+
+// Produces returns nil, Splitter sets no header.
+func (s *Splitter) Produces(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value { return nil }
+
+// Consumes returns the sticky header of Splitter.
+func (s *Splitter) Consumes(pipeSpec *httppipeline.FilterSpec) []*httppipeline.Value {
+	sticky := pipeSpec.FilterSpec().(*Spec).Sticky
+	if sticky == nil || sticky.Source != sourceHeader {
+		return nil
+	}
+	return []*httppipeline.Value{{Header: sticky.Name, Type: httppipeline.ValueString}}
+}
+
+// Init initializes Splitter.
+func (s *Splitter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	s.pipeSpec, s.spec, s.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	s.reload()
+}
+
+// Inherit inherits previous generation of Splitter.
+func (s *Splitter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	s.Init(pipeSpec, super)
+}
+
+func (s *Splitter) reload() {
+	s.totalWeight = 0
+	for _, b := range s.spec.Branches {
+		s.totalWeight += b.Weight
+	}
+}
+
+// Handle splits HTTPContext to a branch pipeline.
+func (s *Splitter) Handle(ctx context.HTTPContext) string {
+	result := s.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (s *Splitter) handle(ctx context.HTTPContext) string {
+	branch := s.choose(ctx)
+
+	ro, exists := s.super.GetRunningObject(branch.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag(stringtool.Cat("splitter: pipeline ", branch.Pipeline, " not found"))
+		return resultBranchNotFound
+	}
+
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag(stringtool.Cat("splitter: ", branch.Pipeline, " is not a handler"))
+		return resultBranchNotFound
+	}
+
+	ctx.AddTag(stringtool.Cat("splitter: branch ", branch.Name))
+	handler.Handle(ctx)
+
+	return ""
+}
+
+// choose chooses a branch by weights, the point in the total weight is
+// the hash of the sticky key, or a random number if there's no sticky key.
+func (s *Splitter) choose(ctx context.HTTPContext) *Branch {
+	var point int
+	if key, ok := s.stickyKey(ctx); ok {
+		point = int(hashtool.Hash32(key) % uint32(s.totalWeight))
+	} else {
+		point = rand.Intn(s.totalWeight)
+	}
+
+	for _, b := range s.spec.Branches {
+		if point < b.Weight {
+			return b
+		}
+		point -= b.Weight
+	}
+
+	// NOTE: It never happens, because the point is less than total weight.
+	return s.spec.Branches[len(s.spec.Branches)-1]
+}
+
+func (s *Splitter) stickyKey(ctx context.HTTPContext) (string, bool) {
+	if s.spec.Sticky == nil {
+		return "", false
+	}
+
+	r := ctx.Request()
+	var key string
+	switch s.spec.Sticky.Source {
+	case sourceHeader:
+		key = r.Header().Get(s.spec.Sticky.Name)
+	case sourceCookie:
+		if cookie, err := r.Cookie(s.spec.Sticky.Name); err == nil {
+			key = cookie.Value
+		}
+	case sourceQuery:
+		key = r.Std().URL.Query().Get(s.spec.Sticky.Name)
+	case sourceRealIP:
+		key = r.RealIP()
+	}
+
+	return key, key != ""
+}
+
+// Status returns status.
+func (s *Splitter) Status() interface{} { return nil }
+
+// Close closes Splitter.
+func (s *Splitter) Close() {}
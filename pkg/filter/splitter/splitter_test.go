@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package splitter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+func newSplitter(t *testing.T, spec map[string]interface{}) *Splitter {
+	return filtertest.NewFilter(t, &Splitter{}, spec).(*Splitter)
+}
+
+func newContext(user string) context.HTTPContext {
+	r := filtertest.NewRequest(http.MethodGet, "http://127.0.0.1/", "", nil)
+	if user != "" {
+		r.Header.Set("X-User", user)
+	}
+	return filtertest.NewContext(r)
+}
+
+func TestChoose(t *testing.T) {
+	s := newSplitter(t, map[string]interface{}{
+		"branches": []map[string]interface{}{
+			{"name": "stable", "pipeline": "pipeline-stable", "weight": 90},
+			{"name": "canary", "pipeline": "pipeline-canary", "weight": 10},
+			{"name": "off", "pipeline": "pipeline-off", "weight": 0},
+		},
+		"sticky": map[string]interface{}{
+			"source": "header",
+			"name":   "X-User",
+		},
+	})
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[s.choose(newContext("")).Name]++
+	}
+	if counts["off"] != 0 {
+		t.Errorf("branch with weight 0 should not be chosen")
+	}
+	if counts["canary"] < 700 || counts["canary"] > 1300 {
+		t.Errorf("canary should be chosen about 1000 times, got %d", counts["canary"])
+	}
+
+	for _, user := range []string{"alice", "bob", "carol"} {
+		branch := s.choose(newContext(user)).Name
+		for i := 0; i < 10; i++ {
+			if b := s.choose(newContext(user)).Name; b != branch {
+				t.Errorf("user %s should stick to branch %s, got %s", user, branch, b)
+			}
+		}
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	specs := []map[string]interface{}{
+		{
+			"branches": []map[string]interface{}{
+				{"name": "a", "pipeline": "pipeline-a", "weight": 0},
+			},
+		},
+		{
+			"branches": []map[string]interface{}{
+				{"name": "a", "pipeline": "pipeline-a", "weight": 1},
+				{"name": "a", "pipeline": "pipeline-b", "weight": 1},
+			},
+		},
+		{
+			"branches": []map[string]interface{}{
+				{"name": "a", "pipeline": "pipeline-a", "weight": 1},
+			},
+			"sticky": map[string]interface{}{"source": "cookie"},
+		},
+	}
+
+	for i, spec := range specs {
+		_, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+			Name: "splitter",
+			Kind: Kind,
+		}, spec)
+		if err == nil {
+			t.Errorf("spec %d should be invalid", i)
+		}
+	}
+}
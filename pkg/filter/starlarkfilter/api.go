@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package starlarkfilter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const stateKey = "state"
+
+type (
+	// state is the per-call state stored in the thread.
+	state struct {
+		ctx         context.HTTPContext
+		maxBodySize int64
+		reqBody     []byte
+		rspBody     []byte
+	}
+
+	builtinFunc func(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error)
+)
+
+// predeclared is the predeclared names of scripts.
+var predeclared = starlark.StringDict{
+	"eg": &starlarkstruct.Module{
+		Name: "eg",
+		Members: starlark.StringDict{
+			"req_method":     newBuiltin("req_method", reqMethod),
+			"req_path":       newBuiltin("req_path", reqPath),
+			"set_req_path":   newBuiltin("set_req_path", setReqPath),
+			"req_query":      newBuiltin("req_query", reqQuery),
+			"set_req_query":  newBuiltin("set_req_query", setReqQuery),
+			"req_real_ip":    newBuiltin("req_real_ip", reqRealIP),
+			"req_header":     newBuiltin("req_header", reqHeader),
+			"set_req_header": newBuiltin("set_req_header", setReqHeader),
+			"add_req_header": newBuiltin("add_req_header", addReqHeader),
+			"del_req_header": newBuiltin("del_req_header", delReqHeader),
+			"req_body":       newBuiltin("req_body", reqBody),
+			"set_req_body":   newBuiltin("set_req_body", setReqBody),
+			"rsp_status":     newBuiltin("rsp_status", rspStatus),
+			"set_rsp_status": newBuiltin("set_rsp_status", setRspStatus),
+			"rsp_header":     newBuiltin("rsp_header", rspHeader),
+			"set_rsp_header": newBuiltin("set_rsp_header", setRspHeader),
+			"del_rsp_header": newBuiltin("del_rsp_header", delRspHeader),
+			"rsp_body":       newBuiltin("rsp_body", rspBody),
+			"set_rsp_body":   newBuiltin("set_rsp_body", setRspBody),
+			"log":            newBuiltin("log", log),
+		},
+	},
+}
+
+// newBuiltin wraps fn as a builtin, which could only be called in the
+// handle function, since there is no HTTPContext at the top level.
+func newBuiltin(name string, fn builtinFunc) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin,
+		args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+		s, ok := thread.Local(stateKey).(*state)
+		if !ok {
+			return nil, fmt.Errorf("%s: could only be called in %s", b.Name(), handleFunc)
+		}
+		return fn(s, b.Name(), args, kwargs)
+	})
+}
+
+func (s *state) readBody(body io.Reader) ([]byte, error) {
+	if body == nil {
+		return []byte{}, nil
+	}
+
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, body, s.maxBodySize+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+	if written > s.maxBodySize {
+		return nil, fmt.Errorf("body exceed %dB", s.maxBodySize)
+	}
+
+	return buff.Bytes(), nil
+}
+
+func getString(fnName string, args starlark.Tuple, kwargs []starlark.Tuple,
+	fn func() string) (starlark.Value, error) {
+
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlark.String(fn()), nil
+}
+
+func setString(fnName string, args starlark.Tuple, kwargs []starlark.Tuple,
+	fn func(value string)) (starlark.Value, error) {
+
+	var value string
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 1, &value); err != nil {
+		return nil, err
+	}
+	fn(value)
+	return starlark.None, nil
+}
+
+func reqMethod(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return getString(fnName, args, kwargs, s.ctx.Request().Method)
+}
+
+func reqPath(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return getString(fnName, args, kwargs, s.ctx.Request().Path)
+}
+
+func setReqPath(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return setString(fnName, args, kwargs, s.ctx.Request().SetPath)
+}
+
+func reqQuery(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return getString(fnName, args, kwargs, s.ctx.Request().Query)
+}
+
+func setReqQuery(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return setString(fnName, args, kwargs, s.ctx.Request().SetQuery)
+}
+
+func reqRealIP(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return getString(fnName, args, kwargs, s.ctx.Request().RealIP)
+}
+
+func reqHeader(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 1, &key); err != nil {
+		return nil, err
+	}
+	return starlark.String(s.ctx.Request().Header().Get(key)), nil
+}
+
+func setReqHeader(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key, value string
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 2, &key, &value); err != nil {
+		return nil, err
+	}
+	s.ctx.Request().Header().Set(key, value)
+	return starlark.None, nil
+}
+
+func addReqHeader(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key, value string
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 2, &key, &value); err != nil {
+		return nil, err
+	}
+	s.ctx.Request().Header().Add(key, value)
+	return starlark.None, nil
+}
+
+func delReqHeader(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return setString(fnName, args, kwargs, s.ctx.Request().Header().Del)
+}
+
+func reqBody(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+
+	if s.reqBody == nil {
+		r := s.ctx.Request()
+		body, err := s.readBody(r.Body())
+		if err != nil {
+			return nil, err
+		}
+		s.reqBody = body
+		r.SetBody(bytes.NewReader(body))
+	}
+
+	return starlark.String(s.reqBody), nil
+}
+
+func setReqBody(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return setString(fnName, args, kwargs, func(value string) {
+		s.reqBody = []byte(value)
+		s.ctx.Request().SetBody(bytes.NewReader(s.reqBody))
+	})
+}
+
+func rspStatus(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(s.ctx.Response().StatusCode()), nil
+}
+
+func setRspStatus(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var code int
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 1, &code); err != nil {
+		return nil, err
+	}
+	if code < 200 || code >= 600 {
+		return nil, fmt.Errorf("%s: invalid status code: %d", fnName, code)
+	}
+	s.ctx.Response().SetStatusCode(code)
+	return starlark.None, nil
+}
+
+func rspHeader(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 1, &key); err != nil {
+		return nil, err
+	}
+	return starlark.String(s.ctx.Response().Header().Get(key)), nil
+}
+
+func setRspHeader(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key, value string
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 2, &key, &value); err != nil {
+		return nil, err
+	}
+	s.ctx.Response().Header().Set(key, value)
+	return starlark.None, nil
+}
+
+func delRspHeader(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return setString(fnName, args, kwargs, s.ctx.Response().Header().Del)
+}
+
+func rspBody(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fnName, args, kwargs, 0); err != nil {
+		return nil, err
+	}
+
+	if s.rspBody == nil {
+		w := s.ctx.Response()
+		body, err := s.readBody(w.Body())
+		if err != nil {
+			return nil, err
+		}
+		s.rspBody = body
+		w.SetBody(bytes.NewReader(body))
+	}
+
+	return starlark.String(s.rspBody), nil
+}
+
+func setRspBody(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return setString(fnName, args, kwargs, func(value string) {
+		s.rspBody = []byte(value)
+		w := s.ctx.Response()
+		w.Header().Del("Content-Length")
+		w.SetBody(bytes.NewReader(s.rspBody))
+	})
+}
+
+func log(s *state, fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return setString(fnName, args, kwargs, func(msg string) {
+		logger.Infof("starlarkFilter: %s", msg)
+	})
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package starlarkfilter
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of StarlarkFilter.
+	Kind = "StarlarkFilter"
+
+	resultFailed          = "failed"
+	resultResponseAlready = "responseAlready"
+
+	handleFunc = "handle"
+
+	defaultTimeout     = "100ms"
+	defaultMaxSteps    = 1000000
+	defaultMaxBodySize = 4 * 1024 * 1024
+)
+
+var (
+	results = []string{resultFailed, resultResponseAlready}
+)
+
+func init() {
+	httppipeline.Register(&StarlarkFilter{})
+}
+
+type (
+	// StarlarkFilter is the filter running Starlark scripts.
+	StarlarkFilter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		handle  starlark.Callable
+	}
+
+	// Spec describes the StarlarkFilter.
+	Spec struct {
+		Script      string `yaml:"script" jsonschema:"required"`
+		Timeout     string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxSteps    uint64 `yaml:"maxSteps" jsonschema:"omitempty,minimum=0"`
+		MaxBodySize int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	_, err := load(s.Script, s.MaxSteps)
+	return err
+}
+
+// load runs the top level statements of the script, and returns the
+// handle function defined by it. The globals of the script are frozen,
+// so the function could be called concurrently.
+func load(script string, maxSteps uint64) (starlark.Callable, error) {
+	thread := &starlark.Thread{Name: Kind}
+	if maxSteps > 0 {
+		thread.SetMaxExecutionSteps(maxSteps)
+	}
+
+	globals, err := starlark.ExecFile(thread, Kind, script, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("load script failed: %v", err)
+	}
+	globals.Freeze()
+
+	fn, ok := globals[handleFunc].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("function %s is not defined", handleFunc)
+	}
+
+	return fn, nil
+}
+
+// Kind returns the kind of StarlarkFilter.
+func (sf *StarlarkFilter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of StarlarkFilter.
+func (sf *StarlarkFilter) DefaultSpec() interface{} {
+	return &Spec{
+		Timeout:     defaultTimeout,
+		MaxSteps:    defaultMaxSteps,
+		MaxBodySize: defaultMaxBodySize,
+	}
+}
+
+// Description returns the description of StarlarkFilter.
+func (sf *StarlarkFilter) Description() string {
+	return "StarlarkFilter runs Starlark scripts to inspect and modify requests and responses."
+}
+
+// Results returns the results of StarlarkFilter.
+func (sf *StarlarkFilter) Results() []string {
+	return results
+}
+
+// Init initializes StarlarkFilter.
+func (sf *StarlarkFilter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	sf.pipeSpec, sf.spec, sf.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	sf.reload()
+}
+
+// Inherit inherits previous generation of StarlarkFilter.
+func (sf *StarlarkFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	sf.Init(pipeSpec, super)
+}
+
+func (sf *StarlarkFilter) reload() {
+	var err error
+	if sf.spec.Timeout != "" {
+		sf.timeout, err = time.ParseDuration(sf.spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", sf.spec.Timeout, err)
+		}
+	}
+
+	sf.handle, err = load(sf.spec.Script, sf.spec.MaxSteps)
+	if err != nil {
+		logger.Errorf("BUG: %v", err)
+	}
+}
+
+// Handle handles HTTPContext by running the Starlark script.
+func (sf *StarlarkFilter) Handle(ctx context.HTTPContext) string {
+	result := sf.handleContext(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (sf *StarlarkFilter) handleContext(ctx context.HTTPContext) string {
+	if sf.handle == nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag("starlarkFilter: script is not loaded")
+		return resultFailed
+	}
+
+	result, err := sf.run(ctx)
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("starlarkFilter: ", err.Error()))
+		return resultFailed
+	}
+
+	switch result {
+	case "":
+		return ""
+	case resultResponseAlready:
+		return resultResponseAlready
+	default:
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("starlarkFilter: unknown result ", result))
+		return resultFailed
+	}
+}
+
+func (sf *StarlarkFilter) run(ctx context.HTTPContext) (string, error) {
+	thread := &starlark.Thread{
+		Name: sf.pipeSpec.Name(),
+		Print: func(_ *starlark.Thread, msg string) {
+			logger.Infof("starlarkFilter: %s", msg)
+		},
+	}
+	if sf.spec.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(sf.spec.MaxSteps)
+	}
+	thread.SetLocal(stateKey, &state{ctx: ctx, maxBodySize: sf.spec.MaxBodySize})
+
+	if sf.timeout > 0 {
+		timer := time.AfterFunc(sf.timeout, func() {
+			thread.Cancel(fmt.Sprintf("timeout after %v", sf.timeout))
+		})
+		defer timer.Stop()
+	}
+
+	// NOTE: The script stops on the cancellation of the request too.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel("request cancelled")
+		case <-stop:
+		}
+	}()
+
+	ret, err := starlark.Call(thread, sf.handle, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	switch ret := ret.(type) {
+	case starlark.NoneType:
+		return "", nil
+	case starlark.String:
+		return string(ret), nil
+	default:
+		return "", fmt.Errorf("%s returns %s, want string or None", handleFunc, ret.Type())
+	}
+}
+
+// Status returns status.
+func (sf *StarlarkFilter) Status() interface{} { return nil }
+
+// Close closes StarlarkFilter.
+func (sf *StarlarkFilter) Close() {}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timeout
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of Timeout.
+	Kind = "Timeout"
+
+	resultTimeout = "timeout"
+)
+
+var (
+	results = []string{resultTimeout}
+)
+
+func init() {
+	httppipeline.Register(&Timeout{})
+}
+
+type (
+	// Timeout enforces a deadline over the filters after it.
+	Timeout struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		err     error
+	}
+
+	// Spec describes the Timeout.
+	Spec struct {
+		Timeout    string `yaml:"timeout" jsonschema:"required,format=duration"`
+		StatusCode int    `yaml:"statusCode" jsonschema:"omitempty,format=httpcode"`
+	}
+)
+
+// Kind returns the kind of Timeout.
+func (t *Timeout) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Timeout.
+func (t *Timeout) DefaultSpec() interface{} {
+	return &Spec{
+		StatusCode: http.StatusGatewayTimeout,
+	}
+}
+
+// Description returns the description of Timeout.
+func (t *Timeout) Description() string {
+	return "Timeout cancels the request if the filters after it don't finish in time."
+}
+
+// Results returns the results of Timeout.
+func (t *Timeout) Results() []string {
+	return results
+}
+
+// Init initializes Timeout.
+func (t *Timeout) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	t.pipeSpec, t.spec, t.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	t.reload()
+}
+
+// Inherit inherits previous generation of Timeout.
+func (t *Timeout) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	t.Init(pipeSpec, super)
+}
+
+func (t *Timeout) reload() {
+	// NOTE: The format has been validated.
+	t.timeout, _ = time.ParseDuration(t.spec.Timeout)
+	t.err = fmt.Errorf("filter %s timed out after %v", t.pipeSpec.Name(), t.timeout)
+}
+
+// Handle calls the filters after Timeout, and cancels the request if they
+// don't finish in time. Filters must stop on the cancellation of the
+// request, which is done by Proxy, LuaFilter, JSFilter, StarlarkFilter
+// and others respecting ctx.Done().
+func (t *Timeout) Handle(ctx context.HTTPContext) string {
+	timer := time.AfterFunc(t.timeout, func() {
+		ctx.Cancel(t.err)
+	})
+
+	result := ctx.CallNextHandler("")
+	if timer.Stop() {
+		return result
+	}
+
+	ctx.Response().SetStatusCode(t.spec.StatusCode)
+	ctx.AddTag(stringtool.Cat("timeout: timed out after ", t.timeout.String()))
+
+	return resultTimeout
+}
+
+// Status returns status.
+func (t *Timeout) Status() interface{} { return nil }
+
+// Close closes Timeout.
+func (t *Timeout) Close() {}
@@ -19,10 +19,14 @@ package validator
 
 import (
 	"net/http"
+	"sort"
 
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/celexpr"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/signer"
 	"github.com/megaease/easegress/pkg/util/stringtool"
@@ -41,6 +45,7 @@ var (
 
 func init() {
 	httppipeline.Register(&Validator{})
+	secret.RegisterSensitiveFields("secret", "clientSecret", "accessKeySecret")
 }
 
 type (
@@ -54,6 +59,7 @@ type (
 		jwt     *JWTValidator
 		signer  *signer.Signer
 		oauth2  *OAuth2Validator
+		expr    *celexpr.Expression
 	}
 
 	// Spec describes the Validator.
@@ -62,9 +68,24 @@ type (
 		JWT       *JWTValidatorSpec         `yaml:"jwt,omitempty" jsonschema:"omitempty"`
 		Signature *signer.Spec              `yaml:"signature,omitempty" jsonschema:"omitempty"`
 		OAuth2    *OAuth2ValidatorSpec      `yaml:"oauth2,omitempty" jsonschema:"omitempty"`
+		// Expression is a CEL expression, requests are invalid if it
+		// is not evaluated to true, see package celexpr for variables.
+		Expression string `yaml:"expression,omitempty" jsonschema:"omitempty"`
 	}
 )
 
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.Expression != "" {
+		_, err := celexpr.Compile(s.Expression)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Kind returns the kind of Validator.
 func (v *Validator) Kind() string {
 	return Kind
@@ -85,6 +106,61 @@ func (v *Validator) Results() []string {
 	return results
 }
 
+// DescribeAPI describes the headers validated as parameters, and the JWT
+// and OAuth2 tokens as security schemes. Signatures and expressions are
+// not described.
+func (v *Validator) DescribeAPI(pipeSpec *httppipeline.FilterSpec) *httppipeline.APIDescription {
+	spec := pipeSpec.FilterSpec().(*Spec)
+	description := &httppipeline.APIDescription{}
+
+	if spec.Headers != nil {
+		names := make([]string, 0, len(*spec.Headers))
+		for name := range *spec.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			vv := (*spec.Headers)[name]
+			description.Parameters = append(description.Parameters, &httppipeline.APIParameter{
+				Name:     name,
+				In:       httppipeline.APIInHeader,
+				Required: true,
+				Enum:     vv.Values,
+				Pattern:  vv.Regexp,
+			})
+		}
+	}
+
+	if spec.JWT != nil {
+		security := &httppipeline.APISecurity{
+			Type:         httppipeline.APISecurityHTTP,
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+		}
+		if spec.JWT.CookieName != "" {
+			security = &httppipeline.APISecurity{
+				Type:        httppipeline.APISecurityAPIKey,
+				In:          httppipeline.APIInCookie,
+				Name:        spec.JWT.CookieName,
+				Description: "JWT in the cookie, or in the header Authorization as a bearer token",
+			}
+		}
+		description.Security = append(description.Security, security)
+	}
+	if spec.OAuth2 != nil {
+		description.Security = append(description.Security, &httppipeline.APISecurity{
+			Type:        httppipeline.APISecurityHTTP,
+			Scheme:      "bearer",
+			Description: "OAuth2 access token",
+		})
+	}
+
+	if len(description.Parameters) == 0 && len(description.Security) == 0 {
+		return nil
+	}
+	return description
+}
+
 // Init initializes Validator.
 func (v *Validator) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
 	v.pipeSpec, v.spec, v.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
@@ -95,7 +171,6 @@ func (v *Validator) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Su
 func (v *Validator) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
-	previousGeneration.Close()
 	v.Init(pipeSpec, super)
 }
 
@@ -115,6 +190,14 @@ func (v *Validator) reload() {
 	if v.spec.OAuth2 != nil {
 		v.oauth2 = NewOAuth2Validator(v.spec.OAuth2)
 	}
+
+	if v.spec.Expression != "" {
+		var err error
+		v.expr, err = celexpr.Compile(v.spec.Expression)
+		if err != nil {
+			logger.Errorf("BUG: %v", err)
+		}
+	}
 }
 
 // Handle validates HTTPContext.
@@ -162,6 +245,21 @@ func (v *Validator) handle(ctx context.HTTPContext) string {
 		}
 	}
 
+	if v.spec.Expression != "" {
+		matched := false
+		if v.expr != nil {
+			var err error
+			matched, err = v.expr.Eval(ctx)
+			if err != nil {
+				ctx.AddTag(stringtool.Cat("expression validator: ", err.Error()))
+			}
+		}
+		if !matched {
+			ctx.Response().SetStatusCode(http.StatusForbidden)
+			return resultInvalid
+		}
+	}
+
 	return ""
 }
 
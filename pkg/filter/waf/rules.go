@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+import (
+	"regexp"
+)
+
+// Severities and their anomaly scores, the same as the OWASP Core Rule Set.
+const (
+	scoreCritical = 5
+	scoreError    = 4
+	scoreWarning  = 3
+	scoreNotice   = 2
+)
+
+// Targets of rules.
+const (
+	targetURI     = "uri"
+	targetPath    = "path"
+	targetArgs    = "args"
+	targetHeaders = "headers"
+	targetBody    = "body"
+)
+
+type (
+	// rule is a check on parts of requests, rules are a curated subset of
+	// the OWASP ModSecurity Core Rule Set, and IDs are from it.
+	rule struct {
+		id      string
+		msg     string
+		score   int
+		targets []string
+		re      *regexp.Regexp
+		// check is used instead of re for checks on the whole request.
+		check func(req *inspection) bool
+	}
+)
+
+var rules = []*rule{
+	// Protocol anomalies.
+	{
+		id:    "920280",
+		msg:   "missing Host header",
+		score: scoreWarning,
+		check: func(req *inspection) bool { return req.host == "" },
+	},
+	{
+		id:    "920320",
+		msg:   "missing User-Agent header",
+		score: scoreNotice,
+		check: func(req *inspection) bool { return req.userAgent == "" },
+	},
+	{
+		id:      "920270",
+		msg:     "invalid character (null byte) in request",
+		score:   scoreError,
+		targets: []string{targetPath, targetArgs, targetHeaders},
+		re:      regexp.MustCompile(`\x00`),
+	},
+
+	// Request smuggling and header injection.
+	{
+		id:      "921110",
+		msg:     "HTTP request smuggling attack",
+		score:   scoreCritical,
+		targets: []string{targetArgs, targetBody},
+		re:      regexp.MustCompile(`(?i)[\r\n]\W*?(?:get|post|head|options|connect|put|delete|trace|track|patch|propfind|propatch|mkcol|copy|move|lock|unlock)\s+\S+\s+http/\d`),
+	},
+	{
+		id:      "921150",
+		msg:     "HTTP header injection via payload (CR/LF detected)",
+		score:   scoreCritical,
+		targets: []string{targetArgs},
+		re:      regexp.MustCompile(`[\r\n]\s*[\w-]+\s*:`),
+	},
+	{
+		id:      "921160",
+		msg:     "HTTP response splitting attack",
+		score:   scoreCritical,
+		targets: []string{targetArgs, targetHeaders},
+		re:      regexp.MustCompile(`(?i)[\r\n]\s*(?:content-(?:type|length)|set-cookie|location)\s*:`),
+	},
+
+	// Path traversal and file access.
+	{
+		id:      "930100",
+		msg:     "path traversal attack (encoded /../)",
+		score:   scoreCritical,
+		targets: []string{targetURI},
+		re:      regexp.MustCompile(`(?i)(?:(?:%2e|%252e)(?:%2e|%252e|\.)|\.(?:%2e|%252e))(?:%2f|%252f|%5c|%255c|%c0%af|/|\\)|\.\.(?:%2f|%252f|%5c|%255c|%c0%af)`),
+	},
+	{
+		id:      "930110",
+		msg:     "path traversal attack (/../)",
+		score:   scoreCritical,
+		targets: []string{targetPath, targetArgs, targetBody},
+		re:      regexp.MustCompile(`(?:^|[\\/])\.\.(?:[\\/]|$)`),
+	},
+	{
+		id:      "930120",
+		msg:     "OS file access attempt",
+		score:   scoreCritical,
+		targets: []string{targetPath, targetArgs, targetBody},
+		re:      regexp.MustCompile(`(?i)(?:/etc/(?:passwd|shadow|group|hosts)|/proc/self/|\bboot\.ini\b|\bwin\.ini\b|(?:^|/)\.(?:htaccess|htpasswd|git/|env\b))`),
+	},
+
+	// Common injection signatures.
+	{
+		id:      "932100",
+		msg:     "remote command execution: Unix command injection",
+		score:   scoreCritical,
+		targets: []string{targetArgs, targetBody},
+		re:      regexp.MustCompile("(?i)(?:[;|`]|&&|\\$\\()\\s*(?:cat|ls|id|whoami|uname|wget|curl|nc|ncat|bash|sh|python|perl|chmod|rm)\\b"),
+	},
+	{
+		id:      "933100",
+		msg:     "PHP injection attack: opening tag found",
+		score:   scoreCritical,
+		targets: []string{targetArgs, targetBody},
+		re:      regexp.MustCompile(`(?i)<\?(?:php|=)`),
+	},
+	{
+		id:      "941100",
+		msg:     "XSS attack: script tag, javascript URI or event handler",
+		score:   scoreCritical,
+		targets: []string{targetArgs, targetHeaders, targetBody},
+		re:      regexp.MustCompile(`(?i)<script[^>]*>|javascript:|\bon(?:error|load|click|mouse\w+|focus|blur)\s*=`),
+	},
+	{
+		id:      "942100",
+		msg:     "SQL injection attack: common signatures",
+		score:   scoreCritical,
+		targets: []string{targetArgs, targetBody},
+		re:      regexp.MustCompile(`(?i)\bunion\b[\s\S]*?\bselect\b|\b(?:or|and)\b\s+['"]?\d+['"]?\s*=\s*['"]?\d+|'\s*(?:or|and)\s+'|;\s*(?:drop|truncate|delete)\s+\w|\b(?:sleep|benchmark|pg_sleep)\s*\(`),
+	},
+	{
+		id:      "944150",
+		msg:     "remote command execution: Log4j / JNDI lookup",
+		score:   scoreCritical,
+		targets: []string{targetURI, targetArgs, targetHeaders, targetBody},
+		re:      regexp.MustCompile(`(?i)\$\{\s*jndi\s*:|\$\{[^}]*\$\{\s*(?:lower|upper|env|::-)`),
+	},
+}
+
+func ruleIDs() map[string]*rule {
+	m := make(map[string]*rule, len(rules))
+	for _, r := range rules {
+		m[r.id] = r
+	}
+	return m
+}
@@ -0,0 +1,391 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of WAF.
+	Kind = "WAF"
+
+	resultBlocked = "blocked"
+
+	modeBlock  = "block"
+	modeDetect = "detect"
+)
+
+var results = []string{resultBlocked}
+
+func init() {
+	httppipeline.Register(&WAF{})
+}
+
+type (
+	// WAF checks requests against a curated subset of the OWASP Core Rule
+	// Set, and blocks requests whose anomaly score reaches the threshold.
+	WAF struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		mutex   sync.Mutex
+		status  *Status
+		enabled []*rule
+	}
+
+	// Spec describes the WAF.
+	Spec struct {
+		// Mode is block or detect, matches are only tagged in detect mode.
+		Mode             string       `yaml:"mode" jsonschema:"omitempty,enum=,enum=block,enum=detect"`
+		AnomalyThreshold int          `yaml:"anomalyThreshold" jsonschema:"omitempty,minimum=1"`
+		InspectBody      bool         `yaml:"inspectBody" jsonschema:"omitempty"`
+		MaxBodySize      int64        `yaml:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		DisabledRules    []string     `yaml:"disabledRules" jsonschema:"omitempty,uniqueItems=true"`
+		Exclusions       []*Exclusion `yaml:"exclusions" jsonschema:"omitempty"`
+	}
+
+	// Exclusion excludes rules for requests whose path has the prefix, the
+	// rules are disabled if neither args nor headers are specified, or
+	// the args and headers are not inspected by the rules otherwise.
+	Exclusion struct {
+		Rules      []string `yaml:"rules" jsonschema:"required,minItems=1,uniqueItems=true"`
+		PathPrefix string   `yaml:"pathPrefix" jsonschema:"omitempty"`
+		Args       []string `yaml:"args" jsonschema:"omitempty,uniqueItems=true"`
+		Headers    []string `yaml:"headers" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Status is the status of WAF.
+	Status struct {
+		Inspected uint64            `yaml:"inspected"`
+		Matched   uint64            `yaml:"matched"`
+		Blocked   uint64            `yaml:"blocked"`
+		Rules     map[string]uint64 `yaml:"rules,omitempty"`
+	}
+
+	inspection struct {
+		host      string
+		userAgent string
+		variables []*variable
+	}
+
+	variable struct {
+		target string
+		name   string
+		value  string
+	}
+
+	// excluded is the exclusion of a rule for a request.
+	excluded struct {
+		all     bool
+		args    map[string]struct{}
+		headers map[string]struct{}
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	ids := ruleIDs()
+	check := func(id string) error {
+		if _, exists := ids[id]; !exists {
+			return fmt.Errorf("unknown rule %s", id)
+		}
+		return nil
+	}
+
+	for _, id := range s.DisabledRules {
+		if err := check(id); err != nil {
+			return err
+		}
+	}
+	for _, e := range s.Exclusions {
+		for _, id := range e.Rules {
+			if err := check(id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of WAF.
+func (w *WAF) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of WAF.
+func (w *WAF) DefaultSpec() interface{} {
+	return &Spec{
+		Mode:             modeBlock,
+		AnomalyThreshold: scoreCritical,
+		MaxBodySize:      64 * 1024,
+	}
+}
+
+// Description returns the description of WAF.
+func (w *WAF) Description() string {
+	return "WAF checks requests against a subset of the OWASP Core Rule Set."
+}
+
+// Results returns the results of WAF.
+func (w *WAF) Results() []string {
+	return results
+}
+
+// Init initializes WAF.
+func (w *WAF) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	w.pipeSpec, w.spec, w.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	w.reload()
+}
+
+// Inherit inherits previous generation of WAF.
+func (w *WAF) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	w.Init(pipeSpec, super)
+}
+
+func (w *WAF) reload() {
+	w.status = &Status{Rules: map[string]uint64{}}
+
+	w.enabled = nil
+	for _, r := range rules {
+		if !stringtool.StrInSlice(r.id, w.spec.DisabledRules) {
+			w.enabled = append(w.enabled, r)
+		}
+	}
+}
+
+// Handle checks HTTPContext against rules.
+func (w *WAF) Handle(ctx context.HTTPContext) string {
+	result := w.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (w *WAF) handle(ctx context.HTTPContext) string {
+	matched := w.inspect(ctx.Request())
+
+	score := 0
+	ids := make([]string, 0, len(matched))
+	for _, r := range matched {
+		score += r.score
+		ids = append(ids, r.id)
+	}
+	block := score >= w.spec.AnomalyThreshold && w.spec.Mode != modeDetect
+
+	w.mutex.Lock()
+	w.status.Inspected++
+	if len(matched) > 0 {
+		w.status.Matched++
+	}
+	if block {
+		w.status.Blocked++
+	}
+	for _, id := range ids {
+		w.status.Rules[id]++
+	}
+	w.mutex.Unlock()
+
+	if len(matched) == 0 {
+		return ""
+	}
+
+	ctx.AddTag(stringtool.Cat("waf: score ", strconv.Itoa(score), ", rules ", strings.Join(ids, ",")))
+	if !block {
+		return ""
+	}
+
+	ctx.Response().SetStatusCode(http.StatusForbidden)
+	return resultBlocked
+}
+
+func (w *WAF) readBody(r context.HTTPRequest) string {
+	buff := bytes.NewBuffer(nil)
+	io.CopyN(buff, r.Body(), w.spec.MaxBodySize)
+	// NOTE: Only the leading part of a large body is inspected, and
+	// the whole body is kept for following filters.
+	r.SetBody(io.MultiReader(bytes.NewReader(buff.Bytes()), r.Body()))
+	return buff.String()
+}
+
+func (w *WAF) newInspection(r context.HTTPRequest) *inspection {
+	std := r.Std()
+	req := &inspection{
+		host:      r.Host(),
+		userAgent: r.Header().Get("User-Agent"),
+	}
+
+	add := func(target, name, value string) {
+		if value != "" {
+			req.variables = append(req.variables, &variable{target: target, name: name, value: value})
+		}
+	}
+
+	add(targetURI, "", std.RequestURI)
+	add(targetPath, "", r.Path())
+	for _, arg := range parseArgs(std.URL.RawQuery) {
+		add(targetArgs, arg[0], arg[0])
+		add(targetArgs, arg[0], arg[1])
+	}
+	for name, values := range std.Header {
+		for _, value := range values {
+			add(targetHeaders, name, value)
+		}
+	}
+	if w.spec.InspectBody {
+		add(targetBody, "", w.readBody(r))
+	}
+
+	return req
+}
+
+// parseArgs parses the query into name-value pairs. It does not use
+// url.ParseQuery, which drops pairs containing semicolons and pairs failed
+// to unescape, so attacks could be hidden in them.
+func parseArgs(rawQuery string) [][2]string {
+	var args [][2]string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value := pair, ""
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+		args = append(args, [2]string{unescape(name), unescape(value)})
+	}
+	return args
+}
+
+func unescape(s string) string {
+	if v, err := url.QueryUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
+
+// exclusions returns exclusions of rules for the path.
+func (w *WAF) exclusions(path string) map[string]*excluded {
+	result := map[string]*excluded{}
+	for _, e := range w.spec.Exclusions {
+		if !strings.HasPrefix(path, e.PathPrefix) {
+			continue
+		}
+
+		for _, id := range e.Rules {
+			ex := result[id]
+			if ex == nil {
+				ex = &excluded{args: map[string]struct{}{}, headers: map[string]struct{}{}}
+				result[id] = ex
+			}
+			if len(e.Args) == 0 && len(e.Headers) == 0 {
+				ex.all = true
+			}
+			for _, arg := range e.Args {
+				ex.args[arg] = struct{}{}
+			}
+			for _, header := range e.Headers {
+				ex.headers[http.CanonicalHeaderKey(header)] = struct{}{}
+			}
+		}
+	}
+	return result
+}
+
+func (ex *excluded) excludes(v *variable) bool {
+	if ex == nil {
+		return false
+	}
+	if ex.all {
+		return true
+	}
+
+	switch v.target {
+	case targetArgs:
+		_, exists := ex.args[v.name]
+		return exists
+	case targetHeaders:
+		_, exists := ex.headers[v.name]
+		return exists
+	}
+	return false
+}
+
+// inspect returns the matched rules.
+func (w *WAF) inspect(r context.HTTPRequest) []*rule {
+	req := w.newInspection(r)
+	exclusions := w.exclusions(r.Path())
+
+	var matched []*rule
+	for _, rl := range w.enabled {
+		ex := exclusions[rl.id]
+		if ex != nil && ex.all {
+			continue
+		}
+		if rl.match(req, ex) {
+			matched = append(matched, rl)
+		}
+	}
+	return matched
+}
+
+func (rl *rule) match(req *inspection, ex *excluded) bool {
+	if rl.check != nil {
+		return rl.check(req)
+	}
+
+	for _, v := range req.variables {
+		if !stringtool.StrInSlice(v.target, rl.targets) || ex.excludes(v) {
+			continue
+		}
+		if rl.re.MatchString(v.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the status of WAF.
+func (w *WAF) Status() interface{} {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	s := *w.status
+	s.Rules = make(map[string]uint64, len(w.status.Rules))
+	for id, count := range w.status.Rules {
+		s.Rules[id] = count
+	}
+	return &s
+}
+
+// Close closes WAF.
+func (w *WAF) Close() {}
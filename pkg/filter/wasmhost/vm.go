@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	stdcontext "context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	// hostModuleName is the module name of host functions imported by guests.
+	hostModuleName = "easegress"
+
+	// exported functions of guests.
+	guestFuncInit  = "wasm_init"
+	guestFuncAlloc = "wasm_alloc"
+	guestFuncRun   = "wasm_run"
+)
+
+type (
+	contextKey struct{}
+
+	// vmPool holds at most maxVMs instances of the same compiled module.
+	vmPool struct {
+		runtime  wazero.Runtime
+		compiled wazero.CompiledModule
+		codeSize int
+		loadedAt time.Time
+
+		maxVMs  int32
+		created int32
+		serial  uint64
+		vms     chan *vm
+	}
+
+	// vm is an instance of the wasm module, it runs one request at a time.
+	vm struct {
+		mod   api.Module
+		runFn api.Function
+	}
+)
+
+func newVMPool(ctx stdcontext.Context, code []byte, maxVMs int32, maxMemoryPages uint32) (*vmPool, error) {
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(maxMemoryPages).
+		WithCloseOnContextDone(true)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+
+	_, err := exportHostFunctions(runtime.NewHostModuleBuilder(hostModuleName)).Instantiate(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("instantiate host module failed: %v", err)
+	}
+
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("compile wasm code failed: %v", err)
+	}
+
+	for _, name := range []string{guestFuncAlloc, guestFuncRun} {
+		if _, exists := compiled.ExportedFunctions()[name]; !exists {
+			runtime.Close(ctx)
+			return nil, fmt.Errorf("wasm code doesn't export function %s", name)
+		}
+	}
+
+	p := &vmPool{
+		runtime:  runtime,
+		compiled: compiled,
+		codeSize: len(code),
+		loadedAt: time.Now(),
+		maxVMs:   maxVMs,
+		vms:      make(chan *vm, maxVMs),
+	}
+
+	// NOTE: Create one vm at once to detect errors of instantiation early.
+	first, err := p.newVM(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	p.created = 1
+	p.vms <- first
+
+	return p, nil
+}
+
+func (p *vmPool) newVM(ctx stdcontext.Context) (*vm, error) {
+	name := fmt.Sprintf("vm-%d", atomic.AddUint64(&p.serial, 1))
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, wazero.NewModuleConfig().WithName(name))
+	if err != nil {
+		return nil, fmt.Errorf("instantiate wasm code failed: %v", err)
+	}
+
+	if init := mod.ExportedFunction(guestFuncInit); init != nil {
+		if _, err := init.Call(ctx); err != nil {
+			mod.Close(ctx)
+			return nil, fmt.Errorf("call %s failed: %v", guestFuncInit, err)
+		}
+	}
+
+	return &vm{mod: mod, runFn: mod.ExportedFunction(guestFuncRun)}, nil
+}
+
+// get returns an idle vm, or creates a new one if the limit is not
+// reached, it returns nil if all vms are busy.
+func (p *vmPool) get() *vm {
+	select {
+	case v := <-p.vms:
+		return v
+	default:
+	}
+
+	if atomic.AddInt32(&p.created, 1) > p.maxVMs {
+		atomic.AddInt32(&p.created, -1)
+		return nil
+	}
+
+	v, err := p.newVM(stdcontext.Background())
+	if err != nil {
+		atomic.AddInt32(&p.created, -1)
+		return nil
+	}
+
+	return v
+}
+
+// put gives the vm back, the vm is dropped if it is not healthy.
+func (p *vmPool) put(v *vm, healthy bool) {
+	if healthy {
+		p.vms <- v
+		return
+	}
+
+	v.mod.Close(stdcontext.Background())
+	atomic.AddInt32(&p.created, -1)
+}
+
+func (p *vmPool) idle() int {
+	return len(p.vms)
+}
+
+func (p *vmPool) close() {
+	p.runtime.Close(stdcontext.Background())
+}
+
+func (v *vm) run(ctx context.HTTPContext, timeout time.Duration) (int32, error) {
+	c := stdcontext.WithValue(stdcontext.Background(), contextKey{}, ctx)
+	if timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		c, cancel = stdcontext.WithTimeout(c, timeout)
+		defer cancel()
+	}
+
+	results, err := v.runFn.Call(c)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	return int32(results[0]), nil
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	stdcontext "context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of WasmHost.
+	Kind = "WasmHost"
+
+	resultOutOfVM   = "outOfVM"
+	resultWasmError = "wasmError"
+
+	maxWasmResult = 9
+
+	defaultMaxConcurrency = 10
+	defaultTimeout        = "100ms"
+	defaultMaxMemoryPages = 256
+)
+
+var (
+	results = []string{resultOutOfVM, resultWasmError}
+)
+
+func init() {
+	for i := 1; i <= maxWasmResult; i++ {
+		results = append(results, wasmResultToFilterResult(int32(i)))
+	}
+	httppipeline.Register(&WasmHost{})
+}
+
+func wasmResultToFilterResult(r int32) string {
+	return "wasmResult" + strconv.Itoa(int(r))
+}
+
+type (
+	// WasmHost is the filter running WebAssembly modules.
+	WasmHost struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		pool    *vmPool
+		// handedOver is true if the pool is taken over by the next
+		// generation, so it's not closed with this one.
+		handedOver bool
+	}
+
+	// Spec describes the WasmHost.
+	Spec struct {
+		MaxConcurrency int32  `yaml:"maxConcurrency" jsonschema:"omitempty,minimum=1"`
+		Code           string `yaml:"code" jsonschema:"required"`
+		Timeout        string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxMemoryPages uint32 `yaml:"maxMemoryPages" jsonschema:"omitempty,minimum=1,maximum=65536"`
+	}
+
+	// Status is the status of WasmHost.
+	Status struct {
+		Health   string `yaml:"health"`
+		CodeSize int    `yaml:"codeSize"`
+		LoadedAt string `yaml:"loadedAt"`
+		IdleVMs  int    `yaml:"idleVMs"`
+		MaxVMs   int32  `yaml:"maxVMs"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.Code == "" {
+		return fmt.Errorf("code is empty")
+	}
+	return nil
+}
+
+// readCode reads the wasm binary, code could be a URL, a file path, or
+// the base64 encoded binary.
+func (s *Spec) readCode() ([]byte, error) {
+	if strings.HasPrefix(s.Code, "http://") || strings.HasPrefix(s.Code, "https://") {
+		resp, err := http.Get(s.Code)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	if code, err := base64.StdEncoding.DecodeString(s.Code); err == nil {
+		return code, nil
+	}
+
+	return ioutil.ReadFile(s.Code)
+}
+
+// Kind returns the kind of WasmHost.
+func (wh *WasmHost) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of WasmHost.
+func (wh *WasmHost) DefaultSpec() interface{} {
+	return &Spec{
+		MaxConcurrency: defaultMaxConcurrency,
+		Timeout:        defaultTimeout,
+		MaxMemoryPages: defaultMaxMemoryPages,
+	}
+}
+
+// Description returns the description of WasmHost.
+func (wh *WasmHost) Description() string {
+	return "WasmHost runs WebAssembly modules to inspect and modify requests and responses."
+}
+
+// Results returns the results of WasmHost.
+func (wh *WasmHost) Results() []string {
+	return results
+}
+
+// Init initializes WasmHost.
+func (wh *WasmHost) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	wh.pipeSpec, wh.spec, wh.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+
+	err := wh.reload()
+	if err != nil {
+		logger.Errorf("%s: load wasm code failed: %v", pipeSpec.Name(), err)
+	}
+}
+
+// Inherit inherits previous generation of WasmHost.
+func (wh *WasmHost) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	wh.pipeSpec, wh.spec, wh.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+
+	err := wh.reload()
+	if err == nil {
+		return
+	}
+
+	// NOTE: Keep serving with the previous code if the new one failed
+	// to load, so that a bad update doesn't break the traffic.
+	logger.Errorf("%s: load wasm code failed, keep using previous one: %v", pipeSpec.Name(), err)
+	prev := previousGeneration.(*WasmHost)
+	wh.pool, prev.handedOver = prev.pool, true
+}
+
+func (wh *WasmHost) reload() error {
+	wh.timeout = 0
+	if wh.spec.Timeout != "" {
+		timeout, err := time.ParseDuration(wh.spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", wh.spec.Timeout, err)
+		}
+		wh.timeout = timeout
+	}
+
+	code, err := wh.spec.readCode()
+	if err != nil {
+		return fmt.Errorf("read code failed: %v", err)
+	}
+
+	pool, err := newVMPool(stdcontext.Background(), code, wh.spec.MaxConcurrency, wh.spec.MaxMemoryPages)
+	if err != nil {
+		return err
+	}
+
+	wh.pool = pool
+	return nil
+}
+
+// Handle handles HTTPContext by running the wasm module.
+func (wh *WasmHost) Handle(ctx context.HTTPContext) string {
+	result := wh.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (wh *WasmHost) handle(ctx context.HTTPContext) string {
+	if wh.pool == nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag("wasmHost: wasm code is not loaded")
+		return resultWasmError
+	}
+
+	vm := wh.pool.get()
+	if vm == nil {
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag("wasmHost: out of vm")
+		return resultOutOfVM
+	}
+
+	r, err := vm.run(ctx, wh.timeout)
+	wh.pool.put(vm, err == nil)
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("wasmHost: ", err.Error()))
+		return resultWasmError
+	}
+
+	if r == 0 {
+		return ""
+	}
+	if r < 0 || r > maxWasmResult {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(fmt.Sprintf("wasmHost: unknown result %d", r))
+		return resultWasmError
+	}
+
+	return wasmResultToFilterResult(r)
+}
+
+// Status returns status.
+func (wh *WasmHost) Status() interface{} {
+	s := &Status{MaxVMs: wh.spec.MaxConcurrency}
+	if wh.pool == nil {
+		s.Health = "unloaded"
+		return s
+	}
+
+	s.Health = "loaded"
+	s.CodeSize = wh.pool.codeSize
+	s.LoadedAt = wh.pool.loadedAt.Format(time.RFC3339)
+	s.IdleVMs = wh.pool.idle()
+	return s
+}
+
+// Close closes WasmHost.
+func (wh *WasmHost) Close() {
+	if wh.pool != nil && !wh.handedOver {
+		wh.pool.close()
+	}
+}
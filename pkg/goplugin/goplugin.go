@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package goplugin loads filters from Go plugins at runtime.
+//
+// A plugin is a Go plugin(built with -buildmode=plugin) which exports:
+//
+//	func EasegressABIVersion() string
+//	func Filters() []httppipeline.Filter
+//
+// EasegressABIVersion must return ABIVersion the plugin built against.
+// Filters is optional for plugins registering plugin types by package
+// sdk in their init functions, other plugins must not register filters.
+package goplugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/sdk"
+)
+
+const (
+	// ABIVersion is the ABI version of plugins, it follows the version
+	// of the SDK which is the surface exposed to plugins.
+	ABIVersion = sdk.Version
+
+	abiVersionSymbol = "EasegressABIVersion"
+	filtersSymbol    = "Filters"
+
+	pluginExt = ".so"
+
+	// loadDelay is the delay to load a plugin after the last change of
+	// its file, so that half-written files will not be loaded.
+	loadDelay = time.Second
+)
+
+type (
+	// Loader loads plugins in the plugin directory, and watches the
+	// directory to load new plugins and unload removed ones.
+	Loader struct {
+		dir     string
+		watcher *fsnotify.Watcher
+		done    chan struct{}
+
+		mutex   sync.Mutex
+		plugins map[string]*Plugin
+		opened  map[string]struct{}
+		pending map[string]*time.Timer
+	}
+
+	// Plugin is the information of a loaded plugin.
+	Plugin struct {
+		Path       string    `yaml:"path"`
+		ABIVersion string    `yaml:"abiVersion"`
+		Kinds      []string  `yaml:"kinds"`
+		LoadedAt   time.Time `yaml:"loadedAt"`
+	}
+)
+
+// Global is the global plugin loader.
+var Global *Loader
+
+// New creates a Loader and loads plugins in the plugin directory,
+// plugins are disabled if the plugin directory is not configured.
+func New(opt *option.Options) (*Loader, error) {
+	l := &Loader{
+		dir:     opt.AbsPluginDir,
+		done:    make(chan struct{}),
+		plugins: map[string]*Plugin{},
+		opened:  map[string]struct{}{},
+		pending: map[string]*time.Timer{},
+	}
+	Global = l
+
+	if l.dir == "" {
+		return l, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create watcher failed: %v", err)
+	}
+	err = watcher.Add(l.dir)
+	if err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watch %s failed: %v", l.dir, err)
+	}
+	l.watcher = watcher
+
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("read %s failed: %v", l.dir, err)
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != pluginExt {
+			continue
+		}
+		// NOTE: Broken plugins should not stop the server.
+		err := l.Load(filepath.Join(l.dir, file.Name()))
+		if err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
+
+	go l.watch()
+
+	return l, nil
+}
+
+func (l *Loader) watch() {
+	for {
+		select {
+		case <-l.done:
+			return
+		case err, ok := <-l.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Errorf("watch plugin directory %s failed: %v", l.dir, err)
+		case event, ok := <-l.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Ext(event.Name) != pluginExt {
+				continue
+			}
+			switch {
+			case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				l.cancelLoad(event.Name)
+				l.Unload(event.Name)
+			case event.Op&(fsnotify.Create|fsnotify.Write) != 0:
+				l.delayLoad(event.Name)
+			}
+		}
+	}
+}
+
+func (l *Loader) delayLoad(path string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if timer, exists := l.pending[path]; exists {
+		timer.Reset(loadDelay)
+		return
+	}
+
+	l.pending[path] = time.AfterFunc(loadDelay, func() {
+		l.mutex.Lock()
+		delete(l.pending, path)
+		l.mutex.Unlock()
+
+		err := l.Load(path)
+		if err != nil {
+			logger.Errorf("%v", err)
+		}
+	})
+}
+
+func (l *Loader) cancelLoad(path string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if timer, exists := l.pending[path]; exists {
+		timer.Stop()
+		delete(l.pending, path)
+	}
+}
+
+// Load loads the plugin in path and registers its filters. All or none
+// of the filters are registered.
+func (l *Loader) Load(path string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// NOTE: Go caches opened plugins by path and never unloads them,
+	// opening the same path again returns the stale plugin.
+	if _, exists := l.opened[path]; exists {
+		return fmt.Errorf("plugin %s: opened before, please use a new file name for new versions", path)
+	}
+
+	// NOTE: Init functions of the plugin run in Open, plugin types
+	// registered by them are collected instead of registered.
+	var p *plugin.Plugin
+	var err error
+	filters := sdk.CollectPluginTypes(func() {
+		p, err = plugin.Open(path)
+	})
+	if err != nil {
+		return fmt.Errorf("plugin %s: open failed: %v", path, err)
+	}
+	l.opened[path] = struct{}{}
+
+	sym, err := p.Lookup(abiVersionSymbol)
+	if err != nil {
+		return fmt.Errorf("plugin %s: %v", path, err)
+	}
+	abiVersionFunc, ok := sym.(func() string)
+	if !ok {
+		return fmt.Errorf("plugin %s: want %s as func() string, got %T", path, abiVersionSymbol, sym)
+	}
+	abiVersion := abiVersionFunc()
+	if abiVersion != ABIVersion {
+		return fmt.Errorf("plugin %s: ABI version %s is incompatible with %s", path, abiVersion, ABIVersion)
+	}
+
+	sym, err = p.Lookup(filtersSymbol)
+	if err == nil {
+		filtersFunc, ok := sym.(func() []httppipeline.Filter)
+		if !ok {
+			return fmt.Errorf("plugin %s: want %s as func() []httppipeline.Filter, got %T", path, filtersSymbol, sym)
+		}
+		filters = append(filters, filtersFunc()...)
+	}
+
+	kinds := []string{}
+	for _, f := range filters {
+		err := httppipeline.TryRegister(f)
+		if err != nil {
+			for _, kind := range kinds {
+				httppipeline.Unregister(kind)
+			}
+			return fmt.Errorf("plugin %s: register filter failed: %v", path, err)
+		}
+		kinds = append(kinds, f.Kind())
+	}
+	if len(kinds) == 0 {
+		return fmt.Errorf("plugin %s: no filters", path)
+	}
+
+	l.plugins[path] = &Plugin{
+		Path:       path,
+		ABIVersion: abiVersion,
+		Kinds:      kinds,
+		LoadedAt:   time.Now(),
+	}
+	logger.Infof("plugin %s loaded, filters: %v", path, kinds)
+
+	return nil
+}
+
+// Unload unregisters all filters of the plugin in path.
+func (l *Loader) Unload(path string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	p, exists := l.plugins[path]
+	if !exists {
+		return
+	}
+
+	for _, kind := range p.Kinds {
+		httppipeline.Unregister(kind)
+	}
+	delete(l.plugins, path)
+
+	logger.Infof("plugin %s unloaded, filters: %v", path, p.Kinds)
+}
+
+// UnloadKind unregisters the filter of the kind. The filters of running
+// pipelines are not affected, but new pipelines could not use it any more.
+func (l *Loader) UnloadKind(kind string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for path, p := range l.plugins {
+		for i, k := range p.Kinds {
+			if k != kind {
+				continue
+			}
+
+			httppipeline.Unregister(kind)
+			p.Kinds = append(p.Kinds[:i:i], p.Kinds[i+1:]...)
+			if len(p.Kinds) == 0 {
+				delete(l.plugins, path)
+			}
+			logger.Infof("filter %s of plugin %s unloaded", kind, path)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("filter %s is not loaded from plugins", kind)
+}
+
+// Plugins returns all loaded plugins sorted by path.
+func (l *Loader) Plugins() []*Plugin {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	plugins := make([]*Plugin, 0, len(l.plugins))
+	for _, p := range l.plugins {
+		copied := *p
+		copied.Kinds = append([]string{}, p.Kinds...)
+		plugins = append(plugins, &copied)
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Path < plugins[j].Path
+	})
+
+	return plugins
+}
+
+// Close closes Loader, loaded filters are kept.
+func (l *Loader) Close(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	close(l.done)
+	if l.watcher != nil {
+		l.watcher.Close()
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for path, timer := range l.pending {
+		timer.Stop()
+		delete(l.pending, path)
+	}
+}
@@ -20,6 +20,7 @@ package graceupdate
 import (
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/megaease/easegress/pkg/logger"
@@ -31,6 +32,7 @@ var (
 	Global     = &gracenet.Net{}
 	didInherit = os.Getenv("LISTEN_FDS") != ""
 	ppid       = os.Getppid()
+	updating   int32
 )
 
 // IsInherit returns if I am the child process
@@ -39,6 +41,12 @@ func IsInherit() bool {
 	return didInherit
 }
 
+// IsUpdating returns if the child process has been started on gracefully
+// updating process, which takes over the place of me in the cluster.
+func IsUpdating() bool {
+	return atomic.LoadInt32(&updating) == 1
+}
+
 // CallOriProcessTerm notifies parent process to exist.
 func CallOriProcessTerm(done chan struct{}) bool {
 	if didInherit && ppid != 1 {
@@ -52,6 +60,22 @@ func CallOriProcessTerm(done chan struct{}) bool {
 	return false
 }
 
+// OriProcessExited returns if the parent process which I took over on
+// gracefully updating process has exited, it's always true if I'm not
+// the child process.
+func OriProcessExited() bool {
+	if !didInherit || ppid == 1 {
+		return true
+	}
+	// NOTE: I'm adopted by another process after my parent exited.
+	return os.Getppid() != ppid
+}
+
+// Update gracefully updates me, as if SIGUSR2 is received.
+func Update() error {
+	return syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+}
+
 // NotifySigUsr2 handles signal SIGUSR2 to gracefaully update.
 func NotifySigUsr2(closeCls func(), restartCls func()) {
 	sigUsr2 := make(chan os.Signal, 1)
@@ -66,6 +90,7 @@ func NotifySigUsr2(closeCls func(), restartCls func()) {
 			// Reset signal usr2 notify
 			NotifySigUsr2(closeCls, restartCls)
 		} else {
+			atomic.StoreInt32(&updating, 1)
 			childdone := make(chan error, 1)
 			go func() {
 				process, err := os.FindProcess(pid)
@@ -78,6 +103,7 @@ func NotifySigUsr2(closeCls func(), restartCls func()) {
 					select {
 					case err := <-childdone:
 						logger.Errorf("child proc exited: %v", err)
+						atomic.StoreInt32(&updating, 0)
 						restartCls()
 						NotifySigUsr2(closeCls, restartCls)
 					}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lint reports the non-fatal issues of object specs, which are
+// valid but likely not working as intended.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// RuleZeroTimeout is the rule of timeouts set to zero.
+	RuleZeroTimeout = "zeroTimeout"
+	// RuleInsecureTLS is the rule of skipping the verification of TLS
+	// certificates.
+	RuleInsecureTLS = "insecureTLS"
+	// RuleUnreferencedPipeline is the rule of pipelines referenced by
+	// no other objects.
+	RuleUnreferencedPipeline = "unreferencedPipeline"
+	// RuleMisplacedPipeline is the rule of objects referencing pipelines
+	// which don't run on all node groups of the objects.
+	RuleMisplacedPipeline = "misplacedPipeline"
+)
+
+var insecureKeys = map[string]struct{}{
+	"insecuretls":              {},
+	"insecureskipverify":       {},
+	"insecure-skip-tls-verify": {},
+}
+
+// Issue is a non-fatal issue of an object spec.
+type Issue struct {
+	Object  string `yaml:"object"`
+	Filter  string `yaml:"filter,omitempty"`
+	Field   string `yaml:"field,omitempty"`
+	Rule    string `yaml:"rule"`
+	Message string `yaml:"message"`
+}
+
+// Lint reports the issues of the specs, which are all the objects to
+// run, since some rules are about the references between them.
+func Lint(specs []*supervisor.Spec) []*Issue {
+	var issues []*Issue
+	values := make([]map[string]struct{}, len(specs))
+	for i, spec := range specs {
+		var config interface{}
+		if err := yaml.Unmarshal([]byte(spec.YAMLConfig()), &config); err != nil {
+			continue
+		}
+		values[i] = map[string]struct{}{}
+		walk(config, "", "", func(field, key string, value interface{}) {
+			// NOTE: Node groups are not references, even if they're the
+			// same as the names of objects.
+			if s, ok := value.(string); ok && !strings.HasPrefix(field, "nodeGroups[") {
+				values[i][s] = struct{}{}
+			}
+			if issue := lintField(field, key, value); issue != nil {
+				issue.Object = spec.Name()
+				issues = append(issues, issue)
+			}
+		})
+
+		if pipeline, ok := spec.ObjectSpec().(*httppipeline.Spec); ok {
+			for _, w := range pipeline.Lint() {
+				issues = append(issues, &Issue{
+					Object:  spec.Name(),
+					Filter:  w.Filter,
+					Rule:    w.Rule,
+					Message: w.Message,
+				})
+			}
+		}
+	}
+
+	for i, spec := range specs {
+		if spec.Kind() != httppipeline.Kind {
+			continue
+		}
+		referrers := referrers(specs, values, i)
+		if len(referrers) == 0 {
+			issues = append(issues, &Issue{
+				Object:  spec.Name(),
+				Rule:    RuleUnreferencedPipeline,
+				Message: fmt.Sprintf("pipeline %s is referenced by no other objects", spec.Name()),
+			})
+		}
+		for _, j := range referrers {
+			if group, ok := uncoveredGroup(specs[j], spec); !ok {
+				issues = append(issues, &Issue{
+					Object: specs[j].Name(),
+					Rule:   RuleMisplacedPipeline,
+					Message: fmt.Sprintf("pipeline %s doesn't run on node group %s, where %s runs",
+						spec.Name(), group, specs[j].Name()),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Object != issues[j].Object {
+			return issues[i].Object < issues[j].Object
+		}
+		return issues[i].Field < issues[j].Field
+	})
+
+	return issues
+}
+
+// referrers returns the indexes of the specs referencing specs[i], by its
+// qualified name, or by its name in the same namespace.
+func referrers(specs []*supervisor.Spec, values []map[string]struct{}, i int) []int {
+	var result []int
+	name := specs[i].Name()
+	localName := strings.TrimPrefix(name, specs[i].Namespace()+supervisor.NamespaceSeparator)
+	for j, spec := range specs {
+		if j == i {
+			continue
+		}
+		if _, exists := values[j][name]; exists {
+			result = append(result, j)
+			continue
+		}
+		if _, exists := values[j][localName]; exists && spec.Namespace() == specs[i].Namespace() {
+			result = append(result, j)
+		}
+	}
+	return result
+}
+
+// uncoveredGroup returns a node group where the referrer runs but the
+// pipeline doesn't, "*" stands for the members without the node groups of
+// the pipeline if the referrer runs on all members.
+func uncoveredGroup(referrer, pipeline *supervisor.Spec) (string, bool) {
+	if len(pipeline.NodeGroups()) == 0 {
+		return "", true
+	}
+	if len(referrer.NodeGroups()) == 0 {
+		return "*", false
+	}
+	for _, group := range referrer.NodeGroups() {
+		if !pipeline.PlacedOn(group) {
+			return group, false
+		}
+	}
+	return "", true
+}
+
+// walk calls fn with every scalar value in the config, its field path and
+// the key of the innermost map holding it.
+func walk(config interface{}, field, key string, fn func(field, key string, value interface{})) {
+	switch config := config.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range config {
+			walk(v, joinField(field, fmt.Sprint(k)), fmt.Sprint(k), fn)
+		}
+	case []interface{}:
+		for i, v := range config {
+			walk(v, fmt.Sprintf("%s[%d]", field, i), key, fn)
+		}
+	default:
+		fn(field, key, config)
+	}
+}
+
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// lintField returns the issue of the field, or nil if none.
+func lintField(field, key string, value interface{}) *Issue {
+	lowerKey := strings.ToLower(key)
+	switch {
+	case strings.Contains(lowerKey, "timeout") && isZeroDuration(value):
+		return &Issue{
+			Field:   field,
+			Rule:    RuleZeroTimeout,
+			Message: fmt.Sprintf("%s is zero, the operation may never time out or time out at once", field),
+		}
+	case value == true:
+		if _, exists := insecureKeys[lowerKey]; exists {
+			return &Issue{
+				Field:   field,
+				Rule:    RuleInsecureTLS,
+				Message: fmt.Sprintf("%s is enabled, the TLS certificates are not verified", field),
+			}
+		}
+	}
+	return nil
+}
+
+func isZeroDuration(value interface{}) bool {
+	switch value := value.(type) {
+	case int:
+		return value == 0
+	case string:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n == 0
+		}
+		d, err := time.ParseDuration(value)
+		return err == nil && d == 0
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/megaease/easegress/pkg/filter/ldapauth"
+	_ "github.com/megaease/easegress/pkg/filter/mock"
+	_ "github.com/megaease/easegress/pkg/object/crontrigger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestLint(t *testing.T) {
+	var specs []*supervisor.Spec
+	for _, config := range []string{`
+name: api
+kind: HTTPPipeline
+filters:
+- name: auth
+  kind: LDAPAuth
+  url: ldaps://ldap.example.com:636
+  userDN: uid={user},ou=people,dc=example,dc=com
+  insecureTLS: true
+  timeout: 0s
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`, `
+name: orphan
+kind: HTTPPipeline
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`, `
+name: cron
+kind: CronTrigger
+schedule: "@every 1m"
+pipeline: api
+timeout: 10s
+`, `
+name: batch
+kind: HTTPPipeline
+nodeGroups: [batch]
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`, `
+name: batch-cron
+kind: CronTrigger
+nodeGroups: [batch, api]
+schedule: "@every 1m"
+pipeline: batch
+`} {
+		spec, err := supervisor.NewSpec(config)
+		if err != nil {
+			t.Fatalf("new spec failed: %v", err)
+		}
+		specs = append(specs, spec)
+	}
+
+	got := map[string]*Issue{}
+	for _, issue := range Lint(specs) {
+		got[issue.Object+"/"+issue.Rule] = issue
+	}
+
+	if issue := got["api/"+RuleInsecureTLS]; issue == nil || issue.Field != "filters[0].insecureTLS" {
+		t.Errorf("want insecure TLS of api, got %+v", issue)
+	}
+	if issue := got["api/"+RuleZeroTimeout]; issue == nil || issue.Field != "filters[0].timeout" {
+		t.Errorf("want zero timeout of api, got %+v", issue)
+	}
+	if issue := got["api/"+RuleUnreferencedPipeline]; issue != nil {
+		t.Errorf("want api referenced, got %+v", issue)
+	}
+	if issue := got["orphan/"+RuleUnreferencedPipeline]; issue == nil {
+		t.Errorf("want orphan unreferenced")
+	}
+	if issue := got["batch-cron/"+RuleMisplacedPipeline]; issue == nil || !strings.Contains(issue.Message, "node group api") {
+		t.Errorf("want batch-cron misplaced on node group api, got %+v", issue)
+	}
+	if issue := got["cron/"+RuleMisplacedPipeline]; issue != nil {
+		t.Errorf("want api placed on all members, got %+v", issue)
+	}
+	for key := range got {
+		if strings.HasPrefix(key, "cron/") {
+			t.Errorf("want no issues of cron, got %s", key)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bussubscriber
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/bus"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codecounter"
+)
+
+const (
+	// Category is the category of BusSubscriber.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of BusSubscriber.
+	Kind = "BusSubscriber"
+
+	defaultBufferSize = 1024
+	defaultWorkers    = 1
+
+	headerBusTopic = "X-EG-Bus-Topic"
+	headerBusTime  = "X-EG-Bus-Time"
+)
+
+func init() {
+	supervisor.Register(&BusSubscriber{})
+}
+
+type (
+	// BusSubscriber is Object BusSubscriber, it subscribes a topic of the
+	// message bus and sends the messages to a pipeline as requests.
+	BusSubscriber struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		sub     *bus.Subscription
+		watcher cluster.Watcher
+		timeout time.Duration
+		done    chan struct{}
+		wg      sync.WaitGroup
+
+		relayed uint64
+
+		statusMutex sync.Mutex
+		handled     uint64
+		failed      uint64
+		cc          *codecounter.CodeCounter
+	}
+
+	// Spec describes the BusSubscriber.
+	Spec struct {
+		Topic      string `yaml:"topic" jsonschema:"required,format=urlname"`
+		Pipeline   string `yaml:"pipeline" jsonschema:"required"`
+		BufferSize int    `yaml:"bufferSize" jsonschema:"omitempty,minimum=1"`
+		Workers    int    `yaml:"workers" jsonschema:"omitempty,minimum=1"`
+		Timeout    string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		// Cluster receives the messages published on other members of
+		// the cluster too, it's best-effort.
+		Cluster bool `yaml:"cluster" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of BusSubscriber.
+	Status struct {
+		Received uint64         `yaml:"received"`
+		Relayed  uint64         `yaml:"relayed,omitempty"`
+		Dropped  uint64         `yaml:"dropped"`
+		Pending  int            `yaml:"pending"`
+		Handled  uint64         `yaml:"handled"`
+		Failed   uint64         `yaml:"failed"`
+		Codes    map[int]uint64 `yaml:"codes"`
+	}
+)
+
+// Category returns the category of BusSubscriber.
+func (bs *BusSubscriber) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of BusSubscriber.
+func (bs *BusSubscriber) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of BusSubscriber.
+func (bs *BusSubscriber) DefaultSpec() interface{} {
+	return &Spec{
+		BufferSize: defaultBufferSize,
+		Workers:    defaultWorkers,
+	}
+}
+
+// Init initializes BusSubscriber.
+func (bs *BusSubscriber) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	bs.superSpec, bs.spec, bs.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	bs.reload(nil)
+}
+
+// Inherit inherits previous generation of BusSubscriber.
+func (bs *BusSubscriber) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	bs.superSpec, bs.spec, bs.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+
+	// NOTE: The subscription of the same topic is taken over, so the
+	// buffered messages are not lost.
+	prev := previousGeneration.(*BusSubscriber)
+	prev.stop()
+	if prev.spec.Topic == bs.spec.Topic && prev.spec.BufferSize == bs.spec.BufferSize {
+		bs.reload(prev.sub)
+	} else {
+		prev.sub.Close()
+		bs.reload(nil)
+	}
+}
+
+func (bs *BusSubscriber) reload(sub *bus.Subscription) {
+	bs.cc = codecounter.New()
+	bs.done = make(chan struct{})
+
+	// NOTE: The format has been validated.
+	bs.timeout, _ = time.ParseDuration(bs.spec.Timeout)
+
+	bs.sub = sub
+	if bs.sub == nil {
+		bs.sub = bus.Global.Subscribe(bs.spec.Topic, bs.spec.BufferSize)
+	}
+
+	for i := 0; i < bs.spec.Workers; i++ {
+		bs.wg.Add(1)
+		go bs.work()
+	}
+
+	if bs.spec.Cluster {
+		bs.watch()
+	}
+}
+
+func (bs *BusSubscriber) work() {
+	defer bs.wg.Done()
+
+	for {
+		// NOTE: Check done first, the channel of messages may be ready
+		// at the same time.
+		select {
+		case <-bs.done:
+			return
+		default:
+		}
+
+		select {
+		case <-bs.done:
+			return
+		case msg, ok := <-bs.sub.C():
+			if !ok {
+				return
+			}
+			bs.handle(msg)
+		}
+	}
+}
+
+// watch delivers the messages published on other members, which are
+// relayed through the cluster store.
+func (bs *BusSubscriber) watch() {
+	cls := bs.super.Cluster()
+	watcher, err := cls.Watcher()
+	if err != nil {
+		logger.Errorf("%s: create cluster watcher failed: %v", bs.superSpec.Name(), err)
+		return
+	}
+	ch, err := watcher.WatchPrefix(cls.Layout().BusTopicPrefix(bs.spec.Topic))
+	if err != nil {
+		watcher.Close()
+		logger.Errorf("%s: watch cluster failed: %v", bs.superSpec.Name(), err)
+		return
+	}
+	bs.watcher = watcher
+
+	ownPrefix := cls.Layout().BusMemberPrefix(bs.spec.Topic)
+	bs.wg.Add(1)
+	go func() {
+		defer bs.wg.Done()
+		for kvs := range ch {
+			for k, v := range kvs {
+				// NOTE: Messages published on own member are delivered
+				// by the bus directly, and nil means the message expired.
+				if v == nil || strings.HasPrefix(k, ownPrefix) {
+					continue
+				}
+				msg := &bus.Message{}
+				err := json.Unmarshal([]byte(*v), msg)
+				if err != nil {
+					logger.Errorf("%s: unmarshal message %s failed: %v", bs.superSpec.Name(), k, err)
+					continue
+				}
+				if bs.sub.Deliver(msg) {
+					atomic.AddUint64(&bs.relayed, 1)
+				}
+			}
+		}
+	}()
+}
+
+func (bs *BusSubscriber) handle(msg *bus.Message) {
+	code, err := bs.send(msg)
+
+	bs.statusMutex.Lock()
+	defer bs.statusMutex.Unlock()
+	if err != nil {
+		bs.failed++
+		logger.Errorf("%s: %v", bs.superSpec.Name(), err)
+		return
+	}
+	bs.handled++
+	bs.cc.Count(code)
+}
+
+func (bs *BusSubscriber) send(msg *bus.Message) (int, error) {
+	ro, exists := bs.super.GetRunningObject(bs.spec.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		return 0, fmt.Errorf("pipeline %s not found", bs.spec.Pipeline)
+	}
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a handler", bs.spec.Pipeline)
+	}
+
+	stdctx := stdcontext.Background()
+	if bs.timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		stdctx, cancel = stdcontext.WithTimeout(stdctx, bs.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(stdctx, msg.Method, msg.URL, bytes.NewReader(msg.Body))
+	if err != nil {
+		return 0, fmt.Errorf("new request failed: %v", err)
+	}
+	// NOTE: The message is shared by all subscribers.
+	for k, v := range msg.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	req.Host = msg.Host
+	req.Header.Set(headerBusTopic, msg.Topic)
+	req.Header.Set(headerBusTime, msg.Time.Format(time.RFC3339Nano))
+
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+	handler.Handle(ctx)
+	ctx.Finish()
+
+	return ctx.Response().StatusCode(), nil
+}
+
+// Status returns the status of BusSubscriber.
+func (bs *BusSubscriber) Status() *supervisor.Status {
+	bs.statusMutex.Lock()
+	defer bs.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: &Status{
+			Received: bs.sub.Received(),
+			Relayed:  atomic.LoadUint64(&bs.relayed),
+			Dropped:  bs.sub.Dropped(),
+			Pending:  len(bs.sub.C()),
+			Handled:  bs.handled,
+			Failed:   bs.failed,
+			Codes:    bs.cc.Codes(),
+		},
+	}
+}
+
+// stop stops the workers after the messages being handled are done.
+func (bs *BusSubscriber) stop() {
+	close(bs.done)
+	if bs.watcher != nil {
+		bs.watcher.Close()
+	}
+	bs.wg.Wait()
+}
+
+// Close closes BusSubscriber.
+func (bs *BusSubscriber) Close() {
+	bs.stop()
+	bs.sub.Close()
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crontrigger
+
+import (
+	stdcontext "context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codecounter"
+
+	cron "github.com/robfig/cron/v3"
+)
+
+const (
+	// Category is the category of CronTrigger.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of CronTrigger.
+	Kind = "CronTrigger"
+
+	// withoutSecondOpt is the standard cron format of unix.
+	withoutSecondOpt = cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor
+	withSecondOpt    = cron.Second | withoutSecondOpt
+
+	defaultHost = "crontrigger.local"
+
+	headerCronTrigger = "X-EG-Cron-Trigger"
+	headerCronTime    = "X-EG-Cron-Time"
+)
+
+func init() {
+	supervisor.Register(&CronTrigger{})
+}
+
+type (
+	// CronTrigger is Object CronTrigger, it sends requests to a pipeline
+	// on a cron schedule, to run periodic jobs as pipelines.
+	CronTrigger struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		cron    *cron.Cron
+		entryID cron.EntryID
+		jitter  time.Duration
+		timeout time.Duration
+		mutex   cluster.Mutex
+		running int32
+		done    chan struct{}
+
+		statusMutex sync.Mutex
+		fired       uint64
+		skipped     uint64
+		failed      uint64
+		lastFired   time.Time
+		cc          *codecounter.CodeCounter
+	}
+
+	// Spec describes the CronTrigger.
+	Spec struct {
+		Schedule   string `yaml:"schedule" jsonschema:"required"`
+		WithSecond bool   `yaml:"withSecond" jsonschema:"omitempty"`
+		Pipeline   string `yaml:"pipeline" jsonschema:"required"`
+
+		Method string            `yaml:"method" jsonschema:"omitempty,format=httpmethod"`
+		Path   string            `yaml:"path" jsonschema:"omitempty,pattern=^/"`
+		Header map[string]string `yaml:"header" jsonschema:"omitempty"`
+		Body   string            `yaml:"body" jsonschema:"omitempty"`
+
+		// Jitter is the max random delay after the scheduled time, to
+		// spread the jobs scheduled at the same time.
+		Jitter  string `yaml:"jitter" jsonschema:"omitempty,format=duration"`
+		Timeout string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		// Singleton makes only one member of the cluster fire each tick.
+		Singleton bool `yaml:"singleton" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of CronTrigger.
+	Status struct {
+		Fired     uint64         `yaml:"fired"`
+		Skipped   uint64         `yaml:"skipped"`
+		Failed    uint64         `yaml:"failed"`
+		Codes     map[int]uint64 `yaml:"codes"`
+		LastFired string         `yaml:"lastFired,omitempty"`
+		NextFire  string         `yaml:"nextFire,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	_, err := cron.NewParser(spec.parseOpt()).Parse(spec.Schedule)
+	if err != nil {
+		return fmt.Errorf("parse schedule %s failed: %v", spec.Schedule, err)
+	}
+
+	return nil
+}
+
+func (spec Spec) parseOpt() cron.ParseOption {
+	if spec.WithSecond {
+		return withSecondOpt
+	}
+	return withoutSecondOpt
+}
+
+// Category returns the category of CronTrigger.
+func (ct *CronTrigger) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of CronTrigger.
+func (ct *CronTrigger) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of CronTrigger.
+func (ct *CronTrigger) DefaultSpec() interface{} {
+	return &Spec{
+		Method: http.MethodGet,
+		Path:   "/",
+	}
+}
+
+// Init initializes CronTrigger.
+func (ct *CronTrigger) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	ct.superSpec, ct.spec, ct.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	ct.reload()
+}
+
+// Inherit inherits previous generation of CronTrigger.
+func (ct *CronTrigger) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	ct.Init(superSpec, super)
+}
+
+func (ct *CronTrigger) reload() {
+	ct.cc = codecounter.New()
+	ct.done = make(chan struct{})
+
+	// NOTE: The formats have been validated.
+	ct.jitter, _ = time.ParseDuration(ct.spec.Jitter)
+	ct.timeout, _ = time.ParseDuration(ct.spec.Timeout)
+
+	ct.cron = cron.New(cron.WithParser(cron.NewParser(ct.spec.parseOpt())))
+	entryID, err := ct.cron.AddFunc(ct.spec.Schedule, ct.fire)
+	if err != nil {
+		logger.Errorf("BUG: add cron job %s failed: %v", ct.spec.Schedule, err)
+		return
+	}
+	ct.entryID = entryID
+	ct.cron.Start()
+}
+
+// fire sends the request of a tick, the tick is skipped if the request
+// of the previous one is still running.
+func (ct *CronTrigger) fire() {
+	if !atomic.CompareAndSwapInt32(&ct.running, 0, 1) {
+		ct.statusMutex.Lock()
+		ct.skipped++
+		ct.statusMutex.Unlock()
+		logger.Warnf("%s: skip the tick since the previous one is still running", ct.superSpec.Name())
+		return
+	}
+	defer atomic.StoreInt32(&ct.running, 0)
+
+	// NOTE: Prev is the scheduled time of the running tick, which is
+	// the same in all members, unlike the time it's fired.
+	tick := ct.cron.Entry(ct.entryID).Prev
+	if ct.spec.Singleton && !ct.claim(tick) {
+		return
+	}
+
+	if ct.jitter > 0 {
+		select {
+		case <-ct.done:
+			return
+		case <-time.After(time.Duration(rand.Int63n(int64(ct.jitter)))):
+		}
+	}
+
+	code, err := ct.send(tick)
+
+	ct.statusMutex.Lock()
+	defer ct.statusMutex.Unlock()
+	ct.fired++
+	ct.lastFired = time.Now()
+	if err != nil {
+		ct.failed++
+		logger.Errorf("%s: %v", ct.superSpec.Name(), err)
+		return
+	}
+	ct.cc.Count(code)
+}
+
+// claim claims the tick in the cluster, it returns false if the tick has
+// been claimed by another member.
+func (ct *CronTrigger) claim(tick time.Time) bool {
+	cls := ct.super.Cluster()
+	name := ct.superSpec.Name()
+
+	if ct.mutex == nil {
+		mutex, err := cls.Mutex(cls.Layout().CronTriggerLock(name))
+		if err != nil {
+			logger.Errorf("%s: create cluster mutex failed: %v", name, err)
+			return false
+		}
+		ct.mutex = mutex
+	}
+
+	err := ct.mutex.Lock()
+	if err != nil {
+		logger.Errorf("%s: lock cluster mutex failed: %v", name, err)
+		return false
+	}
+	defer ct.mutex.Unlock()
+
+	key := cls.Layout().StatusCronTriggerKey(name)
+	value, err := cls.Get(key)
+	if err != nil {
+		logger.Errorf("%s: get %s failed: %v", name, key, err)
+		return false
+	}
+	if value != nil {
+		last, _ := strconv.ParseInt(*value, 10, 64)
+		if last >= tick.Unix() {
+			return false
+		}
+	}
+
+	err = cls.Put(key, strconv.FormatInt(tick.Unix(), 10))
+	if err != nil {
+		logger.Errorf("%s: put %s failed: %v", name, key, err)
+		return false
+	}
+
+	return true
+}
+
+func (ct *CronTrigger) send(tick time.Time) (int, error) {
+	ro, exists := ct.super.GetRunningObject(ct.spec.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		return 0, fmt.Errorf("pipeline %s not found", ct.spec.Pipeline)
+	}
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a handler", ct.spec.Pipeline)
+	}
+
+	stdctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+	if ct.timeout > 0 {
+		var cancelTimeout stdcontext.CancelFunc
+		stdctx, cancelTimeout = stdcontext.WithTimeout(stdctx, ct.timeout)
+		defer cancelTimeout()
+	}
+	// NOTE: The running request is cancelled if it's closed.
+	go func() {
+		select {
+		case <-ct.done:
+			cancel()
+		case <-stdctx.Done():
+		}
+	}()
+
+	url := "http://" + defaultHost + ct.spec.Path
+	req, err := http.NewRequestWithContext(stdctx, ct.spec.Method, url, strings.NewReader(ct.spec.Body))
+	if err != nil {
+		return 0, fmt.Errorf("new request failed: %v", err)
+	}
+	for k, v := range ct.spec.Header {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(headerCronTrigger, ct.superSpec.Name())
+	req.Header.Set(headerCronTime, tick.Format(time.RFC3339))
+
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+	handler.Handle(ctx)
+	ctx.Finish()
+
+	return ctx.Response().StatusCode(), nil
+}
+
+// Status returns the status of CronTrigger.
+func (ct *CronTrigger) Status() *supervisor.Status {
+	ct.statusMutex.Lock()
+	defer ct.statusMutex.Unlock()
+
+	s := &Status{
+		Fired:   ct.fired,
+		Skipped: ct.skipped,
+		Failed:  ct.failed,
+		Codes:   ct.cc.Codes(),
+	}
+	if !ct.lastFired.IsZero() {
+		s.LastFired = ct.lastFired.Format(time.RFC3339)
+	}
+	if next := ct.cron.Entry(ct.entryID).Next; !next.IsZero() {
+		s.NextFire = next.Format(time.RFC3339)
+	}
+
+	return &supervisor.Status{
+		ObjectStatus: s,
+	}
+}
+
+// Drain stops scheduling and waits for the running tick to complete
+// until the deadline.
+func (ct *CronTrigger) Drain(deadline time.Time) {
+	ctx := ct.cron.Stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Until(deadline)):
+	}
+}
+
+// Close closes CronTrigger.
+func (ct *CronTrigger) Close() {
+	ct.cron.Stop()
+	close(ct.done)
+}
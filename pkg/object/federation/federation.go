@@ -0,0 +1,532 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package federation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/gitopssync"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of Federation.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of Federation.
+	Kind = "Federation"
+
+	requestTimeout = 30 * time.Second
+)
+
+func init() {
+	supervisor.Register(&Federation{})
+	secret.RegisterSensitiveFields("token")
+}
+
+type (
+	// Federation is Object Federation, it runs in a secondary region, syncs
+	// the objects of the primary region to the cluster, and reports the
+	// stats of the region back to the primary.
+	Federation struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		client *http.Client
+		ctx    context.Context
+		cancel context.CancelFunc
+		done   chan struct{}
+
+		statusMutex sync.Mutex
+		status      *Status
+	}
+
+	// Spec describes the Federation.
+	Spec struct {
+		Region string `yaml:"region" jsonschema:"required,pattern=^[A-Za-z0-9][-A-Za-z0-9_.]*$"`
+		// Primary is the address of the admin API of the primary region.
+		Primary string `yaml:"primary" jsonschema:"required,format=uri"`
+		// Token is the bearer token of the admin API of the primary.
+		Token string `yaml:"token" jsonschema:"omitempty"`
+		// Kinds are the kinds of objects to sync, all kinds except the
+		// ones syncing config, Federation and GitOpsSync, if empty.
+		Kinds        []string    `yaml:"kinds" jsonschema:"omitempty,uniqueItems=true"`
+		Overrides    []*Override `yaml:"overrides" jsonschema:"omitempty"`
+		PollInterval string      `yaml:"pollInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Override overrides the spec of an object in this region, the patch
+	// is merged into the spec like JSON merge patch: maps are merged
+	// recursively, null values delete the fields, and others replace them.
+	Override struct {
+		Name  string                 `yaml:"name" jsonschema:"required"`
+		Patch map[string]interface{} `yaml:"patch" jsonschema:"-"`
+	}
+
+	// Status is the status of Federation.
+	Status struct {
+		Objects    int    `yaml:"objects"`
+		SyncedAt   string `yaml:"syncedAt,omitempty"`
+		SyncError  string `yaml:"syncError,omitempty"`
+		ReportedAt string `yaml:"reportedAt,omitempty"`
+		// ReportError is the error of reporting to the primary.
+		ReportError string `yaml:"reportError,omitempty"`
+	}
+
+	// pipelineStatus extracts the stats from the status of a pipeline.
+	pipelineStatus struct {
+		Stats *struct {
+			Count    uint64  `yaml:"count"`
+			M1       float64 `yaml:"m1"`
+			ErrCount uint64  `yaml:"errCount"`
+			M1Err    float64 `yaml:"m1Err"`
+			Mean     uint64  `yaml:"mean"`
+			P99      float64 `yaml:"p99"`
+		} `yaml:"stats"`
+	}
+)
+
+// Category returns the category of Federation.
+func (f *Federation) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of Federation.
+func (f *Federation) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Federation.
+func (f *Federation) DefaultSpec() interface{} {
+	return &Spec{
+		PollInterval: "30s",
+	}
+}
+
+// Validate validates the spec of Federation.
+func (spec *Spec) Validate() error {
+	for _, o := range spec.Overrides {
+		if len(o.Patch) == 0 {
+			return fmt.Errorf("override of %s: empty patch", o.Name)
+		}
+		for _, field := range []string{"name", "kind"} {
+			if _, exists := o.Patch[field]; exists {
+				return fmt.Errorf("override of %s: %s can't be overridden", o.Name, field)
+			}
+		}
+	}
+	return nil
+}
+
+// Init initializes Federation.
+func (f *Federation) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	f.superSpec, f.spec, f.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	f.reload()
+}
+
+// Inherit inherits previous generation of Federation.
+func (f *Federation) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	f.Init(superSpec, super)
+}
+
+func (f *Federation) reload() {
+	f.status = &Status{}
+	f.client = &http.Client{Timeout: requestTimeout}
+	f.done = make(chan struct{})
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+
+	go f.run()
+}
+
+// owner returns the owner of the objects synced from the primary.
+func (f *Federation) owner() string {
+	return Kind + "/" + f.superSpec.Name()
+}
+
+func (f *Federation) run() {
+	defer close(f.done)
+
+	// NOTE: The format has been validated.
+	pollInterval, _ := time.ParseDuration(f.spec.PollInterval)
+	if pollInterval <= 0 {
+		pollInterval = 30 * time.Second
+	}
+
+	for {
+		f.sync()
+		f.report()
+
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// sync syncs the objects of the primary with the overrides applied.
+func (f *Federation) sync() {
+	count, err := f.syncSpecs()
+	if err != nil {
+		if f.ctx.Err() == nil {
+			logger.Errorf("%s sync from %s failed: %v", f.superSpec.Name(), f.spec.Primary, err)
+		}
+		f.updateStatus(func(s *Status) { s.SyncError = err.Error() })
+		return
+	}
+
+	f.updateStatus(func(s *Status) {
+		s.Objects, s.SyncedAt, s.SyncError = count, time.Now().Format(time.RFC3339), ""
+	})
+}
+
+func (f *Federation) syncSpecs() (int, error) {
+	body, err := f.call(http.MethodGet, api.ObjectPrefix, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	docs := []map[string]interface{}{}
+	err = yaml.Unmarshal(body, &docs)
+	if err != nil {
+		return 0, fmt.Errorf("unmarshal objects failed: %v", err)
+	}
+	docs, err = selectDocs(docs, f.spec.Kinds, f.spec.Overrides)
+	if err != nil {
+		return 0, err
+	}
+
+	server := api.GlobalServer
+	if server == nil {
+		return 0, fmt.Errorf("api server is not ready")
+	}
+
+	plan, err := server.SyncSpecs(f.owner(), mustMarshal(docs))
+	if err != nil {
+		return 0, err
+	}
+	for _, change := range plan.Changes {
+		logger.Infof("%s %s %s %s from %s", f.superSpec.Name(),
+			change.Action, change.Kind, change.Name, f.spec.Primary)
+	}
+
+	return len(docs), nil
+}
+
+// selectDocs selects the documents of the kinds, and applies the
+// overrides to them.
+func selectDocs(docs []map[string]interface{}, kinds []string,
+	overrides []*Override) ([]map[string]interface{}, error) {
+
+	patches := map[string]map[string]interface{}{}
+	for _, o := range overrides {
+		patches[o.Name] = o.Patch
+	}
+
+	selected := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		kind, _ := doc["kind"].(string)
+		if !selectKind(kind, kinds) {
+			continue
+		}
+
+		if patch, exists := patches[fmt.Sprint(doc["name"])]; exists {
+			doc = mergePatch(doc, patch).(map[string]interface{})
+		}
+		// NOTE: Plaintext sensitive fields are redacted by the primary,
+		// they must not overwrite the real ones.
+		if strings.Contains(string(mustMarshal(doc)), secret.Redacted) {
+			return nil, fmt.Errorf("%v has redacted sensitive fields, encrypt them "+
+				"with the master key shared by the regions, or use secret references", doc["name"])
+		}
+		selected = append(selected, doc)
+	}
+
+	return selected, nil
+}
+
+func selectKind(kind string, kinds []string) bool {
+	if len(kinds) == 0 {
+		return kind != Kind && kind != gitopssync.Kind
+	}
+
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// mergePatch merges the patch into the value like JSON merge patch, except
+// that lists of named maps, e.g. the filters of pipelines, are merged by
+// the names of their elements.
+func mergePatch(value interface{}, patch interface{}) interface{} {
+	if merged, ok := mergeNamedList(value, patch); ok {
+		return merged
+	}
+
+	patchMap, ok := toStringMap(patch)
+	if !ok {
+		return patch
+	}
+
+	valueMap, ok := toStringMap(value)
+	if !ok {
+		valueMap = map[string]interface{}{}
+	}
+	result := make(map[string]interface{}, len(valueMap))
+	for k, v := range valueMap {
+		result[k] = v
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = mergePatch(result[k], v)
+	}
+
+	return result
+}
+
+// mergeNamedList merges the patch into the value by the names of elements
+// if both of them are lists of named maps, the elements only in the value
+// are kept, and the ones only in the patch are appended.
+func mergeNamedList(value interface{}, patch interface{}) ([]interface{}, bool) {
+	valueList, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	patchList, ok := patch.([]interface{})
+	if !ok || !namedList(valueList) || !namedList(patchList) {
+		return nil, false
+	}
+
+	result := make([]interface{}, len(valueList))
+	copy(result, valueList)
+	for _, p := range patchList {
+		pm, _ := toStringMap(p)
+		merged := false
+		for i, v := range result {
+			vm, _ := toStringMap(v)
+			if vm["name"] == pm["name"] {
+				result[i] = mergePatch(vm, pm)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			result = append(result, p)
+		}
+	}
+
+	return result, true
+}
+
+func namedList(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, element := range list {
+		m, ok := toStringMap(element)
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// toStringMap converts the maps decoded from YAML to map[string]interface{}.
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[fmt.Sprint(k)] = v
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+func mustMarshal(v interface{}) []byte {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", v, err))
+	}
+	return buff
+}
+
+// report reports the state of the sync and the stats of the region to the
+// primary.
+func (f *Federation) report() {
+	report, err := f.regionReport()
+	if err == nil {
+		_, err = f.call(http.MethodPut,
+			fmt.Sprintf("%s/regions/%s", api.FederationPrefix, f.spec.Region), mustMarshal(report))
+	}
+	if err != nil {
+		if f.ctx.Err() == nil {
+			logger.Errorf("%s report to %s failed: %v", f.superSpec.Name(), f.spec.Primary, err)
+		}
+		f.updateStatus(func(s *Status) { s.ReportError = err.Error() })
+		return
+	}
+
+	f.updateStatus(func(s *Status) {
+		s.ReportedAt, s.ReportError = time.Now().Format(time.RFC3339), ""
+	})
+}
+
+func (f *Federation) regionReport() (*api.RegionReport, error) {
+	cls := f.super.Cluster()
+	layout := cls.Layout()
+
+	members, err := cls.GetPrefix(layout.StatusMemberPrefix())
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := cls.GetPrefix(layout.StatusObjectsPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	f.statusMutex.Lock()
+	report := &api.RegionReport{
+		Region:    f.spec.Region,
+		Cluster:   f.super.Options().ClusterName,
+		Members:   len(members),
+		Objects:   f.status.Objects,
+		SyncedAt:  f.status.SyncedAt,
+		SyncError: f.status.SyncError,
+	}
+	f.statusMutex.Unlock()
+
+	report.Pipelines = sumStats(layout.StatusObjectsPrefix(), statuses)
+	return report, nil
+}
+
+// sumStats sums up the stats of pipelines in the statuses of all members,
+// whose keys are <prefix><object>/<member>.
+func sumStats(prefix string, statuses map[string]string) map[string]*api.RegionStats {
+	pipelines := map[string]*api.RegionStats{}
+	for key, value := range statuses {
+		names := strings.Split(strings.TrimPrefix(key, prefix), "/")
+		if len(names) != 2 {
+			continue
+		}
+
+		status := pipelineStatus{}
+		if err := yaml.Unmarshal([]byte(value), &status); err != nil || status.Stats == nil {
+			continue
+		}
+
+		sum, exists := pipelines[names[0]]
+		if !exists {
+			sum = &api.RegionStats{}
+			pipelines[names[0]] = sum
+		}
+		sum.Add(&api.RegionStats{
+			Members:  1,
+			Count:    status.Stats.Count,
+			M1:       status.Stats.M1,
+			ErrCount: status.Stats.ErrCount,
+			M1Err:    status.Stats.M1Err,
+			Mean:     float64(status.Stats.Mean),
+			P99:      status.Stats.P99,
+		})
+	}
+
+	return pipelines
+}
+
+// call calls the admin API of the primary.
+func (f *Federation) call(method, path string, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(f.ctx, requestTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(f.spec.Primary, "/") + api.APIPrefix + path
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if f.spec.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.spec.Token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	buff, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, buff)
+	}
+	return buff, nil
+}
+
+func (f *Federation) updateStatus(fn func(s *Status)) {
+	f.statusMutex.Lock()
+	defer f.statusMutex.Unlock()
+
+	fn(f.status)
+}
+
+// Status returns the status of Federation.
+func (f *Federation) Status() *supervisor.Status {
+	f.statusMutex.Lock()
+	s := *f.status
+	f.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: &s,
+	}
+}
+
+// Close closes Federation.
+func (f *Federation) Close() {
+	f.cancel()
+	<-f.done
+}
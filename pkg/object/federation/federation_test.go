@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package federation
+
+import (
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMergePatch(t *testing.T) {
+	value := map[string]interface{}{}
+	yaml.Unmarshal([]byte(`
+name: pipeline-demo
+kind: HTTPPipeline
+flow:
+- filter: proxy
+filters:
+  proxy:
+    timeout: 1s
+    pools: [a]
+`), &value)
+	patch := map[string]interface{}{}
+	yaml.Unmarshal([]byte(`
+filters:
+  proxy:
+    timeout: 3s
+    pools: [b]
+flow: null
+`), &patch)
+
+	got := mergePatch(value, patch)
+	want := map[string]interface{}{}
+	yaml.Unmarshal([]byte(`
+name: pipeline-demo
+kind: HTTPPipeline
+filters:
+  proxy:
+    timeout: 3s
+    pools: [b]
+`), &want)
+	if string(mustMarshal(got)) != string(mustMarshal(want)) {
+		t.Errorf("want %s, got %s", mustMarshal(want), mustMarshal(got))
+	}
+}
+
+func TestMergeNamedList(t *testing.T) {
+	value := map[string]interface{}{}
+	yaml.Unmarshal([]byte(`
+filters:
+- name: validator
+  kind: Validator
+- name: proxy
+  kind: Proxy
+  mainPool:
+    servers:
+    - url: http://127.0.0.1:9095
+`), &value)
+	patch := map[string]interface{}{}
+	yaml.Unmarshal([]byte(`
+filters:
+- name: proxy
+  mainPool:
+    servers:
+    - url: http://10.0.0.1:9095
+- name: mock
+  kind: Mock
+`), &patch)
+
+	got := mergePatch(value, patch)
+	want := map[string]interface{}{}
+	yaml.Unmarshal([]byte(`
+filters:
+- name: validator
+  kind: Validator
+- name: proxy
+  kind: Proxy
+  mainPool:
+    servers:
+    - url: http://10.0.0.1:9095
+- name: mock
+  kind: Mock
+`), &want)
+	if string(mustMarshal(got)) != string(mustMarshal(want)) {
+		t.Errorf("want %s, got %s", mustMarshal(want), mustMarshal(got))
+	}
+}
+
+func TestSelectDocs(t *testing.T) {
+	docs := []map[string]interface{}{}
+	yaml.Unmarshal([]byte(`
+- name: server-demo
+  kind: HTTPServer
+  port: 10080
+- name: pipeline-demo
+  kind: HTTPPipeline
+- name: gitops
+  kind: GitOpsSync
+- name: federation
+  kind: Federation
+`), &docs)
+
+	overrides := []*Override{{Name: "server-demo", Patch: map[string]interface{}{"port": 10081}}}
+	selected, err := selectDocs(docs, nil, overrides)
+	if err != nil {
+		t.Fatalf("select failed: %v", err)
+	}
+	if len(selected) != 2 || selected[0]["port"] != 10081 {
+		t.Errorf("want server and pipeline with the port overridden, got %v", selected)
+	}
+
+	selected, err = selectDocs(docs, []string{"HTTPPipeline"}, nil)
+	if err != nil || len(selected) != 1 || selected[0]["name"] != "pipeline-demo" {
+		t.Errorf("want the pipeline only, got %v, %v", selected, err)
+	}
+
+	docs = append(docs, map[string]interface{}{"name": "consul", "kind": "ConsulServiceRegistry", "token": "******"})
+	_, err = selectDocs(docs, nil, nil)
+	if err == nil {
+		t.Errorf("want error for redacted fields")
+	}
+}
+
+func TestSumStats(t *testing.T) {
+	prefix := "/status/objects/"
+	stats := sumStats(prefix, map[string]string{
+		prefix + "pipeline-demo/eg1": "stats: {count: 100, m1: 1.5, errCount: 2, mean: 10, p99: 50}",
+		prefix + "pipeline-demo/eg2": "stats: {count: 300, m1: 2.5, errCount: 1, mean: 30, p99: 40}",
+		prefix + "server-demo/eg1":   "health: {}",
+	})
+
+	got := stats["pipeline-demo"]
+	if len(stats) != 1 || got == nil {
+		t.Fatalf("want stats of pipeline-demo only, got %v", stats)
+	}
+	if got.Members != 2 || got.Count != 400 || got.M1 != 4 || got.ErrCount != 3 ||
+		got.Mean != 25 || got.P99 != 50 {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestSpec(t *testing.T) {
+	_, err := supervisor.NewSpec(`
+name: federation
+kind: Federation
+region: eu-west
+primary: https://eg-us.example.com:2381
+overrides:
+- name: server-demo
+  patch:
+    port: 10081
+`)
+	if err != nil {
+		t.Errorf("want valid spec, got %v", err)
+	}
+
+	_, err = supervisor.NewSpec(`
+name: federation
+kind: Federation
+region: eu-west
+primary: https://eg-us.example.com:2381
+overrides:
+- name: server-demo
+  patch:
+    name: other
+`)
+	if err == nil {
+		t.Errorf("want error for overriding the name")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gitopssync
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitRepo is a local repository fetching the branch of the remote one by
+// the git command, only the latest commit is fetched.
+type gitRepo struct {
+	dir      string
+	url      string
+	branch   string
+	username string
+	password string
+}
+
+func (g *gitRepo) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if g.username != "" || g.password != "" {
+		// NOTE: Pass the credentials by the environment, so they're not
+		// in the arguments or the config files.
+		auth := base64.StdEncoding.EncodeToString([]byte(g.username + ":" + g.password))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// fetch fetches the latest commit of the branch, and returns its SHA.
+func (g *gitRepo) fetch(ctx context.Context) (string, error) {
+	err := os.MkdirAll(g.dir, 0o750)
+	if err != nil {
+		return "", fmt.Errorf("create dir %s failed: %v", g.dir, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		_, err = g.run(ctx, "init", "-q")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err = g.run(ctx, "fetch", "-q", "--depth", "1", g.url, "refs/heads/"+g.branch)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := g.run(ctx, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// readSpecs reads the YAML files under the dir of the commit in the order
+// of their paths, and joins them as YAML documents.
+func (g *gitRepo) readSpecs(ctx context.Context, commit, dir string) ([]byte, error) {
+	args := []string{"ls-tree", "-r", "--name-only", commit}
+	dir = strings.Trim(dir, "/")
+	if dir != "" {
+		args = append(args, "--", dir+"/")
+	}
+	out, err := g.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(out), "\n") {
+		switch path.Ext(file) {
+		case ".yaml", ".yml":
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	var buff []byte
+	for _, file := range files {
+		content, err := g.run(ctx, "cat-file", "blob", commit+":"+file)
+		if err != nil {
+			return nil, err
+		}
+		buff = append(buff, "---\n"...)
+		buff = append(buff, content...)
+		buff = append(buff, '\n')
+	}
+
+	return buff, nil
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gitopssync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of GitOpsSync.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of GitOpsSync.
+	Kind = "GitOpsSync"
+
+	// appliedRef is the ref of the last commit applied successfully, it's
+	// the target of rollbacks, and keeps the commit in the local repo.
+	appliedRef = "refs/easegress/applied"
+
+	syncTimeout = 5 * time.Minute
+)
+
+func init() {
+	supervisor.Register(&GitOpsSync{})
+	secret.RegisterSensitiveFields("password", "webhookSecret")
+}
+
+type (
+	// GitOpsSync is Object GitOpsSync, it syncs the specs in a git
+	// repository to the cluster.
+	GitOpsSync struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		repo    *gitRepo
+		trigger chan struct{}
+		ctx     context.Context
+		cancel  context.CancelFunc
+		done    chan struct{}
+
+		statusMutex sync.Mutex
+		status      *Status
+	}
+
+	// Spec describes the GitOpsSync.
+	Spec struct {
+		Repository string `yaml:"repository" jsonschema:"required"`
+		Branch     string `yaml:"branch" jsonschema:"omitempty"`
+		// Path is the directory of the specs in the repository, the YAML
+		// files under it are read recursively.
+		Path     string `yaml:"path" jsonschema:"omitempty"`
+		Username string `yaml:"username" jsonschema:"omitempty"`
+		Password string `yaml:"password" jsonschema:"omitempty"`
+
+		PollInterval string `yaml:"pollInterval" jsonschema:"omitempty,format=duration"`
+		// WebhookSecret verifies the push events, webhooks are disabled
+		// if it's empty.
+		WebhookSecret string `yaml:"webhookSecret" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of GitOpsSync.
+	Status struct {
+		Commit    string `yaml:"commit,omitempty"`
+		AppliedAt string `yaml:"appliedAt,omitempty"`
+		// FailedCommit is the commit failed to apply, it's not retried
+		// until a new commit is pushed.
+		FailedCommit   string `yaml:"failedCommit,omitempty"`
+		RolledBackTo   string `yaml:"rolledBackTo,omitempty"`
+		SyncError      string `yaml:"syncError,omitempty"`
+		LastSync       string `yaml:"lastSync,omitempty"`
+		WebhooksPushed uint64 `yaml:"webhooksPushed"`
+	}
+)
+
+// Category returns the category of GitOpsSync.
+func (g *GitOpsSync) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of GitOpsSync.
+func (g *GitOpsSync) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of GitOpsSync.
+func (g *GitOpsSync) DefaultSpec() interface{} {
+	return &Spec{
+		Branch:       "main",
+		PollInterval: "1m",
+	}
+}
+
+// Init initializes GitOpsSync.
+func (g *GitOpsSync) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	g.superSpec, g.spec, g.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	g.reload()
+}
+
+// Inherit inherits previous generation of GitOpsSync.
+func (g *GitOpsSync) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	g.Init(superSpec, super)
+}
+
+func (g *GitOpsSync) reload() {
+	g.status = &Status{}
+	g.trigger = make(chan struct{}, 1)
+	g.done = make(chan struct{})
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	g.repo = &gitRepo{
+		dir:      filepath.Join(g.super.Options().AbsDataDir, "gitops", g.superSpec.Name()),
+		url:      g.spec.Repository,
+		branch:   g.spec.Branch,
+		username: g.spec.Username,
+		password: g.spec.Password,
+	}
+
+	go g.run()
+}
+
+// owner returns the owner of the objects synced from the repository.
+func (g *GitOpsSync) owner() string {
+	return Kind + "/" + g.superSpec.Name()
+}
+
+func (g *GitOpsSync) run() {
+	defer close(g.done)
+
+	// NOTE: The format has been validated.
+	pollInterval, _ := time.ParseDuration(g.spec.PollInterval)
+	if pollInterval <= 0 {
+		pollInterval = time.Minute
+	}
+
+	for {
+		g.sync()
+
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		case <-g.trigger:
+		}
+	}
+}
+
+// sync fetches the latest commit and applies it, the last commit applied
+// successfully is applied again if it fails.
+func (g *GitOpsSync) sync() {
+	ctx, cancel := context.WithTimeout(g.ctx, syncTimeout)
+	defer cancel()
+
+	commit, err := g.repo.fetch(ctx)
+	if err != nil {
+		if g.ctx.Err() == nil {
+			logger.Errorf("%s fetch %s failed: %v", g.superSpec.Name(), g.spec.Repository, err)
+		}
+		g.updateStatus(func(s *Status) { s.SyncError = err.Error() })
+		return
+	}
+
+	g.statusMutex.Lock()
+	skip := commit == g.status.Commit || commit == g.status.FailedCommit
+	g.statusMutex.Unlock()
+	if skip {
+		g.updateStatus(func(s *Status) {
+			if commit == s.Commit {
+				s.SyncError = ""
+			}
+		})
+		return
+	}
+
+	err = g.apply(ctx, commit)
+	if err == nil {
+		_, err = g.repo.run(ctx, "update-ref", appliedRef, commit)
+		if err != nil {
+			logger.Errorf("%s update %s failed: %v", g.superSpec.Name(), appliedRef, err)
+		}
+		g.updateStatus(func(s *Status) {
+			s.Commit, s.AppliedAt = commit, time.Now().Format(time.RFC3339)
+			s.FailedCommit, s.RolledBackTo, s.SyncError = "", "", ""
+		})
+		return
+	}
+
+	logger.Errorf("%s apply commit %s failed: %v", g.superSpec.Name(), commit, err)
+	syncErr := fmt.Sprintf("apply commit %s failed: %v", commit, err)
+
+	rolledBackTo, err := g.rollback(ctx)
+	if err != nil {
+		logger.Errorf("%s rollback failed: %v", g.superSpec.Name(), err)
+		syncErr += fmt.Sprintf("; rollback failed: %v", err)
+	}
+
+	g.updateStatus(func(s *Status) {
+		s.FailedCommit, s.RolledBackTo, s.SyncError = commit, rolledBackTo, syncErr
+		if rolledBackTo != "" {
+			s.Commit = rolledBackTo
+		}
+	})
+}
+
+// apply reads the specs of the commit and syncs them to the cluster.
+func (g *GitOpsSync) apply(ctx context.Context, commit string) error {
+	body, err := g.repo.readSpecs(ctx, commit, g.spec.Path)
+	if err != nil {
+		return err
+	}
+
+	server := api.GlobalServer
+	if server == nil {
+		return fmt.Errorf("api server is not ready")
+	}
+
+	plan, err := server.SyncSpecs(g.owner(), body)
+	if err != nil {
+		return err
+	}
+	for _, change := range plan.Changes {
+		logger.Infof("%s %s %s %s from commit %s", g.superSpec.Name(),
+			change.Action, change.Kind, change.Name, shortSHA(commit))
+	}
+
+	return nil
+}
+
+// rollback applies the last commit applied successfully, it returns
+// empty if there is none.
+func (g *GitOpsSync) rollback(ctx context.Context) (string, error) {
+	out, err := g.repo.run(ctx, "rev-parse", "-q", "--verify", appliedRef)
+	if err != nil {
+		// NOTE: Nothing has been applied successfully.
+		return "", nil
+	}
+	commit := strings.TrimSpace(string(out))
+
+	err = g.apply(ctx, commit)
+	if err != nil {
+		return "", fmt.Errorf("apply commit %s failed: %v", commit, err)
+	}
+
+	logger.Infof("%s rolled back to commit %s", g.superSpec.Name(), shortSHA(commit))
+	return commit, nil
+}
+
+func shortSHA(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+func (g *GitOpsSync) updateStatus(fn func(s *Status)) {
+	g.statusMutex.Lock()
+	defer g.statusMutex.Unlock()
+
+	fn(g.status)
+	g.status.LastSync = time.Now().Format(time.RFC3339)
+}
+
+// Status returns the status of GitOpsSync.
+func (g *GitOpsSync) Status() *supervisor.Status {
+	g.statusMutex.Lock()
+	s := *g.status
+	g.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: &s,
+	}
+}
+
+// Close closes GitOpsSync, it waits for the running git commands, so the
+// next generation doesn't run into their lock files.
+func (g *GitOpsSync) Close() {
+	g.cancel()
+	<-g.done
+}
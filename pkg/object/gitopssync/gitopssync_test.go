@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gitopssync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gitCommit(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(file), 0o750)
+		if err := ioutil.WriteFile(file, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "test"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+}
+
+func TestGitRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	remote, err := ioutil.TempDir("", "gitops-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(remote)
+	local, err := ioutil.TempDir("", "gitops-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	cmd := exec.Command("git", "init", "-q", "-b", "main")
+	cmd.Dir = remote
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	gitCommit(t, remote, map[string]string{
+		"README.md":                  "# config",
+		"production/b.yaml":          "name: b",
+		"production/pipelines/a.yml": "name: a",
+		"staging/c.yaml":             "name: c",
+	})
+
+	repo := &gitRepo{dir: filepath.Join(local, "repo"), url: remote, branch: "main"}
+	ctx := context.Background()
+	commit, err := repo.fetch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commit) != 40 {
+		t.Fatalf("invalid commit %s", commit)
+	}
+
+	body, err := repo.readSpecs(ctx, commit, "/production/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "---\nname: b\n---\nname: a\n"; string(body) != want {
+		t.Errorf("want %q, got %q", want, body)
+	}
+
+	gitCommit(t, remote, map[string]string{"production/b.yaml": "name: b2"})
+	next, err := repo.fetch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == commit {
+		t.Fatalf("new commit not fetched")
+	}
+	body, err = repo.readSpecs(ctx, next, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "name: b2") {
+		t.Errorf("unexpected specs %q", body)
+	}
+
+	// NOTE: The ref keeps the commit applied before for rollbacks.
+	if _, err := repo.run(ctx, "update-ref", appliedRef, commit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	body, err = repo.readSpecs(ctx, appliedRef, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "name: b2") {
+		t.Errorf("unexpected specs %q", body)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, c := range []struct {
+		header http.Header
+		want   bool
+	}{
+		{http.Header{"X-Hub-Signature-256": {signature}}, true},
+		{http.Header{"X-Hub-Signature-256": {"sha256=00"}}, false},
+		{http.Header{"X-Gitlab-Token": {"secret"}}, true},
+		{http.Header{"X-Gitlab-Token": {"wrong"}}, false},
+		{http.Header{}, false},
+	} {
+		if got := verifyWebhook("secret", c.header, body); got != c.want {
+			t.Errorf("header %v: want %v, got %v", c.header, c.want, got)
+		}
+	}
+}
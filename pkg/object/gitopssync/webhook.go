@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gitopssync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/api"
+)
+
+const maxWebhookBodySize = 4 << 20
+
+// HandleWebhook handles the push events of GitHub, GitLab and the
+// compatible ones, the events of other branches are ignored.
+func (g *GitOpsSync) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if g.spec.WebhookSecret == "" {
+		api.HandleAPIError(w, r, http.StatusForbidden, fmt.Errorf("webhooks are disabled"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+
+	if !verifyWebhook(g.spec.WebhookSecret, r.Header, body) {
+		api.HandleAPIError(w, r, http.StatusUnauthorized, fmt.Errorf("invalid signature or token"))
+		return
+	}
+
+	// NOTE: Other events, e.g. ping, carry no ref, they trigger syncing too.
+	event := &struct {
+		Ref string `json:"ref"`
+	}{}
+	json.Unmarshal(body, event)
+	if event.Ref != "" && event.Ref != "refs/heads/"+g.spec.Branch {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	g.updateStatus(func(s *Status) { s.WebhooksPushed++ })
+	select {
+	case g.trigger <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifyWebhook verifies the HMAC signature of GitHub or the token of
+// GitLab.
+func verifyWebhook(secret string, header http.Header, body []byte) bool {
+	if signature := header.Get("X-Hub-Signature-256"); signature != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	// RequestIDHeader is the header of the ID of the request, which is
+	// kept in the access records.
+	RequestIDHeader = "X-Request-Id"
+
+	accessRecordCount      = 1024
+	accessSubscriberBuffer = 256
+)
+
+type (
+	// AccessRecord is the record of a request handled by a pipeline of
+	// this member, the latest ones are kept in memory for tailing.
+	AccessRecord struct {
+		Time       time.Time `yaml:"time" json:"time"`
+		Pipeline   string    `yaml:"pipeline" json:"pipeline"`
+		RequestID  string    `yaml:"requestID,omitempty" json:"requestID,omitempty"`
+		RealIP     string    `yaml:"realIP" json:"realIP"`
+		Method     string    `yaml:"method" json:"method"`
+		Path       string    `yaml:"path" json:"path"`
+		StatusCode int       `yaml:"statusCode" json:"statusCode"`
+		Duration   string    `yaml:"duration" json:"duration"`
+	}
+
+	// accessLog is the ring of the latest access records, subscribers
+	// falling behind miss records instead of blocking requests.
+	accessLog struct {
+		mutex       sync.Mutex
+		records     []*AccessRecord
+		next        int
+		subscribers map[chan *AccessRecord]struct{}
+	}
+)
+
+var globalAccessLog = &accessLog{
+	records:     make([]*AccessRecord, 0, accessRecordCount),
+	subscribers: map[chan *AccessRecord]struct{}{},
+}
+
+func newAccessRecord(pipeline string, ctx context.HTTPContext) *AccessRecord {
+	r := ctx.Request()
+	return &AccessRecord{
+		Time:       time.Now(),
+		Pipeline:   pipeline,
+		RequestID:  r.Header().Get(RequestIDHeader),
+		RealIP:     r.RealIP(),
+		Method:     r.Method(),
+		Path:       r.Path(),
+		StatusCode: ctx.Response().StatusCode(),
+		Duration:   ctx.Duration().String(),
+	}
+}
+
+func (l *accessLog) append(record *AccessRecord) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.records) < accessRecordCount {
+		l.records = append(l.records, record)
+	} else {
+		l.records[l.next] = record
+		l.next = (l.next + 1) % accessRecordCount
+	}
+
+	for ch := range l.subscribers {
+		select {
+		case ch <- record:
+		default:
+		}
+	}
+}
+
+// RecentAccessRecords returns the latest limit records matched from the
+// oldest, all of them are returned if limit is 0.
+func RecentAccessRecords(match func(*AccessRecord) bool, limit int) []*AccessRecord {
+	l := globalAccessLog
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var result []*AccessRecord
+	for i := len(l.records) - 1; i >= 0; i-- {
+		record := l.records[(l.next+i)%len(l.records)]
+		if !match(record) {
+			continue
+		}
+		result = append(result, record)
+		if limit != 0 && len(result) == limit {
+			break
+		}
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// SubscribeAccessRecords returns the channel of the records from now on,
+// and the function to unsubscribe.
+func SubscribeAccessRecords() (<-chan *AccessRecord, func()) {
+	l := globalAccessLog
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ch := make(chan *AccessRecord, accessSubscriberBuffer)
+	l.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		delete(l.subscribers, ch)
+	}
+}
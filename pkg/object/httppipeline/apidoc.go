@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+const (
+	// APIInHeader is the location of parameters in headers.
+	APIInHeader = "header"
+	// APIInQuery is the location of parameters in the query.
+	APIInQuery = "query"
+	// APIInCookie is the location of parameters in cookies.
+	APIInCookie = "cookie"
+
+	// APISecurityAPIKey is the type of keys in parameters.
+	APISecurityAPIKey = "apiKey"
+	// APISecurityHTTP is the type of HTTP authentication schemes.
+	APISecurityHTTP = "http"
+	// APISecurityOpenIDConnect is the type of OpenID Connect.
+	APISecurityOpenIDConnect = "openIdConnect"
+)
+
+type (
+	// APIParameter is a parameter the filter requires of requests.
+	APIParameter struct {
+		Name        string
+		In          string
+		Required    bool
+		Enum        []string
+		Pattern     string
+		Description string
+	}
+
+	// APISecurity is an authentication scheme checked by the filter, in
+	// the terms of security schemes of OpenAPI.
+	APISecurity struct {
+		// Type is one of APISecurityAPIKey, APISecurityHTTP and
+		// APISecurityOpenIDConnect.
+		Type string
+		// Scheme and BearerFormat are of APISecurityHTTP, e.g. basic or
+		// bearer, and JWT.
+		Scheme       string
+		BearerFormat string
+		// In and Name are of APISecurityAPIKey, where the key is.
+		In   string
+		Name string
+		// OpenIDConnectURL is of APISecurityOpenIDConnect, the URL of
+		// the discovery document.
+		OpenIDConnectURL string
+		Description      string
+	}
+
+	// APIDescription describes what a filter requires of requests.
+	APIDescription struct {
+		// Filter is the name of the filter, it's set by the pipeline.
+		Filter     string
+		Parameters []*APIParameter
+		Security   []*APISecurity
+	}
+
+	// APIDescriber is implemented by filters checking requests, e.g.
+	// validators and authentication filters, so the API documents
+	// generated from pipelines describe the checks.
+	APIDescriber interface {
+		// DescribeAPI describes the checks of the filter with the spec,
+		// it returns nil if the filter checks nothing with the spec.
+		DescribeAPI(filterSpec *FilterSpec) *APIDescription
+	}
+)
+
+// DescribeAPI returns the descriptions of the filters in the flow of the
+// valid spec, in the order of the flow.
+func (s *Spec) DescribeAPI() []*APIDescription {
+	specs := map[string]*FilterSpec{}
+	for _, filter := range s.Filters {
+		// NOTE: The spec has been validated.
+		spec, err := newFilterSpecInternal(filter)
+		if err != nil {
+			continue
+		}
+		specs[spec.Name()] = spec
+	}
+
+	var descriptions []*APIDescription
+	for _, stage := range s.Graph() {
+		spec := specs[stage.Filter]
+		if spec == nil {
+			continue
+		}
+		describer, ok := spec.RootFilter().(APIDescriber)
+		if !ok {
+			continue
+		}
+		if description := describer.DescribeAPI(spec); description != nil {
+			description.Filter = stage.Filter
+			descriptions = append(descriptions, description)
+		}
+	}
+	return descriptions
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// ResultBudgetExceeded is the built-in result of filters making the
+	// request headers exceed the header budget of the pipeline.
+	ResultBudgetExceeded = "budgetExceeded"
+
+	// BudgetPolicyReject rejects the request exceeding the budget.
+	BudgetPolicyReject = "reject"
+	// BudgetPolicyEvict evicts the values added by the filter exceeding
+	// the budget, the request is rejected if it's still exceeded.
+	BudgetPolicyEvict = "evict"
+)
+
+type (
+	// HeaderBudgetSpec limits the request headers, which carry the values
+	// passed between filters, so a misbehaving filter can't grow them
+	// unboundedly.
+	HeaderBudgetSpec struct {
+		MaxBytes int    `yaml:"maxBytes" jsonschema:"omitempty,minimum=1"`
+		MaxCount int    `yaml:"maxCount" jsonschema:"omitempty,minimum=1"`
+		Policy   string `yaml:"policy" jsonschema:"omitempty,enum=,enum=reject,enum=evict"`
+	}
+
+	// HeaderBudgetStatus is the status of the header budget, the peaks are
+	// the high-water marks of all requests.
+	HeaderBudgetStatus struct {
+		PeakBytes int64  `yaml:"peakBytes"`
+		PeakCount int64  `yaml:"peakCount"`
+		Evicted   uint64 `yaml:"evicted"`
+		Rejected  uint64 `yaml:"rejected"`
+	}
+
+	headerBudget struct {
+		spec *HeaderBudgetSpec
+
+		peakBytes int64
+		peakCount int64
+		evicted   uint64
+		rejected  uint64
+	}
+
+	// budgetMark is the numbers of values of the request headers after
+	// the last check within the budget.
+	budgetMark map[string]int
+)
+
+// Validate validates HeaderBudgetSpec.
+func (s HeaderBudgetSpec) Validate() error {
+	if s.MaxBytes == 0 && s.MaxCount == 0 {
+		return fmt.Errorf("both maxBytes and maxCount are zero")
+	}
+
+	return nil
+}
+
+func newHeaderBudget(spec *HeaderBudgetSpec) *headerBudget {
+	return &headerBudget{spec: spec}
+}
+
+func (b *headerBudget) measure(h http.Header) (bytes, count int) {
+	for k, vs := range h {
+		count += len(vs)
+		for _, v := range vs {
+			bytes += len(k) + len(v)
+		}
+	}
+	return
+}
+
+func (b *headerBudget) exceeded(bytes, count int) bool {
+	return (b.spec.MaxBytes > 0 && bytes > b.spec.MaxBytes) ||
+		(b.spec.MaxCount > 0 && count > b.spec.MaxCount)
+}
+
+func (b *headerBudget) observe(bytes, count int) {
+	storeMax(&b.peakBytes, int64(bytes))
+	storeMax(&b.peakCount, int64(count))
+}
+
+func storeMax(addr *int64, value int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if value <= old || atomic.CompareAndSwapInt64(addr, old, value) {
+			return
+		}
+	}
+}
+
+// check checks the request headers after the filter, which is empty
+// before the first filter. The values added since the last check are
+// evicted if the policy is evict. It returns the mark of this check, and
+// false if the budget is still exceeded.
+func (b *headerBudget) check(ctx context.HTTPContext, filter string, mark budgetMark) (budgetMark, bool) {
+	h := ctx.Request().Header().Std()
+	bytes, count := b.measure(h)
+	b.observe(bytes, count)
+
+	if b.exceeded(bytes, count) && b.spec.Policy == BudgetPolicyEvict && mark != nil {
+		for k, vs := range h {
+			if n := mark[k]; n == 0 {
+				delete(h, k)
+			} else if len(vs) > n {
+				h[k] = vs[:n]
+			}
+		}
+		atomic.AddUint64(&b.evicted, 1)
+		ctx.AddTag(stringtool.Cat("header budget: evicted headers added by filter ", filter))
+		bytes, count = b.measure(h)
+	}
+
+	if b.exceeded(bytes, count) {
+		atomic.AddUint64(&b.rejected, 1)
+		return mark, false
+	}
+
+	if b.spec.Policy != BudgetPolicyEvict {
+		return nil, true
+	}
+	mark = make(budgetMark, len(h))
+	for k, vs := range h {
+		mark[k] = len(vs)
+	}
+	return mark, true
+}
+
+// budgetExceeded sets the response of the request exceeding the budget,
+// it's exceeded by the client if filter is empty.
+func budgetExceeded(ctx context.HTTPContext, filter string) string {
+	if filter == "" {
+		ctx.Response().SetStatusCode(http.StatusRequestHeaderFieldsTooLarge)
+		ctx.AddTag("header budget: exceeded by request")
+	} else {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat("header budget: exceeded by filter ", filter))
+	}
+	return ResultBudgetExceeded
+}
+
+func (b *headerBudget) status() *HeaderBudgetStatus {
+	return &HeaderBudgetStatus{
+		PeakBytes: atomic.LoadInt64(&b.peakBytes),
+		PeakCount: atomic.LoadInt64(&b.peakCount),
+		Evicted:   atomic.LoadUint64(&b.evicted),
+		Rejected:  atomic.LoadUint64(&b.rejected),
+	}
+}
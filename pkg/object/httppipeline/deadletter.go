@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"bytes"
+	stdcontext "context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	defaultDeadLetterMaxBodySize = 1024 * 1024
+
+	// Headers carrying the error metadata of dead letters.
+	headerDeadLetterPipeline   = "X-EG-Dead-Letter-Pipeline"
+	headerDeadLetterFilter     = "X-EG-Dead-Letter-Filter"
+	headerDeadLetterResult     = "X-EG-Dead-Letter-Result"
+	headerDeadLetterStatusCode = "X-EG-Dead-Letter-Status-Code"
+	headerDeadLetterTime       = "X-EG-Dead-Letter-Time"
+	headerDeadLetterTruncated  = "X-EG-Dead-Letter-Truncated"
+
+	// headerDeadLetterPrefix is the prefix of the headers above in the
+	// canonical form.
+	headerDeadLetterPrefix = "X-Eg-Dead-Letter-"
+)
+
+type (
+	// DeadLetterSpec describes the dead-letter pipeline of HTTPPipeline.
+	DeadLetterSpec struct {
+		Pipeline    string   `yaml:"pipeline" jsonschema:"required"`
+		Results     []string `yaml:"results" jsonschema:"omitempty,uniqueItems=true"`
+		StatusCodes []int    `yaml:"statusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		MaxBodySize int64    `yaml:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// DeadLetterStatus is the status of dead letters.
+	DeadLetterStatus struct {
+		Sent   uint64 `yaml:"sent"`
+		Failed uint64 `yaml:"failed"`
+	}
+
+	deadLetter struct {
+		spec     *DeadLetterSpec
+		super    *supervisor.Supervisor
+		pipeline string
+
+		sent   uint64
+		failed uint64
+	}
+
+	// deadLetterKey is the key of the request context value marking dead
+	// letters, so they're never sent to a dead-letter pipeline again.
+	deadLetterKey struct{}
+
+	// deadLetterRecord records the original request and the failure of it.
+	deadLetterRecord struct {
+		body *captureReader
+
+		filter string
+		result string
+		fatal  bool
+	}
+
+	// captureReader keeps the body up to maxBodySize+1 bytes while it's
+	// read by filters. Reads are serialized, since the rest of the body
+	// may be read for the dead letter while the transport of a proxy is
+	// still reading it.
+	captureReader struct {
+		mutex       sync.Mutex
+		body        io.Reader
+		buff        bytes.Buffer
+		maxBodySize int64
+		err         error
+	}
+)
+
+func newDeadLetter(spec *DeadLetterSpec, super *supervisor.Supervisor, pipeline string) *deadLetter {
+	return &deadLetter{
+		spec:     spec,
+		super:    super,
+		pipeline: pipeline,
+	}
+}
+
+// capture wraps the body of the request to capture it while it's read,
+// nothing is read ahead. It returns nil if the request is a dead letter
+// itself, to avoid looping.
+func (dl *deadLetter) capture(ctx context.HTTPContext) *deadLetterRecord {
+	r := ctx.Request()
+	if r.Std().Context().Value(deadLetterKey{}) != nil {
+		return nil
+	}
+
+	record := &deadLetterRecord{}
+	if r.Body() == nil {
+		return record
+	}
+
+	maxBodySize := dl.spec.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = defaultDeadLetterMaxBodySize
+	}
+	record.body = &captureReader{body: r.Body(), maxBodySize: maxBodySize}
+	r.SetBody(record.body)
+
+	return record
+}
+
+// record records the result of the filter.
+func (dl *deadLetter) record(record *deadLetterRecord, filter, result string) {
+	if result == "" {
+		// NOTE: The filter succeeded at last, e.g. called again by Retry.
+		if record.filter == filter {
+			record.filter, record.result, record.fatal = "", "", false
+		}
+		return
+	}
+
+	if record.fatal && record.filter != filter {
+		return
+	}
+
+	record.filter, record.result = filter, result
+	record.fatal = stringtool.StrInSlice(result, dl.spec.Results)
+}
+
+// handle sends the request to the dead-letter pipeline if it failed.
+func (dl *deadLetter) handle(ctx context.HTTPContext, record *deadLetterRecord, result string) {
+	statusCode := ctx.Response().StatusCode()
+
+	failed := record.fatal
+	if !failed && len(dl.spec.Results) == 0 && result != "" {
+		// NOTE: The result isn't handled by any filter.
+		failed = true
+	}
+	if !failed {
+		for _, code := range dl.spec.StatusCodes {
+			if code == statusCode {
+				failed = true
+				break
+			}
+		}
+	}
+	if !failed {
+		return
+	}
+
+	var body []byte
+	var truncated bool
+	if record.body != nil {
+		var err error
+		body, truncated, err = record.body.captured()
+		if err != nil {
+			logger.Warnf("%s: read body for dead letter failed: %v", dl.pipeline, err)
+		}
+	}
+
+	r := ctx.Request()
+	req, err := http.NewRequest(r.Method(), r.Std().URL.String(), bytes.NewReader(body))
+	if err != nil {
+		atomic.AddUint64(&dl.failed, 1)
+		logger.Errorf("%s: new dead letter failed: %v", dl.pipeline, err)
+		return
+	}
+	req.Header = r.Header().Copy().Std()
+	req.Host = r.Host()
+	req.RemoteAddr = r.Std().RemoteAddr
+	req = req.WithContext(stdcontext.WithValue(req.Context(), deadLetterKey{}, true))
+
+	// NOTE: The metadata headers sent by the client are dropped, so they
+	// can't be confused with ours.
+	for key := range req.Header {
+		if strings.HasPrefix(key, headerDeadLetterPrefix) {
+			req.Header.Del(key)
+		}
+	}
+
+	req.Header.Set(headerDeadLetterPipeline, dl.pipeline)
+	req.Header.Set(headerDeadLetterStatusCode, strconv.Itoa(statusCode))
+	req.Header.Set(headerDeadLetterTime, time.Now().Format(time.RFC3339))
+	if record.filter != "" {
+		req.Header.Set(headerDeadLetterFilter, record.filter)
+		req.Header.Set(headerDeadLetterResult, record.result)
+	}
+	if truncated {
+		req.Header.Set(headerDeadLetterTruncated, "true")
+	}
+
+	go dl.send(req)
+}
+
+func (dl *deadLetter) send(req *http.Request) {
+	ro, exists := dl.super.GetRunningObject(dl.spec.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		atomic.AddUint64(&dl.failed, 1)
+		logger.Errorf("%s: dead-letter pipeline %s not found", dl.pipeline, dl.spec.Pipeline)
+		return
+	}
+
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		atomic.AddUint64(&dl.failed, 1)
+		logger.Errorf("%s: %s is not a handler", dl.pipeline, dl.spec.Pipeline)
+		return
+	}
+
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+	handler.Handle(ctx)
+	ctx.Finish()
+
+	atomic.AddUint64(&dl.sent, 1)
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	n, err := c.body.Read(p)
+	if remaining := c.maxBodySize + 1 - int64(c.buff.Len()); remaining > 0 && n > 0 {
+		if int64(n) > remaining {
+			c.buff.Write(p[:remaining])
+		} else {
+			c.buff.Write(p[:n])
+		}
+	}
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+func (c *captureReader) Close() error {
+	if closer, ok := c.body.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// captured reads the rest of the body up to maxBodySize if it's not read
+// to the end by filters, and returns the captured body and whether it's
+// truncated.
+func (c *captureReader) captured() ([]byte, bool, error) {
+	c.mutex.Lock()
+	done, remaining := c.err != nil, c.maxBodySize+1-int64(c.buff.Len())
+	c.mutex.Unlock()
+
+	if !done && remaining > 0 {
+		io.CopyN(ioutil.Discard, c, remaining)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var err error
+	if c.err != nil && c.err != io.EOF {
+		err = c.err
+	}
+	body := c.buff.Bytes()
+	if int64(len(body)) > c.maxBodySize {
+		return body[:c.maxBodySize], true, err
+	}
+	return body, false, err
+}
+
+func (dl *deadLetter) status() *DeadLetterStatus {
+	return &DeadLetterStatus{
+		Sent:   atomic.LoadUint64(&dl.sent),
+		Failed: atomic.LoadUint64(&dl.failed),
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// deadline limits the execution time of a filter in the flow. Only the
+// time spent in the filter itself is counted, so the clock is paused
+// while the filters after it are running.
+type deadline struct {
+	ctx       context.HTTPContext
+	err       error
+	remaining time.Duration
+	started   time.Time
+	timer     *time.Timer
+	expired   int32
+	reported  bool
+}
+
+func newDeadline(ctx context.HTTPContext, name string, timeout time.Duration) *deadline {
+	d := &deadline{
+		ctx:       ctx,
+		err:       fmt.Errorf("filter %s exceeded deadline %v", name, timeout),
+		remaining: timeout,
+	}
+	d.resume()
+	return d
+}
+
+func (d *deadline) expire() {
+	atomic.StoreInt32(&d.expired, 1)
+	d.ctx.Cancel(d.err)
+}
+
+// pause stops the clock, and reports whether the deadline was exceeded,
+// only once for a deadline. It's safe to call on a nil deadline.
+func (d *deadline) pause() bool {
+	if d == nil {
+		return false
+	}
+	if d.timer != nil && d.timer.Stop() {
+		d.remaining -= time.Since(d.started)
+	}
+	d.timer = nil
+
+	if d.reported || !d.isExpired() {
+		return false
+	}
+	d.reported = true
+	return true
+}
+
+// resume restarts the clock, it's safe to call on a nil deadline.
+func (d *deadline) resume() {
+	if d == nil || d.isExpired() {
+		return
+	}
+	d.started = time.Now()
+	d.timer = time.AfterFunc(d.remaining, d.expire)
+}
+
+func (d *deadline) isExpired() bool {
+	return atomic.LoadInt32(&d.expired) == 1
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	drainCheckInterval  = 50 * time.Millisecond
+)
+
+// enter and leave count the requests in flight of the generation.
+func (hp *HTTPPipeline) enter() { atomic.AddInt64(&hp.inFlight, 1) }
+func (hp *HTTPPipeline) leave() { atomic.AddInt64(&hp.inFlight, -1) }
+
+// drain waits until the generation has no request in flight, and reports
+// false if there're still some after the timeout. It checks after an
+// interval at first, because the requests dispatched just before the
+// switch may not have entered yet.
+func (hp *HTTPPipeline) drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(drainCheckInterval)
+		if atomic.LoadInt64(&hp.inFlight) == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+}
+
+// retire closes the filters of the previous generation after the requests
+// in flight of it completed, so a reload never breaks them. It's called
+// once the new generation was built, and the supervisor switches new
+// requests to the new generation right after that.
+func (hp *HTTPPipeline) retire(timeout time.Duration) {
+	go func() {
+		hp.drainFilters()
+		if !hp.drain(timeout) {
+			logger.Warnf("%s: close previous generation with %d requests in flight after %v",
+				hp.superSpec.Name(), atomic.LoadInt64(&hp.inFlight), timeout)
+		}
+		hp.Close()
+	}()
+}
+
+// Drain waits for the requests in flight to complete until the deadline.
+// It's called on shutdown after the traffic gates stopped accepting, and
+// the filters flush their buffered outputs in Close afterwards.
+func (hp *HTTPPipeline) Drain(deadline time.Time) {
+	hp.drainFilters()
+	if !hp.drain(time.Until(deadline)) {
+		logger.Warnf("%s: shutdown with %d requests in flight",
+			hp.superSpec.Name(), atomic.LoadInt64(&hp.inFlight))
+	}
+}
+
+// drainFilters calls OnDrain of the filters not kept by the next
+// generation, only once.
+func (hp *HTTPPipeline) drainFilters() {
+	hp.drainOnce.Do(func() {
+		for _, runningFilter := range hp.runningFilters {
+			if d, ok := runningFilter.filter.(Drainer); ok && !runningFilter.kept {
+				d.OnDrain()
+			}
+		}
+	})
+}
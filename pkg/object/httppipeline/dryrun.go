@@ -0,0 +1,455 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	dryRunMaxBodySize = 1024 * 1024
+	dryRunHost        = "dryrun.easegress"
+)
+
+type (
+	// DryRunRequest is the synthetic request of dry-run.
+	DryRunRequest struct {
+		Method string      `yaml:"method,omitempty"`
+		URL    string      `yaml:"url"`
+		Header http.Header `yaml:"header,omitempty"`
+		Body   string      `yaml:"body,omitempty"`
+	}
+
+	// DryRunMock is the mocked behavior of a filter in dry-run, the filter
+	// sets the response and returns the result.
+	DryRunMock struct {
+		Result     string            `yaml:"result,omitempty"`
+		StatusCode int               `yaml:"statusCode,omitempty"`
+		Header     map[string]string `yaml:"header,omitempty"`
+		Body       string            `yaml:"body,omitempty"`
+	}
+
+	// DryRunResult is the result of dry-run.
+	DryRunResult struct {
+		Stages   []*DryRunStage  `yaml:"stages"`
+		Response *DryRunResponse `yaml:"response"`
+	}
+
+	// DryRunStage is a filter called in dry-run.
+	DryRunStage struct {
+		Name     string `yaml:"name"`
+		Kind     string `yaml:"kind"`
+		Result   string `yaml:"result,omitempty"`
+		Duration string `yaml:"duration"`
+		Mocked   bool   `yaml:"mocked,omitempty"`
+		// Recorded is the request reaching the mocked filter.
+		Recorded *DryRunRequest `yaml:"recorded,omitempty"`
+		Effect   *DryRunEffect  `yaml:"effect,omitempty"`
+	}
+
+	// DryRunEffect is the changes made by a filter, the fields are the
+	// new values, and empty ones are not changed.
+	DryRunEffect struct {
+		Method         string              `yaml:"method,omitempty"`
+		URL            string              `yaml:"url,omitempty"`
+		RequestHeader  *DryRunHeaderChange `yaml:"requestHeader,omitempty"`
+		StatusCode     int                 `yaml:"statusCode,omitempty"`
+		ResponseHeader *DryRunHeaderChange `yaml:"responseHeader,omitempty"`
+	}
+
+	// DryRunHeaderChange is the changes of a header.
+	DryRunHeaderChange struct {
+		Set map[string][]string `yaml:"set,omitempty"`
+		Del []string            `yaml:"del,omitempty"`
+	}
+
+	// DryRunResponse is the final response of dry-run.
+	DryRunResponse struct {
+		StatusCode int         `yaml:"statusCode"`
+		Header     http.Header `yaml:"header,omitempty"`
+		Body       string      `yaml:"body,omitempty"`
+	}
+
+	// dryRun records the stages of a dry-run. The changes between two
+	// calls, entering or leaving a filter, are made by the filter on top
+	// of the stack, e.g. the filter calling the next one makes the changes
+	// before entering the next one, and after leaving it.
+	dryRun struct {
+		super *supervisor.Supervisor
+		mocks map[string]*DryRunMock
+
+		mutex  sync.Mutex
+		stages []*DryRunStage
+		stack  []*DryRunStage
+		last   *dryRunSnapshot
+	}
+
+	dryRunSnapshot struct {
+		method         string
+		url            string
+		requestHeader  http.Header
+		statusCode     int
+		responseHeader http.Header
+	}
+
+	// dryRunFilter wraps the filters of the sandbox.
+	dryRunFilter struct {
+		Filter
+		dr   *dryRun
+		spec *FilterSpec
+		mock *DryRunMock
+	}
+)
+
+// DryRun handles the request by a sandbox pipeline built from the spec, and
+// reports the effect of each filter. The filters are executed for real,
+// except the mocked ones, which record the requests reaching them and
+// reply the mocked responses instead. The journal and the dead-letter
+// queue are disabled in the sandbox.
+func DryRun(superSpec *supervisor.Spec, super *supervisor.Supervisor,
+	req *DryRunRequest, mocks map[string]*DryRunMock) (result *DryRunResult, err error) {
+
+	if superSpec.Kind() != Kind {
+		return nil, fmt.Errorf("%s is not a %s", superSpec.Name(), Kind)
+	}
+	// NOTE: The spec is changed for the sandbox, so it's not shared.
+	superSpec, err = supervisor.NewSpec(superSpec.YAMLConfig())
+	if err != nil {
+		return nil, err
+	}
+	spec := superSpec.ObjectSpec().(*Spec)
+	for name, mock := range mocks {
+		err := spec.validateMock(name, mock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stdr, err := req.newRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	spec.Journal, spec.DeadLetter = nil, nil
+	hp := &HTTPPipeline{
+		superSpec: superSpec,
+		spec:      spec,
+		super:     super,
+		dryRun:    &dryRun{super: super, mocks: mocks},
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("build pipeline failed: %v", e)
+		}
+	}()
+	hp.reload(nil)
+	defer hp.Close()
+
+	w := httptest.NewRecorder()
+	ctx := context.New(w, stdr, tracing.NoopTracing, "")
+	hp.dryRun.enter(ctx, nil)
+	hp.handle(ctx)
+	hp.dryRun.leave(ctx)
+	ctx.Finish()
+
+	result = &DryRunResult{
+		Stages: hp.dryRun.stages,
+		Response: &DryRunResponse{
+			StatusCode: w.Code,
+			Header:     w.Header(),
+			Body:       limitBody(w.Body.Bytes()),
+		},
+	}
+	return result, nil
+}
+
+func (spec *Spec) validateMock(name string, mock *DryRunMock) error {
+	for _, f := range spec.Filters {
+		if f["name"] != name {
+			continue
+		}
+		kind, _ := f["kind"].(string)
+		rootFilter, exists := getRootFilter(kind)
+		if !exists {
+			return fmt.Errorf("kind %s not found", kind)
+		}
+		if mock != nil && mock.Result != "" && !stringtool.StrInSlice(mock.Result, rootFilter.Results()) {
+			return fmt.Errorf("mocked result %s of filter %s not in %v", mock.Result, name, rootFilter.Results())
+		}
+		return nil
+	}
+	return fmt.Errorf("mocked filter %s not found", name)
+}
+
+func (req *DryRunRequest) newRequest() (*http.Request, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	url := req.URL
+	if strings.HasPrefix(url, "/") {
+		url = "http://" + dryRunHost + url
+	}
+	stdr, err := http.NewRequest(method, url, strings.NewReader(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("new request failed: %v", err)
+	}
+	for k, v := range req.Header {
+		stdr.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	stdr.RemoteAddr = "127.0.0.1:0"
+
+	return stdr, nil
+}
+
+func limitBody(body []byte) string {
+	if len(body) > dryRunMaxBodySize {
+		return string(body[:dryRunMaxBodySize])
+	}
+	return string(body)
+}
+
+// newFilter creates the filter of the sandbox, the mocked filters are not
+// initialized.
+func (dr *dryRun) newFilter(spec *FilterSpec, rootFilter Filter) Filter {
+	f := &dryRunFilter{dr: dr, spec: spec}
+	if mock, exists := dr.mocks[spec.Name()]; exists {
+		if mock == nil {
+			mock = &DryRunMock{}
+		}
+		f.Filter, f.mock = rootFilter, mock
+		return f
+	}
+
+	f.Filter = reflect.New(reflect.TypeOf(rootFilter).Elem()).Interface().(Filter)
+	f.Filter.Init(spec, dr.super)
+	return f
+}
+
+// Handle handles the context, the result of the filter is the one passed
+// to the next filter, or returned if it doesn't call the next one.
+func (f *dryRunFilter) Handle(ctx context.HTTPContext) string {
+	stage := &DryRunStage{Name: f.spec.Name(), Kind: f.spec.Kind()}
+	f.dr.enter(ctx, stage)
+
+	called := false
+	caller := ctx.HandlerCaller()
+	ctx.SetHandlerCaller(func(lastResult string) string {
+		stage.Result, called = lastResult, true
+		f.dr.leave(ctx)
+		defer f.dr.enter(ctx, stage)
+		return caller(lastResult)
+	})
+	defer ctx.SetHandlerCaller(caller)
+
+	startTime := time.Now()
+	var result string
+	if f.mock != nil {
+		result = f.handleMock(ctx, stage)
+	} else {
+		result = f.Filter.Handle(ctx)
+	}
+	stage.Duration = time.Since(startTime).String()
+
+	if !called {
+		stage.Result = result
+	}
+	f.dr.leave(ctx)
+	return result
+}
+
+func (f *dryRunFilter) handleMock(ctx context.HTTPContext, stage *DryRunStage) string {
+	stage.Mocked = true
+
+	r := ctx.Request()
+	stage.Recorded = &DryRunRequest{
+		Method: r.Method(),
+		URL:    r.Std().URL.String(),
+		Header: r.Header().Std().Clone(),
+	}
+	if body := r.Body(); body != nil {
+		buff := bytes.NewBuffer(nil)
+		io.CopyN(buff, body, dryRunMaxBodySize)
+		r.SetBody(io.MultiReader(bytes.NewReader(buff.Bytes()), body))
+		stage.Recorded.Body = buff.String()
+	}
+
+	w := ctx.Response()
+	if f.mock.StatusCode != 0 {
+		w.SetStatusCode(f.mock.StatusCode)
+	}
+	for k, v := range f.mock.Header {
+		w.Header().Set(k, v)
+	}
+	if f.mock.Body != "" {
+		w.SetBody(strings.NewReader(f.mock.Body))
+	}
+
+	return ctx.CallNextHandler(f.mock.Result)
+}
+
+// Status returns nil for the mocked filters.
+func (f *dryRunFilter) Status() interface{} {
+	if f.mock != nil {
+		return nil
+	}
+	return f.Filter.Status()
+}
+
+// Close closes the filter, the mocked filters are not initialized.
+func (f *dryRunFilter) Close() {
+	if f.mock == nil {
+		f.Filter.Close()
+	}
+}
+
+// enter records the changes till entering the stage, and pushes it, the
+// stage is nil for the client.
+func (dr *dryRun) enter(ctx context.HTTPContext, stage *DryRunStage) {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+
+	dr.record(ctx)
+	if stage != nil && !dr.contains(stage) {
+		dr.stages = append(dr.stages, stage)
+	}
+	dr.stack = append(dr.stack, stage)
+}
+
+// leave records the changes till leaving the stage on top, and pops it.
+func (dr *dryRun) leave(ctx context.HTTPContext) {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+
+	dr.record(ctx)
+	if len(dr.stack) > 0 {
+		dr.stack = dr.stack[:len(dr.stack)-1]
+	}
+}
+
+func (dr *dryRun) contains(stage *DryRunStage) bool {
+	for _, s := range dr.stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// record takes a snapshot, and attributes the changes since the last one
+// to the stage on top of the stack.
+func (dr *dryRun) record(ctx context.HTTPContext) {
+	snapshot := newDryRunSnapshot(ctx)
+	last := dr.last
+	dr.last = snapshot
+	if last == nil || len(dr.stack) == 0 {
+		return
+	}
+	stage := dr.stack[len(dr.stack)-1]
+	if stage == nil {
+		return
+	}
+
+	effect := stage.Effect
+	if effect == nil {
+		effect = &DryRunEffect{}
+	}
+	if snapshot.method != last.method {
+		effect.Method = snapshot.method
+	}
+	if snapshot.url != last.url {
+		effect.URL = snapshot.url
+	}
+	if snapshot.statusCode != last.statusCode {
+		effect.StatusCode = snapshot.statusCode
+	}
+	effect.RequestHeader = diffHeader(effect.RequestHeader, last.requestHeader, snapshot.requestHeader)
+	effect.ResponseHeader = diffHeader(effect.ResponseHeader, last.responseHeader, snapshot.responseHeader)
+
+	if *effect != (DryRunEffect{}) {
+		stage.Effect = effect
+	}
+}
+
+func newDryRunSnapshot(ctx context.HTTPContext) *dryRunSnapshot {
+	r, w := ctx.Request(), ctx.Response()
+	return &dryRunSnapshot{
+		method:         r.Method(),
+		url:            r.Std().URL.String(),
+		requestHeader:  r.Header().Std().Clone(),
+		statusCode:     w.StatusCode(),
+		responseHeader: w.Header().Std().Clone(),
+	}
+}
+
+// diffHeader merges the changes from prev to next into the change.
+func diffHeader(change *DryRunHeaderChange, prev, next http.Header) *DryRunHeaderChange {
+	if change == nil {
+		change = &DryRunHeaderChange{}
+	}
+
+	for k, v := range next {
+		if reflect.DeepEqual(prev[k], v) {
+			continue
+		}
+		if change.Set == nil {
+			change.Set = map[string][]string{}
+		}
+		change.Set[k] = v
+		change.Del = removeString(change.Del, k)
+	}
+	for k := range prev {
+		if _, exists := next[k]; exists {
+			continue
+		}
+		delete(change.Set, k)
+		if !stringtool.StrInSlice(k, change.Del) {
+			change.Del = append(change.Del, k)
+			sort.Strings(change.Del)
+		}
+	}
+
+	if len(change.Set) == 0 && len(change.Del) == 0 {
+		return nil
+	}
+	return change
+}
+
+func removeString(ss []string, s string) []string {
+	for i, v := range ss {
+		if v == s {
+			return append(ss[:i], ss[i+1:]...)
+		}
+	}
+	return ss
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import "sort"
+
+type (
+	// Stage is a filter in the flow of the pipeline, with the edges to
+	// the filters called after it.
+	Stage struct {
+		Filter string       `yaml:"filter"`
+		Kind   string       `yaml:"kind"`
+		If     string       `yaml:"if,omitempty"`
+		Edges  []*StageEdge `yaml:"edges"`
+	}
+
+	// StageEdge is an edge of the flow, Result is empty for the edge
+	// taken by the empty result, and To is LabelEND for the end of the
+	// pipeline.
+	StageEdge struct {
+		Result string `yaml:"result,omitempty"`
+		To     string `yaml:"to"`
+	}
+)
+
+// Graph returns the flow of the pipeline as a graph, the filters are in
+// the order of the flow, it's the order of filters if flow is empty.
+func (s *Spec) Graph() []*Stage {
+	kinds := map[string]string{}
+	var names []string
+	for _, filter := range s.Filters {
+		name, _ := filter["name"].(string)
+		kind, _ := filter["kind"].(string)
+		kinds[name] = kind
+		names = append(names, name)
+	}
+
+	flow := s.Flow
+	if len(flow) == 0 {
+		for _, name := range names {
+			flow = append(flow, Flow{Filter: name})
+		}
+	}
+
+	stages := make([]*Stage, 0, len(flow))
+	for i, f := range flow {
+		next := LabelEND
+		if f.Next != "" {
+			next = f.Next
+		} else if i+1 < len(flow) {
+			next = flow[i+1].Filter
+		}
+
+		stage := &Stage{
+			Filter: f.Filter,
+			Kind:   kinds[f.Filter],
+			If:     f.If,
+			Edges:  []*StageEdge{{To: next}},
+		}
+
+		results := make([]string, 0, len(f.JumpIf))
+		for result := range f.JumpIf {
+			results = append(results, result)
+		}
+		sort.Strings(results)
+		for _, result := range results {
+			stage.Edges = append(stage.Edges, &StageEdge{Result: result, To: f.JumpIf[result]})
+		}
+
+		stages = append(stages, stage)
+	}
+
+	return stages
+}
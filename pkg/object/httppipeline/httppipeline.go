@@ -20,6 +20,7 @@ package httppipeline
 import (
 	"bytes"
 	"fmt"
+	"net/http"
 	"reflect"
 	"sync"
 	"time"
@@ -27,7 +28,10 @@ import (
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/celexpr"
+	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/v"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -41,6 +45,10 @@ const (
 
 	// LabelEND is the built-in label for jumping of flow.
 	LabelEND = "END"
+
+	// ResultDeadlineExceeded is the built-in result of filters exceeding
+	// the timeout in the flow.
+	ResultDeadlineExceeded = "deadlineExceeded"
 )
 
 func init() {
@@ -56,32 +64,87 @@ type (
 
 		runningFilters []*runningFilter
 		ht             *context.HTTPTemplate
+		deadLetter     *deadLetter
+		retry          *retryPolicy
+		budget         *headerBudget
+		journal        *journal
+		journalKept    bool
+		drainTimeout   time.Duration
+		inFlight       int64
+		versionTag     string
+		drainOnce      sync.Once
+		dryRun         *dryRun
+		httpStat       *httpstat.HTTPStat
 	}
 
 	runningFilter struct {
 		spec       *FilterSpec
 		jumpIf     map[string]string
+		condition  *celexpr.Expression
+		timeout    time.Duration
+		next       int
+		stat       *stageStat
 		rootFilter Filter
 		filter     Filter
+		// kept means the filter is reconfigured in place and kept by
+		// the next generation, so it's not drained or closed.
+		kept bool
 	}
 
 	// Spec describes the HTTPPipeline.
 	Spec struct {
-		Flow    []Flow                   `yaml:"flow" jsonschema:"omitempty"`
-		Filters []map[string]interface{} `yaml:"filters" jsonschema:"-"`
+		Flow       []Flow                   `yaml:"flow" jsonschema:"omitempty"`
+		Filters    []map[string]interface{} `yaml:"filters" jsonschema:"-"`
+		DeadLetter *DeadLetterSpec          `yaml:"deadLetter,omitempty" jsonschema:"omitempty"`
+		Retry      *RetrySpec               `yaml:"retry,omitempty" jsonschema:"omitempty"`
+		// HeaderBudget limits the request headers, which is checked
+		// before each filter. The result of the filter exceeding it is
+		// ResultBudgetExceeded.
+		HeaderBudget *HeaderBudgetSpec `yaml:"headerBudget,omitempty" jsonschema:"omitempty"`
+		// Journal writes the requests to an append-only log before
+		// handling them, so they can be replayed later.
+		Journal *JournalSpec `yaml:"journal,omitempty" jsonschema:"omitempty"`
+		// DrainTimeout is the max time to wait for the requests in flight
+		// of the previous generation before closing its filters on reload.
+		DrainTimeout string `yaml:"drainTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		// Version is the config version of the spec, it's set by the
+		// admin API, and tagged to the requests handled by the spec.
+		Version int64 `yaml:"version,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Flow controls the flow of pipeline.
 	Flow struct {
 		Filter string            `yaml:"filter" jsonschema:"required,format=urlname"`
 		JumpIf map[string]string `yaml:"jumpIf" jsonschema:"omitempty"`
+		// Next is the label of the filter after it if the result is
+		// empty or it's skipped, default is the next one in the flow.
+		// Together with JumpIf, the flow is a directed acyclic graph
+		// whose edges only point to the filters after it.
+		Next string `yaml:"next,omitempty" jsonschema:"omitempty"`
+		// If is a CEL expression, see package celexpr for variables, the
+		// filter is skipped if it's evaluated to false.
+		If string `yaml:"if,omitempty" jsonschema:"omitempty"`
+		// Timeout is the max execution time of the filter, excluding the
+		// filters after it. The request is cancelled and the result is
+		// ResultDeadlineExceeded if it's exceeded.
+		Timeout string `yaml:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
 	}
 
 	// Status contains all status gernerated by runtime, for displaying to users.
 	Status struct {
-		Health string `yaml:"health"`
+		Health  string `yaml:"health"`
+		Version int64  `yaml:"version,omitempty"`
 
-		Filters map[string]interface{} `yaml:"filters"`
+		Filters      map[string]interface{} `yaml:"filters"`
+		DeadLetters  *DeadLetterStatus      `yaml:"deadLetters,omitempty"`
+		Retries      *RetryStatus           `yaml:"retries,omitempty"`
+		HeaderBudget *HeaderBudgetStatus    `yaml:"headerBudget,omitempty"`
+		Journal      *JournalStatus         `yaml:"journal,omitempty"`
+		// Stages are the stats of the filters, keyed by their names.
+		Stages map[string]*StageStatus `yaml:"stages,omitempty"`
+		// Stats are the stats of the requests handled by the pipeline,
+		// excluding the replayed ones.
+		Stats *httpstat.Status `yaml:"stats"`
 	}
 
 	// PipelineContext contains the context of the HTTPPipeline.
@@ -235,7 +298,11 @@ func (s Spec) Validate(config []byte) (err error) {
 	errPrefix := "filters"
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("%s: %s", errPrefix, r)
+			if e, ok := r.(error); ok {
+				err = v.WrapField(errPrefix, e)
+			} else {
+				err = fmt.Errorf("%s: %s", errPrefix, r)
+			}
 		}
 	}()
 
@@ -246,10 +313,14 @@ func (s Spec) Validate(config []byte) (err error) {
 	filterBuffs := convertToFilterBuffs(filtersData)
 
 	filterSpecs := make(map[string]*FilterSpec)
+	var orderedSpecs []*FilterSpec
 	var templateFilterBuffs []context.FilterBuff
 	for _, filterSpec := range s.Filters {
 		spec, err := newFilterSpecInternal(filterSpec)
 		if err != nil {
+			if name, ok := filterSpec["name"].(string); ok && name != "" {
+				err = v.WrapField(name, err)
+			}
 			panic(err)
 		}
 
@@ -257,6 +328,7 @@ func (s Spec) Validate(config []byte) (err error) {
 			panic(fmt.Errorf("conflict name: %s", spec.Name()))
 		}
 		filterSpecs[spec.Name()] = spec
+		orderedSpecs = append(orderedSpecs, spec)
 
 		templateFilterBuffs = append(templateFilterBuffs, context.FilterBuff{
 			Name: spec.Name(),
@@ -286,7 +358,18 @@ func (s Spec) Validate(config []byte) (err error) {
 		if !exists {
 			panic(fmt.Errorf("filter %s not found", f.Filter))
 		}
+		if f.If != "" {
+			if _, err := celexpr.Compile(f.If); err != nil {
+				panic(fmt.Errorf("filter %s: invalid if: %v", f.Filter, err))
+			}
+		}
 		expectedResults := spec.RootFilter().Results()
+		if f.Timeout != "" {
+			expectedResults = append(expectedResults, ResultDeadlineExceeded)
+		}
+		if s.HeaderBudget != nil {
+			expectedResults = append(expectedResults, ResultBudgetExceeded)
+		}
 		for result, label := range f.JumpIf {
 			if !stringtool.StrInSlice(result, expectedResults) {
 				panic(fmt.Errorf("filter %s: result %s is not in %v",
@@ -297,9 +380,98 @@ func (s Spec) Validate(config []byte) (err error) {
 					f.Filter, label))
 			}
 		}
+		if _, exists := labelsValid[f.Next]; f.Next != "" && !exists {
+			panic(fmt.Errorf("filter %s: next label %s not found",
+				f.Filter, f.Next))
+		}
 		labelsValid[f.Filter] = struct{}{}
 	}
 
+	if err := validateReachable(s.Flow); err != nil {
+		panic(err)
+	}
+
+	errPrefix = "values"
+	if len(s.Flow) != 0 {
+		orderedSpecs = orderedSpecs[:0]
+		for _, f := range s.Flow {
+			orderedSpecs = append(orderedSpecs, filterSpecs[f.Filter])
+		}
+	}
+	if err := validateValues(orderedSpecs); err != nil {
+		panic(err)
+	}
+
+	if s.DeadLetter != nil {
+		errPrefix = "deadLetter"
+		for _, result := range s.DeadLetter.Results {
+			found := result == ResultDeadlineExceeded || result == ResultBudgetExceeded
+			for _, spec := range filterSpecs {
+				if stringtool.StrInSlice(result, spec.RootFilter().Results()) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				panic(fmt.Errorf("result %s is not a result of any filter", result))
+			}
+		}
+	}
+
+	if s.Retry != nil {
+		errPrefix = "retry"
+		if s.Retry.From != "" {
+			found := false
+			for _, f := range s.Flow {
+				found = found || f.Filter == s.Retry.From
+			}
+			if _, exists := filterSpecs[s.Retry.From]; len(s.Flow) == 0 && exists {
+				found = true
+			}
+			if !found {
+				panic(fmt.Errorf("filter %s not found in flow", s.Retry.From))
+			}
+		}
+		for _, result := range s.Retry.Results {
+			found := false
+			for _, spec := range filterSpecs {
+				if stringtool.StrInSlice(result, spec.RootFilter().Results()) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				panic(fmt.Errorf("result %s is not a result of any filter", result))
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateReachable validates all filters in the flow are reachable from
+// the first one, since next could skip the filters after it.
+func validateReachable(flow []Flow) error {
+	if len(flow) == 0 {
+		return nil
+	}
+
+	reachable := map[string]struct{}{flow[0].Filter: {}}
+	for i, f := range flow {
+		if _, exists := reachable[f.Filter]; !exists {
+			return fmt.Errorf("filter %s is unreachable", f.Filter)
+		}
+
+		next := f.Next
+		if next == "" && i+1 < len(flow) {
+			next = flow[i+1].Filter
+		}
+		reachable[next] = struct{}{}
+		for _, label := range f.JumpIf {
+			reachable[label] = struct{}{}
+		}
+	}
+
 	return nil
 }
 
@@ -321,6 +493,7 @@ func (hp *HTTPPipeline) DefaultSpec() interface{} {
 // Init initilizes HTTPPipeline.
 func (hp *HTTPPipeline) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
 	hp.superSpec, hp.spec, hp.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	hp.httpStat = httpstat.New()
 	hp.reload(nil /*no previous generation*/)
 }
 
@@ -329,10 +502,13 @@ func (hp *HTTPPipeline) Inherit(superSpec *supervisor.Spec,
 	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
 
 	hp.superSpec, hp.spec, hp.super = superSpec, superSpec.ObjectSpec().(*Spec), super
-	hp.reload(previousGeneration.(*HTTPPipeline))
+	prev := previousGeneration.(*HTTPPipeline)
+	hp.httpStat = prev.httpStat
+	hp.reload(prev)
 
-	// NOTE: It's filters' responsibility to inherit and clean their resources.
-	// previousGeneration.Close()
+	// NOTE: Filters inherit resources from the previous generation, but
+	// it's closed here after draining, instead of by the filters.
+	prev.retire(hp.drainTimeout)
 }
 
 func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
@@ -346,6 +522,7 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 
 			runningFilters = append(runningFilters, &runningFilter{
 				spec: spec,
+				stat: newStageStat(),
 			})
 		}
 	} else {
@@ -365,34 +542,74 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 				panic(fmt.Errorf("flow filter %s not found in filters", f.Filter))
 			}
 
+			var condition *celexpr.Expression
+			if f.If != "" {
+				var err error
+				condition, err = celexpr.Compile(f.If)
+				if err != nil {
+					panic(err)
+				}
+			}
+
+			// NOTE: The format has been validated.
+			timeout, _ := time.ParseDuration(f.Timeout)
+
 			runningFilters = append(runningFilters, &runningFilter{
-				spec:   spec,
-				jumpIf: f.JumpIf,
+				spec:      spec,
+				jumpIf:    f.JumpIf,
+				condition: condition,
+				timeout:   timeout,
+				stat:      newStageStat(),
 			})
 		}
 	}
 
+	for i, runningFilter := range runningFilters {
+		runningFilter.spec.pipeline = hp.superSpec.Name()
+		runningFilter.next = i + 1
+		if len(hp.spec.Flow) != 0 && hp.spec.Flow[i].Next != "" {
+			runningFilter.next = labelIndex(runningFilters, hp.spec.Flow[i].Next)
+		}
+	}
+
 	var filterBuffs []context.FilterBuff
 	for _, runningFilter := range runningFilters {
 		name, kind := runningFilter.spec.Name(), runningFilter.spec.Kind()
-		rootFilter, exists := filterRegistry[kind]
+		rootFilter, exists := getRootFilter(kind)
 		if !exists {
 			panic(fmt.Errorf("kind %s not found", kind))
 		}
 
+		prevRunningFilter := previousGeneration.getRunningFilter(name)
 		var prevInstance Filter
-		if previousGeneration != nil {
-			runningFilter := previousGeneration.getRunningFilter(name)
-			if runningFilter != nil {
-				prevInstance = runningFilter.filter
+		if prevRunningFilter != nil {
+			prevInstance = prevRunningFilter.filter
+		}
+
+		var filter Filter
+		if prevInstance != nil && prevInstance.Kind() == kind {
+			if r, ok := prevInstance.(Reconfigurer); ok {
+				err := r.OnConfigUpdate(runningFilter.spec, hp.super)
+				if err == nil {
+					filter, prevRunningFilter.kept = prevInstance, true
+				} else if err != ErrNotReconfigurable {
+					logger.Warnf("%s: reconfigure filter %s failed, replace it: %v",
+						hp.superSpec.Name(), name, err)
+				}
 			}
 		}
 
-		filter := reflect.New(reflect.TypeOf(rootFilter).Elem()).Interface().(Filter)
-		if prevInstance == nil {
-			filter.Init(runningFilter.spec, hp.super)
-		} else {
-			filter.Inherit(runningFilter.spec, prevInstance, hp.super)
+		if filter == nil && hp.dryRun != nil {
+			filter = hp.dryRun.newFilter(runningFilter.spec, rootFilter)
+		}
+
+		if filter == nil {
+			filter = reflect.New(reflect.TypeOf(rootFilter).Elem()).Interface().(Filter)
+			if prevInstance == nil {
+				filter.Init(runningFilter.spec, hp.super)
+			} else {
+				filter.Inherit(runningFilter.spec, prevInstance, hp.super)
+			}
 		}
 
 		runningFilter.filter, runningFilter.rootFilter = filter, rootFilter
@@ -411,18 +628,65 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 	}
 
 	hp.runningFilters = runningFilters
+
+	hp.deadLetter = nil
+	if hp.spec.DeadLetter != nil {
+		hp.deadLetter = newDeadLetter(hp.spec.DeadLetter, hp.super, hp.superSpec.Name())
+	}
+
+	hp.retry = nil
+	if hp.spec.Retry != nil {
+		hp.retry = newRetryPolicy(hp.spec.Retry, hp.superSpec.Name())
+	}
+
+	hp.budget = nil
+	if hp.spec.HeaderBudget != nil {
+		hp.budget = newHeaderBudget(hp.spec.HeaderBudget)
+	}
+
+	hp.journal = nil
+	if hp.spec.Journal != nil {
+		// NOTE: The journal in the same dir is taken over from the
+		// previous generation, which keeps writing to it while draining.
+		if previousGeneration != nil && previousGeneration.journal != nil &&
+			previousGeneration.journal.dir == hp.spec.Journal.Dir {
+			hp.journal = previousGeneration.journal
+			hp.journal.update(hp.spec.Journal)
+			previousGeneration.journalKept = true
+		} else {
+			hp.journal, err = newJournal(hp.spec.Journal, hp.superSpec.Name())
+			if err != nil {
+				logger.Errorf("%s: open journal failed: %v", hp.superSpec.Name(), err)
+			}
+		}
+	}
+
+	hp.drainTimeout = defaultDrainTimeout
+	if hp.spec.DrainTimeout != "" {
+		// NOTE: The format has been validated.
+		hp.drainTimeout, _ = time.ParseDuration(hp.spec.DrainTimeout)
+	}
+
+	hp.versionTag = ""
+	if hp.spec.Version != 0 {
+		hp.versionTag = fmt.Sprintf("pipeline %s version %d", hp.superSpec.Name(), hp.spec.Version)
+	}
 }
 
 func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
-	// return index + 1 if last filter succeeded
+	// return the next filter if last filter succeeded
 	if result == "" {
-		return index + 1
+		if index == -1 {
+			return 0
+		}
+		return hp.runningFilters[index].next
 	}
 
 	// check the jumpIf table of current filter, return its index if the jump
 	// target is valid and -1 otherwise
 	filter := hp.runningFilters[index]
-	if !stringtool.StrInSlice(result, filter.rootFilter.Results()) {
+	if result != ResultDeadlineExceeded && result != ResultBudgetExceeded &&
+		!stringtool.StrInSlice(result, filter.rootFilter.Results()) {
 		format := "BUG: invalid result %s not in %v"
 		logger.Errorf(format, result, filter.rootFilter.Results())
 	}
@@ -434,12 +698,19 @@ func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
 	if !ok {
 		return -1
 	}
-	if name == LabelEND {
-		return len(hp.runningFilters)
+
+	return labelIndex(hp.runningFilters, name)
+}
+
+// labelIndex returns the index of the filter with the label, or -1 if
+// it's not found. The index of LabelEND is the length of the filters.
+func labelIndex(runningFilters []*runningFilter, label string) int {
+	if label == LabelEND {
+		return len(runningFilters)
 	}
 
-	for index++; index < len(hp.runningFilters); index++ {
-		if hp.runningFilters[index].spec.Name() == name {
+	for index, filter := range runningFilters {
+		if filter.spec.Name() == label {
 			return index
 		}
 	}
@@ -447,58 +718,170 @@ func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
 	return -1
 }
 
+// Handle handles the HTTPContext by the filters.
 func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
+	if hp.journal != nil {
+		hp.journal.append(ctx)
+	}
+	hp.handle(ctx)
+
+	hp.httpStat.Stat(ctx.StatMetric())
+	globalAccessLog.append(newAccessRecord(hp.superSpec.Name(), ctx))
+}
+
+// Replay handles the requests journaled in [from, to) again, the replayed
+// requests are not journaled.
+func (hp *HTTPPipeline) Replay(from, to time.Time) (*ReplayResult, error) {
+	if hp.journal == nil {
+		return nil, fmt.Errorf("journal of %s is not enabled", hp.superSpec.Name())
+	}
+	return hp.journal.replay(from, to, hp.handle)
+}
+
+func (hp *HTTPPipeline) handle(ctx context.HTTPContext) {
+	hp.enter()
+	defer hp.leave()
+
+	// NOTE: The pipeline could be called by filters of another pipeline,
+	// e.g. Bridge and Splitter, so the state of the caller pipeline must
+	// be restored before return.
+	prevPipeCtx, nested := GetPipelineContext(ctx)
+	prevCaller := ctx.HandlerCaller()
+
 	pipeCtx := newAndSetPipelineContext(ctx)
-	defer deletePipelineContext(ctx)
+	defer func() {
+		if nested {
+			runningContexts.Store(ctx, prevPipeCtx)
+			ctx.SetHandlerCaller(prevCaller)
+		} else {
+			deletePipelineContext(ctx)
+		}
+	}()
 	ctx.SetTemplate(hp.ht)
+	if hp.versionTag != "" {
+		ctx.AddTag(hp.versionTag)
+	}
 
 	filterIndex := -1
 	filterStat := &FilterStat{}
+	var filterDeadline *deadline
+	var mark budgetMark
+
+	var dlRecord *deadLetterRecord
+	if hp.deadLetter != nil {
+		dlRecord = hp.deadLetter.capture(ctx)
+	}
 
 	handle := func(lastResult string) string {
 		// Filters are called recursively as a stack, so we need to save current
 		// state and restore it before return
 		lastIndex := filterIndex
 		lastStat := filterStat
+		lastDeadline := filterDeadline
+		if lastDeadline.pause() {
+			// The filter calling the next handler exceeded its deadline,
+			// the result is replaced, so it could be handled by jumpIf.
+			lastResult = deadlineExceeded(ctx, hp.runningFilters[lastIndex].spec.Name())
+		}
+		if hp.budget != nil {
+			var name string
+			if lastIndex >= 0 {
+				name = hp.runningFilters[lastIndex].spec.Name()
+			}
+			var ok bool
+			if mark, ok = hp.budget.check(ctx, name, mark); !ok {
+				if lastIndex == -1 {
+					return budgetExceeded(ctx, "") // exceeded by the client
+				}
+				lastResult = budgetExceeded(ctx, name)
+			}
+		}
 		defer func() {
 			filterIndex = lastIndex
 			filterStat = lastStat
+			filterDeadline = lastDeadline
+			lastDeadline.resume()
 		}()
 
 		filterIndex = hp.getNextFilterIndex(filterIndex, lastResult)
+		for filterIndex >= 0 && filterIndex < len(hp.runningFilters) &&
+			!hp.runningFilters[filterIndex].satisfied(ctx) {
+			filterIndex = hp.runningFilters[filterIndex].next
+		}
 		if filterIndex == len(hp.runningFilters) {
 			return "" // reach the end of pipeline
 		} else if filterIndex == -1 {
 			return lastResult // an error occurs but no filter can handle it
 		}
 
-		filter := hp.runningFilters[filterIndex]
-		name := filter.spec.Name()
+		run := func(filter *runningFilter) string {
+			name := filter.spec.Name()
 
-		if err := ctx.SaveReqToTemplate(name); err != nil {
-			format := "save http req failed, dict is %#v err is %v"
-			logger.Errorf(format, ctx.Template().GetDict(), err)
-		}
+			if err := ctx.SaveReqToTemplate(name); err != nil {
+				format := "save http req failed, dict is %#v err is %v"
+				logger.Errorf(format, ctx.Template().GetDict(), err)
+			}
+
+			filterStat = &FilterStat{Name: name, Kind: filter.spec.Kind()}
+
+			filterDeadline = nil
+			if filter.timeout > 0 {
+				filterDeadline = newDeadline(ctx, name, filter.timeout)
+			}
 
-		filterStat = &FilterStat{Name: name, Kind: filter.spec.Kind()}
+			// NOTE: The filters after it, and the requests sent by it,
+			// e.g. by Proxy, are traced as children of its span.
+			parentSpan := ctx.Span()
+			span := parentSpan.NewChild(name)
+			ctx.SetSpan(span)
 
-		startTime := time.Now()
-		result := filter.filter.Handle(ctx)
+			startTime := time.Now()
+			result := filter.filter.Handle(ctx)
+			if filterDeadline.pause() {
+				result = deadlineExceeded(ctx, name)
+			}
+
+			ctx.SetSpan(parentSpan)
+			if result != "" {
+				span.LogKV("result", result)
+			}
+			span.Finish()
 
-		filterStat.Duration = time.Since(startTime)
-		filterStat.Result = result
+			filterStat.Duration = time.Since(startTime)
+			filterStat.Result = result
+			filter.stat.stat(filterStat.selfDuration(), result)
+
+			if dlRecord != nil {
+				hp.deadLetter.record(dlRecord, name, result)
+			}
 
-		if err := ctx.SaveRspToTemplate(name); err != nil {
-			format := "save http rsp failed, dict is %#v err is %v"
-			logger.Errorf(format, ctx.Template().GetDict(), err)
+			if err := ctx.SaveRspToTemplate(name); err != nil {
+				format := "save http rsp failed, dict is %#v err is %v"
+				logger.Errorf(format, ctx.Template().GetDict(), err)
+			}
+
+			lastStat.Next = append(lastStat.Next, filterStat)
+			return result
 		}
 
-		lastStat.Next = append(lastStat.Next, filterStat)
-		return result
+		filter := hp.runningFilters[filterIndex]
+		if hp.retry != nil && filter.spec.Name() == hp.retry.spec.From {
+			return hp.retry.do(ctx, func() string { return run(filter) })
+		}
+		return run(filter)
 	}
 
 	ctx.SetHandlerCaller(handle)
-	handle("")
+	var result string
+	if hp.retry != nil && hp.retry.spec.From == "" {
+		result = hp.retry.do(ctx, func() string { return handle("") })
+	} else {
+		result = handle("")
+	}
+
+	if dlRecord != nil {
+		hp.deadLetter.handle(ctx, dlRecord, result)
+	}
 
 	if len(filterStat.Next) > 0 {
 		pipeCtx.FilterStats = filterStat.Next[0]
@@ -506,7 +889,32 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 	ctx.AddTag(stringtool.Cat("pipeline: ", pipeCtx.log()))
 }
 
+func deadlineExceeded(ctx context.HTTPContext, name string) string {
+	ctx.Response().SetStatusCode(http.StatusGatewayTimeout)
+	ctx.AddTag(stringtool.Cat("filter ", name, ": deadline exceeded"))
+	return ResultDeadlineExceeded
+}
+
+// satisfied reports whether the condition of the filter is satisfied,
+// errors of the evaluation, e.g. missing keys, are taken as false.
+func (rf *runningFilter) satisfied(ctx context.HTTPContext) bool {
+	if rf.condition == nil {
+		return true
+	}
+
+	result, err := rf.condition.Eval(ctx)
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("filter ", rf.spec.Name(), ": ", err.Error()))
+		return false
+	}
+	return result
+}
+
 func (hp *HTTPPipeline) getRunningFilter(name string) *runningFilter {
+	if hp == nil {
+		return nil
+	}
+
 	for _, filter := range hp.runningFilters {
 		if filter.spec.Name() == name {
 			return filter
@@ -516,14 +924,48 @@ func (hp *HTTPPipeline) getRunningFilter(name string) *runningFilter {
 	return nil
 }
 
+// FilterState returns the live internal state of the filter.
+func (hp *HTTPPipeline) FilterState(name string) (interface{}, error) {
+	rf := hp.getRunningFilter(name)
+	if rf == nil {
+		return nil, ErrFilterNotFound
+	}
+
+	reporter, ok := rf.filter.(StateReporter)
+	if !ok {
+		return nil, ErrNoState
+	}
+	state := reporter.State()
+	if state == nil {
+		return nil, ErrNoState
+	}
+	return state, nil
+}
+
 // Status returns Status genreated by Runtime.
 func (hp *HTTPPipeline) Status() *supervisor.Status {
 	s := &Status{
+		Version: hp.spec.Version,
 		Filters: make(map[string]interface{}),
+		Stages:  make(map[string]*StageStatus),
+		Stats:   hp.httpStat.Status(),
 	}
 
 	for _, runningFilter := range hp.runningFilters {
 		s.Filters[runningFilter.spec.Name()] = runningFilter.filter.Status()
+		s.Stages[runningFilter.spec.Name()] = runningFilter.stat.status()
+	}
+	if hp.deadLetter != nil {
+		s.DeadLetters = hp.deadLetter.status()
+	}
+	if hp.retry != nil {
+		s.Retries = hp.retry.status()
+	}
+	if hp.budget != nil {
+		s.HeaderBudget = hp.budget.status()
+	}
+	if hp.journal != nil {
+		s.Journal = hp.journal.status()
 	}
 
 	return &supervisor.Status{
@@ -533,7 +975,13 @@ func (hp *HTTPPipeline) Status() *supervisor.Status {
 
 // Close closes HTTPPipeline.
 func (hp *HTTPPipeline) Close() {
+	hp.drainFilters()
 	for _, runningFilter := range hp.runningFilters {
-		runningFilter.filter.Close()
+		if !runningFilter.kept {
+			runningFilter.filter.Close()
+		}
+	}
+	if hp.journal != nil && !hp.journalKept {
+		hp.journal.close()
 	}
 }
@@ -0,0 +1,972 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const testFilterKind = "PipelineTestFilter"
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "httppipeline-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "httppipeline-for-log",
+		AbsLogDir: absLogDir,
+	})
+	Register(&testFilter{})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+type (
+	// testFilter appends its name to the X-Trace header of the request,
+	// sleeps until the request is cancelled or for the duration in its
+	// spec, and returns the result in its spec, only for the first
+	// Failures calls if it's not zero.
+	testFilter struct {
+		spec    *testFilterSpec
+		name    string
+		calls   int
+		closed  int32
+		drained int32
+	}
+
+	testFilterSpec struct {
+		Result   string `yaml:"result" jsonschema:"omitempty"`
+		Sleep    string `yaml:"sleep" jsonschema:"omitempty,format=duration"`
+		Failures int    `yaml:"failures" jsonschema:"omitempty"`
+		// Reconfigurable makes the filter updated in place on reload.
+		Reconfigurable bool `yaml:"reconfigurable" jsonschema:"omitempty"`
+		// Always makes the filter predict it always returns Result.
+		Always bool `yaml:"always" jsonschema:"omitempty"`
+
+		Produces map[string]ValueType `yaml:"produces" jsonschema:"omitempty"`
+		Consumes map[string]ValueType `yaml:"consumes" jsonschema:"omitempty"`
+	}
+)
+
+func (f *testFilter) Kind() string             { return testFilterKind }
+func (f *testFilter) DefaultSpec() interface{} { return &testFilterSpec{} }
+func (f *testFilter) Description() string      { return "test filter" }
+func (f *testFilter) Results() []string        { return []string{"failed"} }
+func (f *testFilter) Status() interface{}      { return nil }
+func (f *testFilter) Close()                   { atomic.StoreInt32(&f.closed, 1) }
+func (f *testFilter) Produces(spec *FilterSpec) []*Value {
+	return testValues(spec.FilterSpec().(*testFilterSpec).Produces)
+}
+func (f *testFilter) Consumes(spec *FilterSpec) []*Value {
+	return testValues(spec.FilterSpec().(*testFilterSpec).Consumes)
+}
+func (f *testFilter) AlwaysResult(spec *FilterSpec) (string, bool) {
+	s := spec.FilterSpec().(*testFilterSpec)
+	return s.Result, s.Always
+}
+func testValues(m map[string]ValueType) []*Value {
+	var values []*Value
+	for header, typ := range m {
+		values = append(values, &Value{Header: header, Type: typ})
+	}
+	return values
+}
+func (f *testFilter) Init(spec *FilterSpec, super *supervisor.Supervisor) {
+	f.spec, f.name = spec.FilterSpec().(*testFilterSpec), spec.Name()
+}
+func (f *testFilter) Inherit(spec *FilterSpec, previousGeneration Filter, super *supervisor.Supervisor) {
+	f.Init(spec, super)
+}
+func (f *testFilter) OnConfigUpdate(spec *FilterSpec, super *supervisor.Supervisor) error {
+	if !spec.FilterSpec().(*testFilterSpec).Reconfigurable {
+		return ErrNotReconfigurable
+	}
+	f.Init(spec, super)
+	return nil
+}
+func (f *testFilter) OnDrain() { atomic.StoreInt32(&f.drained, 1) }
+func (f *testFilter) Handle(ctx context.HTTPContext) string {
+	ctx.Request().Header().Add("X-Trace", f.name)
+	if f.spec.Sleep != "" {
+		d, _ := time.ParseDuration(f.spec.Sleep)
+		select {
+		case <-ctx.Done():
+		case <-time.After(d):
+		}
+	}
+	f.calls++
+	if f.spec.Failures > 0 && f.calls > f.spec.Failures {
+		return ctx.CallNextHandler("")
+	}
+	return ctx.CallNextHandler(f.spec.Result)
+}
+
+func newTestPipeline(t *testing.T, yamlConfig string) *HTTPPipeline {
+	spec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	hp := &HTTPPipeline{}
+	hp.Init(spec, nil)
+	t.Cleanup(hp.Close)
+	return hp
+}
+
+func handleTestRequest(hp *HTTPPipeline, header http.Header) string {
+	r := httptest.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	ctx := context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")
+	hp.Handle(ctx)
+	return strings.Join(ctx.Request().Header().GetAll("X-Trace"), ",")
+}
+
+func TestFlowCondition(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: validator
+- filter: cached
+  if: '"x-cached" in request.headers'
+- filter: upstream
+  if: '!("x-cached" in request.headers)'
+- filter: log
+  if: request.headers["x-log"] == "true"
+filters:
+- name: validator
+  kind: PipelineTestFilter
+- name: cached
+  kind: PipelineTestFilter
+- name: upstream
+  kind: PipelineTestFilter
+- name: log
+  kind: PipelineTestFilter
+`)
+
+	if got := handleTestRequest(hp, nil); got != "validator,upstream" {
+		t.Errorf("want validator,upstream, got %s", got)
+	}
+	header := http.Header{"X-Cached": {"1"}, "X-Log": {"true"}}
+	if got := handleTestRequest(hp, header); got != "validator,cached,log" {
+		t.Errorf("want validator,cached,log, got %s", got)
+	}
+}
+
+func TestFlowConditionInvalid(t *testing.T) {
+	_, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: validator
+  if: request.headers["x-log"]
+filters:
+- name: validator
+  kind: PipelineTestFilter
+`)
+	if err == nil {
+		t.Errorf("want error for non-bool condition")
+	}
+}
+
+func TestFlowGraph(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: entry
+  jumpIf: { failed: slow }
+- filter: fast
+  next: merge
+- filter: slow
+- filter: merge
+filters:
+- name: entry
+  kind: PipelineTestFilter
+  result: failed
+  failures: 1
+- name: fast
+  kind: PipelineTestFilter
+- name: slow
+  kind: PipelineTestFilter
+- name: merge
+  kind: PipelineTestFilter
+`)
+
+	if got := handleTestRequest(hp, nil); got != "entry,slow,merge" {
+		t.Errorf("want entry,slow,merge, got %s", got)
+	}
+	if got := handleTestRequest(hp, nil); got != "entry,fast,merge" {
+		t.Errorf("want entry,fast,merge, got %s", got)
+	}
+}
+
+func TestFlowGraphInvalid(t *testing.T) {
+	config := `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: a
+  next: %s
+- filter: b
+- filter: c
+filters:
+- name: a
+  kind: PipelineTestFilter
+- name: b
+  kind: PipelineTestFilter
+- name: c
+  kind: PipelineTestFilter
+`
+
+	for next, want := range map[string]string{
+		"c": "filter b is unreachable",
+		"a": "next label a not found",
+	} {
+		_, err := supervisor.NewSpec(strings.Replace(config, "%s", next, 1))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("want error %s, got %v", want, err)
+		}
+	}
+}
+
+func TestFlowTimeout(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: stuck
+  timeout: 20ms
+  jumpIf: { deadlineExceeded: fallback }
+- filter: upstream
+- filter: fallback
+filters:
+- name: stuck
+  kind: PipelineTestFilter
+  sleep: 10s
+- name: upstream
+  kind: PipelineTestFilter
+- name: fallback
+  kind: PipelineTestFilter
+`)
+
+	start := time.Now()
+	if got := handleTestRequest(hp, nil); got != "stuck,fallback" {
+		t.Errorf("want stuck,fallback, got %s", got)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("stuck filter is not cancelled after %v", d)
+	}
+}
+
+func TestFlowTimeoutExcludesNextFilters(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: outer
+  timeout: 50ms
+  jumpIf: { deadlineExceeded: END }
+- filter: slow
+- filter: last
+filters:
+- name: outer
+  kind: PipelineTestFilter
+- name: slow
+  kind: PipelineTestFilter
+  sleep: 100ms
+- name: last
+  kind: PipelineTestFilter
+`)
+
+	if got := handleTestRequest(hp, nil); got != "outer,slow,last" {
+		t.Errorf("want outer,slow,last, got %s", got)
+	}
+}
+
+func TestRetryFromCheckpoint(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+retry:
+  from: flaky
+  results: [failed]
+  baseInterval: 1ms
+flow:
+- filter: first
+- filter: flaky
+- filter: last
+filters:
+- name: first
+  kind: PipelineTestFilter
+- name: flaky
+  kind: PipelineTestFilter
+  result: failed
+  failures: 2
+- name: last
+  kind: PipelineTestFilter
+`)
+
+	// NOTE: The request is restored before every attempt, so only the
+	// trace of the last attempt is left.
+	if got := handleTestRequest(hp, nil); got != "first,flaky,last" {
+		t.Errorf("want first,flaky,last, got %s", got)
+	}
+	first, flaky := hp.runningFilters[0].filter.(*testFilter), hp.runningFilters[1].filter.(*testFilter)
+	if first.calls != 1 || flaky.calls != 3 {
+		t.Errorf("want 1 call of first and 3 calls of flaky, got %d and %d", first.calls, flaky.calls)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+retry:
+  maxAttempts: 2
+  results: [failed]
+  baseInterval: 1ms
+flow:
+- filter: first
+- filter: flaky
+- filter: last
+filters:
+- name: first
+  kind: PipelineTestFilter
+- name: flaky
+  kind: PipelineTestFilter
+  result: failed
+- name: last
+  kind: PipelineTestFilter
+`)
+
+	if got := handleTestRequest(hp, nil); got != "first,flaky" {
+		t.Errorf("want first,flaky, got %s", got)
+	}
+	if first := hp.runningFilters[0].filter.(*testFilter); first.calls != 2 {
+		t.Errorf("want 2 calls of first, got %d", first.calls)
+	}
+	status := hp.Status().ObjectStatus.(*Status).Retries
+	if status.Retries != 1 || status.Exhausted != 1 {
+		t.Errorf("want 1 retry and 1 exhausted, got %+v", status)
+	}
+}
+
+func TestRetryRestoresRequest(t *testing.T) {
+	p := newRetryPolicy(&RetrySpec{
+		Results:      []string{"failed"},
+		BaseInterval: "1ms",
+		MaxBodySize:  1024,
+	}, "pipeline")
+
+	r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/orders?id=1", strings.NewReader("body"))
+	ctx := context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")
+
+	attempts := 0
+	result := p.do(ctx, func() string {
+		attempts++
+		req, w := ctx.Request(), ctx.Response()
+		body, _ := ioutil.ReadAll(req.Body())
+		if req.Path() != "/orders" || req.Query() != "id=1" || string(body) != "body" ||
+			req.Header().Get("X-Changed") != "" {
+			t.Errorf("attempt %d: request is not restored", attempts)
+		}
+		if w.StatusCode() != http.StatusOK || w.Header().Get("X-Changed") != "" || w.Body() != nil {
+			t.Errorf("attempt %d: response is not reset", attempts)
+		}
+
+		req.SetPath("/changed")
+		req.SetQuery("id=2")
+		req.Header().Set("X-Changed", "true")
+		w.SetStatusCode(http.StatusBadGateway)
+		w.Header().Set("X-Changed", "true")
+		w.SetBody(strings.NewReader("error"))
+		return "failed"
+	})
+
+	if result != "failed" || attempts != 3 {
+		t.Errorf("want 3 failed attempts, got %d %s", attempts, result)
+	}
+}
+
+// brokenReader returns the data, then fails like a client gone away.
+type brokenReader struct{ data io.Reader }
+
+func (r *brokenReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, fmt.Errorf("connection reset")
+	}
+	return n, err
+}
+
+func TestRetrySkipsBody(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		maxBodySize int64
+		body        io.Reader
+		want        string
+		attempts    int
+	}{
+		{"large body", 4, strings.NewReader("large body"), "large body", 1},
+		{"body kept", 16, strings.NewReader("small body"), "small body", 3},
+		{"no body kept", 0, strings.NewReader("body"), "body", 1},
+		{"no body", 0, strings.NewReader(""), "", 3},
+		{"broken body", 16, &brokenReader{strings.NewReader("part")}, "part", 1},
+	} {
+		p := newRetryPolicy(&RetrySpec{
+			Results:      []string{"failed"},
+			BaseInterval: "1ms",
+			MaxBodySize:  c.maxBodySize,
+		}, "pipeline")
+
+		r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/", c.body)
+		ctx := context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")
+
+		attempts := 0
+		p.do(ctx, func() string {
+			attempts++
+			if body, _ := ioutil.ReadAll(ctx.Request().Body()); string(body) != c.want {
+				t.Errorf("%s: want body %q, got %q", c.name, c.want, body)
+			}
+			return "failed"
+		})
+
+		if attempts != c.attempts {
+			t.Errorf("%s: want %d attempts, got %d", c.name, c.attempts, attempts)
+		}
+	}
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	data io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestDeadLetterCapture(t *testing.T) {
+	dl := newDeadLetter(&DeadLetterSpec{Pipeline: "dead-letter", MaxBodySize: 8}, nil, "pipeline")
+
+	// NOTE: Clients can't opt out of dead letters by the header.
+	r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/", nil)
+	r.Header.Set(headerDeadLetterPipeline, "pipeline")
+	if dl.capture(context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")) == nil {
+		t.Errorf("want request with the header captured")
+	}
+	r = r.WithContext(stdcontext.WithValue(r.Context(), deadLetterKey{}, true))
+	if dl.capture(context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")) != nil {
+		t.Errorf("want dead letter not captured")
+	}
+
+	for _, c := range []struct {
+		name      string
+		body      string
+		read      int
+		want      string
+		truncated bool
+	}{
+		{"read by filters", "body", 4, "body", false},
+		{"partly read", "body", 2, "body", false},
+		{"not read", "body", 0, "body", false},
+		{"large body", "large body", 10, "large bo", true},
+		{"large body not read", "large body", 0, "large bo", true},
+	} {
+		body := &countingReader{data: strings.NewReader(c.body)}
+		r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1/", body)
+		ctx := context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")
+
+		record := dl.capture(ctx)
+		if body.read != 0 {
+			t.Errorf("%s: want body not read ahead, got %d bytes read", c.name, body.read)
+		}
+
+		data, _ := ioutil.ReadAll(io.LimitReader(ctx.Request().Body(), int64(c.read)))
+		if string(data) != c.body[:c.read] {
+			t.Errorf("%s: want body %q read by filters, got %q", c.name, c.body[:c.read], data)
+		}
+
+		captured, truncated, err := record.body.captured()
+		if err != nil || string(captured) != c.want || truncated != c.truncated {
+			t.Errorf("%s: want %q truncated %v, got %q truncated %v, %v",
+				c.name, c.want, c.truncated, captured, truncated, err)
+		}
+	}
+}
+
+func TestReloadDrainsPreviousGeneration(t *testing.T) {
+	prev := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: slow
+  kind: PipelineTestFilter
+  sleep: 300ms
+`)
+
+	done := make(chan string)
+	go func() { done <- handleTestRequest(prev, nil) }()
+	time.Sleep(100 * time.Millisecond)
+
+	spec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+drainTimeout: 5s
+filters:
+- name: fast
+  kind: PipelineTestFilter
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	hp := &HTTPPipeline{}
+	hp.Inherit(spec, prev, nil)
+	t.Cleanup(hp.Close)
+
+	slow := prev.runningFilters[0].filter.(*testFilter)
+	if got := handleTestRequest(hp, nil); got != "fast" {
+		t.Errorf("want fast, got %s", got)
+	}
+	if atomic.LoadInt32(&slow.closed) != 0 {
+		t.Errorf("previous generation is closed with a request in flight")
+	}
+
+	if got := <-done; got != "slow" {
+		t.Errorf("want slow, got %s", got)
+	}
+	for start := time.Now(); atomic.LoadInt32(&slow.closed) == 0; {
+		if time.Since(start) > time.Second {
+			t.Fatalf("previous generation is not closed after drained")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHeaderBudget(t *testing.T) {
+	config := `
+name: pipeline
+kind: HTTPPipeline
+headerBudget:
+  maxCount: 3
+  policy: %s
+flow:
+- filter: first
+- filter: second
+  jumpIf: { budgetExceeded: END }
+- filter: third
+filters:
+- name: first
+  kind: PipelineTestFilter
+- name: second
+  kind: PipelineTestFilter
+- name: third
+  kind: PipelineTestFilter
+`
+
+	hp := newTestPipeline(t, strings.Replace(config, "%s", "reject", 1))
+	if got := handleTestRequest(hp, nil); got != "first,second,third" {
+		t.Errorf("want first,second,third, got %s", got)
+	}
+	header := http.Header{"X-Trace": {"client"}}
+	if got := handleTestRequest(hp, header); got != "client,first,second" {
+		t.Errorf("want client,first,second, got %s", got)
+	}
+	status := hp.Status().ObjectStatus.(*Status).HeaderBudget
+	if status.PeakCount != 4 || status.Rejected != 2 || status.Evicted != 0 {
+		t.Errorf("want peak 4, 2 rejected and 0 evicted, got %+v", status)
+	}
+
+	hp = newTestPipeline(t, strings.Replace(config, "%s", "evict", 1))
+	if got := handleTestRequest(hp, nil); got != "first,second" {
+		t.Errorf("want first,second, got %s", got)
+	}
+	header = http.Header{"X-Trace": {"client", "client"}, "X-Other": {"client"}}
+	if got := handleTestRequest(hp, header); got != "client,client" {
+		t.Errorf("want client,client, got %s", got)
+	}
+	status = hp.Status().ObjectStatus.(*Status).HeaderBudget
+	if status.Evicted != 1 || status.Rejected != 1 {
+		t.Errorf("want 1 evicted and 1 rejected, got %+v", status)
+	}
+}
+
+func TestValueTypes(t *testing.T) {
+	config := `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: consumer
+- filter: producer
+- filter: %s
+filters:
+- name: producer
+  kind: PipelineTestFilter
+  produces: { x-groups: list, x-asn: int }
+- name: consumer
+  kind: PipelineTestFilter
+  consumes: { x-groups: string, x-asn: int }
+- name: stringConsumer
+  kind: PipelineTestFilter
+  consumes: { X-Groups: string }
+- name: listConsumer
+  kind: PipelineTestFilter
+  consumes: { x-groups: list, x-asn: string }
+`
+
+	// NOTE: Headers consumed before produced are sent by clients.
+	_, err := supervisor.NewSpec(strings.Replace(config, "%s", "listConsumer", 1))
+	if err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+	_, err = supervisor.NewSpec(strings.Replace(config, "%s", "stringConsumer", 1))
+	if err == nil || !strings.Contains(err.Error(), "filter stringConsumer consumes header X-Groups as string") {
+		t.Errorf("want type mismatch error, got %v", err)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	hp := newTestPipeline(t, fmt.Sprintf(`
+name: pipeline
+kind: HTTPPipeline
+journal:
+  dir: %s
+filters:
+- name: upstream
+  kind: PipelineTestFilter
+`, t.TempDir()))
+
+	start := time.Now()
+	var middle time.Time
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			middle = time.Now()
+		}
+		handleTestRequest(hp, http.Header{"X-Id": {strconv.Itoa(i)}})
+	}
+
+	var ids []string
+	result, err := hp.journal.replay(middle, time.Now(), func(ctx context.HTTPContext) {
+		if ctx.Request().Header().Get(headerJournalReplay) == "" {
+			t.Errorf("want header %s in replayed requests", headerJournalReplay)
+		}
+		ids = append(ids, ctx.Request().Header().Get("X-Id"))
+	})
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if strings.Join(ids, ",") != "2" || result.Replayed != 1 {
+		t.Errorf("want request 2 replayed, got %v", ids)
+	}
+
+	result, err = hp.Replay(start, time.Now())
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if result.Replayed != 3 || result.Codes[http.StatusOK] != 3 {
+		t.Errorf("want 3 requests replayed with 200, got %+v", result)
+	}
+	if s := hp.journal.status(); s.Written != 3 || s.Segments != 1 {
+		t.Errorf("want 3 records in 1 segment, replayed ones excluded, got %+v", s)
+	}
+}
+
+func TestReloadReconfiguresInPlace(t *testing.T) {
+	prev := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: consumer
+  kind: PipelineTestFilter
+  reconfigurable: true
+- name: proxy
+  kind: PipelineTestFilter
+`)
+
+	spec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+drainTimeout: 1s
+filters:
+- name: consumer
+  kind: PipelineTestFilter
+  reconfigurable: true
+  sleep: 1ms
+- name: proxy
+  kind: PipelineTestFilter
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	hp := &HTTPPipeline{}
+	hp.Inherit(spec, prev, nil)
+	t.Cleanup(hp.Close)
+
+	consumer, proxy := prev.runningFilters[0].filter.(*testFilter), prev.runningFilters[1].filter.(*testFilter)
+	if hp.runningFilters[0].filter != consumer || consumer.spec.Sleep != "1ms" {
+		t.Fatalf("want consumer reconfigured in place")
+	}
+	if hp.runningFilters[1].filter == proxy {
+		t.Fatalf("want proxy replaced by a new generation")
+	}
+
+	for start := time.Now(); atomic.LoadInt32(&proxy.closed) == 0; {
+		if time.Since(start) > time.Second {
+			t.Fatalf("previous generation is not closed after drained")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&proxy.drained) == 0 {
+		t.Errorf("want proxy drained before closed")
+	}
+	if atomic.LoadInt32(&consumer.drained) != 0 || atomic.LoadInt32(&consumer.closed) != 0 {
+		t.Errorf("want consumer neither drained nor closed")
+	}
+	if got := handleTestRequest(hp, nil); got != "consumer,proxy" {
+		t.Errorf("want consumer,proxy, got %s", got)
+	}
+}
+
+func TestDrainOnShutdown(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: slow
+  kind: PipelineTestFilter
+  sleep: 300ms
+`)
+
+	done := make(chan string, 1)
+	go func() { done <- handleTestRequest(hp, nil) }()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	hp.Drain(time.Now().Add(5 * time.Second))
+	if time.Since(start) < 150*time.Millisecond {
+		t.Errorf("drained with a request in flight")
+	}
+	if got := <-done; got != "slow" {
+		t.Errorf("want slow, got %s", got)
+	}
+
+	slow := hp.runningFilters[0].filter.(*testFilter)
+	if atomic.LoadInt32(&slow.drained) == 0 {
+		t.Errorf("want slow drained")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	spec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: auth
+  jumpIf: {failed: END}
+- filter: proxy
+- filter: never
+filters:
+- name: auth
+  kind: PipelineTestFilter
+- name: proxy
+  kind: PipelineTestFilter
+- name: never
+  kind: PipelineTestFilter
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	req := &DryRunRequest{URL: "/users?id=1", Header: http.Header{"X-User": {"alice"}}, Body: "hello"}
+	mocks := map[string]*DryRunMock{
+		"proxy": {Result: "failed", StatusCode: http.StatusTeapot, Header: map[string]string{"X-Mock": "1"}, Body: "mocked"},
+	}
+	result, err := DryRun(spec, nil, req, mocks)
+	if err != nil {
+		t.Fatalf("dry-run failed: %v", err)
+	}
+
+	if len(result.Stages) != 2 {
+		t.Fatalf("want 2 stages, got %d", len(result.Stages))
+	}
+	auth, proxy := result.Stages[0], result.Stages[1]
+	if auth.Name != "auth" || auth.Mocked || auth.Effect == nil ||
+		!reflect.DeepEqual(auth.Effect.RequestHeader.Set["X-Trace"], []string{"auth"}) {
+		t.Errorf("unexpected stage auth: %+v", auth)
+	}
+	if proxy.Name != "proxy" || !proxy.Mocked || proxy.Result != "failed" {
+		t.Errorf("unexpected stage proxy: %+v", proxy)
+	}
+	if proxy.Recorded == nil || proxy.Recorded.Body != "hello" ||
+		proxy.Recorded.Header.Get("X-Trace") != "auth" {
+		t.Errorf("unexpected recorded request: %+v", proxy.Recorded)
+	}
+	if proxy.Effect == nil || proxy.Effect.StatusCode != http.StatusTeapot ||
+		!reflect.DeepEqual(proxy.Effect.ResponseHeader.Set["X-Mock"], []string{"1"}) {
+		t.Errorf("unexpected effect of proxy: %+v", proxy.Effect)
+	}
+	if result.Response.StatusCode != http.StatusTeapot || result.Response.Body != "mocked" {
+		t.Errorf("unexpected response: %+v", result.Response)
+	}
+
+	_, err = DryRun(spec, nil, req, map[string]*DryRunMock{"proxy": {Result: "unknown"}})
+	if err == nil {
+		t.Errorf("want error for unknown result")
+	}
+}
+
+func TestAccessRecords(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: access-pipeline
+kind: HTTPPipeline
+filters:
+- name: validator
+  kind: PipelineTestFilter
+`)
+
+	ch, unsubscribe := SubscribeAccessRecords()
+	defer unsubscribe()
+
+	handleTestRequest(hp, http.Header{RequestIDHeader: {"req-1"}})
+	handleTestRequest(hp, http.Header{RequestIDHeader: {"req-2"}})
+
+	if record := <-ch; record.Pipeline != "access-pipeline" || record.RequestID != "req-1" {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	records := RecentAccessRecords(func(r *AccessRecord) bool {
+		return r.Pipeline == "access-pipeline"
+	}, 1)
+	if len(records) != 1 || records[0].RequestID != "req-2" {
+		t.Errorf("unexpected latest records %+v", records)
+	}
+
+	if stats := hp.Status().ObjectStatus.(*Status).Stats; stats.Count != 2 {
+		t.Errorf("want 2 requests in stats, got %d", stats.Count)
+	}
+}
+
+func TestGraphAndStages(t *testing.T) {
+	hp := newTestPipeline(t, `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: validator
+  jumpIf: {failed: END}
+- filter: upstream
+filters:
+- name: validator
+  kind: PipelineTestFilter
+  result: failed
+- name: upstream
+  kind: PipelineTestFilter
+`)
+
+	graph := hp.spec.Graph()
+	if len(graph) != 2 || graph[0].Kind != testFilterKind {
+		t.Fatalf("unexpected graph: %v", graph)
+	}
+	edges := graph[0].Edges
+	if len(edges) != 2 || edges[0].To != "upstream" || edges[1].Result != "failed" || edges[1].To != LabelEND {
+		t.Errorf("unexpected edges of validator: %v", edges)
+	}
+	if edges := graph[1].Edges; len(edges) != 1 || edges[0].To != LabelEND {
+		t.Errorf("unexpected edges of upstream: %v", edges)
+	}
+
+	handleTestRequest(hp, nil)
+	stages := hp.Status().ObjectStatus.(*Status).Stages
+	if stage := stages["validator"]; stage.Count != 1 {
+		t.Errorf("unexpected stage of validator: %+v", stage)
+	}
+	if stage := stages["upstream"]; stage.Count != 0 {
+		t.Errorf("unexpected stage of upstream: %+v", stage)
+	}
+}
+
+func TestLint(t *testing.T) {
+	spec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: mock
+  jumpIf: {failed: log}
+- filter: proxy
+- filter: log
+  if: request.headers["x-log"] == "true"
+  jumpIf: {failed: END}
+- filter: last
+filters:
+- name: mock
+  kind: PipelineTestFilter
+  result: failed
+  always: true
+- name: proxy
+  kind: PipelineTestFilter
+  produces: {X-User: string}
+- name: log
+  kind: PipelineTestFilter
+  result: failed
+  always: true
+- name: last
+  kind: PipelineTestFilter
+- name: unused
+  kind: PipelineTestFilter
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	var got []string
+	for _, w := range spec.ObjectSpec().(*Spec).Lint() {
+		got = append(got, w.Rule+":"+w.Filter)
+	}
+	want := []string{
+		LintUnusedFilter + ":unused",
+		LintUnreachableFilter + ":proxy",
+		LintUnconsumedValue + ":proxy",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
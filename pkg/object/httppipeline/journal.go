@@ -0,0 +1,378 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	defaultJournalMaxSegmentSize = 64 * 1024 * 1024
+	defaultJournalMaxSize        = 1024 * 1024 * 1024
+	defaultJournalMaxBodySize    = 1024 * 1024
+
+	journalSegmentSuffix = ".journal"
+
+	// headerJournalReplay carries the original time of replayed requests.
+	headerJournalReplay = "X-EG-Journal-Replay"
+)
+
+type (
+	// JournalSpec describes the write-ahead journal of HTTPPipeline.
+	JournalSpec struct {
+		Dir            string `yaml:"dir" jsonschema:"required"`
+		MaxSegmentSize int64  `yaml:"maxSegmentSize" jsonschema:"omitempty,minimum=1"`
+		MaxSize        int64  `yaml:"maxSize" jsonschema:"omitempty,minimum=1"`
+		Retention      string `yaml:"retention" jsonschema:"omitempty,format=duration"`
+		MaxBodySize    int64  `yaml:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// JournalStatus is the status of the journal.
+	JournalStatus struct {
+		Segments int    `yaml:"segments"`
+		Size     int64  `yaml:"size"`
+		Written  uint64 `yaml:"written"`
+		Failed   uint64 `yaml:"failed"`
+	}
+
+	// ReplayResult is the result of replaying the journal.
+	ReplayResult struct {
+		Replayed int         `yaml:"replayed"`
+		Broken   int         `yaml:"broken"`
+		Codes    map[int]int `yaml:"codes"`
+	}
+
+	// journal is an append-only log of the requests, split into segments
+	// named by the time of their first records.
+	journal struct {
+		dir       string
+		pipeline  string
+		spec      *JournalSpec
+		retention time.Duration
+
+		mutex    sync.Mutex
+		segments []int64
+		sizes    map[int64]int64
+		size     int64
+		file     *os.File
+		written  uint64
+		failed   uint64
+	}
+
+	// journalRecord is a request in the journal.
+	journalRecord struct {
+		Time       int64               `json:"time"`
+		Method     string              `json:"method"`
+		URL        string              `json:"url"`
+		Host       string              `json:"host"`
+		RemoteAddr string              `json:"remoteAddr"`
+		Header     map[string][]string `json:"header"`
+		Body       []byte              `json:"body"`
+		Truncated  bool                `json:"truncated,omitempty"`
+	}
+)
+
+func newJournal(spec *JournalSpec, pipeline string) (*journal, error) {
+	err := os.MkdirAll(spec.Dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("create dir %s failed: %v", spec.Dir, err)
+	}
+
+	infos, err := ioutil.ReadDir(spec.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %s failed: %v", spec.Dir, err)
+	}
+
+	j := &journal{
+		dir:      spec.Dir,
+		pipeline: pipeline,
+		sizes:    map[int64]int64{},
+	}
+	j.update(spec)
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, journalSegmentSuffix) {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(name, journalSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		j.segments = append(j.segments, start)
+		j.sizes[start] = info.Size()
+		j.size += info.Size()
+	}
+	sort.Slice(j.segments, func(i, k int) bool {
+		return j.segments[i] < j.segments[k]
+	})
+
+	return j, nil
+}
+
+// update updates the limits of the journal, the dir never changes.
+func (j *journal) update(spec *JournalSpec) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.spec = spec
+	j.retention = 0
+	if spec.Retention != "" {
+		// NOTE: The format has been validated.
+		j.retention, _ = time.ParseDuration(spec.Retention)
+	}
+}
+
+func (j *journal) path(start int64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", start, journalSegmentSuffix))
+}
+
+// append writes the request to the journal before it's handled, errors
+// are logged but never stop the request.
+func (j *journal) append(ctx context.HTTPContext) {
+	r := ctx.Request()
+	record := &journalRecord{
+		Time:       time.Now().UnixNano(),
+		Method:     r.Method(),
+		URL:        r.Std().URL.String(),
+		Host:       r.Host(),
+		RemoteAddr: r.Std().RemoteAddr,
+		Header:     r.Header().Std(),
+	}
+
+	if body := r.Body(); body != nil {
+		j.mutex.Lock()
+		maxBodySize := j.spec.MaxBodySize
+		j.mutex.Unlock()
+		if maxBodySize == 0 {
+			maxBodySize = defaultJournalMaxBodySize
+		}
+
+		buff := bytes.NewBuffer(nil)
+		written, err := io.CopyN(buff, body, maxBodySize+1)
+		// NOTE: Keep the original body intact whatever happens.
+		r.SetBody(io.MultiReader(bytes.NewReader(buff.Bytes()), body))
+		if err != nil && err != io.EOF {
+			logger.Warnf("%s: read body for journal failed: %v", j.pipeline, err)
+		}
+
+		record.Body = buff.Bytes()
+		if written > maxBodySize {
+			record.Body, record.Truncated = record.Body[:maxBodySize], true
+		}
+	}
+
+	buff, err := json.Marshal(record)
+	if err != nil {
+		j.mutex.Lock()
+		j.failed++
+		j.mutex.Unlock()
+		logger.Errorf("%s: marshal journal record failed: %v", j.pipeline, err)
+		return
+	}
+	buff = append(buff, '\n')
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	err = j.write(record.Time, buff)
+	if err != nil {
+		j.failed++
+		logger.Errorf("%s: write journal failed: %v", j.pipeline, err)
+		return
+	}
+	j.written++
+}
+
+func (j *journal) write(now int64, buff []byte) error {
+	maxSegmentSize := j.spec.MaxSegmentSize
+	if maxSegmentSize == 0 {
+		maxSegmentSize = defaultJournalMaxSegmentSize
+	}
+
+	if j.file != nil && j.sizes[j.segments[len(j.segments)-1]] >= maxSegmentSize {
+		j.file.Close()
+		j.file = nil
+	}
+
+	if j.file == nil {
+		// NOTE: Records are only appended to the segments opened by the
+		// journal itself, the last one may end with a broken record.
+		file, err := os.OpenFile(j.path(now), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+		if err != nil {
+			return err
+		}
+		j.file = file
+		j.segments = append(j.segments, now)
+		j.sizes[now] = 0
+		j.purge(now)
+	}
+
+	n, err := j.file.Write(buff)
+	j.sizes[j.segments[len(j.segments)-1]] += int64(n)
+	j.size += int64(n)
+
+	return err
+}
+
+// purge removes the oldest segments exceeding the max size or the
+// retention, the segment being written is always kept.
+func (j *journal) purge(now int64) {
+	maxSize := j.spec.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultJournalMaxSize
+	}
+
+	for len(j.segments) > 1 {
+		// NOTE: The records of a segment are all older than the start
+		// of the segment after it.
+		expired := j.retention > 0 && j.segments[1] < now-int64(j.retention)
+		if !expired && j.size <= maxSize {
+			return
+		}
+
+		start := j.segments[0]
+		err := os.Remove(j.path(start))
+		if err != nil && !os.IsNotExist(err) {
+			logger.Errorf("%s: remove journal segment %d failed: %v", j.pipeline, start, err)
+		}
+		j.size -= j.sizes[start]
+		delete(j.sizes, start)
+		j.segments = j.segments[1:]
+	}
+}
+
+// replay sends the requests journaled in [from, to) to the handler in
+// order, and waits for all of them.
+func (j *journal) replay(from, to time.Time, handle func(ctx context.HTTPContext)) (*ReplayResult, error) {
+	j.mutex.Lock()
+	segments := append([]int64(nil), j.segments...)
+	j.mutex.Unlock()
+
+	result := &ReplayResult{Codes: map[int]int{}}
+	for i, start := range segments {
+		if i+1 < len(segments) && segments[i+1] < from.UnixNano() {
+			continue
+		}
+		if start >= to.UnixNano() {
+			break
+		}
+
+		err := j.replaySegment(start, from, to, handle, result)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (j *journal) replaySegment(start int64, from, to time.Time,
+	handle func(ctx context.HTTPContext), result *ReplayResult) error {
+
+	file, err := os.Open(j.path(start))
+	if os.IsNotExist(err) {
+		// NOTE: The segment is purged after listing.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("open journal segment %d failed: %v", start, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// NOTE: The record without the line end is being written,
+			// or broken by a crash.
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read journal segment %d failed: %v", start, err)
+		}
+
+		record := &journalRecord{}
+		err = json.Unmarshal(line, record)
+		if err != nil {
+			result.Broken++
+			continue
+		}
+		if record.Time < from.UnixNano() || record.Time >= to.UnixNano() {
+			continue
+		}
+
+		req, err := http.NewRequest(record.Method, record.URL, bytes.NewReader(record.Body))
+		if err != nil {
+			result.Broken++
+			continue
+		}
+		req.Header = record.Header
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Host = record.Host
+		req.RemoteAddr = record.RemoteAddr
+		req.Header.Set(headerJournalReplay, time.Unix(0, record.Time).Format(time.RFC3339Nano))
+
+		w := httptest.NewRecorder()
+		ctx := context.New(w, req, tracing.NoopTracing, "")
+		handle(ctx)
+		ctx.Finish()
+
+		result.Replayed++
+		result.Codes[w.Code]++
+	}
+}
+
+func (j *journal) status() *JournalStatus {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return &JournalStatus{
+		Segments: len(j.segments),
+		Size:     j.size,
+		Written:  j.written,
+		Failed:   j.failed,
+	}
+}
+
+func (j *journal) close() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
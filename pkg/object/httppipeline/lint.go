@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	// LintUnusedFilter is the rule of filters not in the flow.
+	LintUnusedFilter = "unusedFilter"
+	// LintUnreachableFilter is the rule of filters never reached, because
+	// the filters before them always return other results.
+	LintUnreachableFilter = "unreachableFilter"
+	// LintUnconsumedValue is the rule of values produced by filters but
+	// consumed by none of the filters after them.
+	LintUnconsumedValue = "unconsumedValue"
+)
+
+type (
+	// ResultPredictor is implemented by filters whose results could be
+	// decided by their specs, e.g. a Mock with a rule for all paths, so
+	// the filters only reached by other results are reported by linting.
+	ResultPredictor interface {
+		// AlwaysResult returns the result always returned by the filter
+		// with the spec, ok is false if it's decided per request.
+		AlwaysResult(filterSpec *FilterSpec) (result string, ok bool)
+	}
+
+	// LintWarning is a non-fatal issue of the spec of a pipeline, which
+	// is valid but likely not working as intended.
+	LintWarning struct {
+		Filter  string
+		Rule    string
+		Message string
+	}
+)
+
+// Lint reports the non-fatal issues of the valid spec.
+func (s *Spec) Lint() []*LintWarning {
+	specs := map[string]*FilterSpec{}
+	for _, filter := range s.Filters {
+		// NOTE: The spec has been validated.
+		spec, err := newFilterSpecInternal(filter)
+		if err != nil {
+			continue
+		}
+		specs[spec.Name()] = spec
+	}
+
+	var warnings []*LintWarning
+	inFlow := map[string]struct{}{}
+	for _, f := range s.Flow {
+		inFlow[f.Filter] = struct{}{}
+	}
+	if len(s.Flow) != 0 {
+		for _, filter := range s.Filters {
+			name, _ := filter["name"].(string)
+			if _, exists := inFlow[name]; !exists {
+				warnings = append(warnings, &LintWarning{
+					Filter:  name,
+					Rule:    LintUnusedFilter,
+					Message: fmt.Sprintf("filter %s is not in the flow", name),
+				})
+			}
+		}
+	}
+
+	stages := s.Graph()
+	warnings = append(warnings, lintReachable(stages, specs)...)
+	warnings = append(warnings, lintValues(stages, specs)...)
+
+	return warnings
+}
+
+// lintReachable reports the stages never reached, because the filters
+// before them always return the results not leading to them.
+func lintReachable(stages []*Stage, specs map[string]*FilterSpec) []*LintWarning {
+	if len(stages) == 0 {
+		return nil
+	}
+
+	blocked := map[string]string{}
+	reachable := map[string]struct{}{stages[0].Filter: {}}
+	for _, stage := range stages {
+		if _, exists := reachable[stage.Filter]; !exists {
+			continue
+		}
+
+		result, always := "", false
+		if spec := specs[stage.Filter]; spec != nil {
+			if predictor, ok := spec.RootFilter().(ResultPredictor); ok {
+				result, always = predictor.AlwaysResult(spec)
+			}
+		}
+
+		// NOTE: The result without jumpIf takes the default edge, and so
+		// does the stage skipped by its condition.
+		taken := ""
+		for _, edge := range stage.Edges {
+			if edge.Result == result {
+				taken = result
+			}
+		}
+		for _, edge := range stage.Edges {
+			if !always || edge.Result == taken || (stage.If != "" && edge.Result == "") {
+				reachable[edge.To] = struct{}{}
+			} else if _, exists := blocked[edge.To]; !exists {
+				blocked[edge.To] = fmt.Sprintf("filter %s always returns result %q", stage.Filter, result)
+			}
+		}
+	}
+
+	var warnings []*LintWarning
+	for _, stage := range stages {
+		if _, exists := reachable[stage.Filter]; exists {
+			continue
+		}
+		message := fmt.Sprintf("filter %s is unreachable", stage.Filter)
+		if reason := blocked[stage.Filter]; reason != "" {
+			message += ": " + reason
+		}
+		warnings = append(warnings, &LintWarning{
+			Filter:  stage.Filter,
+			Rule:    LintUnreachableFilter,
+			Message: message,
+		})
+	}
+	return warnings
+}
+
+// lintValues reports the values produced by filters but consumed by none
+// of the filters after them. They may be read by the backends, so it's
+// just a warning.
+func lintValues(stages []*Stage, specs map[string]*FilterSpec) []*LintWarning {
+	var warnings []*LintWarning
+	for i, stage := range stages {
+		spec := specs[stage.Filter]
+		if spec == nil {
+			continue
+		}
+		declarer, ok := spec.RootFilter().(ValueDeclarer)
+		if !ok {
+			continue
+		}
+
+		consumed := map[string]struct{}{}
+		for _, after := range stages[i+1:] {
+			afterSpec := specs[after.Filter]
+			if afterSpec == nil {
+				continue
+			}
+			if d, ok := afterSpec.RootFilter().(ValueDeclarer); ok {
+				for _, v := range d.Consumes(afterSpec) {
+					consumed[http.CanonicalHeaderKey(v.Header)] = struct{}{}
+				}
+			}
+		}
+
+		var headers []string
+		for _, v := range declarer.Produces(spec) {
+			if _, exists := consumed[http.CanonicalHeaderKey(v.Header)]; !exists {
+				headers = append(headers, v.Header)
+			}
+		}
+		sort.Strings(headers)
+		for _, header := range headers {
+			warnings = append(warnings, &LintWarning{
+				Filter:  stage.Filter,
+				Rule:    LintUnconsumedValue,
+				Message: fmt.Sprintf("header %s produced by filter %s is consumed by no filter after it", header, stage.Filter),
+			})
+		}
+	}
+	return warnings
+}
@@ -18,8 +18,10 @@
 package httppipeline
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -46,8 +48,9 @@ type (
 
 		// Inherit also initializes the Filter.
 		// But it needs to handle the lifecycle of the previous generation.
-		// So it's own responsibility for the filter to inherit and clean the previous generation stuff.
-		// The http pipeline won't call Close for the previous generation.
+		// So it's own responsibility for the filter to inherit the previous generation stuff.
+		// The http pipeline calls Close for the previous generation after its requests in flight
+		// complete, so the Filter must not close it in Inherit.
 		Inherit(filterSpec *FilterSpec, previousGeneration Filter, super *supervisor.Supervisor)
 
 		// Handle handles one HTTP request, all possible results
@@ -61,39 +64,91 @@ type (
 		// Close closes itself.
 		Close()
 	}
+
+	// Reconfigurer is implemented by filters updating their config in
+	// place, e.g. to keep long-lived connections or consumers. They are
+	// kept on reload of the pipeline instead of being replaced by a new
+	// generation, so they are neither inherited nor closed.
+	Reconfigurer interface {
+		// OnConfigUpdate updates the config of the running filter, which
+		// may be handling requests concurrently. The filter is replaced
+		// by a new generation as usual if it returns an error, and
+		// ErrNotReconfigurable means it's not supported this time.
+		OnConfigUpdate(filterSpec *FilterSpec, super *supervisor.Supervisor) error
+	}
+
+	// Drainer is implemented by filters which need to stop accepting
+	// work before being closed, e.g. consumers and websocket servers.
+	Drainer interface {
+		// OnDrain is called when the generation of the filter is
+		// retired, or the pipeline is closed, before waiting for its
+		// requests in flight. The filter should stop accepting new work
+		// and finish the work in flight, Close is called after that.
+		OnDrain()
+	}
+
+	// StateReporter is implemented by filters which could report their
+	// live internal state, e.g. the state of circuit breakers. Unlike
+	// Status, which is reported to the cluster periodically, State is
+	// called on demand by the admin API, so it could be more detailed.
+	StateReporter interface {
+		// State returns the state at the moment, it's called while the
+		// filter may be handling requests concurrently. Nil means the
+		// filter has no state to report, e.g. a plugin not reporting it.
+		State() interface{}
+	}
 )
 
 var (
-	filterRegistry = map[string]Filter{}
+	// ErrNotReconfigurable is returned by OnConfigUpdate if the filter
+	// can't update the config in place.
+	ErrNotReconfigurable = errors.New("not reconfigurable")
+
+	// ErrFilterNotFound is returned by FilterState if there's no such
+	// filter in the pipeline.
+	ErrFilterNotFound = errors.New("filter not found")
+
+	// ErrNoState is returned by FilterState if the filter doesn't
+	// implement StateReporter or reports nil.
+	ErrNoState = errors.New("filter doesn't report state")
 )
 
-// Register registers filter.
+var (
+	filterRegistry      = map[string]Filter{}
+	filterRegistryMutex sync.RWMutex
+)
+
+// Register registers filter, it panics if the filter is invalid.
 func Register(f Filter) {
-	if f.Kind() == "" {
-		panic(fmt.Errorf("%T: empty kind", f))
+	err := TryRegister(f)
+	if err != nil {
+		panic(err)
 	}
+}
 
-	existedFilter, existed := filterRegistry[f.Kind()]
-	if existed {
-		panic(fmt.Errorf("%T and %T got same kind: %s", f, existedFilter, f.Kind()))
+// TryRegister registers filter, it returns an error if the filter is
+// invalid. It is used to register filters at runtime, e.g. from plugins.
+func TryRegister(f Filter) error {
+	if f.Kind() == "" {
+		return fmt.Errorf("%T: empty kind", f)
 	}
 
 	// Checking filter type.
 	filterType := reflect.TypeOf(f)
 	if filterType.Kind() != reflect.Ptr {
-		panic(fmt.Errorf("%s: want a pointer, got %s", f.Kind(), filterType.Kind()))
+		return fmt.Errorf("%s: want a pointer, got %s", f.Kind(), filterType.Kind())
 	}
 	if filterType.Elem().Kind() != reflect.Struct {
-		panic(fmt.Errorf("%s elem: want a struct, got %s", f.Kind(), filterType.Kind()))
+		return fmt.Errorf("%s elem: want a struct, got %s", f.Kind(), filterType.Kind())
 	}
 
 	// Checking spec type.
 	specType := reflect.TypeOf(f.DefaultSpec())
 	if specType.Kind() != reflect.Ptr {
-		panic(fmt.Errorf("%s spec: want a pointer, got %s", f.Kind(), specType.Kind()))
+		return fmt.Errorf("%s spec: want a pointer, got %s", f.Kind(), specType.Kind())
 	}
 	if specType.Elem().Kind() != reflect.Struct {
-		panic(fmt.Errorf("%s spec elem: want a struct, got %s", f.Kind(), specType.Elem().Kind()))
+		return fmt.Errorf("%s spec elem: want a struct, got %s", f.Kind(), specType.Elem().Kind())
 	}
 
 	// Checking results.
@@ -101,16 +156,46 @@ func Register(f Filter) {
 	for _, result := range f.Results() {
 		_, exists := results[result]
 		if exists {
-			panic(fmt.Errorf("repeated result: %s", result))
+			return fmt.Errorf("repeated result: %s", result)
 		}
 		results[result] = struct{}{}
 	}
 
+	filterRegistryMutex.Lock()
+	defer filterRegistryMutex.Unlock()
+
+	existedFilter, existed := filterRegistry[f.Kind()]
+	if existed {
+		return fmt.Errorf("%T and %T got same kind: %s", f, existedFilter, f.Kind())
+	}
+
 	filterRegistry[f.Kind()] = f
+
+	return nil
+}
+
+// Unregister unregisters the filter of the kind. Running filters of the
+// kind are not affected, but new ones could not be created any more.
+func Unregister(kind string) {
+	filterRegistryMutex.Lock()
+	defer filterRegistryMutex.Unlock()
+
+	delete(filterRegistry, kind)
+}
+
+func getRootFilter(kind string) (Filter, bool) {
+	filterRegistryMutex.RLock()
+	defer filterRegistryMutex.RUnlock()
+
+	f, exists := filterRegistry[kind]
+	return f, exists
 }
 
 // GetFilterRegistry get the filter registry.
 func GetFilterRegistry() map[string]Filter {
+	filterRegistryMutex.RLock()
+	defer filterRegistryMutex.RUnlock()
+
 	result := map[string]Filter{}
 
 	for kind, f := range filterRegistry {
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	defaultRetryMaxAttempts  = 3
+	defaultRetryBaseInterval = 100 * time.Millisecond
+	defaultRetryMaxInterval  = 10 * time.Second
+)
+
+type (
+	// RetrySpec describes the retry policy of HTTPPipeline.
+	RetrySpec struct {
+		// From is the name of the filter in the flow where the request
+		// is re-executed from, it's the beginning of the flow if empty.
+		From         string   `yaml:"from,omitempty" jsonschema:"omitempty"`
+		MaxAttempts  int      `yaml:"maxAttempts" jsonschema:"omitempty,minimum=1"`
+		Results      []string `yaml:"results" jsonschema:"omitempty,uniqueItems=true"`
+		StatusCodes  []int    `yaml:"statusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		BaseInterval string   `yaml:"baseInterval" jsonschema:"omitempty,format=duration"`
+		MaxInterval  string   `yaml:"maxInterval" jsonschema:"omitempty,format=duration"`
+		// MaxBodySize is the max size of request bodies kept to be sent
+		// again, requests with larger bodies are never retried, so are
+		// the requests with any body if it's 0.
+		MaxBodySize int64 `yaml:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// RetryStatus is the status of retries.
+	RetryStatus struct {
+		Retries   uint64 `yaml:"retries"`
+		Exhausted uint64 `yaml:"exhausted"`
+	}
+
+	retryPolicy struct {
+		spec         *RetrySpec
+		pipeline     string
+		results      map[string]struct{}
+		statusCodes  map[int]struct{}
+		maxAttempts  int
+		baseInterval time.Duration
+		maxInterval  time.Duration
+		maxBodySize  int64
+
+		retries   uint64
+		exhausted uint64
+	}
+)
+
+// Validate validates RetrySpec.
+func (s RetrySpec) Validate() error {
+	if len(s.Results) == 0 && len(s.StatusCodes) == 0 {
+		return fmt.Errorf("both results and statusCodes are empty")
+	}
+
+	return nil
+}
+
+func newRetryPolicy(spec *RetrySpec, pipeline string) *retryPolicy {
+	p := &retryPolicy{
+		spec:         spec,
+		pipeline:     pipeline,
+		results:      map[string]struct{}{},
+		statusCodes:  map[int]struct{}{},
+		maxAttempts:  spec.MaxAttempts,
+		baseInterval: defaultRetryBaseInterval,
+		maxInterval:  defaultRetryMaxInterval,
+		maxBodySize:  spec.MaxBodySize,
+	}
+
+	for _, result := range spec.Results {
+		p.results[result] = struct{}{}
+	}
+	for _, code := range spec.StatusCodes {
+		p.statusCodes[code] = struct{}{}
+	}
+
+	if p.maxAttempts == 0 {
+		p.maxAttempts = defaultRetryMaxAttempts
+	}
+	// NOTE: The format has been validated.
+	if spec.BaseInterval != "" {
+		p.baseInterval, _ = time.ParseDuration(spec.BaseInterval)
+	}
+	if spec.MaxInterval != "" {
+		p.maxInterval, _ = time.ParseDuration(spec.MaxInterval)
+	}
+
+	return p
+}
+
+// do calls fn, which executes the flow from the retry point, and calls it
+// again with the original request on retryable outcomes.
+func (p *retryPolicy) do(ctx context.HTTPContext, fn func() string) string {
+	r := ctx.Request()
+
+	// NOTE: The body is restored as it is if it's not kept, so the flow
+	// reads the same body, or fails with the same error, as no retry.
+	buff := bytes.NewBuffer(nil)
+	written, err := io.CopyN(buff, r.Body(), p.maxBodySize+1)
+	if err != nil && err != io.EOF {
+		r.SetBody(io.MultiReader(buff, r.Body()))
+		ctx.AddTag(fmt.Sprintf("pipeline retry: read body failed, not retried: %v", err))
+		return fn()
+	}
+	if written > p.maxBodySize {
+		r.SetBody(io.MultiReader(buff, r.Body()))
+		ctx.AddTag(fmt.Sprintf("pipeline retry: body exceeds %dB, not retried", p.maxBodySize))
+		return fn()
+	}
+	data := buff.Bytes()
+
+	// NOTE: Filters in the flow change the request and the response, so
+	// they're restored before every attempt.
+	path, query, header := r.Path(), r.Query(), r.Header().Copy()
+	w := ctx.Response()
+	code, respHeader, respBody := w.StatusCode(), w.Header().Copy(), w.Body()
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			r.SetPath(path)
+			r.SetQuery(query)
+			r.Header().Reset(header.Copy().Std())
+
+			if body, ok := w.Body().(io.Closer); ok && w.Body() != respBody {
+				body.Close()
+			}
+			w.SetStatusCode(code)
+			w.Header().Reset(respHeader.Copy().Std())
+			w.SetBody(respBody)
+		}
+		r.SetBody(bytes.NewReader(data))
+
+		result := fn()
+		if !p.retryable(ctx, result) {
+			if attempt > 1 {
+				ctx.AddTag(fmt.Sprintf("pipeline retry: succeeded after %d attempts", attempt))
+			}
+			return result
+		}
+
+		if attempt >= p.maxAttempts {
+			atomic.AddUint64(&p.exhausted, 1)
+			ctx.AddTag(fmt.Sprintf("pipeline retry: failed after %d attempts", attempt))
+			return result
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result
+		case <-timer.C:
+		}
+		atomic.AddUint64(&p.retries, 1)
+	}
+}
+
+func (p *retryPolicy) retryable(ctx context.HTTPContext, result string) bool {
+	if result != "" {
+		if _, exists := p.results[result]; exists {
+			return true
+		}
+	}
+
+	_, exists := p.statusCodes[ctx.Response().StatusCode()]
+	return exists
+}
+
+// backoff returns the interval before the next attempt, it is exponential
+// to the attempts with jitters, and capped by maxInterval.
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	d := p.baseInterval << uint(attempt-1)
+	if d <= 0 || d > p.maxInterval {
+		d = p.maxInterval
+	}
+
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func (p *retryPolicy) status() *RetryStatus {
+	return &RetryStatus{
+		Retries:   atomic.LoadUint64(&p.retries),
+		Exhausted: atomic.LoadUint64(&p.exhausted),
+	}
+}
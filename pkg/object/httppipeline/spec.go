@@ -20,6 +20,7 @@ package httppipeline
 import (
 	"fmt"
 
+	"github.com/megaease/easegress/pkg/featureflag"
 	"github.com/megaease/easegress/pkg/v"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -31,6 +32,7 @@ type (
 		meta       *FilterMetaSpec
 		filterSpec interface{}
 		rootFilter Filter
+		pipeline   string
 	}
 
 	// FilterMetaSpec is metadata for all specs.
@@ -76,7 +78,7 @@ func newFilterSpecInternal(spec map[string]interface{}) (*FilterSpec, error) {
 		return nil, fmt.Errorf("unmarshal failed: %v", err)
 	}
 
-	rootFilter, exists := filterRegistry[meta.Kind]
+	rootFilter, exists := getRootFilter(meta.Kind)
 	if !exists {
 		return nil, fmt.Errorf("kind %s not found", meta.Kind)
 	}
@@ -90,7 +92,7 @@ func newFilterSpecInternal(spec map[string]interface{}) (*FilterSpec, error) {
 
 	vr := v.Validate(s.filterSpec, []byte(yamlConfig))
 	if !vr.Valid() {
-		return nil, fmt.Errorf("%v", vr.Error())
+		return nil, vr
 	}
 
 	return s, nil
@@ -112,6 +114,19 @@ func (s *FilterSpec) FilterSpec() interface{} {
 	return s.filterSpec
 }
 
+// Pipeline returns the name of the pipeline running the filter, it's
+// empty if the filter spec is not created by a pipeline.
+func (s *FilterSpec) Pipeline() string {
+	return s.pipeline
+}
+
+// FlagEnabled reports whether the feature flag of the pipeline is enabled,
+// it's decided at runtime by the flags set by the admin API, so filters
+// should check it for every request instead of caching it.
+func (s *FilterSpec) FlagEnabled(flag string) bool {
+	return featureflag.Enabled(s.pipeline, flag)
+}
+
 // RootFilter returns the root filter of the filter spec.
 func (s *FilterSpec) RootFilter() Filter {
 	return s.rootFilter
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"sync"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+
+	"github.com/megaease/easegress/pkg/util/sampler"
+)
+
+type (
+	// StageStatus is the statistics of a filter in the pipeline, the
+	// durations exclude the filters called after it, in milliseconds.
+	StageStatus struct {
+		Count   uint64            `yaml:"count"`
+		M1      float64           `yaml:"m1"`
+		P50     float64           `yaml:"p50"`
+		P99     float64           `yaml:"p99"`
+		Results map[string]uint64 `yaml:"results,omitempty"`
+	}
+
+	// stageStat is the statistics tool of a filter in the pipeline.
+	stageStat struct {
+		mutex sync.Mutex
+
+		count           uint64
+		rate1           metrics.EWMA
+		durationSampler *sampler.DurationSampler
+		results         map[string]uint64
+	}
+)
+
+func newStageStat() *stageStat {
+	return &stageStat{
+		rate1:           metrics.NewEWMA1(),
+		durationSampler: sampler.NewDurationSampler(),
+		results:         map[string]uint64{},
+	}
+}
+
+func (ss *stageStat) stat(duration time.Duration, result string) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	ss.count++
+	ss.rate1.Update(1)
+	ss.durationSampler.Update(duration)
+	if result != "" {
+		ss.results[result]++
+	}
+}
+
+// status returns the status, it assumes it is called every five seconds
+// like httpstat.HTTPStat.
+func (ss *stageStat) status() *StageStatus {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	ss.rate1.Tick()
+
+	s := &StageStatus{
+		Count: ss.count,
+		M1:    ss.rate1.Rate(),
+		P50:   ss.durationSampler.P50(),
+		P99:   ss.durationSampler.P99(),
+	}
+	if len(ss.results) != 0 {
+		s.Results = make(map[string]uint64, len(ss.results))
+		for result, count := range ss.results {
+			s.Results[result] = count
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	// ValueString is a single value.
+	ValueString ValueType = "string"
+	// ValueInt is a single integer value.
+	ValueInt ValueType = "int"
+	// ValueList is a list of values, in multiple header values or
+	// separated by commas.
+	ValueList ValueType = "list"
+)
+
+type (
+	// ValueType is the type of a value passed between filters in a
+	// request header.
+	ValueType string
+
+	// Value declares a value passed between filters in a request header.
+	Value struct {
+		Header string
+		Type   ValueType
+	}
+
+	// ValueDeclarer is implemented by filters passing values to other
+	// filters in request headers, so type mismatches between them are
+	// detected when validating the spec of the pipeline, instead of
+	// failing per request.
+	ValueDeclarer interface {
+		// Produces returns the values set by the filter with the spec.
+		Produces(filterSpec *FilterSpec) []*Value
+
+		// Consumes returns the values read by the filter with the spec.
+		Consumes(filterSpec *FilterSpec) []*Value
+	}
+
+	producedValue struct {
+		filter string
+		typ    ValueType
+	}
+)
+
+// accepts reports whether a filter consuming a value of the type accepts
+// the value of type v.
+func (t ValueType) accepts(v ValueType) bool {
+	switch t {
+	case ValueList:
+		return true
+	case ValueString:
+		return v != ValueList
+	default:
+		return t == v
+	}
+}
+
+// validateValues checks the values consumed by each filter against the
+// ones produced by the filters before it. Values not produced by any
+// filter are sent by clients, which are not checked.
+func validateValues(specs []*FilterSpec) error {
+	produced := map[string]*producedValue{}
+	for _, spec := range specs {
+		declarer, ok := spec.RootFilter().(ValueDeclarer)
+		if !ok {
+			continue
+		}
+
+		for _, v := range declarer.Consumes(spec) {
+			p, exists := produced[http.CanonicalHeaderKey(v.Header)]
+			if exists && !v.Type.accepts(p.typ) {
+				return fmt.Errorf("filter %s consumes header %s as %s, but filter %s produces %s",
+					spec.Name(), v.Header, v.Type, p.filter, p.typ)
+			}
+		}
+		for _, v := range declarer.Produces(spec) {
+			produced[http.CanonicalHeaderKey(v.Header)] = &producedValue{
+				filter: spec.Name(),
+				typ:    v.Type,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// BackpressureSpec describes the backpressure of HTTPServer. If the
+	// requests in flight reach MaxInFlight, e.g. the upstreams are slow,
+	// new requests are rejected with 429 until they drop to LowWatermark.
+	// With PauseAccept, new connections are not accepted meanwhile, so
+	// clients are slowed down by TCP instead of queueing in memory.
+	BackpressureSpec struct {
+		MaxInFlight  int32  `yaml:"maxInFlight" jsonschema:"required,minimum=1"`
+		LowWatermark int32  `yaml:"lowWatermark" jsonschema:"omitempty,minimum=0"`
+		RetryAfter   string `yaml:"retryAfter" jsonschema:"omitempty,format=duration"`
+		PauseAccept  bool   `yaml:"pauseAccept" jsonschema:"omitempty"`
+	}
+
+	// BackpressureStatus is the status of backpressure.
+	BackpressureStatus struct {
+		InFlight   int32  `yaml:"inFlight"`
+		Overloaded bool   `yaml:"overloaded"`
+		Rejected   uint64 `yaml:"rejected"`
+	}
+
+	// backpressure lives across reloads of the spec, so the requests in
+	// flight are always counted.
+	backpressure struct {
+		spec       atomic.Value // *BackpressureSpec
+		inFlight   int32
+		overloaded int32
+		rejected   uint64
+
+		mutex  sync.Mutex
+		resume chan struct{}
+	}
+)
+
+// Validate validates BackpressureSpec.
+func (s BackpressureSpec) Validate() error {
+	if s.LowWatermark >= s.MaxInFlight {
+		return fmt.Errorf("lowWatermark %d is not less than maxInFlight %d",
+			s.LowWatermark, s.MaxInFlight)
+	}
+
+	return nil
+}
+
+func (s *BackpressureSpec) lowWatermark() int32 {
+	if s.LowWatermark > 0 {
+		return s.LowWatermark
+	}
+	return s.MaxInFlight * 9 / 10
+}
+
+// retryAfter returns the value of the Retry-After header in seconds.
+func (s *BackpressureSpec) retryAfter() string {
+	if s.RetryAfter == "" {
+		return ""
+	}
+	// NOTE: The format has been validated.
+	d, _ := time.ParseDuration(s.RetryAfter)
+	seconds := int((d + time.Second - 1) / time.Second)
+	return strconv.Itoa(seconds)
+}
+
+func newBackpressure() *backpressure {
+	bp := &backpressure{}
+	bp.spec.Store((*BackpressureSpec)(nil))
+	return bp
+}
+
+func (bp *backpressure) reload(spec *BackpressureSpec) {
+	bp.spec.Store(spec)
+	if spec == nil || atomic.LoadInt32(&bp.inFlight) <= spec.lowWatermark() {
+		bp.setOverloaded(false)
+	}
+}
+
+func (bp *backpressure) getSpec() *BackpressureSpec {
+	return bp.spec.Load().(*BackpressureSpec)
+}
+
+// enter counts a request in flight, it returns false if the request
+// should be rejected, which is not counted.
+func (bp *backpressure) enter() bool {
+	n := atomic.AddInt32(&bp.inFlight, 1)
+	spec := bp.getSpec()
+	if spec == nil {
+		return true
+	}
+
+	if n > spec.MaxInFlight || (atomic.LoadInt32(&bp.overloaded) == 1 && n > spec.lowWatermark()) {
+		if atomic.LoadInt32(&bp.overloaded) == 0 {
+			bp.setOverloaded(true)
+		}
+		atomic.AddInt32(&bp.inFlight, -1)
+		atomic.AddUint64(&bp.rejected, 1)
+		return false
+	}
+
+	return true
+}
+
+func (bp *backpressure) leave() {
+	n := atomic.AddInt32(&bp.inFlight, -1)
+	if atomic.LoadInt32(&bp.overloaded) == 0 {
+		return
+	}
+
+	spec := bp.getSpec()
+	if spec == nil || n <= spec.lowWatermark() {
+		bp.setOverloaded(false)
+	}
+}
+
+func (bp *backpressure) setOverloaded(overloaded bool) {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+
+	if overloaded {
+		if bp.resume == nil {
+			bp.resume = make(chan struct{})
+		}
+		atomic.StoreInt32(&bp.overloaded, 1)
+		return
+	}
+
+	if bp.resume != nil {
+		close(bp.resume)
+		bp.resume = nil
+	}
+	atomic.StoreInt32(&bp.overloaded, 0)
+}
+
+// waitAccept blocks accepting new connections while it's overloaded, if
+// PauseAccept is enabled.
+func (bp *backpressure) waitAccept(done <-chan struct{}) {
+	spec := bp.getSpec()
+	if spec == nil || !spec.PauseAccept {
+		return
+	}
+
+	bp.mutex.Lock()
+	resume := bp.resume
+	bp.mutex.Unlock()
+	if resume == nil {
+		return
+	}
+
+	select {
+	case <-resume:
+	case <-done:
+	}
+}
+
+func (bp *backpressure) status() *BackpressureStatus {
+	if bp.getSpec() == nil {
+		return nil
+	}
+
+	return &BackpressureStatus{
+		InFlight:   atomic.LoadInt32(&bp.inFlight),
+		Overloaded: atomic.LoadInt32(&bp.overloaded) == 1,
+		Rejected:   atomic.LoadUint64(&bp.rejected),
+	}
+}
@@ -26,7 +26,7 @@ const (
 	serverShutdownTimeout = 30 * time.Second
 )
 
-func serverShutdownContext() (stdcontext.Context, stdcontext.CancelFunc) {
-	ctx, cancelFunc := stdcontext.WithTimeout(stdcontext.Background(), serverShutdownTimeout)
+func serverShutdownContext(deadline time.Time) (stdcontext.Context, stdcontext.CancelFunc) {
+	ctx, cancelFunc := stdcontext.WithDeadline(stdcontext.Background(), deadline)
 	return ctx, cancelFunc
 }
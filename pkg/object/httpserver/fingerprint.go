@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	stdcontext "context"
+	"net"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/util/tlsfingerprint"
+)
+
+const (
+	// maxClientHelloSize is the max bytes to buffer for a ClientHello,
+	// connections with larger ones are not fingerprinted.
+	maxClientHelloSize = 64 * 1024
+
+	defaultJA3Header = "X-TLS-JA3"
+	defaultJA4Header = "X-TLS-JA4"
+)
+
+type (
+	// fingerprintListener records the ClientHello of TLS connections
+	// to compute their fingerprints.
+	fingerprintListener struct {
+		net.Listener
+
+		// conns are keyed by remote address, because http.Server
+		// only passes the TLS connection wrapping them to ConnContext.
+		conns sync.Map
+	}
+
+	fingerprintConn struct {
+		net.Conn
+		listener *fingerprintListener
+		key      string
+
+		closeOnce sync.Once
+
+		mutex sync.Mutex
+		buff  []byte
+		done  bool
+		ja3   string
+		ja4   string
+	}
+
+	fingerprintKey struct{}
+)
+
+func newFingerprintListener(l net.Listener) *fingerprintListener {
+	return &fingerprintListener{Listener: l}
+}
+
+// Accept accepts one connection.
+func (l *fingerprintListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &fingerprintConn{Conn: c, listener: l, key: c.RemoteAddr().String()}
+	l.conns.Store(fc.key, fc)
+	return fc, nil
+}
+
+// connContext is used as ConnContext of http.Server to attach the
+// fingerprintConn to the context of requests.
+func (l *fingerprintListener) connContext(ctx stdcontext.Context, c net.Conn) stdcontext.Context {
+	fc, ok := l.conns.Load(c.RemoteAddr().String())
+	if !ok {
+		return ctx
+	}
+	return stdcontext.WithValue(ctx, fingerprintKey{}, fc)
+}
+
+func (c *fingerprintConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.record(b[:n])
+	}
+	return n, err
+}
+
+func (c *fingerprintConn) record(b []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.done {
+		return
+	}
+
+	c.buff = append(c.buff, b...)
+	ch, err := tlsfingerprint.Parse(c.buff)
+	if err == tlsfingerprint.ErrIncomplete && len(c.buff) < maxClientHelloSize {
+		return
+	}
+
+	c.done, c.buff = true, nil
+	if err == nil {
+		c.ja3, c.ja4 = ch.JA3(), ch.JA4()
+	}
+}
+
+func (c *fingerprintConn) fingerprints() (ja3, ja4 string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ja3, c.ja4
+}
+
+func (c *fingerprintConn) Close() error {
+	// NOTE: Delete it only once, the address may be reused by a new
+	// connection after it is closed.
+	c.closeOnce.Do(func() { c.listener.conns.Delete(c.key) })
+	return c.Conn.Close()
+}
+
+// fingerprintsFromContext returns fingerprints of the connection of
+// the request.
+func fingerprintsFromContext(ctx stdcontext.Context) (ja3, ja4 string) {
+	fc, ok := ctx.Value(fingerprintKey{}).(*fingerprintConn)
+	if !ok {
+		return "", ""
+	}
+	return fc.fingerprints()
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/supervisor"
 )
 
@@ -37,6 +38,7 @@ const (
 
 func init() {
 	supervisor.Register(&HTTPServer{})
+	secret.RegisterSensitiveFields("keyBase64")
 }
 
 type (
@@ -118,6 +120,12 @@ func (hs *HTTPServer) Status() *supervisor.Status {
 	}
 }
 
+// Drain stops accepting connections and waits for the requests in
+// flight to complete until the deadline.
+func (hs *HTTPServer) Drain(deadline time.Time) {
+	hs.runtime.Drain(deadline)
+}
+
 // Close closes HTTPServer.
 func (hs *HTTPServer) Close() {
 	hs.runtime.Close()
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LimitsSpec describes the limits of requests, requests violating them
+// are rejected before routing. MaxHeaderSize also bounds what the HTTP
+// server reads before parsing the request, see maxHeaderBytes.
+type LimitsSpec struct {
+	// MaxHeaderCount is the max number of header fields, including Host.
+	MaxHeaderCount int `yaml:"maxHeaderCount" jsonschema:"omitempty,minimum=1"`
+	// MaxHeaderSize is the max total size in bytes of header fields.
+	MaxHeaderSize int `yaml:"maxHeaderSize" jsonschema:"omitempty,minimum=1"`
+	// MaxURLLength is the max length of the request URI.
+	MaxURLLength int `yaml:"maxURLLength" jsonschema:"omitempty,minimum=1"`
+	// MaxQueryParams is the max number of query parameters.
+	MaxQueryParams int `yaml:"maxQueryParams" jsonschema:"omitempty,minimum=1"`
+}
+
+// maxHeaderBytes returns the MaxHeaderBytes of the HTTP server, it bounds
+// the request line and the header, so the max URL length is added to the
+// max header size. It returns 0, i.e. http.DefaultMaxHeaderBytes, if the
+// header size is not limited.
+func (l *LimitsSpec) maxHeaderBytes() int {
+	if l == nil || l.MaxHeaderSize <= 0 {
+		return 0
+	}
+	return l.MaxHeaderSize + l.MaxURLLength
+}
+
+// check checks the request, it returns the status code and the reason if
+// the request violates any limit, or zero if it doesn't.
+func (l *LimitsSpec) check(r *http.Request) (int, string) {
+	if l.MaxURLLength > 0 && len(r.RequestURI) > l.MaxURLLength {
+		return http.StatusRequestURITooLong,
+			"url length " + strconv.Itoa(len(r.RequestURI)) + " exceeds limit"
+	}
+
+	if l.MaxQueryParams > 0 {
+		count := 0
+		for _, param := range strings.Split(r.URL.RawQuery, "&") {
+			if param != "" {
+				count++
+			}
+		}
+		if count > l.MaxQueryParams {
+			return http.StatusBadRequest,
+				"query parameter count " + strconv.Itoa(count) + " exceeds limit"
+		}
+	}
+
+	if l.MaxHeaderCount <= 0 && l.MaxHeaderSize <= 0 {
+		return 0, ""
+	}
+
+	// NOTE: Host is removed from the header map by the Go HTTP server,
+	// count it back.
+	count, size := 0, 0
+	if r.Host != "" {
+		count, size = 1, len("Host")+len(r.Host)+4
+	}
+	for key, values := range r.Header {
+		for _, value := range values {
+			count++
+			// 4 is for ": " and CRLF.
+			size += len(key) + len(value) + 4
+		}
+	}
+
+	if l.MaxHeaderCount > 0 && count > l.MaxHeaderCount {
+		return http.StatusRequestHeaderFieldsTooLarge,
+			"header count " + strconv.Itoa(count) + " exceeds limit"
+	}
+	if l.MaxHeaderSize > 0 && size > l.MaxHeaderSize {
+		return http.StatusRequestHeaderFieldsTooLarge,
+			"header size " + strconv.Itoa(size) + " exceeds limit"
+	}
+
+	return 0, ""
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	limits := &LimitsSpec{
+		MaxHeaderCount: 4,
+		MaxHeaderSize:  128,
+		MaxURLLength:   32,
+		MaxQueryParams: 2,
+	}
+
+	for _, c := range []struct {
+		name   string
+		url    string
+		header map[string]string
+		want   int
+	}{
+		{"within limits", "/path?a=1&b=2", map[string]string{"X-A": "a"}, 0},
+		{"url too long", "/" + strings.Repeat("p", 32), nil, http.StatusRequestURITooLong},
+		{"too many query params", "/path?a=1&b=2&c=3", nil, http.StatusBadRequest},
+		{"empty query params ignored", "/path?a=1&&b=2&", nil, 0},
+		{"too many headers", "/", map[string]string{"X-A": "a", "X-B": "b", "X-C": "c", "X-D": "d"}, http.StatusRequestHeaderFieldsTooLarge},
+		{"header too large", "/", map[string]string{"X-A": strings.Repeat("a", 128)}, http.StatusRequestHeaderFieldsTooLarge},
+	} {
+		r := httptest.NewRequest(http.MethodGet, c.url, nil)
+		for k, v := range c.header {
+			r.Header.Set(k, v)
+		}
+		if code, reason := limits.check(r); code != c.want {
+			t.Errorf("%s: want status %d, got %d (%s)", c.name, c.want, code, reason)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/"+strings.Repeat("p", 64)+"?a&b&c", nil)
+	r.Header.Set("X-A", strings.Repeat("a", 256))
+	if code, _ := (&LimitsSpec{}).check(r); code != 0 {
+		t.Errorf("want no limits, got status %d", code)
+	}
+}
+
+func TestLimitsMaxHeaderBytes(t *testing.T) {
+	for _, c := range []struct {
+		limits *LimitsSpec
+		want   int
+	}{
+		{nil, 0},
+		{&LimitsSpec{MaxURLLength: 1024}, 0},
+		{&LimitsSpec{MaxHeaderSize: 4096}, 4096},
+		{&LimitsSpec{MaxHeaderSize: 4096, MaxURLLength: 1024}, 5120},
+	} {
+		if got := c.limits.maxHeaderBytes(); got != c.want {
+			t.Errorf("%+v: want %d, got %d", c.limits, c.want, got)
+		}
+	}
+
+	// The HTTP server rejects large headers before reading all of them.
+	handled := false
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = true
+	}))
+	srv.Config.MaxHeaderBytes = (&LimitsSpec{MaxHeaderSize: 1024}).maxHeaderBytes()
+	srv.Start()
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("X-A", strings.Repeat("a", 64*1024))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge || handled {
+		t.Errorf("want status 431 without handling, got %d", resp.StatusCode)
+	}
+}
@@ -40,6 +40,9 @@ type LimitListener struct {
 	sem       *sem2.Semaphore
 	closeOnce sync.Once     // ensures the done chan is only closed once
 	done      chan struct{} // no values sent; closed when Close is called
+
+	// waitAccept blocks accepting until it's allowed or done is closed.
+	waitAccept func(done <-chan struct{})
 }
 
 // acquire acquires the limiting semaphore. Returns true if successfully
@@ -57,6 +60,9 @@ func (l *LimitListener) release() { l.sem.Release() }
 
 // Accept accepts one connection.
 func (l *LimitListener) Accept() (net.Conn, error) {
+	if l.waitAccept != nil {
+		l.waitAccept(l.done)
+	}
 	acquired := l.acquire()
 	// If the semaphore isn't acquired because the listener was closed, expect
 	// that this call to accept won't block, but immediately return an error.
@@ -41,6 +41,8 @@ type (
 		httpStat *httpstat.HTTPStat
 		topN     *topn.TopN
 
+		backpressure *backpressure
+
 		rules       atomic.Value // *muxRules
 		muxMapper   MuxMapper    // MuxMapper
 		mapperMutex sync.RWMutex
@@ -278,8 +280,9 @@ func (mp *muxPath) matchHeaders(ctx context.HTTPContext) (ci *cacheItem, ok bool
 
 func newMux(httpStat *httpstat.HTTPStat, topN *topn.TopN, mapper MuxMapper) *mux {
 	m := &mux{
-		httpStat: httpStat,
-		topN:     topN,
+		httpStat:     httpStat,
+		topN:         topN,
+		backpressure: newBackpressure(),
 	}
 
 	m.rules.Store(&muxRules{spec: &Spec{}, tracer: tracing.NoopTracing})
@@ -352,6 +355,7 @@ func (m *mux) reloadRules(superSpec *supervisor.Spec, super *supervisor.Supervis
 	}
 
 	m.rules.Store(rules)
+	m.backpressure.reload(spec.Backpressure)
 }
 
 func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
@@ -365,6 +369,24 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		m.topN.Stat(ctx)
 	})
 
+	if !m.backpressure.enter() {
+		m.handleBackpressure(ctx, rules.spec.Backpressure)
+		return
+	}
+	defer m.backpressure.leave()
+
+	if rules.spec.Limits != nil {
+		if code, reason := rules.spec.Limits.check(stdr); code != 0 {
+			ctx.AddTag(reason)
+			ctx.Response().SetStatusCode(code)
+			return
+		}
+	}
+
+	if rules.spec.TLSFingerprint != nil {
+		m.setTLSFingerprints(ctx, rules.spec.TLSFingerprint, stdr)
+	}
+
 	ci := rules.getCacheItem(ctx)
 	if ci != nil {
 		m.handleRequestWithCache(rules, ctx, ci)
@@ -422,6 +444,22 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	m.handleRequestWithCache(rules, ctx, ci)
 }
 
+// handleBackpressure rejects the request, and closes the connection if
+// accepting is paused, so the client has to wait for a new connection.
+func (m *mux) handleBackpressure(ctx context.HTTPContext, spec *BackpressureSpec) {
+	ctx.AddTag("backpressure: too many requests in flight")
+	ctx.Response().SetStatusCode(http.StatusTooManyRequests)
+	if spec == nil {
+		return
+	}
+	if retryAfter := spec.retryAfter(); retryAfter != "" {
+		ctx.Response().Header().Set("Retry-After", retryAfter)
+	}
+	if spec.PauseAccept && ctx.Request().Std().ProtoMajor == 1 {
+		ctx.Response().Header().Set("Connection", "close")
+	}
+}
+
 func (m *mux) handleIPNotAllow(ctx context.HTTPContext) {
 	ctx.AddTag(stringtool.Cat("ip ", ctx.Request().RealIP(), " not allow"))
 	ctx.Response().SetStatusCode(http.StatusForbidden)
@@ -478,6 +516,23 @@ func (m *mux) appendXForwardedFor(ctx context.HTTPContext) {
 	}
 }
 
+func (m *mux) setTLSFingerprints(ctx context.HTTPContext, spec *TLSFingerprintSpec, stdr *http.Request) {
+	h := ctx.Request().Header()
+	ja3Header, ja4Header := spec.ja3Header(), spec.ja4Header()
+
+	// NOTE: Delete them first, so clients can't forge them.
+	h.Del(ja3Header)
+	h.Del(ja4Header)
+
+	ja3, ja4 := fingerprintsFromContext(stdr.Context())
+	if ja3 != "" {
+		h.Set(ja3Header, ja3)
+	}
+	if ja4 != "" {
+		h.Set(ja4Header, ja4)
+	}
+}
+
 func (m *mux) close() {
 	rules := m.rules.Load().(*muxRules)
 	err := rules.tracer.Close()
@@ -18,14 +18,18 @@
 package httpserver
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"sync/atomic"
 	"time"
 
+	"github.com/megaease/easegress/pkg/certstore"
 	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/spiffe"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/topn"
@@ -64,6 +68,10 @@ type (
 		nextSuperSpec *supervisor.Spec
 		super         *supervisor.Supervisor
 	}
+	eventDrain struct {
+		deadline time.Time
+		done     chan struct{}
+	}
 	eventClose struct{ done chan struct{} }
 
 	runtime struct {
@@ -83,6 +91,8 @@ type (
 		httpStat      *httpstat.HTTPStat
 		topN          *topn.TopN
 		limitListener *LimitListener
+
+		spiffeSource atomic.Value // *spiffe.Source
 	}
 
 	// Status contains all status gernerated by runtime, for displaying to users.
@@ -93,7 +103,9 @@ type (
 		Error string    `yaml:"error,omitempty"`
 
 		*httpstat.Status
-		TopN *topn.Status `yaml:"topN"`
+		TopN         *topn.Status        `yaml:"topN"`
+		SPIFFE       *spiffe.Status      `yaml:"spiffe,omitempty"`
+		Backpressure *BackpressureStatus `yaml:"backpressure,omitempty"`
 	}
 )
 
@@ -126,17 +138,36 @@ func (r *runtime) Close() {
 	<-done
 }
 
+// Drain shuts down the server gracefully until the deadline.
+func (r *runtime) Drain(deadline time.Time) {
+	done := make(chan struct{})
+	r.eventChan <- &eventDrain{deadline: deadline, done: done}
+	<-done
+}
+
 // Status returns HTTPServer Status.
 func (r *runtime) Status() *Status {
 	health := r.getError().Error()
 
-	return &Status{
+	s := &Status{
 		Health: health,
 		State:  r.getState(),
 		Error:  r.getError().Error(),
 		Status: r.httpStat.Status(),
 		TopN:   r.topN.Status(),
+
+		Backpressure: r.mux.backpressure.status(),
+	}
+	if source := r.getSPIFFESource(); source != nil {
+		s.SPIFFE = source.Status()
 	}
+
+	return s
+}
+
+func (r *runtime) getSPIFFESource() *spiffe.Source {
+	source, _ := r.spiffeSource.Load().(*spiffe.Source)
+	return source
 }
 
 func (r *runtime) SetMuxMapper(mapper MuxMapper) {
@@ -155,6 +186,8 @@ func (r *runtime) fsm() {
 			r.handleEventServeFailed(e)
 		case *eventReload:
 			r.handleEventReload(e)
+		case *eventDrain:
+			r.handleEventDrain(e)
 		case *eventClose:
 			r.handleEventClose(e)
 			// NOTE: We don't close hs.eventChan,
@@ -241,6 +274,12 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.XForwardedFor, y.XForwardedFor = false, false
 	x.Tracing, y.Tracing = nil, nil
 	x.IPFilter, y.IPFilter = nil, nil
+	// Limits are checked per request, except the max header bytes which
+	// is applied by the HTTP server.
+	if x.Limits.maxHeaderBytes() == y.Limits.maxHeaderBytes() {
+		x.Limits, y.Limits = nil, nil
+	}
+	x.Backpressure, y.Backpressure = nil, nil
 	x.Rules, y.Rules = nil, nil
 
 	// The update of rules need not to shutdown server.
@@ -260,15 +299,30 @@ func (r *runtime) startServer() {
 	}
 
 	srv := &http.Server{
-		Addr:        fmt.Sprintf(":%d", r.spec.Port),
-		Handler:     r.mux,
-		IdleTimeout: keepAliveTimeout,
+		Addr:           fmt.Sprintf(":%d", r.spec.Port),
+		Handler:        r.mux,
+		IdleTimeout:    keepAliveTimeout,
+		MaxHeaderBytes: r.spec.Limits.maxHeaderBytes(),
 	}
 	srv.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
 	if r.spec.HTTPS {
-		tlsConfig, _ := r.spec.tlsConfig()
-		srv.TLSConfig = tlsConfig
+		if r.spec.SPIFFE != nil {
+			source := spiffe.Acquire(r.spec.SPIFFE.WorkloadAPIAddr)
+			r.spiffeSource.Store(source)
+			srv.TLSConfig = spiffe.ServerTLSConfig(source, r.spec.SPIFFE)
+		} else if r.spec.Certificate != "" {
+			srv.TLSConfig = &tls.Config{
+				GetCertificate: certstore.GetCertificate(r.spec.Certificate),
+			}
+		} else if len(r.spec.Certificates) != 0 {
+			srv.TLSConfig = &tls.Config{
+				GetCertificate: certstore.GetCertificates(r.spec.Certificates),
+			}
+		} else {
+			tlsConfig, _ := r.spec.tlsConfig()
+			srv.TLSConfig = tlsConfig
+		}
 	}
 
 	r.server = srv
@@ -291,8 +345,16 @@ func (r *runtime) startServer() {
 		}
 
 		limitListener := NewLimitListener(listener, r.spec.MaxConnections)
+		limitListener.waitAccept = r.mux.backpressure.waitAccept
 		r.limitListener = limitListener
-		go r.runHTTP1And2Server(limitListener, r.spec.HTTPS, r.startNum)
+
+		var l net.Listener = limitListener
+		if r.spec.TLSFingerprint != nil {
+			fl := newFingerprintListener(limitListener)
+			srv.ConnContext = fl.connContext
+			l = fl
+		}
+		go r.runHTTP1And2Server(l, r.spec.HTTPS, r.startNum)
 	}
 }
 
@@ -306,12 +368,12 @@ func (r *runtime) runHTTP3Server(startNum uint64) {
 	}
 }
 
-func (r *runtime) runHTTP1And2Server(limitListener *LimitListener, https bool, startNum uint64) {
+func (r *runtime) runHTTP1And2Server(listener net.Listener, https bool, startNum uint64) {
 	var err error
 	if https {
-		err = r.server.ServeTLS(limitListener, "", "")
+		err = r.server.ServeTLS(listener, "", "")
 	} else {
-		err = r.server.Serve(limitListener)
+		err = r.server.Serve(listener)
 	}
 	if err != http.ErrServerClosed {
 		r.eventChan <- &eventServeFailed{
@@ -322,6 +384,15 @@ func (r *runtime) runHTTP1And2Server(limitListener *LimitListener, https bool, s
 }
 
 func (r *runtime) closeServer() {
+	r.shutdownServer(time.Now().Add(serverShutdownTimeout))
+
+	if source := r.getSPIFFESource(); source != nil {
+		source.Release()
+		r.spiffeSource.Store((*spiffe.Source)(nil))
+	}
+}
+
+func (r *runtime) shutdownServer(deadline time.Time) {
 	if r.server == nil {
 		return
 	}
@@ -334,7 +405,7 @@ func (r *runtime) closeServer() {
 		}
 	} else {
 		// NOTE: It's safe to shutdown serve failed server.
-		ctx, cancelFunc := serverShutdownContext()
+		ctx, cancelFunc := serverShutdownContext(deadline)
 		defer cancelFunc()
 		err := r.server.Shutdown(ctx)
 
@@ -376,6 +447,11 @@ func (r *runtime) handleEventReload(e *eventReload) {
 	r.reload(e.nextSuperSpec, e.super)
 }
 
+func (r *runtime) handleEventDrain(e *eventDrain) {
+	r.shutdownServer(e.deadline)
+	close(e.done)
+}
+
 func (r *runtime) handleEventClose(e *eventClose) {
 	r.closeServer()
 	r.mux.close()
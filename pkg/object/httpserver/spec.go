@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/megaease/easegress/pkg/spiffe"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
 )
@@ -42,10 +43,33 @@ type (
 		XForwardedFor    bool          `yaml:"xForwardedFor" jsonschema:"omitempty"`
 		Tracing          *tracing.Spec `yaml:"tracing" jsonschema:"omitempty"`
 
+		TLSFingerprint *TLSFingerprintSpec `yaml:"tlsFingerprint,omitempty" jsonschema:"omitempty"`
+		Limits         *LimitsSpec         `yaml:"limits,omitempty" jsonschema:"omitempty"`
+		Backpressure   *BackpressureSpec   `yaml:"backpressure,omitempty" jsonschema:"omitempty"`
+
+		// Certificate is the name of the certificate in the certificate
+		// store used instead of certBase64 and keyBase64, so it could be
+		// rotated without restarting the server.
+		Certificate string `yaml:"certificate,omitempty" jsonschema:"omitempty"`
+		// Certificates are the names of certificates in the certificate
+		// store, the one is chosen by the server name of the client.
+		Certificates []string `yaml:"certificates,omitempty" jsonschema:"omitempty"`
+
+		// SPIFFE makes the server use SVIDs instead of certBase64 and
+		// keyBase64, and requires clients to present SVIDs.
+		SPIFFE *spiffe.Spec `yaml:"spiffe,omitempty" jsonschema:"omitempty"`
+
 		IPFilter *ipfilter.Spec `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
 		Rules    []Rule         `yaml:"rules" jsonschema:"omitempty"`
 	}
 
+	// TLSFingerprintSpec describes the TLS fingerprints of clients set to
+	// request headers, the default headers are X-TLS-JA3 and X-TLS-JA4.
+	TLSFingerprintSpec struct {
+		JA3Header string `yaml:"ja3Header" jsonschema:"omitempty"`
+		JA4Header string `yaml:"ja4Header" jsonschema:"omitempty"`
+	}
+
 	// Rule is first level entry of router.
 	Rule struct {
 		// NOTICE: If the field is a pointer, it must have `omitempty` in tag `yaml`
@@ -92,7 +116,27 @@ func (spec *Spec) Validate() error {
 		return fmt.Errorf("https is disabled when http3 enabled")
 	}
 
-	if spec.HTTPS {
+	if spec.SPIFFE != nil && !spec.HTTPS {
+		return fmt.Errorf("https is disabled when spiffe enabled")
+	}
+
+	if spec.Certificate != "" && len(spec.Certificates) != 0 {
+		return fmt.Errorf("both certificate and certificates are specified")
+	}
+
+	if spec.Certificate != "" || len(spec.Certificates) != 0 {
+		if !spec.HTTPS {
+			return fmt.Errorf("https is disabled when certificate specified")
+		}
+		if spec.SPIFFE != nil {
+			return fmt.Errorf("both certificate and spiffe are specified")
+		}
+		if spec.CertBase64 != "" || spec.KeyBase64 != "" {
+			return fmt.Errorf("both certificate and certBase64/keyBase64 are specified")
+		}
+	}
+
+	if spec.HTTPS && spec.SPIFFE == nil && spec.Certificate == "" && len(spec.Certificates) == 0 {
 		if spec.CertBase64 == "" {
 			return fmt.Errorf("certBase64 is empty when https enabled")
 		}
@@ -105,6 +149,15 @@ func (spec *Spec) Validate() error {
 		}
 	}
 
+	if spec.TLSFingerprint != nil {
+		if !spec.HTTPS {
+			return fmt.Errorf("https is disabled when tlsFingerprint enabled")
+		}
+		if spec.HTTP3 {
+			return fmt.Errorf("tlsFingerprint is not supported by http3")
+		}
+	}
+
 	return nil
 }
 
@@ -120,6 +173,20 @@ func (spec Spec) tlsConfig() (*tls.Config, error) {
 	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
 }
 
+func (s *TLSFingerprintSpec) ja3Header() string {
+	if s.JA3Header == "" {
+		return defaultJA3Header
+	}
+	return s.JA3Header
+}
+
+func (s *TLSFingerprintSpec) ja4Header() string {
+	if s.JA4Header == "" {
+		return defaultJA4Header
+	}
+	return s.JA4Header
+}
+
 func (h *Header) initHeaderRoute() {
 	h.headerRE = regexp.MustCompile(h.Regexp)
 }
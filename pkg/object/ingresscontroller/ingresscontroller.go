@@ -0,0 +1,390 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of IngressController.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of IngressController.
+	Kind = "IngressController"
+
+	defaultIngressClass = "easegress"
+
+	// syncDelay is the delay of syncing after resources are changed, to
+	// sync the changes in a short time together.
+	syncDelay = time.Second
+)
+
+func init() {
+	supervisor.Register(&IngressController{})
+}
+
+type (
+	// IngressController is Object IngressController, it translates the
+	// Ingresses and the custom resources of Kubernetes to HTTPServers and
+	// HTTPPipelines, and the TLS secrets to certificates.
+	IngressController struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		client *k8sClient
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		statusMutex sync.Mutex
+		status      *Status
+	}
+
+	// Spec describes the IngressController.
+	Spec struct {
+		// KubeConfig is the path of the kubeconfig file, MasterURL
+		// overrides its server, the config of the pod is used if both
+		// are empty.
+		KubeConfig string `yaml:"kubeConfig" jsonschema:"omitempty"`
+		MasterURL  string `yaml:"masterURL" jsonschema:"omitempty,format=url"`
+		// Namespaces are the namespaces to watch, all if it's empty.
+		Namespaces     []string    `yaml:"namespaces" jsonschema:"omitempty,uniqueItems=true"`
+		IngressClass   string      `yaml:"ingressClass" jsonschema:"omitempty"`
+		HTTPServer     *ServerSpec `yaml:"httpServer" jsonschema:"required"`
+		HTTPSServer    *ServerSpec `yaml:"httpsServer,omitempty" jsonschema:"omitempty"`
+		ResyncInterval string      `yaml:"resyncInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// ServerSpec describes the HTTPServer generated.
+	ServerSpec struct {
+		Port             uint16 `yaml:"port" jsonschema:"required,minimum=1"`
+		KeepAlive        bool   `yaml:"keepAlive" jsonschema:"omitempty"`
+		KeepAliveTimeout string `yaml:"keepAliveTimeout" jsonschema:"omitempty,format=duration"`
+		MaxConnections   uint32 `yaml:"maxConnections" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of IngressController.
+	Status struct {
+		Ingresses    int      `yaml:"ingresses"`
+		Pipelines    int      `yaml:"pipelines"`
+		Certificates int      `yaml:"certificates"`
+		LastSync     string   `yaml:"lastSync,omitempty"`
+		SyncError    string   `yaml:"syncError,omitempty"`
+		Warnings     []string `yaml:"warnings,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.HTTPSServer != nil && spec.HTTPSServer.Port == spec.HTTPServer.Port {
+		return fmt.Errorf("httpServer and httpsServer use the same port %d", spec.HTTPServer.Port)
+	}
+
+	return nil
+}
+
+// Category returns the category of IngressController.
+func (ic *IngressController) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of IngressController.
+func (ic *IngressController) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of IngressController.
+func (ic *IngressController) DefaultSpec() interface{} {
+	return &Spec{
+		IngressClass:   defaultIngressClass,
+		ResyncInterval: "5m",
+	}
+}
+
+// Init initializes IngressController.
+func (ic *IngressController) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	ic.superSpec, ic.spec, ic.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	ic.reload()
+}
+
+// Inherit inherits previous generation of IngressController.
+func (ic *IngressController) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	ic.Init(superSpec, super)
+}
+
+func (ic *IngressController) reload() {
+	ic.status = &Status{}
+	ic.ctx, ic.cancel = context.WithCancel(context.Background())
+
+	client, err := newK8sClient(ic.spec.MasterURL, ic.spec.KubeConfig)
+	if err != nil {
+		logger.Errorf("%s create kubernetes client failed: %v", ic.superSpec.Name(), err)
+		ic.status.SyncError = err.Error()
+		return
+	}
+	ic.client = client
+
+	go ic.run()
+}
+
+// owner returns the owner of the objects and the certificates synced.
+func (ic *IngressController) owner() string {
+	return Kind + "/" + ic.superSpec.Name()
+}
+
+func (ic *IngressController) namespaces() []string {
+	if len(ic.spec.Namespaces) == 0 {
+		return []string{""}
+	}
+	return ic.spec.Namespaces
+}
+
+func (ic *IngressController) run() {
+	// NOTE: The format has been validated.
+	resyncInterval, _ := time.ParseDuration(ic.spec.ResyncInterval)
+	if resyncInterval <= 0 {
+		resyncInterval = 5 * time.Minute
+	}
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	secretQuery := url.Values{"fieldSelector": []string{"type=" + secretTypeTLS}}
+	for _, ns := range ic.namespaces() {
+		go ic.watch(ingressResource.path(ns), nil, resyncInterval, notify)
+		go ic.watch(pipelineResource.path(ns), nil, resyncInterval, notify)
+		go ic.watch(pluginResource.path(ns), nil, resyncInterval, notify)
+		go ic.watch(secretResource.path(ns), secretQuery, resyncInterval, notify)
+	}
+
+	ic.sync()
+	for {
+		select {
+		case <-ic.ctx.Done():
+			return
+		case <-time.After(resyncInterval):
+		case <-changed:
+			select {
+			case <-ic.ctx.Done():
+				return
+			case <-time.After(syncDelay):
+			}
+			select {
+			case <-changed:
+			default:
+			}
+		}
+		ic.sync()
+	}
+}
+
+// watch watches the resources of the path, and calls notify once they
+// are changed.
+func (ic *IngressController) watch(path string, query url.Values,
+	retryInterval time.Duration, notify func()) {
+
+	var resourceVersion string
+	for {
+		var err error
+		resourceVersion, err = ic.client.watch(ic.ctx, path, query, resourceVersion, notify)
+		if ic.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+
+		// NOTE: The custom resource definitions may be not installed, the
+		// resources are synced by resyncing after they are installed.
+		if err != errNotFound {
+			logger.Errorf("%s watch %s failed: %v", ic.superSpec.Name(), path, err)
+		}
+		select {
+		case <-ic.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (ic *IngressController) sync() {
+	tr, err := ic.translate()
+	if err == nil {
+		err = ic.apply(tr)
+	}
+
+	ic.statusMutex.Lock()
+	defer ic.statusMutex.Unlock()
+
+	ic.status.LastSync = time.Now().Format(time.RFC3339)
+	ic.status.SyncError = ""
+	if err != nil {
+		logger.Errorf("%s sync from kubernetes failed: %v", ic.superSpec.Name(), err)
+		ic.status.SyncError = err.Error()
+		return
+	}
+
+	ic.status.Warnings = tr.warnings
+	ic.status.Certificates = len(tr.certificates)
+	ic.status.Pipelines = tr.pipelines
+	for _, w := range tr.warnings {
+		logger.Warnf("%s %s", ic.superSpec.Name(), w)
+	}
+}
+
+// translate gets the resources from Kubernetes and translates them.
+func (ic *IngressController) translate() (*translation, error) {
+	res := &resources{
+		services: map[string]*service{},
+		secrets:  map[string]*secret{},
+	}
+
+	for _, ns := range ic.namespaces() {
+		ingresses := &ingressList{}
+		err := ic.client.get(ic.ctx, ingressResource.path(ns), ingresses)
+		if err != nil {
+			return nil, fmt.Errorf("list ingresses failed: %v", err)
+		}
+		res.ingresses = append(res.ingresses, ingresses.Items...)
+
+		// NOTE: The custom resources are optional.
+		pipelines := &customResourceList{}
+		err = ic.client.get(ic.ctx, pipelineResource.path(ns), pipelines)
+		if err != nil && err != errNotFound {
+			return nil, fmt.Errorf("list pipelines failed: %v", err)
+		}
+		res.pipelines = append(res.pipelines, pipelines.Items...)
+
+		plugins := &customResourceList{}
+		err = ic.client.get(ic.ctx, pluginResource.path(ns), plugins)
+		if err != nil && err != errNotFound {
+			return nil, fmt.Errorf("list plugins failed: %v", err)
+		}
+		res.plugins = append(res.plugins, plugins.Items...)
+	}
+
+	res.ingresses = matchIngresses(res.ingresses, ic.spec.IngressClass)
+
+	for _, key := range referencedSecrets(res.ingresses) {
+		if _, exists := res.secrets[key]; exists {
+			continue
+		}
+		s := &secret{}
+		err := ic.getNamespaced(secretResource, key, s)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get secret %s failed: %v", key, err)
+		}
+		res.secrets[key] = s
+	}
+
+	for _, key := range referencedServices(res.ingresses) {
+		if _, exists := res.services[key]; exists {
+			continue
+		}
+		s := &service{}
+		err := ic.getNamespaced(serviceResource, key, s)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get service %s failed: %v", key, err)
+		}
+		res.services[key] = s
+	}
+
+	ic.statusMutex.Lock()
+	ic.status.Ingresses = len(res.ingresses)
+	ic.statusMutex.Unlock()
+
+	return newTranslator(ic.superSpec.Name(), ic.spec, res).translate(), nil
+}
+
+// getNamespaced gets the resource by namespace/name.
+func (ic *IngressController) getNamespaced(r resource, key string, v interface{}) error {
+	parts := strings.SplitN(key, "/", 2)
+	ns, name := parts[0], parts[1]
+	return ic.client.get(ic.ctx, r.path(ns)+"/"+name, v)
+}
+
+// apply syncs the certificates before the specs, since the HTTPS server
+// references them.
+func (ic *IngressController) apply(tr *translation) error {
+	server := api.GlobalServer
+	if server == nil {
+		return fmt.Errorf("api server is not ready")
+	}
+
+	changed, err := server.SyncCertificates(ic.owner(), tr.certificates)
+	if err != nil {
+		return err
+	}
+	for _, name := range changed {
+		logger.Infof("%s sync certificate %s from kubernetes", ic.superSpec.Name(), name)
+	}
+
+	body, err := tr.specDocs()
+	if err != nil {
+		return err
+	}
+	plan, err := server.SyncSpecs(ic.owner(), body)
+	if err != nil {
+		return err
+	}
+	for _, change := range plan.Changes {
+		logger.Infof("%s %s %s %s from kubernetes", ic.superSpec.Name(), change.Action, change.Kind, change.Name)
+	}
+
+	return nil
+}
+
+// Status returns the status of IngressController.
+func (ic *IngressController) Status() *supervisor.Status {
+	ic.statusMutex.Lock()
+	s := *ic.status
+	ic.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: &s,
+	}
+}
+
+// Close closes IngressController.
+func (ic *IngressController) Close() {
+	ic.cancel()
+}
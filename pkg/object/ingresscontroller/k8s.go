@@ -0,0 +1,385 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	requestTimeout = 30 * time.Second
+	// watchTimeout is the timeout of watch requests sent to the API
+	// server, the watch is resumed from the last resource version.
+	watchTimeout = 5 * time.Minute
+)
+
+var errNotFound = fmt.Errorf("not found")
+
+type (
+	// k8sClient is a minimal client of the Kubernetes API server, it only
+	// gets, lists and watches resources in JSON.
+	k8sClient struct {
+		server     string
+		token      string
+		tokenFile  string
+		httpClient *http.Client
+	}
+
+	// resource is a kind of resources of the Kubernetes API.
+	resource struct {
+		// prefix is the path of the API group and version.
+		prefix string
+		plural string
+	}
+
+	kubeConfig struct {
+		CurrentContext string `yaml:"current-context"`
+		Clusters       []struct {
+			Name    string `yaml:"name"`
+			Cluster struct {
+				Server                   string `yaml:"server"`
+				CertificateAuthority     string `yaml:"certificate-authority"`
+				CertificateAuthorityData string `yaml:"certificate-authority-data"`
+				InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			} `yaml:"cluster"`
+		} `yaml:"clusters"`
+		Users []struct {
+			Name string `yaml:"name"`
+			User struct {
+				Token                 string `yaml:"token"`
+				TokenFile             string `yaml:"tokenFile"`
+				ClientCertificate     string `yaml:"client-certificate"`
+				ClientCertificateData string `yaml:"client-certificate-data"`
+				ClientKey             string `yaml:"client-key"`
+				ClientKeyData         string `yaml:"client-key-data"`
+			} `yaml:"user"`
+		} `yaml:"users"`
+		Contexts []struct {
+			Name    string `yaml:"name"`
+			Context struct {
+				Cluster string `yaml:"cluster"`
+				User    string `yaml:"user"`
+			} `yaml:"context"`
+		} `yaml:"contexts"`
+	}
+
+	watchEvent struct {
+		Type   string          `json:"type"`
+		Object json.RawMessage `json:"object"`
+	}
+
+	statusObject struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+var (
+	ingressResource  = resource{prefix: "/apis/networking.k8s.io/v1", plural: "ingresses"}
+	pipelineResource = resource{prefix: "/apis/easegress.megaease.com/v1", plural: "pipelines"}
+	pluginResource   = resource{prefix: "/apis/easegress.megaease.com/v1", plural: "plugins"}
+	secretResource   = resource{prefix: "/api/v1", plural: "secrets"}
+	serviceResource  = resource{prefix: "/api/v1", plural: "services"}
+)
+
+// path returns the path of the resources in the namespace, all
+// namespaces if it's empty.
+func (r resource) path(namespace string) string {
+	if namespace == "" {
+		return r.prefix + "/" + r.plural
+	}
+	return r.prefix + "/namespaces/" + namespace + "/" + r.plural
+}
+
+// newK8sClient creates the client by the master URL and the kubeconfig,
+// the config of the pod is used if both are empty.
+func newK8sClient(masterURL, kubeConfigFile string) (*k8sClient, error) {
+	c := &k8sClient{}
+	tlsConfig := &tls.Config{}
+
+	switch {
+	case kubeConfigFile != "":
+		err := c.loadKubeConfig(kubeConfigFile, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+	case masterURL == "":
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in kubernetes, kubeConfig or masterURL is required")
+		}
+		c.server = "https://" + net.JoinHostPort(host, port)
+		c.tokenFile = path.Join(serviceAccountDir, "token")
+		pool, err := loadCertPool(path.Join(serviceAccountDir, "ca.crt"), "")
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if masterURL != "" {
+		c.server = masterURL
+	}
+	c.server = strings.TrimSuffix(c.server, "/")
+
+	c.httpClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+
+	return c, nil
+}
+
+func (c *k8sClient) loadKubeConfig(file string, tlsConfig *tls.Config) error {
+	buff, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read %s failed: %v", file, err)
+	}
+
+	config := &kubeConfig{}
+	err = yaml.Unmarshal(buff, config)
+	if err != nil {
+		return fmt.Errorf("unmarshal %s to yaml failed: %v", file, err)
+	}
+
+	var clusterName, userName string
+	for _, kctx := range config.Contexts {
+		if kctx.Name == config.CurrentContext {
+			clusterName, userName = kctx.Context.Cluster, kctx.Context.User
+		}
+	}
+	if clusterName == "" {
+		return fmt.Errorf("context %s not found in %s", config.CurrentContext, file)
+	}
+
+	found := false
+	for _, cluster := range config.Clusters {
+		if cluster.Name != clusterName {
+			continue
+		}
+		found = true
+		c.server = cluster.Cluster.Server
+		tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+		if cluster.Cluster.CertificateAuthority != "" || cluster.Cluster.CertificateAuthorityData != "" {
+			tlsConfig.RootCAs, err = loadCertPool(cluster.Cluster.CertificateAuthority,
+				cluster.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("cluster %s not found in %s", clusterName, file)
+	}
+
+	for _, user := range config.Users {
+		if user.Name != userName {
+			continue
+		}
+		c.token, c.tokenFile = user.User.Token, user.User.TokenFile
+
+		cert, err := loadFileOrData(user.User.ClientCertificate, user.User.ClientCertificateData)
+		if err != nil {
+			return err
+		}
+		key, err := loadFileOrData(user.User.ClientKey, user.User.ClientKeyData)
+		if err != nil {
+			return err
+		}
+		if len(cert) != 0 {
+			keyPair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return fmt.Errorf("load client certificate of %s failed: %v", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{keyPair}
+		}
+	}
+
+	return nil
+}
+
+func loadFileOrData(file, data string) ([]byte, error) {
+	if data != "" {
+		buff, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode base64 data failed: %v", err)
+		}
+		return buff, nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+
+	buff, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %v", file, err)
+	}
+	return buff, nil
+}
+
+func loadCertPool(file, data string) (*x509.CertPool, error) {
+	buff, err := loadFileOrData(file, data)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buff) {
+		return nil, fmt.Errorf("no certificate found in the certificate authority")
+	}
+	return pool, nil
+}
+
+func (c *k8sClient) do(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.server + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	token := c.token
+	if c.tokenFile != "" {
+		// NOTE: The tokens of service accounts are rotated, so read it
+		// every time.
+		buff, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read %s failed: %v", c.tokenFile, err)
+		}
+		token = strings.TrimSpace(string(buff))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return nil, fmt.Errorf("get %s failed: %s: %s", path, resp.Status, body)
+}
+
+// get gets the resource of the path into v, it returns errNotFound if
+// the resource doesn't exist.
+func (c *k8sClient) get(ctx context.Context, path string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	resp, err := c.do(ctx, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("decode %s failed: %v", path, err)
+	}
+	return nil
+}
+
+// watch watches the resources of the path from the resource version,
+// fn is called once any of them is changed. It returns the last resource
+// version received, which is empty if it's too old to resume.
+func (c *k8sClient) watch(ctx context.Context, path string, query url.Values,
+	resourceVersion string, fn func()) (string, error) {
+
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("watch", "true")
+	q.Set("timeoutSeconds", fmt.Sprint(int(watchTimeout.Seconds())))
+	if resourceVersion != "" {
+		q.Set("resourceVersion", resourceVersion)
+	}
+
+	resp, err := c.do(ctx, path, q)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := &watchEvent{}
+		err := decoder.Decode(event)
+		if err == io.EOF {
+			return resourceVersion, nil
+		}
+		if err != nil {
+			return resourceVersion, fmt.Errorf("decode event of %s failed: %v", path, err)
+		}
+
+		if event.Type == "ERROR" {
+			status := &statusObject{}
+			json.Unmarshal(event.Object, status)
+			if status.Code == http.StatusGone {
+				return "", nil
+			}
+			return resourceVersion, fmt.Errorf("watch %s failed: %s", path, status.Message)
+		}
+
+		obj := &struct {
+			Metadata objectMeta `json:"metadata"`
+		}{}
+		err = json.Unmarshal(event.Object, obj)
+		if err != nil {
+			return resourceVersion, fmt.Errorf("decode object of %s failed: %v", path, err)
+		}
+		resourceVersion = obj.Metadata.ResourceVersion
+
+		if event.Type != "BOOKMARK" {
+			fn()
+		}
+	}
+}
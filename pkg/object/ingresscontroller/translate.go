@@ -0,0 +1,697 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/certstore"
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// crdGroup is the API group of the custom resources.
+	crdGroup = "easegress.megaease.com"
+	// crdPipelineKind is the kind of the custom resources of pipelines.
+	crdPipelineKind = "Pipeline"
+
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+	pathTypeExact = "Exact"
+
+	secretTypeTLS = "kubernetes.io/tls"
+
+	// NOTE: Importing the package of HTTPServer brings in QUIC, which
+	// doesn't support all Go versions.
+	httpServerKind = "HTTPServer"
+)
+
+type (
+	objectMeta struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		ResourceVersion string            `json:"resourceVersion"`
+		Annotations     map[string]string `json:"annotations"`
+	}
+
+	ingress struct {
+		Metadata objectMeta  `json:"metadata"`
+		Spec     ingressSpec `json:"spec"`
+	}
+
+	ingressList struct {
+		Items []*ingress `json:"items"`
+	}
+
+	ingressSpec struct {
+		IngressClassName *string         `json:"ingressClassName"`
+		DefaultBackend   *ingressBackend `json:"defaultBackend"`
+		TLS              []*ingressTLS   `json:"tls"`
+		Rules            []*ingressRule  `json:"rules"`
+	}
+
+	ingressTLS struct {
+		Hosts      []string `json:"hosts"`
+		SecretName string   `json:"secretName"`
+	}
+
+	ingressRule struct {
+		Host string `json:"host"`
+		HTTP *struct {
+			Paths []*ingressPath `json:"paths"`
+		} `json:"http"`
+	}
+
+	ingressPath struct {
+		Path     string         `json:"path"`
+		PathType string         `json:"pathType"`
+		Backend  ingressBackend `json:"backend"`
+	}
+
+	ingressBackend struct {
+		Service *struct {
+			Name string `json:"name"`
+			Port struct {
+				Name   string `json:"name"`
+				Number int    `json:"number"`
+			} `json:"port"`
+		} `json:"service"`
+		Resource *struct {
+			APIGroup string `json:"apiGroup"`
+			Kind     string `json:"kind"`
+			Name     string `json:"name"`
+		} `json:"resource"`
+	}
+
+	// customResource is a Pipeline or Plugin, the spec of a Pipeline is
+	// the spec of an HTTPPipeline, and the one of a Plugin is the spec of
+	// a filter.
+	customResource struct {
+		Metadata objectMeta             `json:"metadata"`
+		Spec     map[string]interface{} `json:"spec"`
+	}
+
+	customResourceList struct {
+		Items []*customResource `json:"items"`
+	}
+
+	secret struct {
+		Metadata objectMeta        `json:"metadata"`
+		Type     string            `json:"type"`
+		Data     map[string]string `json:"data"`
+	}
+
+	service struct {
+		Metadata objectMeta `json:"metadata"`
+		Spec     struct {
+			Ports []struct {
+				Name string `json:"name"`
+				Port int    `json:"port"`
+			} `json:"ports"`
+		} `json:"spec"`
+	}
+
+	// resources are the resources of Kubernetes to translate, the
+	// services and secrets are indexed by namespace/name.
+	resources struct {
+		ingresses []*ingress
+		pipelines []*customResource
+		plugins   []*customResource
+		services  map[string]*service
+		secrets   map[string]*secret
+	}
+
+	serverSpec struct {
+		Kind             string      `yaml:"kind"`
+		Name             string      `yaml:"name"`
+		Port             uint16      `yaml:"port"`
+		KeepAlive        bool        `yaml:"keepAlive"`
+		KeepAliveTimeout string      `yaml:"keepAliveTimeout,omitempty"`
+		MaxConnections   uint32      `yaml:"maxConnections,omitempty"`
+		HTTPS            bool        `yaml:"https"`
+		Certificates     []string    `yaml:"certificates,omitempty"`
+		Rules            []*ruleSpec `yaml:"rules"`
+	}
+
+	ruleSpec struct {
+		HostRegexp string      `yaml:"hostRegexp,omitempty"`
+		Paths      []*pathSpec `yaml:"paths"`
+	}
+
+	pathSpec struct {
+		Path       string `yaml:"path,omitempty"`
+		PathPrefix string `yaml:"pathPrefix,omitempty"`
+		Backend    string `yaml:"backend"`
+	}
+
+	// hostRoutes are the routes of a host, the prefixes are trimmed the
+	// trailing slash.
+	hostRoutes struct {
+		host     string
+		exact    []*route
+		prefixes []*route
+	}
+
+	route struct {
+		path    string
+		backend string
+	}
+
+	translator struct {
+		name string
+		spec *Spec
+		res  *resources
+
+		specs        map[string]interface{}
+		routes       map[string]*hostRoutes
+		certificates map[string]*certstore.Certificate
+		warnings     []string
+	}
+
+	// translation is the result of the translation.
+	translation struct {
+		specs        []interface{}
+		pipelines    int
+		certificates []*certstore.Certificate
+		warnings     []string
+	}
+)
+
+// matchIngresses returns the ingresses of the class, the class is
+// specified by the field ingressClassName or the annotation.
+func matchIngresses(ingresses []*ingress, class string) []*ingress {
+	var result []*ingress
+	for _, ing := range ingresses {
+		if ing.Spec.IngressClassName != nil {
+			if *ing.Spec.IngressClassName == class {
+				result = append(result, ing)
+			}
+			continue
+		}
+		if ing.Metadata.Annotations[ingressClassAnnotation] == class {
+			result = append(result, ing)
+		}
+	}
+	return result
+}
+
+// referencedSecrets returns namespace/name of the secrets of TLS.
+func referencedSecrets(ingresses []*ingress) []string {
+	var keys []string
+	for _, ing := range ingresses {
+		for _, t := range ing.Spec.TLS {
+			if t.SecretName != "" {
+				keys = append(keys, ing.Metadata.Namespace+"/"+t.SecretName)
+			}
+		}
+	}
+	return keys
+}
+
+// referencedServices returns namespace/name of the services whose ports
+// are referenced by names.
+func referencedServices(ingresses []*ingress) []string {
+	var keys []string
+	add := func(ns string, b *ingressBackend) {
+		if b != nil && b.Service != nil && b.Service.Port.Name != "" {
+			keys = append(keys, ns+"/"+b.Service.Name)
+		}
+	}
+	for _, ing := range ingresses {
+		ns := ing.Metadata.Namespace
+		add(ns, ing.Spec.DefaultBackend)
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, p := range rule.HTTP.Paths {
+				add(ns, &p.Backend)
+			}
+		}
+	}
+	return keys
+}
+
+func newTranslator(name string, spec *Spec, res *resources) *translator {
+	return &translator{
+		name:         name,
+		spec:         spec,
+		res:          res,
+		specs:        map[string]interface{}{},
+		routes:       map[string]*hostRoutes{},
+		certificates: map[string]*certstore.Certificate{},
+	}
+}
+
+func (t *translator) objectName(namespace, name string) string {
+	return fmt.Sprintf("%s-%s-%s", t.name, namespace, name)
+}
+
+func (t *translator) warnf(format string, args ...interface{}) {
+	t.warnings = append(t.warnings, fmt.Sprintf(format, args...))
+}
+
+// translate translates the resources to the specs of objects and the
+// certificates, the invalid resources are skipped with warnings.
+func (t *translator) translate() *translation {
+	sortByName := func(items []*customResource) {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Metadata.Namespace+"/"+items[i].Metadata.Name <
+				items[j].Metadata.Namespace+"/"+items[j].Metadata.Name
+		})
+	}
+	sortByName(t.res.pipelines)
+
+	for _, cr := range t.res.pipelines {
+		err := t.translatePipeline(cr)
+		if err != nil {
+			t.warnf("pipeline %s/%s: %v", cr.Metadata.Namespace, cr.Metadata.Name, err)
+		}
+	}
+
+	ingresses := append([]*ingress{}, t.res.ingresses...)
+	sort.Slice(ingresses, func(i, j int) bool {
+		return ingresses[i].Metadata.Namespace+"/"+ingresses[i].Metadata.Name <
+			ingresses[j].Metadata.Namespace+"/"+ingresses[j].Metadata.Name
+	})
+
+	var defaultBackend string
+	for _, ing := range ingresses {
+		t.translateIngress(ing)
+
+		if ing.Spec.DefaultBackend == nil {
+			continue
+		}
+		backend, err := t.backend(ing.Metadata.Namespace, ing.Spec.DefaultBackend)
+		if err != nil {
+			t.warnf("ingress %s/%s: default backend: %v", ing.Metadata.Namespace, ing.Metadata.Name, err)
+			continue
+		}
+		if defaultBackend != "" && defaultBackend != backend {
+			t.warnf("ingress %s/%s: default backend conflicts with %s", ing.Metadata.Namespace,
+				ing.Metadata.Name, defaultBackend)
+			continue
+		}
+		defaultBackend = backend
+	}
+
+	rules := t.rules(defaultBackend)
+
+	var certificates []string
+	for name := range t.certificates {
+		certificates = append(certificates, name)
+	}
+	sort.Strings(certificates)
+
+	t.addServer(t.name+"-http", t.spec.HTTPServer, nil, rules)
+	if t.spec.HTTPSServer != nil && len(certificates) != 0 {
+		t.addServer(t.name+"-https", t.spec.HTTPSServer, certificates, rules)
+	}
+
+	result := &translation{warnings: t.warnings}
+	var names []string
+	for name := range t.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := t.specs[name]
+		result.specs = append(result.specs, spec)
+		if _, ok := spec.(*serverSpec); !ok {
+			result.pipelines++
+		}
+	}
+	for _, name := range certificates {
+		result.certificates = append(result.certificates, t.certificates[name])
+	}
+
+	return result
+}
+
+// translatePipeline translates the Pipeline, the filters referenced by
+// the flow but not defined in it are the Plugins in the same namespace.
+func (t *translator) translatePipeline(cr *customResource) error {
+	ns := cr.Metadata.Namespace
+	spec := map[string]interface{}{}
+	for k, v := range cr.Spec {
+		spec[k] = v
+	}
+	name := t.objectName(ns, cr.Metadata.Name)
+	spec["kind"], spec["name"] = httppipeline.Kind, name
+
+	filters, _ := spec["filters"].([]interface{})
+	filters = append([]interface{}{}, filters...)
+	defined := map[string]struct{}{}
+	for _, f := range filters {
+		if m, ok := f.(map[string]interface{}); ok {
+			if n, ok := m["name"].(string); ok {
+				defined[n] = struct{}{}
+			}
+		}
+	}
+
+	flow, _ := spec["flow"].([]interface{})
+	for _, f := range flow {
+		m, _ := f.(map[string]interface{})
+		filter, _ := m["filter"].(string)
+		if _, exists := defined[filter]; exists || filter == "" {
+			continue
+		}
+
+		plugin := t.plugin(ns, filter)
+		if plugin == nil {
+			return fmt.Errorf("filter %s is neither defined nor a plugin", filter)
+		}
+		filterSpec := map[string]interface{}{}
+		for k, v := range plugin.Spec {
+			filterSpec[k] = v
+		}
+		filterSpec["name"] = filter
+		filters = append(filters, filterSpec)
+		defined[filter] = struct{}{}
+	}
+	spec["filters"] = filters
+
+	return t.addSpec(name, spec)
+}
+
+func (t *translator) plugin(namespace, name string) *customResource {
+	for _, cr := range t.res.plugins {
+		if cr.Metadata.Namespace == namespace && cr.Metadata.Name == name {
+			return cr
+		}
+	}
+	return nil
+}
+
+// addSpec adds the spec of the object if it's valid.
+func (t *translator) addSpec(name string, spec interface{}) error {
+	buff, err := yaml.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("marshal %#v to yaml failed: %v", spec, err)
+	}
+	_, err = supervisor.NewSpec(string(buff))
+	if err != nil {
+		return err
+	}
+
+	t.specs[name] = spec
+	return nil
+}
+
+func (t *translator) translateIngress(ing *ingress) {
+	ns, name := ing.Metadata.Namespace, ing.Metadata.Name
+
+	for _, tls := range ing.Spec.TLS {
+		if tls.SecretName == "" {
+			continue
+		}
+		err := t.addCertificate(ns, tls.SecretName)
+		if err != nil {
+			t.warnf("ingress %s/%s: secret %s: %v", ns, name, tls.SecretName, err)
+		}
+	}
+
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		routes := t.routes[rule.Host]
+		if routes == nil {
+			routes = &hostRoutes{host: rule.Host}
+			t.routes[rule.Host] = routes
+		}
+
+		for _, p := range rule.HTTP.Paths {
+			backend, err := t.backend(ns, &p.Backend)
+			if err != nil {
+				t.warnf("ingress %s/%s: path %s: %v", ns, name, p.Path, err)
+				continue
+			}
+
+			path := p.Path
+			if path == "" {
+				path = "/"
+			}
+
+			err = routes.add(path, p.PathType == pathTypeExact, backend)
+			if err != nil {
+				t.warnf("ingress %s/%s: %v", ns, name, err)
+			}
+		}
+	}
+}
+
+func (hr *hostRoutes) add(path string, exact bool, backend string) error {
+	routes := &hr.prefixes
+	if exact {
+		routes = &hr.exact
+	} else {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	for _, r := range *routes {
+		if r.path == path {
+			if r.backend == backend {
+				return nil
+			}
+			return fmt.Errorf("path %s of host %q conflicts with backend %s", path, hr.host, r.backend)
+		}
+	}
+	*routes = append(*routes, &route{path: path, backend: backend})
+	return nil
+}
+
+// backend returns the name of the pipeline of the backend, the pipeline
+// of a service is generated.
+func (t *translator) backend(namespace string, b *ingressBackend) (string, error) {
+	if b.Resource != nil {
+		if b.Resource.APIGroup != crdGroup || b.Resource.Kind != crdPipelineKind {
+			return "", fmt.Errorf("unsupported resource %s/%s", b.Resource.APIGroup, b.Resource.Kind)
+		}
+		name := t.objectName(namespace, b.Resource.Name)
+		if _, exists := t.specs[name]; !exists {
+			return "", fmt.Errorf("pipeline %s not found or invalid", b.Resource.Name)
+		}
+		return name, nil
+	}
+
+	if b.Service == nil {
+		return "", fmt.Errorf("neither service nor resource specified")
+	}
+
+	port := b.Service.Port.Number
+	if b.Service.Port.Name != "" {
+		svc := t.res.services[namespace+"/"+b.Service.Name]
+		if svc == nil {
+			return "", fmt.Errorf("service %s not found", b.Service.Name)
+		}
+		for _, p := range svc.Spec.Ports {
+			if p.Name == b.Service.Port.Name {
+				port = p.Port
+			}
+		}
+		if port == 0 {
+			return "", fmt.Errorf("port %s of service %s not found", b.Service.Port.Name, b.Service.Name)
+		}
+	}
+	if port == 0 {
+		return "", fmt.Errorf("port of service %s not specified", b.Service.Name)
+	}
+
+	name := t.objectName(namespace, fmt.Sprintf("%s-%d", b.Service.Name, port))
+	if _, exists := t.specs[name]; exists {
+		return name, nil
+	}
+
+	// NOTE: The DNS name of the service is used, so the traffic is
+	// balanced to the endpoints by Kubernetes.
+	spec := map[string]interface{}{
+		"kind": httppipeline.Kind,
+		"name": name,
+		"flow": []map[string]interface{}{{"filter": "proxy"}},
+		"filters": []map[string]interface{}{{
+			"kind": proxy.Kind,
+			"name": "proxy",
+			"mainPool": map[string]interface{}{
+				"servers": []map[string]interface{}{{
+					"url": fmt.Sprintf("http://%s.%s.svc:%d", b.Service.Name, namespace, port),
+				}},
+				"loadBalance": map[string]interface{}{"policy": proxy.PolicyRoundRobin},
+			},
+		}},
+	}
+	err := t.addSpec(name, spec)
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func (t *translator) addCertificate(namespace, secretName string) error {
+	name := t.objectName(namespace, secretName)
+	if _, exists := t.certificates[name]; exists {
+		return nil
+	}
+
+	s := t.res.secrets[namespace+"/"+secretName]
+	if s == nil {
+		return fmt.Errorf("not found")
+	}
+	if s.Type != secretTypeTLS {
+		return fmt.Errorf("type is %s, not %s", s.Type, secretTypeTLS)
+	}
+
+	// NOTE: The data of secrets are encoded in base64 already.
+	buff, err := yaml.Marshal(&certstore.Certificate{
+		Name:       name,
+		CertBase64: s.Data["tls.crt"],
+		KeyBase64:  s.Data["tls.key"],
+	})
+	if err != nil {
+		return err
+	}
+	c, err := certstore.NewCertificate(buff)
+	if err != nil {
+		return err
+	}
+
+	t.certificates[name] = c
+	return nil
+}
+
+// rules returns the rules of servers, the exact hosts precede the
+// wildcard ones, and the exact paths precede the longer prefixes, which
+// precede the shorter ones. The default backend is the last.
+func (t *translator) rules(defaultBackend string) []*ruleSpec {
+	var hosts []*hostRoutes
+	for _, routes := range t.routes {
+		hosts = append(hosts, routes)
+	}
+	if defaultBackend != "" {
+		routes := t.routes[""]
+		if routes == nil {
+			routes = &hostRoutes{}
+			hosts = append(hosts, routes)
+		}
+		// NOTE: The error means the rules have the prefix /, which take
+		// precedence over the default backend.
+		routes.add("/", false, defaultBackend)
+	}
+
+	hostOrder := func(host string) int {
+		switch {
+		case host == "":
+			return 2
+		case strings.HasPrefix(host, "*."):
+			return 1
+		default:
+			return 0
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		oi, oj := hostOrder(hosts[i].host), hostOrder(hosts[j].host)
+		if oi != oj {
+			return oi < oj
+		}
+		if len(hosts[i].host) != len(hosts[j].host) {
+			return len(hosts[i].host) > len(hosts[j].host)
+		}
+		return hosts[i].host < hosts[j].host
+	})
+
+	var rules []*ruleSpec
+	for _, hr := range hosts {
+		rule := &ruleSpec{HostRegexp: hostRegexp(hr.host)}
+
+		for _, r := range hr.exact {
+			rule.Paths = append(rule.Paths, &pathSpec{Path: r.path, Backend: r.backend})
+		}
+
+		// NOTE: Prefixes match elements of paths, so /foo matches /foo and
+		// /foo/bar, but not /foobar.
+		sort.SliceStable(hr.prefixes, func(i, j int) bool {
+			return len(hr.prefixes[i].path) > len(hr.prefixes[j].path)
+		})
+		for _, r := range hr.prefixes {
+			if r.path == "" {
+				rule.Paths = append(rule.Paths, &pathSpec{PathPrefix: "/", Backend: r.backend})
+				continue
+			}
+			rule.Paths = append(rule.Paths,
+				&pathSpec{Path: r.path, Backend: r.backend},
+				&pathSpec{PathPrefix: r.path + "/", Backend: r.backend})
+		}
+
+		if len(rule.Paths) != 0 {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// hostRegexp returns the regular expression matching the host with any
+// port, a wildcard matches a single label.
+func hostRegexp(host string) string {
+	if host == "" {
+		return ""
+	}
+	if strings.HasPrefix(host, "*.") {
+		return `^[^.]+` + regexp.QuoteMeta(host[1:]) + `(:\d+)?$`
+	}
+	return `^` + regexp.QuoteMeta(host) + `(:\d+)?$`
+}
+
+// addServer adds the spec of the server, it's valid by construction.
+func (t *translator) addServer(name string, spec *ServerSpec, certificates []string, rules []*ruleSpec) {
+	t.specs[name] = &serverSpec{
+		Kind:             httpServerKind,
+		Name:             name,
+		Port:             spec.Port,
+		KeepAlive:        spec.KeepAlive,
+		KeepAliveTimeout: spec.KeepAliveTimeout,
+		MaxConnections:   spec.MaxConnections,
+		HTTPS:            len(certificates) != 0,
+		Certificates:     certificates,
+		Rules:            rules,
+	}
+}
+
+// specDocs returns the specs as YAML documents.
+func (tr *translation) specDocs() ([]byte, error) {
+	var buff []byte
+	for _, spec := range tr.specs {
+		doc, err := yaml.Marshal(spec)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %#v to yaml failed: %v", spec, err)
+		}
+		buff = append(buff, "---\n"...)
+		buff = append(buff, doc...)
+	}
+	return buff, nil
+}
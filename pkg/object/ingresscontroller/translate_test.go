@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	_ "github.com/megaease/easegress/pkg/filter/mock"
+)
+
+const ingressesJSON = `{"items": [
+{
+  "metadata": {"name": "shop", "namespace": "default"},
+  "spec": {
+    "ingressClassName": "easegress",
+    "tls": [{"hosts": ["shop.example.com"], "secretName": "shop-tls"}],
+    "rules": [{
+      "host": "shop.example.com",
+      "http": {"paths": [
+        {"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "web", "port": {"number": 80}}}},
+        {"path": "/api/", "pathType": "Prefix", "backend": {"service": {"name": "api", "port": {"name": "http"}}}},
+        {"path": "/healthz", "pathType": "Exact", "backend": {"resource": {"apiGroup": "easegress.megaease.com", "kind": "Pipeline", "name": "health"}}}
+      ]}
+    }]
+  }
+},
+{
+  "metadata": {"name": "legacy", "namespace": "default", "annotations": {"kubernetes.io/ingress.class": "easegress"}},
+  "spec": {
+    "defaultBackend": {"service": {"name": "web", "port": {"number": 80}}},
+    "rules": [{
+      "host": "*.example.com",
+      "http": {"paths": [
+        {"path": "/missing", "pathType": "Prefix", "backend": {"resource": {"apiGroup": "easegress.megaease.com", "kind": "Pipeline", "name": "missing"}}}
+      ]}
+    }]
+  }
+},
+{
+  "metadata": {"name": "other", "namespace": "default"},
+  "spec": {
+    "ingressClassName": "nginx",
+    "defaultBackend": {"service": {"name": "other", "port": {"number": 80}}}
+  }
+}
+]}`
+
+const pipelinesJSON = `{"items": [
+{
+  "metadata": {"name": "health", "namespace": "default"},
+  "spec": {"flow": [{"filter": "ok"}]}
+}
+]}`
+
+const pluginsJSON = `{"items": [
+{
+  "metadata": {"name": "ok", "namespace": "default"},
+  "spec": {"kind": "Mock", "rules": [{"code": 200, "body": "ok"}]}
+}
+]}`
+
+const servicesJSON = `{"metadata": {"name": "api", "namespace": "default"},
+  "spec": {"ports": [{"name": "http", "port": 8080}]}}`
+
+func newTLSSecret(t *testing.T, host string) *secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &secret{Type: secretTypeTLS, Data: map[string]string{
+		"tls.crt": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"tls.key": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}}
+	return s
+}
+
+func TestTranslate(t *testing.T) {
+	res := &resources{
+		services: map[string]*service{},
+		secrets:  map[string]*secret{"default/shop-tls": newTLSSecret(t, "shop.example.com")},
+	}
+
+	ingresses := &ingressList{}
+	pipelines, plugins := &customResourceList{}, &customResourceList{}
+	svc := &service{}
+	for _, item := range []struct {
+		data string
+		v    interface{}
+	}{
+		{ingressesJSON, ingresses},
+		{pipelinesJSON, pipelines},
+		{pluginsJSON, plugins},
+		{servicesJSON, svc},
+	} {
+		if err := json.Unmarshal([]byte(item.data), item.v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res.ingresses = matchIngresses(ingresses.Items, defaultIngressClass)
+	res.pipelines, res.plugins = pipelines.Items, plugins.Items
+	res.services["default/api"] = svc
+
+	if len(res.ingresses) != 2 {
+		t.Fatalf("want 2 ingresses, got %d", len(res.ingresses))
+	}
+	if keys := referencedServices(res.ingresses); len(keys) != 1 || keys[0] != "default/api" {
+		t.Errorf("unexpected referenced services %v", keys)
+	}
+
+	spec := &Spec{
+		HTTPServer:  &ServerSpec{Port: 80},
+		HTTPSServer: &ServerSpec{Port: 443},
+	}
+	tr := newTranslator("ic", spec, res).translate()
+
+	if len(tr.warnings) != 1 {
+		t.Errorf("want 1 warning of the missing pipeline, got %v", tr.warnings)
+	}
+	if len(tr.certificates) != 1 || tr.certificates[0].Name != "ic-default-shop-tls" {
+		t.Fatalf("unexpected certificates %v", tr.certificates)
+	}
+	if tr.pipelines != 3 {
+		t.Errorf("want 3 pipelines, got %d", tr.pipelines)
+	}
+
+	var servers []*serverSpec
+	for _, spec := range tr.specs {
+		if s, ok := spec.(*serverSpec); ok {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) != 2 || servers[1].Name != "ic-https" || servers[1].Certificates[0] != "ic-default-shop-tls" {
+		t.Fatalf("unexpected servers %v", servers)
+	}
+
+	rules := servers[0].Rules
+	if len(rules) != 2 {
+		t.Fatalf("want 2 rules, got %d", len(rules))
+	}
+	if rules[0].HostRegexp != `^shop\.example\.com(:\d+)?$` {
+		t.Errorf("unexpected host regexp %s", rules[0].HostRegexp)
+	}
+	want := []pathSpec{
+		{Path: "/healthz", Backend: "ic-default-health"},
+		{Path: "/api", Backend: "ic-default-api-8080"},
+		{PathPrefix: "/api/", Backend: "ic-default-api-8080"},
+		{PathPrefix: "/", Backend: "ic-default-web-80"},
+	}
+	if len(rules[0].Paths) != len(want) {
+		t.Fatalf("want %d paths, got %d", len(want), len(rules[0].Paths))
+	}
+	for i, p := range rules[0].Paths {
+		if *p != want[i] {
+			t.Errorf("path %d: want %v, got %v", i, want[i], *p)
+		}
+	}
+
+	// NOTE: The wildcard rule has no valid paths, so the catch-all rule
+	// of the default backend follows.
+	if rules[1].HostRegexp != "" || rules[1].Paths[0].Backend != "ic-default-web-80" {
+		t.Errorf("unexpected default rule %v", rules[1])
+	}
+
+	if _, err := tr.specDocs(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHostRegexp(t *testing.T) {
+	for host, want := range map[string]string{
+		"":              "",
+		"a.example.com": `^a\.example\.com(:\d+)?$`,
+		"*.example.com": `^[^.]+\.example\.com(:\d+)?$`,
+	} {
+		if got := hostRegexp(host); got != want {
+			t.Errorf("host %q: want %s, got %s", host, want, got)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/v"
@@ -190,9 +191,16 @@ func (m *Master) readAPISpec(w http.ResponseWriter, r *http.Request, pbSpec inte
 		return fmt.Errorf("read body failed: %v", err)
 	}
 
-	err = json.Unmarshal(body, pbSpec)
+	// NOTE: The body could be either JSON or YAML, anchors and aliases
+	// in YAML are expanded here.
+	jsonBuff, err := yamljsontool.YAMLToJSON(body)
 	if err != nil {
-		return fmt.Errorf("unmarshal %s to pb spec %#v failed: %v", string(body), pbSpec, err)
+		return fmt.Errorf("unmarshal %s failed: %v", string(body), err)
+	}
+
+	err = json.Unmarshal(jsonBuff, pbSpec)
+	if err != nil {
+		return fmt.Errorf("unmarshal %s to pb spec %#v failed: %v", string(jsonBuff), pbSpec, err)
 	}
 
 	err = m.convertPBToSpec(pbSpec, spec)
@@ -200,7 +208,7 @@ func (m *Master) readAPISpec(w http.ResponseWriter, r *http.Request, pbSpec inte
 		return err
 	}
 
-	yamlBuff, err := yamljsontool.JSONToYAML(body)
+	yamlBuff, err := yamljsontool.JSONToYAML(jsonBuff)
 	if err != nil {
 		return err
 	}
@@ -212,3 +220,31 @@ func (m *Master) readAPISpec(w http.ResponseWriter, r *http.Request, pbSpec inte
 
 	return nil
 }
+
+// writeAPISpec writes the spec in JSON, or in YAML if the client accepts
+// it only.
+func (m *Master) writeAPISpec(w http.ResponseWriter, r *http.Request, spec interface{}) {
+	buff, err := json.Marshal(spec)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to json failed: %v", spec, err))
+	}
+
+	if !acceptYAML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buff)
+		return
+	}
+
+	buff, err = yamljsontool.JSONToYAML(buff)
+	if err != nil {
+		panic(fmt.Errorf("transform json %s to yaml failed: %v", buff, err))
+	}
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func acceptYAML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return !strings.Contains(accept, "json") &&
+		(strings.Contains(accept, "yaml") || strings.Contains(accept, "yml"))
+}
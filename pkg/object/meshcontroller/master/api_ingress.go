@@ -18,7 +18,6 @@
 package master
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
@@ -59,13 +58,7 @@ func (m *Master) listIngresses(w http.ResponseWriter, r *http.Request) {
 		}
 		apiSpecs = append(apiSpecs, ingress)
 	}
-	buff, err := json.Marshal(apiSpecs)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", specs, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	m.writeAPISpec(w, r, apiSpecs)
 }
 
 func (m *Master) createIngress(w http.ResponseWriter, r *http.Request) {
@@ -121,13 +114,7 @@ func (m *Master) getIngress(w http.ResponseWriter, r *http.Request) {
 		panic(fmt.Errorf("convert spec %#v to pb failed: %v", ingressSpec, err))
 	}
 
-	buff, err := json.Marshal(pbIngressSpec)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", pbIngressSpec, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	m.writeAPISpec(w, r, pbIngressSpec)
 }
 
 func (m *Master) updateIngress(w http.ResponseWriter, r *http.Request) {
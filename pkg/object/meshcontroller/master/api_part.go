@@ -18,7 +18,6 @@
 package master
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -217,13 +216,7 @@ func (m *Master) getPartOfService(meta *partMeta) http.HandlerFunc {
 			panic(err)
 		}
 
-		buff, err := json.Marshal(part)
-		if err != nil {
-			panic(err)
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(buff)
+		m.writeAPISpec(w, r, part)
 	})
 }
 
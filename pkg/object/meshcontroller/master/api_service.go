@@ -18,7 +18,6 @@
 package master
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -63,13 +62,7 @@ func (m *Master) listServices(w http.ResponseWriter, r *http.Request) {
 		apiSpecs = append(apiSpecs, service)
 	}
 
-	buff, err := json.Marshal(apiSpecs)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", specs, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	m.writeAPISpec(w, r, apiSpecs)
 }
 
 func (m *Master) createService(w http.ResponseWriter, r *http.Request) {
@@ -136,13 +129,7 @@ func (m *Master) getService(w http.ResponseWriter, r *http.Request) {
 		panic(fmt.Errorf("convert spec %#v to pb failed: %v", serviceSpec, err))
 	}
 
-	buff, err := json.Marshal(pbServiceSpec)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", serviceSpec, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	m.writeAPISpec(w, r, pbServiceSpec)
 }
 
 func (m *Master) updateService(w http.ResponseWriter, r *http.Request) {
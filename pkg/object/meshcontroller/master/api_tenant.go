@@ -18,7 +18,6 @@
 package master
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
@@ -62,13 +61,7 @@ func (m *Master) listTenants(w http.ResponseWriter, r *http.Request) {
 		apiSpecs = append(apiSpecs, tenant)
 	}
 
-	buff, err := json.Marshal(apiSpecs)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", specs, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	m.writeAPISpec(w, r, apiSpecs)
 }
 
 func (m *Master) createTenant(w http.ResponseWriter, r *http.Request) {
@@ -132,13 +125,7 @@ func (m *Master) getTenant(w http.ResponseWriter, r *http.Request) {
 		panic(fmt.Errorf("convert spec %#v to pb failed: %v", tenantSpec, err))
 	}
 
-	buff, err := json.Marshal(pbTenantSpec)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to json failed: %v", pbTenantSpec, err))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(buff)
+	m.writeAPISpec(w, r, pbTenantSpec)
 }
 
 func (m *Master) updateTenant(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	v1alpha1 "github.com/megaease/easemesh-api/v1alpha1"
+)
+
+func TestReadAndWriteAPISpecInYAML(t *testing.T) {
+	m := &Master{}
+
+	body := `
+x-description: &description demo tenant
+name: tenant-demo
+description: *description
+`
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	tenant := &spec.Tenant{}
+	err := m.readAPISpec(nil, r, &v1alpha1.Tenant{}, tenant)
+	if err != nil {
+		t.Fatalf("read api spec failed: %v", err)
+	}
+	if tenant.Name != "tenant-demo" || tenant.Description != "demo tenant" {
+		t.Errorf("unexpected tenant: %+v", tenant)
+	}
+
+	pbTenant := &v1alpha1.Tenant{}
+	err = m.convertSpecToPB(tenant, pbTenant)
+	if err != nil {
+		t.Fatalf("convert spec to pb failed: %v", err)
+	}
+
+	r.Header.Set("Accept", "text/vnd.yaml")
+	w := httptest.NewRecorder()
+	m.writeAPISpec(w, r, pbTenant)
+	if ct := w.Header().Get("Content-Type"); ct != "text/vnd.yaml" {
+		t.Errorf("want yaml, got %s", ct)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("name: tenant-demo")) {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	m.writeAPISpec(w, r, pbTenant)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("want json, got %s", ct)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consulserviceregistry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/logger"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// configWaitTime is the max time of blocking queries.
+const configWaitTime = 5 * time.Minute
+
+// owner returns the owner of the objects synced from Consul KV.
+func (c *ConsulServiceRegistry) owner() string {
+	return Kind + "/" + c.superSpec.Name()
+}
+
+// watchConfig watches the specs under the config prefix in Consul KV by
+// blocking queries, and syncs them to the cluster once they're changed.
+func (c *ConsulServiceRegistry) watchConfig(ctx context.Context, retryInterval time.Duration) {
+	var lastIndex uint64
+	for {
+		index, err := c.syncConfig(ctx, lastIndex)
+
+		c.statusMutex.Lock()
+		c.configIndex = index
+		c.configSyncError = ""
+		if err != nil {
+			c.configSyncError = err.Error()
+		}
+		c.statusMutex.Unlock()
+
+		if err == nil {
+			lastIndex = index
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Errorf("%s sync config from consul failed: %v", c.superSpec.Name(), err)
+
+		// NOTE: Query again without waiting after the retry interval.
+		lastIndex = 0
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// syncConfig waits for the change after the index and syncs it, it
+// returns the index of the specs synced.
+func (c *ConsulServiceRegistry) syncConfig(ctx context.Context, lastIndex uint64) (uint64, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return lastIndex, err
+	}
+
+	q := &consulapi.QueryOptions{
+		Namespace:  c.spec.Namespace,
+		Datacenter: c.spec.Datacenter,
+		WaitIndex:  lastIndex,
+		WaitTime:   configWaitTime,
+	}
+	pairs, meta, err := client.KV().List(c.spec.ConfigPrefix, q.WithContext(ctx))
+	if err != nil {
+		return lastIndex, fmt.Errorf("list %s failed: %v", c.spec.ConfigPrefix, err)
+	}
+	// NOTE: The index could go backwards, e.g. the Consul servers are
+	// restored from a snapshot.
+	if meta.LastIndex == lastIndex {
+		return lastIndex, nil
+	}
+
+	server := api.GlobalServer
+	if server == nil {
+		return lastIndex, fmt.Errorf("api server is not ready")
+	}
+
+	plan, err := server.SyncSpecs(c.owner(), joinSpecDocs(pairs))
+	if err != nil {
+		return lastIndex, err
+	}
+	for _, change := range plan.Changes {
+		logger.Infof("%s %s %s %s from consul", c.superSpec.Name(), change.Action, change.Kind, change.Name)
+	}
+
+	return meta.LastIndex, nil
+}
+
+// joinSpecDocs joins the values of the keys as YAML documents, the keys
+// ending with / are folders.
+func joinSpecDocs(pairs consulapi.KVPairs) []byte {
+	var buff []byte
+	for _, pair := range pairs {
+		if strings.HasSuffix(pair.Key, "/") || len(pair.Value) == 0 {
+			continue
+		}
+		buff = append(buff, "---\n"...)
+		buff = append(buff, pair.Value...)
+		buff = append(buff, '\n')
+	}
+	return buff
+}
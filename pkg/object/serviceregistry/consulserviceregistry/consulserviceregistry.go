@@ -18,11 +18,13 @@
 package consulserviceregistry
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/supervisor"
 
 	"github.com/hashicorp/consul/api"
@@ -38,6 +40,7 @@ const (
 
 func init() {
 	supervisor.Register(&ConsulServiceRegistry{})
+	secret.RegisterSensitiveFields("token")
 }
 
 type (
@@ -50,10 +53,15 @@ type (
 		clientMutex sync.RWMutex
 		client      *api.Client
 
-		statusMutex sync.Mutex
-		serversNum  map[string]int
+		statusMutex     sync.Mutex
+		serversNum      map[string]int
+		configIndex     uint64
+		configSyncError string
+		registered      []string
 
-		done chan struct{}
+		done        chan struct{}
+		watchCtx    context.Context
+		cancelWatch context.CancelFunc
 	}
 
 	// Spec describes the ConsulServiceRegistry.
@@ -65,12 +73,32 @@ type (
 		Namespace    string   `yaml:"namespace" jsonschema:"omitempty"`
 		SyncInterval string   `yaml:"syncInterval" jsonschema:"required,format=duration"`
 		ServiceTags  []string `yaml:"serviceTags" jsonschema:"omitempty"`
+
+		// ConfigPrefix is the prefix of keys of specs in Consul KV, the
+		// specs are synced to the cluster if it's not empty.
+		ConfigPrefix string            `yaml:"configPrefix" jsonschema:"omitempty"`
+		Registration *RegistrationSpec `yaml:"registration,omitempty" jsonschema:"omitempty"`
+	}
+
+	// RegistrationSpec describes registering the members and their
+	// HTTPServers as services to the Consul agent.
+	RegistrationSpec struct {
+		ServiceName string   `yaml:"serviceName" jsonschema:"required"`
+		Address     string   `yaml:"address" jsonschema:"omitempty"`
+		Tags        []string `yaml:"tags" jsonschema:"omitempty"`
+
+		CheckInterval                  string `yaml:"checkInterval" jsonschema:"omitempty,format=duration"`
+		DeregisterCriticalServiceAfter string `yaml:"deregisterCriticalServiceAfter" jsonschema:"omitempty,format=duration"`
 	}
 
 	// Status is the status of ConsulServiceRegistry.
 	Status struct {
 		Health     string         `yaml:"health"`
 		ServersNum map[string]int `yaml:"serversNum"`
+
+		ConfigIndex     uint64   `yaml:"configIndex,omitempty"`
+		ConfigSyncError string   `yaml:"configSyncError,omitempty"`
+		Registered      []string `yaml:"registered,omitempty"`
 	}
 )
 
@@ -110,6 +138,7 @@ func (c *ConsulServiceRegistry) Inherit(superSpec *supervisor.Spec,
 func (c *ConsulServiceRegistry) reload() {
 	c.serversNum = map[string]int{}
 	c.done = make(chan struct{})
+	c.watchCtx, c.cancelWatch = context.WithCancel(context.Background())
 
 	_, err := c.getClient()
 	if err != nil {
@@ -142,16 +171,16 @@ func (c *ConsulServiceRegistry) buildClient() (*api.Client, error) {
 
 	config := api.DefaultConfig()
 	config.Address = c.spec.Address
-	if config.Scheme != "" {
+	if c.spec.Scheme != "" {
 		config.Scheme = c.spec.Scheme
 	}
-	if config.Datacenter != "" {
+	if c.spec.Datacenter != "" {
 		config.Datacenter = c.spec.Datacenter
 	}
-	if config.Token != "" {
+	if c.spec.Token != "" {
 		config.Token = c.spec.Token
 	}
-	if config.Namespace != "" {
+	if c.spec.Namespace != "" {
 		config.Namespace = c.spec.Namespace
 	}
 
@@ -185,7 +214,14 @@ func (c *ConsulServiceRegistry) run() {
 		return
 	}
 
+	if c.spec.ConfigPrefix != "" {
+		go c.watchConfig(c.watchCtx, syncInterval)
+	}
+
 	c.update()
+	if c.spec.Registration != nil {
+		c.register()
+	}
 
 	for {
 		select {
@@ -193,6 +229,9 @@ func (c *ConsulServiceRegistry) run() {
 			return
 		case <-time.After(syncInterval):
 			c.update()
+			if c.spec.Registration != nil {
+				c.register()
+			}
 		}
 	}
 }
@@ -268,11 +307,12 @@ func (c *ConsulServiceRegistry) Status() *supervisor.Status {
 	}
 
 	c.statusMutex.Lock()
-	serversNum := c.serversNum
+	s.ServersNum = c.serversNum
+	s.ConfigIndex = c.configIndex
+	s.ConfigSyncError = c.configSyncError
+	s.Registered = c.registered
 	c.statusMutex.Unlock()
 
-	s.ServersNum = serversNum
-
 	return &supervisor.Status{
 		ObjectStatus: s,
 	}
@@ -280,6 +320,11 @@ func (c *ConsulServiceRegistry) Status() *supervisor.Status {
 
 // Close closes ConsulServiceRegistry.
 func (c *ConsulServiceRegistry) Close() {
+	c.cancelWatch()
+	// NOTE: The next generation registers them again if it's inherited.
+	if c.spec.Registration != nil {
+		c.deregister()
+	}
 	c.closeClient()
 	close(c.done)
 
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consulserviceregistry
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+const (
+	defaultCheckInterval = "10s"
+	defaultCheckAddress  = "127.0.0.1"
+	adminServiceTag      = "admin"
+	memberServiceMetaKey = "easegress-member"
+	serverServiceMetaKey = "easegress-server"
+)
+
+// serviceIDPrefix returns the prefix of the IDs of services registered
+// by this member.
+func (c *ConsulServiceRegistry) serviceIDPrefix() string {
+	return c.spec.Registration.ServiceName + "-" + c.super.Options().Name
+}
+
+// desiredServices returns the services of this member and its running
+// HTTPServers.
+func (c *ConsulServiceRegistry) desiredServices() ([]*consulapi.AgentServiceRegistration, error) {
+	reg := c.spec.Registration
+	member := c.super.Options().Name
+
+	checkAddress := reg.Address
+	if checkAddress == "" {
+		checkAddress = defaultCheckAddress
+	}
+	interval := reg.CheckInterval
+	if interval == "" {
+		interval = defaultCheckInterval
+	}
+
+	newService := func(id string, port int, tags []string, meta map[string]string) *consulapi.AgentServiceRegistration {
+		meta[memberServiceMetaKey] = member
+		return &consulapi.AgentServiceRegistration{
+			ID:      id,
+			Name:    reg.ServiceName,
+			Address: reg.Address,
+			Port:    port,
+			Tags:    append(tags, reg.Tags...),
+			Meta:    meta,
+		}
+	}
+
+	_, apiPort, err := net.SplitHostPort(c.super.Options().APIAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api-addr: %v", err)
+	}
+	port, err := strconv.Atoi(apiPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api-addr: %v", err)
+	}
+	node := newService(c.serviceIDPrefix(), port, []string{adminServiceTag}, map[string]string{})
+	node.Check = &consulapi.AgentServiceCheck{
+		HTTP:     "http://" + net.JoinHostPort(checkAddress, apiPort) + "/apis/v1/healthz",
+		Interval: interval,
+	}
+	services := []*consulapi.AgentServiceRegistration{node}
+
+	c.super.WalkRunningObjects(func(ro *supervisor.RunningObject) bool {
+		spec, ok := ro.Spec().ObjectSpec().(*httpserver.Spec)
+		if !ok {
+			return true
+		}
+
+		scheme := "http"
+		if spec.HTTPS {
+			scheme = "https"
+		}
+		name := ro.Spec().Name()
+		service := newService(c.serviceIDPrefix()+"-"+name, int(spec.Port),
+			[]string{name, scheme}, map[string]string{serverServiceMetaKey: name})
+		service.Check = &consulapi.AgentServiceCheck{
+			TCP:      net.JoinHostPort(checkAddress, strconv.Itoa(int(spec.Port))),
+			Interval: interval,
+		}
+		services = append(services, service)
+		return true
+	}, httpserver.Category)
+
+	for _, service := range services {
+		if reg.DeregisterCriticalServiceAfter != "" {
+			service.Check.DeregisterCriticalServiceAfter = reg.DeregisterCriticalServiceAfter
+		}
+	}
+
+	return services, nil
+}
+
+// register registers this member and its running HTTPServers as services
+// to the Consul agent, and deregisters the ones of HTTPServers closed.
+func (c *ConsulServiceRegistry) register() {
+	client, err := c.getClient()
+	if err != nil {
+		logger.Errorf("%s get consul client failed: %v", c.superSpec.Name(), err)
+		return
+	}
+
+	services, err := c.desiredServices()
+	if err != nil {
+		logger.Errorf("%s build services failed: %v", c.superSpec.Name(), err)
+		return
+	}
+
+	agent := client.Agent()
+	registered := []string{}
+	desired := map[string]struct{}{}
+	for _, service := range services {
+		desired[service.ID] = struct{}{}
+		err := agent.ServiceRegister(service)
+		if err != nil {
+			logger.Errorf("%s register service %s failed: %v", c.superSpec.Name(), service.ID, err)
+			continue
+		}
+		registered = append(registered, service.ID)
+	}
+
+	for _, id := range c.registeredServiceIDs(agent) {
+		if _, exists := desired[id]; exists {
+			continue
+		}
+		err := agent.ServiceDeregister(id)
+		if err != nil {
+			logger.Errorf("%s deregister service %s failed: %v", c.superSpec.Name(), id, err)
+		}
+	}
+
+	c.statusMutex.Lock()
+	c.registered = registered
+	c.statusMutex.Unlock()
+}
+
+// deregister deregisters all services registered by this member.
+func (c *ConsulServiceRegistry) deregister() {
+	client, err := c.getClient()
+	if err != nil {
+		logger.Errorf("%s get consul client failed: %v", c.superSpec.Name(), err)
+		return
+	}
+
+	agent := client.Agent()
+	for _, id := range c.registeredServiceIDs(agent) {
+		err := agent.ServiceDeregister(id)
+		if err != nil {
+			logger.Errorf("%s deregister service %s failed: %v", c.superSpec.Name(), id, err)
+		}
+	}
+}
+
+func (c *ConsulServiceRegistry) registeredServiceIDs(agent *consulapi.Agent) []string {
+	services, err := agent.Services()
+	if err != nil {
+		logger.Errorf("%s list services of agent failed: %v", c.superSpec.Name(), err)
+		return nil
+	}
+
+	var ids []string
+	prefix := c.serviceIDPrefix()
+	for id, service := range services {
+		if service.Meta[memberServiceMetaKey] != c.super.Options().Name {
+			continue
+		}
+		if id == prefix || strings.HasPrefix(id, prefix+"-") {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
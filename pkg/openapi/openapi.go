@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package openapi generates OpenAPI 3 documents of the APIs served by
+// HTTP servers, from the routes of the servers and the filters of the
+// pipelines they route to.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Version is the version of OpenAPI of the documents.
+	Version = "3.0.3"
+
+	// ServerKind is the kind of HTTPServer, whose routes are documented.
+	ServerKind = "HTTPServer"
+
+	pathParam = "path"
+)
+
+// methods are the methods of the routes without methods, in the order of
+// the fields of PathItem.
+var methods = []string{
+	http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete,
+	http.MethodOptions, http.MethodHead, http.MethodPatch,
+}
+
+type (
+	// Document is an OpenAPI document.
+	Document struct {
+		OpenAPI    string               `yaml:"openapi" json:"openapi"`
+		Info       *Info                `yaml:"info" json:"info"`
+		Paths      map[string]*PathItem `yaml:"paths" json:"paths"`
+		Components *Components          `yaml:"components,omitempty" json:"components,omitempty"`
+	}
+
+	// Info is the metadata of the APIs.
+	Info struct {
+		Title   string `yaml:"title" json:"title"`
+		Version string `yaml:"version" json:"version"`
+	}
+
+	// PathItem is the operations of a path.
+	PathItem struct {
+		Get     *Operation `yaml:"get,omitempty" json:"get,omitempty"`
+		Put     *Operation `yaml:"put,omitempty" json:"put,omitempty"`
+		Post    *Operation `yaml:"post,omitempty" json:"post,omitempty"`
+		Delete  *Operation `yaml:"delete,omitempty" json:"delete,omitempty"`
+		Options *Operation `yaml:"options,omitempty" json:"options,omitempty"`
+		Head    *Operation `yaml:"head,omitempty" json:"head,omitempty"`
+		Patch   *Operation `yaml:"patch,omitempty" json:"patch,omitempty"`
+	}
+
+	// Operation is an API operation, it's handled by a pipeline.
+	Operation struct {
+		Summary    string                `yaml:"summary" json:"summary"`
+		Tags       []string              `yaml:"tags" json:"tags"`
+		Parameters []*Parameter          `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+		Security   []map[string][]string `yaml:"security,omitempty" json:"security,omitempty"`
+		Responses  map[string]*Response  `yaml:"responses" json:"responses"`
+		Servers    []*Server             `yaml:"servers" json:"servers"`
+	}
+
+	// Parameter is a parameter of an operation.
+	Parameter struct {
+		Name        string  `yaml:"name" json:"name"`
+		In          string  `yaml:"in" json:"in"`
+		Description string  `yaml:"description,omitempty" json:"description,omitempty"`
+		Required    bool    `yaml:"required" json:"required"`
+		Schema      *Schema `yaml:"schema" json:"schema"`
+	}
+
+	// Schema is the schema of a parameter.
+	Schema struct {
+		Type    string   `yaml:"type" json:"type"`
+		Enum    []string `yaml:"enum,omitempty" json:"enum,omitempty"`
+		Pattern string   `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	}
+
+	// Response is a response of an operation.
+	Response struct {
+		Description string `yaml:"description" json:"description"`
+	}
+
+	// Server is a server serving an operation.
+	Server struct {
+		URL       string                     `yaml:"url" json:"url"`
+		Variables map[string]*ServerVariable `yaml:"variables,omitempty" json:"variables,omitempty"`
+	}
+
+	// ServerVariable is a variable in the URL of a server.
+	ServerVariable struct {
+		Default string `yaml:"default" json:"default"`
+	}
+
+	// Components are the security schemes referenced by operations.
+	Components struct {
+		SecuritySchemes map[string]*SecurityScheme `yaml:"securitySchemes" json:"securitySchemes"`
+	}
+
+	// SecurityScheme is a security scheme checked by a filter.
+	SecurityScheme struct {
+		Type             string `yaml:"type" json:"type"`
+		Description      string `yaml:"description,omitempty" json:"description,omitempty"`
+		Name             string `yaml:"name,omitempty" json:"name,omitempty"`
+		In               string `yaml:"in,omitempty" json:"in,omitempty"`
+		Scheme           string `yaml:"scheme,omitempty" json:"scheme,omitempty"`
+		BearerFormat     string `yaml:"bearerFormat,omitempty" json:"bearerFormat,omitempty"`
+		OpenIDConnectURL string `yaml:"openIdConnectUrl,omitempty" json:"openIdConnectUrl,omitempty"`
+	}
+
+	// serverSpec is the part of the spec of HTTPServer about routes.
+	// NOTE: It's unmarshalled from the config instead of importing the
+	// package of HTTPServer, so generating documents doesn't depend on
+	// traffic gates.
+	serverSpec struct {
+		Port  uint16 `yaml:"port"`
+		HTTPS bool   `yaml:"https"`
+		Rules []struct {
+			Host  string `yaml:"host"`
+			Paths []struct {
+				Path       string   `yaml:"path"`
+				PathPrefix string   `yaml:"pathPrefix"`
+				PathRegexp string   `yaml:"pathRegexp"`
+				Methods    []string `yaml:"methods"`
+				Backend    string   `yaml:"backend"`
+			} `yaml:"paths"`
+		} `yaml:"rules"`
+	}
+
+	// pipelineAPI is what the pipeline requires of requests.
+	pipelineAPI struct {
+		parameters []*Parameter
+		security   map[string][]string
+	}
+)
+
+// Generate generates the document of the APIs served by the HTTP servers
+// in the specs, which are all objects running. Routes by regular
+// expressions or to pipelines not in the specs are not documented.
+func Generate(specs []*supervisor.Spec, info *Info) *Document {
+	doc := &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      map[string]*PathItem{},
+		Components: &Components{SecuritySchemes: map[string]*SecurityScheme{}},
+	}
+
+	pipelines := map[string]*supervisor.Spec{}
+	var servers []*supervisor.Spec
+	for _, spec := range specs {
+		switch spec.Kind() {
+		case httppipeline.Kind:
+			pipelines[spec.Name()] = spec
+		case ServerKind:
+			servers = append(servers, spec)
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name() < servers[j].Name() })
+
+	apis := map[string]*pipelineAPI{}
+	for _, server := range servers {
+		spec := &serverSpec{}
+		err := yaml.Unmarshal([]byte(server.YAMLConfig()), spec)
+		if err != nil {
+			continue
+		}
+
+		scheme := "http"
+		if spec.HTTPS {
+			scheme = "https"
+		}
+		for _, rule := range spec.Rules {
+			url := &Server{URL: fmt.Sprintf("%s://%s:%d", scheme, rule.Host, spec.Port)}
+			if rule.Host == "" {
+				url.URL = fmt.Sprintf("%s://{host}:%d", scheme, spec.Port)
+				url.Variables = map[string]*ServerVariable{"host": {Default: "127.0.0.1"}}
+			}
+
+			for _, p := range rule.Paths {
+				pipeline := pipelines[p.Backend]
+				if pipeline == nil {
+					pipeline = pipelines[supervisor.QualifiedName(server.Namespace(), p.Backend)]
+				}
+				if pipeline == nil || p.PathRegexp != "" {
+					continue
+				}
+
+				api := apis[pipeline.Name()]
+				if api == nil {
+					api = describePipeline(pipeline, doc.Components.SecuritySchemes)
+					apis[pipeline.Name()] = api
+				}
+
+				path, parameters := p.Path, api.parameters
+				if path == "" {
+					path = p.PathPrefix + "{" + pathParam + "}"
+					if p.PathPrefix == "" {
+						path = "/{" + pathParam + "}"
+					}
+					parameters = append([]*Parameter{{
+						Name:        pathParam,
+						In:          "path",
+						Description: "the rest of the path, which may contain slashes",
+						Required:    true,
+						Schema:      &Schema{Type: "string"},
+					}}, parameters...)
+				}
+
+				item := doc.Paths[path]
+				if item == nil {
+					item = &PathItem{}
+					doc.Paths[path] = item
+				}
+				pathMethods := p.Methods
+				if len(pathMethods) == 0 {
+					pathMethods = methods
+				}
+				for _, method := range pathMethods {
+					op := item.operation(method)
+					if op == nil {
+						continue
+					}
+					if *op == nil {
+						*op = newOperation(pipeline.Name(), parameters, api.security)
+					}
+					// NOTE: The first route of a path and a method wins, the
+					// same route in other servers only adds the servers.
+					if (*op).Summary == pipeline.Name() && !hasServer((*op).Servers, url) {
+						(*op).Servers = append((*op).Servers, url)
+					}
+				}
+			}
+		}
+	}
+
+	if len(doc.Components.SecuritySchemes) == 0 {
+		doc.Components = nil
+	}
+	return doc
+}
+
+func newOperation(pipeline string, parameters []*Parameter, security map[string][]string) *Operation {
+	op := &Operation{
+		Summary:    pipeline,
+		Tags:       []string{pipeline},
+		Parameters: parameters,
+		Responses: map[string]*Response{
+			"default": {Description: fmt.Sprintf("response of pipeline %s", pipeline)},
+		},
+	}
+	if len(security) != 0 {
+		op.Security = []map[string][]string{security}
+	}
+	return op
+}
+
+func hasServer(servers []*Server, server *Server) bool {
+	for _, s := range servers {
+		if s.URL == server.URL {
+			return true
+		}
+	}
+	return false
+}
+
+// operation returns the field of the operation of the method, or nil if
+// the method is not supported by OpenAPI.
+func (item *PathItem) operation(method string) **Operation {
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		return &item.Get
+	case http.MethodPut:
+		return &item.Put
+	case http.MethodPost:
+		return &item.Post
+	case http.MethodDelete:
+		return &item.Delete
+	case http.MethodOptions:
+		return &item.Options
+	case http.MethodHead:
+		return &item.Head
+	case http.MethodPatch:
+		return &item.Patch
+	}
+	return nil
+}
+
+// describePipeline describes the parameters and security required by the
+// filters of the pipeline, the security schemes are added to schemes by
+// the names of the pipeline and the filters.
+func describePipeline(pipeline *supervisor.Spec, schemes map[string]*SecurityScheme) *pipelineAPI {
+	api := &pipelineAPI{security: map[string][]string{}}
+	spec, ok := pipeline.ObjectSpec().(*httppipeline.Spec)
+	if !ok {
+		return api
+	}
+
+	for _, description := range spec.DescribeAPI() {
+		for _, p := range description.Parameters {
+			api.parameters = append(api.parameters, &Parameter{
+				Name:        p.Name,
+				In:          p.In,
+				Description: p.Description,
+				Required:    p.Required,
+				Schema:      &Schema{Type: "string", Enum: p.Enum, Pattern: p.Pattern},
+			})
+		}
+		for i, s := range description.Security {
+			name := pipeline.Name() + "." + description.Filter
+			if i > 0 {
+				name = fmt.Sprintf("%s.%d", name, i)
+			}
+			schemes[name] = &SecurityScheme{
+				Type:             s.Type,
+				Description:      s.Description,
+				Name:             s.Name,
+				In:               s.In,
+				Scheme:           s.Scheme,
+				BearerFormat:     s.BearerFormat,
+				OpenIDConnectURL: s.OpenIDConnectURL,
+			}
+			api.security[name] = []string{}
+		}
+	}
+	return api
+}
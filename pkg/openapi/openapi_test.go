@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"testing"
+
+	_ "github.com/megaease/easegress/pkg/filter/apikeyauth"
+	_ "github.com/megaease/easegress/pkg/filter/mock"
+	_ "github.com/megaease/easegress/pkg/filter/validator"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+type (
+	// testServer stands for HTTPServer, which is not imported by tests.
+	testServer struct{}
+
+	testServerSpec struct {
+		Port  uint16      `yaml:"port" jsonschema:"required"`
+		HTTPS bool        `yaml:"https" jsonschema:"omitempty"`
+		Rules interface{} `yaml:"rules" jsonschema:"-"`
+	}
+)
+
+func (s *testServer) Category() supervisor.ObjectCategory { return supervisor.CategoryTrafficGate }
+func (s *testServer) Kind() string                        { return ServerKind }
+func (s *testServer) DefaultSpec() interface{}            { return &testServerSpec{} }
+func (s *testServer) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+}
+func (s *testServer) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+}
+func (s *testServer) Status() *supervisor.Status { return nil }
+func (s *testServer) Close()                     {}
+
+func init() {
+	supervisor.Register(&testServer{})
+}
+
+func TestGenerate(t *testing.T) {
+	var specs []*supervisor.Spec
+	for _, config := range []string{`
+name: server
+kind: HTTPServer
+port: 10080
+rules:
+- host: api.example.com
+  paths:
+  - path: /orders
+    methods: [GET, POST]
+    backend: orders
+  - pathPrefix: /users/
+    backend: users
+  - pathRegexp: ^/items/\d+$
+    backend: orders
+  - path: /missing
+    backend: missing
+`, `
+name: orders
+kind: HTTPPipeline
+filters:
+- name: auth
+  kind: APIKeyAuth
+  header: X-API-Key
+- name: validator
+  kind: Validator
+  headers:
+    X-Tenant:
+      values: [a, b]
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`, `
+name: users
+kind: HTTPPipeline
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - code: 200
+`} {
+		spec, err := supervisor.NewSpec(config)
+		if err != nil {
+			t.Fatalf("new spec failed: %v", err)
+		}
+		specs = append(specs, spec)
+	}
+
+	doc := Generate(specs, &Info{Title: "test", Version: "1"})
+	if len(doc.Paths) != 2 {
+		t.Fatalf("want 2 paths, got %v", doc.Paths)
+	}
+
+	orders := doc.Paths["/orders"]
+	if orders == nil || orders.Get == nil || orders.Post == nil || orders.Put != nil {
+		t.Fatalf("unexpected operations of /orders: %+v", orders)
+	}
+	op := orders.Get
+	if op.Summary != "orders" || len(op.Servers) != 1 || op.Servers[0].URL != "http://api.example.com:10080" {
+		t.Errorf("unexpected operation: %+v", op)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "X-Tenant" || len(op.Parameters[0].Schema.Enum) != 2 {
+		t.Errorf("unexpected parameters: %+v", op.Parameters)
+	}
+	if len(op.Security) != 1 || op.Security[0]["orders.auth"] == nil {
+		t.Errorf("unexpected security: %+v", op.Security)
+	}
+	if scheme := doc.Components.SecuritySchemes["orders.auth"]; scheme == nil || scheme.In != "header" || scheme.Name != "X-API-Key" {
+		t.Errorf("unexpected security scheme: %+v", scheme)
+	}
+
+	users := doc.Paths["/users/{path}"]
+	if users == nil || users.Delete == nil || users.Delete.Parameters[0].In != "path" {
+		t.Errorf("unexpected operations of /users/{path}: %+v", users)
+	}
+}
@@ -52,6 +52,7 @@ type Options struct {
 	// meta
 	Name                            string            `yaml:"name" env:"EG_NAME"`
 	Labels                          map[string]string `yaml:"labels" env:"EG_LABELS"`
+	NodeGroup                       string            `yaml:"node-group"`
 	ClusterName                     string            `yaml:"cluster-name"`
 	ClusterRole                     string            `yaml:"cluster-role"`
 	ClusterRequestTimeout           string            `yaml:"cluster-request-timeout"`
@@ -60,7 +61,25 @@ type Options struct {
 	ClusterAdvertiseClientURLs      []string          `yaml:"cluster-advertise-client-urls"`
 	ClusterInitialAdvertisePeerURLs []string          `yaml:"cluster-initial-advertise-peer-urls"`
 	ClusterJoinURLs                 []string          `yaml:"cluster-join-urls"`
+	ClusterDiscovery                string            `yaml:"cluster-discovery"`
+	ClusterDiscoveryTarget          string            `yaml:"cluster-discovery-target"`
+	ClusterDiscoveryExpect          int               `yaml:"cluster-discovery-expect"`
+	ClusterEtcdEndpoints            []string          `yaml:"cluster-etcd-endpoints"`
+	ClusterEtcdPrefix               string            `yaml:"cluster-etcd-prefix"`
+	ClusterEtcdCAFile               string            `yaml:"cluster-etcd-ca-file"`
+	ClusterEtcdCertFile             string            `yaml:"cluster-etcd-cert-file"`
+	ClusterEtcdKeyFile              string            `yaml:"cluster-etcd-key-file"`
 	APIAddr                         string            `yaml:"api-addr"`
+	GRPCAPIAddr                     string            `yaml:"grpc-api-addr"`
+	GossipAddr                      string            `yaml:"gossip-addr"`
+	APIAuthFile                     string            `yaml:"api-auth-file"`
+	APITLSCertFile                  string            `yaml:"api-tls-cert-file"`
+	APITLSKeyFile                   string            `yaml:"api-tls-key-file"`
+	APITLSClientCAFile              string            `yaml:"api-tls-client-ca-file"`
+	APIRequireIfMatch               bool              `yaml:"api-require-if-match"`
+	PipelineVersions                int               `yaml:"pipeline-versions"`
+	ConfigHistory                   int               `yaml:"config-history"`
+	ShutdownTimeout                 string            `yaml:"shutdown-timeout"`
 	Debug                           bool              `yaml:"debug"`
 
 	// Path.
@@ -69,17 +88,39 @@ type Options struct {
 	WALDir    string `yaml:"wal-dir"`
 	LogDir    string `yaml:"log-dir"`
 	MemberDir string `yaml:"member-dir"`
+	PluginDir string `yaml:"plugin-dir"`
+
+	// Vault, the token is read from VAULT_TOKEN if vault-token-file is empty.
+	VaultAddr            string `yaml:"vault-addr"`
+	VaultTokenFile       string `yaml:"vault-token-file"`
+	VaultNamespace       string `yaml:"vault-namespace"`
+	VaultRefreshInterval string `yaml:"vault-refresh-interval"`
+
+	// Master key to encrypt sensitive fields of object specs, the key is
+	// read from EG_MASTER_KEY if both are empty.
+	MasterKeyFile         string `yaml:"master-key-file"`
+	MasterKeyVaultTransit string `yaml:"master-key-vault-transit"`
+
+	// Interpolation in object specs, nothing is interpolated if empty.
+	InterpolationEnvPrefixes []string `yaml:"interpolation-env-prefixes"`
+	InterpolationFileDirs    []string `yaml:"interpolation-file-dirs"`
 
 	// Profile.
 	CPUProfileFile    string `yaml:"cpu-profile-file"`
 	MemoryProfileFile string `yaml:"memory-profile-file"`
 
 	// Prepare the items below in advance.
-	AbsHomeDir   string `yaml:"-"`
-	AbsDataDir   string `yaml:"-"`
-	AbsWALDir    string `yaml:"-"`
-	AbsLogDir    string `yaml:"-"`
-	AbsMemberDir string `yaml:"-"`
+	AbsHomeDir     string `yaml:"-"`
+	AbsDataDir     string `yaml:"-"`
+	AbsWALDir      string `yaml:"-"`
+	AbsLogDir      string `yaml:"-"`
+	AbsMemberDir   string `yaml:"-"`
+	AbsPluginDir   string `yaml:"-"`
+	AbsAPIAuthFile string `yaml:"-"`
+
+	AbsAPITLSCertFile     string `yaml:"-"`
+	AbsAPITLSKeyFile      string `yaml:"-"`
+	AbsAPITLSClientCAFile string `yaml:"-"`
 }
 
 // New creates a default Options.
@@ -95,6 +136,7 @@ func New() *Options {
 	opt.flags.BoolVar(&opt.ForceNewCluster, "force-new-cluster", false, "Force to create a new one-member cluster.")
 	opt.flags.StringVar(&opt.Name, "name", "eg-default-name", "Human-readable name for this member.")
 	opt.flags.StringToStringVar(&opt.Labels, "labels", nil, "The labels for the instance of Easegress.")
+	opt.flags.StringVar(&opt.NodeGroup, "node-group", "", "Node group of this member, objects placed on other node groups don't run on it.")
 	opt.flags.StringVar(&opt.ClusterName, "cluster-name", "eg-cluster-default-name", "Human-readable name for the new cluster, ignored while joining an existed cluster.")
 	opt.flags.StringVar(&opt.ClusterRole, "cluster-role", "writer", "Cluster role for this member (reader, writer).")
 	opt.flags.StringVar(&opt.ClusterRequestTimeout, "cluster-request-timeout", "10s", "Timeout to handle request in the cluster.")
@@ -103,7 +145,25 @@ func New() *Options {
 	opt.flags.StringSliceVar(&opt.ClusterAdvertiseClientURLs, "cluster-advertise-client-urls", []string{"http://localhost:2379"}, "List of this member’s client URLs to advertise to the rest of the cluster.")
 	opt.flags.StringSliceVar(&opt.ClusterInitialAdvertisePeerURLs, "cluster-initial-advertise-peer-urls", []string{"http://localhost:2380"}, "List of this member’s peer URLs to advertise to the rest of the cluster.")
 	opt.flags.StringSliceVar(&opt.ClusterJoinURLs, "cluster-join-urls", nil, "List of URLs to join, when the first url is the same with any one of cluster-initial-advertise-peer-urls, it means to join itself, and this config will be treated empty.")
+	opt.flags.StringVar(&opt.ClusterDiscovery, "cluster-discovery", "", "Way to discover the peers to join if cluster-join-urls is empty (dns-srv, kubernetes, gce), it's disabled if empty.")
+	opt.flags.StringVar(&opt.ClusterDiscoveryTarget, "cluster-discovery-target", "", "SRV name for dns-srv, headless service name for kubernetes, or instance label(key=value) for gce to discover the peers.")
+	opt.flags.IntVar(&opt.ClusterDiscoveryExpect, "cluster-discovery-expect", 1, "Number of writers expected to be discovered before a writer bootstraps or joins the cluster.")
+	opt.flags.StringSliceVar(&opt.ClusterEtcdEndpoints, "cluster-etcd-endpoints", nil, "List of client URLs of an external etcd cluster to store the config in, the embedded etcd is not started if specified.")
+	opt.flags.StringVar(&opt.ClusterEtcdPrefix, "cluster-etcd-prefix", "", "Prefix of keys in the external etcd cluster, so it could be shared with others.")
+	opt.flags.StringVar(&opt.ClusterEtcdCAFile, "cluster-etcd-ca-file", "", "Path to the CA certificate file to verify the external etcd cluster.")
+	opt.flags.StringVar(&opt.ClusterEtcdCertFile, "cluster-etcd-cert-file", "", "Path to the client certificate file for the external etcd cluster.")
+	opt.flags.StringVar(&opt.ClusterEtcdKeyFile, "cluster-etcd-key-file", "", "Path to the client key file for the external etcd cluster.")
 	opt.flags.StringVar(&opt.APIAddr, "api-addr", "localhost:2381", "Address([host]:port) to listen on for administration traffic.")
+	opt.flags.StringVar(&opt.GRPCAPIAddr, "grpc-api-addr", "", "Address([host]:port) to listen on for the admin API over gRPC, it's disabled if empty.")
+	opt.flags.StringVar(&opt.GossipAddr, "gossip-addr", "localhost:2383", "Address([host]:port) to listen on for gossiping shared counters with other members, it's also advertised to them, shared counters are local to the member if empty.")
+	opt.flags.StringVar(&opt.APIAuthFile, "api-auth-file", "", "Path to the file of users and roles of the admin API, authentication is disabled if empty.")
+	opt.flags.StringVar(&opt.APITLSCertFile, "api-tls-cert-file", "", "Path to the certificate file to serve the admin API over TLS, it's served in plaintext if empty.")
+	opt.flags.StringVar(&opt.APITLSKeyFile, "api-tls-key-file", "", "Path to the private key file to serve the admin API over TLS.")
+	opt.flags.StringVar(&opt.APITLSClientCAFile, "api-tls-client-ca-file", "", "Path to the CA certificate file to verify client certificates of the admin API, they're not requested if empty.")
+	opt.flags.BoolVar(&opt.APIRequireIfMatch, "api-require-if-match", true, "Require the header If-Match in the admin API updating or deleting a resource, so concurrent changes never overwrite each other, set it to false to make it optional.")
+	opt.flags.IntVar(&opt.PipelineVersions, "pipeline-versions", 10, "Number of versions of each pipeline spec kept for rollback, the history is disabled if it's 0.")
+	opt.flags.IntVar(&opt.ConfigHistory, "config-history", 50, "Number of revisions of the whole config kept for rollback, the history is disabled if it's 0.")
+	opt.flags.StringVar(&opt.ShutdownTimeout, "shutdown-timeout", "30s", "Max time to wait for the requests in flight to complete on shutdown.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
 
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
@@ -111,6 +171,17 @@ func New() *Options {
 	opt.flags.StringVar(&opt.WALDir, "wal-dir", "", "Path to the WAL directory.")
 	opt.flags.StringVar(&opt.LogDir, "log-dir", "log", "Path to the log directory.")
 	opt.flags.StringVar(&opt.MemberDir, "member-dir", "member", "Path to the member directory.")
+	opt.flags.StringVar(&opt.PluginDir, "plugin-dir", "", "Path to the directory of filter plugins(.so files), plugins are disabled if empty.")
+
+	opt.flags.StringVar(&opt.VaultAddr, "vault-addr", "", "Address of the Vault server to resolve secret references(vault:path#key) in object specs, VAULT_ADDR is used if empty.")
+	opt.flags.StringVar(&opt.VaultTokenFile, "vault-token-file", "", "Path to the file containing the Vault token, VAULT_TOKEN is used if empty.")
+	opt.flags.StringVar(&opt.VaultNamespace, "vault-namespace", "", "Vault namespace(Vault Enterprise only).")
+	opt.flags.StringVar(&opt.VaultRefreshInterval, "vault-refresh-interval", "5m", "Interval to refresh secrets without leases to detect rotation.")
+	opt.flags.StringVar(&opt.MasterKeyFile, "master-key-file", "", "Path to the file containing the base64 encoded 256-bit master key to encrypt sensitive fields of object specs, EG_MASTER_KEY is used if empty.")
+	opt.flags.StringVar(&opt.MasterKeyVaultTransit, "master-key-vault-transit", "", "Name of the Vault transit key to encrypt sensitive fields of object specs instead of the local master key.")
+
+	opt.flags.StringSliceVar(&opt.InterpolationEnvPrefixes, "interpolation-env-prefixes", nil, "Prefixes of environment variables allowed to be interpolated by ${ENV:NAME} in object specs, none is allowed if empty.")
+	opt.flags.StringSliceVar(&opt.InterpolationFileDirs, "interpolation-file-dirs", nil, "Directories of files allowed to be interpolated by ${file:/path} in object specs, none is allowed if empty.")
 
 	opt.flags.StringVar(&opt.CPUProfileFile, "cpu-profile-file", "", "Path to the CPU profile file.")
 	opt.flags.StringVar(&opt.MemoryProfileFile, "memory-profile-file", "", "Path to the memory profile file.")
@@ -195,9 +266,22 @@ func (opt *Options) Parse() (string, error) {
 	return "", nil
 }
 
+// UseExternalEtcd reports whether the config is stored in an external etcd
+// cluster instead of the embedded one.
+func (opt *Options) UseExternalEtcd() bool {
+	return len(opt.ClusterEtcdEndpoints) != 0
+}
+
 // adjust adjusts the options to handle conflict
 // between user's config and internal component.
 func (opt *Options) adjust() {
+	if opt.UseExternalEtcd() && opt.ClusterRole != "reader" {
+		fmt.Printf("cluster-role %s changed to reader because of cluster-etcd-endpoints\n",
+			opt.ClusterRole)
+		// NOTE: Readers don't start the embedded etcd.
+		opt.ClusterRole = "reader"
+	}
+
 	if opt.ClusterRole != "writer" {
 		return
 	}
@@ -225,14 +309,34 @@ func (opt *Options) validate() error {
 		return err
 	}
 
-	switch opt.ClusterRole {
-	case "reader":
+	switch {
+	case opt.UseExternalEtcd():
+		if opt.ForceNewCluster {
+			return fmt.Errorf("external etcd got force-new-cluster")
+		}
+
+		for _, endpoint := range opt.ClusterEtcdEndpoints {
+			_, err := url.Parse(endpoint)
+			if err != nil {
+				return fmt.Errorf("invalid cluster-etcd-endpoints: %s: %v", endpoint, err)
+			}
+		}
+
+		if (opt.ClusterEtcdCertFile == "") != (opt.ClusterEtcdKeyFile == "") {
+			return fmt.Errorf("cluster-etcd-cert-file and cluster-etcd-key-file must be specified together")
+		}
+
+		if opt.ClusterEtcdPrefix != "" && !strings.HasPrefix(opt.ClusterEtcdPrefix, "/") {
+			return fmt.Errorf("cluster-etcd-prefix must start with /")
+		}
+
+	case opt.ClusterRole == "reader":
 		if opt.ForceNewCluster {
 			return fmt.Errorf("reader got force-new-cluster")
 		}
 
-		if len(opt.ClusterJoinURLs) == 0 {
-			return fmt.Errorf("reader got empty cluster-join-urls")
+		if len(opt.ClusterJoinURLs) == 0 && opt.ClusterDiscovery == "" {
+			return fmt.Errorf("reader got empty cluster-join-urls and cluster-discovery")
 		}
 
 		for _, urlText := range opt.ClusterJoinURLs {
@@ -242,7 +346,7 @@ func (opt *Options) validate() error {
 			}
 		}
 
-	case "writer":
+	case opt.ClusterRole == "writer":
 		if len(opt.ClusterListenClientURLs) == 0 {
 			return fmt.Errorf("empty cluster-listen-client-urls")
 		}
@@ -293,20 +397,85 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid cluster-role(support writer, reader)")
 	}
 
+	if opt.NodeGroup != "" {
+		if err := common.ValidateName(opt.NodeGroup); err != nil {
+			return fmt.Errorf("invalid node-group: %v", err)
+		}
+	}
+
+	switch opt.ClusterDiscovery {
+	case "":
+	case "dns-srv", "kubernetes", "gce":
+		if opt.ClusterDiscoveryTarget == "" {
+			return fmt.Errorf("cluster-discovery %s got empty cluster-discovery-target",
+				opt.ClusterDiscovery)
+		}
+		if opt.ClusterDiscovery == "gce" && !strings.Contains(opt.ClusterDiscoveryTarget, "=") {
+			return fmt.Errorf("invalid cluster-discovery-target: %s: want label key=value",
+				opt.ClusterDiscoveryTarget)
+		}
+		if opt.ClusterDiscoveryExpect < 1 {
+			return fmt.Errorf("invalid cluster-discovery-expect: %d", opt.ClusterDiscoveryExpect)
+		}
+	default:
+		return fmt.Errorf("invalid cluster-discovery(support dns-srv, kubernetes, gce)")
+	}
+
 	_, err := time.ParseDuration(opt.ClusterRequestTimeout)
 	if err != nil {
 		return fmt.Errorf("invalid cluster-request-timeout: %v", err)
 	}
 
+	_, err = time.ParseDuration(opt.VaultRefreshInterval)
+	if err != nil {
+		return fmt.Errorf("invalid vault-refresh-interval: %v", err)
+	}
+
+	if opt.PipelineVersions < 0 {
+		return fmt.Errorf("invalid pipeline-versions: %d", opt.PipelineVersions)
+	}
+
+	if opt.ConfigHistory < 0 {
+		return fmt.Errorf("invalid config-history: %d", opt.ConfigHistory)
+	}
+
+	_, err = time.ParseDuration(opt.ShutdownTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid shutdown-timeout: %v", err)
+	}
+
+	if opt.MasterKeyFile != "" && opt.MasterKeyVaultTransit != "" {
+		return fmt.Errorf("both master-key-file and master-key-vault-transit are specified")
+	}
+
 	_, _, err = net.SplitHostPort(opt.APIAddr)
 	if err != nil {
 		return fmt.Errorf("invalid api-addr: %v", err)
 	}
+	if opt.GRPCAPIAddr != "" {
+		_, _, err = net.SplitHostPort(opt.GRPCAPIAddr)
+		if err != nil {
+			return fmt.Errorf("invalid grpc-api-addr: %v", err)
+		}
+	}
+	if opt.GossipAddr != "" {
+		_, _, err = net.SplitHostPort(opt.GossipAddr)
+		if err != nil {
+			return fmt.Errorf("invalid gossip-addr: %v", err)
+		}
+	}
 
 	if err != nil {
 		return fmt.Errorf("invalid api-url: %v", err)
 	}
 
+	if (opt.APITLSCertFile == "") != (opt.APITLSKeyFile == "") {
+		return fmt.Errorf("api-tls-cert-file and api-tls-key-file must be set together")
+	}
+	if opt.APITLSClientCAFile != "" && opt.APITLSCertFile == "" {
+		return fmt.Errorf("api-tls-client-ca-file requires api-tls-cert-file")
+	}
+
 	// dirs
 	if opt.HomeDir == "" {
 		return fmt.Errorf("empty home-dir")
@@ -359,6 +528,11 @@ func (opt *Options) prepare() error {
 		{dir: opt.WALDir, absDir: &opt.AbsWALDir},
 		{dir: opt.LogDir, absDir: &opt.AbsLogDir},
 		{dir: opt.MemberDir, absDir: &opt.AbsMemberDir},
+		{dir: opt.PluginDir, absDir: &opt.AbsPluginDir},
+		{dir: opt.APIAuthFile, absDir: &opt.AbsAPIAuthFile},
+		{dir: opt.APITLSCertFile, absDir: &opt.AbsAPITLSCertFile},
+		{dir: opt.APITLSKeyFile, absDir: &opt.AbsAPITLSKeyFile},
+		{dir: opt.APITLSClientCAFile, absDir: &opt.AbsAPITLSClientCAFile},
 	}
 	for _, di := range table {
 		if di.dir == "" {
@@ -19,10 +19,15 @@ package registry
 
 import (
 	// Objects
+	_ "github.com/megaease/easegress/pkg/object/bussubscriber"
+	_ "github.com/megaease/easegress/pkg/object/crontrigger"
 	_ "github.com/megaease/easegress/pkg/object/easemonitormetrics"
+	_ "github.com/megaease/easegress/pkg/object/federation"
 	_ "github.com/megaease/easegress/pkg/object/function"
+	_ "github.com/megaease/easegress/pkg/object/gitopssync"
 	_ "github.com/megaease/easegress/pkg/object/httppipeline"
 	_ "github.com/megaease/easegress/pkg/object/httpserver"
+	_ "github.com/megaease/easegress/pkg/object/ingresscontroller"
 	_ "github.com/megaease/easegress/pkg/object/meshcontroller"
 	_ "github.com/megaease/easegress/pkg/object/serviceregistry/consulserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/serviceregistry/etcdserviceregistry"
@@ -31,17 +36,49 @@ import (
 
 	// Filters
 	_ "github.com/megaease/easegress/pkg/filter/apiaggregator"
+	_ "github.com/megaease/easegress/pkg/filter/apikeyauth"
+	_ "github.com/megaease/easegress/pkg/filter/authcallout"
+	_ "github.com/megaease/easegress/pkg/filter/basicauth"
+	_ "github.com/megaease/easegress/pkg/filter/batcher"
+	_ "github.com/megaease/easegress/pkg/filter/botdetector"
 	_ "github.com/megaease/easegress/pkg/filter/bridge"
+	_ "github.com/megaease/easegress/pkg/filter/buffer"
+	_ "github.com/megaease/easegress/pkg/filter/bulkhead"
+	_ "github.com/megaease/easegress/pkg/filter/buspublisher"
 	_ "github.com/megaease/easegress/pkg/filter/circuitbreaker"
 	_ "github.com/megaease/easegress/pkg/filter/corsadaptor"
+	_ "github.com/megaease/easegress/pkg/filter/dedup"
+	_ "github.com/megaease/easegress/pkg/filter/digest"
+	_ "github.com/megaease/easegress/pkg/filter/execfilter"
+	_ "github.com/megaease/easegress/pkg/filter/extproc"
 	_ "github.com/megaease/easegress/pkg/filter/fallback"
+	_ "github.com/megaease/easegress/pkg/filter/geoip"
+	_ "github.com/megaease/easegress/pkg/filter/hmacauth"
+	_ "github.com/megaease/easegress/pkg/filter/injectiondetector"
+	_ "github.com/megaease/easegress/pkg/filter/jsfilter"
+	_ "github.com/megaease/easegress/pkg/filter/jwtauth"
+	_ "github.com/megaease/easegress/pkg/filter/keyedratelimiter"
+	_ "github.com/megaease/easegress/pkg/filter/ldapauth"
+	_ "github.com/megaease/easegress/pkg/filter/loadshedder"
+	_ "github.com/megaease/easegress/pkg/filter/luafilter"
+	_ "github.com/megaease/easegress/pkg/filter/mirror"
 	_ "github.com/megaease/easegress/pkg/filter/mock"
+	_ "github.com/megaease/easegress/pkg/filter/multipartparser"
+	_ "github.com/megaease/easegress/pkg/filter/oidcauth"
 	_ "github.com/megaease/easegress/pkg/filter/proxy"
 	_ "github.com/megaease/easegress/pkg/filter/ratelimiter"
+	_ "github.com/megaease/easegress/pkg/filter/redactor"
+	_ "github.com/megaease/easegress/pkg/filter/regexextractor"
 	_ "github.com/megaease/easegress/pkg/filter/remotefilter"
 	_ "github.com/megaease/easegress/pkg/filter/requestadaptor"
 	_ "github.com/megaease/easegress/pkg/filter/responseadaptor"
+	_ "github.com/megaease/easegress/pkg/filter/retry"
 	_ "github.com/megaease/easegress/pkg/filter/retryer"
+	_ "github.com/megaease/easegress/pkg/filter/splitter"
+	_ "github.com/megaease/easegress/pkg/filter/starlarkfilter"
 	_ "github.com/megaease/easegress/pkg/filter/timelimiter"
+	_ "github.com/megaease/easegress/pkg/filter/timeout"
 	_ "github.com/megaease/easegress/pkg/filter/validator"
+	_ "github.com/megaease/easegress/pkg/filter/waf"
+	_ "github.com/megaease/easegress/pkg/filter/wasmhost"
 )
@@ -0,0 +1,327 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sdk
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/crdt"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/tracing"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// Harness runs a plugin outside of pipelines for testing, the
+	// config is validated and the plugin is created as in pipelines.
+	Harness struct {
+		pluginType string
+		plugin     Plugin
+
+		flagsMutex sync.RWMutex
+		flags      map[string]bool
+
+		leasesMutex  sync.Mutex
+		leaseHolders map[string]*harnessLease
+
+		countersMutex sync.Mutex
+		counters      map[string]*harnessCounter
+	}
+
+	// harnessCounter is the counter in the memory of the harness, the
+	// counters of the same name share it, as if they converge at once.
+	harnessCounter struct {
+		h      *Harness
+		window time.Duration
+		state  *crdt.PNCounter
+	}
+
+	// harnessLease is the lease in the memory of the harness, it's held
+	// by at most one lease of the same name.
+	harnessLease struct {
+		h    *Harness
+		name string
+		// done is non-nil while it's held, and closed once it isn't.
+		done chan struct{}
+	}
+)
+
+// harnessMember is the member holding leases and adding to counters of
+// harnesses, and harnessOthers is the other members of it.
+const (
+	harnessMember = "harness"
+	harnessOthers = "others"
+)
+
+// closedChan is returned by Done of leases not held.
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// NewHarness creates a Harness running the plugin of the registered
+// plugin type with the config in YAML, as the filter spec in pipelines
+// without name and kind.
+func NewHarness(pluginType string, yamlConfig string) (*Harness, error) {
+	spec, f, err := newHarnessSpec(pluginType, yamlConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	plugin, err := f.pluginType.PluginCtor(spec.Name(), spec.FilterSpec())
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Harness{
+		pluginType:   pluginType,
+		plugin:       plugin,
+		flags:        map[string]bool{},
+		leaseHolders: map[string]*harnessLease{},
+		counters:     map[string]*harnessCounter{},
+	}
+	if fp, ok := plugin.(FlaggedPlugin); ok {
+		fp.SetFlags(h.flagEnabled)
+	}
+	if lp, ok := plugin.(LeasePlugin); ok {
+		lp.SetLeases(h.newLease)
+	}
+	if cp, ok := plugin.(CounterPlugin); ok {
+		cp.SetCounters(h.newCounter)
+	}
+
+	return h, nil
+}
+
+func newHarnessSpec(pluginType string, yamlConfig string) (*httppipeline.FilterSpec, *pluginFilter, error) {
+	config := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(yamlConfig), &config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unmarshal %s failed: %v", yamlConfig, err)
+	}
+
+	spec, err := httppipeline.NewFilterSpec(&httppipeline.FilterMetaSpec{
+		Name: "harness",
+		Kind: pluginType,
+	}, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, ok := spec.RootFilter().(*pluginFilter)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a plugin type", pluginType)
+	}
+
+	return spec, f, nil
+}
+
+// UpdateConfig updates the config of the plugin in place as hot reload
+// in pipelines, the plugin must be a ReconfigurablePlugin.
+func (h *Harness) UpdateConfig(yamlConfig string) error {
+	rp, ok := h.plugin.(ReconfigurablePlugin)
+	if !ok {
+		return fmt.Errorf("%s is not reconfigurable", h.pluginType)
+	}
+
+	spec, _, err := newHarnessSpec(h.pluginType, yamlConfig)
+	if err != nil {
+		return err
+	}
+
+	return rp.OnConfigUpdate(spec.FilterSpec())
+}
+
+// SetFlag enables or disables the feature flag for the plugin, as the
+// admin API sets it for the pipeline, all flags are disabled initially.
+func (h *Harness) SetFlag(flag string, enabled bool) {
+	h.flagsMutex.Lock()
+	defer h.flagsMutex.Unlock()
+	h.flags[flag] = enabled
+}
+
+func (h *Harness) flagEnabled(flag string) bool {
+	h.flagsMutex.RLock()
+	defer h.flagsMutex.RUnlock()
+	return h.flags[flag]
+}
+
+func (h *Harness) newLease(name string, ttl time.Duration) (Lease, error) {
+	if ttl < time.Second {
+		return nil, fmt.Errorf("ttl of lease %s must be at least 1s", name)
+	}
+	return &harnessLease{h: h, name: name}, nil
+}
+
+// LoseLease makes the lease of the name lost by its holder, as if it
+// can't be kept alive in the cluster, so the plugin waiting for it takes
+// over.
+func (h *Harness) LoseLease(name string) {
+	h.leasesMutex.Lock()
+	defer h.leasesMutex.Unlock()
+	h.dropLease(name)
+}
+
+// dropLease drops the holder of the lease, the caller must hold the lock.
+func (h *Harness) dropLease(name string) {
+	if l := h.leaseHolders[name]; l != nil {
+		delete(h.leaseHolders, name)
+		close(l.done)
+		l.done = nil
+	}
+}
+
+func (l *harnessLease) Acquire(ctx stdcontext.Context) error {
+	for {
+		l.h.leasesMutex.Lock()
+		holder := l.h.leaseHolders[l.name]
+		if holder == nil {
+			l.done = make(chan struct{})
+			l.h.leaseHolders[l.name] = l
+		}
+		if holder == nil || holder == l {
+			l.h.leasesMutex.Unlock()
+			return nil
+		}
+		done := holder.done
+		l.h.leasesMutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+		}
+	}
+}
+
+func (l *harnessLease) Done() <-chan struct{} {
+	l.h.leasesMutex.Lock()
+	defer l.h.leasesMutex.Unlock()
+
+	if l.done == nil {
+		return closedChan
+	}
+	return l.done
+}
+
+func (l *harnessLease) Holder() (string, error) {
+	l.h.leasesMutex.Lock()
+	defer l.h.leasesMutex.Unlock()
+
+	if l.h.leaseHolders[l.name] == nil {
+		return "", nil
+	}
+	return harnessMember, nil
+}
+
+func (l *harnessLease) Release() error {
+	l.h.leasesMutex.Lock()
+	defer l.h.leasesMutex.Unlock()
+
+	if l.h.leaseHolders[l.name] == l {
+		l.h.dropLease(l.name)
+	}
+	return nil
+}
+
+func (h *Harness) newCounter(name string, window time.Duration) (Counter, error) {
+	if window < 0 {
+		return nil, fmt.Errorf("window of counter %s must not be negative", name)
+	}
+
+	h.countersMutex.Lock()
+	defer h.countersMutex.Unlock()
+
+	c := h.counters[name]
+	if c == nil {
+		c = &harnessCounter{h: h, window: window, state: crdt.NewPNCounter(crdt.WindowOf(time.Now(), window))}
+		h.counters[name] = c
+	}
+	return c, nil
+}
+
+// AddToCounter adds the delta to the counter of the name as if other
+// members add to it, it's seen by the plugin at once.
+func (h *Harness) AddToCounter(name string, delta int64) error {
+	h.countersMutex.Lock()
+	defer h.countersMutex.Unlock()
+
+	c := h.counters[name]
+	if c == nil {
+		return fmt.Errorf("counter %s not found", name)
+	}
+	c.state.Roll(crdt.WindowOf(time.Now(), c.window))
+	c.state.Add(harnessOthers, delta)
+	return nil
+}
+
+func (c *harnessCounter) Add(delta int64) {
+	c.h.countersMutex.Lock()
+	defer c.h.countersMutex.Unlock()
+
+	c.state.Roll(crdt.WindowOf(time.Now(), c.window))
+	c.state.Add(harnessMember, delta)
+}
+
+func (c *harnessCounter) Value() int64 {
+	c.h.countersMutex.Lock()
+	defer c.h.countersMutex.Unlock()
+
+	c.state.Roll(crdt.WindowOf(time.Now(), c.window))
+	return c.state.Value()
+}
+
+// Handle handles the request by the plugin, and returns the task for
+// checking the request and response after handling, and the result.
+func (h *Harness) Handle(r *http.Request) (Task, string) {
+	task := context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")
+	task.SetHandlerCaller(func(lastResult string) string { return lastResult })
+
+	return task, h.plugin.Handle(task)
+}
+
+// State returns the state of the plugin, which must be a StatePlugin.
+func (h *Harness) State() (interface{}, error) {
+	sp, ok := h.plugin.(StatePlugin)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't report state", h.pluginType)
+	}
+
+	return sp.State(), nil
+}
+
+// Close drains and closes the plugin, and releases its leases.
+func (h *Harness) Close() {
+	if dp, ok := h.plugin.(DrainablePlugin); ok {
+		dp.OnDrain()
+	}
+	h.plugin.Close()
+
+	h.leasesMutex.Lock()
+	defer h.leasesMutex.Unlock()
+	for name := range h.leaseHolders {
+		h.dropLease(name)
+	}
+}
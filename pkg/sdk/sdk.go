@@ -0,0 +1,448 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sdk is the stable surface to develop filters out of the tree,
+// the filters could be compiled into Easegress or loaded from plugins.
+//
+// A plugin type is registered by RegisterPluginType, Easegress creates a
+// Config by the config constructor for every filter in pipelines, and
+// creates a Plugin by the plugin constructor with the validated Config.
+package sdk
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/common"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/crdt"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Version is the version of the SDK, it is bumped once the SDK
+	// changes incompatibly.
+	Version = "v1"
+
+	// ResultInitFailed is the result of plugins failed to be created,
+	// it is added to results of all plugin types.
+	ResultInitFailed = "initFailed"
+)
+
+type (
+	// Task is the task handled by plugins, it carries the HTTP request
+	// and response.
+	Task = context.HTTPContext
+
+	// Config is the config of a plugin. It must be a pointer to a struct
+	// with yaml and jsonschema tags, and it is validated by its method
+	// `Validate() error` if there is.
+	Config interface{}
+
+	// Plugin handles tasks.
+	Plugin interface {
+		// Handle handles the task, the result must be empty or one of
+		// the results of the plugin type. Plugins must not call the
+		// next handler of the task, it is called by the SDK.
+		Handle(task Task) (result string)
+
+		// Close closes the plugin.
+		Close()
+	}
+
+	// StatusPlugin is the plugin reporting its runtime status.
+	StatusPlugin interface {
+		Plugin
+
+		// Status returns the runtime status.
+		Status() interface{}
+	}
+
+	// StatePlugin is the plugin reporting its live internal state on
+	// demand, e.g. its connections or buffers.
+	StatePlugin interface {
+		Plugin
+
+		// State returns the state at the moment, it's called while the
+		// plugin may be handling tasks concurrently.
+		State() interface{}
+	}
+
+	// ReconfigurablePlugin is the plugin updating its config in place on
+	// hot reload, instead of being replaced by a new plugin, e.g. to keep
+	// its consumers or connections.
+	ReconfigurablePlugin interface {
+		Plugin
+
+		// OnConfigUpdate updates the config of the plugin, which may be
+		// handling tasks concurrently. The plugin is replaced by a new one
+		// created with the config if it returns an error.
+		OnConfigUpdate(config Config) error
+	}
+
+	// DrainablePlugin is the plugin stopping accepting work before being
+	// closed on hot reload or deleting.
+	DrainablePlugin interface {
+		Plugin
+
+		// OnDrain stops accepting new work and finishes the work in
+		// flight, Close is called after the tasks in flight complete.
+		OnDrain()
+	}
+
+	// Flags reports whether the feature flag of the pipeline running the
+	// plugin is enabled, flags are set by the admin API at runtime.
+	Flags func(flag string) bool
+
+	// FlaggedPlugin is the plugin querying the feature flags of its
+	// pipeline, e.g. to switch to a risky behavior gradually.
+	FlaggedPlugin interface {
+		Plugin
+
+		// SetFlags is called once after the plugin is created and before
+		// it handles tasks, flags should be queried for every task
+		// instead of being cached, since they change at runtime.
+		SetFlags(flags Flags)
+	}
+
+	// Lease is a cluster wide lease held by at most one member at a time,
+	// it expires in its TTL if the holder is down, so another member
+	// waiting for it takes over.
+	Lease = cluster.Lease
+
+	// Leases creates the lease of the name, which is shared by the
+	// plugins of the pipeline in all members. The TTL is how long it
+	// takes to fail over after the holder is down, at least 1s.
+	Leases func(name string, ttl time.Duration) (Lease, error)
+
+	// LeasePlugin is the plugin doing the work which only one member
+	// should do at a time, e.g. firing a scheduled job or polling a
+	// remote directory.
+	LeasePlugin interface {
+		Plugin
+
+		// SetLeases is called once after the plugin is created and
+		// before it handles tasks, the leases created by it are released
+		// after it's closed.
+		SetLeases(leases Leases)
+	}
+
+	// Counter is a counter shared by members of the cluster, it's changed
+	// locally and converges in all members in the background, so its
+	// value is approximate.
+	Counter = crdt.Counter
+
+	// Counters creates the counter of the name, which is shared by the
+	// plugins of the pipeline in all members. It's reset at the start of
+	// every window aligned to the Unix epoch, or never if the window is 0.
+	Counters func(name string, window time.Duration) (Counter, error)
+
+	// CounterPlugin is the plugin enforcing approximate limits across
+	// members, e.g. global rate limits or quotas, without touching the
+	// cluster for every task.
+	CounterPlugin interface {
+		Plugin
+
+		// SetCounters is called once after the plugin is created and
+		// before it handles tasks, the counters created by it stop
+		// converging after it's closed.
+		SetCounters(counters Counters)
+	}
+
+	// ConfigCtor creates a Config with default values.
+	ConfigCtor func() Config
+
+	// PluginCtor creates a Plugin of the name with the validated Config.
+	PluginCtor func(name string, config Config) (Plugin, error)
+
+	// PluginType describes a plugin type.
+	PluginType struct {
+		Name        string
+		Description string
+		Results     []string
+		ConfigCtor  ConfigCtor
+		PluginCtor  PluginCtor
+	}
+
+	// pluginFilter adapts plugin types to filters.
+	pluginFilter struct {
+		pluginType *PluginType
+		results    []string
+
+		pipeSpec *httppipeline.FilterSpec
+		plugin   Plugin
+		err      error
+
+		// clusterMutex guards the leases and counters in the cluster.
+		clusterMutex sync.Mutex
+		leases       []Lease
+		counters     []*crdt.SharedCounter
+	}
+)
+
+var (
+	collectMutex sync.Mutex
+
+	collectingMutex sync.Mutex
+	collecting      bool
+	collected       []httppipeline.Filter
+)
+
+// RegisterPluginType registers the plugin type of the name.
+func RegisterPluginType(name string, configCtor ConfigCtor, pluginCtor PluginCtor) error {
+	return Register(&PluginType{
+		Name:       name,
+		ConfigCtor: configCtor,
+		PluginCtor: pluginCtor,
+	})
+}
+
+// Register registers the plugin type.
+func Register(pt *PluginType) error {
+	if pt.ConfigCtor == nil || pt.PluginCtor == nil {
+		return fmt.Errorf("%s: constructors are required", pt.Name)
+	}
+	for _, result := range pt.Results {
+		if result == "" || result == ResultInitFailed {
+			return fmt.Errorf("%s: result %q is reserved", pt.Name, result)
+		}
+	}
+
+	f := &pluginFilter{
+		pluginType: pt,
+		results:    append(append([]string{}, pt.Results...), ResultInitFailed),
+	}
+
+	collectingMutex.Lock()
+	if collecting {
+		collected = append(collected, f)
+		collectingMutex.Unlock()
+		return nil
+	}
+	collectingMutex.Unlock()
+
+	return httppipeline.TryRegister(f)
+}
+
+// CollectPluginTypes runs fn and returns the filters of plugin types
+// registered during it, instead of registering them. It is used by
+// plugin loaders to take over the registering.
+func CollectPluginTypes(fn func()) []httppipeline.Filter {
+	collectMutex.Lock()
+	defer collectMutex.Unlock()
+
+	collectingMutex.Lock()
+	collecting, collected = true, nil
+	collectingMutex.Unlock()
+
+	defer func() {
+		collectingMutex.Lock()
+		collecting, collected = false, nil
+		collectingMutex.Unlock()
+	}()
+
+	fn()
+
+	collectingMutex.Lock()
+	defer collectingMutex.Unlock()
+	return collected
+}
+
+// Kind returns the kind of the plugin type.
+func (f *pluginFilter) Kind() string {
+	if f.pluginType == nil {
+		return ""
+	}
+	return f.pluginType.Name
+}
+
+// DefaultSpec returns the default config of the plugin type.
+func (f *pluginFilter) DefaultSpec() interface{} {
+	return f.pluginType.ConfigCtor()
+}
+
+// Description returns the description of the plugin type.
+func (f *pluginFilter) Description() string {
+	return f.pluginType.Description
+}
+
+// Results returns the results of the plugin type.
+func (f *pluginFilter) Results() []string {
+	return f.results
+}
+
+// Init creates the plugin.
+func (f *pluginFilter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	// NOTE: The pipeline creates the zero value of the root filter,
+	// so the plugin type comes from the root filter.
+	root := pipeSpec.RootFilter().(*pluginFilter)
+	f.pluginType, f.results, f.pipeSpec = root.pluginType, root.results, pipeSpec
+
+	f.plugin, f.err = f.pluginType.PluginCtor(pipeSpec.Name(), pipeSpec.FilterSpec())
+	if f.err != nil {
+		logger.Errorf("%s: create plugin %s failed: %v", pipeSpec.Name(), f.pluginType.Name, f.err)
+		return
+	}
+	if fp, ok := f.plugin.(FlaggedPlugin); ok {
+		fp.SetFlags(pipeSpec.FlagEnabled)
+	}
+
+	var cls cluster.Cluster
+	var gossiper *crdt.Gossiper
+	if super != nil {
+		cls, gossiper = super.Cluster(), crdt.Global
+	}
+	if lp, ok := f.plugin.(LeasePlugin); ok {
+		lp.SetLeases(f.leasesOf(cls))
+	}
+	if cp, ok := f.plugin.(CounterPlugin); ok {
+		cp.SetCounters(f.countersOf(gossiper))
+	}
+}
+
+// leasesOf returns the Leases creating leases of the pipeline in the
+// cluster, they're released after the plugin is closed.
+func (f *pluginFilter) leasesOf(cls cluster.Cluster) Leases {
+	return func(name string, ttl time.Duration) (Lease, error) {
+		if cls == nil {
+			return nil, fmt.Errorf("cluster is unavailable")
+		}
+		if common.ValidateName(name) != nil {
+			return nil, fmt.Errorf("invalid lease name %s", name)
+		}
+
+		lease, err := cls.Lease(cls.Layout().PluginLease(f.pipeSpec.Pipeline(), name), ttl)
+		if err != nil {
+			return nil, err
+		}
+
+		f.clusterMutex.Lock()
+		f.leases = append(f.leases, lease)
+		f.clusterMutex.Unlock()
+
+		return lease, nil
+	}
+}
+
+// Inherit creates a new plugin, the previous one is closed by the pipeline.
+func (f *pluginFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	f.Init(pipeSpec, super)
+}
+
+// countersOf returns the Counters creating counters of the pipeline shared
+// by the gossiper, they're closed after the plugin is closed.
+func (f *pluginFilter) countersOf(g *crdt.Gossiper) Counters {
+	return func(name string, window time.Duration) (Counter, error) {
+		if g == nil {
+			return nil, fmt.Errorf("gossiper is unavailable")
+		}
+		if common.ValidateName(name) != nil {
+			return nil, fmt.Errorf("invalid counter name %s", name)
+		}
+		if window < 0 {
+			return nil, fmt.Errorf("window of counter %s must not be negative", name)
+		}
+
+		counter := crdt.NewSharedCounter(g, f.pipeSpec.Pipeline()+"/"+name, window)
+
+		f.clusterMutex.Lock()
+		f.counters = append(f.counters, counter)
+		f.clusterMutex.Unlock()
+
+		return counter, nil
+	}
+}
+
+// OnConfigUpdate updates the config of the plugin in place if it's a
+// ReconfigurablePlugin.
+func (f *pluginFilter) OnConfigUpdate(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) error {
+	rp, ok := f.plugin.(ReconfigurablePlugin)
+	if !ok || f.err != nil {
+		return httppipeline.ErrNotReconfigurable
+	}
+
+	err := rp.OnConfigUpdate(pipeSpec.FilterSpec())
+	if err != nil {
+		return err
+	}
+	f.pipeSpec = pipeSpec
+
+	return nil
+}
+
+// OnDrain drains the plugin if it's a DrainablePlugin.
+func (f *pluginFilter) OnDrain() {
+	if dp, ok := f.plugin.(DrainablePlugin); ok {
+		dp.OnDrain()
+	}
+}
+
+// Handle handles the task by the plugin.
+func (f *pluginFilter) Handle(ctx context.HTTPContext) string {
+	if f.err != nil {
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		ctx.AddTag(stringtool.Cat(f.pluginType.Name, ": ", f.err.Error()))
+		return ctx.CallNextHandler(ResultInitFailed)
+	}
+
+	return ctx.CallNextHandler(f.plugin.Handle(ctx))
+}
+
+// Status returns the status of the plugin.
+func (f *pluginFilter) Status() interface{} {
+	if sp, ok := f.plugin.(StatusPlugin); ok {
+		return sp.Status()
+	}
+	return nil
+}
+
+// State returns the state of the plugin if it's a StatePlugin.
+func (f *pluginFilter) State() interface{} {
+	if sp, ok := f.plugin.(StatePlugin); ok {
+		return sp.State()
+	}
+	return nil
+}
+
+// Close closes the plugin, releases its leases and closes its counters.
+func (f *pluginFilter) Close() {
+	if f.plugin != nil {
+		f.plugin.Close()
+	}
+
+	f.clusterMutex.Lock()
+	defer f.clusterMutex.Unlock()
+	for _, lease := range f.leases {
+		if err := lease.Release(); err != nil {
+			logger.Errorf("%s: release lease failed: %v", f.pipeSpec.Pipeline(), err)
+		}
+	}
+	f.leases = nil
+
+	for _, counter := range f.counters {
+		counter.Close()
+	}
+	f.counters = nil
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sdk
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+type (
+	echoConfig struct {
+		Header string `yaml:"header" jsonschema:"required"`
+		Value  string `yaml:"value" jsonschema:"omitempty"`
+	}
+
+	echoPlugin struct {
+		config   *echoConfig
+		flags    Flags
+		leases   Leases
+		counters Counters
+	}
+)
+
+func (c echoConfig) Validate() error {
+	if c.Value == "invalid" {
+		return fmt.Errorf("invalid value")
+	}
+	return nil
+}
+
+func (p *echoPlugin) Handle(task Task) string {
+	value := task.Request().Header().Get(p.config.Header)
+	if value == "" {
+		return "missing"
+	}
+	if p.flags("shout") {
+		value += "!"
+	}
+	task.Response().Header().Set(p.config.Header, value+p.config.Value)
+	return ""
+}
+
+func (p *echoPlugin) SetFlags(flags Flags) {
+	p.flags = flags
+}
+
+func (p *echoPlugin) SetLeases(leases Leases) {
+	p.leases = leases
+}
+
+func (p *echoPlugin) SetCounters(counters Counters) {
+	p.counters = counters
+}
+
+func (p *echoPlugin) OnConfigUpdate(config Config) error {
+	p.config = config.(*echoConfig)
+	return nil
+}
+
+func (p *echoPlugin) Close() {}
+
+func init() {
+	err := Register(&PluginType{
+		Name:       "SDKTestEcho",
+		Results:    []string{"missing"},
+		ConfigCtor: func() Config { return &echoConfig{Value: "-echo"} },
+		PluginCtor: func(name string, config Config) (Plugin, error) {
+			return &echoPlugin{config: config.(*echoConfig)}, nil
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestHarness(t *testing.T) {
+	h, err := NewHarness("SDKTestEcho", "header: X-Echo")
+	if err != nil {
+		t.Fatalf("new harness failed: %v", err)
+	}
+	defer h.Close()
+
+	r, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	task, result := h.Handle(r)
+	if result != "missing" {
+		t.Errorf("want result missing, got %q", result)
+	}
+
+	r.Header.Set("X-Echo", "hello")
+	task, result = h.Handle(r)
+	if result != "" {
+		t.Errorf("want empty result, got %q", result)
+	}
+	if got := task.Response().Header().Get("X-Echo"); got != "hello-echo" {
+		t.Errorf("want header hello-echo, got %q", got)
+	}
+}
+
+func TestHarnessFlags(t *testing.T) {
+	h, err := NewHarness("SDKTestEcho", "header: X-Echo")
+	if err != nil {
+		t.Fatalf("new harness failed: %v", err)
+	}
+	defer h.Close()
+
+	r, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	r.Header.Set("X-Echo", "hello")
+	h.SetFlag("shout", true)
+	task, _ := h.Handle(r)
+	if got := task.Response().Header().Get("X-Echo"); got != "hello!-echo" {
+		t.Errorf("want header hello!-echo, got %q", got)
+	}
+
+	h.SetFlag("shout", false)
+	task, _ = h.Handle(r)
+	if got := task.Response().Header().Get("X-Echo"); got != "hello-echo" {
+		t.Errorf("want header hello-echo, got %q", got)
+	}
+}
+
+func TestHarnessLeases(t *testing.T) {
+	h, err := NewHarness("SDKTestEcho", "header: X-Echo")
+	if err != nil {
+		t.Fatalf("new harness failed: %v", err)
+	}
+	defer h.Close()
+
+	leases := h.plugin.(*echoPlugin).leases
+	if _, err := leases("job", time.Millisecond); err == nil {
+		t.Errorf("want error for ttl less than 1s")
+	}
+	first, _ := leases("job", time.Second)
+	second, _ := leases("job", time.Second)
+
+	if err := first.Acquire(stdcontext.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	if holder, _ := second.Holder(); holder != harnessMember {
+		t.Errorf("want holder %s, got %q", harnessMember, holder)
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := second.Acquire(ctx); err == nil {
+		t.Errorf("want error acquiring the held lease")
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- second.Acquire(stdcontext.Background())
+	}()
+	h.LoseLease("job")
+	select {
+	case <-first.Done():
+	default:
+		t.Errorf("want the lost lease done")
+	}
+	if err := <-acquired; err != nil {
+		t.Errorf("acquire after failover failed: %v", err)
+	}
+
+	if err := second.Release(); err != nil {
+		t.Errorf("release failed: %v", err)
+	}
+	if holder, _ := first.Holder(); holder != "" {
+		t.Errorf("want no holder, got %q", holder)
+	}
+}
+
+func TestHarnessCounters(t *testing.T) {
+	h, err := NewHarness("SDKTestEcho", "header: X-Echo")
+	if err != nil {
+		t.Fatalf("new harness failed: %v", err)
+	}
+	defer h.Close()
+
+	counters := h.plugin.(*echoPlugin).counters
+	if _, err := counters("requests", -time.Second); err == nil {
+		t.Errorf("want error for negative window")
+	}
+	if err := h.AddToCounter("requests", 1); err == nil {
+		t.Errorf("want error for unknown counter")
+	}
+
+	counter, _ := counters("requests", time.Hour)
+	counter.Add(2)
+	if err := h.AddToCounter("requests", 3); err != nil {
+		t.Fatalf("add to counter failed: %v", err)
+	}
+	if v := counter.Value(); v != 5 {
+		t.Errorf("want 5, got %d", v)
+	}
+
+	same, _ := counters("requests", time.Hour)
+	same.Add(-1)
+	if v := counter.Value(); v != 4 {
+		t.Errorf("want 4, got %d", v)
+	}
+}
+
+func TestHarnessUpdateConfig(t *testing.T) {
+	h, err := NewHarness("SDKTestEcho", "header: X-Echo")
+	if err != nil {
+		t.Fatalf("new harness failed: %v", err)
+	}
+	defer h.Close()
+
+	if err := h.UpdateConfig("header: X-Echo\nvalue: invalid"); err == nil {
+		t.Errorf("want error for invalid config")
+	}
+	if err := h.UpdateConfig("header: X-Echo\nvalue: -updated"); err != nil {
+		t.Fatalf("update config failed: %v", err)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	r.Header.Set("X-Echo", "hello")
+	task, _ := h.Handle(r)
+	if got := task.Response().Header().Get("X-Echo"); got != "hello-updated" {
+		t.Errorf("want header hello-updated, got %q", got)
+	}
+}
+
+func TestHarnessInvalidConfig(t *testing.T) {
+	for _, config := range []string{
+		"value: -echo",
+		"header: X-Echo\nvalue: invalid",
+		"header: [",
+	} {
+		_, err := NewHarness("SDKTestEcho", config)
+		if err == nil {
+			t.Errorf("want error for config %q", config)
+		}
+	}
+
+	_, err := NewHarness("SDKTestUnknown", "header: X-Echo")
+	if err == nil {
+		t.Errorf("want error for unknown plugin type")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	ctors := PluginType{
+		ConfigCtor: func() Config { return &echoConfig{} },
+		PluginCtor: func(name string, config Config) (Plugin, error) { return &echoPlugin{}, nil },
+	}
+
+	tests := []struct {
+		name    string
+		results []string
+		wantErr bool
+	}{
+		{name: "SDKTestEcho", wantErr: true},
+		{name: "SDKTestReserved", results: []string{ResultInitFailed}, wantErr: true},
+		{name: "SDKTestEmpty", results: []string{""}, wantErr: true},
+		{name: "SDKTestRepeated", results: []string{"a", "a"}, wantErr: true},
+		{name: "SDKTestOK", results: []string{"a"}},
+	}
+
+	for _, tc := range tests {
+		pt := ctors
+		pt.Name, pt.Results = tc.name, tc.results
+		err := Register(&pt)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: want error %v, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+
+	if _, exists := httppipeline.GetFilterRegistry()["SDKTestOK"]; !exists {
+		t.Errorf("SDKTestOK is not registered")
+	}
+}
+
+func TestCollectPluginTypes(t *testing.T) {
+	filters := CollectPluginTypes(func() {
+		err := RegisterPluginType("SDKTestCollected",
+			func() Config { return &echoConfig{} },
+			func(name string, config Config) (Plugin, error) { return &echoPlugin{}, nil })
+		if err != nil {
+			t.Errorf("register failed: %v", err)
+		}
+	})
+
+	if len(filters) != 1 || filters[0].Kind() != "SDKTestCollected" {
+		t.Fatalf("want collected SDKTestCollected, got %v", filters)
+	}
+	if _, exists := httppipeline.GetFilterRegistry()["SDKTestCollected"]; exists {
+		t.Errorf("collected plugin type should not be registered")
+	}
+}
@@ -0,0 +1,518 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// EncryptedPrefix is the prefix of encrypted values of sensitive fields.
+	EncryptedPrefix = "encrypted:v1:"
+
+	// Redacted replaces plaintext values of sensitive fields in outputs.
+	Redacted = "******"
+
+	masterKeyEnv = "EG_MASTER_KEY"
+
+	keyProviderLocal = "local"
+	keyProviderVault = "vault"
+)
+
+type (
+	// keyWrapper wraps data keys by the master key, it's the key
+	// encryption key of the envelope encryption.
+	keyWrapper interface {
+		provider() string
+		wrap(dataKey []byte) ([]byte, error)
+		unwrap(wrapped []byte) ([]byte, error)
+	}
+
+	// localKeyWrapper wraps data keys by a local master key.
+	localKeyWrapper struct {
+		aead cipher.AEAD
+	}
+
+	// vaultKeyWrapper wraps data keys by a key of the Vault transit
+	// secrets engine, so the master key never leaves Vault.
+	vaultKeyWrapper struct {
+		vault *vaultClient
+		key   string
+	}
+)
+
+var (
+	sensitiveFieldsMutex sync.RWMutex
+	sensitiveFields      = map[string]struct{}{}
+)
+
+// RegisterSensitiveFields marks fields of specs as sensitive by their
+// YAML names, string values of them, or strings in lists of them, are
+// encrypted in the config store and redacted in outputs. Packages owning
+// the fields should call it in init().
+func RegisterSensitiveFields(names ...string) {
+	sensitiveFieldsMutex.Lock()
+	defer sensitiveFieldsMutex.Unlock()
+
+	for _, name := range names {
+		sensitiveFields[name] = struct{}{}
+	}
+}
+
+// IsSensitiveField reports whether the field is sensitive.
+func IsSensitiveField(name string) bool {
+	sensitiveFieldsMutex.RLock()
+	defer sensitiveFieldsMutex.RUnlock()
+
+	_, exists := sensitiveFields[name]
+	return exists
+}
+
+// IsEncrypted reports whether s is an encrypted value.
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, EncryptedPrefix)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, data[:n], data[n:], nil)
+}
+
+func newLocalKeyWrapper(filename string) (*localKeyWrapper, error) {
+	text := os.Getenv(masterKeyEnv)
+	if filename != "" {
+		buff, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("read master key file failed: %v", err)
+		}
+		text = string(buff)
+	}
+	if text == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("decode master key failed: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 256 bits, got %d bits", len(key)*8)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &localKeyWrapper{aead: aead}, nil
+}
+
+func (w *localKeyWrapper) provider() string { return keyProviderLocal }
+
+func (w *localKeyWrapper) wrap(dataKey []byte) ([]byte, error) {
+	return seal(w.aead, dataKey)
+}
+
+func (w *localKeyWrapper) unwrap(wrapped []byte) ([]byte, error) {
+	return open(w.aead, wrapped)
+}
+
+func (w *vaultKeyWrapper) provider() string { return keyProviderVault }
+
+func (w *vaultKeyWrapper) wrap(dataKey []byte) ([]byte, error) {
+	vr, err := w.vault.do(http.MethodPost, "transit/encrypt/"+w.key, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(dataKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, _ := vr.Data["ciphertext"].(string)
+	if ciphertext == "" {
+		return nil, fmt.Errorf("no ciphertext in vault response")
+	}
+	return []byte(ciphertext), nil
+}
+
+func (w *vaultKeyWrapper) unwrap(wrapped []byte) ([]byte, error) {
+	vr, err := w.vault.do(http.MethodPost, "transit/decrypt/"+w.key, map[string]interface{}{
+		"ciphertext": string(wrapped),
+	})
+	if err != nil {
+		return nil, err
+	}
+	plaintext, _ := vr.Data["plaintext"].(string)
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// dataKey returns the plaintext data key of the wrapped one, unwrapped
+// data keys are cached since specs are decrypted on every change.
+func (m *Manager) dataKey(provider string, wrapped []byte) ([]byte, error) {
+	if m.wrapper == nil {
+		return nil, fmt.Errorf("master key is not configured")
+	}
+	if m.wrapper.provider() != provider {
+		return nil, fmt.Errorf("value was encrypted by the %s master key, but the %s one is configured",
+			provider, m.wrapper.provider())
+	}
+
+	m.dataKeysMutex.Lock()
+	defer m.dataKeysMutex.Unlock()
+
+	if key, exists := m.dataKeys[string(wrapped)]; exists {
+		return key, nil
+	}
+
+	key, err := m.wrapper.unwrap(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key failed: %v", err)
+	}
+	m.dataKeys[string(wrapped)] = key
+	return key, nil
+}
+
+func (m *Manager) decrypt(value string) (string, error) {
+	fields := strings.Split(strings.TrimPrefix(value, EncryptedPrefix), ":")
+	if len(fields) != 3 {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %v", err)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(fields[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %v", err)
+	}
+
+	key, err := m.dataKey(fields[0], wrapped)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, data)
+	if err != nil {
+		return "", fmt.Errorf("decrypt failed: %v", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptYAML encrypts plaintext values of sensitive fields in the YAML
+// config by the global Manager with a new data key. The config is
+// returned as it is if no master key is configured or nothing to encrypt.
+func EncryptYAML(config string) (string, error) {
+	m := Global
+	if m == nil || m.wrapper == nil {
+		return config, nil
+	}
+	return m.encryptYAML(config)
+}
+
+func (m *Manager) encryptYAML(config string) (string, error) {
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	var aead cipher.AEAD
+	var prefix string
+	encrypt := func(s string) (string, error) {
+		if aead == nil {
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return "", err
+			}
+			wrapped, err := m.wrapper.wrap(key)
+			if err != nil {
+				return "", fmt.Errorf("wrap data key failed: %v", err)
+			}
+			aead, err = newAEAD(key)
+			if err != nil {
+				return "", err
+			}
+			prefix = EncryptedPrefix + m.wrapper.provider() + ":" +
+				base64.RawURLEncoding.EncodeToString(wrapped) + ":"
+		}
+
+		data, err := seal(aead, []byte(s))
+		if err != nil {
+			return "", err
+		}
+		return prefix + base64.RawURLEncoding.EncodeToString(data), nil
+	}
+
+	changed, err := transformSensitive(doc, encrypt)
+	if err != nil || !changed {
+		return config, err
+	}
+
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("marshal failed: %v", err)
+	}
+	return string(buff), nil
+}
+
+// DecryptYAML decrypts encrypted values in the YAML config by the global
+// Manager, secret references are kept. The config is returned as it is
+// if nothing is encrypted.
+func DecryptYAML(config string) (string, error) {
+	if !strings.Contains(config, EncryptedPrefix) {
+		return config, nil
+	}
+
+	m := Global
+	if m == nil {
+		m = &Manager{}
+	}
+
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal failed: %v", err)
+	}
+	doc, err = m.decryptValue(doc)
+	if err != nil {
+		return "", err
+	}
+
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("marshal failed: %v", err)
+	}
+	return string(buff), nil
+}
+
+func (m *Manager) decryptValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if IsEncrypted(v) {
+			return m.decrypt(v)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			decrypted, err := m.decryptValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = decrypted
+		}
+	case []interface{}:
+		for i, item := range v {
+			decrypted, err := m.decryptValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = decrypted
+		}
+	}
+
+	return value, nil
+}
+
+// RedactYAML replaces plaintext values of sensitive fields in the YAML
+// config, encrypted values and secret references are kept. The config is
+// returned as it is if it's invalid or nothing to redact.
+func RedactYAML(config string) string {
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return config
+	}
+
+	changed, _ := transformSensitive(doc, func(string) (string, error) {
+		return Redacted, nil
+	})
+	if !changed {
+		return config
+	}
+
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		return config
+	}
+	return string(buff)
+}
+
+// RestoreRedactedYAML replaces the redacted values of sensitive fields in
+// the YAML config with the values at the same places in the current one,
+// so a redacted config read from the API could be written back as it is.
+// The config is returned as it is if nothing to restore.
+func RestoreRedactedYAML(config, current string) (string, error) {
+	if !strings.Contains(config, Redacted) {
+		return config, nil
+	}
+
+	var doc, currentDoc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal failed: %v", err)
+	}
+	err = yaml.Unmarshal([]byte(current), &currentDoc)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal current failed: %v", err)
+	}
+
+	if !restoreRedacted(doc, currentDoc) {
+		return config, nil
+	}
+
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("marshal failed: %v", err)
+	}
+	return string(buff), nil
+}
+
+// restoreRedacted restores the redacted values of sensitive fields in
+// place, it reports whether anything is restored.
+func restoreRedacted(value, current interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		cur, ok := current.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		for key, item := range v {
+			name, _ := key.(string)
+			if !IsSensitiveField(name) {
+				changed = restoreRedacted(item, cur[key]) || changed
+				continue
+			}
+
+			switch item := item.(type) {
+			case string:
+				if s, ok := cur[key].(string); ok && item == Redacted {
+					v[key], changed = s, true
+				}
+			case []interface{}:
+				curItem, _ := cur[key].([]interface{})
+				for i, elem := range item {
+					if elem != Redacted || i >= len(curItem) {
+						continue
+					}
+					if s, ok := curItem[i].(string); ok {
+						item[i], changed = s, true
+					}
+				}
+			}
+		}
+	case []interface{}:
+		cur, _ := current.([]interface{})
+		for i, item := range v {
+			if i < len(cur) {
+				changed = restoreRedacted(item, cur[i]) || changed
+			}
+		}
+	}
+
+	return changed
+}
+
+// transformSensitive replaces plaintext values of sensitive fields in
+// place, it reports whether anything is replaced.
+func transformSensitive(value interface{}, fn func(string) (string, error)) (bool, error) {
+	transform := func(s string) (interface{}, bool, error) {
+		if s == "" || s == Redacted || IsEncrypted(s) || IsReference(s) {
+			return s, false, nil
+		}
+		result, err := fn(s)
+		return result, err == nil, err
+	}
+
+	changed := false
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			name, _ := key.(string)
+			if !IsSensitiveField(name) {
+				c, err := transformSensitive(item, fn)
+				if err != nil {
+					return false, err
+				}
+				changed = changed || c
+				continue
+			}
+
+			switch item := item.(type) {
+			case string:
+				result, c, err := transform(item)
+				if err != nil {
+					return false, err
+				}
+				v[key], changed = result, changed || c
+			case []interface{}:
+				for i, elem := range item {
+					s, ok := elem.(string)
+					if !ok {
+						continue
+					}
+					result, c, err := transform(s)
+					if err != nil {
+						return false, err
+					}
+					item[i], changed = result, changed || c
+				}
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			c, err := transformSensitive(item, fn)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const sensitiveConfig = `name: ldap
+kind: LDAPAuth
+bindPassword: p@ss
+secrets:
+- s1
+- vault:secret/data/redis#password
+nested:
+  bindPassword: ""
+  host: ldap.example.com
+`
+
+func init() {
+	RegisterSensitiveFields("bindPassword", "secrets")
+}
+
+func newMasterKey(t *testing.T) string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	filename := filepath.Join(t.TempDir(), "master.key")
+	ioutil.WriteFile(filename, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	return filename
+}
+
+func TestEncryptLocalKey(t *testing.T) {
+	m, err := New(&option.Options{MasterKeyFile: newMasterKey(t)})
+	if err != nil {
+		t.Fatalf("new manager failed: %v", err)
+	}
+	m.vault = newManager(t, &fakeVault{password: "redis-pass"}).vault
+
+	encrypted, err := m.encryptYAML(sensitiveConfig)
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if strings.Contains(encrypted, "p@ss") || strings.Contains(encrypted, "- s1\n") {
+		t.Fatalf("plaintext found in encrypted config:\n%s", encrypted)
+	}
+	if strings.Count(encrypted, EncryptedPrefix+keyProviderLocal) != 2 {
+		t.Fatalf("want 2 encrypted values:\n%s", encrypted)
+	}
+	if !strings.Contains(encrypted, "vault:secret/data/redis#password") {
+		t.Fatalf("secret reference should be kept:\n%s", encrypted)
+	}
+
+	again, _ := m.encryptYAML(encrypted)
+	if again != encrypted {
+		t.Errorf("encrypted values should not be encrypted again")
+	}
+
+	resolved, paths, err := m.resolveYAML(encrypted)
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	for _, want := range []string{"bindPassword: p@ss", "- s1", "- redis-pass"} {
+		if !strings.Contains(resolved, want) {
+			t.Errorf("want %q in resolved config:\n%s", want, resolved)
+		}
+	}
+	if len(paths) != 1 {
+		t.Errorf("want 1 secret path, got %v", paths)
+	}
+
+	// Another master key can't decrypt it.
+	other, _ := New(&option.Options{MasterKeyFile: newMasterKey(t)})
+	if _, _, err := other.resolveYAML(encrypted); err == nil {
+		t.Errorf("want error decrypting with another master key")
+	}
+}
+
+func TestEncryptVaultTransit(t *testing.T) {
+	fv := &fakeVault{}
+	m := newManager(t, fv)
+	m.wrapper = &vaultKeyWrapper{vault: m.vault, key: "eg"}
+	m.dataKeys = map[string][]byte{}
+
+	encrypted, err := m.encryptYAML(sensitiveConfig)
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if strings.Count(encrypted, EncryptedPrefix+keyProviderVault) != 2 {
+		t.Fatalf("want 2 encrypted values:\n%s", encrypted)
+	}
+
+	for i := 0; i < 3; i++ {
+		fv.password = "redis-pass"
+		resolved, _, err := m.resolveYAML(encrypted)
+		if err != nil {
+			t.Fatalf("resolve failed: %v", err)
+		}
+		if !strings.Contains(resolved, "bindPassword: p@ss") {
+			t.Fatalf("want decrypted bindPassword:\n%s", resolved)
+		}
+	}
+	if fv.decrypts != 1 {
+		t.Errorf("want data key unwrapped once, got %d", fv.decrypts)
+	}
+}
+
+func TestRedactYAML(t *testing.T) {
+	redacted := RedactYAML(sensitiveConfig)
+	if strings.Contains(redacted, "p@ss") || strings.Contains(redacted, "- s1") {
+		t.Fatalf("plaintext found in redacted config:\n%s", redacted)
+	}
+	for _, want := range []string{"bindPassword: '******'", "vault:secret/data/redis#password", `bindPassword: ""`} {
+		if !strings.Contains(redacted, want) {
+			t.Errorf("want %q in redacted config:\n%s", want, redacted)
+		}
+	}
+
+	config := "name: demo\nkind: HTTPServer\n"
+	if RedactYAML(config) != config {
+		t.Errorf("config without sensitive fields should be kept")
+	}
+}
+
+func TestRestoreRedactedYAML(t *testing.T) {
+	redacted := strings.Replace(RedactYAML(sensitiveConfig), "ldap.example.com", "ldap.example.org", 1)
+	restored, err := RestoreRedactedYAML(redacted, sensitiveConfig)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	for _, want := range []string{"bindPassword: p@ss", "- s1", "ldap.example.org"} {
+		if !strings.Contains(restored, want) {
+			t.Errorf("want %q in restored config:\n%s", want, restored)
+		}
+	}
+
+	config := "name: ldap\nkind: LDAPAuth\nbindPassword: '******'\n"
+	restored, err = RestoreRedactedYAML(config, "name: ldap\nkind: LDAPAuth\n")
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored != config {
+		t.Errorf("config without current values should be kept, got:\n%s", restored)
+	}
+}
@@ -0,0 +1,385 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package secret resolves secret references in object specs.
+//
+// A reference is a string value in the form of vault:<path>#<key>, e.g.
+// vault:secret/data/redis#password, it is replaced by the value of the key
+// in the Vault secret at the path. Secrets are cached and refreshed in the
+// background, leases of dynamic secrets are renewed, and the paths of
+// changed secrets are sent to the channel returned by Changes.
+//
+// Values of sensitive fields are envelope-encrypted before being stored,
+// in the form of encrypted:v1:<provider>:<wrapped data key>:<ciphertext>,
+// the data key is wrapped by the local master key or a Vault transit key.
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const (
+	// VaultPrefix is the prefix of Vault secret references.
+	VaultPrefix = "vault:"
+
+	checkInterval = 5 * time.Second
+	retryInterval = 10 * time.Second
+)
+
+type (
+	// Manager resolves and refreshes secrets.
+	Manager struct {
+		vault           *vaultClient
+		refreshInterval time.Duration
+
+		mutex   sync.Mutex
+		secrets map[string]*vaultSecret
+
+		wrapper       keyWrapper
+		dataKeysMutex sync.Mutex
+		dataKeys      map[string][]byte
+
+		changes chan []string
+		done    chan struct{}
+	}
+
+	vaultSecret struct {
+		path          string
+		data          map[string]interface{}
+		leaseID       string
+		leaseDuration time.Duration
+		renewable     bool
+		nextRefresh   time.Time
+	}
+)
+
+// Global is the global secret manager.
+var Global *Manager
+
+// New creates a Manager, references can't be resolved if the Vault
+// address is not configured, and sensitive fields are not encrypted if
+// no master key is configured.
+func New(opt *option.Options) (*Manager, error) {
+	m := &Manager{
+		secrets:  map[string]*vaultSecret{},
+		dataKeys: map[string][]byte{},
+		changes:  make(chan []string, 1),
+		done:     make(chan struct{}),
+	}
+
+	addr := opt.VaultAddr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+
+	if opt.MasterKeyVaultTransit != "" {
+		if addr == "" {
+			return nil, fmt.Errorf("master-key-vault-transit requires vault-addr")
+		}
+		m.wrapper = &vaultKeyWrapper{
+			vault: newVaultClient(addr, opt.VaultTokenFile, opt.VaultNamespace),
+			key:   opt.MasterKeyVaultTransit,
+		}
+	} else {
+		wrapper, err := newLocalKeyWrapper(opt.MasterKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		// NOTE: Avoid the typed nil in the interface.
+		if wrapper != nil {
+			m.wrapper = wrapper
+		}
+	}
+	if m.wrapper == nil {
+		logger.Warnf("no master key configured, sensitive fields of specs are stored in plaintext")
+	}
+
+	Global = m
+
+	if addr == "" {
+		return m, nil
+	}
+
+	m.vault = newVaultClient(addr, opt.VaultTokenFile, opt.VaultNamespace)
+	m.refreshInterval, _ = time.ParseDuration(opt.VaultRefreshInterval)
+	if m.refreshInterval <= 0 {
+		m.refreshInterval = 5 * time.Minute
+	}
+
+	go m.run()
+
+	return m, nil
+}
+
+// IsReference reports whether s is a secret reference.
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, VaultPrefix)
+}
+
+// ParseReference parses the reference into the path and the key.
+func ParseReference(ref string) (path, key string, err error) {
+	if !IsReference(ref) {
+		return "", "", fmt.Errorf("%s is not a secret reference", ref)
+	}
+
+	s := strings.TrimPrefix(ref, VaultPrefix)
+	i := strings.LastIndex(s, "#")
+	if i <= 0 || i == len(s)-1 {
+		return "", "", fmt.Errorf("invalid secret reference %s: want %s<path>#<key>", ref, VaultPrefix)
+	}
+
+	return strings.Trim(s[:i], "/"), s[i+1:], nil
+}
+
+// Changes returns the channel receiving paths of changed secrets.
+func (m *Manager) Changes() <-chan []string {
+	return m.changes
+}
+
+// Resolve returns the value of the reference.
+func (m *Manager) Resolve(ref string) (string, error) {
+	path, key, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	if m.vault == nil {
+		return "", fmt.Errorf("resolve %s failed: vault-addr is not configured", ref)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	secret, exists := m.secrets[path]
+	if !exists {
+		secret, err = m.read(path)
+		if err != nil {
+			return "", fmt.Errorf("read secret %s failed: %v", path, err)
+		}
+		m.secrets[path] = secret
+	}
+
+	value, exists := secret.data[key]
+	if !exists {
+		return "", fmt.Errorf("key %s not found in secret %s", key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	buff, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("marshal key %s of secret %s failed: %v", key, path, err)
+	}
+	return string(buff), nil
+}
+
+// ResolveYAML replaces all references in the string values of the YAML
+// config and decrypts encrypted values by the global Manager, it returns
+// the resolved config and the paths of secrets used. The config is
+// returned as it is if there is nothing to resolve.
+func ResolveYAML(config string) (string, []string, error) {
+	m := Global
+	if m == nil {
+		m = &Manager{}
+	}
+	return m.resolveYAML(config)
+}
+
+func (m *Manager) resolveYAML(config string) (string, []string, error) {
+	if !strings.Contains(config, VaultPrefix) && !strings.Contains(config, EncryptedPrefix) {
+		return config, nil, nil
+	}
+
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return "", nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	paths := map[string]struct{}{}
+	decrypted := false
+	doc, err = m.resolveValue(doc, paths, &decrypted)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(paths) == 0 && !decrypted {
+		return config, nil, nil
+	}
+
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", nil, fmt.Errorf("marshal failed: %v", err)
+	}
+
+	result := make([]string, 0, len(paths))
+	for path := range paths {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+
+	return string(buff), result, nil
+}
+
+func (m *Manager) resolveValue(value interface{}, paths map[string]struct{}, decrypted *bool) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if IsEncrypted(v) {
+			*decrypted = true
+			return m.decrypt(v)
+		}
+		if !IsReference(v) {
+			return v, nil
+		}
+		path, _, err := ParseReference(v)
+		if err != nil {
+			return nil, err
+		}
+		s, err := m.Resolve(v)
+		if err != nil {
+			return nil, err
+		}
+		paths[path] = struct{}{}
+		return s, nil
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			resolved, err := m.resolveValue(item, paths, decrypted)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := m.resolveValue(item, paths, decrypted)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	}
+
+	return value, nil
+}
+
+func (m *Manager) read(path string) (*vaultSecret, error) {
+	vr, err := m.vault.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &vaultSecret{
+		path:          path,
+		data:          vr.Data,
+		leaseID:       vr.LeaseID,
+		leaseDuration: time.Duration(vr.LeaseDuration) * time.Second,
+		renewable:     vr.Renewable,
+	}
+	secret.nextRefresh = time.Now().Add(m.refreshDelay(secret.leaseDuration))
+
+	return secret, nil
+}
+
+// refreshDelay returns the delay to refresh a secret, leases are renewed
+// when two thirds of them passed.
+func (m *Manager) refreshDelay(leaseDuration time.Duration) time.Duration {
+	if leaseDuration > 0 && leaseDuration*2/3 < m.refreshInterval {
+		return leaseDuration * 2 / 3
+	}
+	return m.refreshInterval
+}
+
+func (m *Manager) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			changed := m.refresh()
+			if len(changed) == 0 {
+				continue
+			}
+			select {
+			case m.changes <- changed:
+			case <-m.done:
+				return
+			}
+		}
+	}
+}
+
+// refresh refreshes secrets due, it returns paths of changed secrets.
+func (m *Manager) refresh() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	changed := []string{}
+	for path, secret := range m.secrets {
+		if now.Before(secret.nextRefresh) {
+			continue
+		}
+
+		if secret.renewable && secret.leaseID != "" {
+			vr, err := m.vault.renew(secret.leaseID, secret.leaseDuration)
+			if err == nil && vr.LeaseDuration > 0 {
+				secret.leaseDuration = time.Duration(vr.LeaseDuration) * time.Second
+				secret.nextRefresh = now.Add(m.refreshDelay(secret.leaseDuration))
+				continue
+			}
+			// NOTE: The lease could not be renewed anymore after
+			// its max TTL, so read a new secret.
+			logger.Warnf("renew lease of secret %s failed, read it again: %v", path, err)
+		}
+
+		newSecret, err := m.read(path)
+		if err != nil {
+			logger.Errorf("refresh secret %s failed: %v", path, err)
+			secret.nextRefresh = now.Add(retryInterval)
+			continue
+		}
+		m.secrets[path] = newSecret
+
+		if !reflect.DeepEqual(secret.data, newSecret.data) {
+			logger.Infof("secret %s changed", path)
+			changed = append(changed, path)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+// Close closes the Manager.
+func (m *Manager) Close(wg *sync.WaitGroup) {
+	defer wg.Done()
+	close(m.done)
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "secret-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "secret-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+type fakeVault struct {
+	mutex    sync.Mutex
+	password string
+	renewals int
+	renewErr bool
+	decrypts int
+}
+
+func (fv *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "s.token" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+
+	var body interface{}
+	switch r.URL.Path {
+	case "/v1/secret/data/redis":
+		body = map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     map[string]interface{}{"password": fv.password, "port": 6379},
+				"metadata": map[string]interface{}{"version": 1},
+			},
+		}
+	case "/v1/database/creds/app":
+		body = map[string]interface{}{
+			"lease_id":       "database/creds/app/1",
+			"lease_duration": 60,
+			"renewable":      true,
+			"data":           map[string]interface{}{"username": "u-" + fv.password},
+		}
+	case "/v1/sys/leases/renew":
+		fv.renewals++
+		if fv.renewErr {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":["lease not found"]}`))
+			return
+		}
+		body = map[string]interface{}{"lease_id": "database/creds/app/1", "lease_duration": 60, "renewable": true}
+	case "/v1/transit/encrypt/eg":
+		req := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&req)
+		body = map[string]interface{}{
+			"data": map[string]interface{}{"ciphertext": "vault:v1:" + req["plaintext"]},
+		}
+	case "/v1/transit/decrypt/eg":
+		fv.decrypts++
+		req := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&req)
+		body = map[string]interface{}{
+			"data": map[string]interface{}{"plaintext": strings.TrimPrefix(req["ciphertext"], "vault:v1:")},
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+
+	json.NewEncoder(w).Encode(body)
+}
+
+func newManager(t *testing.T, fv *fakeVault) *Manager {
+	server := httptest.NewServer(fv)
+	t.Cleanup(server.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	ioutil.WriteFile(tokenFile, []byte("s.token\n"), 0600)
+
+	return &Manager{
+		vault:           newVaultClient(server.URL, tokenFile, ""),
+		refreshInterval: time.Minute,
+		secrets:         map[string]*vaultSecret{},
+		changes:         make(chan []string, 1),
+		done:            make(chan struct{}),
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	path, key, err := ParseReference("vault:secret/data/redis#password")
+	if err != nil || path != "secret/data/redis" || key != "password" {
+		t.Errorf("unexpected result %s, %s, %v", path, key, err)
+	}
+
+	for _, ref := range []string{"vault:secret/data/redis", "vault:#password", "vault:secret#", "secret#key"} {
+		if _, _, err := ParseReference(ref); err == nil {
+			t.Errorf("%s should be invalid", ref)
+		}
+	}
+}
+
+func TestResolveYAML(t *testing.T) {
+	m := newManager(t, &fakeVault{password: "p1"})
+
+	config := `
+name: pipeline
+filters:
+- name: redis
+  password: vault:secret/data/redis#password
+  port: vault:secret/data/redis#port
+  user: vault:database/creds/app#username
+- name: other
+  value: plain
+`
+	resolved, paths, err := m.resolveYAML(config)
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	for _, s := range []string{"password: p1", `port: "6379"`, "user: u-p1", "value: plain"} {
+		if !strings.Contains(resolved, s) {
+			t.Errorf("resolved config should contain %q:\n%s", s, resolved)
+		}
+	}
+	if len(paths) != 2 || paths[0] != "database/creds/app" || paths[1] != "secret/data/redis" {
+		t.Errorf("unexpected paths %v", paths)
+	}
+
+	if _, _, err := m.resolveYAML("password: vault:secret/data/redis#missing"); err == nil {
+		t.Errorf("missing key should fail")
+	}
+	if _, _, err := m.resolveYAML("password: vault:secret/data/none#password"); err == nil {
+		t.Errorf("missing secret should fail")
+	}
+
+	config = "password: plain"
+	if resolved, _, _ := m.resolveYAML(config); resolved != config {
+		t.Errorf("config without references should not be changed")
+	}
+
+	if _, _, err := (&Manager{}).resolveYAML("password: vault:secret/data/redis#password"); err == nil {
+		t.Errorf("resolve without vault should fail")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	fv := &fakeVault{password: "p1"}
+	m := newManager(t, fv)
+
+	if _, err := m.Resolve("vault:secret/data/redis#password"); err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if _, err := m.Resolve("vault:database/creds/app#username"); err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+
+	// The lease is renewed, and the static secret is not due yet.
+	m.secrets["database/creds/app"].nextRefresh = time.Time{}
+	fv.password = "p2"
+	if changed := m.refresh(); len(changed) != 0 {
+		t.Errorf("nothing should be changed, but got %v", changed)
+	}
+	if fv.renewals != 1 {
+		t.Errorf("lease should be renewed once, but got %d", fv.renewals)
+	}
+
+	// Both are read again if the lease could not be renewed.
+	fv.renewErr = true
+	for _, secret := range m.secrets {
+		secret.nextRefresh = time.Time{}
+	}
+	changed := m.refresh()
+	if len(changed) != 2 {
+		t.Errorf("both secrets should be changed, but got %v", changed)
+	}
+	if v, _ := m.Resolve("vault:secret/data/redis#password"); v != "p2" {
+		t.Errorf("password should be p2, but got %s", v)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const vaultRequestTimeout = 10 * time.Second
+
+type (
+	// vaultClient is a minimal client of the Vault HTTP API, only reading
+	// secrets and renewing leases are supported.
+	vaultClient struct {
+		addr      string
+		tokenFile string
+		namespace string
+		client    *http.Client
+	}
+
+	vaultResponse struct {
+		LeaseID       string                 `json:"lease_id"`
+		LeaseDuration int                    `json:"lease_duration"`
+		Renewable     bool                   `json:"renewable"`
+		Data          map[string]interface{} `json:"data"`
+		Errors        []string               `json:"errors"`
+	}
+)
+
+func newVaultClient(addr, tokenFile, namespace string) *vaultClient {
+	return &vaultClient{
+		addr:      strings.TrimSuffix(addr, "/"),
+		tokenFile: tokenFile,
+		namespace: namespace,
+		client:    &http.Client{Timeout: vaultRequestTimeout},
+	}
+}
+
+// token reads the token every time, so that tokens rotated by
+// Vault Agent are picked up.
+func (c *vaultClient) token() (string, error) {
+	if c.tokenFile == "" {
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+
+	buff, err := ioutil.ReadFile(c.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read vault token file failed: %v", err)
+	}
+	return strings.TrimSpace(string(buff)), nil
+}
+
+func (c *vaultClient) do(method, path string, body interface{}) (*vaultResponse, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+
+	var reader *bytes.Reader
+	if body != nil {
+		buff, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(buff)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, c.addr+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	vr := &vaultResponse{}
+	err = json.NewDecoder(resp.Body).Decode(vr)
+	if resp.StatusCode != http.StatusOK {
+		if err == nil && len(vr.Errors) > 0 {
+			return nil, fmt.Errorf("vault responded %d: %s", resp.StatusCode, strings.Join(vr.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault responded %d", resp.StatusCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode vault response failed: %v", err)
+	}
+
+	return vr, nil
+}
+
+// read reads the secret at path, data of KV version 2 secrets is unwrapped.
+func (c *vaultClient) read(path string) (*vaultResponse, error) {
+	vr, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := vr.Data["data"].(map[string]interface{}); ok {
+		if _, ok := vr.Data["metadata"].(map[string]interface{}); ok {
+			vr.Data = data
+		}
+	}
+
+	return vr, nil
+}
+
+func (c *vaultClient) renew(leaseID string, increment time.Duration) (*vaultResponse, error) {
+	return c.do(http.MethodPut, "sys/leases/renew", map[string]interface{}{
+		"lease_id":  leaseID,
+		"increment": int(increment.Seconds()),
+	})
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package spiffe provides SPIFFE identities(SVIDs) fetched from a SPIFFE
+// Workload API for TLS servers and clients, SVIDs are rotated
+// automatically, and peers are authenticated by their SPIFFE IDs.
+//
+// Reference: https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Workload_API.md
+package spiffe
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// EndpointSocketEnv is the environment variable of the default
+	// Workload API address.
+	EndpointSocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+
+	minRetryInterval = time.Second
+	maxRetryInterval = 30 * time.Second
+)
+
+type (
+	// Source keeps the latest SVID and trust bundles from a Workload API.
+	Source struct {
+		addr   string
+		refs   int
+		cancel context.CancelFunc
+
+		mutex     sync.RWMutex
+		id        string
+		cert      *tls.Certificate
+		bundles   map[string]*x509.CertPool
+		updatedAt time.Time
+		err       error
+	}
+
+	// Status is the status of a Source.
+	Status struct {
+		Addr      string `yaml:"addr"`
+		ID        string `yaml:"id,omitempty"`
+		ExpiresAt string `yaml:"expiresAt,omitempty"`
+		UpdatedAt string `yaml:"updatedAt,omitempty"`
+		Error     string `yaml:"error,omitempty"`
+	}
+)
+
+var (
+	sourcesMutex sync.Mutex
+	sources      = map[string]*Source{}
+)
+
+// Acquire returns the Source of the Workload API at addr, it is shared by
+// all users of the same address, and must be released by Release.
+// SPIFFE_ENDPOINT_SOCKET is used if addr is empty.
+func Acquire(addr string) *Source {
+	if addr == "" {
+		addr = os.Getenv(EndpointSocketEnv)
+	}
+
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+
+	s, exists := sources[addr]
+	if !exists {
+		ctx, cancel := context.WithCancel(context.Background())
+		s = &Source{addr: addr, cancel: cancel}
+		sources[addr] = s
+		go s.run(ctx)
+	}
+	s.refs++
+
+	return s
+}
+
+// Release releases the Source, it is closed if nobody uses it.
+func (s *Source) Release() {
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	delete(sources, s.addr)
+	s.cancel()
+}
+
+func (s *Source) run(ctx context.Context) {
+	retryInterval := minRetryInterval
+	for {
+		s.mutex.RLock()
+		lastUpdate := s.updatedAt
+		s.mutex.RUnlock()
+
+		err := s.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.err = err
+		updated := s.updatedAt != lastUpdate
+		s.mutex.Unlock()
+		logger.Errorf("fetch x509 svid from %s failed: %v", s.addr, err)
+
+		// NOTE: Reset the interval if the stream worked for a while.
+		if updated {
+			retryInterval = minRetryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+		if retryInterval *= 2; retryInterval > maxRetryInterval {
+			retryInterval = maxRetryInterval
+		}
+	}
+}
+
+func (s *Source) watch(ctx context.Context) error {
+	if s.addr == "" {
+		return fmt.Errorf("workload api address is empty, and %s is not set", EndpointSocketEnv)
+	}
+
+	conn, err := dialWorkloadAPI(ctx, s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fetchX509SVID(ctx, conn, func(resp *x509SVIDResponse) {
+		err := s.update(resp)
+		if err != nil {
+			logger.Errorf("update x509 svid from %s failed: %v", s.addr, err)
+		}
+	})
+}
+
+// update updates the SVID and bundles, the first SVID is used as the
+// default one as the Workload API requires.
+func (s *Source) update(resp *x509SVIDResponse) error {
+	if len(resp.Svids) == 0 {
+		return fmt.Errorf("no svid in response")
+	}
+	svid := resp.Svids[0]
+
+	certs, err := x509.ParseCertificates(svid.X509Svid)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("parse svid %s failed: %v", svid.SpiffeId, err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(svid.X509SvidKey)
+	if err != nil {
+		return fmt.Errorf("parse key of svid %s failed: %v", svid.SpiffeId, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("key of svid %s is not a signer", svid.SpiffeId)
+	}
+
+	td, err := trustDomainOf(svid.SpiffeId)
+	if err != nil {
+		return err
+	}
+	bundles := map[string]*x509.CertPool{}
+	bundles[td], err = parseBundle(svid.Bundle)
+	if err != nil {
+		return fmt.Errorf("parse bundle of %s failed: %v", td, err)
+	}
+	for id, bundle := range resp.FederatedBundles {
+		federatedTD, err := trustDomainOf(id)
+		if err != nil {
+			return err
+		}
+		bundles[federatedTD], err = parseBundle(bundle)
+		if err != nil {
+			return fmt.Errorf("parse bundle of %s failed: %v", federatedTD, err)
+		}
+	}
+
+	cert := &tls.Certificate{PrivateKey: signer, Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.id, s.cert, s.bundles = svid.SpiffeId, cert, bundles
+	s.updatedAt, s.err = time.Now(), nil
+
+	logger.Infof("x509 svid %s updated from %s, expires at %s",
+		svid.SpiffeId, s.addr, certs[0].NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+func parseBundle(der []byte) (*x509.CertPool, error) {
+	certs, err := x509.ParseCertificates(der)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("empty bundle")
+	}
+
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+// trustDomainOf returns the trust domain of the SPIFFE ID, trust domain
+// IDs like spiffe://example.org are accepted too.
+func trustDomainOf(id string) (string, error) {
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme != "spiffe" || u.Host == "" {
+		return "", fmt.Errorf("invalid spiffe id %s", id)
+	}
+	return u.Host, nil
+}
+
+// certificate returns the current SVID.
+func (s *Source) certificate() (*tls.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.cert == nil {
+		if s.err != nil {
+			return nil, fmt.Errorf("no svid from %s: %v", s.addr, s.err)
+		}
+		return nil, fmt.Errorf("no svid from %s yet", s.addr)
+	}
+	return s.cert, nil
+}
+
+// bundle returns the trust bundle of the trust domain.
+func (s *Source) bundle(td string) *x509.CertPool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.bundles[td]
+}
+
+// Status returns the status of the Source.
+func (s *Source) Status() *Status {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	status := &Status{Addr: s.addr, ID: s.id}
+	if s.cert != nil {
+		status.ExpiresAt = s.cert.Leaf.NotAfter.Format(time.RFC3339)
+		status.UpdatedAt = s.updatedAt.Format(time.RFC3339)
+	}
+	if s.err != nil {
+		status.Error = s.err.Error()
+	}
+	return status
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "spiffe-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "spiffe-for-log",
+		AbsLogDir: absLogDir,
+	})
+	code := m.Run()
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, td string) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: td},
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: td}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create ca failed: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, id string) *x509SVID {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	u, _ := url.Parse(id)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create svid failed: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	return &x509SVID{SpiffeId: id, X509Svid: der, X509SvidKey: keyDER, Bundle: ca.cert.Raw}
+}
+
+// startWorkloadAPI starts a fake Workload API sending the SVID.
+func startWorkloadAPI(t *testing.T, svid *x509SVID) string {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "SpiffeWorkloadAPI",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "FetchX509SVID",
+			ServerStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				if len(md.Get(workloadHeader)) == 0 {
+					return fmt.Errorf("security header missing")
+				}
+				if err := stream.RecvMsg(&x509SVIDRequest{}); err != nil {
+					return err
+				}
+				if err := stream.SendMsg(&x509SVIDResponse{Svids: []*x509SVID{svid}}); err != nil {
+					return err
+				}
+				<-stream.Context().Done()
+				return nil
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	return "unix://" + socket
+}
+
+func waitSVID(t *testing.T, s *Source) {
+	for i := 0; i < 100; i++ {
+		if _, err := s.certificate(); err == nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("no svid: %v", s.Status().Error)
+}
+
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		errs <- tls.Server(conn, serverConfig).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+	if err == nil {
+		// NOTE: The server verifies the client after the client finished
+		// the handshake in TLS 1.3, read to get the result.
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	serverErr := <-errs
+	if err != nil {
+		return err
+	}
+	return serverErr
+}
+
+func TestMTLS(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	serverSource := Acquire(startWorkloadAPI(t, ca.issue(t, "spiffe://example.org/gateway")))
+	defer serverSource.Release()
+	clientSource := Acquire(startWorkloadAPI(t, ca.issue(t, "spiffe://example.org/client")))
+	defer clientSource.Release()
+	waitSVID(t, serverSource)
+	waitSVID(t, clientSource)
+
+	if id := serverSource.Status().ID; id != "spiffe://example.org/gateway" {
+		t.Errorf("id should be spiffe://example.org/gateway, but got %s", id)
+	}
+
+	serverConfig := ServerTLSConfig(serverSource, &Spec{AllowedIDs: []string{"spiffe://example.org/client"}})
+	clientConfig := ClientTLSConfig(clientSource, &Spec{AllowedTrustDomains: []string{"example.org"}})
+	if err := handshake(t, serverConfig, clientConfig); err != nil {
+		t.Errorf("handshake failed: %v", err)
+	}
+
+	serverConfig = ServerTLSConfig(serverSource, &Spec{AllowedIDs: []string{"spiffe://example.org/other"}})
+	if err := handshake(t, serverConfig, clientConfig); err == nil {
+		t.Errorf("client should not be allowed")
+	}
+
+	// SVIDs from unknown trust domains are rejected.
+	other := newTestCA(t, "other.org")
+	otherSource := Acquire(startWorkloadAPI(t, other.issue(t, "spiffe://other.org/client")))
+	defer otherSource.Release()
+	waitSVID(t, otherSource)
+	serverConfig = ServerTLSConfig(serverSource, &Spec{})
+	if err := handshake(t, serverConfig, ClientTLSConfig(otherSource, &Spec{})); err == nil {
+		t.Errorf("client of unknown trust domain should not be allowed")
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	s1, s2 := Acquire("unix:///nonexistent.sock"), Acquire("unix:///nonexistent.sock")
+	if s1 != s2 {
+		t.Errorf("sources of the same address should be shared")
+	}
+	s1.Release()
+	s2.Release()
+	if s3 := Acquire("unix:///nonexistent.sock"); s3 == s1 {
+		t.Errorf("released source should not be reused")
+	} else {
+		s3.Release()
+	}
+
+	if _, err := s1.certificate(); err == nil {
+		t.Errorf("certificate should fail without svid")
+	}
+}
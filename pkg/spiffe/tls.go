@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+// Spec describes the SPIFFE identity of a TLS server or client, and the
+// SPIFFE IDs of peers allowed. All peers with SVIDs issued by known trust
+// domains are allowed if both allowedIDs and allowedTrustDomains are empty.
+type Spec struct {
+	WorkloadAPIAddr     string   `yaml:"workloadAPIAddr" jsonschema:"omitempty"`
+	AllowedIDs          []string `yaml:"allowedIDs" jsonschema:"omitempty,uniqueItems=true"`
+	AllowedTrustDomains []string `yaml:"allowedTrustDomains" jsonschema:"omitempty,uniqueItems=true"`
+}
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	for _, id := range s.AllowedIDs {
+		if _, err := trustDomainOf(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServerTLSConfig returns the TLS config of servers, which presents the
+// SVID of the source, and requires clients to present valid SVIDs.
+func ServerTLSConfig(source *Source, spec *Spec) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return source.certificate()
+		},
+		// NOTE: Clients are verified by VerifyPeerCertificate against
+		// SPIFFE bundles instead of the system roots.
+		ClientAuth: tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPeer(source, spec, rawCerts)
+		},
+	}
+}
+
+// ClientTLSConfig returns the TLS config of clients, which presents the
+// SVID of the source, and requires servers to present valid SVIDs.
+func ClientTLSConfig(source *Source, spec *Spec) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return source.certificate()
+		},
+		// NOTE: SVIDs don't contain host names, servers are verified by
+		// VerifyPeerCertificate against SPIFFE bundles.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPeer(source, spec, rawCerts)
+		},
+	}
+}
+
+// verifyPeer verifies the certificate chain of the peer against the
+// bundle of its trust domain, and authorizes its SPIFFE ID.
+func verifyPeer(source *Source, spec *Spec, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("peer presented no certificate")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parse peer certificate failed: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	leaf := certs[0]
+	if len(leaf.URIs) != 1 {
+		return fmt.Errorf("peer certificate has %d uri sans, want one spiffe id", len(leaf.URIs))
+	}
+	id := leaf.URIs[0].String()
+	td, err := trustDomainOf(id)
+	if err != nil {
+		return err
+	}
+
+	roots := source.bundle(td)
+	if roots == nil {
+		return fmt.Errorf("no bundle of trust domain %s for peer %s", td, id)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("verify peer %s failed: %v", id, err)
+	}
+
+	if len(spec.AllowedIDs) == 0 && len(spec.AllowedTrustDomains) == 0 {
+		return nil
+	}
+	if stringtool.StrInSlice(id, spec.AllowedIDs) || stringtool.StrInSlice(td, spec.AllowedTrustDomains) {
+		return nil
+	}
+	return fmt.Errorf("peer %s is not allowed", id)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spiffe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// The messages and the method below are from workload.proto of the
+// SPIFFE Workload API, only the X.509 part is used.
+// Reference: https://github.com/spiffe/go-spiffe/blob/main/v2/proto/spiffe/workload/workload.proto
+
+const (
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+
+	// workloadHeader is required by agents to prevent SSRF attacks.
+	workloadHeader = "workload.spiffe.io"
+)
+
+type (
+	x509SVIDRequest struct{}
+
+	x509SVIDResponse struct {
+		Svids            []*x509SVID       `protobuf:"bytes,1,rep,name=svids,proto3"`
+		Crl              [][]byte          `protobuf:"bytes,2,rep,name=crl,proto3"`
+		FederatedBundles map[string][]byte `protobuf:"bytes,3,rep,name=federated_bundles,json=federatedBundles,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	}
+
+	x509SVID struct {
+		SpiffeId    string `protobuf:"bytes,1,opt,name=spiffe_id,json=spiffeId,proto3"`
+		X509Svid    []byte `protobuf:"bytes,2,opt,name=x509_svid,json=x509Svid,proto3"`
+		X509SvidKey []byte `protobuf:"bytes,3,opt,name=x509_svid_key,json=x509SvidKey,proto3"`
+		Bundle      []byte `protobuf:"bytes,4,opt,name=bundle,proto3"`
+	}
+)
+
+func (m *x509SVIDRequest) Reset()         { *m = x509SVIDRequest{} }
+func (m *x509SVIDRequest) String() string { return proto.CompactTextString(m) }
+func (*x509SVIDRequest) ProtoMessage()    {}
+
+func (m *x509SVIDResponse) Reset()         { *m = x509SVIDResponse{} }
+func (m *x509SVIDResponse) String() string { return proto.CompactTextString(m) }
+func (*x509SVIDResponse) ProtoMessage()    {}
+
+func (m *x509SVID) Reset()         { *m = x509SVID{} }
+func (m *x509SVID) String() string { return proto.CompactTextString(m) }
+func (*x509SVID) ProtoMessage()    {}
+
+// dialWorkloadAPI dials the Workload API at addr, which is
+// unix:///path/to/socket or tcp://host:port.
+func dialWorkloadAPI(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	var network, address string
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		network, address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		network, address = "tcp", strings.TrimPrefix(addr, "tcp://")
+	default:
+		return nil, fmt.Errorf("invalid workload api address %s: want unix:// or tcp://", addr)
+	}
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}
+
+	// NOTE: The passthrough scheme keeps the target from being resolved,
+	// the real address is dialed by the dialer.
+	return grpc.DialContext(ctx, "passthrough:///workloadapi",
+		grpc.WithInsecure(), grpc.WithContextDialer(dialer))
+}
+
+// fetchX509SVID streams X.509 SVIDs and bundles, it returns when the
+// stream breaks or ctx is done.
+func fetchX509SVID(ctx context.Context, conn *grpc.ClientConn, onUpdate func(*x509SVIDResponse)) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, workloadHeader, "true")
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    "FetchX509SVID",
+		ServerStreams: true,
+	}, fetchX509SVIDMethod)
+	if err != nil {
+		return err
+	}
+
+	err = stream.SendMsg(&x509SVIDRequest{})
+	if err != nil {
+		return err
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp := &x509SVIDResponse{}
+		err := stream.RecvMsg(resp)
+		if err != nil {
+			return err
+		}
+		onUpdate(resp)
+	}
+}
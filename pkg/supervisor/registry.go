@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"time"
 )
 
 type (
@@ -63,6 +64,15 @@ type (
 		Timestamp int64
 	}
 
+	// Drainer is the optional interface of objects which could finish
+	// their work in flight gracefully. On shutdown, the supervisor calls
+	// Drain of all objects in a category before closing them.
+	Drainer interface {
+		// Drain stops taking new work and waits for the work in flight
+		// to complete until the deadline.
+		Drain(deadline time.Time)
+	}
+
 	// TrafficGate is the object in category of TrafficGate.
 	TrafficGate interface {
 		Object
@@ -123,6 +133,33 @@ func ObjectKinds() []string {
 	return kinds
 }
 
+// ObjectDefaultSpec returns the default spec of the kind, the second
+// return value is false if the kind isn't registered.
+func ObjectDefaultSpec(kind string) (interface{}, bool) {
+	o, exists := objectRegistry[kind]
+	if !exists {
+		return nil, false
+	}
+	return o.DefaultSpec(), true
+}
+
+// KindPriority returns the priority of the kind by its category, the
+// objects of a lower priority may depend on the ones of a higher one,
+// e.g. traffic gates depend on pipelines. The priority is smaller if it's
+// higher, and it's -1 if the kind isn't registered.
+func KindPriority(kind string) int {
+	o, exists := objectRegistry[kind]
+	if !exists {
+		return -1
+	}
+	for i, category := range objectOrderedCategories {
+		if category == o.Category() {
+			return i
+		}
+	}
+	return -1
+}
+
 // Register registers object.
 func Register(o Object) {
 	if o.Kind() == "" {
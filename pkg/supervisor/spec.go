@@ -19,24 +19,42 @@ package supervisor
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/megaease/easegress/pkg/configblock"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/util/interpolation"
 	"github.com/megaease/easegress/pkg/v"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
+// NamespaceSeparator separates the namespace and the name in the name of
+// an object in a namespace.
+const NamespaceSeparator = "."
+
 type (
 	// Spec is the universal spec for all objects.
 	Spec struct {
 		yamlConfig string
 		meta       *MetaSpec
 		objectSpec interface{}
+
+		// secretPaths are paths of secrets referenced by the spec.
+		secretPaths []string
+		// blockNames are names of blocks referenced by the spec.
+		blockNames []string
 	}
 
 	// MetaSpec is metadata for all specs.
 	MetaSpec struct {
 		Name string `yaml:"name" jsonschema:"required,format=urlname"`
 		Kind string `yaml:"kind" jsonschema:"required"`
+		// Namespace scopes the name, it's empty for the default one.
+		Namespace string `yaml:"namespace,omitempty" jsonschema:"omitempty,format=urlname"`
+		// NodeGroups are the node groups of members to run the object,
+		// it runs on all members if empty.
+		NodeGroups []string `yaml:"nodeGroups,omitempty" jsonschema:"omitempty,uniqueItems=true"`
 	}
 )
 
@@ -60,7 +78,10 @@ func NewSpec(yamlConfig string) (*Spec, error) {
 	}
 	vr := v.Validate(meta, []byte(yamlConfig))
 	if !vr.Valid() {
-		return nil, fmt.Errorf("validate metadata failed: \n%s", vr)
+		return nil, fmt.Errorf("validate metadata failed: \n%w", vr)
+	}
+	if strings.Contains(meta.Namespace, NamespaceSeparator) {
+		return nil, fmt.Errorf("namespace %s contains %s", meta.Namespace, NamespaceSeparator)
 	}
 
 	rootObject, exists := objectRegistry[meta.Kind]
@@ -70,29 +91,107 @@ func NewSpec(yamlConfig string) (*Spec, error) {
 
 	s.meta, s.objectSpec = meta, rootObject.DefaultSpec()
 
-	err = yaml.Unmarshal([]byte(yamlConfig), s.objectSpec)
+	// NOTE: Block references are resolved before secret ones, since
+	// blocks may reference secrets as well. The YAML config keeps both.
+	resolvedConfig, blockNames, err := configblock.ResolveYAML(yamlConfig)
+	if err != nil {
+		return nil, fmt.Errorf("resolve blocks failed: %v", err)
+	}
+	s.blockNames = blockNames
+
+	// NOTE: Environment variables and files are the ones of the member
+	// creating the spec, so the same config works in all environments.
+	resolvedConfig, err = interpolation.ResolveYAML(resolvedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("interpolate failed: %v", err)
+	}
+
+	// NOTE: Secret references are resolved for the object spec only, the
+	// YAML config keeps them, so secrets are never stored or shown.
+	resolvedConfig, secretPaths, err := secret.ResolveYAML(resolvedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("resolve secrets failed: %v", err)
+	}
+	s.secretPaths = secretPaths
+
+	err = yaml.Unmarshal([]byte(resolvedConfig), s.objectSpec)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal failed: %v", err)
 	}
-	vr = v.Validate(s.objectSpec, []byte(yamlConfig))
+	vr = v.Validate(s.objectSpec, []byte(resolvedConfig))
 	if !vr.Valid() {
-		return nil, fmt.Errorf("validate spec failed: \n%s", vr)
+		return nil, fmt.Errorf("validate spec failed: \n%w", vr)
 	}
 
 	return s, nil
 }
 
-// Name returns name.
-func (s *Spec) Name() string { return s.meta.Name }
+// Name returns the name, which is prefixed by the namespace and the
+// separator if the object is in a namespace, so names in different
+// namespaces never collide.
+func (s *Spec) Name() string { return QualifiedName(s.meta.Namespace, s.meta.Name) }
+
+// QualifiedName returns the name of the object in the namespace, it's the
+// name itself in the default namespace.
+func QualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + NamespaceSeparator + name
+}
+
+// Namespace returns the namespace, it's empty for the default one.
+func (s *Spec) Namespace() string { return s.meta.Namespace }
 
 // Kind returns kind.
 func (s *Spec) Kind() string { return s.meta.Kind }
 
+// NodeGroups returns the node groups to run the object, it's empty if the
+// object runs on all members.
+func (s *Spec) NodeGroups() []string { return s.meta.NodeGroups }
+
+// PlacedOn reports whether the object runs on the members of the node group.
+func (s *Spec) PlacedOn(nodeGroup string) bool {
+	if len(s.meta.NodeGroups) == 0 {
+		return true
+	}
+	for _, g := range s.meta.NodeGroups {
+		if g == nodeGroup {
+			return true
+		}
+	}
+	return false
+}
+
 // YAMLConfig returns the config in yaml format.
 func (s *Spec) YAMLConfig() string {
 	return s.yamlConfig
 }
 
+// usesSecrets reports whether the spec references any of the secrets.
+func (s *Spec) usesSecrets(paths []string) bool {
+	for _, p := range s.secretPaths {
+		for _, path := range paths {
+			if p == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesBlocks reports whether the spec references any of the blocks.
+func (s *Spec) usesBlocks(names []string) bool {
+	for _, name := range s.blockNames {
+		for _, n := range names {
+			if name == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ObjectSpec returns the object spec.
 func (s *Spec) ObjectSpec() interface{} {
 	return s.objectSpec
@@ -22,10 +22,13 @@ import (
 	"reflect"
 	"runtime/debug"
 	"sync"
+	"time"
 
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/configblock"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/storage"
 )
 
@@ -40,6 +43,8 @@ func InitGlobalSupervisor(super *Supervisor) {
 
 const (
 	maxStatusesRecordCount = 10
+
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 type (
@@ -52,7 +57,12 @@ type (
 		runningCategories map[ObjectCategory]*RunningCategory
 		firstHandle       bool
 		firstHandleDone   chan struct{}
-		done              chan struct{}
+		secretChanges     <-chan []string
+		blockChanges      <-chan []string
+		// lastConfig is the last config applied, objects failing to be
+		// created from it are retried when blocks change.
+		lastConfig map[string]string
+		done       chan struct{}
 	}
 
 	// RunningCategory is the bucket to gather running objects in the same category.
@@ -137,6 +147,19 @@ func (ro *RunningObject) closeWithRecovery() {
 	ro.object.Close()
 }
 
+func (ro *RunningObject) drainWithRecovery(deadline time.Time) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("%s: recover from drain, err: %v, stack trace:\n%s\n",
+				ro.spec.Name(), err, debug.Stack())
+		}
+	}()
+
+	if drainer, ok := ro.object.(Drainer); ok {
+		drainer.Drain(deadline)
+	}
+}
+
 // MustNew creates a Supervisor.
 func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 	s := &Supervisor{
@@ -149,6 +172,12 @@ func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 		firstHandleDone:   make(chan struct{}),
 		done:              make(chan struct{}),
 	}
+	if secret.Global != nil {
+		s.secretChanges = secret.Global.Changes()
+	}
+	if configblock.Global != nil {
+		s.blockChanges = configblock.Global.Changes()
+	}
 
 	for _, category := range objectOrderedCategories {
 		s.runningCategories[category] = &RunningCategory{
@@ -206,6 +235,10 @@ func (s *Supervisor) run() {
 			return
 		case config := <-s.storage.WatchConfig():
 			s.applyConfig(config)
+		case paths := <-s.secretChanges:
+			s.applySecretChanges(paths)
+		case names := <-s.blockChanges:
+			s.applyBlockChanges(names)
 		}
 	}
 }
@@ -218,6 +251,8 @@ func (s *Supervisor) applyConfig(config map[string]string) {
 		}()
 	}
 
+	s.lastConfig = config
+
 	// Create, update, delete from high to low priority.
 	for _, category := range objectOrderedCategories {
 		// NOTE: System controller can't be manipulated after initialized.
@@ -267,6 +302,15 @@ func (s *Supervisor) applyConfigInCategory(config map[string]string, category Ob
 				name, ro.Spec().Name())
 			continue
 		}
+		// NOTE: Objects placed on other node groups are treated as deleted.
+		if !ro.Spec().PlacedOn(s.options.NodeGroup) {
+			if prevInstance != nil {
+				prev.closeWithRecovery()
+				delete(rc.runningObjects, name)
+				logger.Infof("delete %s placed on node groups %v", name, ro.Spec().NodeGroups())
+			}
+			continue
+		}
 
 		if prevInstance == nil {
 			ro.initWithRecovery(s)
@@ -280,6 +324,60 @@ func (s *Supervisor) applyConfigInCategory(config map[string]string, category Ob
 	}
 }
 
+// applySecretChanges updates running objects referencing changed secrets,
+// by creating new generations from the same config.
+func (s *Supervisor) applySecretChanges(paths []string) {
+	s.reloadObjects("secrets", func(spec *Spec) bool {
+		return spec.usesSecrets(paths)
+	})
+}
+
+// applyBlockChanges updates running objects referencing changed blocks
+// like applySecretChanges, and creates the objects which failed to be
+// created from the last config, since they may reference the blocks.
+func (s *Supervisor) applyBlockChanges(names []string) {
+	s.reloadObjects("blocks", func(spec *Spec) bool {
+		return spec.usesBlocks(names)
+	})
+
+	// NOTE: Objects not changed are skipped, and there's nothing to
+	// retry before the first config.
+	if s.lastConfig != nil {
+		s.applyConfig(s.lastConfig)
+	}
+}
+
+// reloadObjects creates new generations of the running objects chosen by
+// uses from the same config.
+func (s *Supervisor) reloadObjects(reason string, uses func(spec *Spec) bool) {
+	for _, category := range objectOrderedCategories {
+		if category == CategorySystemController {
+			continue
+		}
+
+		rc := s.runningCategories[category]
+		func() {
+			rc.mutex.Lock()
+			defer rc.mutex.Unlock()
+
+			for name, prev := range rc.runningObjects {
+				if !uses(prev.spec) {
+					continue
+				}
+
+				ro, err := newRunningObjectFromConfig(prev.spec.YAMLConfig())
+				if err != nil {
+					logger.Errorf("update %s for changed %s failed: %v", name, reason, err)
+					continue
+				}
+				ro.inheritWithRecovery(prev.Instance(), s)
+				rc.runningObjects[name] = ro
+				logger.Infof("update %s for changed %s", name, reason)
+			}
+		}()
+	}
+}
+
 // WalkFunc is the type of the function called for
 // each running object visited by WalkRunningObjects.
 type WalkFunc func(runningObject *RunningObject) bool
@@ -357,9 +455,21 @@ func (s *Supervisor) Close(wg *sync.WaitGroup) {
 	<-s.done
 }
 
+func (s *Supervisor) shutdownTimeout() time.Duration {
+	timeout, err := time.ParseDuration(s.options.ShutdownTimeout)
+	if err != nil {
+		return defaultShutdownTimeout
+	}
+	return timeout
+}
+
 func (s *Supervisor) close() {
 	s.storage.Close()
 
+	// NOTE: All objects share the deadline, so the traffic gates stop
+	// accepting first, then the pipelines complete the requests in flight.
+	deadline := time.Now().Add(s.shutdownTimeout())
+
 	// Close from low to high priority.
 	for i := len(objectOrderedCategories) - 1; i >= 0; i-- {
 		rc := s.runningCategories[objectOrderedCategories[i]]
@@ -367,6 +477,16 @@ func (s *Supervisor) close() {
 			rc.mutex.Lock()
 			defer rc.mutex.Unlock()
 
+			wg := &sync.WaitGroup{}
+			for _, ro := range rc.runningObjects {
+				wg.Add(1)
+				go func(ro *RunningObject) {
+					defer wg.Done()
+					ro.drainWithRecovery(deadline)
+				}(ro)
+			}
+			wg.Wait()
+
 			for name, ro := range rc.runningObjects {
 				ro.closeWithRecovery()
 				delete(rc.runningObjects, name)
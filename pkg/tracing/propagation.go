@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	zipkinot "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	zipkingomodel "github.com/openzipkin/zipkin-go/model"
+)
+
+const (
+	// TraceParentHeader is the header of W3C Trace Context.
+	// Reference: https://www.w3.org/TR/trace-context/#traceparent-header
+	TraceParentHeader = "Traceparent"
+
+	traceParentVersion = "00"
+	traceFlagSampled   = "01"
+	traceFlagNone      = "00"
+)
+
+// extractHTTPHeader extracts the span context propagated in the header,
+// in B3 or W3C Trace Context format, B3 takes precedence. It returns nil
+// if there's no valid one.
+func (t *Tracing) extractHTTPHeader(header http.Header) opentracing.SpanContext {
+	if t == NoopTracing || header == nil {
+		return nil
+	}
+
+	// NOTE: Zipkin returns an empty context without error if there are
+	// no B3 headers.
+	sc, err := t.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if zsc, ok := sc.(zipkinot.SpanContext); err == nil && !(ok && zsc.TraceID.Empty()) {
+		return sc
+	}
+
+	if traceParent := header.Get(TraceParentHeader); traceParent != "" {
+		zsc, err := parseTraceParent(traceParent)
+		if err == nil {
+			return zipkinot.SpanContext(*zsc)
+		}
+	}
+
+	return nil
+}
+
+// InjectHTTPHeader injects the context of the span into the header, in
+// both B3 and W3C Trace Context formats.
+func InjectHTTPHeader(span Span, header http.Header) error {
+	err := span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders,
+		opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		return err
+	}
+
+	if sc, ok := span.Context().(zipkinot.SpanContext); ok {
+		header.Set(TraceParentHeader, formatTraceParent((*zipkingomodel.SpanContext)(&sc)))
+	}
+
+	return nil
+}
+
+func parseTraceParent(traceParent string) (*zipkingomodel.SpanContext, error) {
+	fields := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(fields) < 4 || fields[0] != traceParentVersion {
+		return nil, fmt.Errorf("unsupported traceparent %s", traceParent)
+	}
+
+	traceID, err := hex.DecodeString(fields[1])
+	if err != nil || len(traceID) != 16 {
+		return nil, fmt.Errorf("invalid trace id %s", fields[1])
+	}
+	spanID, err := hex.DecodeString(fields[2])
+	if err != nil || len(spanID) != 8 {
+		return nil, fmt.Errorf("invalid parent id %s", fields[2])
+	}
+	flags, err := hex.DecodeString(fields[3])
+	if err != nil || len(flags) != 1 {
+		return nil, fmt.Errorf("invalid trace flags %s", fields[3])
+	}
+
+	sc := &zipkingomodel.SpanContext{
+		TraceID: zipkingomodel.TraceID{
+			High: binary.BigEndian.Uint64(traceID[:8]),
+			Low:  binary.BigEndian.Uint64(traceID[8:]),
+		},
+		ID: zipkingomodel.ID(binary.BigEndian.Uint64(spanID)),
+	}
+	if sc.TraceID.Empty() || sc.ID == 0 {
+		return nil, fmt.Errorf("invalid traceparent %s", traceParent)
+	}
+
+	sampled := flags[0]&1 == 1
+	sc.Sampled = &sampled
+
+	return sc, nil
+}
+
+func formatTraceParent(sc *zipkingomodel.SpanContext) string {
+	flags := traceFlagNone
+	if sc.Debug || (sc.Sampled != nil && *sc.Sampled) {
+		flags = traceFlagSampled
+	}
+
+	return fmt.Sprintf("%s-%016x%016x-%016x-%s",
+		traceParentVersion, sc.TraceID.High, sc.TraceID.Low, uint64(sc.ID), flags)
+}
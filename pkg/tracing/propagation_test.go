@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/tracing/zipkin"
+)
+
+func TestTraceParent(t *testing.T) {
+	for _, tp := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-0000000000000000a3ce929d0e0e4736-00f067aa0ba902b7-00",
+	} {
+		sc, err := parseTraceParent(tp)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", tp, err)
+		}
+		if got := formatTraceParent(sc); got != tp {
+			t.Errorf("want %s, got %s", tp, got)
+		}
+	}
+
+	for _, tp := range []string{
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		if _, err := parseTraceParent(tp); err == nil {
+			t.Errorf("want error for %s", tp)
+		}
+	}
+}
+
+func TestSpanWithHeader(t *testing.T) {
+	tracer, err := New(&Spec{
+		ServiceName: "test",
+		Zipkin: &zipkin.Spec{
+			ServerURL:  "http://127.0.0.1:9411/api/v2/spans",
+			SampleRate: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new tracing failed: %v", err)
+	}
+	defer tracer.Close()
+
+	header := http.Header{}
+	header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	span := NewSpanWithHeader(tracer, "server", header).NewChild("filter")
+
+	out := http.Header{}
+	if err := InjectHTTPHeader(span, out); err != nil {
+		t.Fatalf("inject failed: %v", err)
+	}
+	if got := out.Get("X-B3-Traceid"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("want trace id propagated to B3, got %s", got)
+	}
+	if got := out.Get(TraceParentHeader); !strings.HasPrefix(got, "00-4bf92f3577b34da6a3ce929d0e0e4736-") ||
+		!strings.HasSuffix(got, "-00") || strings.Contains(got, "00f067aa0ba902b7") {
+		t.Errorf("want child span in traceparent, got %s", got)
+	}
+}
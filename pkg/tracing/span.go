@@ -18,6 +18,7 @@
 package tracing
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/megaease/easegress/pkg/tracing/base"
@@ -79,6 +80,20 @@ func NewSpanWithStart(tracer *Tracing, name string, startAt time.Time) Span {
 	return newSpanWithStart(tracer, name, startAt)
 }
 
+// NewSpanWithHeader creates a span, which is the child of the span
+// propagated in the header of the request if it exists.
+func NewSpanWithHeader(tracer *Tracing, name string, header http.Header) Span {
+	opts := []opentracing.StartSpanOption{opentracing.StartTime(time.Now())}
+	if parent := tracer.extractHTTPHeader(header); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent))
+	}
+
+	return &span{
+		tracer: tracer,
+		span:   tracer.StartSpan(name, opts...),
+	}
+}
+
 func newSpanWithStart(tracer *Tracing, name string, startAt time.Time) Span {
 	return &span{
 		tracer: tracer,
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodystream
+
+import (
+	"io"
+	"sync"
+)
+
+type (
+	// Stage wraps a body into another one. A stage must not read the
+	// body until the returned reader is read, so a chain of stages
+	// processes the body piece by piece without buffering it as a whole.
+	Stage func(body io.Reader) io.Reader
+
+	// TransformFunc reads src and writes the transformed body to dst.
+	TransformFunc func(dst io.Writer, src io.Reader) error
+
+	// wrapper forwards Close to the wrapped body, since the body from
+	// network must be closed after it's read.
+	wrapper struct {
+		io.Reader
+		body io.Reader
+	}
+
+	transformer struct {
+		body io.Reader
+		fn   TransformFunc
+
+		once sync.Once
+		pr   *io.PipeReader
+	}
+
+	observer struct {
+		body io.Reader
+		fn   func(err error)
+		done bool
+	}
+)
+
+// Chain applies stages to body in order.
+func Chain(body io.Reader, stages ...Stage) io.Reader {
+	for _, stage := range stages {
+		body = stage(body)
+	}
+	return body
+}
+
+// Transform returns a stage running fn in a goroutine started by the
+// first Read. The writes of fn block until they are read, so fn never
+// runs ahead of the reader. The error returned by fn is returned by
+// Read after the transformed body, and Close stops fn.
+func Transform(fn TransformFunc) Stage {
+	return func(body io.Reader) io.Reader {
+		return &transformer{body: body, fn: fn}
+	}
+}
+
+// Tee returns a stage writing the body to writers while it's read,
+// e.g. for hashing or mirroring it.
+func Tee(writers ...io.Writer) Stage {
+	return func(body io.Reader) io.Reader {
+		return &wrapper{
+			Reader: io.TeeReader(body, io.MultiWriter(writers...)),
+			body:   body,
+		}
+	}
+}
+
+// OnEOF returns a stage calling fn once the body is read to the end,
+// with nil, or is failed to read, with the error.
+func OnEOF(fn func(err error)) Stage {
+	return func(body io.Reader) io.Reader {
+		return &observer{body: body, fn: fn}
+	}
+}
+
+func closeBody(body io.Reader) error {
+	if closer, ok := body.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (w *wrapper) Close() error {
+	return closeBody(w.body)
+}
+
+func (t *transformer) start() {
+	pr, pw := io.Pipe()
+	t.pr = pr
+	go func() {
+		// NOTE: CloseWithError(nil) makes the reader get io.EOF.
+		pw.CloseWithError(t.fn(pw, t.body))
+	}()
+}
+
+func (t *transformer) Read(p []byte) (int, error) {
+	t.once.Do(t.start)
+	if t.pr == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return t.pr.Read(p)
+}
+
+func (t *transformer) Close() error {
+	// NOTE: Don't start the goroutine if it's never read.
+	t.once.Do(func() {})
+	if t.pr != nil {
+		t.pr.Close()
+	}
+	return closeBody(t.body)
+}
+
+func (o *observer) Read(p []byte) (int, error) {
+	n, err := o.body.Read(p)
+	if err != nil && !o.done {
+		o.done = true
+		if err == io.EOF {
+			o.fn(nil)
+		} else {
+			o.fn(err)
+		}
+	}
+	return n, err
+}
+
+func (o *observer) Close() error {
+	return closeBody(o.body)
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodystream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func gzipFunc(dst io.Writer, src io.Reader) error {
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func TestChain(t *testing.T) {
+	data := strings.Repeat("easegress", 100000)
+	body := &closeRecorder{Reader: strings.NewReader(data)}
+
+	hash := sha256.New()
+	var eofErr error
+	eofCalled := 0
+
+	r := Chain(body,
+		Tee(hash),
+		OnEOF(func(err error) { eofCalled, eofErr = eofCalled+1, err }),
+		Transform(gzipFunc),
+	)
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("new gzip reader failed: %v", err)
+	}
+	got, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("read body failed: %v", err)
+	}
+	if string(got) != data {
+		t.Errorf("body mismatched")
+	}
+
+	if eofCalled != 1 || eofErr != nil {
+		t.Errorf("want OnEOF called once with nil, got %d, %v", eofCalled, eofErr)
+	}
+	sum := sha256.Sum256([]byte(data))
+	if !bytes.Equal(hash.Sum(nil), sum[:]) {
+		t.Errorf("hash mismatched")
+	}
+
+	r.(io.Closer).Close()
+	if !body.closed {
+		t.Errorf("want body closed")
+	}
+}
+
+func TestTransformError(t *testing.T) {
+	r := Chain(strings.NewReader("abc"), Transform(func(dst io.Writer, src io.Reader) error {
+		io.Copy(dst, src)
+		return fmt.Errorf("broken")
+	}))
+
+	got, err := ioutil.ReadAll(r)
+	if string(got) != "abc" || err == nil || err.Error() != "broken" {
+		t.Errorf("want abc and error broken, got %s, %v", got, err)
+	}
+}
+
+func TestTransformBackpressure(t *testing.T) {
+	var written int32
+	r := Chain(strings.NewReader(""), Transform(func(dst io.Writer, src io.Reader) error {
+		for i := 0; i < 100; i++ {
+			if _, err := dst.Write([]byte("x")); err != nil {
+				return err
+			}
+			atomic.AddInt32(&written, 1)
+		}
+		return nil
+	}))
+
+	p := make([]byte, 1)
+	for i := 0; i < 3; i++ {
+		r.Read(p)
+	}
+	r.(io.Closer).Close()
+
+	// NOTE: The write after the last read may have completed.
+	if n := atomic.LoadInt32(&written); n > 4 {
+		t.Errorf("want at most 4 writes before close, got %d", n)
+	}
+
+	var unread Stage = Transform(gzipFunc)
+	if err := unread(strings.NewReader("")).(io.Closer).Close(); err != nil {
+		t.Errorf("want closing unread body succeed, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package celexpr evaluates CEL(https://github.com/google/cel-spec)
+// expressions as conditions over HTTPContext.
+//
+// The variables are:
+//
+//	request.method   string
+//	request.scheme   string
+//	request.host     string
+//	request.path     string
+//	request.query    map(string, string)
+//	request.headers  map(string, string)
+//	request.realIP   string
+//	response.status  int
+//	response.headers map(string, string)
+//
+// Keys of headers are in lower case, and only the first value of a
+// header or a query parameter is in the maps. Accessing a missing key
+// is an error, so it should be checked by `in` first, e.g.
+// `"x-user" in request.headers && request.headers["x-user"] != ""`.
+package celexpr
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+type (
+	// Expression is a compiled boolean CEL expression, it is safe for
+	// concurrent use.
+	Expression struct {
+		source  string
+		program cel.Program
+	}
+)
+
+var (
+	env     *cel.Env
+	envErr  error
+	envOnce sync.Once
+)
+
+func getEnv() (*cel.Env, error) {
+	envOnce.Do(func() {
+		stringMap := decls.NewMapType(decls.String, decls.String)
+		env, envErr = cel.NewEnv(cel.Declarations(
+			decls.NewVar("request.method", decls.String),
+			decls.NewVar("request.scheme", decls.String),
+			decls.NewVar("request.host", decls.String),
+			decls.NewVar("request.path", decls.String),
+			decls.NewVar("request.query", stringMap),
+			decls.NewVar("request.headers", stringMap),
+			decls.NewVar("request.realIP", decls.String),
+			decls.NewVar("response.status", decls.Int),
+			decls.NewVar("response.headers", stringMap),
+		))
+	})
+
+	return env, envErr
+}
+
+// Compile compiles the source to an Expression, the source must be
+// evaluated to bool.
+func Compile(source string) (*Expression, error) {
+	env, err := getEnv()
+	if err != nil {
+		return nil, fmt.Errorf("BUG: create cel env failed: %v", err)
+	}
+
+	ast, iss := env.Compile(source)
+	if iss != nil && iss.Err() != nil {
+		return nil, fmt.Errorf("compile %s failed: %v", source, iss.Err())
+	}
+	if !proto.Equal(ast.ResultType(), decls.Bool) {
+		return nil, fmt.Errorf("%s: want bool, got %v", source, ast.ResultType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("create program for %s failed: %v", source, err)
+	}
+
+	return &Expression{source: source, program: program}, nil
+}
+
+// String returns the source of the Expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the Expression over HTTPContext.
+func (e *Expression) Eval(ctx context.HTTPContext) (bool, error) {
+	val, _, err := e.program.Eval(newActivation(ctx))
+	if err != nil {
+		return false, fmt.Errorf("eval %s failed: %v", e.source, err)
+	}
+
+	result, ok := val.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("eval %s: want bool, got %T", e.source, val.Value())
+	}
+
+	return result, nil
+}
+
+// Match returns true only if the Expression is evaluated to true.
+func (e *Expression) Match(ctx context.HTTPContext) bool {
+	result, err := e.Eval(ctx)
+	return err == nil && result
+}
+
+// NOTE: The values are lazy, so only the used ones are built.
+func newActivation(ctx context.HTTPContext) map[string]interface{} {
+	r, w := ctx.Request(), ctx.Response()
+
+	return map[string]interface{}{
+		"request.method": func() interface{} { return r.Method() },
+		"request.scheme": func() interface{} { return r.Scheme() },
+		"request.host":   func() interface{} { return r.Host() },
+		"request.path":   func() interface{} { return r.Path() },
+		"request.query": func() interface{} {
+			query := map[string]string{}
+			values, _ := url.ParseQuery(r.Query())
+			for key, values := range values {
+				if len(values) > 0 {
+					query[key] = values[0]
+				}
+			}
+			return query
+		},
+		"request.headers":  func() interface{} { return headerMap(r.Header()) },
+		"request.realIP":   func() interface{} { return r.RealIP() },
+		"response.status":  func() interface{} { return w.StatusCode() },
+		"response.headers": func() interface{} { return headerMap(w.Header()) },
+	}
+}
+
+func headerMap(h *httpheader.HTTPHeader) map[string]string {
+	m := map[string]string{}
+	h.VisitAll(func(key, value string) {
+		key = strings.ToLower(key)
+		if _, exists := m[key]; !exists {
+			m[key] = value
+		}
+	})
+	return m
+}
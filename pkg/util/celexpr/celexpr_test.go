@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package celexpr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{source: `request.method == "GET"`},
+		{source: `request.path.startsWith("/api") && request.headers["x-user"] != ""`},
+		{source: `response.status >= 500`},
+		{source: `request.method`, wantErr: true},
+		{source: `request.unknown == "a"`, wantErr: true},
+		{source: `request.method ==`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		_, err := Compile(tc.source)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: want error %v, got %v", tc.source, tc.wantErr, err)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/api/users?id=7&id=8", nil)
+	r.Header.Set("X-User", "alice")
+	r.Header.Add("X-Group", "dev")
+	r.Header.Add("X-Group", "ops")
+	ctx := context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "")
+	ctx.Response().SetStatusCode(http.StatusBadGateway)
+
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{source: `request.method == "POST"`, want: true},
+		{source: `request.host == "example.com" && request.path.startsWith("/api/")`, want: true},
+		{source: `request.query["id"] == "7"`, want: true},
+		{source: `"name" in request.query`, want: false},
+		{source: `request.headers["x-user"] == "alice"`, want: true},
+		{source: `request.headers["x-group"] == "dev"`, want: true},
+		{source: `request.headers["x-user"].matches("^b")`, want: false},
+		{source: `response.status == 502`, want: true},
+		// NOTE: Missing keys are evaluation errors.
+		{source: `request.headers["x-none"] == ""`, want: false},
+	}
+
+	for _, tc := range tests {
+		e, err := Compile(tc.source)
+		if err != nil {
+			t.Fatalf("%s: compile failed: %v", tc.source, err)
+		}
+		if got := e.Match(ctx); got != tc.want {
+			t.Errorf("%s: want %v, got %v", tc.source, tc.want, got)
+		}
+	}
+}
@@ -270,6 +270,16 @@ type (
 	// EventListenerFunc is a listener function to listen state transit event
 	EventListenerFunc func(event *Event)
 
+	// Snapshot is the state of a circuit breaker at a moment, the rates
+	// are of the results recorded in the current window.
+	Snapshot struct {
+		State       string    `yaml:"state"`
+		Since       time.Time `yaml:"since"`
+		Calls       uint32    `yaml:"calls"`
+		FailureRate uint8     `yaml:"failureRate"`
+		SlowRate    uint8     `yaml:"slowRate"`
+	}
+
 	// CircuitBreaker defines a circuit breaker
 	CircuitBreaker struct {
 		lock                    sync.Mutex
@@ -385,6 +395,23 @@ func (cb *CircuitBreaker) State() State {
 	return cb.state
 }
 
+// Snapshot returns the state of the circuit breaker at the moment.
+func (cb *CircuitBreaker) Snapshot() *Snapshot {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	s := &Snapshot{
+		State: stateStrings[cb.state],
+		Since: cb.transitTime,
+	}
+	if cb.window != nil && cb.window.Total() > 0 {
+		s.Calls = cb.window.Total()
+		s.FailureRate = cb.window.FailureRate()
+		s.SlowRate = cb.window.SlowRate()
+	}
+	return s
+}
+
 // AcquirePermission acquires a permission from the circuit breaker
 // returns true & stateID if the request is permitted
 // returns false & stateID if the request is rejected
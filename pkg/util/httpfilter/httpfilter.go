@@ -24,6 +24,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/celexpr"
 	"github.com/megaease/easegress/pkg/util/hashtool"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
@@ -44,11 +45,14 @@ type (
 		Headers     map[string]*urlrule.StringMatch `yaml:"headers" jsonschema:"omitempty"`
 		URLs        []*urlrule.URLRule              `yaml:"urls" jsonschema:"omitempty"`
 		Probability *Probability                    `yaml:"probability,omitempty" jsonschema:"omitempty"`
+		// Expression is a CEL expression, see package celexpr for variables.
+		Expression string `yaml:"expression,omitempty" jsonschema:"omitempty"`
 	}
 
 	// HTTPFilter filters HTTP traffic.
 	HTTPFilter struct {
-		spec *Spec
+		spec       *Spec
+		expression *celexpr.Expression
 	}
 
 	// Probability filters HTTP traffic by probability.
@@ -70,14 +74,21 @@ func (p Probability) Validate() error {
 
 // Validate validates Spec
 func (s Spec) Validate() error {
-	if len(s.Headers) == 0 && s.Probability == nil {
-		return fmt.Errorf("none of headers and probability is specified")
+	if len(s.Headers) == 0 && s.Probability == nil && s.Expression == "" {
+		return fmt.Errorf("none of headers, probability and expression is specified")
 	}
 
 	if len(s.Headers) > 0 && s.Probability != nil {
 		return fmt.Errorf("both headers and probability are specified")
 	}
 
+	if s.Expression != "" {
+		_, err := celexpr.Compile(s.Expression)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -95,11 +106,28 @@ func New(spec *Spec) *HTTPFilter {
 		url.Init()
 	}
 
+	if spec.Expression != "" {
+		var err error
+		hf.expression, err = celexpr.Compile(spec.Expression)
+		if err != nil {
+			logger.Errorf("BUG: %v", err)
+		}
+	}
+
 	return hf
 }
 
 // Filter filters HTTPContext.
 func (hf *HTTPFilter) Filter(ctx context.HTTPContext) bool {
+	if hf.spec.Expression != "" {
+		if hf.expression == nil || !hf.expression.Match(ctx) {
+			return false
+		}
+		if len(hf.spec.Headers) == 0 && hf.spec.Probability == nil {
+			return true
+		}
+	}
+
 	if len(hf.spec.Headers) > 0 {
 		matchHeader := hf.filterHeader(ctx)
 		if len(hf.spec.URLs) > 0 {
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package interpolation interpolates environment variables and files in
+// the string values of object specs.
+//
+// ${ENV:NAME} is replaced by the environment variable NAME, and it's an
+// error if the variable is not set, unless a default is given in the form
+// of ${ENV:NAME:-default}. ${file:/path} is replaced by the content of the
+// file at the absolute path, without trailing newlines. $${...} escapes
+// the interpolation, it's replaced by ${...}.
+//
+// Anyone allowed to write objects could interpolate values and send them
+// out, e.g. in headers of proxied requests, so only the variables with the
+// prefixes and the files in the directories allowed by the options of the
+// server are interpolated, and never the keys of secrets of the server.
+package interpolation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const (
+	sourceEnv  = "ENV"
+	sourceFile = "file"
+
+	defaultSeparator = ":-"
+)
+
+var (
+	pattern = regexp.MustCompile(`\$?\$\{(` + sourceEnv + `|` + sourceFile + `):([^}]*)\}`)
+
+	// deniedEnvs are the environment variables of the keys of secrets,
+	// they're never interpolated even if their prefixes are allowed.
+	deniedEnvs = map[string]struct{}{
+		"EG_MASTER_KEY": {},
+		"VAULT_TOKEN":   {},
+	}
+
+	policyMutex sync.RWMutex
+	envPrefixes []string
+	fileDirs    []string
+	// deniedFiles are the files of the keys of secrets of the server,
+	// they're never interpolated even if their directories are allowed.
+	deniedFiles map[string]struct{}
+)
+
+// Init sets what could be interpolated by the options, nothing could be
+// interpolated before it's called.
+func Init(opt *option.Options) {
+	setPolicy(opt.InterpolationEnvPrefixes, opt.InterpolationFileDirs, []string{
+		opt.MasterKeyFile,
+		opt.VaultTokenFile,
+		opt.AbsAPIAuthFile,
+		opt.AbsAPITLSKeyFile,
+		opt.ClusterEtcdKeyFile,
+	})
+}
+
+func setPolicy(prefixes, dirs, files []string) {
+	policyMutex.Lock()
+	defer policyMutex.Unlock()
+
+	envPrefixes, fileDirs, deniedFiles = nil, nil, map[string]struct{}{}
+	for _, prefix := range prefixes {
+		if prefix != "" {
+			envPrefixes = append(envPrefixes, prefix)
+		}
+	}
+	for _, dir := range dirs {
+		if dir != "" {
+			fileDirs = append(fileDirs, realPath(dir))
+		}
+	}
+	for _, file := range files {
+		if file != "" {
+			deniedFiles[realPath(file)] = struct{}{}
+		}
+	}
+}
+
+// realPath returns the absolute path with symbolic links evaluated, or the
+// cleaned absolute path if it doesn't exist.
+func realPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs
+	}
+	return real
+}
+
+func envAllowed(name string) bool {
+	if _, denied := deniedEnvs[name]; denied {
+		return false
+	}
+
+	policyMutex.RLock()
+	defer policyMutex.RUnlock()
+
+	for _, prefix := range envPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileAllowed returns if the file is in an allowed directory, after
+// evaluating symbolic links, so they can't point out of the directories.
+func fileAllowed(path string) bool {
+	path = realPath(path)
+
+	policyMutex.RLock()
+	defer policyMutex.RUnlock()
+
+	if _, denied := deniedFiles[path]; denied {
+		return false
+	}
+	for _, dir := range fileDirs {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveYAML interpolates all string values of the YAML config, the
+// config is returned as it is if there is nothing to interpolate.
+func ResolveYAML(config string) (string, error) {
+	if !pattern.MatchString(config) {
+		return config, nil
+	}
+
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	doc, err = resolveValue(doc)
+	if err != nil {
+		return "", err
+	}
+
+	buff, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("marshal failed: %v", err)
+	}
+	return string(buff), nil
+}
+
+// Resolve interpolates the string.
+func Resolve(s string) (string, error) {
+	var err error
+	result := pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		if err != nil {
+			return match
+		}
+
+		sub := pattern.FindStringSubmatch(match)
+		var value string
+		switch sub[1] {
+		case sourceEnv:
+			value, err = lookupEnv(sub[2])
+		case sourceFile:
+			value, err = readFile(sub[2])
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+func lookupEnv(ref string) (string, error) {
+	name, defaultValue, hasDefault := ref, "", false
+	if i := strings.Index(ref, defaultSeparator); i >= 0 {
+		name, defaultValue, hasDefault = ref[:i], ref[i+len(defaultSeparator):], true
+	}
+	if name == "" {
+		return "", fmt.Errorf("empty name of environment variable in ${%s:%s}", sourceEnv, ref)
+	}
+	if !envAllowed(name) {
+		return "", fmt.Errorf("environment variable %s is not allowed to be interpolated", name)
+	}
+
+	value, exists := os.LookupEnv(name)
+	if exists {
+		return value, nil
+	}
+	if hasDefault {
+		return defaultValue, nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
+
+func readFile(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %s in ${%s:%s} is not absolute", path, sourceFile, path)
+	}
+	if !fileAllowed(path) {
+		return "", fmt.Errorf("file %s is not allowed to be interpolated", path)
+	}
+
+	buff, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read file %s failed: %v", path, err)
+	}
+	return strings.TrimRight(string(buff), "\r\n"), nil
+}
+
+func resolveValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return Resolve(v)
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			resolved, err := resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package interpolation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	os.Setenv("EG_TEST_HOST", "10.0.0.1")
+	defer os.Unsetenv("EG_TEST_HOST")
+	os.Unsetenv("EG_TEST_UNSET")
+
+	dir, err := ioutil.TempDir("", "interpolation")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	token := filepath.Join(dir, "token")
+	ioutil.WriteFile(token, []byte("secret-token\n"), 0600)
+	masterKey := filepath.Join(dir, "master.key")
+	ioutil.WriteFile(masterKey, []byte("master-key\n"), 0600)
+
+	outside, err := ioutil.TempDir("", "interpolation")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(outside)
+	outsideToken := filepath.Join(outside, "token")
+	ioutil.WriteFile(outsideToken, []byte("outside-token\n"), 0600)
+	link := filepath.Join(dir, "link")
+	os.Symlink(outsideToken, link)
+
+	setPolicy([]string{"EG_TEST_", "EG_"}, []string{dir}, []string{masterKey})
+	defer setPolicy(nil, nil, nil)
+
+	for _, c := range []struct {
+		s    string
+		want string
+	}{
+		{"http://${ENV:EG_TEST_HOST}:8080", "http://10.0.0.1:8080"},
+		{"${ENV:EG_TEST_UNSET:-default}", "default"},
+		{"${ENV:EG_TEST_HOST:-default}", "10.0.0.1"},
+		{"Bearer ${file:" + token + "}", "Bearer secret-token"},
+		{"$${ENV:EG_TEST_HOST}", "${ENV:EG_TEST_HOST}"},
+		{"${jndi:ldap://example}", "${jndi:ldap://example}"},
+	} {
+		got, err := Resolve(c.s)
+		if err != nil {
+			t.Errorf("resolve %s failed: %v", c.s, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("resolve %s: want %s, got %s", c.s, c.want, got)
+		}
+	}
+
+	for _, s := range []string{
+		"${ENV:EG_TEST_UNSET}",
+		"${ENV:}",
+		"${file:relative/token}",
+		"${file:" + filepath.Join(dir, "missing") + "}",
+		"${ENV:HOME}",
+		"${ENV:HOME:-default}",
+		"${ENV:EG_MASTER_KEY}",
+		"${file:" + outsideToken + "}",
+		"${file:" + dir + "/../" + filepath.Base(outside) + "/token}",
+		"${file:" + link + "}",
+		"${file:" + masterKey + "}",
+	} {
+		if _, err := Resolve(s); err == nil {
+			t.Errorf("want error for %s", s)
+		}
+	}
+}
+
+func TestResolveYAML(t *testing.T) {
+	os.Setenv("EG_TEST_HOST", "10.0.0.1")
+	defer os.Unsetenv("EG_TEST_HOST")
+
+	setPolicy([]string{"EG_TEST_"}, nil, nil)
+	defer setPolicy(nil, nil, nil)
+
+	config := "name: proxy\n"
+	got, err := ResolveYAML(config)
+	if err != nil || got != config {
+		t.Errorf("want config unchanged, got %q, %v", got, err)
+	}
+
+	got, err = ResolveYAML("servers:\n- url: http://${ENV:EG_TEST_HOST}:8080\n")
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	want := "servers:\n- url: http://10.0.0.1:8080\n"
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
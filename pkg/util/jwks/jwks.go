@@ -0,0 +1,367 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultRefreshInterval = time.Hour
+	defaultTimeout         = 10 * time.Second
+
+	// minRefreshInterval limits refreshing for unknown key ids, so
+	// tokens with random key ids can't flood the JWKS server.
+	minRefreshInterval = 10 * time.Second
+
+	maxSize = 1024 * 1024
+)
+
+type (
+	// Spec describes the JSON Web Key Set to fetch keys from.
+	Spec struct {
+		URL             string `yaml:"url" jsonschema:"required,format=uri"`
+		RefreshInterval string `yaml:"refreshInterval" jsonschema:"omitempty,format=duration"`
+		Timeout         string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		InsecureTLS     bool   `yaml:"insecureTls" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of JWKS.
+	Status struct {
+		Keys        int    `yaml:"keys"`
+		LastRefresh string `yaml:"lastRefresh,omitempty"`
+		LastError   string `yaml:"lastError,omitempty"`
+	}
+
+	// JWKS caches keys of a JSON Web Key Set and refreshes them.
+	JWKS struct {
+		spec            *Spec
+		client          *http.Client
+		refreshInterval time.Duration
+
+		mutex       sync.Mutex
+		keys        []*jwk
+		lastRefresh time.Time
+		lastError   string
+		// refreshing is closed when the refresh in progress is done.
+		refreshing chan struct{}
+
+		done chan struct{}
+	}
+
+	jwk struct {
+		kid string
+		// kty is RSA, EC or oct.
+		kty string
+		key interface{}
+	}
+
+	jsonWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		K   string `json:"k"`
+	}
+)
+
+func parseDuration(d string, dflt time.Duration) time.Duration {
+	if d == "" {
+		return dflt
+	}
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", d, err)
+		return dflt
+	}
+	return duration
+}
+
+// New creates a JWKS and starts refreshing keys in background.
+func New(spec *Spec) *JWKS {
+	j := &JWKS{
+		spec:            spec,
+		refreshInterval: parseDuration(spec.RefreshInterval, defaultRefreshInterval),
+		done:            make(chan struct{}),
+	}
+	j.client = newHTTPClient(spec.InsecureTLS, parseDuration(spec.Timeout, defaultTimeout))
+
+	go j.run()
+
+	return j
+}
+
+func (j *JWKS) run() {
+	ticker := time.NewTicker(j.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		j.refresh(true)
+
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh fetches keys without holding the lock, so validating with the
+// cached keys isn't blocked while fetching. Concurrent refreshes wait for
+// the one in progress instead of fetching again, and the refresh is
+// skipped if keys were just refreshed, unless it's forced.
+func (j *JWKS) refresh(force bool) {
+	j.mutex.Lock()
+	if refreshing := j.refreshing; refreshing != nil {
+		j.mutex.Unlock()
+		<-refreshing
+		return
+	}
+	if !force && time.Since(j.lastRefresh) < minRefreshInterval {
+		j.mutex.Unlock()
+		return
+	}
+	refreshing := make(chan struct{})
+	j.refreshing = refreshing
+	j.mutex.Unlock()
+
+	keys, err := j.fetch()
+
+	j.mutex.Lock()
+	j.update(keys, err)
+	j.refreshing = nil
+	j.mutex.Unlock()
+	close(refreshing)
+}
+
+// update updates keys by the result of fetching, the caller must hold the lock.
+func (j *JWKS) update(keys []*jwk, err error) {
+	j.lastRefresh = time.Now()
+
+	if err != nil {
+		j.lastError = err.Error()
+		logger.Errorf("fetch jwks from %s failed: %v", j.spec.URL, err)
+		return
+	}
+
+	j.keys, j.lastError = keys, ""
+}
+
+func (j *JWKS) fetch() ([]*jwk, error) {
+	resp, err := j.client.Get(j.spec.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	return parseJWKS(body)
+}
+
+func parseJWKS(buff []byte) ([]*jwk, error) {
+	var set struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	err := json.Unmarshal(buff, &set)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal jwks failed: %v", err)
+	}
+
+	var keys []*jwk
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			// NOTE: Skip keys not supported, others are still usable.
+			logger.Warnf("skip jwk %s: %v", k.Kid, err)
+			continue
+		}
+		keys = append(keys, &jwk{kid: k.Kid, kty: k.Kty, key: key})
+	}
+
+	return keys, nil
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buff, err := decodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buff), nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %v", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %v", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %v", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "oct":
+		secret, err := decodeSegment(k.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid k: %v", err)
+		}
+		return secret, nil
+	}
+
+	return nil, fmt.Errorf("unsupported kty %s", k.Kty)
+}
+
+func ktyOf(alg string) string {
+	switch alg[:2] {
+	case "RS":
+		return "RSA"
+	case "ES":
+		return "EC"
+	default:
+		return "oct"
+	}
+}
+
+// Key returns the key of the kid for the algorithm, keys are refreshed
+// if the kid is not found, e.g. the keys are rotated.
+func (j *JWKS) Key(kid, alg string) (interface{}, error) {
+	j.mutex.Lock()
+	key := j.find(kid, alg)
+	recent := time.Since(j.lastRefresh) < minRefreshInterval
+	j.mutex.Unlock()
+
+	if key != nil {
+		return key, nil
+	}
+	if recent {
+		return nil, fmt.Errorf("key %q not found", kid)
+	}
+
+	j.refresh(false)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if key := j.find(kid, alg); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("key %q not found", kid)
+}
+
+// find finds the key, the caller must hold the lock. If kid is empty,
+// the first key of the type is used.
+func (j *JWKS) find(kid, alg string) interface{} {
+	kty := ktyOf(alg)
+	for _, k := range j.keys {
+		if k.kty == kty && (kid == "" || k.kid == kid) {
+			return k.key
+		}
+	}
+	return nil
+}
+
+// Status returns the status of JWKS.
+func (j *JWKS) Status() *Status {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	s := &Status{
+		Keys:      len(j.keys),
+		LastError: j.lastError,
+	}
+	if !j.lastRefresh.IsZero() {
+		s.LastRefresh = j.lastRefresh.Format(time.RFC3339)
+	}
+	return s
+}
+
+// Close stops refreshing keys.
+func (j *JWKS) Close() {
+	close(j.done)
+}
+
+func newHTTPClient(insecureTLS bool, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: insecureTLS,
+			},
+		},
+	}
+}
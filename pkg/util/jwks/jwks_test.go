@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	absLogDir := filepath.Join(os.TempDir(), "eg-test", "jwks-log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "jwks-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(absLogDir)
+	os.Exit(code)
+}
+
+func TestRefreshWithoutBlocking(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		w.Write([]byte(`{"keys": [{"kty": "oct", "kid": "key-1", "k": "c2VjcmV0"}]}`))
+	}))
+	defer server.Close()
+
+	j := New(&Spec{URL: server.URL})
+	defer j.Close()
+
+	for i := 0; j.Status().Keys == 0; i++ {
+		if i == 100 {
+			t.Fatalf("keys are not fetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	j.mutex.Lock()
+	j.lastRefresh = time.Now().Add(-minRefreshInterval)
+	j.mutex.Unlock()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := j.Key("key-2", "HS256"); err == nil {
+				t.Errorf("want error for unknown key")
+			}
+		}()
+	}
+
+	for i := 0; atomic.LoadInt32(&fetches) < 2; i++ {
+		if i == 100 {
+			t.Fatalf("keys are not refreshed for unknown key")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if key, err := j.Key("key-1", "HS256"); err != nil || string(key.([]byte)) != "secret" {
+			t.Errorf("want cached key, got %v, %v", key, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("cached key is blocked by refreshing")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("want concurrent refreshes fetch once, got %d fetches", n-1)
+	}
+}
@@ -47,6 +47,16 @@ type (
 	// EventListenerFunc is a listener function to listen state transit event
 	EventListenerFunc func(event *Event)
 
+	// Snapshot is the state of a rate limiter at a moment, tokens are the
+	// ones permitted from the beginning of the current cycle, including
+	// the reserved ones of the requests waiting, which are limited by
+	// maxTokens.
+	Snapshot struct {
+		State     string `yaml:"state"`
+		Tokens    int    `yaml:"tokens"`
+		MaxTokens int    `yaml:"maxTokens"`
+	}
+
 	// RateLimiter defines a rate limiter
 	RateLimiter struct {
 		lock      sync.Mutex
@@ -124,6 +134,27 @@ func (rl *RateLimiter) notifyListener(tm time.Time, state State) {
 	}
 }
 
+// Snapshot returns the state of the rate limiter at the moment.
+func (rl *RateLimiter) Snapshot() *Snapshot {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	s := &Snapshot{State: stateStrings[rl.state]}
+	if rl.state == StateDisabled {
+		return s
+	}
+
+	s.MaxTokens = rl.policy.LimitForPeriod
+	s.MaxTokens *= int(rl.policy.TimeoutDuration/rl.policy.LimitRefreshPeriod) + 1
+
+	cycle := int(nowFunc().Sub(rl.startTime) / rl.policy.LimitRefreshPeriod)
+	s.Tokens = rl.tokens - (cycle-rl.cycle)*rl.policy.LimitForPeriod
+	if s.Tokens < 0 {
+		s.Tokens = 0
+	}
+	return s
+}
+
 // AcquirePermission acquires a permission from the rate limiter.
 // returns true if the request is permitted and false otherwise.
 // when permitted, the caller should wait returned duration before action.
@@ -157,3 +157,30 @@ func TestRateLimiter(t *testing.T) {
 		t.Errorf("wait duration should not be: %s", d.String())
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	policy := Policy{
+		LimitRefreshPeriod: time.Millisecond * 10,
+		TimeoutDuration:    time.Millisecond * 10,
+		LimitForPeriod:     2,
+	}
+	limiter := New(&policy)
+
+	for i := 0; i < 3; i++ {
+		limiter.AcquirePermission()
+	}
+	s := limiter.Snapshot()
+	if s.State != "Limiting" || s.Tokens != 3 || s.MaxTokens != 4 {
+		t.Errorf("want limiting with 3 of 4 tokens, got %+v", s)
+	}
+
+	now = now.Add(time.Millisecond * 20)
+	if s := limiter.Snapshot(); s.Tokens != 0 {
+		t.Errorf("want no tokens after 2 cycles, got %+v", s)
+	}
+
+	limiter.SetState(StateDisabled)
+	if s := limiter.Snapshot(); s.State != "Disabled" || s.MaxTokens != 0 {
+		t.Errorf("want disabled, got %+v", s)
+	}
+}
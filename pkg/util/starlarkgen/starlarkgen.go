@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package starlarkgen generates object specs by Starlark scripts.
+//
+// A script defines the function `main()` which returns a spec or a
+// list of specs, and a spec is a dict with string keys. Other scripts
+// could be loaded by `load("path/to/lib.star", "symbol")`, the path is
+// relative to the directory of the loading script.
+package starlarkgen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+	"go.starlark.net/starlarkstruct"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	mainFunc = "main"
+
+	// DefaultMaxSteps is the default maximum execution steps of scripts.
+	DefaultMaxSteps = 100000000
+)
+
+type (
+	// Generator generates specs by Starlark scripts.
+	Generator struct {
+		maxSteps uint64
+		modules  map[string]*module
+	}
+
+	module struct {
+		globals starlark.StringDict
+		err     error
+	}
+)
+
+var predeclared = starlark.StringDict{
+	"json":   starlarkjson.Module,
+	"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+}
+
+// New creates a Generator, scripts are stopped after maxSteps execution
+// steps, and 0 means DefaultMaxSteps.
+func New(maxSteps uint64) *Generator {
+	if maxSteps == 0 {
+		maxSteps = DefaultMaxSteps
+	}
+
+	return &Generator{
+		maxSteps: maxSteps,
+		modules:  map[string]*module{},
+	}
+}
+
+// GenerateFile generates specs by the script in the file.
+func (g *Generator) GenerateFile(filename string) ([]map[string]interface{}, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.Generate(filename, src)
+}
+
+// Generate generates specs by the script src, filename is used to
+// report errors and resolve loaded files.
+func (g *Generator) Generate(filename string, src []byte) ([]map[string]interface{}, error) {
+	thread := g.newThread(filename)
+
+	globals, err := starlark.ExecFile(thread, filename, src, predeclared)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := globals[mainFunc].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: function %s is not defined", filename, mainFunc)
+	}
+
+	ret, err := starlark.Call(thread, fn, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []starlark.Value
+	switch ret := ret.(type) {
+	case *starlark.Dict:
+		values = []starlark.Value{ret}
+	case *starlark.List:
+		for i := 0; i < ret.Len(); i++ {
+			values = append(values, ret.Index(i))
+		}
+	case starlark.Tuple:
+		values = ret
+	default:
+		return nil, fmt.Errorf("%s: %s returns %s, want dict or list", filename, mainFunc, ret.Type())
+	}
+
+	specs := make([]map[string]interface{}, 0, len(values))
+	for i, v := range values {
+		spec, ok := v.(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("%s: spec %d is %s, want dict", filename, i, v.Type())
+		}
+		m, err := toGo(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: spec %d: %v", filename, i, err)
+		}
+		specs = append(specs, m.(map[string]interface{}))
+	}
+
+	return specs, nil
+}
+
+// GenerateYAML generates specs by the script src, and returns them in
+// YAML documents.
+func (g *Generator) GenerateYAML(filename string, src []byte) ([][]byte, error) {
+	specs, err := g.Generate(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([][]byte, 0, len(specs))
+	for _, spec := range specs {
+		buff, err := yaml.Marshal(spec)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %#v to yaml failed: %v", spec, err)
+		}
+		docs = append(docs, buff)
+	}
+
+	return docs, nil
+}
+
+func (g *Generator) newThread(filename string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: filename,
+		Load: g.load,
+	}
+	thread.SetMaxExecutionSteps(g.maxSteps)
+	return thread
+}
+
+// load loads the module relative to the directory of the loading file,
+// modules are loaded only once in a Generator.
+func (g *Generator) load(thread *starlark.Thread, name string) (starlark.StringDict, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(thread.Name), name)
+	}
+
+	m, exists := g.modules[name]
+	if exists {
+		if m.globals == nil && m.err == nil {
+			return nil, fmt.Errorf("cycle in load graph: %s", name)
+		}
+		return m.globals, m.err
+	}
+
+	m = &module{}
+	g.modules[name] = m
+
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		m.err = err
+		return nil, err
+	}
+
+	m.globals, m.err = starlark.ExecFile(g.newThread(name), name, src, predeclared)
+	return m.globals, m.err
+}
+
+// toGo converts Starlark values to Go values which could be marshaled
+// to YAML.
+func toGo(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("int %s overflows", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case *starlark.List:
+		list := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := toGo(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, e)
+		}
+		return list, nil
+	case starlark.Tuple:
+		list := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			e, err := toGo(e)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, e)
+		}
+		return list, nil
+	case *starlark.Dict:
+		m := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is %s, want string", item[0], item[0].Type())
+			}
+			value, err := toGo(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[string(key)] = value
+		}
+		return m, nil
+	case *starlarkstruct.Struct:
+		d := starlark.StringDict{}
+		v.ToStringDict(d)
+		m := make(map[string]interface{}, len(d))
+		for key, value := range d {
+			value, err := toGo(value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
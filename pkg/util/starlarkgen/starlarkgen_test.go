@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package starlarkgen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const libScript = `
+def pipeline(name, backend):
+    return {
+        "name": name,
+        "kind": "HTTPPipeline",
+        "flow": [{"filter": "proxy"}],
+        "filters": [{
+            "name": "proxy",
+            "kind": "Proxy",
+            "mainPool": {"servers": [{"url": backend}]},
+        }],
+    }
+`
+
+const mainScript = `
+load("lib.star", "pipeline")
+
+def main():
+    return [pipeline("pipeline-%d" % i, "http://127.0.0.1:%d" % (9090 + i)) for i in range(3)]
+`
+
+func TestGenerateFile(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "lib.star"), []byte(libScript), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "main.star"), []byte(mainScript), 0644)
+
+	specs, err := New(0).GenerateFile(filepath.Join(dir, "main.star"))
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if len(specs) != 3 {
+		t.Fatalf("want 3 specs, got %d", len(specs))
+	}
+
+	want := map[string]interface{}{
+		"name": "pipeline-2",
+		"kind": "HTTPPipeline",
+		"flow": []interface{}{map[string]interface{}{"filter": "proxy"}},
+		"filters": []interface{}{map[string]interface{}{
+			"name": "proxy",
+			"kind": "Proxy",
+			"mainPool": map[string]interface{}{
+				"servers": []interface{}{map[string]interface{}{"url": "http://127.0.0.1:9092"}},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(specs[2], want) {
+		t.Errorf("want %#v, got %#v", want, specs[2])
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		script  string
+		want    int
+		wantErr bool
+	}{
+		{script: "def main():\n    return {'name': 'a', 'kind': 'HTTPServer'}", want: 1},
+		{script: "def main():\n    return ({'name': 'a'}, {'name': 'b'})", want: 2},
+		{script: "def main():\n    return [struct(name = 'a')]", wantErr: true},
+		{script: "def main():\n    return [{1: 'a'}]", wantErr: true},
+		{script: "def main():\n    return 'a'", wantErr: true},
+		{script: "def other():\n    return {}", wantErr: true},
+		{script: "def main():\n    return [{'n': i} for i in range(1000000000)]", wantErr: true},
+		{script: "load('missing.star', 'x')\ndef main():\n    return {}", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		specs, err := New(100000).Generate("test.star", []byte(tc.script))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: want error %v, got %v", tc.script, tc.wantErr, err)
+			continue
+		}
+		if len(specs) != tc.want {
+			t.Errorf("%q: want %d specs, got %d", tc.script, tc.want, len(specs))
+		}
+	}
+}
@@ -0,0 +1,362 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tlsfingerprint parses TLS ClientHello messages and computes the
+// JA3 and JA4 fingerprints of them.
+//
+// Reference:
+//
+//	https://github.com/salesforce/ja3
+//	https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+package tlsfingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	recordTypeHandshake      = 22
+	handshakeTypeClientHello = 1
+
+	extensionServerName          = 0
+	extensionSupportedGroups     = 10
+	extensionECPointFormats      = 11
+	extensionSignatureAlgorithms = 13
+	extensionALPN                = 16
+	extensionSupportedVersions   = 43
+)
+
+// ErrIncomplete means more data is required to parse the ClientHello.
+var ErrIncomplete = fmt.Errorf("incomplete client hello")
+
+// ClientHello is the fields of a ClientHello used by fingerprints, all of
+// them are kept in the order sent by the client, GREASE values included.
+type ClientHello struct {
+	Version             uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SupportedGroups     []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+	ALPNProtocols       []string
+	ServerName          string
+}
+
+// Parse parses the ClientHello from the first bytes sent by a client,
+// which are TLS records. It returns ErrIncomplete if data is not enough.
+func Parse(data []byte) (*ClientHello, error) {
+	// NOTE: A ClientHello could be fragmented into several records.
+	var msg []byte
+	s := cryptobyte.String(data)
+	for {
+		var typ uint8
+		var version uint16
+		var fragment cryptobyte.String
+		if !s.ReadUint8(&typ) {
+			return nil, ErrIncomplete
+		}
+		if typ != recordTypeHandshake {
+			return nil, fmt.Errorf("record type %d is not handshake", typ)
+		}
+		if !s.ReadUint16(&version) || !s.ReadUint16LengthPrefixed(&fragment) {
+			return nil, ErrIncomplete
+		}
+		msg = append(msg, fragment...)
+
+		if len(msg) >= 4 {
+			if msg[0] != handshakeTypeClientHello {
+				return nil, fmt.Errorf("handshake type %d is not client hello", msg[0])
+			}
+			length := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+			if len(msg) >= 4+length {
+				return parseClientHello(msg[4 : 4+length])
+			}
+		}
+	}
+}
+
+func parseClientHello(body []byte) (*ClientHello, error) {
+	ch := &ClientHello{}
+	s := cryptobyte.String(body)
+
+	var sessionID, cipherSuites, compressionMethods cryptobyte.String
+	if !s.ReadUint16(&ch.Version) || !s.Skip(32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!s.ReadUint8LengthPrefixed(&compressionMethods) {
+		return nil, fmt.Errorf("malformed client hello")
+	}
+
+	for !cipherSuites.Empty() {
+		var suite uint16
+		if !cipherSuites.ReadUint16(&suite) {
+			return nil, fmt.Errorf("malformed cipher suites")
+		}
+		ch.CipherSuites = append(ch.CipherSuites, suite)
+	}
+
+	if s.Empty() {
+		// Extensions are optional.
+		return ch, nil
+	}
+
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, fmt.Errorf("malformed extensions")
+	}
+	for !extensions.Empty() {
+		var typ uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&typ) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, fmt.Errorf("malformed extensions")
+		}
+		ch.Extensions = append(ch.Extensions, typ)
+		if !ch.parseExtension(typ, data) {
+			return nil, fmt.Errorf("malformed extension %d", typ)
+		}
+	}
+
+	return ch, nil
+}
+
+func (ch *ClientHello) parseExtension(typ uint16, data cryptobyte.String) bool {
+	switch typ {
+	case extensionServerName:
+		var list cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return false
+		}
+		for !list.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !list.ReadUint8(&nameType) || !list.ReadUint16LengthPrefixed(&name) {
+				return false
+			}
+			if nameType == 0 && ch.ServerName == "" {
+				ch.ServerName = string(name)
+			}
+		}
+	case extensionSupportedGroups:
+		var list cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return false
+		}
+		ch.SupportedGroups = readUint16s(list)
+	case extensionECPointFormats:
+		var list cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&list) {
+			return false
+		}
+		ch.PointFormats = append([]uint8(nil), list...)
+	case extensionSignatureAlgorithms:
+		var list cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return false
+		}
+		ch.SignatureAlgorithms = readUint16s(list)
+	case extensionALPN:
+		var list cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return false
+		}
+		for !list.Empty() {
+			var proto cryptobyte.String
+			if !list.ReadUint8LengthPrefixed(&proto) {
+				return false
+			}
+			ch.ALPNProtocols = append(ch.ALPNProtocols, string(proto))
+		}
+	case extensionSupportedVersions:
+		var list cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&list) {
+			return false
+		}
+		ch.SupportedVersions = readUint16s(list)
+	}
+
+	return true
+}
+
+func readUint16s(s cryptobyte.String) []uint16 {
+	var result []uint16
+	var v uint16
+	for s.ReadUint16(&v) {
+		result = append(result, v)
+	}
+	return result
+}
+
+// isGREASE reports whether v is a GREASE value defined in RFC 8701.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	result := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func joinDecimal(values []uint16) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(s, "-")
+}
+
+func joinHex(values []uint16) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(s, ",")
+}
+
+// JA3String returns the JA3 string of the ClientHello, which is
+// "SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats".
+func (ch *ClientHello) JA3String() string {
+	formats := make([]string, len(ch.PointFormats))
+	for i, f := range ch.PointFormats {
+		formats[i] = strconv.Itoa(int(f))
+	}
+
+	return fmt.Sprintf("%d,%s,%s,%s,%s", ch.Version,
+		joinDecimal(withoutGREASE(ch.CipherSuites)),
+		joinDecimal(withoutGREASE(ch.Extensions)),
+		joinDecimal(withoutGREASE(ch.SupportedGroups)),
+		strings.Join(formats, "-"))
+}
+
+// JA3 returns the JA3 fingerprint, the MD5 of the JA3 string.
+func (ch *ClientHello) JA3() string {
+	sum := md5.Sum([]byte(ch.JA3String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 returns the JA4 fingerprint of the ClientHello over TCP.
+func (ch *ClientHello) JA4() string {
+	ciphers := withoutGREASE(ch.CipherSuites)
+	extensions := withoutGREASE(ch.Extensions)
+
+	sni := "i"
+	for _, e := range extensions {
+		if e == extensionServerName {
+			sni = "d"
+			break
+		}
+	}
+
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ch.ja4Version(), sni,
+		min99(len(ciphers)), min99(len(extensions)), ch.ja4ALPN())
+
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+	b := ja4Hash(joinHex(ciphers))
+
+	sorted := make([]uint16, 0, len(extensions))
+	for _, e := range extensions {
+		if e != extensionServerName && e != extensionALPN {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	c := ""
+	if len(sorted) > 0 {
+		c = joinHex(sorted)
+		if algorithms := withoutGREASE(ch.SignatureAlgorithms); len(algorithms) > 0 {
+			c += "_" + joinHex(algorithms)
+		}
+	}
+
+	return a + "_" + b + "_" + ja4Hash(c)
+}
+
+func (ch *ClientHello) ja4Version() string {
+	version := ch.Version
+	if versions := withoutGREASE(ch.SupportedVersions); len(versions) > 0 {
+		version = 0
+		for _, v := range versions {
+			if v > version {
+				version = v
+			}
+		}
+	}
+
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	default:
+		return "00"
+	}
+}
+
+func (ch *ClientHello) ja4ALPN() string {
+	if len(ch.ALPNProtocols) == 0 || ch.ALPNProtocols[0] == "" {
+		return "00"
+	}
+
+	proto := ch.ALPNProtocols[0]
+	first, last := proto[0], proto[len(proto)-1]
+	if isAlphanumeric(first) && isAlphanumeric(last) {
+		return string([]byte{first, last})
+	}
+
+	h := hex.EncodeToString([]byte(proto))
+	return string([]byte{h[0], h[len(h)-1]})
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func min99(n int) int {
+	if n > 99 {
+		return 99
+	}
+	return n
+}
+
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
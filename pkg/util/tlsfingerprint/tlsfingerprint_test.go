@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tlsfingerprint
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+func uint16s(b *cryptobyte.Builder, values ...uint16) {
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, v := range values {
+			b.AddUint16(v)
+		}
+	})
+}
+
+func extension(b *cryptobyte.Builder, typ uint16, f func(b *cryptobyte.Builder)) {
+	b.AddUint16(typ)
+	b.AddUint16LengthPrefixed(f)
+}
+
+func clientHello() []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(handshakeTypeClientHello)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16(0x0303)
+		b.AddBytes(make([]byte, 32))
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+		uint16s(b, 0x0a0a, 0x1301, 0xc02b, 0x002f)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint8(0) })
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			extension(b, 0x1a1a, func(b *cryptobyte.Builder) {})
+			extension(b, extensionServerName, func(b *cryptobyte.Builder) {
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint8(0)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte("example.com")) })
+				})
+			})
+			extension(b, extensionSupportedGroups, func(b *cryptobyte.Builder) { uint16s(b, 0x2a2a, 29, 23) })
+			extension(b, extensionECPointFormats, func(b *cryptobyte.Builder) {
+				b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint8(0) })
+			})
+			extension(b, extensionSignatureAlgorithms, func(b *cryptobyte.Builder) { uint16s(b, 0x0403, 0x0804) })
+			extension(b, extensionALPN, func(b *cryptobyte.Builder) {
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					for _, proto := range []string{"h2", "http/1.1"} {
+						b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte(proto)) })
+					}
+				})
+			})
+			extension(b, extensionSupportedVersions, func(b *cryptobyte.Builder) {
+				b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint16(0x3a3a)
+					b.AddUint16(0x0304)
+					b.AddUint16(0x0303)
+				})
+			})
+		})
+	})
+	return b.BytesOrPanic()
+}
+
+func records(msg []byte, size int) []byte {
+	var data []byte
+	for len(msg) > 0 {
+		n := size
+		if n > len(msg) {
+			n = len(msg)
+		}
+		data = append(data, recordTypeHandshake, 0x03, 0x01, byte(n>>8), byte(n))
+		data = append(data, msg[:n]...)
+		msg = msg[n:]
+	}
+	return data
+}
+
+func TestFingerprints(t *testing.T) {
+	msg := clientHello()
+	for _, size := range []int{len(msg), 10} {
+		ch, err := Parse(records(msg, size))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if ch.ServerName != "example.com" {
+			t.Errorf("server name should be example.com, but got %s", ch.ServerName)
+		}
+
+		if s := ch.JA3String(); s != "771,4865-49195-47,0-10-11-13-16-43,29-23,0" {
+			t.Errorf("unexpected ja3 string %s", s)
+		}
+		if s := ch.JA3(); s != "0f92d7a0e8b92db0367a29764a06d32a" {
+			t.Errorf("unexpected ja3 %s", s)
+		}
+		if s := ch.JA4(); s != "t13d0306h2_58a34ed92d94_fb71836bce29" {
+			t.Errorf("unexpected ja4 %s", s)
+		}
+	}
+
+	data := records(msg, 10)
+	if _, err := Parse(data[:len(data)-1]); err != ErrIncomplete {
+		t.Errorf("error should be ErrIncomplete, but got %v", err)
+	}
+	if _, err := Parse([]byte("GET / HTTP/1.1\r\n\r\n")); err == nil || err == ErrIncomplete {
+		t.Errorf("plain http should fail, but got %v", err)
+	}
+}
+
+func TestGoClient(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		conn := tls.Client(client, &tls.Config{ServerName: "example.com", NextProtos: []string{"http/1.1"}})
+		conn.Handshake()
+		conn.Close()
+	}()
+
+	var data []byte
+	buff := make([]byte, 1024)
+	for {
+		n, err := server.Read(buff)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		data = append(data, buff[:n]...)
+		ch, err := Parse(data)
+		if err == ErrIncomplete {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if ja4 := ch.JA4(); !strings.HasPrefix(ja4, "t13d") || !strings.Contains(ja4, "h1_") {
+			t.Errorf("unexpected ja4 %s", ja4)
+		}
+		return
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/megaease/easegress/pkg/util/jsontool"
 
@@ -52,7 +53,8 @@ var (
 		DefinitionNameWithPackage:  true,
 		RequiredFromJSONSchemaTags: true,
 	}
-	reflectorSchemaMetas = map[*genjs.Reflector]map[reflect.Type]*schemaMeta{}
+	reflectorSchemaMetas      = map[*genjs.Reflector]map[reflect.Type]*schemaMeta{}
+	reflectorSchemaMetasMutex sync.Mutex
 )
 
 // GetSchemaInYAML returns the json schema of t in yaml format.
@@ -106,7 +108,7 @@ func Validate(v interface{}, yamlBuff []byte) *ValidateRecorder {
 		if ok {
 			err = cv.Validate(yamlBuff)
 			if err != nil {
-				vr.GeneralErrs = append(vr.GeneralErrs, err.Error())
+				vr.recordContent(err)
 			}
 			// if a custom ContentValidator is executed, `custom format validation` and `general validation` are not executed.
 			return vr
@@ -121,6 +123,10 @@ func Validate(v interface{}, yamlBuff []byte) *ValidateRecorder {
 }
 
 func getSchemaMeta(reflector *genjs.Reflector, t reflect.Type) (*schemaMeta, error) {
+	// NOTE: Schemas are got by the admin API and validations concurrently.
+	reflectorSchemaMetasMutex.Lock()
+	defer reflectorSchemaMetasMutex.Unlock()
+
 	schemaMetas, exists := reflectorSchemaMetas[reflector]
 	if !exists {
 		schemaMetas = make(map[reflect.Type]*schemaMeta)
@@ -18,6 +18,7 @@
 package v
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
@@ -52,15 +53,86 @@ type (
 
 		// SystemErr stands internal error, which often means bugs.
 		SystemErr string `yaml:"systemErr,omitempty"`
+
+		fieldErrs []*FieldError
+	}
+
+	// FieldError is a validation error of a field, the fields inside
+	// others are joined by dots, e.g. filters.proxy.mainPool, and the
+	// field of errors of the whole object is empty.
+	FieldError struct {
+		Field   string `yaml:"field"`
+		Message string `yaml:"message"`
+	}
+
+	// fieldError is the error of a field, which could wrap the errors of
+	// the fields inside it.
+	fieldError struct {
+		field string
+		err   error
 	}
 )
 
+// WrapField wraps the error of the field, so it's reported by the field in
+// FieldErrorsOf. The message of it is "<field>: <message of err>".
+func WrapField(field string, err error) error {
+	return &fieldError{field: field, err: err}
+}
+
+func (e *fieldError) Error() string { return e.field + ": " + e.err.Error() }
+func (e *fieldError) Unwrap() error { return e.err }
+
+// FieldErrorsOf returns the errors by fields of the error returned by
+// validating, the field is empty if it's unknown.
+func FieldErrorsOf(err error) []*FieldError {
+	return fieldErrorsOf("", err)
+}
+
+func fieldErrorsOf(prefix string, err error) []*FieldError {
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		return fieldErrorsOf(joinField(prefix, fe.field), fe.err)
+	}
+
+	var vr *ValidateRecorder
+	if errors.As(err, &vr) {
+		var errs []*FieldError
+		for _, e := range vr.fieldErrs {
+			errs = append(errs, &FieldError{Field: joinField(prefix, e.Field), Message: e.Message})
+		}
+		return errs
+	}
+
+	return []*FieldError{{Field: prefix, Message: err.Error()}}
+}
+
+func joinField(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	if field == "" {
+		return prefix
+	}
+	return prefix + "." + field
+}
+
 func (vr *ValidateRecorder) recordJSONSchema(result *loadjs.Result) {
 	for _, err := range result.Errors() {
 		vr.JSONSchemaErrs = append(vr.JSONSchemaErrs, err.String())
+
+		field := err.Field()
+		if field == loadjs.STRING_ROOT_SCHEMA_PROPERTY {
+			field = ""
+		}
+		vr.fieldErrs = append(vr.fieldErrs, &FieldError{Field: field, Message: err.Description()})
 	}
 }
 
+func (vr *ValidateRecorder) recordContent(err error) {
+	vr.GeneralErrs = append(vr.GeneralErrs, err.Error())
+	vr.fieldErrs = append(vr.fieldErrs, FieldErrorsOf(err)...)
+}
+
 func getFieldYAMLName(field *reflect.StructField) string {
 	fieldName := field.Name
 
@@ -123,6 +195,10 @@ func (vr *ValidateRecorder) recordFormat(val *reflect.Value, field *reflect.Stru
 				fmt.Sprintf("%s: %s",
 					getFieldYAMLName(field),
 					err.Error()))
+			vr.fieldErrs = append(vr.fieldErrs, &FieldError{
+				Field:   getFieldYAMLName(field),
+				Message: err.Error(),
+			})
 		}
 	}
 }
@@ -152,12 +228,19 @@ func (vr *ValidateRecorder) recordGeneral(val *reflect.Value, field *reflect.Str
 		vr.GeneralErrs = append(vr.GeneralErrs, fmt.Sprintf("%s: %s",
 			fieldName,
 			err.Error()))
+
+		var prefix string
+		if field != nil {
+			prefix = fieldName
+		}
+		vr.fieldErrs = append(vr.fieldErrs, fieldErrorsOf(prefix, err)...)
 	}
 }
 
 func (vr *ValidateRecorder) recordSystem(err error) {
 	if err != nil {
 		vr.SystemErr = err.Error()
+		vr.fieldErrs = append(vr.fieldErrs, &FieldError{Message: err.Error()})
 	}
 }
 